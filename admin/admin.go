@@ -0,0 +1,165 @@
+// Package admin serves the operational endpoints every service exposes,
+// /metrics and /debug/pprof, on a separate port from its API so they are
+// never reachable through the public ingress. Health endpoints can be
+// mounted too, for probes that target the admin port.
+//
+// Importing net/http/pprof registers its handlers on
+// http.DefaultServeMux as a side effect, which importing this package
+// can't avoid. The admin handler registers them on its own mux instead,
+// so never serve http.DefaultServeMux (a nil handler) on a public port.
+//
+//	go admin.Serve(ctx, ":9090",
+//		admin.Gatherer(prometheus.DefaultGatherer),
+//		admin.Health(checks),
+//		admin.BearerToken(os.Getenv("ADMIN_TOKEN")),
+//		admin.Logger(logger),
+//	)
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	// Also registers on http.DefaultServeMux; see the package doc.
+	"net/http/pprof"
+	"strings"
+
+	"github.com/jdotw/go-utils/health"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/metrics"
+	"github.com/jdotw/go-utils/transport"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type options struct {
+	gatherer prometheus.Gatherer
+	health   *health.Registry
+	auth     func(*http.Request) bool
+	pprof    bool
+	logger   log.Factory
+}
+
+// Option configures the admin handler.
+type Option func(*options)
+
+// Gatherer exposes the metrics gathered by g. It defaults to
+// prometheus.DefaultGatherer.
+func Gatherer(g prometheus.Gatherer) Option {
+	return func(o *options) {
+		o.gatherer = g
+	}
+}
+
+// Health mounts the registry's /livez, /readyz and /healthz endpoints,
+// which are served without authentication so probes can reach them.
+func Health(registry *health.Registry) Option {
+	return func(o *options) {
+		o.health = registry
+	}
+}
+
+// Auth requires requests to the metrics and profiling endpoints to be
+// allowed by fn, responding 401 otherwise.
+func Auth(fn func(*http.Request) bool) Option {
+	return func(o *options) {
+		o.auth = fn
+	}
+}
+
+// BasicAuth requires HTTP basic authentication with username and
+// password. An empty password leaves the endpoints open.
+func BasicAuth(username, password string) Option {
+	if password == "" {
+		return func(*options) {}
+	}
+	return Auth(func(r *http.Request) bool {
+		u, p, ok := r.BasicAuth()
+		return ok && equal(u, username) && equal(p, password)
+	})
+}
+
+// BearerToken requires an Authorization: Bearer header with token. An
+// empty token leaves the endpoints open.
+func BearerToken(token string) Option {
+	if token == "" {
+		return func(*options) {}
+	}
+	return Auth(func(r *http.Request) bool {
+		t := r.Header.Get("Authorization")
+		return strings.HasPrefix(t, "Bearer ") && equal(strings.TrimPrefix(t, "Bearer "), token)
+	})
+}
+
+// WithoutPprof leaves out the profiling endpoints.
+func WithoutPprof() Option {
+	return func(o *options) {
+		o.pprof = false
+	}
+}
+
+// Logger logs the admin server's lifecycle when started with Serve.
+func Logger(logger log.Factory) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func newOptions(opts []Option) options {
+	o := options{pprof: true}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// NewHandler returns a handler serving /metrics and /debug/pprof/, plus
+// the health endpoints when configured.
+func NewHandler(opts ...Option) http.Handler {
+	return newHandler(newOptions(opts))
+}
+
+func newHandler(o options) http.Handler {
+	mux := http.NewServeMux()
+	protect := func(h http.Handler) http.Handler {
+		if o.auth == nil {
+			return h
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !o.auth(r) {
+				w.Header().Set("WWW-Authenticate", `Basic realm="admin"`)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+
+	mux.Handle("/metrics", protect(metrics.Handler(o.gatherer)))
+	if o.pprof {
+		mux.Handle("/debug/pprof/", protect(http.HandlerFunc(pprof.Index)))
+		mux.Handle("/debug/pprof/cmdline", protect(http.HandlerFunc(pprof.Cmdline)))
+		mux.Handle("/debug/pprof/profile", protect(http.HandlerFunc(pprof.Profile)))
+		mux.Handle("/debug/pprof/symbol", protect(http.HandlerFunc(pprof.Symbol)))
+		mux.Handle("/debug/pprof/trace", protect(http.HandlerFunc(pprof.Trace)))
+	}
+	if o.health != nil {
+		o.health.Mount(mux)
+	}
+	return mux
+}
+
+// Serve serves the admin handler on addr until ctx is cancelled. Unlike
+// the API server it doesn't wait for a grace period on shutdown, since
+// scrapes and profiles can be retried.
+func Serve(ctx context.Context, addr string, opts ...Option) error {
+	o := newOptions(opts)
+	serveOpts := []transport.ServeOption{transport.ServeGracePeriod(0)}
+	if o.logger != nil {
+		serveOpts = append(serveOpts, transport.ServeLogger(log.Named(o.logger, "admin")))
+	}
+	return transport.Serve(ctx, addr, newHandler(o), serveOpts...)
+}
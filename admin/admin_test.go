@@ -0,0 +1,64 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jdotw/go-utils/health"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestNewHandler(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{Name: "widgets_total", Help: "Widgets."}))
+	h := NewHandler(Gatherer(registry), Health(health.NewRegistry()), BearerToken("secret"))
+
+	tests := []struct {
+		path   string
+		token  string
+		status int
+	}{
+		{"/metrics", "", http.StatusUnauthorized},
+		{"/metrics", "wrong", http.StatusUnauthorized},
+		{"/metrics", "secret", http.StatusOK},
+		{"/debug/pprof/", "", http.StatusUnauthorized},
+		{"/debug/pprof/", "secret", http.StatusOK},
+		{"/livez", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("%s with token %q: expected %d, got %d", tt.path, tt.token, tt.status, w.Code)
+		}
+		if tt.path == "/metrics" && w.Code == http.StatusOK && !strings.Contains(w.Body.String(), "widgets_total 0") {
+			t.Errorf("expected the gatherer's metrics, got %s", w.Body.String())
+		}
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	h := NewHandler(Gatherer(prometheus.NewRegistry()), BasicAuth("ops", "pa55"), WithoutPprof())
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.SetBasicAuth("ops", "pa55")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200 with valid credentials, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil)
+	req.SetBasicAuth("ops", "pa55")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected profiling to be disabled, got %d", w.Code)
+	}
+}
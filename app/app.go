@@ -0,0 +1,414 @@
+// Package app bootstraps a service: it loads configuration, initializes
+// logging, tracing and metrics, serves HTTP, gRPC and the admin
+// endpoints, runs lifecycle hooks and shuts everything down gracefully,
+// so a service's main is a few lines:
+//
+//	func main() {
+//		var cfg Config // embeds app.Config
+//		a, err := app.New("orders", app.WithConfig(&cfg))
+//		if err != nil {
+//			panic(err)
+//		}
+//		db, err := db.Open(ctx, cfg.DB, db.Logger(a.Logger), db.Tracer(a.Tracer), db.Health(a.Health))
+//		...
+//		a.HTTP(makeHandler(a, db))
+//		a.OnStop(func(ctx context.Context) error { return closeDB(db) })
+//		if err := a.Run(context.Background()); err != nil {
+//			a.Logger.Bg().Fatal("Service failed", zap.Error(err))
+//		}
+//	}
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jdotw/go-utils/admin"
+	"github.com/jdotw/go-utils/config"
+	"github.com/jdotw/go-utils/health"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/metrics"
+	"github.com/jdotw/go-utils/reload"
+	"github.com/jdotw/go-utils/tracing"
+	"github.com/jdotw/go-utils/transport"
+	grpctransport "github.com/jdotw/go-utils/transport/grpc"
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// Config holds the settings every service shares. Embed it in the
+// service's own config struct and load that with WithConfig.
+type Config struct {
+	HTTPAddr  string `json:"http_addr" env:"HTTP_ADDR" default:":8080"`
+	GRPCAddr  string `json:"grpc_addr" env:"GRPC_ADDR" default:":9000"`
+	AdminAddr string `json:"admin_addr" env:"ADMIN_ADDR" default:":9090"`
+	// AdminToken protects the metrics and profiling endpoints with a
+	// bearer token when set.
+	AdminToken string `json:"-" env:"ADMIN_TOKEN"`
+	// GracePeriod is how long in-flight requests have to finish on
+	// shutdown.
+	GracePeriod time.Duration `json:"grace_period" env:"SHUTDOWN_GRACE_PERIOD" default:"30s"`
+	// DrainDelay keeps serving with /readyz failing for this long after a
+	// shutdown signal, so load balancers stop routing first.
+	DrainDelay time.Duration `json:"drain_delay" env:"SHUTDOWN_DRAIN_DELAY" default:"5s"`
+}
+
+// configurer is implemented by config structs embedding Config.
+type configurer interface {
+	appConfig() *Config
+}
+
+func (c *Config) appConfig() *Config {
+	return c
+}
+
+// Hook is run when the app starts or stops.
+type Hook func(ctx context.Context) error
+
+type options struct {
+	cfg        interface{}
+	configOpts []config.Option
+	logOpts    []log.Option
+	logger     log.Factory
+	tracer     opentracing.Tracer
+	registerer prometheus.Registerer
+	gatherer   prometheus.Gatherer
+	signals    []os.Signal
+	reloadOpts []reload.Option
+}
+
+// Option configures New.
+type Option func(*options)
+
+// WithConfig loads cfg with the config package before anything else is
+// initialized. When cfg embeds Config, the app's servers use it;
+// otherwise Config is loaded on its own.
+func WithConfig(cfg interface{}, opts ...config.Option) Option {
+	return func(o *options) {
+		o.cfg = cfg
+		o.configOpts = opts
+	}
+}
+
+// LogOptions are passed to log.Init.
+func LogOptions(opts ...log.Option) Option {
+	return func(o *options) {
+		o.logOpts = append(o.logOpts, opts...)
+	}
+}
+
+// WithLogger uses logger rather than initializing one with log.Init.
+func WithLogger(logger log.Factory) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithTracer uses tracer rather than initializing one with tracing.Init.
+func WithTracer(tracer opentracing.Tracer) Option {
+	return func(o *options) {
+		o.tracer = tracer
+	}
+}
+
+// WithRegistry registers and exposes metrics with registry rather than
+// the Prometheus defaults.
+func WithRegistry(registry *prometheus.Registry) Option {
+	return func(o *options) {
+		o.registerer = registry
+		o.gatherer = registry
+	}
+}
+
+// Signals overrides the signals that trigger shutdown, which default to
+// SIGINT and SIGTERM.
+func Signals(signals ...os.Signal) Option {
+	return func(o *options) {
+		o.signals = signals
+	}
+}
+
+// ReloadOptions configure the app's Reloader, such as to watch config
+// files with reload.WatchFiles. Unlike a Reloader from reload.New, the
+// app's doesn't catch SIGHUP unless asked to with
+// reload.Signals(syscall.SIGHUP), leaving the signal's default handling
+// alone for services that don't reload.
+func ReloadOptions(opts ...reload.Option) Option {
+	return func(o *options) {
+		o.reloadOpts = append(o.reloadOpts, opts...)
+	}
+}
+
+// App is a service's runtime: its shared dependencies, servers and
+// lifecycle hooks.
+type App struct {
+	Name   string
+	Config *Config
+	Logger log.Factory
+	Tracer opentracing.Tracer
+	// Registerer registers the service's metrics.
+	Registerer prometheus.Registerer
+	// RED records request metrics for endpoints.
+	RED *metrics.RED
+	// Health holds the checks served on /livez, /readyz and /healthz.
+	Health *health.Registry
+	// Reloader reloads the subsystems registered with it while Run runs.
+	Reloader *reload.Reloader
+
+	gatherer prometheus.Gatherer
+	signals  []os.Signal
+	handler  http.Handler
+	grpc     *grpctransport.Server
+	onStart  []Hook
+	onStop   []Hook
+
+	mu    sync.Mutex
+	addrs map[string]net.Addr
+}
+
+// New loads configuration and initializes logging, tracing and metrics
+// for the service called name.
+func New(name string, opts ...Option) (*App, error) {
+	o := options{
+		registerer: prometheus.DefaultRegisterer,
+		gatherer:   prometheus.DefaultGatherer,
+		signals:    []os.Signal{os.Interrupt, syscall.SIGTERM},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	cfg := &Config{}
+	c, embedded := o.cfg.(configurer)
+	if embedded {
+		cfg = c.appConfig()
+	}
+	if o.cfg != nil {
+		if err := config.Load(o.cfg, o.configOpts...); err != nil {
+			return nil, err
+		}
+	}
+	if !embedded {
+		if err := config.Load(cfg, o.configOpts...); err != nil {
+			return nil, err
+		}
+	}
+
+	a := &App{
+		Name:       name,
+		Config:     cfg,
+		Logger:     o.logger,
+		Tracer:     o.tracer,
+		Registerer: o.registerer,
+		RED:        metrics.NewRED(o.registerer, ""),
+		Health:     health.NewRegistry(),
+		gatherer:   o.gatherer,
+		signals:    o.signals,
+		addrs:      make(map[string]net.Addr),
+	}
+	if a.Logger == nil || a.Tracer == nil {
+		logger, metricsFactory := log.Init(name, append([]log.Option{log.ErrorCounter(o.registerer)}, o.logOpts...)...)
+		if a.Logger == nil {
+			a.Logger = logger
+		}
+		if a.Tracer == nil {
+			a.Tracer = tracing.Init(name, metricsFactory, a.Logger)
+		}
+	}
+	a.Reloader = reload.New(a.Logger, append([]reload.Option{reload.Signals()}, o.reloadOpts...)...)
+	return a, nil
+}
+
+// HTTP serves handler on Config.HTTPAddr.
+func (a *App) HTTP(handler http.Handler) {
+	a.handler = handler
+}
+
+// NewGRPCServer returns a gRPC server using the app's logger, tracer,
+// grace period and drain delay, for serving with GRPC. opts are applied
+// after those.
+func (a *App) NewGRPCServer(opts ...grpctransport.ServerOption) *grpctransport.Server {
+	opts = append([]grpctransport.ServerOption{
+		grpctransport.GracePeriod(a.Config.GracePeriod),
+		grpctransport.DrainDelay(a.Config.DrainDelay),
+	}, opts...)
+	return grpctransport.NewServer(a.Logger, a.Tracer, opts...)
+}
+
+// GRPC serves server on Config.GRPCAddr, with its own grace period and
+// drain delay; create it with NewGRPCServer to use the app's.
+func (a *App) GRPC(server *grpctransport.Server) {
+	a.grpc = server
+}
+
+// OnStart adds a hook run before the servers start. Run fails if a hook
+// does, after running the stop hooks.
+func (a *App) OnStart(hook Hook) {
+	a.onStart = append(a.onStart, hook)
+}
+
+// OnStop adds a hook run after the servers stop, in reverse order of
+// addition, with the grace period as the deadline.
+func (a *App) OnStop(hook Hook) {
+	a.onStop = append(a.onStop, hook)
+}
+
+// Addr returns the address the "http", "grpc" or "admin" server is
+// listening on, once Run has started it.
+func (a *App) Addr(server string) net.Addr {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.addrs[server]
+}
+
+func (a *App) listen(server, addr string) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("%s server: %w", server, err)
+	}
+	a.mu.Lock()
+	a.addrs[server] = ln.Addr()
+	a.mu.Unlock()
+	return ln, nil
+}
+
+// Run starts the app and blocks until ctx is cancelled, a shutdown
+// signal arrives or a server fails. It then drains and stops the
+// servers, runs the stop hooks, and flushes tracing and logging. It
+// returns nil after a clean shutdown.
+func (a *App) Run(ctx context.Context) (err error) {
+	defer a.flush()
+	ctx, stop := signal.NotifyContext(ctx, a.signals...)
+	defer stop()
+
+	var listeners []net.Listener
+	closeListeners := func() {
+		for _, ln := range listeners {
+			ln.Close()
+		}
+	}
+	var httpLn, grpcLn, adminLn net.Listener
+	if a.handler != nil {
+		if httpLn, err = a.listen("http", a.Config.HTTPAddr); err != nil {
+			return err
+		}
+		listeners = append(listeners, httpLn)
+	}
+	if a.grpc != nil {
+		if grpcLn, err = a.listen("grpc", a.Config.GRPCAddr); err != nil {
+			closeListeners()
+			return err
+		}
+		listeners = append(listeners, grpcLn)
+	}
+	if a.Config.AdminAddr != "" {
+		if adminLn, err = a.listen("admin", a.Config.AdminAddr); err != nil {
+			closeListeners()
+			return err
+		}
+		listeners = append(listeners, adminLn)
+	}
+
+	for _, hook := range a.onStart {
+		if err := hook(ctx); err != nil {
+			closeListeners()
+			a.stop()
+			return err
+		}
+	}
+
+	// serveCtx is cancelled to stop the servers, on shutdown or when one
+	// of them fails
+	serveCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errc := make(chan error, 4)
+	var wg sync.WaitGroup
+	serve := func(fn func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(); err != nil {
+				errc <- err
+				cancel()
+			}
+		}()
+	}
+
+	if httpLn != nil {
+		serve(func() error {
+			return transport.ServeListener(serveCtx, httpLn, a.handler,
+				transport.ServeSignals(a.signals...),
+				transport.ServeGracePeriod(a.Config.GracePeriod),
+				transport.ServeDrainDelay(a.Config.DrainDelay),
+				transport.ServeHealth(a.Health),
+				transport.ServeLogger(a.Logger),
+			)
+		})
+	}
+	if grpcLn != nil {
+		serve(func() error {
+			return grpctransport.ServeListener(serveCtx, grpcLn, a.grpc)
+		})
+	}
+	if adminLn != nil {
+		handler := admin.NewHandler(admin.Gatherer(a.gatherer), admin.Health(a.Health), admin.BearerToken(a.Config.AdminToken))
+		serve(func() error {
+			return transport.ServeListener(serveCtx, adminLn, handler,
+				transport.ServeSignals(a.signals...),
+				transport.ServeGracePeriod(0),
+			)
+		})
+	}
+	serve(func() error {
+		return a.Reloader.Run(serveCtx)
+	})
+	a.Logger.Bg().Info("Service started", zap.String("service", a.Name))
+
+	<-serveCtx.Done()
+	wg.Wait()
+	close(errc)
+	for e := range errc {
+		if err == nil {
+			err = e
+		}
+	}
+	if stopErr := a.stop(); err == nil {
+		err = stopErr
+	}
+	a.Logger.Bg().Info("Service stopped", zap.String("service", a.Name))
+	return err
+}
+
+// stop runs the stop hooks in reverse order, returning the first error.
+func (a *App) stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), a.Config.GracePeriod)
+	defer cancel()
+	var first error
+	for i := len(a.onStop) - 1; i >= 0; i-- {
+		if err := a.onStop[i](ctx); err != nil {
+			a.Logger.Bg().Error("Stop hook failed", zap.Error(err))
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+func (a *App) flush() {
+	if closer, ok := a.Tracer.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			a.Logger.Bg().Error("Failed to flush tracer", zap.Error(err))
+		}
+	}
+	log.Sync(a.Logger)
+}
@@ -0,0 +1,145 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jdotw/go-utils/config"
+	"github.com/jdotw/go-utils/log"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type serviceConfig struct {
+	Config
+	Greeting string `json:"greeting" env:"GREETING" default:"hello"`
+}
+
+func testEnv(env map[string]string) config.Option {
+	return config.Lookup(func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	})
+}
+
+func newTestApp(t *testing.T, cfg *serviceConfig) *App {
+	t.Helper()
+	env := testEnv(map[string]string{
+		"HTTP_ADDR":             "127.0.0.1:0",
+		"GRPC_ADDR":             "127.0.0.1:0",
+		"ADMIN_ADDR":            "127.0.0.1:0",
+		"SHUTDOWN_DRAIN_DELAY":  "0s",
+		"SHUTDOWN_GRACE_PERIOD": "1s",
+	})
+	a, err := New("test", WithConfig(cfg, env),
+		WithLogger(log.NewMockLogFactory()),
+		WithTracer(mocktracer.New()),
+		WithRegistry(prometheus.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestNewLoadsEmbeddedConfig(t *testing.T) {
+	var cfg serviceConfig
+	a := newTestApp(t, &cfg)
+	if a.Config != &cfg.Config {
+		t.Error("expected the app to use the embedded config")
+	}
+	if cfg.HTTPAddr != "127.0.0.1:0" || cfg.GracePeriod != time.Second || cfg.Greeting != "hello" {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+}
+
+func TestRun(t *testing.T) {
+	var cfg serviceConfig
+	a := newTestApp(t, &cfg)
+	a.HTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(cfg.Greeting))
+	}))
+	a.GRPC(a.NewGRPCServer())
+
+	var events []string
+	a.OnStart(func(ctx context.Context) error {
+		events = append(events, "start")
+		return nil
+	})
+	a.OnStop(func(ctx context.Context) error {
+		events = append(events, "stop db")
+		return nil
+	})
+	a.OnStop(func(ctx context.Context) error {
+		events = append(events, "stop cache")
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- a.Run(ctx)
+	}()
+
+	var addr string
+	for i := 0; i < 100 && addr == ""; i++ {
+		if a.Addr("admin") != nil {
+			addr = a.Addr("http").String()
+		} else {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	get := func(url string) (int, string) {
+		for i := 0; i < 50; i++ {
+			resp, err := http.Get(url)
+			if err == nil {
+				defer resp.Body.Close()
+				body, _ := io.ReadAll(resp.Body)
+				return resp.StatusCode, string(body)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("GET %s failed", url)
+		return 0, ""
+	}
+	if code, body := get("http://" + addr + "/"); code != http.StatusOK || body != "hello" {
+		t.Errorf("unexpected response %d %q", code, body)
+	}
+	if code, _ := get("http://" + a.Addr("admin").String() + "/readyz"); code != http.StatusOK {
+		t.Errorf("expected the admin server to serve health checks, got %d", code)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancellation")
+	}
+	if len(events) != 3 || events[0] != "start" || events[1] != "stop cache" || events[2] != "stop db" {
+		t.Errorf("unexpected hook order %v", events)
+	}
+}
+
+func TestRunStartHookFails(t *testing.T) {
+	var cfg serviceConfig
+	a := newTestApp(t, &cfg)
+	errFailed := errors.New("migrations failed")
+	stopped := false
+	a.OnStart(func(ctx context.Context) error { return errFailed })
+	a.OnStop(func(ctx context.Context) error {
+		stopped = true
+		return nil
+	})
+	if err := a.Run(context.Background()); err != errFailed {
+		t.Errorf("expected the start hook's error, got %v", err)
+	}
+	if !stopped {
+		t.Error("expected stop hooks to run after a failed start")
+	}
+}
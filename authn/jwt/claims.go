@@ -0,0 +1,62 @@
+package jwt
+
+import (
+	"context"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// TokenFromContext returns the raw JWT moved to the context by the
+// transport, or an empty string. Pass it to httpclient.ForwardToken to
+// call other services on behalf of the caller.
+func TokenFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(JWTContextKey).(string)
+	return token
+}
+
+// ClaimsFromContext returns the claims stored by the parsing middleware,
+// or nil if the request was not authenticated.
+func ClaimsFromContext(ctx context.Context) jwt.Claims {
+	claims, _ := ctx.Value(JWTClaimsContextKey).(jwt.Claims)
+	return claims
+}
+
+// SubjectFromContext returns the subject (sub) claim of the JWT parsed by
+// the middleware, or an empty string.
+func SubjectFromContext(ctx context.Context) string {
+	switch claims := ClaimsFromContext(ctx).(type) {
+	case jwt.MapClaims:
+		sub, _ := claims["sub"].(string)
+		return sub
+	case *jwt.StandardClaims:
+		return claims.Subject
+	case *jwt.RegisteredClaims:
+		return claims.Subject
+	}
+	return ""
+}
+
+// RolesFromClaims returns the roles claim of a JWT, given either as an
+// array of strings or a space separated string.
+func RolesFromClaims(claims jwt.Claims) []string {
+	mc, ok := claims.(jwt.MapClaims)
+	if !ok {
+		return nil
+	}
+	switch roles := mc["roles"].(type) {
+	case []interface{}:
+		out := make([]string, 0, len(roles))
+		for _, r := range roles {
+			if s, ok := r.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	case []string:
+		return roles
+	case string:
+		return strings.Fields(roles)
+	}
+	return nil
+}
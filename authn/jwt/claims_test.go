@@ -0,0 +1,47 @@
+package jwt
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestSubjectFromContext(t *testing.T) {
+	tests := []struct {
+		claims jwt.Claims
+		want   string
+	}{
+		{jwt.MapClaims{"sub": "user-1"}, "user-1"},
+		{&jwt.StandardClaims{Subject: "user-2"}, "user-2"},
+		{&jwt.RegisteredClaims{Subject: "user-3"}, "user-3"},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		if tt.claims != nil {
+			ctx = context.WithValue(ctx, JWTClaimsContextKey, tt.claims)
+		}
+		if have := SubjectFromContext(ctx); have != tt.want {
+			t.Errorf("unexpected subject; expected %q, got %q", tt.want, have)
+		}
+	}
+}
+
+func TestRolesFromClaims(t *testing.T) {
+	tests := []struct {
+		claims jwt.Claims
+		want   []string
+	}{
+		{jwt.MapClaims{"roles": []interface{}{"admin", "reader"}}, []string{"admin", "reader"}},
+		{jwt.MapClaims{"roles": "admin reader"}, []string{"admin", "reader"}},
+		{jwt.MapClaims{"sub": "user-1"}, nil},
+		{&jwt.StandardClaims{Subject: "user-2"}, nil},
+	}
+	for _, tt := range tests {
+		if have := RolesFromClaims(tt.claims); !reflect.DeepEqual(have, tt.want) {
+			t.Errorf("unexpected roles; expected %v, got %v", tt.want, have)
+		}
+	}
+}
@@ -5,10 +5,17 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/go-kit/kit/endpoint"
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/jdotw/go-utils/clock"
+	"github.com/jdotw/go-utils/errorsx"
+	"github.com/jdotw/go-utils/httpclient"
+	"github.com/jdotw/go-utils/identity"
 	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/retry"
 	"github.com/jdotw/go-utils/tracing"
 	"github.com/opentracing/opentracing-go"
 	"go.uber.org/zap"
@@ -31,27 +38,28 @@ const (
 	JWTDecodedTokenContextKey contextKey = "JWTDecodedToken"
 )
 
+// The token errors are unauthenticated errors, so they respond 401.
 var (
 	// ErrTokenContextMissing denotes a token was not passed into the parsing
 	// middleware's context.
-	ErrTokenContextMissing = errors.New("JWT not present")
+	ErrTokenContextMissing = errorsx.Sentinel(errorsx.CodeUnauthenticated, "JWT not present")
 
 	// ErrTokenInvalid denotes a token was not able to be validated.
-	ErrTokenInvalid = errors.New("JWT was invalid")
+	ErrTokenInvalid = errorsx.Sentinel(errorsx.CodeUnauthenticated, "JWT was invalid")
 
 	// ErrTokenExpired denotes a token's expire header (exp) has since passed.
-	ErrTokenExpired = errors.New("JWT is expired")
+	ErrTokenExpired = errorsx.Sentinel(errorsx.CodeUnauthenticated, "JWT is expired")
 
 	// ErrTokenMalformed denotes a token was not formatted as a JWT.
-	ErrTokenMalformed = errors.New("JWT is malformed")
+	ErrTokenMalformed = errorsx.Sentinel(errorsx.CodeUnauthenticated, "JWT is malformed")
 
 	// ErrTokenNotActive denotes a token's not before header (nbf) is in the
 	// future.
-	ErrTokenNotActive = errors.New("token is not valid yet")
+	ErrTokenNotActive = errorsx.Sentinel(errorsx.CodeUnauthenticated, "token is not valid yet")
 
 	// ErrUnexpectedSigningMethod denotes a token was signed with an unexpected
 	// signing method.
-	ErrUnexpectedSigningMethod = errors.New("unexpected signing method")
+	ErrUnexpectedSigningMethod = errorsx.Sentinel(errorsx.CodeUnauthenticated, "unexpected signing method")
 )
 
 type Jwks struct {
@@ -72,13 +80,23 @@ type JSONWebKeys struct {
 // Tokens are signed with a Key ID header (kid) which is useful for determining
 // the key to use for parsing. Particularly useful for clients.
 func NewSigner(kid string, key []byte, method jwt.SigningMethod, claims jwt.Claims) endpoint.Middleware {
+	return NewKeySigner(kid, func(context.Context) ([]byte, error) { return key, nil }, method, claims)
+}
+
+// NewKeySigner is NewSigner with the key read for each request, so keys
+// held by a secrets provider can be rotated without a restart.
+func NewKeySigner(kid string, key func(ctx context.Context) ([]byte, error), method jwt.SigningMethod, claims jwt.Claims) endpoint.Middleware {
 	return func(next endpoint.Endpoint) endpoint.Endpoint {
 		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			k, err := key(ctx)
+			if err != nil {
+				return nil, err
+			}
 			token := jwt.NewWithClaims(method, claims)
 			token.Header["kid"] = kid
 
 			// Sign and get the complete encoded token as a string using the secret
-			tokenString, err := token.SignedString(key)
+			tokenString, err := token.SignedString(k)
 			if err != nil {
 				return nil, err
 			}
@@ -109,33 +127,100 @@ func StandardClaimsFactory() jwt.Claims {
 // jdotw/go-utils Additions
 //
 
+// DefaultJWKSRefreshInterval is how often an Authenticator fetches the
+// JWKS again, picking up rotated signing keys.
+const DefaultJWKSRefreshInterval = time.Hour
+
+// DefaultJWKSMinRefreshInterval is the minimum time between the fetches
+// an Authenticator makes for tokens signed with a key it doesn't have.
+const DefaultJWKSMinRefreshInterval = time.Minute
+
 type Authenticator struct {
 	logger log.Factory
 	tracer opentracing.Tracer
+	clock  clock.Clock
+
+	jwks       *jwksCache
+	jwksURL    string
+	refresh    time.Duration
+	minRefresh time.Duration
+	client     *http.Client
+}
 
-	jwks    *Jwks
-	jwksURL string
+// jwksCache is shared by copies of an Authenticator.
+type jwksCache struct {
+	mu        sync.Mutex
+	jwks      *Jwks
+	fetchedAt time.Time
+	// refreshing is closed when the fetch in progress, if any, completes
+	refreshing chan struct{}
+	// unknownAt is when a token with an unknown key ID last caused a fetch
+	unknownAt time.Time
 }
 
-func NewAuthenticator(logger log.Factory, tracer opentracing.Tracer, jwksURL string) Authenticator {
+// AuthenticatorOption configures an Authenticator.
+type AuthenticatorOption func(*Authenticator)
+
+// WithClock makes the Authenticator check token expiry and JWKS age with
+// c rather than the system clock.
+func WithClock(c clock.Clock) AuthenticatorOption {
+	return func(a *Authenticator) {
+		a.clock = c
+	}
+}
+
+// JWKSRefreshInterval sets how often the JWKS is fetched again,
+// DefaultJWKSRefreshInterval by default. Zero fetches it only once.
+func JWKSRefreshInterval(d time.Duration) AuthenticatorOption {
+	return func(a *Authenticator) {
+		a.refresh = d
+	}
+}
+
+// JWKSMinRefreshInterval sets the minimum time between fetches for
+// tokens signed with a key the JWKS doesn't have,
+// DefaultJWKSMinRefreshInterval by default. It stops tokens with made up
+// key IDs from making the Authenticator fetch the JWKS on every request.
+func JWKSMinRefreshInterval(d time.Duration) AuthenticatorOption {
+	return func(a *Authenticator) {
+		a.minRefresh = d
+	}
+}
+
+func NewAuthenticator(logger log.Factory, tracer opentracing.Tracer, jwksURL string, opts ...AuthenticatorOption) Authenticator {
 	a := Authenticator{
-		logger:  logger,
-		tracer:  tracer,
-		jwksURL: jwksURL,
+		logger:     logger,
+		tracer:     tracer,
+		clock:      clock.New(),
+		jwks:       &jwksCache{},
+		jwksURL:    jwksURL,
+		refresh:    DefaultJWKSRefreshInterval,
+		minRefresh: DefaultJWKSMinRefreshInterval,
+		client: httpclient.New("jwks", logger, tracer,
+			httpclient.Retry(retry.DefaultPolicy()),
+			httpclient.CheckStatus(),
+		),
+	}
+	for _, opt := range opts {
+		opt(&a)
 	}
 
-	jwks, err := a.getJWKS()
+	jwks, err := a.getJWKS(context.Background())
 	if err != nil {
 		a.logger.Bg().Fatal(err.Error())
 	}
-	a.jwks = jwks
+	a.jwks.jwks = jwks
+	a.jwks.fetchedAt = a.clock.Now()
 
 	return a
 }
 
-func (a *Authenticator) getJWKS() (*Jwks, error) {
-	resp, err := http.Get(a.jwksURL)
-
+func (a *Authenticator) getJWKS(ctx context.Context) (*Jwks, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.jwksURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := a.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -150,6 +235,94 @@ func (a *Authenticator) getJWKS() (*Jwks, error) {
 	return &jwks, nil
 }
 
+// currentJWKS returns the JWKS. Once it is older than the refresh
+// interval it is fetched again in the background, while requests carry
+// on with the previous keys.
+func (a *Authenticator) currentJWKS() *Jwks {
+	a.jwks.mu.Lock()
+	defer a.jwks.mu.Unlock()
+	if a.refresh > 0 && a.clock.Since(a.jwks.fetchedAt) >= a.refresh {
+		a.refreshJWKS()
+	}
+	return a.jwks.jwks
+}
+
+// refreshJWKS starts fetching the JWKS in the background unless a fetch
+// is already in progress, and returns a channel closed once the fetch
+// completes. The previous keys are kept if the fetch fails, and tried
+// again after another interval. It must be called with the lock held.
+func (a *Authenticator) refreshJWKS() <-chan struct{} {
+	if a.jwks.refreshing != nil {
+		return a.jwks.refreshing
+	}
+	done := make(chan struct{})
+	a.jwks.refreshing = done
+	go func() {
+		jwks, err := a.getJWKS(context.Background())
+
+		a.jwks.mu.Lock()
+		defer a.jwks.mu.Unlock()
+		a.jwks.refreshing = nil
+		a.jwks.fetchedAt = a.clock.Now()
+		if err != nil {
+			a.logger.Bg().Error("Failed to refresh JWKS, using previous keys", zap.Error(err))
+		} else {
+			a.jwks.jwks = jwks
+		}
+		close(done)
+	}()
+	return done
+}
+
+// findKey returns the key with ID kid. If the JWKS doesn't have it, such
+// as just after the identity provider rotates its keys, the JWKS is
+// fetched again and the request waits for it, at most once per minimum
+// refresh interval.
+func (a *Authenticator) findKey(kid interface{}) *JSONWebKeys {
+	if key := keyWithID(a.currentJWKS(), kid); key != nil {
+		return key
+	}
+
+	a.jwks.mu.Lock()
+	if a.jwks.refreshing == nil {
+		if a.clock.Since(a.jwks.unknownAt) < a.minRefresh {
+			a.jwks.mu.Unlock()
+			return nil
+		}
+		a.jwks.unknownAt = a.clock.Now()
+	}
+	done := a.refreshJWKS()
+	a.jwks.mu.Unlock()
+
+	<-done
+	return keyWithID(a.currentJWKS(), kid)
+}
+
+func keyWithID(jwks *Jwks, kid interface{}) *JSONWebKeys {
+	for k := range jwks.Keys {
+		if kid == jwks.Keys[k].Kid {
+			return &jwks.Keys[k]
+		}
+	}
+	return nil
+}
+
+// Reload fetches the JWKS now rather than waiting for the refresh
+// interval, such as after the identity provider rotates its keys. The
+// previous keys are kept if the fetch fails. It implements
+// reload.Reloadable.
+func (a *Authenticator) Reload(ctx context.Context) error {
+	jwks, err := a.getJWKS(ctx)
+	if err != nil {
+		return err
+	}
+	a.jwks.mu.Lock()
+	defer a.jwks.mu.Unlock()
+	a.jwks.jwks = jwks
+	a.jwks.fetchedAt = a.clock.Now()
+	return nil
+}
+
 // NewMiddleware creates an Endpoint middleware
 // that parses and validates the JWT token added to the ctx
 // by the transport layers.
@@ -157,16 +330,12 @@ func (a *Authenticator) getJWKS() (*Jwks, error) {
 func (a *Authenticator) NewMiddleware() endpoint.Middleware {
 	kf := func(token *jwt.Token) (interface{}, error) {
 		// Find matching Key in JWKS
-		var cert string
-		for k := range a.jwks.Keys {
-			if token.Header["kid"] == a.jwks.Keys[k].Kid {
-				cert = "-----BEGIN CERTIFICATE-----\n" + a.jwks.Keys[k].X5c[0] + "\n-----END CERTIFICATE-----"
-			}
-		}
-		if len(cert) == 0 {
+		key := a.findKey(token.Header["kid"])
+		if key == nil || len(key.X5c) == 0 {
 			err := errors.New("invalid key id")
 			return token, err
 		}
+		cert := "-----BEGIN CERTIFICATE-----\n" + key.X5c[0] + "\n-----END CERTIFICATE-----"
 
 		// Return Public Key
 		result, _ := jwt.ParseRSAPublicKeyFromPEM([]byte(cert))
@@ -176,6 +345,68 @@ func (a *Authenticator) NewMiddleware() endpoint.Middleware {
 	return newParser(kf, method, MapClaimsFactory, *a)
 }
 
+// Claims verifying their time based fields against a given time: the
+// jwt.MapClaims and jwt.StandardClaims, and jwt.RegisteredClaims.
+type (
+	unixClaims interface {
+		VerifyExpiresAt(cmp int64, req bool) bool
+		VerifyIssuedAt(cmp int64, req bool) bool
+		VerifyNotBefore(cmp int64, req bool) bool
+	}
+	timeClaims interface {
+		VerifyExpiresAt(cmp time.Time, req bool) bool
+		VerifyIssuedAt(cmp time.Time, req bool) bool
+		VerifyNotBefore(cmp time.Time, req bool) bool
+	}
+)
+
+// validateClaims checks the exp, iat and nbf claims at now, as
+// jwt.Claims.Valid does at the system time. The Valid method of the jwt
+// claims types only checks those, but other claims types, including
+// those embedding the jwt ones, are validated with their Valid method
+// too, so their own checks, such as of the audience, still apply.
+func validateClaims(claims jwt.Claims, now time.Time) error {
+	if err := verifyTimes(claims, now); err != nil {
+		return err
+	}
+	switch claims.(type) {
+	case jwt.MapClaims, jwt.StandardClaims, *jwt.StandardClaims, jwt.RegisteredClaims, *jwt.RegisteredClaims:
+		return nil
+	}
+	return claims.Valid()
+}
+
+// verifyTimes checks the time based claims of claims at now, if it has
+// them.
+func verifyTimes(claims jwt.Claims, now time.Time) error {
+	var exp, iat, nbf bool
+	switch c := claims.(type) {
+	case unixClaims:
+		exp, iat, nbf = c.VerifyExpiresAt(now.Unix(), false), c.VerifyIssuedAt(now.Unix(), false), c.VerifyNotBefore(now.Unix(), false)
+	case timeClaims:
+		exp, iat, nbf = c.VerifyExpiresAt(now, false), c.VerifyIssuedAt(now, false), c.VerifyNotBefore(now, false)
+	default:
+		return nil
+	}
+	vErr := &jwt.ValidationError{}
+	if !exp {
+		vErr.Inner = errors.New("token is expired")
+		vErr.Errors |= jwt.ValidationErrorExpired
+	}
+	if !iat {
+		vErr.Inner = errors.New("token used before issued")
+		vErr.Errors |= jwt.ValidationErrorIssuedAt
+	}
+	if !nbf {
+		vErr.Inner = errors.New("token is not valid yet")
+		vErr.Errors |= jwt.ValidationErrorNotValidYet
+	}
+	if vErr.Errors == 0 {
+		return nil
+	}
+	return vErr
+}
+
 func extractTokenFromContext(ctx context.Context) (*string, error) {
 	// tokenString is stored in the context from the transport handlers.
 	tokenString, ok := ctx.Value(JWTContextKey).(string)
@@ -192,7 +423,11 @@ func parseTokenString(ctx context.Context, tokenString string, expectedSigningMe
 	// of the token to identify which key to use, but the parsed token
 	// (head and claims) is provided to the callback, providing
 	// flexibility.
-	token, err := jwt.ParseWithClaims(tokenString, newClaims(), func(token *jwt.Token) (interface{}, error) {
+	//
+	// Time based claims are checked afterwards by validateClaims, against
+	// the Authenticator's clock.
+	parser := jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.ParseWithClaims(tokenString, newClaims(), func(token *jwt.Token) (interface{}, error) {
 		// Don't forget to validate the alg is what you expect:
 		if token.Method != expectedSigningMethod {
 			return nil, ErrUnexpectedSigningMethod
@@ -220,6 +455,9 @@ func newParser(keyFunc jwt.Keyfunc, method jwt.SigningMethod, newClaims ClaimsFa
 			}
 
 			token, err := parseTokenString(ctx, *tokenString, method, newClaims, keyFunc)
+			if err == nil {
+				err = validateClaims(token.Claims, authn.clock.Now())
+			}
 			if err != nil {
 				if e, ok := err.(*jwt.ValidationError); ok {
 					switch {
@@ -262,6 +500,10 @@ func newParser(keyFunc jwt.Keyfunc, method jwt.SigningMethod, newClaims ClaimsFa
 
 			ctx = context.WithValue(ctx, JWTDecodedTokenContextKey, token)
 			ctx = context.WithValue(ctx, JWTClaimsContextKey, token.Claims)
+			ctx = identity.WithUserID(ctx, SubjectFromContext(ctx))
+			if roles := RolesFromClaims(token.Claims); roles != nil {
+				ctx = identity.WithRoles(ctx, roles)
+			}
 
 			span.Finish()
 
@@ -2,11 +2,14 @@ package opa
 
 import (
 	"context"
-	"os"
+	"net"
+	"strconv"
 
 	"github.com/go-kit/kit/endpoint"
 	"github.com/jdotw/go-utils/authn/jwt"
 	"github.com/jdotw/go-utils/authzerrors"
+	"github.com/jdotw/go-utils/config"
+	"github.com/jdotw/go-utils/identity"
 	"github.com/jdotw/go-utils/log"
 	"github.com/jdotw/go-utils/opa"
 	"github.com/jdotw/go-utils/tracing"
@@ -36,14 +39,16 @@ func NewAuthorizor(logger log.Factory, tracer opentracing.Tracer) Authorizor {
 }
 
 type queryInput struct {
-	Request interface{} `json:"request,omitempty"`
-	Claims  interface{} `json:"claims,omitempty"`
+	Request  interface{}       `json:"request,omitempty"`
+	Claims   interface{}       `json:"claims,omitempty"`
+	Identity identity.Identity `json:"identity"`
 }
 
 func inputForRequest(ctx context.Context, request interface{}) queryInput {
 	return queryInput{
-		Request: request,
-		Claims:  ctx.Value(jwt.JWTClaimsContextKey),
+		Request:  request,
+		Claims:   ctx.Value(jwt.JWTClaimsContextKey),
+		Identity: identity.FromContext(ctx),
 	}
 }
 
@@ -55,12 +60,21 @@ func (a *Authorizor) NewInProcessMiddleware(policy string, queryString string) e
 	if err != nil {
 		a.logger.Bg().Fatal("Failed to prepare endpoint authorization policy", zap.Error(err))
 	}
+	return a.inProcessMiddleware(func() rego.PreparedEvalQuery { return query }, queryString)
+}
+
+// NewPolicyMiddleware is NewInProcessMiddleware evaluating p, so the
+// policy can be reloaded without a restart.
+func (a *Authorizor) NewPolicyMiddleware(p *Policy) endpoint.Middleware {
+	return a.inProcessMiddleware(p.prepared, p.queryString)
+}
 
+func (a *Authorizor) inProcessMiddleware(prepared func() rego.PreparedEvalQuery, queryString string) endpoint.Middleware {
 	return func(next endpoint.Endpoint) endpoint.Endpoint {
 		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 			ctx, span := tracing.NewChildSpanAndContext(ctx, a.tracer, "AuthZPolicyInternal")
 
-			results, err := query.Eval(ctx, rego.EvalInput(inputForRequest(ctx, request)))
+			results, err := prepared().Eval(ctx, rego.EvalInput(inputForRequest(ctx, request)))
 			if err != nil {
 				// handle error
 				return nil, err
@@ -83,16 +97,18 @@ type AuthorizationResponse struct {
 	Result bool `json:"result,omitempty"`
 }
 
+// SidecarConfig locates the OPA sidecar queried by NewSidecarMiddleware.
+type SidecarConfig struct {
+	Host string `json:"host" env:"OPA_HOST" default:"localhost"`
+	Port int    `json:"port" env:"OPA_PORT" default:"8181" validate:"min=1,max=65535"`
+}
+
 func (a *Authorizor) NewSidecarMiddleware(queryString string) endpoint.Middleware {
-	h := os.Getenv("OPA_HOST")
-	if len(h) == 0 {
-		h = "localhost"
-	}
-	p := os.Getenv("OPA_PORT")
-	if len(p) == 0 {
-		p = "8181"
+	var cfg SidecarConfig
+	if err := config.Load(&cfg); err != nil {
+		a.logger.Bg().Fatal("Failed to load OPA sidecar config", zap.Error(err))
 	}
-	c := opa.NewOPAClient(a.logger, a.tracer, "http://"+h+":"+p)
+	c := opa.NewOPAClient(a.logger, a.tracer, "http://"+net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)))
 	return func(next endpoint.Endpoint) endpoint.Endpoint {
 		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 			ctx, span := tracing.NewChildSpanAndContext(ctx, a.tracer, "AuthZPolicyExternal")
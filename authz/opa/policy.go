@@ -0,0 +1,68 @@
+package opa
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// PolicyFunc loads the rego source of a policy, such as from a file or
+// config.
+type PolicyFunc func(ctx context.Context) (string, error)
+
+// PolicyFile loads a policy from the file at path.
+func PolicyFile(path string) PolicyFunc {
+	return func(context.Context) (string, error) {
+		b, err := os.ReadFile(path)
+		return string(b), err
+	}
+}
+
+// Policy is an endpoint authorization policy that can be replaced while
+// the service runs. It implements reload.Reloadable.
+type Policy struct {
+	queryString string
+	load        PolicyFunc
+
+	mu    sync.RWMutex
+	query rego.PreparedEvalQuery
+}
+
+// NewPolicy loads a policy with load and prepares queryString against
+// it, for NewPolicyMiddleware.
+func NewPolicy(queryString string, load PolicyFunc) (*Policy, error) {
+	p := &Policy{queryString: queryString, load: load}
+	if err := p.Reload(context.Background()); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Reload loads the policy again and, once the query is prepared against
+// it, evaluates requests with it from then on. The current policy is
+// kept if it fails to load or compile.
+func (p *Policy) Reload(ctx context.Context) error {
+	policy, err := p.load(ctx)
+	if err != nil {
+		return err
+	}
+	query, err := rego.New(
+		rego.Query(p.queryString),
+		rego.Module("policy.rego", policy),
+	).PrepareForEval(ctx)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.query = query
+	return nil
+}
+
+func (p *Policy) prepared() rego.PreparedEvalQuery {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.query
+}
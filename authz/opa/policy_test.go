@@ -0,0 +1,51 @@
+package opa
+
+import (
+	"context"
+	"testing"
+
+	stdjwt "github.com/golang-jwt/jwt/v4"
+	"github.com/jdotw/go-utils/authn/jwt"
+	"github.com/jdotw/go-utils/authzerrors"
+	"github.com/jdotw/go-utils/log"
+	"github.com/opentracing/opentracing-go"
+)
+
+func TestPolicyReload(t *testing.T) {
+	policy := `package orders
+allow { input.claims.role == "admin" }`
+	p, err := NewPolicy("data.orders.allow == true", func(context.Context) (string, error) {
+		return policy, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAuthorizor(log.NewMockLogFactory(), opentracing.NoopTracer{})
+	e := a.NewPolicyMiddleware(p)(func(context.Context, interface{}) (interface{}, error) {
+		return "ok", nil
+	})
+	ctx := context.WithValue(context.Background(), jwt.JWTClaimsContextKey, stdjwt.MapClaims{"role": "support"})
+
+	if _, err := e(ctx, nil); err != authzerrors.ErrDeniedByPolicy {
+		t.Fatalf("expected support to be denied, got %v", err)
+	}
+
+	policy = `package orders
+allow { input.claims.role == "admin" }
+allow { input.claims.role == "support" }`
+	if err := p.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e(ctx, nil); err != nil {
+		t.Fatalf("expected support to be allowed after reloading, got %v", err)
+	}
+
+	policy = `package orders
+allow {`
+	if err := p.Reload(context.Background()); err == nil {
+		t.Errorf("expected an invalid policy to fail to reload")
+	}
+	if _, err := e(ctx, nil); err != nil {
+		t.Errorf("expected the previous policy to be kept, got %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package opa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jdotw/go-utils/model"
+	"github.com/jdotw/go-utils/tracing"
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"go.uber.org/zap"
+	"gorm.io/gorm/clause"
+)
+
+// ErrUnsupportedResidual is returned when a policy's partial evaluation
+// leaves conditions that can't be expressed as SQL predicates.
+var ErrUnsupportedResidual = errors.New("unsupported policy residual")
+
+// comparisons maps rego comparison builtins to SQL operators.
+var comparisons = map[string]string{
+	"eq":    "=",
+	"equal": "=",
+	"neq":   "<>",
+	"lt":    "<",
+	"lte":   "<=",
+	"gt":    ">",
+	"gte":   ">=",
+}
+
+// NewRowFilter returns a model.RowFilter that partially evaluates query
+// against policy with the caller's claims as input, treating the row
+// under unknown (e.g. "input.row") as unknown. The conditions left on
+// the row become the filter's predicate, so list endpoints share the
+// policy used to authorize single records.
+//
+//	allow { input.row.owner_id == input.claims.sub }
+//	allow { input.claims.role == "admin" }
+//
+//	authorizor := opa.NewAuthorizor(logger, tracer)
+//	filter := authorizor.NewRowFilter(policy, "data.documents.allow == true", "input.row")
+//	db.Scopes(model.RowSecurity(filter)).Find(&docs)
+//
+// Residuals may only compare row columns with constants using ==, !=,
+// <, <=, > and >=; anything else fails with ErrUnsupportedResidual.
+func (a *Authorizor) NewRowFilter(policy string, queryString string, unknown string) model.RowFilter {
+	query, err := rego.New(
+		rego.Query(queryString),
+		rego.Module("policy.rego", policy),
+		rego.Unknowns([]string{unknown}),
+	).PrepareForPartial(context.Background())
+	if err != nil {
+		a.logger.Bg().Fatal("Failed to prepare row filter policy", zap.Error(err))
+	}
+	row := ast.MustParseRef(unknown)
+
+	return func(ctx context.Context) (clause.Expression, error) {
+		ctx, span := tracing.NewChildSpanAndContext(ctx, a.tracer, "AuthZRowFilter")
+		defer span.Finish()
+
+		pq, err := query.Partial(ctx, rego.EvalInput(inputForRequest(ctx, nil)))
+		if err != nil {
+			return nil, err
+		}
+		expr, err := residualExpression(pq, row)
+		if err != nil {
+			a.logger.For(ctx).Error("Failed to translate row filter policy", zap.String("query", queryString), zap.Error(err))
+		}
+		return expr, err
+	}
+}
+
+// residualExpression translates partial evaluation results: queries are
+// alternatives and the expressions within one must all hold. No queries
+// means no row is allowed; an empty query allows every row.
+func residualExpression(pq *rego.PartialQueries, row ast.Ref) (clause.Expression, error) {
+	if len(pq.Support) > 0 {
+		return nil, fmt.Errorf("%w: policy needs support rules", ErrUnsupportedResidual)
+	}
+	if len(pq.Queries) == 0 {
+		return model.DenyAll, nil
+	}
+	alternatives := make([]clause.Expression, 0, len(pq.Queries))
+	for _, body := range pq.Queries {
+		if len(body) == 0 {
+			return nil, nil
+		}
+		conditions := make([]clause.Expression, 0, len(body))
+		for _, expr := range body {
+			condition, err := residualCondition(expr, row)
+			if err != nil {
+				return nil, err
+			}
+			conditions = append(conditions, condition)
+		}
+		alternatives = append(alternatives, and(conditions))
+	}
+	if len(alternatives) == 1 {
+		return alternatives[0], nil
+	}
+	return clause.Or(alternatives...), nil
+}
+
+func residualCondition(expr *ast.Expr, row ast.Ref) (clause.Expression, error) {
+	if expr.Negated || !expr.IsCall() || len(expr.Operands()) != 2 {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedResidual, expr)
+	}
+	op, ok := comparisons[expr.Operator().String()]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedResidual, expr)
+	}
+	left, right := expr.Operand(0), expr.Operand(1)
+	column, ok := rowColumn(left, row)
+	value := right
+	if !ok {
+		// The row is on the right, so flip the comparison
+		if column, ok = rowColumn(right, row); !ok {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupportedResidual, expr)
+		}
+		value = left
+		op = flipped(op)
+	}
+	if !ast.IsConstant(value.Value) {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedResidual, expr)
+	}
+	v, err := ast.JSON(value.Value)
+	if err != nil {
+		return nil, err
+	}
+	if n, ok := v.(json.Number); ok {
+		// Pass numbers to the driver as numbers rather than strings
+		if v, err = n.Int64(); err != nil {
+			v, err = n.Float64()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return clause.Expr{
+		SQL:  "? " + op + " ?",
+		Vars: []interface{}{clause.Column{Table: clause.CurrentTable, Name: column}, v},
+	}, nil
+}
+
+func and(conditions []clause.Expression) clause.Expression {
+	if len(conditions) == 1 {
+		return conditions[0]
+	}
+	return clause.And(conditions...)
+}
+
+// rowColumn returns the column named by a reference to a field of row.
+func rowColumn(term *ast.Term, row ast.Ref) (string, bool) {
+	ref, ok := term.Value.(ast.Ref)
+	if !ok || len(ref) != len(row)+1 || !ref.HasPrefix(row) {
+		return "", false
+	}
+	column, ok := ref[len(row)].Value.(ast.String)
+	return string(column), ok
+}
+
+func flipped(op string) string {
+	switch op {
+	case "<":
+		return ">"
+	case "<=":
+		return ">="
+	case ">":
+		return "<"
+	case ">=":
+		return "<="
+	}
+	return op
+}
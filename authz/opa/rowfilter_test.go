@@ -0,0 +1,82 @@
+package opa
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	stdjwt "github.com/golang-jwt/jwt/v4"
+	"github.com/jdotw/go-utils/authn/jwt"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/model"
+	"github.com/opentracing/opentracing-go"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/utils/tests"
+)
+
+const documentsPolicy = `
+package documents
+
+allow {
+	input.row.owner_id == input.claims.sub
+}
+
+allow {
+	input.row.published == true
+	input.row.rating >= 3
+}
+
+allow {
+	input.claims.role == "admin"
+}
+`
+
+func TestNewRowFilter(t *testing.T) {
+	a := NewAuthorizor(log.NewMockLogFactory(), opentracing.NoopTracer{})
+	filter := a.NewRowFilter(documentsPolicy, "data.documents.allow == true", "input.row")
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		claims   stdjwt.MapClaims
+		expected string
+	}{
+		{"owner or published", stdjwt.MapClaims{"sub": "alice"},
+			"SELECT * FROM `documents` WHERE (`documents`.`owner_id` = \"alice\" OR (`documents`.`published` = true AND `documents`.`rating` >= 3))"},
+		{"admin", stdjwt.MapClaims{"sub": "bob", "role": "admin"},
+			"SELECT * FROM `documents`"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), jwt.JWTClaimsContextKey, tt.claims)
+			stmt := db.WithContext(ctx).Table("documents").Scopes(model.RowSecurity(filter)).Find(&[]map[string]interface{}{}).Statement
+			if sql := db.Dialector.Explain(stmt.SQL.String(), stmt.Vars...); sql != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, sql)
+			}
+		})
+	}
+}
+
+func TestResidualCondition(t *testing.T) {
+	a := NewAuthorizor(log.NewMockLogFactory(), opentracing.NoopTracer{})
+
+	// Comparisons with the row on the right are flipped
+	filter := a.NewRowFilter("package p\nallow { 3 < input.row.rating }", "data.p.allow == true", "input.row")
+	expr, err := filter(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, ok := expr.(clause.Expr); !ok || c.SQL != "? > ?" {
+		t.Errorf("expected a flipped comparison, got %#v", expr)
+	}
+
+	// Conditions other than comparisons with constants are rejected
+	filter = a.NewRowFilter("package p\nallow { startswith(input.row.name, \"a\") }", "data.p.allow == true", "input.row")
+	if _, err := filter(context.Background()); !errors.Is(err, ErrUnsupportedResidual) {
+		t.Errorf("expected %v, got %v", ErrUnsupportedResidual, err)
+	}
+}
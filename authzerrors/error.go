@@ -1,5 +1,7 @@
 package authzerrors
 
-import "errors"
+import "github.com/jdotw/go-utils/errorsx"
 
-var ErrDeniedByPolicy = errors.New("denied by policy agent")
+// ErrDeniedByPolicy is returned when the policy agent denies a request.
+// It responds 403.
+var ErrDeniedByPolicy = errorsx.Sentinel(errorsx.CodePermissionDenied, "denied by policy agent")
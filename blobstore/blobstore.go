@@ -0,0 +1,75 @@
+// Package blobstore stores objects in S3 or GCS behind one interface,
+// so services and their tests don't depend on a provider's SDK:
+//
+//	store, err := blobstore.NewS3(ctx, cfg)
+//	store = blobstore.Instrument(store, "uploads", tracer, prometheus.DefaultRegisterer)
+//	obj, err := store.Put(ctx, "avatars/"+userID, body, blobstore.PutOptions{ContentType: "image/png"})
+//	url, err := store.Presign(ctx, http.MethodGet, obj.Key, 15*time.Minute)
+//
+// FileResponse and PutFilePart connect stores to the transport
+// package's file download and upload helpers.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jdotw/go-utils/recorderrors"
+)
+
+var (
+	// ErrNotFound is returned for keys with no object. It wraps
+	// recorderrors.ErrNotFound, so it maps to a 404.
+	ErrNotFound = fmt.Errorf("blob %w", recorderrors.ErrNotFound)
+
+	// ErrPresignUnsupported is returned by stores that can't presign
+	// URLs, or for methods other than GET and PUT.
+	ErrPresignUnsupported = errors.New("presigned URLs not supported")
+)
+
+// Object describes a stored object.
+type Object struct {
+	Key         string
+	ContentType string
+	Size        int64
+	ModTime     time.Time
+	ETag        string
+	Metadata    map[string]string
+}
+
+// PutOptions describe an object being stored.
+type PutOptions struct {
+	// ContentType defaults to application/octet-stream.
+	ContentType string
+	Metadata    map[string]string
+}
+
+// Blob is an object being read. Close it when done.
+type Blob struct {
+	Object
+	io.ReadCloser
+}
+
+// Store stores objects by key.
+type Store interface {
+	// Put stores body under key, replacing any existing object.
+	Put(ctx context.Context, key string, body io.Reader, opts PutOptions) (Object, error)
+	// Get opens the object stored under key.
+	Get(ctx context.Context, key string) (*Blob, error)
+	// Delete removes the object stored under key. Deleting a missing
+	// object is not an error.
+	Delete(ctx context.Context, key string) error
+	// Presign returns a URL allowing anyone holding it to GET or PUT the
+	// object under key until it expires.
+	Presign(ctx context.Context, method, key string, expires time.Duration) (string, error)
+}
+
+func contentType(opts PutOptions) string {
+	if opts.ContentType == "" {
+		return "application/octet-stream"
+	}
+	return opts.ContentType
+}
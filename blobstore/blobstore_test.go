@@ -0,0 +1,137 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jdotw/go-utils/recorderrors"
+	"github.com/jdotw/go-utils/transport"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInstrumentedMemoryStore(t *testing.T) {
+	tracer := mocktracer.New()
+	registry := prometheus.NewRegistry()
+	store := Instrument(NewMemoryStore(), "test", tracer, registry)
+	s := store.(*instrumentedStore)
+	ctx := context.Background()
+
+	obj, err := store.Put(ctx, "a.txt", strings.NewReader("hello"), PutOptions{ContentType: "text/plain"})
+	if err != nil || obj.Size != 5 {
+		t.Fatalf("unexpected put result %+v, %v", obj, err)
+	}
+	blob, err := store.Get(ctx, "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(blob)
+	blob.Close()
+	if string(b) != "hello" || blob.ContentType != "text/plain" {
+		t.Errorf("unexpected blob %q %+v", b, blob.Object)
+	}
+	if _, ok := blob.ReadCloser.(io.Seeker); !ok {
+		t.Error("expected instrumented blob to stay seekable")
+	}
+
+	if err := store.Delete(ctx, "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "a.txt"); !errors.Is(err, ErrNotFound) || !errors.Is(err, recorderrors.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := store.Presign(ctx, http.MethodGet, "a.txt", time.Minute); !errors.Is(err, ErrPresignUnsupported) {
+		t.Errorf("expected ErrPresignUnsupported, got %v", err)
+	}
+
+	if n := testutil.ToFloat64(s.operations.WithLabelValues("test", "get", "not_found")); n != 1 {
+		t.Errorf("expected one not found get, got %v", n)
+	}
+	if n := testutil.ToFloat64(s.bytes.WithLabelValues("test", "read")); n != 5 {
+		t.Errorf("expected 5 bytes read, got %v", n)
+	}
+	if spans := tracer.FinishedSpans(); len(spans) != 5 || spans[0].OperationName != "blobstore.put" {
+		t.Errorf("expected a span per operation, got %d", len(spans))
+	}
+}
+
+func TestFileResponse(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	store.Put(ctx, "report", strings.NewReader("0123456789"), PutOptions{ContentType: "text/csv"})
+
+	file, err := FileResponse(ctx, store, "report", "report.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx = context.WithValue(ctx, transport.ConditionalHeadersContextKey, http.Header{"Range": {"bytes=2-4"}})
+	w := httptest.NewRecorder()
+	if err := transport.HTTPEncodeFileResponse(ctx, w, file); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusPartialContent || w.Body.String() != "234" {
+		t.Errorf("expected a range response, got %d %q", w.Code, w.Body.String())
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename=report.csv` {
+		t.Errorf("unexpected Content-Disposition %q", cd)
+	}
+}
+
+func TestStreamFiles(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("upload", "notes.txt")
+	fw.Write([]byte("some notes"))
+	mw.Close()
+	r := httptest.NewRequest(http.MethodPost, "/", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+
+	store := NewMemoryStore()
+	ctx := context.Background()
+	var objects []Object
+	onFile := StreamFiles(ctx, store, func(part transport.FilePart) string {
+		return "uploads/" + part.Filename
+	}, func(_ transport.FilePart, obj Object) {
+		objects = append(objects, obj)
+	})
+	if err := transport.StreamMultipart(r, transport.MultipartOptions{}, nil, onFile); err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || objects[0].Key != "uploads/notes.txt" || objects[0].Size != 10 {
+		t.Fatalf("unexpected objects %+v", objects)
+	}
+	if objects[0].Metadata["filename"] != "notes.txt" {
+		t.Errorf("expected the filename to be kept, got %v", objects[0].Metadata)
+	}
+}
+
+func TestS3Presign(t *testing.T) {
+	client := s3.New(s3.Options{
+		Region:           "us-east-1",
+		Credentials:      credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+		EndpointResolver: s3.EndpointResolverFromURL("https://s3.example.com"),
+		UsePathStyle:     true,
+	})
+	store := NewS3Store(client, "bucket")
+	url, err := store.Presign(context.Background(), http.MethodPut, "a.txt", 15*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(url, "https://s3.example.com/bucket/a.txt?") || !strings.Contains(url, "X-Amz-Expires=900") || !strings.Contains(url, "X-Amz-Signature=") {
+		t.Errorf("unexpected presigned URL %s", url)
+	}
+	if _, err := store.Presign(context.Background(), http.MethodDelete, "a.txt", time.Minute); !errors.Is(err, ErrPresignUnsupported) {
+		t.Errorf("expected ErrPresignUnsupported, got %v", err)
+	}
+}
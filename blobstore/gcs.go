@@ -0,0 +1,101 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// GCSConfig configures a GCS store. Its tags allow loading it with the
+// config package. Credentials come from Application Default
+// Credentials, which must be a service account to presign URLs.
+type GCSConfig struct {
+	Bucket string `json:"bucket" env:"GCS_BUCKET" validate:"required"`
+}
+
+type gcsStore struct {
+	bucket *storage.BucketHandle
+}
+
+// NewGCS returns a Store for the bucket in cfg.
+func NewGCS(ctx context.Context, cfg GCSConfig) (Store, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("blobstore: create GCS client: %w", err)
+	}
+	return NewGCSStore(client, cfg.Bucket), nil
+}
+
+// NewGCSStore returns a Store for bucket using client.
+func NewGCSStore(client *storage.Client, bucket string) Store {
+	return &gcsStore{bucket: client.Bucket(bucket)}
+}
+
+func (s *gcsStore) Put(ctx context.Context, key string, body io.Reader, opts PutOptions) (Object, error) {
+	// Cancelling the writer's context aborts the upload on failure.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w := s.bucket.Object(key).NewWriter(ctx)
+	w.ContentType = contentType(opts)
+	w.Metadata = opts.Metadata
+	if _, err := io.Copy(w, body); err != nil {
+		cancel()
+		w.Close()
+		return Object{}, err
+	}
+	if err := w.Close(); err != nil {
+		return Object{}, err
+	}
+	attrs := w.Attrs()
+	return Object{
+		Key:         key,
+		ContentType: attrs.ContentType,
+		Size:        attrs.Size,
+		ModTime:     attrs.Updated,
+		ETag:        attrs.Etag,
+		Metadata:    attrs.Metadata,
+	}, nil
+}
+
+func (s *gcsStore) Get(ctx context.Context, key string) (*Blob, error) {
+	r, err := s.bucket.Object(key).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Blob{
+		Object: Object{
+			Key:         key,
+			ContentType: r.Attrs.ContentType,
+			Size:        r.Attrs.Size,
+			ModTime:     r.Attrs.LastModified,
+		},
+		ReadCloser: r,
+	}, nil
+}
+
+func (s *gcsStore) Delete(ctx context.Context, key string) error {
+	err := s.bucket.Object(key).Delete(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *gcsStore) Presign(ctx context.Context, method, key string, expires time.Duration) (string, error) {
+	if method != http.MethodGet && method != http.MethodPut {
+		return "", ErrPresignUnsupported
+	}
+	return s.bucket.SignedURL(key, &storage.SignedURLOptions{
+		Method:  method,
+		Expires: time.Now().Add(expires),
+		Scheme:  storage.SigningSchemeV4,
+	})
+}
@@ -0,0 +1,135 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/jdotw/go-utils/metrics"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type instrumentedStore struct {
+	next       Store
+	name       string
+	tracer     opentracing.Tracer
+	operations *prometheus.CounterVec
+	duration   *prometheus.HistogramVec
+	bytes      *prometheus.CounterVec
+}
+
+// Instrument traces each operation of store and records metrics labelled
+// with name. A nil registerer uses prometheus.DefaultRegisterer.
+func Instrument(store Store, name string, tracer opentracing.Tracer, registerer prometheus.Registerer) Store {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+	return &instrumentedStore{
+		next:   store,
+		name:   name,
+		tracer: tracer,
+		operations: metrics.MustRegister(registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "blobstore_operations_total",
+			Help: "Number of object store operations, by store, operation and result.",
+		}, []string{"store", "operation", "result"})),
+		duration: metrics.MustRegister(registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "blobstore_operation_duration_seconds",
+			Help:    "Time taken by object store operations, by store and operation. Get is timed to the first byte.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"store", "operation"})),
+		bytes: metrics.MustRegister(registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "blobstore_bytes_total",
+			Help: "Bytes written to or read from object stores, by store and direction.",
+		}, []string{"store", "direction"})),
+	}
+}
+
+// observe starts a span for operation on key and returns a function
+// finishing it and recording the result.
+func (s *instrumentedStore) observe(ctx context.Context, operation, key string) (context.Context, func(error)) {
+	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "blobstore."+operation)
+	ext.SpanKindRPCClient.Set(span)
+	span.SetTag("blobstore.name", s.name)
+	span.SetTag("blobstore.key", key)
+	start := time.Now()
+	return ctx, func(err error) {
+		result := "success"
+		switch {
+		case errors.Is(err, ErrNotFound):
+			result = "not_found"
+		case err != nil:
+			result = "error"
+			ext.Error.Set(span, true)
+			span.LogFields(otlog.Error(err))
+		}
+		s.operations.WithLabelValues(s.name, operation, result).Inc()
+		s.duration.WithLabelValues(s.name, operation).Observe(time.Since(start).Seconds())
+		span.Finish()
+	}
+}
+
+func (s *instrumentedStore) Put(ctx context.Context, key string, body io.Reader, opts PutOptions) (Object, error) {
+	ctx, done := s.observe(ctx, "put", key)
+	obj, err := s.next.Put(ctx, key, body, opts)
+	done(err)
+	if err == nil {
+		s.bytes.WithLabelValues(s.name, "write").Add(float64(obj.Size))
+	}
+	return obj, err
+}
+
+func (s *instrumentedStore) Get(ctx context.Context, key string) (*Blob, error) {
+	ctx, done := s.observe(ctx, "get", key)
+	blob, err := s.next.Get(ctx, key)
+	done(err)
+	if err != nil {
+		return nil, err
+	}
+	counter := &countingReadCloser{ReadCloser: blob.ReadCloser, bytes: s.bytes.WithLabelValues(s.name, "read")}
+	if _, ok := blob.ReadCloser.(io.Seeker); ok {
+		blob.ReadCloser = countingReadSeekCloser{counter}
+	} else {
+		blob.ReadCloser = counter
+	}
+	return blob, nil
+}
+
+func (s *instrumentedStore) Delete(ctx context.Context, key string) error {
+	ctx, done := s.observe(ctx, "delete", key)
+	err := s.next.Delete(ctx, key)
+	done(err)
+	return err
+}
+
+func (s *instrumentedStore) Presign(ctx context.Context, method, key string, expires time.Duration) (string, error) {
+	ctx, done := s.observe(ctx, "presign", key)
+	url, err := s.next.Presign(ctx, method, key, expires)
+	done(err)
+	return url, err
+}
+
+// countingReadCloser counts bytes read.
+type countingReadCloser struct {
+	io.ReadCloser
+	bytes prometheus.Counter
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.bytes.Add(float64(n))
+	return n, err
+}
+
+// countingReadSeekCloser keeps seekable bodies seekable, so downloads
+// support ranges.
+type countingReadSeekCloser struct {
+	*countingReadCloser
+}
+
+func (c countingReadSeekCloser) Seek(offset int64, whence int) (int64, error) {
+	return c.ReadCloser.(io.Seeker).Seek(offset, whence)
+}
@@ -0,0 +1,161 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// S3Config configures an S3 store. Its tags allow loading it with the
+// config package. Credentials come from the AWS SDK's default chain.
+type S3Config struct {
+	Bucket string `json:"bucket" env:"S3_BUCKET" validate:"required"`
+	Region string `json:"region" env:"S3_REGION"`
+	// Endpoint overrides the S3 endpoint, for S3 compatible stores such
+	// as MinIO.
+	Endpoint string `json:"endpoint" env:"S3_ENDPOINT"`
+	// UsePathStyle addresses buckets by path rather than subdomain, as
+	// most S3 compatible stores require.
+	UsePathStyle bool `json:"use_path_style" env:"S3_USE_PATH_STYLE"`
+}
+
+type s3Store struct {
+	client   *s3.Client
+	uploader *manager.Uploader
+	presign  *s3.PresignClient
+	bucket   string
+}
+
+// NewS3 returns a Store for the bucket in cfg, configuring the client
+// from the environment.
+func NewS3(ctx context.Context, cfg S3Config) (Store, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if cfg.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(cfg.Region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("blobstore: load AWS config: %w", err)
+	}
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if cfg.Endpoint != "" {
+			o.EndpointResolver = s3.EndpointResolverFromURL(cfg.Endpoint)
+		}
+		o.UsePathStyle = cfg.UsePathStyle
+	})
+	return NewS3Store(client, cfg.Bucket), nil
+}
+
+// NewS3Store returns a Store for bucket using client.
+func NewS3Store(client *s3.Client, bucket string) Store {
+	return &s3Store{
+		client:   client,
+		uploader: manager.NewUploader(client),
+		presign:  s3.NewPresignClient(client),
+		bucket:   bucket,
+	}
+}
+
+func (s *s3Store) Put(ctx context.Context, key string, body io.Reader, opts PutOptions) (Object, error) {
+	// The uploader streams bodies of unknown length in parts.
+	counter := &countingReader{r: body}
+	out, err := s.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        counter,
+		ContentType: aws.String(contentType(opts)),
+		Metadata:    opts.Metadata,
+	})
+	if err != nil {
+		return Object{}, err
+	}
+	return Object{
+		Key:         key,
+		ContentType: contentType(opts),
+		Size:        counter.n,
+		ModTime:     time.Now(),
+		ETag:        strings.Trim(aws.ToString(out.ETag), `"`),
+		Metadata:    opts.Metadata,
+	}, nil
+}
+
+func (s *s3Store) Get(ctx context.Context, key string) (*Blob, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	return &Blob{
+		Object: Object{
+			Key:         key,
+			ContentType: aws.ToString(out.ContentType),
+			Size:        out.ContentLength,
+			ModTime:     aws.ToTime(out.LastModified),
+			ETag:        strings.Trim(aws.ToString(out.ETag), `"`),
+			Metadata:    out.Metadata,
+		},
+		ReadCloser: out.Body,
+	}, nil
+}
+
+func (s *s3Store) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+func (s *s3Store) Presign(ctx context.Context, method, key string, expires time.Duration) (string, error) {
+	withExpiry := s3.WithPresignExpires(expires)
+	var url string
+	switch method {
+	case http.MethodGet:
+		req, err := s.presign.PresignGetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)}, withExpiry)
+		if err != nil {
+			return "", err
+		}
+		url = req.URL
+	case http.MethodPut:
+		req, err := s.presign.PresignPutObject(ctx, &s3.PutObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)}, withExpiry)
+		if err != nil {
+			return "", err
+		}
+		url = req.URL
+	default:
+		return "", ErrPresignUnsupported
+	}
+	return url, nil
+}
+
+// s3Error maps missing key errors to ErrNotFound.
+func s3Error(err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && (apiErr.ErrorCode() == "NoSuchKey" || apiErr.ErrorCode() == "NotFound") {
+		return ErrNotFound
+	}
+	return err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
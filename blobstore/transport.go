@@ -0,0 +1,58 @@
+package blobstore
+
+import (
+	"context"
+	"io"
+
+	"github.com/jdotw/go-utils/transport"
+)
+
+// FileResponse opens the object under key as a transport.FileResponse
+// for HTTPEncodeFileResponse, downloading it as filename if set. The
+// encoder closes the body.
+func FileResponse(ctx context.Context, store Store, key, filename string) (transport.FileResponse, error) {
+	blob, err := store.Get(ctx, key)
+	if err != nil {
+		return transport.FileResponse{}, err
+	}
+	return transport.FileResponse{
+		Body:        blob.ReadCloser,
+		ContentType: blob.ContentType,
+		Filename:    filename,
+		Size:        blob.Size,
+		ModTime:     blob.ModTime,
+	}, nil
+}
+
+// PutFilePart stores a file spooled by transport.HTTPDecodeMultipartRequest
+// under key, with its sniffed content type.
+func PutFilePart(ctx context.Context, store Store, key string, part transport.FilePart) (Object, error) {
+	f, err := part.Open()
+	if err != nil {
+		return Object{}, err
+	}
+	defer f.Close()
+	return store.Put(ctx, key, f, PutOptions{
+		ContentType: part.ContentType,
+		Metadata:    map[string]string{"filename": part.Filename},
+	})
+}
+
+// StreamFiles returns an onFile callback for transport.StreamMultipart
+// storing each uploaded file under the key returned by key, without
+// spooling it to disk. Stored objects are passed to stored.
+func StreamFiles(ctx context.Context, store Store, key func(part transport.FilePart) string, stored func(part transport.FilePart, obj Object)) func(part transport.FilePart, body io.Reader) error {
+	return func(part transport.FilePart, body io.Reader) error {
+		obj, err := store.Put(ctx, key(part), body, PutOptions{
+			ContentType: part.ContentType,
+			Metadata:    map[string]string{"filename": part.Filename},
+		})
+		if err != nil {
+			return err
+		}
+		if stored != nil {
+			stored(part, obj)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,24 @@
+// Package cache provides a byte-oriented key/value Store with TTLs,
+// backed by memory or Redis, for response and endpoint caching.
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Store holds cached values until their TTL expires.
+type Store interface {
+	// Get returns the value for key and whether it was found.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value under key for ttl.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// SetIfAbsent stores value under key for ttl unless key is already
+	// set, reporting whether it stored it. Checking and storing is
+	// atomic, so only one of concurrent callers stores the value.
+	SetIfAbsent(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	// Delete removes the given keys.
+	Delete(ctx context.Context, keys ...string) error
+	// DeletePrefix removes every key starting with prefix.
+	DeletePrefix(ctx context.Context, prefix string) error
+}
@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/jdotw/go-utils/log"
+	"go.uber.org/zap"
+)
+
+// Endpoint response caching
+
+// KeyFunc derives the cache key for a request. Returning false skips the
+// cache for the request. Keys must include anything the response depends
+// on, such as the caller's tenant.
+type KeyFunc func(ctx context.Context, request interface{}) (string, bool)
+
+// EndpointCache caches the responses of an endpoint returning T in a
+// Store, as JSON, for expensive reads and reference data lookups. Failed
+// requests are not cached, and store failures are logged and fall
+// through to the endpoint.
+type EndpointCache[T any] struct {
+	store  Store
+	prefix string
+	ttl    time.Duration
+	key    KeyFunc
+	logger log.Factory
+}
+
+// NewEndpointCache returns an EndpointCache keeping responses for ttl
+// under prefix, which namespaces the endpoint's keys in the store.
+func NewEndpointCache[T any](store Store, prefix string, ttl time.Duration, key KeyFunc, logger log.Factory) *EndpointCache[T] {
+	return &EndpointCache[T]{store: store, prefix: prefix, ttl: ttl, key: key, logger: logger}
+}
+
+// Middleware wraps next with the cache.
+func (c *EndpointCache[T]) Middleware(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		key, ok := c.key(ctx, request)
+		if !ok {
+			return next(ctx, request)
+		}
+		key = c.prefix + key
+
+		if data, ok, err := c.store.Get(ctx, key); err != nil {
+			c.logger.For(ctx).Error("Failed to read endpoint cache", zap.String("key", key), zap.Error(err))
+		} else if ok {
+			var response T
+			if err := json.Unmarshal(data, &response); err == nil {
+				return response, nil
+			}
+		}
+
+		response, err := next(ctx, request)
+		if err != nil {
+			return response, err
+		}
+		if typed, ok := response.(T); ok {
+			data, err := json.Marshal(typed)
+			if err == nil {
+				err = c.store.Set(ctx, key, data, c.ttl)
+			}
+			if err != nil {
+				c.logger.For(ctx).Error("Failed to write endpoint cache", zap.String("key", key), zap.Error(err))
+			}
+		}
+		return response, nil
+	}
+}
+
+// Invalidate drops the cached responses for keys, as returned by the
+// KeyFunc.
+func (c *EndpointCache[T]) Invalidate(ctx context.Context, keys ...string) error {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = c.prefix + key
+	}
+	return c.store.Delete(ctx, prefixed...)
+}
+
+// InvalidateAll drops every cached response of the endpoint.
+func (c *EndpointCache[T]) InvalidateAll(ctx context.Context) error {
+	return c.store.DeletePrefix(ctx, c.prefix)
+}
+
+// InvalidateOnSuccess returns middleware for endpoints that change what
+// the cache holds. After successful requests, it invalidates the key that
+// key derives from the request, or every response when key is nil.
+func (c *EndpointCache[T]) InvalidateOnSuccess(key KeyFunc) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			response, err := next(ctx, request)
+			if err != nil {
+				return response, err
+			}
+			var ierr error
+			if key == nil {
+				ierr = c.InvalidateAll(ctx)
+			} else if k, ok := key(ctx, request); ok {
+				ierr = c.Invalidate(ctx, k)
+			}
+			if ierr != nil {
+				c.logger.For(ctx).Error("Failed to invalidate endpoint cache", zap.Error(ierr))
+			}
+			return response, nil
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jdotw/go-utils/log"
+)
+
+type country struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+func TestEndpointCache(t *testing.T) {
+	store := NewMemoryStore()
+	key := func(ctx context.Context, request interface{}) (string, bool) {
+		code, ok := request.(string)
+		return code, ok && code != ""
+	}
+	c := NewEndpointCache[country](store, "countries:", time.Minute, key, log.NewMockLogFactory())
+
+	calls := 0
+	errFailed := errors.New("failed")
+	lookup := c.Middleware(func(ctx context.Context, request interface{}) (interface{}, error) {
+		calls++
+		if request == "XX" {
+			return nil, errFailed
+		}
+		return country{Code: request.(string), Name: "New Zealand"}, nil
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		response, err := lookup(ctx, "NZ")
+		if err != nil || response != (country{Code: "NZ", Name: "New Zealand"}) {
+			t.Errorf("unexpected response %v, %v", response, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected the second lookup to be cached, endpoint called %d times", calls)
+	}
+	if _, ok, _ := store.Get(ctx, "countries:NZ"); !ok {
+		t.Error("expected the response to be stored under the prefix")
+	}
+
+	// Errors aren't cached, nor are requests without a key
+	lookup(ctx, "XX")
+	lookup(ctx, "XX")
+	lookup(ctx, "")
+	lookup(ctx, "")
+	if calls != 5 {
+		t.Errorf("expected failed and unkeyed requests to reach the endpoint, called %d times", calls)
+	}
+
+	// Invalidation
+	update := c.InvalidateOnSuccess(key)(func(ctx context.Context, request interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	update(ctx, "NZ")
+	lookup(ctx, "NZ")
+	if calls != 6 {
+		t.Errorf("expected the update to invalidate the cached response, called %d times", calls)
+	}
+	c.InvalidateAll(ctx)
+	lookup(ctx, "NZ")
+	if calls != 7 {
+		t.Errorf("expected InvalidateAll to drop the cached response, called %d times", calls)
+	}
+}
@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Now()
+	s := NewMemoryStore().(*memoryStore)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	s.Set(ctx, "/a?x", []byte("1"), time.Minute)
+	s.Set(ctx, "/a?y", []byte("2"), time.Minute)
+	s.Set(ctx, "/b", []byte("3"), time.Second)
+
+	if v, ok, _ := s.Get(ctx, "/a?x"); !ok || string(v) != "1" {
+		t.Errorf("unexpected value; got %q, %v", v, ok)
+	}
+
+	now = now.Add(2 * time.Second)
+	if _, ok, _ := s.Get(ctx, "/b"); ok {
+		t.Error("expired entry should not be returned")
+	}
+
+	s.DeletePrefix(ctx, "/a?")
+	if _, ok, _ := s.Get(ctx, "/a?y"); ok {
+		t.Error("entry should have been deleted by prefix")
+	}
+}
+
+func TestMemoryStoreSetIfAbsent(t *testing.T) {
+	now := time.Now()
+	s := NewMemoryStore().(*memoryStore)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if ok, err := s.SetIfAbsent(ctx, "k", []byte("1"), time.Minute); !ok || err != nil {
+		t.Fatalf("expected the value to be stored, got %v, %v", ok, err)
+	}
+	if ok, _ := s.SetIfAbsent(ctx, "k", []byte("2"), time.Minute); ok {
+		t.Error("expected a set key to be kept")
+	}
+	if v, _, _ := s.Get(ctx, "k"); string(v) != "1" {
+		t.Errorf("unexpected value %q", v)
+	}
+
+	now = now.Add(time.Minute)
+	if ok, _ := s.SetIfAbsent(ctx, "k", []byte("3"), time.Minute); !ok {
+		t.Error("expected an expired key to be replaced")
+	}
+}
@@ -0,0 +1,319 @@
+// Package capture records sanitized HTTP request and response pairs so
+// production bugs can be reproduced locally. The middleware is opt-in:
+// add it to the routes being debugged, typically behind a Filter, and
+// it writes each exchange, with its trace ID, to a Sink after redacting
+// credentials and secret fields. A Replayer feeds captured requests back
+// through the same endpoint on a developer's machine.
+//
+//	sink := capture.NewBlobSink(store, "captures/orders/")
+//	h = capture.NewMiddleware(sink, logger, capture.Filter(func(r *http.Request) bool {
+//		return flags.Enabled(r.Context(), "capture-orders")
+//	}))(h)
+//
+// and locally:
+//
+//	exchanges, err := capture.ReadExchanges(f)
+//	replayer := capture.NewEndpointReplayer(endpoints.CreateOrder, decodeCreateOrderRequest)
+//	result, err := replayer.Replay(ctx, exchanges[0])
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/model"
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+	"go.uber.org/zap"
+)
+
+// DefaultMaxBodySize is the number of bytes of each body captured by
+// default.
+const DefaultMaxBodySize = 64 << 10
+
+// DefaultSinkTimeout is how long writing an exchange to the sink may
+// take by default.
+const DefaultSinkTimeout = 5 * time.Second
+
+// Request is a captured HTTP request.
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+	// Truncated is set when the body exceeded the maximum captured size.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Response is a captured HTTP response.
+type Response struct {
+	Status    int         `json:"status"`
+	Header    http.Header `json:"header,omitempty"`
+	Body      []byte      `json:"body,omitempty"`
+	Truncated bool        `json:"truncated,omitempty"`
+}
+
+// Exchange is a captured request and the response it was given.
+type Exchange struct {
+	ID       string        `json:"id"`
+	TraceID  string        `json:"trace_id,omitempty"`
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration"`
+	Request  Request       `json:"request"`
+	Response Response      `json:"response"`
+}
+
+// Option configures the capture middleware.
+type Option func(*options)
+
+type options struct {
+	filter      func(r *http.Request) bool
+	maxBodySize int64
+	sinkTimeout time.Duration
+	sanitizer   *sanitizer
+	sanitize    []func(ex *Exchange)
+}
+
+// Filter captures only the requests for which fn returns true, such as
+// those of a tenant being debugged or while a feature flag is on. All
+// requests are captured by default.
+func Filter(fn func(r *http.Request) bool) Option {
+	return func(o *options) {
+		o.filter = fn
+	}
+}
+
+// MaxBodySize limits the bytes captured of each request and response
+// body, DefaultMaxBodySize by default. Bodies are always passed on in
+// full.
+func MaxBodySize(n int64) Option {
+	return func(o *options) {
+		o.maxBodySize = n
+	}
+}
+
+// SinkTimeout limits how long writing each exchange to the sink may
+// take, DefaultSinkTimeout by default.
+func SinkTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.sinkTimeout = d
+	}
+}
+
+// RedactHeaders redacts the named headers along with the defaults:
+// Authorization, Proxy-Authorization, Cookie, Set-Cookie and X-Api-Key.
+func RedactHeaders(names ...string) Option {
+	return func(o *options) {
+		for _, name := range names {
+			o.sanitizer.headers[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+}
+
+// RedactFields redacts the named JSON body fields and form and query
+// parameters, matched case insensitively at any depth, along with the
+// defaults such as password, secret and token.
+func RedactFields(names ...string) Option {
+	return func(o *options) {
+		for _, name := range names {
+			o.sanitizer.addField(name)
+		}
+	}
+}
+
+// Sanitize runs fn on each exchange after the built in redaction and
+// before it is written, for data only the service knows to be
+// sensitive.
+func Sanitize(fn func(ex *Exchange)) Option {
+	return func(o *options) {
+		o.sanitize = append(o.sanitize, fn)
+	}
+}
+
+// NewMiddleware returns HTTP middleware writing each request it serves,
+// and the response, to sink once the response is complete. Exchanges
+// are sanitized before they reach the sink, and sink errors are logged
+// without failing the request. The sink is written with a context that
+// outlives the request, so a client hanging up doesn't cancel the
+// write, limited by SinkTimeout.
+func NewMiddleware(sink Sink, logger log.Factory, opts ...Option) func(http.Handler) http.Handler {
+	o := options{
+		filter:      func(*http.Request) bool { return true },
+		maxBodySize: DefaultMaxBodySize,
+		sinkTimeout: DefaultSinkTimeout,
+		sanitizer:   newSanitizer(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !o.filter(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ex := &Exchange{
+				ID:      model.NewUUIDv7(),
+				TraceID: traceID(r.Context()),
+				Time:    time.Now(),
+				Request: Request{
+					Method: r.Method,
+					URL:    r.URL.RequestURI(),
+					Header: r.Header.Clone(),
+				},
+			}
+			if r.Body != nil && r.Body != http.NoBody {
+				body, err := io.ReadAll(io.LimitReader(r.Body, o.maxBodySize+1))
+				if err != nil {
+					log.Warn(logger.For(r.Context()), "Failed to capture request body", zap.Error(err))
+				}
+				r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+				ex.Request.Body, ex.Request.Truncated = truncate(body, o.maxBodySize)
+			}
+
+			rec := &recorder{ResponseWriter: w, status: http.StatusOK, max: o.maxBodySize}
+			next.ServeHTTP(rec, r)
+			ex.Duration = time.Since(ex.Time)
+			ex.Response = Response{
+				Status:    rec.status,
+				Header:    rec.header,
+				Body:      rec.body,
+				Truncated: rec.truncated,
+			}
+			if ex.Response.Header == nil {
+				ex.Response.Header = w.Header().Clone()
+			}
+
+			o.sanitizer.sanitize(ex)
+			for _, fn := range o.sanitize {
+				fn(ex)
+			}
+			ctx, cancel := context.WithTimeout(detached{r.Context()}, o.sinkTimeout)
+			defer cancel()
+			if err := sink.Write(ctx, ex); err != nil {
+				log.Warn(logger.For(r.Context()), "Failed to write captured request", zap.String("capture_id", ex.ID), zap.Error(err))
+			}
+		})
+	}
+}
+
+// detached carries the values of a request's context, such as its span,
+// without its deadline or cancellation.
+type detached struct {
+	parent context.Context
+}
+
+func (detached) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detached) Done() <-chan struct{}               { return nil }
+func (detached) Err() error                          { return nil }
+func (c detached) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
+// readCloser reads the captured start of a body followed by the rest,
+// closing the original.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func truncate(body []byte, max int64) ([]byte, bool) {
+	if int64(len(body)) > max {
+		return body[:max], true
+	}
+	return body, false
+}
+
+func traceID(ctx context.Context) string {
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		if sc, ok := span.Context().(jaeger.SpanContext); ok {
+			return sc.TraceID().String()
+		}
+	}
+	return ""
+}
+
+// recorder records the status, headers and leading bytes of a response
+// written through a ResponseWriter.
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	header      http.Header
+	body        []byte
+	max         int64
+	truncated   bool
+	wroteHeader bool
+}
+
+func (w *recorder) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.header = w.ResponseWriter.Header().Clone()
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recorder) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if room := w.max - int64(len(w.body)); room < int64(len(b)) {
+		w.body = append(w.body, b[:maxInt64(room, 0)]...)
+		w.truncated = true
+	} else {
+		w.body = append(w.body, b...)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush passes through to the underlying writer so streaming responses
+// still work.
+func (w *recorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack passes through to the underlying writer so WebSocket upgrades
+// still work. Nothing written to a hijacked connection is captured.
+func (w *recorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("capture: response writer does not support hijacking")
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (w *recorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// ReadExchanges reads exchanges written by a WriterSink, or a single
+// exchange stored by a BlobSink.
+func ReadExchanges(r io.Reader) ([]*Exchange, error) {
+	var exchanges []*Exchange
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var ex Exchange
+		if err := dec.Decode(&ex); err == io.EOF {
+			return exchanges, nil
+		} else if err != nil {
+			return nil, err
+		}
+		exchanges = append(exchanges, &ex)
+	}
+}
@@ -0,0 +1,209 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jdotw/go-utils/blobstore"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/transport"
+)
+
+type memorySink struct {
+	exchanges []*Exchange
+	ctxErr    error
+}
+
+func (s *memorySink) Write(ctx context.Context, ex *Exchange) error {
+	s.exchanges = append(s.exchanges, ex)
+	s.ctxErr = ctx.Err()
+	return nil
+}
+
+func echo(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Set-Cookie", "session=abc")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(body)
+}
+
+func TestMiddlewareSanitizes(t *testing.T) {
+	sink := &memorySink{}
+	h := NewMiddleware(sink, log.NewMockLogFactory(), RedactFields("card_number"), RedactHeaders("X-Session"))(http.HandlerFunc(echo))
+
+	body := `{"name":"widget","password":"hunter2","payment":{"card_number":"4242"},"items":[{"token":"t"}]}`
+	r := httptest.NewRequest(http.MethodPost, "/widgets?api_key=k&page=2", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Authorization", "Bearer secret")
+	r.Header.Set("X-Session", "s")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusCreated || w.Body.String() != body {
+		t.Errorf("expected the request to be served unchanged, got %d %s", w.Code, w.Body)
+	}
+	if len(sink.exchanges) != 1 {
+		t.Fatalf("expected 1 exchange, got %d", len(sink.exchanges))
+	}
+	ex := sink.exchanges[0]
+	if ex.ID == "" || ex.Request.Method != http.MethodPost || ex.Response.Status != http.StatusCreated {
+		t.Errorf("unexpected exchange %+v", ex)
+	}
+	if ex.Request.URL != "/widgets?api_key=REDACTED&page=2" {
+		t.Errorf("expected the query to be redacted, got %s", ex.Request.URL)
+	}
+	for _, v := range []string{ex.Request.Header.Get("Authorization"), ex.Request.Header.Get("X-Session"), ex.Response.Header.Get("Set-Cookie")} {
+		if v != Redacted {
+			t.Errorf("expected headers to be redacted, got %q", v)
+		}
+	}
+	for _, b := range [][]byte{ex.Request.Body, ex.Response.Body} {
+		var v map[string]interface{}
+		if err := json.Unmarshal(b, &v); err != nil {
+			t.Fatal(err)
+		}
+		if v["name"] != "widget" || v["password"] != Redacted ||
+			v["payment"].(map[string]interface{})["card_number"] != Redacted ||
+			v["items"].([]interface{})[0].(map[string]interface{})["token"] != Redacted {
+			t.Errorf("expected secret fields to be redacted, got %s", b)
+		}
+	}
+}
+
+func TestMiddlewareTruncatesAndFilters(t *testing.T) {
+	sink := &memorySink{}
+	h := NewMiddleware(sink, log.NewMockLogFactory(), MaxBodySize(4), Filter(func(r *http.Request) bool {
+		return r.URL.Path != "/health"
+	}))(http.HandlerFunc(echo))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+	if len(sink.exchanges) != 0 {
+		t.Errorf("expected filtered requests not to be captured, got %d", len(sink.exchanges))
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("0123456789"))
+	r.Header.Set("Content-Type", "text/plain")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Body.String() != "0123456789" {
+		t.Errorf("expected the full body to be served, got %q", w.Body)
+	}
+	ex := sink.exchanges[0]
+	// Only JSON and form bodies can be redacted, so others are dropped
+	if ex.Request.Body != nil || !ex.Request.Truncated {
+		t.Errorf("expected the text request body to be dropped, got %q", ex.Request.Body)
+	}
+	// Truncated JSON can't be redacted either
+	if ex.Response.Body != nil || !ex.Response.Truncated {
+		t.Errorf("expected the truncated JSON response to be dropped, got %q", ex.Response.Body)
+	}
+
+	if _, err := NewReplayer(http.HandlerFunc(echo)).Replay(context.Background(), ex); err != ErrTruncated {
+		t.Errorf("expected ErrTruncated, got %v", err)
+	}
+}
+
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (w *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	return nil, nil, nil
+}
+
+func TestMiddlewareOutlivesRequest(t *testing.T) {
+	sink := &memorySink{}
+	h := NewMiddleware(sink, log.NewMockLogFactory())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, err := w.(http.Hijacker).Hijack(); err != nil {
+			t.Errorf("expected hijacking to pass through, got %v", err)
+		}
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("\x08\x96\x01")).WithContext(ctx)
+	r.Header.Set("Content-Type", "application/x-protobuf")
+	w := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(w, r)
+	if !w.hijacked {
+		t.Error("expected the connection to be hijacked")
+	}
+	if sink.ctxErr != nil {
+		t.Errorf("expected the sink write to outlive the request, got %v", sink.ctxErr)
+	}
+	if ex := sink.exchanges[0]; ex.Request.Body != nil {
+		t.Errorf("expected the protobuf body to be dropped, got %q", ex.Request.Body)
+	}
+}
+
+type greetRequest struct {
+	Name string `json:"name"`
+}
+
+func TestCaptureAndReplay(t *testing.T) {
+	greetings := map[string]string{"ada": "Hello"}
+	e := func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(greetRequest)
+		return map[string]string{"greeting": greetings[req.Name] + ", " + req.Name}, nil
+	}
+	replayer := NewEndpointReplayer(e, transport.HTTPDecodeJSONRequest[greetRequest], ReplayHeader("Authorization", "Bearer local"))
+
+	var buf bytes.Buffer
+	h := NewMiddleware(NewWriterSink(&buf), log.NewMockLogFactory())(replayer.handler)
+	for _, name := range []string{"ada", "alan"} {
+		r := httptest.NewRequest(http.MethodPost, "/greet", strings.NewReader(`{"name":"`+name+`"}`))
+		r.Header.Set("Content-Type", "application/json")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	exchanges, err := ReadExchanges(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exchanges) != 2 {
+		t.Fatalf("expected 2 exchanges, got %d", len(exchanges))
+	}
+
+	greetings["alan"] = "Hi"
+	for i, changed := range []bool{false, true} {
+		result, err := replayer.Replay(context.Background(), exchanges[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Response.Status != http.StatusOK || result.Changed() != changed {
+			t.Errorf("replay %d: expected changed=%t, got %d %s", i, changed, result.Response.Status, result.Response.Body)
+		}
+	}
+}
+
+func TestBlobSink(t *testing.T) {
+	store := blobstore.NewMemoryStore()
+	sink := NewBlobSink(store, "captures/")
+	ex := &Exchange{ID: "0190", TraceID: "abc", Request: Request{Method: http.MethodGet, URL: "/"}}
+	if err := sink.Write(context.Background(), ex); err != nil {
+		t.Fatal(err)
+	}
+	blob, err := store.Get(context.Background(), "captures/0190.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blob.Close()
+	exchanges, err := ReadExchanges(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exchanges) != 1 || exchanges[0].TraceID != "abc" || blob.Metadata["trace_id"] != "abc" {
+		t.Errorf("unexpected stored exchange %+v", exchanges)
+	}
+}
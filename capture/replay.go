@@ -0,0 +1,114 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/jdotw/go-utils/authn/jwt"
+	"github.com/jdotw/go-utils/transport"
+)
+
+// ErrTruncated is returned when replaying a request whose body was
+// truncated when captured.
+var ErrTruncated = errors.New("captured request body is truncated")
+
+// Result is the outcome of replaying an exchange.
+type Result struct {
+	// Exchange is the replayed exchange, as captured.
+	Exchange *Exchange
+	// Response is the response given to the replayed request.
+	Response Response
+}
+
+// Changed reports whether the replayed response differs from the
+// captured one in status or body.
+func (r *Result) Changed() bool {
+	return r.Response.Status != r.Exchange.Response.Status || !bytes.Equal(r.Response.Body, r.Exchange.Response.Body)
+}
+
+// ReplayOption configures a Replayer.
+type ReplayOption func(*Replayer)
+
+// ReplayHeader sets a header on replayed requests, replacing the
+// captured value. Use it to supply credentials in place of redacted
+// ones, such as a token for a local issuer.
+func ReplayHeader(name, value string) ReplayOption {
+	return func(r *Replayer) {
+		r.header.Set(name, value)
+	}
+}
+
+// ReplayServerOptions adds go-kit ServerOptions to the server built by
+// NewEndpointReplayer, such as the ServerBefore functions of the
+// service's own server.
+func ReplayServerOptions(opts ...kithttp.ServerOption) ReplayOption {
+	return func(r *Replayer) {
+		r.serverOpts = append(r.serverOpts, opts...)
+	}
+}
+
+// Replayer feeds captured requests through a handler in process.
+type Replayer struct {
+	handler    http.Handler
+	header     http.Header
+	serverOpts []kithttp.ServerOption
+}
+
+// NewReplayer returns a Replayer serving requests with h.
+func NewReplayer(h http.Handler, opts ...ReplayOption) *Replayer {
+	r := &Replayer{handler: h, header: make(http.Header)}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// NewEndpointReplayer returns a Replayer serving requests with e, decoded
+// by dec and encoded as by the transport package, as a service's go-kit
+// HTTP server would.
+func NewEndpointReplayer(e endpoint.Endpoint, dec kithttp.DecodeRequestFunc, opts ...ReplayOption) *Replayer {
+	r := NewReplayer(nil, opts...)
+	serverOpts := append([]kithttp.ServerOption{
+		kithttp.ServerBefore(kithttp.PopulateRequestContext, jwt.HTTPAuthorizationToContext(), transport.AcceptLanguageToContext()),
+		kithttp.ServerErrorEncoder(transport.HTTPErrorEncoder),
+	}, r.serverOpts...)
+	r.handler = kithttp.NewServer(e, dec, transport.HTTPEncodeResponse, serverOpts...)
+	return r
+}
+
+// Replay serves the captured request of ex with ctx, which may carry a
+// trace span or identity for the replay, and returns the response.
+func (r *Replayer) Replay(ctx context.Context, ex *Exchange) (*Result, error) {
+	if ex.Request.Truncated {
+		return nil, ErrTruncated
+	}
+	req, err := http.NewRequestWithContext(ctx, ex.Request.Method, ex.Request.URL, bytes.NewReader(ex.Request.Body))
+	if err != nil {
+		return nil, err
+	}
+	req.RequestURI = ex.Request.URL
+	req.Header = ex.Request.Header.Clone()
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	for name, values := range r.header {
+		req.Header[name] = values
+	}
+
+	w := httptest.NewRecorder()
+	r.handler.ServeHTTP(w, req)
+	resp := w.Result()
+	return &Result{
+		Exchange: ex,
+		Response: Response{
+			Status: resp.StatusCode,
+			Header: resp.Header,
+			Body:   w.Body.Bytes(),
+		},
+	}, nil
+}
@@ -0,0 +1,146 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Redacted replaces the values of redacted headers, fields and
+// parameters.
+const Redacted = "REDACTED"
+
+var (
+	defaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+	defaultRedactedFields  = []string{"password", "secret", "token", "access_token", "refresh_token", "id_token", "api_key", "client_secret"}
+)
+
+// sanitizer redacts credentials and secret fields from exchanges.
+type sanitizer struct {
+	headers map[string]bool
+	fields  map[string]bool
+}
+
+func newSanitizer() *sanitizer {
+	s := &sanitizer{headers: make(map[string]bool), fields: make(map[string]bool)}
+	for _, h := range defaultRedactedHeaders {
+		s.headers[h] = true
+	}
+	for _, f := range defaultRedactedFields {
+		s.addField(f)
+	}
+	return s
+}
+
+func (s *sanitizer) addField(name string) {
+	s.fields[strings.ToLower(name)] = true
+}
+
+func (s *sanitizer) sanitize(ex *Exchange) {
+	s.redactHeader(ex.Request.Header)
+	s.redactHeader(ex.Response.Header)
+	if u, err := url.Parse(ex.Request.URL); err == nil && u.RawQuery != "" {
+		q := u.Query()
+		if s.redactValues(q) {
+			u.RawQuery = q.Encode()
+			ex.Request.URL = u.String()
+		}
+	}
+	ex.Request.Body = s.redactBody(ex.Request.Header.Get("Content-Type"), ex.Request.Body, ex.Request.Truncated)
+	ex.Response.Body = s.redactBody(ex.Response.Header.Get("Content-Type"), ex.Response.Body, ex.Response.Truncated)
+}
+
+func (s *sanitizer) redactHeader(h http.Header) {
+	for name, values := range h {
+		if s.headers[http.CanonicalHeaderKey(name)] {
+			for i := range values {
+				values[i] = Redacted
+			}
+		}
+	}
+}
+
+func (s *sanitizer) redactValues(values url.Values) bool {
+	redacted := false
+	for name, vs := range values {
+		if s.fields[strings.ToLower(name)] {
+			for i := range vs {
+				vs[i] = Redacted
+			}
+			redacted = true
+		}
+	}
+	return redacted
+}
+
+// redactBody redacts fields of JSON and form bodies. Bodies it can't
+// redact, because they are truncated, malformed or of another type such
+// as protobuf or multipart, are dropped rather than risking a secret
+// being captured.
+func (s *sanitizer) redactBody(contentType string, body []byte, truncated bool) []byte {
+	if len(body) == 0 {
+		return body
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		if truncated {
+			return nil
+		}
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return nil
+		}
+		if !s.redactJSON(v) {
+			return body
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil
+		}
+		return b
+	case mediaType == "application/x-www-form-urlencoded":
+		if truncated {
+			return nil
+		}
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil
+		}
+		if !s.redactValues(values) {
+			return body
+		}
+		return []byte(values.Encode())
+	}
+	return nil
+}
+
+// redactJSON redacts the fields of v, reporting whether it found any.
+func (s *sanitizer) redactJSON(v interface{}) bool {
+	redacted := false
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, fv := range v {
+			if s.fields[strings.ToLower(k)] {
+				v[k] = Redacted
+				redacted = true
+				continue
+			}
+			if s.redactJSON(fv) {
+				redacted = true
+			}
+		}
+	case []interface{}:
+		for _, ev := range v {
+			if s.redactJSON(ev) {
+				redacted = true
+			}
+		}
+	}
+	return redacted
+}
@@ -0,0 +1,67 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/jdotw/go-utils/blobstore"
+)
+
+// Sink stores captured exchanges. Exchanges are written as requests
+// complete, so Write should be quick.
+type Sink interface {
+	Write(ctx context.Context, ex *Exchange) error
+}
+
+// SinkFunc adapts a function to a Sink.
+type SinkFunc func(ctx context.Context, ex *Exchange) error
+
+// Write implements Sink.
+func (f SinkFunc) Write(ctx context.Context, ex *Exchange) error {
+	return f(ctx, ex)
+}
+
+type writerSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewWriterSink returns a Sink writing exchanges to w as JSON lines, as
+// read by ReadExchanges. Writes are serialized, so w need not be safe
+// for concurrent use.
+func NewWriterSink(w io.Writer) Sink {
+	return &writerSink{enc: json.NewEncoder(w)}
+}
+
+func (s *writerSink) Write(_ context.Context, ex *Exchange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(ex)
+}
+
+type blobSink struct {
+	store  blobstore.Store
+	prefix string
+}
+
+// NewBlobSink returns a Sink storing each exchange as a JSON object in
+// store, keyed by prefix and the exchange ID. IDs are time ordered, so
+// listing the prefix lists exchanges in the order they were captured.
+func NewBlobSink(store blobstore.Store, prefix string) Sink {
+	return &blobSink{store: store, prefix: prefix}
+}
+
+func (s *blobSink) Write(ctx context.Context, ex *Exchange) error {
+	b, err := json.Marshal(ex)
+	if err != nil {
+		return err
+	}
+	_, err = s.store.Put(ctx, s.prefix+ex.ID+".json", bytes.NewReader(b), blobstore.PutOptions{
+		ContentType: "application/json",
+		Metadata:    map[string]string{"trace_id": ex.TraceID},
+	})
+	return err
+}
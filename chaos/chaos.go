@@ -0,0 +1,249 @@
+// Package chaos injects faults into requests, so teams can test how
+// services and their clients handle slow dependencies, errors and
+// dropped connections: timeouts, retries and circuit breakers. Faults
+// add latency, fail requests with a status, or abort them without a
+// response, and are scoped to a percentage of requests, to tenants, or
+// to requests that opt in with a header. Only enable it in staging.
+//
+//	injector := chaos.NewInjector(logger, []chaos.Fault{
+//		{Name: "slow", Latency: 2 * time.Second, Jitter: time.Second, Percentage: 10},
+//		{Name: "unavailable", Status: http.StatusServiceUnavailable, OptIn: true},
+//		{Name: "drop", Abort: true, Tenants: []string{"chaos-tenant"}},
+//	}, chaos.Metrics(prometheus.DefaultRegisterer))
+//	handler = injector.NewHTTPMiddleware()(handler)
+//
+// Requests opt in to a fault by naming it in the X-Chaos header:
+//
+//	curl -H "X-Chaos: unavailable" https://orders.staging/orders
+package chaos
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/jdotw/go-utils/clock"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/metrics"
+	"github.com/jdotw/go-utils/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultHeader is the header requests name faults in to opt in to them.
+const DefaultHeader = "X-Chaos"
+
+// Fault is a failure injected into the requests in its scope. A fault
+// adds its latency first, then aborts the request or fails it with its
+// error or status. Faults with only latency let the request continue.
+type Fault struct {
+	// Name identifies the fault in logs, metrics and the opt in header.
+	Name string
+
+	// OptIn limits the fault to requests naming it in the chaos header.
+	OptIn bool
+	// Tenants limits the fault to requests from these tenants.
+	Tenants []string
+	// Percentage limits the fault to a share of the requests in its
+	// scope, from 0 to 100. Zero applies it to all of them.
+	Percentage float64
+
+	// Latency delays requests by this long, plus up to Jitter more.
+	Latency time.Duration
+	Jitter  time.Duration
+	// Err fails requests with this error, such as a sentinel the client
+	// is expected to handle.
+	Err error
+	// Status fails requests with an *Error of this status, when Err is
+	// nil.
+	Status int
+	// Abort drops the connection without a response.
+	Abort bool
+}
+
+// Error is the error of a fault failing requests with a status.
+type Error struct {
+	Fault  string
+	Status int
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("chaos: fault %s injected status %d", e.Fault, e.Status)
+}
+
+// StatusCode implements go-kit's StatusCoder.
+func (e *Error) StatusCode() int {
+	return e.Status
+}
+
+func (f Fault) err() error {
+	if f.Err != nil {
+		return f.Err
+	}
+	if f.Status != 0 {
+		return &Error{Fault: f.Name, Status: f.Status}
+	}
+	return nil
+}
+
+type contextKey string
+
+// HeaderContextKey holds the key used to store the chaos header in the
+// context.
+const HeaderContextKey contextKey = "ChaosHeader"
+
+// HeaderToContext moves the named chaos header to context, so endpoint
+// middleware can apply faults requests opt in to. An empty header uses
+// DefaultHeader.
+func HeaderToContext(header string) kithttp.RequestFunc {
+	if header == "" {
+		header = DefaultHeader
+	}
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if v := r.Header.Get(header); v != "" {
+			return context.WithValue(ctx, HeaderContextKey, v)
+		}
+		return ctx
+	}
+}
+
+// optedIn reports whether the chaos header in ctx, a comma separated
+// list of fault names, names fault.
+func optedIn(ctx context.Context, fault string) bool {
+	v, _ := ctx.Value(HeaderContextKey).(string)
+	for _, name := range strings.Split(v, ",") {
+		if strings.TrimSpace(name) == fault {
+			return true
+		}
+	}
+	return false
+}
+
+type options struct {
+	header   string
+	clock    clock.Clock
+	injected *prometheus.CounterVec
+}
+
+// Option configures an Injector.
+type Option func(*options)
+
+// Header reads the opt in header from name rather than DefaultHeader in
+// the HTTP middleware.
+func Header(name string) Option {
+	return func(o *options) {
+		o.header = name
+	}
+}
+
+// WithClock makes the Injector wait out latency on c rather than the
+// system clock.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// Metrics registers a counter of the faults injected, by fault, with
+// registerer.
+func Metrics(registerer prometheus.Registerer) Option {
+	return func(o *options) {
+		if registerer == nil {
+			registerer = prometheus.DefaultRegisterer
+		}
+		o.injected = metrics.MustRegister(registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "chaos_faults_injected_total",
+			Help: "Number of requests faults were injected into, by fault.",
+		}, []string{"fault"}))
+	}
+}
+
+// Injector injects faults into requests.
+type Injector struct {
+	logger log.Factory
+	opts   options
+	// random returns a number in [0, 100) to place requests in a fault's
+	// percentage
+	random func() float64
+
+	mu     sync.RWMutex
+	faults []Fault
+}
+
+// NewInjector returns an Injector injecting faults.
+func NewInjector(logger log.Factory, faults []Fault, opts ...Option) *Injector {
+	o := options{header: DefaultHeader, clock: clock.New()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Injector{
+		logger: logger,
+		opts:   o,
+		random: func() float64 { return rand.Float64() * 100 },
+		faults: faults,
+	}
+}
+
+// SetFaults replaces the faults injected, such as when reloading config.
+// No faults turns injection off.
+func (i *Injector) SetFaults(faults ...Fault) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.faults = faults
+}
+
+// match returns the first fault whose scope ctx is in.
+func (i *Injector) match(ctx context.Context) (Fault, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	for _, f := range i.faults {
+		if f.OptIn && !optedIn(ctx, f.Name) {
+			continue
+		}
+		if len(f.Tenants) > 0 && !contains(f.Tenants, tenant.Resolve(ctx)) {
+			continue
+		}
+		if f.Percentage > 0 && i.random() >= f.Percentage {
+			continue
+		}
+		return f, true
+	}
+	return Fault{}, false
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// delay waits out f's latency, returning early with ctx's error if it is
+// done first.
+func (i *Injector) delay(ctx context.Context, f Fault) error {
+	d := f.Latency
+	if f.Jitter > 0 {
+		d += time.Duration(rand.Int63n(int64(f.Jitter)))
+	}
+	if d <= 0 {
+		return nil
+	}
+	select {
+	case <-i.opts.clock.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (i *Injector) observe(f Fault) {
+	if i.opts.injected != nil {
+		i.opts.injected.WithLabelValues(f.Name).Inc()
+	}
+}
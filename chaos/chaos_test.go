@@ -0,0 +1,122 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jdotw/go-utils/clock"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func ok(context.Context, interface{}) (interface{}, error) {
+	return "ok", nil
+}
+
+func TestMiddlewareScopes(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	i := NewInjector(log.NewMockLogFactory(), []Fault{
+		{Name: "unavailable", Status: http.StatusServiceUnavailable, OptIn: true},
+		{Name: "timeout", Err: context.DeadlineExceeded, Tenants: []string{"acme"}},
+		{Name: "flaky", Status: http.StatusInternalServerError, Percentage: 25},
+	}, Metrics(registry))
+	random := 50.0
+	i.random = func() float64 { return random }
+	e := i.NewMiddleware()(ok)
+
+	if _, err := e(context.Background(), nil); err != nil {
+		t.Errorf("expected requests outside every scope to succeed, got %v", err)
+	}
+	var chaosErr *Error
+	ctx := context.WithValue(context.Background(), HeaderContextKey, "other, unavailable")
+	if _, err := e(ctx, nil); !errors.As(err, &chaosErr) || chaosErr.StatusCode() != http.StatusServiceUnavailable {
+		t.Errorf("expected the opted in fault, got %v", err)
+	}
+	if _, err := e(tenant.WithID(context.Background(), "acme"), nil); err != context.DeadlineExceeded {
+		t.Errorf("expected the tenant's fault, got %v", err)
+	}
+	random = 10
+	if _, err := e(context.Background(), nil); !errors.As(err, &chaosErr) || chaosErr.Fault != "flaky" {
+		t.Errorf("expected the percentage's fault, got %v", err)
+	}
+
+	i.SetFaults()
+	if _, err := e(ctx, nil); err != nil {
+		t.Errorf("expected no faults after clearing them, got %v", err)
+	}
+	if n := testutil.ToFloat64(i.opts.injected.WithLabelValues("unavailable")); n != 1 {
+		t.Errorf("expected 1 unavailable fault counted, got %v", n)
+	}
+}
+
+func TestMiddlewareLatency(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	i := NewInjector(log.NewMockLogFactory(), []Fault{{Name: "slow", Latency: time.Second}}, WithClock(clk))
+	e := i.NewMiddleware()(ok)
+
+	done := make(chan error)
+	go func() {
+		_, err := e(context.Background(), nil)
+		done <- err
+	}()
+	clk.BlockUntil(1)
+	select {
+	case <-done:
+		t.Fatal("expected the request to be delayed")
+	default:
+	}
+	clk.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Errorf("expected the request to continue after the latency, got %v", err)
+	}
+
+	// Cancelling the request ends the delay
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		_, err := e(ctx, nil)
+		done <- err
+	}()
+	clk.BlockUntil(1)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	i := NewInjector(log.NewMockLogFactory(), []Fault{
+		{Name: "unavailable", Status: http.StatusServiceUnavailable, OptIn: true},
+		{Name: "drop", Abort: true, OptIn: true},
+	})
+	h := i.NewHTTPMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected the request to be served, got %d", w.Code)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(DefaultHeader, "unavailable")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected the injected status, got %d", w.Code)
+	}
+
+	r.Header.Set(DefaultHeader, "drop")
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Errorf("expected the request to be aborted, got %v", rec)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), r)
+}
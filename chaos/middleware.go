@@ -0,0 +1,75 @@
+package chaos
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/jdotw/go-utils/transport"
+	"go.uber.org/zap"
+)
+
+// NewMiddleware returns endpoint middleware injecting faults. Faults
+// requests opt in to need the header moved to context by
+// HeaderToContext, and those scoped to tenants need the tenant
+// middleware to run first. Aborting panics with http.ErrAbortHandler,
+// which the transport recovery middleware passes on for the HTTP server
+// to drop the connection.
+func (i *Injector) NewMiddleware() endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			f, ok := i.match(ctx)
+			if !ok {
+				return next(ctx, request)
+			}
+			i.observe(f)
+			i.logger.For(ctx).Info("Injecting fault", zap.String("fault", f.Name))
+			if err := i.delay(ctx, f); err != nil {
+				return nil, err
+			}
+			if f.Abort {
+				panic(http.ErrAbortHandler)
+			}
+			if err := f.err(); err != nil {
+				return nil, err
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// NewHTTPMiddleware returns HTTP middleware injecting faults, for
+// handlers that aren't go-kit endpoints or to fail requests before they
+// are decoded. Failed requests are encoded with transport's
+// HTTPErrorEncoder, and aborted ones have their connection dropped.
+// Faults scoped to tenants only apply if the tenant is in the request's
+// context, such as from tracing baggage.
+func (i *Injector) NewHTTPMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			if v := r.Header.Get(i.opts.header); v != "" {
+				ctx = context.WithValue(ctx, HeaderContextKey, v)
+			}
+			f, ok := i.match(ctx)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			i.observe(f)
+			i.logger.For(ctx).Info("Injecting fault", zap.String("fault", f.Name))
+			if err := i.delay(ctx, f); err != nil {
+				// The request was cancelled, so no one is waiting for a response
+				return
+			}
+			if f.Abort {
+				panic(http.ErrAbortHandler)
+			}
+			if err := f.err(); err != nil {
+				transport.HTTPErrorEncoder(ctx, err, w)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
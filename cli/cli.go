@@ -0,0 +1,139 @@
+// Package cli gives every service binary the same operational commands,
+// built on the app bootstrap:
+//
+//	func main() {
+//		var cfg Config // embeds app.Config
+//		cli.Main("orders",
+//			cli.Serve("orders", setup, app.WithConfig(&cfg)),
+//			cli.Migrate(openDB, migrateUp, migrateDown),
+//			cli.Healthcheck(),
+//			cli.Config(&cfg),
+//			cli.Routes(makeRouter),
+//		)
+//	}
+//
+// giving "orders serve", "orders migrate up", "orders healthcheck",
+// "orders config validate" and "orders routes list".
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+)
+
+// ErrUsage is returned when a command is invoked incorrectly. The usage
+// has already been printed.
+var ErrUsage = errors.New("usage error")
+
+// Command is a subcommand of a service binary.
+type Command struct {
+	// Name is the word used to invoke the command.
+	Name string
+	// Usage is the arguments after Name, e.g. "up|down".
+	Usage string
+	// Summary is a one line description shown in help.
+	Summary string
+	// Flags registers the command's flags before it runs.
+	Flags func(fs *flag.FlagSet)
+	// Run runs the command with the arguments left after parsing flags.
+	Run func(ctx context.Context, out io.Writer, args []string) error
+}
+
+// CLI dispatches to Commands by name.
+type CLI struct {
+	Name     string
+	Commands []*Command
+	// Out and Err default to os.Stdout and os.Stderr.
+	Out io.Writer
+	Err io.Writer
+}
+
+// New returns a CLI for the binary called name.
+func New(name string, commands ...*Command) *CLI {
+	return &CLI{Name: name, Commands: commands, Out: os.Stdout, Err: os.Stderr}
+}
+
+// Run runs the command named by args[0] with the rest of args.
+func (c *CLI) Run(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		c.usage()
+		if len(args) == 0 {
+			return ErrUsage
+		}
+		return nil
+	}
+	for _, cmd := range c.Commands {
+		if cmd.Name != args[0] {
+			continue
+		}
+		fs := flag.NewFlagSet(c.Name+" "+cmd.Name, flag.ContinueOnError)
+		fs.SetOutput(c.Err)
+		fs.Usage = func() {
+			fmt.Fprintf(c.Err, "Usage: %s %s [flags] %s\n\n%s\n", c.Name, cmd.Name, cmd.Usage, cmd.Summary)
+			fs.PrintDefaults()
+		}
+		if cmd.Flags != nil {
+			cmd.Flags(fs)
+		}
+		if err := fs.Parse(args[1:]); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil
+			}
+			return ErrUsage
+		}
+		err := cmd.Run(ctx, c.Out, fs.Args())
+		if errors.Is(err, ErrUsage) {
+			fs.Usage()
+		}
+		return err
+	}
+	fmt.Fprintf(c.Err, "%s: unknown command %q\n\n", c.Name, args[0])
+	c.usage()
+	return ErrUsage
+}
+
+func (c *CLI) usage() {
+	fmt.Fprintf(c.Err, "Usage: %s <command> [flags] [args]\n\nCommands:\n", c.Name)
+	tw := tabwriter.NewWriter(c.Err, 0, 4, 2, ' ', 0)
+	for _, cmd := range c.Commands {
+		fmt.Fprintf(tw, "  %s %s\t%s\n", cmd.Name, cmd.Usage, cmd.Summary)
+	}
+	tw.Flush()
+}
+
+// Main runs a CLI with os.Args, cancelling the context on SIGINT or
+// SIGTERM, and exits non-zero if the command fails.
+func Main(name string, commands ...*Command) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	c := New(name, commands...)
+	err := c.Run(ctx, os.Args[1:])
+	stop()
+	switch {
+	case errors.Is(err, ErrUsage):
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintf(c.Err, "%s: %v\n", name, err)
+		os.Exit(1)
+	}
+}
+
+// subcommand returns the single argument naming a subcommand of a
+// command, or ErrUsage if it is not one of valid.
+func subcommand(args []string, valid ...string) (string, error) {
+	if len(args) != 1 {
+		return "", ErrUsage
+	}
+	for _, v := range valid {
+		if args[0] == v {
+			return v, nil
+		}
+	}
+	return "", ErrUsage
+}
@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jdotw/go-utils/lock"
+	"github.com/jdotw/go-utils/transport"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+)
+
+func newTestCLI(commands ...*Command) (*CLI, *bytes.Buffer, *bytes.Buffer) {
+	var out, errOut bytes.Buffer
+	c := New("svc", commands...)
+	c.Out = &out
+	c.Err = &errOut
+	return c, &out, &errOut
+}
+
+func TestRun(t *testing.T) {
+	ran := false
+	cmd := &Command{
+		Name:    "hello",
+		Summary: "Say hello",
+		Run: func(ctx context.Context, out io.Writer, args []string) error {
+			ran = true
+			return nil
+		},
+	}
+	c, _, errOut := newTestCLI(cmd)
+
+	if err := c.Run(context.Background(), []string{"hello"}); err != nil || !ran {
+		t.Errorf("expected command to run, got %v", err)
+	}
+	if err := c.Run(context.Background(), []string{"bogus"}); !errors.Is(err, ErrUsage) {
+		t.Errorf("expected usage error for unknown command, got %v", err)
+	}
+	if !strings.Contains(errOut.String(), "Say hello") {
+		t.Errorf("expected usage to list commands, got %q", errOut.String())
+	}
+	if err := c.Run(context.Background(), nil); !errors.Is(err, ErrUsage) {
+		t.Errorf("expected usage error without a command, got %v", err)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	var applied []string
+	step := func(name string) func(context.Context, *gorm.DB) error {
+		return func(context.Context, *gorm.DB) error {
+			applied = append(applied, name)
+			return nil
+		}
+	}
+	open := func(context.Context) (*gorm.DB, lock.Backend, error) {
+		db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{})
+		return db, lock.NewMemoryBackend(), err
+	}
+	c, _, _ := newTestCLI(Migrate(open, step("up"), step("down")))
+	ctx := context.Background()
+
+	for _, direction := range []string{"up", "down"} {
+		if err := c.Run(ctx, []string{"migrate", direction}); err != nil {
+			t.Fatalf("migrate %s: %v", direction, err)
+		}
+	}
+	if strings.Join(applied, ",") != "up,down" {
+		t.Errorf("unexpected migrations %v", applied)
+	}
+	if err := c.Run(ctx, []string{"migrate", "sideways"}); !errors.Is(err, ErrUsage) {
+		t.Errorf("expected usage error, got %v", err)
+	}
+
+	c, _, _ = newTestCLI(Migrate(open, step("up"), nil))
+	if err := c.Run(ctx, []string{"migrate", "down"}); !errors.Is(err, ErrNoDownMigration) {
+		t.Errorf("expected ErrNoDownMigration, got %v", err)
+	}
+}
+
+func TestHealthcheck(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	c, out, _ := newTestCLI(Healthcheck())
+	ctx := context.Background()
+
+	if err := c.Run(ctx, []string{"healthcheck", "-url", srv.URL}); err != nil || out.String() != "OK\n" {
+		t.Errorf("expected healthy, got %v", err)
+	}
+	status = http.StatusServiceUnavailable
+	if err := c.Run(ctx, []string{"healthcheck", "-url", srv.URL}); err == nil {
+		t.Error("expected unhealthy")
+	}
+}
+
+func TestReadyURL(t *testing.T) {
+	for addr, want := range map[string]string{
+		":9090":         "http://localhost:9090/readyz",
+		"0.0.0.0:9090":  "http://localhost:9090/readyz",
+		"10.0.0.1:9090": "http://10.0.0.1:9090/readyz",
+		"[::1]:9090":    "http://[::1]:9090/readyz",
+	} {
+		if have, err := readyURL(addr); err != nil || have != want {
+			t.Errorf("%s: expected %s, got %s (%v)", addr, want, have, err)
+		}
+	}
+}
+
+type testConfig struct {
+	Name string `json:"name" env:"CLI_TEST_NAME" validate:"required"`
+}
+
+func TestConfig(t *testing.T) {
+	var cfg testConfig
+	c, out, _ := newTestCLI(Config(&cfg))
+	ctx := context.Background()
+
+	if err := c.Run(ctx, []string{"config", "validate"}); err == nil {
+		t.Error("expected missing required field to fail validation")
+	}
+	t.Setenv("CLI_TEST_NAME", "orders")
+	if err := c.Run(ctx, []string{"config", "validate"}); err != nil || !strings.Contains(out.String(), "valid") {
+		t.Errorf("expected valid config, got %v", err)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	build := func(context.Context) (*transport.Router, error) {
+		router := transport.NewRouter(http.NewServeMux())
+		ok := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+		router.Handle(http.MethodPost, "/widgets", ok)
+		router.Handle(http.MethodGet, "/widgets", ok)
+		router.Handle(http.MethodGet, "/gadgets", ok)
+		return router, nil
+	}
+	c, out, _ := newTestCLI(Routes(build))
+	if err := c.Run(context.Background(), []string{"routes", "list"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "METHOD  PATTERN\nGET     /gadgets\nGET     /widgets\nPOST    /widgets\n"
+	if out.String() != want {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+}
@@ -0,0 +1,195 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jdotw/go-utils/app"
+	"github.com/jdotw/go-utils/config"
+	"github.com/jdotw/go-utils/db"
+	"github.com/jdotw/go-utils/lock"
+	"github.com/jdotw/go-utils/transport"
+	"gorm.io/gorm"
+)
+
+// ErrNoDownMigration is returned by "migrate down" when the service has
+// no down migration.
+var ErrNoDownMigration = errors.New("no down migration")
+
+// Serve returns the "serve" command, which creates the app with opts,
+// calls setup to register its servers and hooks, and runs it until
+// shutdown.
+func Serve(name string, setup func(ctx context.Context, a *app.App) error, opts ...app.Option) *Command {
+	return &Command{
+		Name:    "serve",
+		Summary: "Run the service",
+		Run: func(ctx context.Context, _ io.Writer, args []string) error {
+			if len(args) != 0 {
+				return ErrUsage
+			}
+			a, err := app.New(name, opts...)
+			if err != nil {
+				return err
+			}
+			if err := setup(ctx, a); err != nil {
+				return err
+			}
+			return a.Run(ctx)
+		},
+	}
+}
+
+// OpenFunc opens the database to migrate and the lock backend
+// serializing migrations across replicas, which may be nil.
+type OpenFunc func(ctx context.Context) (*gorm.DB, lock.Backend, error)
+
+// Migrate returns the "migrate up|down" command, running up or down with
+// db.Migrate. down may be nil if the service only migrates forwards.
+func Migrate(open OpenFunc, up, down db.MigrateFunc) *Command {
+	return &Command{
+		Name:    "migrate",
+		Usage:   "up|down",
+		Summary: "Apply or roll back database migrations",
+		Run: func(ctx context.Context, out io.Writer, args []string) error {
+			direction, err := subcommand(args, "up", "down")
+			if err != nil {
+				return err
+			}
+			migrate := up
+			if direction == "down" {
+				if down == nil {
+					return ErrNoDownMigration
+				}
+				migrate = down
+			}
+			conn, backend, err := open(ctx)
+			if err != nil {
+				return err
+			}
+			if sqlDB, err := conn.DB(); err == nil {
+				defer sqlDB.Close()
+			}
+			if err := db.Migrate(ctx, conn, backend, migrate); err != nil {
+				return fmt.Errorf("migrate %s: %w", direction, err)
+			}
+			fmt.Fprintf(out, "Migrated %s\n", direction)
+			return nil
+		},
+	}
+}
+
+// Healthcheck returns the "healthcheck" command, which exits non-zero
+// unless the running service's /readyz endpoint on the admin server
+// succeeds. It suits container health checks, as images need no curl.
+// The admin address is loaded from app.Config with opts.
+func Healthcheck(opts ...config.Option) *Command {
+	var url string
+	var timeout time.Duration
+	return &Command{
+		Name:    "healthcheck",
+		Summary: "Check the running service is ready",
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&url, "url", "", "URL to check (default /readyz on the admin server)")
+			fs.DurationVar(&timeout, "timeout", 5*time.Second, "request timeout")
+		},
+		Run: func(ctx context.Context, out io.Writer, args []string) error {
+			if len(args) != 0 {
+				return ErrUsage
+			}
+			target := url
+			if target == "" {
+				var cfg app.Config
+				if err := config.Load(&cfg, opts...); err != nil {
+					return err
+				}
+				u, err := readyURL(cfg.AdminAddr)
+				if err != nil {
+					return err
+				}
+				target = u
+			}
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+			if err != nil {
+				return err
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("%s: %s", target, resp.Status)
+			}
+			fmt.Fprintln(out, "OK")
+			return nil
+		},
+	}
+}
+
+// readyURL returns the /readyz URL of a server listening on addr, which
+// may omit the host.
+func readyURL(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("admin address %q: %w", addr, err)
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port) + "/readyz", nil
+}
+
+// Config returns the "config validate" command, which loads cfg with
+// opts as the service would and reports any problems.
+func Config(cfg interface{}, opts ...config.Option) *Command {
+	return &Command{
+		Name:    "config",
+		Usage:   "validate",
+		Summary: "Check the configuration loads and validates",
+		Run: func(ctx context.Context, out io.Writer, args []string) error {
+			if _, err := subcommand(args, "validate"); err != nil {
+				return err
+			}
+			if err := config.Load(cfg, opts...); err != nil {
+				return err
+			}
+			fmt.Fprintln(out, "Configuration is valid")
+			return nil
+		},
+	}
+}
+
+// Routes returns the "routes list" command, printing the routes of the
+// router returned by build. build should register routes without
+// opening connections, e.g. with nil dependencies.
+func Routes(build func(ctx context.Context) (*transport.Router, error)) *Command {
+	return &Command{
+		Name:    "routes",
+		Usage:   "list",
+		Summary: "List the HTTP routes",
+		Run: func(ctx context.Context, out io.Writer, args []string) error {
+			if _, err := subcommand(args, "list"); err != nil {
+				return err
+			}
+			router, err := build(ctx)
+			if err != nil {
+				return err
+			}
+			tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "METHOD\tPATTERN")
+			for _, r := range router.Routes() {
+				fmt.Fprintf(tw, "%s\t%s\n", r.Method, r.Pattern)
+			}
+			return tw.Flush()
+		},
+	}
+}
@@ -0,0 +1,304 @@
+package clientgen
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jdotw/go-utils/authn/jwt"
+	"github.com/jdotw/go-utils/errorsx"
+	"github.com/jdotw/go-utils/httpclient"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/recorderrors"
+	"github.com/jdotw/go-utils/transport"
+	"github.com/opentracing/opentracing-go"
+)
+
+// maxErrorBody is the most of an error response read to decode it.
+const maxErrorBody = 64 << 10
+
+// Client sends the requests of generated clients.
+type Client struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewClient returns a Client calling the service called name at baseURL
+// with an httpclient client, so calls are traced and carry the request
+// ID. Calls forward the caller's JWT from the context, unless opts set
+// another token source with httpclient.BearerToken.
+func NewClient(name, baseURL string, logger log.Factory, tracer opentracing.Tracer, opts ...httpclient.Option) *Client {
+	opts = append([]httpclient.Option{httpclient.ForwardToken(jwt.TokenFromContext)}, opts...)
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  httpclient.New(name, logger, tracer, opts...),
+	}
+}
+
+// Do sends request to the route of method and path, whose path
+// variables are taken from the request's fields tagged path, as
+// transport.BindParams binds them. Fields tagged query become query
+// parameters, and POST, PUT and PATCH requests are sent as JSON. A
+// successful response is decoded as JSON into response, unless it is
+// nil or the status is 204. Error responses are returned as errors of
+// the shared taxonomy; see DecodeError.
+func (c *Client) Do(ctx context.Context, method, path string, request, response interface{}) error {
+	u, err := requestURL(c.baseURL, path, request)
+	if err != nil {
+		return err
+	}
+	var body io.Reader
+	if request != nil && (method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch) {
+		b, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", transport.ContentTypeJSON)
+	if body != nil {
+		req.Header.Set("Content-Type", transport.ContentTypeJSON)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return DecodeError(resp)
+	}
+	if response == nil || resp.StatusCode == http.StatusNoContent {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+// requestURL expands the path variables of path from request, and adds
+// its query parameters.
+func requestURL(baseURL, path string, request interface{}) (string, error) {
+	pathVars, query := url.Values{}, url.Values{}
+	if request != nil {
+		v := reflect.Indirect(reflect.ValueOf(request))
+		if v.Kind() == reflect.Struct {
+			if err := params(v, pathVars, query); err != nil {
+				return "", err
+			}
+		}
+	}
+	var missing error
+	expanded := expandPath(path, func(name string) string {
+		if _, ok := pathVars[name]; !ok && missing == nil {
+			missing = fmt.Errorf("clientgen: no value for path variable %s of %s", name, path)
+		}
+		return url.PathEscape(pathVars.Get(name))
+	})
+	if missing != nil {
+		return "", missing
+	}
+	u := baseURL + expanded
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u, nil
+}
+
+// expandPath replaces the {name} variables of path with value(name).
+func expandPath(path string, value func(name string) string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(path, "{")
+		end := strings.Index(path, "}")
+		if start < 0 || end < start {
+			b.WriteString(path)
+			return b.String()
+		}
+		b.WriteString(path[:start])
+		// Drop any gorilla/mux pattern, as in {id:[0-9]+}
+		name := strings.SplitN(path[start+1:end], ":", 2)[0]
+		b.WriteString(value(name))
+		path = path[end+1:]
+	}
+}
+
+// params collects the values of the fields of v tagged path and query.
+func params(v reflect.Value, pathVars, query url.Values) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := params(v.Field(i), pathVars, query); err != nil {
+				return err
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name, ok := field.Tag.Lookup("path"); ok {
+			values, err := formatValues(v.Field(i))
+			if err != nil {
+				return fmt.Errorf("clientgen: path variable %s: %w", name, err)
+			}
+			if len(values) > 0 {
+				pathVars.Set(name, values[0])
+			}
+		} else if tag, ok := field.Tag.Lookup("query"); ok {
+			name := strings.Split(tag, ",")[0]
+			f := v.Field(i)
+			if f.IsZero() {
+				continue
+			}
+			values, err := formatValues(f)
+			if err != nil {
+				return fmt.Errorf("clientgen: query parameter %s: %w", name, err)
+			}
+			query[name] = values
+		}
+	}
+	return nil
+}
+
+var (
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	timeType          = reflect.TypeOf(time.Time{})
+	durationType      = reflect.TypeOf(time.Duration(0))
+)
+
+// formatValues formats v as transport.BindParams parses it, with a
+// value per element of slices.
+func formatValues(v reflect.Value) ([]string, error) {
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		values := make([]string, v.Len())
+		for i := range values {
+			s, err := formatValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			values[i] = s
+		}
+		return values, nil
+	}
+	s, err := formatValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return []string{s}, nil
+}
+
+func formatValue(v reflect.Value) (string, error) {
+	switch {
+	case v.Type() == timeType:
+		return v.Interface().(time.Time).Format(time.RFC3339Nano), nil
+	case v.Type() == durationType:
+		return v.Interface().(time.Duration).String(), nil
+	case v.Type().Implements(textMarshalerType):
+		b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	}
+	return "", fmt.Errorf("unsupported type %s", v.Type())
+}
+
+// errorBody holds the fields of both transport.HTTPErrorResponse and
+// transport.ProblemDetails, so either error format decodes.
+type errorBody struct {
+	transport.HTTPErrorResponse
+	Detail     string                 `json:"detail"`
+	Title      string                 `json:"title"`
+	ResourceID string                 `json:"resource_id"`
+	Errors     []transport.FieldError `json:"errors"`
+}
+
+// DecodeError returns the error described by an error response written
+// by transport's error encoders, in either format. Errors with a
+// recorderrors code are returned as a *recorderrors.Error, matching its
+// sentinels with errors.Is; others carry their code for errorsx.CodeOf
+// and their message for errorsx.Message. Either way, returning the
+// error from an endpoint responds with the same status and message.
+// Responses without a code get the code for their status.
+func DecodeError(resp *http.Response) error {
+	var body errorBody
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	json.Unmarshal(b, &body)
+
+	code := body.Code
+	if code == "" {
+		code = errorsx.CodeForHTTPStatus(resp.StatusCode)
+	}
+	message := body.Error
+	if message == "" {
+		message = body.Detail
+	}
+	if message == "" {
+		message = body.Title
+	}
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+
+	switch rc := recorderrors.Code(code); rc {
+	case recorderrors.CodeNotFound, recorderrors.CodeAlreadyExists, recorderrors.CodeConflict,
+		recorderrors.CodeValidation, recorderrors.CodePreconditionFailed, recorderrors.CodeUnavailable:
+		e := &recorderrors.Error{Code: rc, Resource: body.Resource, ID: body.ID, Fields: body.Fields}
+		if e.ID == "" {
+			e.ID = body.ResourceID
+		}
+		if len(e.Fields) == 0 {
+			e.Fields = body.Errors
+		}
+		e.Message = recordMessage(e, message)
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			e.RetryIn = time.Duration(secs) * time.Second
+		}
+		return e
+	}
+	return errorsx.NewCode(code, message)
+}
+
+// recordMessage returns the Message of e given the message of the error
+// response, which is e's Error: the resource and fields it adds are
+// removed, and the sentinel's text is left for e to default to.
+func recordMessage(e *recorderrors.Error, message string) string {
+	if e.Resource != "" {
+		prefix := e.Resource
+		if e.ID != "" {
+			prefix += " " + e.ID
+		}
+		message = strings.TrimPrefix(message, prefix+": ")
+	}
+	if len(e.Fields) > 0 {
+		if i := strings.LastIndex(message, ": "+e.Fields[0].Field+" "); i >= 0 {
+			message = message[:i]
+		}
+	}
+	if message == (&recorderrors.Error{Code: e.Code}).Error() {
+		return ""
+	}
+	return message
+}
@@ -0,0 +1,153 @@
+package clientgen
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jdotw/go-utils/authn/jwt"
+	"github.com/jdotw/go-utils/errorsx"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/recorderrors"
+	"github.com/jdotw/go-utils/transport"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+type getOrderRequest struct {
+	ID     string        `path:"id" json:"-"`
+	Expand []string      `query:"expand" json:"-"`
+	Wait   time.Duration `query:"wait" json:"-"`
+}
+
+type updateOrderRequest struct {
+	ID    string `path:"id" json:"-"`
+	Notes string `json:"notes"`
+}
+
+type order struct {
+	ID    string `json:"id"`
+	Notes string `json:"notes"`
+}
+
+func TestGenerate(t *testing.T) {
+	src, err := Generate(Service{
+		Name:    "order-history",
+		Package: "historyclient",
+		Endpoints: []Endpoint{
+			{Name: "GetOrder", Method: "get", Path: "/orders/{id}", Request: getOrderRequest{}, Response: order{}},
+			{Name: "ListFieldErrors", Method: http.MethodGet, Path: "/errors", Response: []recorderrors.FieldError{},
+				Doc: "ListFieldErrors lists errors.\nIt has no request."},
+			{Name: "Purge", Method: "PURGE", Path: "/orders/{id:[0-9]+}", Request: &updateOrderRequest{}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"// Code generated by clientgen. DO NOT EDIT.\n\npackage historyclient\n",
+		"import (\n\t\"context\"\n\t\"net/http\"\n\n\tclientgen \"github.com/jdotw/go-utils/clientgen\"\n",
+		`clientgen "github.com/jdotw/go-utils/clientgen"`,
+		`recorderrors "github.com/jdotw/go-utils/recorderrors"`,
+		`"github.com/opentracing/opentracing-go"`,
+		"type OrderHistoryClient struct {",
+		"func NewOrderHistoryClient(baseURL string, logger log.Factory, tracer opentracing.Tracer, opts ...httpclient.Option) *OrderHistoryClient {",
+		`clientgen.NewClient("order-history", baseURL, logger, tracer, opts...)`,
+		"// GetOrder calls GET /orders/{id}.\nfunc (c *OrderHistoryClient) GetOrder(ctx context.Context, request clientgen.getOrderRequest) (*clientgen.order, error) {",
+		`c.c.Do(ctx, http.MethodGet, "/orders/{id}", request, &response)`,
+		"// ListFieldErrors lists errors.\n// It has no request.\nfunc (c *OrderHistoryClient) ListFieldErrors(ctx context.Context) ([]recorderrors.FieldError, error) {",
+		"\treturn response, nil\n",
+		"\treturn &response, nil\n",
+		`func (c *OrderHistoryClient) Purge(ctx context.Context, request *clientgen.updateOrderRequest) error {`,
+		`return c.c.Do(ctx, "PURGE", "/orders/{id:[0-9]+}", request, nil)`,
+	} {
+		if !strings.Contains(string(src), expected) {
+			t.Errorf("expected the client to contain %q, got:\n%s", expected, src)
+		}
+	}
+
+	invalid := []Service{
+		{Name: "orders", Package: "ordersclient", Endpoints: []Endpoint{{Name: "GetOrder", Method: http.MethodGet, Path: "/orders/{order_id}", Request: getOrderRequest{}}}},
+		{Name: "orders", Package: "ordersclient", Endpoints: []Endpoint{{Name: "Get", Method: http.MethodGet, Path: "/"}, {Name: "Get", Method: http.MethodGet, Path: "/"}}},
+		{Name: "orders", Package: "ordersclient", Endpoints: []Endpoint{{Name: "get", Method: http.MethodGet, Path: "/"}}},
+		{Name: "orders", Package: "orders-client"},
+	}
+	for _, svc := range invalid {
+		if _, err := Generate(svc); err == nil {
+			t.Errorf("expected %+v to be invalid", svc.Endpoints)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	var received *http.Request
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body = nil
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/orders/a b":
+			transport.HTTPEncodeResponse(r.Context(), w, order{ID: "a b"})
+		case "/orders/42":
+			transport.HTTPErrorEncoder(r.Context(), recorderrors.NotFound("order", "42"), w)
+		case "/orders/43":
+			transport.HTTPErrorEncoder(r.Context(), recorderrors.Conflict("order", "43", "already shipped"), w)
+		default:
+			transport.HTTPErrorEncoder(r.Context(), errorsx.NewCode(errorsx.CodePermissionDenied, "not your order"), w)
+		}
+	}))
+	defer srv.Close()
+
+	tracer := mocktracer.New()
+	c := NewClient("orders", srv.URL+"/", log.NewMockLogFactory(), tracer)
+	ctx := context.WithValue(context.Background(), jwt.JWTContextKey, "caller-token")
+
+	var o order
+	err := c.Do(ctx, http.MethodGet, "/orders/{id}", getOrderRequest{ID: "a b", Expand: []string{"items", "notes"}, Wait: time.Second}, &o)
+	if err != nil || o.ID != "a b" {
+		t.Fatalf("expected the order, got %+v, %v", o, err)
+	}
+	if q := received.URL.RawQuery; q != "expand=items&expand=notes&wait=1s" {
+		t.Errorf("unexpected query %s", q)
+	}
+	if auth := received.Header.Get("Authorization"); auth != "Bearer caller-token" {
+		t.Errorf("expected the caller's JWT to be forwarded, got %q", auth)
+	}
+	if received.Header.Get("Mockpfx-Ids-Traceid") == "" || len(tracer.FinishedSpans()) != 1 {
+		t.Errorf("expected the trace context to be propagated, got %v", received.Header)
+	}
+
+	if err := c.Do(ctx, http.MethodPatch, "/orders/{id}", updateOrderRequest{ID: "44", Notes: "leave at door"}, nil); err == nil {
+		t.Fatal("expected an error")
+	} else if errorsx.CodeOf(err) != errorsx.CodePermissionDenied || errorsx.Message(err) != "not your order" || errorsx.HTTPStatus(err) != http.StatusForbidden {
+		t.Errorf("expected the remote code and message, got %v", err)
+	}
+	if body["notes"] != "leave at door" || body["ID"] != nil {
+		t.Errorf("expected the request as the body, got %v", body)
+	}
+
+	err = c.Do(ctx, http.MethodGet, "/orders/{id}", getOrderRequest{ID: "42"}, &o)
+	var re *recorderrors.Error
+	if !errors.Is(err, recorderrors.ErrNotFound) || !errors.As(err, &re) || re.Resource != "order" || re.ID != "42" {
+		t.Errorf("expected the record error, got %#v", err)
+	}
+	if err.Error() != "order 42: record not found" {
+		t.Errorf("expected the remote error message, got %q", err)
+	}
+
+	transport.SetErrorFormat(transport.ErrorFormatProblem)
+	defer transport.SetErrorFormat(transport.ErrorFormatJSON)
+	err = c.Do(ctx, http.MethodGet, "/orders/{id}", getOrderRequest{ID: "43"}, &o)
+	if !errors.Is(err, recorderrors.ErrConflict) || !errors.As(err, &re) || re.ID != "43" || re.Message != "already shipped" {
+		t.Errorf("expected the record error from problem details, got %#v", err)
+	}
+
+	if err := c.Do(ctx, http.MethodGet, "/orders/{id}", nil, &o); err == nil {
+		t.Error("expected a missing path variable to fail")
+	}
+}
@@ -0,0 +1,398 @@
+// Package clientgen generates typed Go clients for services from their
+// endpoint definitions. Generated clients send requests with the
+// instrumented httpclient, forward the caller's JWT, propagate the trace
+// context and request ID, and return error responses as errors of the
+// shared taxonomy, so a service calling another handles its errors as it
+// would its own.
+//
+// A service describes its endpoints in a small program run by go
+// generate:
+//
+//	//go:generate go run ./gen
+//	func main() {
+//		err := clientgen.WriteFile("ordersclient/client.go", clientgen.Service{
+//			Name:    "orders",
+//			Package: "ordersclient",
+//			Endpoints: []clientgen.Endpoint{
+//				{Name: "CreateOrder", Method: http.MethodPost, Path: "/orders",
+//					Request: orders.CreateOrderRequest{}, Response: orders.Order{}},
+//				{Name: "GetOrder", Method: http.MethodGet, Path: "/orders/{id}",
+//					Request: orders.GetOrderRequest{}, Response: orders.Order{}},
+//			},
+//		})
+//		...
+//	}
+//
+// and other services call it through the generated client:
+//
+//	client := ordersclient.NewOrdersClient("http://orders:8080", logger, tracer)
+//	order, err := client.GetOrder(ctx, orders.GetOrderRequest{ID: id})
+//	if errors.Is(err, recorderrors.ErrNotFound) {
+//		...
+//	}
+package clientgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// Endpoint describes an endpoint of a service.
+type Endpoint struct {
+	// Name is the client method calling the endpoint, such as
+	// "CreateOrder".
+	Name string
+	// Doc documents the client method. It defaults to the route.
+	Doc string
+	// Method and Path are the endpoint's route. Path variables, such as
+	// {id} in "/orders/{id}", are taken from the request's fields tagged
+	// path, as transport.BindParams binds them.
+	Method string
+	Path   string
+	// Request and Response are values of the endpoint's request and
+	// response types, such as orders.GetOrderRequest{}. A nil Request
+	// sends none, and a nil Response discards the response.
+	Request  interface{}
+	Response interface{}
+}
+
+// Service describes a service and its endpoints.
+type Service struct {
+	// Name is the service's name, such as "orders". It names the client
+	// type, OrdersClient, and labels the client's spans and metrics.
+	Name string
+	// Package is the name of the generated client's package.
+	Package   string
+	Endpoints []Endpoint
+}
+
+// WriteFile generates the client for svc and writes it to filename.
+func WriteFile(filename string, svc Service) error {
+	src, err := Generate(svc)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, src, 0644)
+}
+
+// Generate returns the formatted source of the client for svc.
+func Generate(svc Service) ([]byte, error) {
+	if !token.IsIdentifier(svc.Package) {
+		return nil, fmt.Errorf("clientgen: invalid package name %q", svc.Package)
+	}
+	client := exported(svc.Name)
+	if !token.IsIdentifier(client) {
+		return nil, fmt.Errorf("clientgen: invalid service name %q", svc.Name)
+	}
+	imports := newImports(
+		"github.com/jdotw/go-utils/clientgen",
+		"github.com/jdotw/go-utils/httpclient",
+		"github.com/jdotw/go-utils/log",
+		"github.com/opentracing/opentracing-go",
+	)
+
+	data := struct {
+		Package string
+		Service string
+		Client  string
+		Imports []genImport
+		Methods []genMethod
+	}{Package: svc.Package, Service: svc.Name, Client: client + "Client"}
+
+	names := map[string]bool{}
+	for _, e := range svc.Endpoints {
+		if !token.IsIdentifier(e.Name) || !token.IsExported(e.Name) {
+			return nil, fmt.Errorf("clientgen: invalid endpoint name %q", e.Name)
+		}
+		if names[e.Name] {
+			return nil, fmt.Errorf("clientgen: duplicate endpoint name %s", e.Name)
+		}
+		names[e.Name] = true
+		if err := checkPathVars(e); err != nil {
+			return nil, err
+		}
+		imports.name("context")
+		m := genMethod{
+			Name:   e.Name,
+			Doc:    comment(e.Doc),
+			Method: imports.methodConstant(e.Method),
+			Path:   strconv.Quote(e.Path),
+		}
+		if e.Doc == "" {
+			m.Doc = comment(fmt.Sprintf("%s calls %s %s.", e.Name, strings.ToUpper(e.Method), e.Path))
+		}
+		for _, v := range []interface{}{e.Request, e.Response} {
+			if v != nil && generic(reflect.TypeOf(v)) {
+				return nil, fmt.Errorf("clientgen: %s: generic type %T is not supported, declare a type for it", e.Name, v)
+			}
+		}
+		if e.Request != nil {
+			m.Request = imports.typeExpr(reflect.TypeOf(e.Request))
+		}
+		if e.Response != nil {
+			t := reflect.TypeOf(e.Response)
+			m.Response = imports.typeExpr(t)
+			// Slices and maps are returned as they are, as they can
+			// already be nil
+			m.Pointer = t.Kind() != reflect.Slice && t.Kind() != reflect.Map
+		}
+		data.Methods = append(data.Methods, m)
+	}
+	data.Imports = imports.list()
+
+	var buf bytes.Buffer
+	if err := clientTemplate.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("clientgen: generated invalid source: %w", err)
+	}
+	return src, nil
+}
+
+// exported turns a service name such as "order-history" into an
+// exported identifier such as "OrderHistory".
+func exported(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// checkPathVars checks every variable of e's path is set from a field of
+// its request.
+func checkPathVars(e Endpoint) error {
+	fields := map[string]bool{}
+	if e.Request != nil {
+		pathFields(reflect.TypeOf(e.Request), fields)
+	}
+	var err error
+	expandPath(e.Path, func(name string) string {
+		if !fields[name] && err == nil {
+			err = fmt.Errorf("clientgen: %s: no request field tagged path:%q", e.Name, name)
+		}
+		return ""
+	})
+	return err
+}
+
+func pathFields(t reflect.Type, fields map[string]bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			pathFields(field.Type, fields)
+			continue
+		}
+		if name, ok := field.Tag.Lookup("path"); ok && field.IsExported() {
+			fields[name] = true
+		}
+	}
+}
+
+// generic reports whether t is or contains an instantiated generic type,
+// whose name can't be written in the generated source.
+func generic(t reflect.Type) bool {
+	if t.Name() != "" {
+		return strings.Contains(t.Name(), "[")
+	}
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return generic(t.Elem())
+	case reflect.Map:
+		return generic(t.Key()) || generic(t.Elem())
+	}
+	return false
+}
+
+// comment turns doc into line comments.
+func comment(doc string) string {
+	lines := strings.Split(strings.TrimSpace(doc), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight("// "+line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+type genImport struct {
+	Name string
+	Path string
+	// Std is set for standard library packages, which are grouped
+	// before the others.
+	Std bool
+}
+
+type genMethod struct {
+	Name     string
+	Doc      string
+	Method   string
+	Path     string
+	Request  string
+	Response string
+	Pointer  bool
+}
+
+// imports names the packages the generated source uses.
+type imports struct {
+	names map[string]string // path to name
+	taken map[string]bool
+	// aliased are the packages of request and response types, which are
+	// always named explicitly as their package name may not match their
+	// path
+	aliased map[string]bool
+}
+
+func newImports(paths ...string) *imports {
+	im := &imports{
+		names: map[string]string{},
+		// Reserve the identifiers used in the generated methods
+		taken:   map[string]bool{"c": true, "ctx": true, "request": true, "response": true, "err": true},
+		aliased: map[string]bool{},
+	}
+	for _, p := range paths {
+		im.name(p)
+	}
+	return im
+}
+
+// name returns the name the package at p is imported as, adding it to
+// the imports if needed.
+func (im *imports) name(p string) string {
+	if name, ok := im.names[p]; ok {
+		return name
+	}
+	base := path.Base(p)
+	if strings.HasPrefix(base, "v") && len(base) > 1 && strings.Trim(base[1:], "0123456789") == "" {
+		// Use the package rather than its major version, as in jwt/v4
+		base = path.Base(path.Dir(p))
+	}
+	// Drop the go of names such as opentracing-go
+	base = strings.TrimPrefix(strings.TrimSuffix(base, "-go"), "go-")
+	base = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			return r
+		}
+		return '_'
+	}, base)
+	name := base
+	for i := 2; im.taken[name] || token.IsKeyword(name); i++ {
+		name = base + strconv.Itoa(i)
+	}
+	im.names[p] = name
+	im.taken[name] = true
+	return name
+}
+
+// methodConstant returns the net/http constant for an HTTP method, or
+// the method quoted if there is none.
+func (im *imports) methodConstant(method string) string {
+	method = strings.ToUpper(method)
+	switch method {
+	case "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS":
+		return im.name("net/http") + ".Method" + method[:1] + strings.ToLower(method[1:])
+	}
+	return strconv.Quote(method)
+}
+
+// typeExpr returns the Go expression for t, importing the packages of
+// the named types in it.
+func (im *imports) typeExpr(t reflect.Type) string {
+	if t.Name() != "" {
+		if t.PkgPath() == "" {
+			return t.Name()
+		}
+		im.aliased[t.PkgPath()] = true
+		return im.name(t.PkgPath()) + "." + t.Name()
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + im.typeExpr(t.Elem())
+	case reflect.Slice:
+		return "[]" + im.typeExpr(t.Elem())
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), im.typeExpr(t.Elem()))
+	case reflect.Map:
+		return "map[" + im.typeExpr(t.Key()) + "]" + im.typeExpr(t.Elem())
+	}
+	return t.String()
+}
+
+func (im *imports) list() []genImport {
+	list := make([]genImport, 0, len(im.names))
+	for p, name := range im.names {
+		imp := genImport{Path: strconv.Quote(p), Std: !strings.Contains(strings.Split(p, "/")[0], ".")}
+		if im.aliased[p] || name != path.Base(p) {
+			imp.Name = name
+		}
+		list = append(list, imp)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Path < list[j].Path
+	})
+	return list
+}
+
+var clientTemplate = template.Must(template.New("client").Parse(`// Code generated by clientgen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}{{if .Std}}
+	{{.Name}} {{.Path}}
+{{- end}}{{end}}
+{{range .Imports}}{{if not .Std}}
+	{{.Name}} {{.Path}}
+{{- end}}{{end}}
+)
+
+// {{.Client}} calls the {{.Service}} service.
+type {{.Client}} struct {
+	c *clientgen.Client
+}
+
+// New{{.Client}} returns a client calling the {{.Service}} service at
+// baseURL. Calls forward the caller's JWT unless opts set another token
+// source.
+func New{{.Client}}(baseURL string, logger log.Factory, tracer opentracing.Tracer, opts ...httpclient.Option) *{{.Client}} {
+	return &{{.Client}}{c: clientgen.NewClient({{printf "%q" .Service}}, baseURL, logger, tracer, opts...)}
+}
+{{range .Methods}}
+{{.Doc}}
+func (c *{{$.Client}}) {{.Name}}(ctx context.Context{{if .Request}}, request {{.Request}}{{end}}) ({{if .Response}}{{if .Pointer}}*{{end}}{{.Response}}, {{end}}error) {
+{{- if .Response}}
+	var response {{.Response}}
+	if err := c.c.Do(ctx, {{.Method}}, {{.Path}}, {{if .Request}}request{{else}}nil{{end}}, &response); err != nil {
+		return nil, err
+	}
+	return {{if .Pointer}}&{{end}}response, nil
+{{- else}}
+	return c.c.Do(ctx, {{.Method}}, {{.Path}}, {{if .Request}}request{{else}}nil{{end}}, nil)
+{{- end}}
+}
+{{end}}`))
@@ -0,0 +1,56 @@
+// Package clock abstracts the passing of time, so code that waits,
+// expires or schedules can be tested without sleeping. Production code
+// takes a Clock, defaulting to New; tests pass a Fake and move it
+// forward by hand.
+//
+//	clk := clock.NewFake(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC))
+//	limiter := ratelimit.NewMemoryLimiter(ratelimit.PerMinute(10), ratelimit.WithClock(clk))
+//	...
+//	clk.Advance(time.Minute)
+package clock
+
+import "time"
+
+// Clock tells the time and waits for it to pass.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// Since returns the time elapsed since t.
+	Since(t time.Time) time.Duration
+	// After waits for d to elapse and then sends the current time on the
+	// returned channel.
+	After(d time.Duration) <-chan time.Time
+	// NewTimer returns a Timer sending the current time on its channel
+	// after at least d.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a single event, as time.Timer.
+type Timer interface {
+	// C returns the channel on which the time is delivered.
+	C() <-chan time.Time
+	// Stop prevents the Timer from firing, reporting whether it was
+	// stopped before firing.
+	Stop() bool
+	// Reset changes the Timer to fire after d, reporting whether it had
+	// been active.
+	Reset(d time.Duration) bool
+}
+
+// New returns the Clock of the time package.
+func New() Clock {
+	return realClock{}
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) NewTimer(d time.Duration) Timer         { return realTimer{time.NewTimer(d)} }
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time { return t.Timer.C }
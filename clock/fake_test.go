@@ -0,0 +1,79 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+func TestFakeTimers(t *testing.T) {
+	f := NewFake(epoch)
+	early := f.NewTimer(time.Second)
+	late := f.After(time.Minute)
+	stopped := f.NewTimer(time.Second)
+	if !stopped.Stop() {
+		t.Error("expected Stop to report an active timer")
+	}
+	if n := f.Waiters(); n != 2 {
+		t.Errorf("expected 2 waiters, got %d", n)
+	}
+
+	f.Advance(30 * time.Second)
+	select {
+	case at := <-early.C():
+		if !at.Equal(epoch.Add(30 * time.Second)) {
+			t.Errorf("expected the timer to deliver the current time, got %s", at)
+		}
+	default:
+		t.Error("expected the due timer to fire")
+	}
+	select {
+	case <-late:
+		t.Error("expected the timer not yet due not to fire")
+	case <-stopped.C():
+		t.Error("expected the stopped timer not to fire")
+	default:
+	}
+	if early.Stop() {
+		t.Error("expected Stop to report a fired timer")
+	}
+
+	f.Set(epoch.Add(time.Minute))
+	select {
+	case <-late:
+	default:
+		t.Error("expected Set to fire the timer")
+	}
+	if f.Since(epoch) != time.Minute {
+		t.Errorf("expected a minute to have passed, got %s", f.Since(epoch))
+	}
+
+	// Reset rearms a fired timer
+	early.Reset(time.Second)
+	f.Advance(time.Second)
+	select {
+	case <-early.C():
+	default:
+		t.Error("expected the reset timer to fire")
+	}
+}
+
+func TestFakeBlockUntil(t *testing.T) {
+	f := NewFake(epoch)
+	done := make(chan time.Time)
+	go func() {
+		done <- <-f.After(time.Hour)
+	}()
+
+	f.BlockUntil(1)
+	f.Advance(time.Hour)
+	select {
+	case at := <-done:
+		if !at.Equal(epoch.Add(time.Hour)) {
+			t.Errorf("expected %s, got %s", epoch.Add(time.Hour), at)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the waiting goroutine to wake")
+	}
+}
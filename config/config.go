@@ -0,0 +1,435 @@
+// Package config loads typed configuration structs from defaults, YAML
+// or JSON files and environment variables, in that order of precedence
+// from lowest to highest, then validates them.
+//
+// Fields are described with struct tags:
+//
+//	type Config struct {
+//		Port     int           `json:"port" env:"PORT" default:"8080"`
+//		Timeout  time.Duration `json:"timeout" env:"TIMEOUT" default:"5s"`
+//		Database string        `json:"database" env:"DATABASE_URL" validate:"required"`
+//		Origins  []string      `json:"origins" env:"CORS_ORIGINS"`
+//	}
+//
+//	var cfg Config
+//	err := config.Load(&cfg, config.Files("config.yaml"), config.Prefix("MYAPP_"))
+//
+// Files are decoded with encoding/json, so fields are named by their
+// json tags, and YAML files are converted to JSON first. Durations in
+// files may be strings such as "5s" or nanoseconds.
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/go-playground/validator/v10"
+)
+
+// ErrRequired is the cause of a FieldError for a required field left
+// empty.
+var ErrRequired = errors.New("required but not set")
+
+var validatorInstance = validator.New()
+
+// ErrUnsupportedFile is returned for files other than .json, .yaml and
+// .yml.
+var ErrUnsupportedFile = errors.New("unsupported config file type")
+
+// Validator is implemented by configs with checks beyond required
+// fields. Validate runs after loading.
+type Validator interface {
+	Validate() error
+}
+
+// FieldError is a problem with one field of a config.
+type FieldError struct {
+	// Field is the path to the field, e.g. "Database.Host".
+	Field string
+	// Source is where the bad value came from, e.g. "env PORT".
+	Source string
+	Err    error
+}
+
+func (e *FieldError) Error() string {
+	if e.Source == "" {
+		return fmt.Sprintf("config %s: %v", e.Field, e.Err)
+	}
+	return fmt.Sprintf("config %s (%s): %v", e.Field, e.Source, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Errors collects every problem found while loading, so they can all be
+// fixed at once.
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+type options struct {
+	files    []string
+	optional []string
+	prefix   string
+	lookup   func(string) (string, bool)
+}
+
+// Option configures Load.
+type Option func(*options)
+
+// Files loads the given files in order, later files overriding earlier
+// ones. Missing files are an error.
+func Files(paths ...string) Option {
+	return func(o *options) {
+		o.files = append(o.files, paths...)
+	}
+}
+
+// OptionalFiles is like Files, but files that don't exist are skipped.
+func OptionalFiles(paths ...string) Option {
+	return func(o *options) {
+		o.files = append(o.files, paths...)
+		o.optional = append(o.optional, paths...)
+	}
+}
+
+// Prefix is prepended to the names in env tags.
+func Prefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+// Lookup replaces os.LookupEnv as the source of environment variables.
+func Lookup(lookup func(string) (string, bool)) Option {
+	return func(o *options) {
+		o.lookup = lookup
+	}
+}
+
+// Load fills the struct cfg points to from defaults, files and the
+// environment, then checks go-playground/validator validate tags and
+// calls Validate if cfg implements Validator.
+func Load(cfg interface{}, opts ...Option) error {
+	o := options{lookup: os.LookupEnv}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	rv := reflect.ValueOf(cfg)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: Load needs a pointer to a struct, got %T", cfg)
+	}
+
+	var errs Errors
+	sources := make(map[string]string)
+	walk(rv.Elem(), "", func(f reflect.Value, sf reflect.StructField, path string) {
+		if def, ok := sf.Tag.Lookup("default"); ok && f.IsZero() {
+			if err := setString(f, def); err != nil {
+				errs = append(errs, &FieldError{Field: path, Source: "default", Err: err})
+			}
+		}
+	})
+	if len(errs) > 0 {
+		return errs
+	}
+
+	for _, path := range o.files {
+		if err := loadFile(cfg, path); err != nil {
+			if errors.Is(err, os.ErrNotExist) && contains(o.optional, path) {
+				continue
+			}
+			return err
+		}
+	}
+
+	walk(rv.Elem(), "", func(f reflect.Value, sf reflect.StructField, path string) {
+		name, ok := sf.Tag.Lookup("env")
+		if !ok || name == "" {
+			return
+		}
+		name = o.prefix + name
+		sources[path] = "env " + name
+		if v, ok := o.lookup(name); ok {
+			if err := setString(f, v); err != nil {
+				errs = append(errs, &FieldError{Field: path, Source: "env " + name, Err: err})
+			}
+		}
+	})
+	if len(errs) > 0 {
+		return errs
+	}
+
+	if err := validate(cfg, sources); err != nil {
+		return err
+	}
+	if v, ok := cfg.(Validator); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+// validate checks validate tags, naming each field's env var as the
+// source of the bad value where it has one.
+func validate(cfg interface{}, sources map[string]string) error {
+	err := validatorInstance.Struct(cfg)
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return err
+	}
+	errs := make(Errors, len(verrs))
+	for i, fe := range verrs {
+		path := strings.SplitN(fe.StructNamespace(), ".", 2)[1]
+		cause := ErrRequired
+		if fe.Tag() != "required" {
+			cause = fmt.Errorf("must satisfy %s", strings.TrimSuffix(fe.Tag()+"="+fe.Param(), "="))
+		}
+		errs[i] = &FieldError{Field: path, Source: sources[path], Err: cause}
+	}
+	return errs
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+func loadFile(cfg interface{}, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	switch filepath.Ext(path) {
+	case ".json":
+	case ".yaml", ".yml":
+		if b, err = yaml.YAMLToJSON(b); err != nil {
+			return fmt.Errorf("config: %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("config: %s: %w", path, ErrUnsupportedFile)
+	}
+	// Durations may be written as strings such as "5s", which
+	// encoding/json can't decode, so they are converted to nanoseconds
+	// first.
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var tree interface{}
+	if err := dec.Decode(&tree); err != nil {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+	tree, err = parseDurations(reflect.TypeOf(cfg), tree, "")
+	if err != nil {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+	if b, err = json.Marshal(tree); err != nil {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+	if err := json.Unmarshal(b, cfg); err != nil {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+	return nil
+}
+
+// parseDurations replaces the duration strings in v, decoded JSON for a
+// value of type t, with their nanoseconds.
+func parseDurations(t reflect.Type, v interface{}, path string) (interface{}, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == durationType {
+		s, ok := v.(string)
+		if !ok {
+			return v, nil
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, &FieldError{Field: path, Err: err}
+		}
+		return int64(d), nil
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if !ok || reflect.PtrTo(t).Implements(jsonUnmarshaler) || reflect.PtrTo(t).Implements(textUnmarshaler) {
+			return v, nil
+		}
+		return obj, parseStructDurations(t, obj, path)
+	case reflect.Slice, reflect.Array:
+		arr, ok := v.([]interface{})
+		if !ok {
+			return v, nil
+		}
+		for i, e := range arr {
+			var err error
+			if arr[i], err = parseDurations(t.Elem(), e, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return nil, err
+			}
+		}
+	case reflect.Map:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return v, nil
+		}
+		for k, e := range obj {
+			var err error
+			if obj[k], err = parseDurations(t.Elem(), e, path+"["+k+"]"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+// parseStructDurations applies parseDurations to the keys of obj naming
+// fields of t, matched like encoding/json matches them.
+func parseStructDurations(t reflect.Type, obj map[string]interface{}, path string) error {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" || !sf.IsExported() && !sf.Anonymous {
+			continue
+		}
+		if sf.Anonymous && name == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if err := parseStructDurations(ft, obj, path); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fieldPath := sf.Name
+		if path != "" {
+			fieldPath = path + "." + sf.Name
+		}
+		for k, v := range obj {
+			if !strings.EqualFold(k, name) {
+				continue
+			}
+			var err error
+			if obj[k], err = parseDurations(sf.Type, v, fieldPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+var (
+	textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	jsonUnmarshaler = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// walk calls fn for each settable field, descending into nested structs
+// that aren't set from text themselves.
+func walk(rv reflect.Value, prefix string, fn func(f reflect.Value, sf reflect.StructField, path string)) {
+	for i := 0; i < rv.NumField(); i++ {
+		sf := rv.Type().Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		f := rv.Field(i)
+		path := sf.Name
+		if prefix != "" {
+			path = prefix + "." + sf.Name
+		}
+		if f.Kind() == reflect.Struct && !reflect.PtrTo(f.Type()).Implements(textUnmarshaler) {
+			walk(f, path, fn)
+			continue
+		}
+		fn(f, sf, path)
+	}
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setString parses s into f according to its type. Slices are comma
+// separated.
+func setString(f reflect.Value, s string) error {
+	if f.CanAddr() && f.Addr().Type().Implements(textUnmarshaler) {
+		return f.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	if f.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+		return nil
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 0, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 0, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	case reflect.Slice:
+		var parts []string
+		if s != "" {
+			parts = strings.Split(s, ",")
+		}
+		slice := reflect.MakeSlice(f.Type(), len(parts), len(parts))
+		for i, p := range parts {
+			if err := setString(slice.Index(i), strings.TrimSpace(p)); err != nil {
+				return err
+			}
+		}
+		f.Set(slice)
+	case reflect.Ptr:
+		v := reflect.New(f.Type().Elem())
+		if err := setString(v.Elem(), s); err != nil {
+			return err
+		}
+		f.Set(v)
+	default:
+		return fmt.Errorf("unsupported type %s", f.Type())
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type database struct {
+	Host string `json:"host" env:"DB_HOST" default:"localhost"`
+	Port int    `json:"port" env:"DB_PORT" default:"5432" validate:"min=1,max=65535"`
+}
+
+type testConfig struct {
+	Name     string        `json:"name" env:"NAME" validate:"required"`
+	Debug    bool          `json:"debug" env:"DEBUG"`
+	Timeout  time.Duration `json:"timeout" env:"TIMEOUT" default:"5s"`
+	Origins  []string      `json:"origins" env:"ORIGINS"`
+	Database database      `json:"database"`
+}
+
+func env(vars map[string]string) Option {
+	return Lookup(func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	})
+}
+
+func writeFile(t *testing.T, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	yamlFile := writeFile(t, "config.yaml", "name: from-yaml\ntimeout: 10000000000\ndatabase:\n  host: db.internal\n")
+	jsonFile := writeFile(t, "override.json", `{"debug": true}`)
+
+	var cfg testConfig
+	err := Load(&cfg,
+		Files(yamlFile, jsonFile),
+		OptionalFiles(filepath.Join(t.TempDir(), "missing.yaml")),
+		Prefix("APP_"),
+		env(map[string]string{"APP_DB_PORT": "6543", "APP_ORIGINS": "a.com, b.com"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := testConfig{
+		Name:     "from-yaml",
+		Debug:    true,
+		Timeout:  10 * time.Second,
+		Origins:  []string{"a.com", "b.com"},
+		Database: database{Host: "db.internal", Port: 6543},
+	}
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("expected %+v, got %+v", expected, cfg)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	// Every bad field is reported at once
+	var cfg testConfig
+	err := Load(&cfg, env(map[string]string{"DEBUG": "maybe", "DB_PORT": "0"}))
+	var errs Errors
+	if !errors.As(err, &errs) || len(errs) != 1 {
+		t.Fatalf("expected parse errors, got %v", err)
+	}
+	if msg := errs[0].Error(); msg != `config Debug (env DEBUG): strconv.ParseBool: parsing "maybe": invalid syntax` {
+		t.Errorf("unexpected message: %s", msg)
+	}
+
+	err = Load(&cfg, env(map[string]string{"DB_PORT": "0"}))
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("expected validation errors, got %v", err)
+	}
+	if !errors.Is(errs[0], ErrRequired) {
+		t.Errorf("expected %v, got %v", ErrRequired, errs[0])
+	}
+	if msg := errs[1].Error(); msg != "config Database.Port (env DB_PORT): must satisfy min=1" {
+		t.Errorf("unexpected message: %s", msg)
+	}
+
+	if err := Load(&cfg, Files(filepath.Join(t.TempDir(), "missing.yaml"))); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a missing file error, got %v", err)
+	}
+	if err := Load(&cfg, Files(writeFile(t, "config.toml", ""))); !errors.Is(err, ErrUnsupportedFile) {
+		t.Errorf("expected %v, got %v", ErrUnsupportedFile, err)
+	}
+}
+
+type retryConfig struct {
+	Backoff time.Duration `json:"backoff"`
+}
+
+type durationConfig struct {
+	retryConfig
+	Timeout  time.Duration            `json:"timeout"`
+	Grace    *time.Duration           `json:"grace_period"`
+	Nested   retryConfig              `json:"nested"`
+	Stages   []retryConfig            `json:"stages"`
+	Limits   map[string]time.Duration `json:"limits"`
+	Interval time.Duration            `json:"interval"`
+}
+
+func TestLoadDurations(t *testing.T) {
+	yamlFile := writeFile(t, "config.yaml", `
+backoff: 100ms
+Timeout: 5s
+grace_period: 1m
+nested:
+  backoff: 2s
+stages:
+  - backoff: 1h
+limits:
+  read: 250ms
+interval: 1000
+`)
+	var cfg durationConfig
+	if err := Load(&cfg, Files(yamlFile)); err != nil {
+		t.Fatal(err)
+	}
+	grace := time.Minute
+	expected := durationConfig{
+		retryConfig: retryConfig{Backoff: 100 * time.Millisecond},
+		Timeout:     5 * time.Second,
+		Grace:       &grace,
+		Nested:      retryConfig{Backoff: 2 * time.Second},
+		Stages:      []retryConfig{{Backoff: time.Hour}},
+		Limits:      map[string]time.Duration{"read": 250 * time.Millisecond},
+		Interval:    1000,
+	}
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("expected %+v, got %+v", expected, cfg)
+	}
+
+	var fe *FieldError
+	err := Load(&cfg, Files(writeFile(t, "bad.json", `{"nested": {"backoff": "soon"}}`)))
+	if !errors.As(err, &fe) || fe.Field != "Nested.Backoff" {
+		t.Errorf("expected a field error for Nested.Backoff, got %v", err)
+	}
+}
+
+type checkedConfig struct {
+	Min int `env:"MIN"`
+	Max int `env:"MAX"`
+}
+
+var errRange = errors.New("min must not exceed max")
+
+func (c *checkedConfig) Validate() error {
+	if c.Min > c.Max {
+		return errRange
+	}
+	return nil
+}
+
+func TestLoadValidator(t *testing.T) {
+	var cfg checkedConfig
+	if err := Load(&cfg, env(map[string]string{"MIN": "2", "MAX": "1"})); err != errRange {
+		t.Errorf("expected %v, got %v", errRange, err)
+	}
+}
@@ -0,0 +1,135 @@
+package correlation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	stdhttp "net/http"
+
+	"github.com/go-kit/kit/transport/grpc"
+	"github.com/go-kit/kit/transport/http"
+	"github.com/jdotw/go-utils/identity"
+	"github.com/opentracing/opentracing-go"
+	"google.golang.org/grpc/metadata"
+)
+
+// Request/correlation ID convention shared by the log and
+// tracing packages. The ID is taken from the X-Request-ID
+// header, or generated if absent, stored in the context,
+// tagged on the active span, and echoed on responses.
+
+const (
+	// RequestIDContextKey holds the key used to store the request ID in
+	// the context. It is the identity package's key.
+	RequestIDContextKey = identity.RequestIDContextKey
+
+	// HeaderName is the HTTP header carrying the request ID.
+	HeaderName = "X-Request-ID"
+
+	// SpanTag and LogField are the names used for the request ID
+	// on spans and log entries.
+	SpanTag  = "request_id"
+	LogField = "request_id"
+
+	// grpc metadata keys must be lower case.
+	metadataKey = "x-request-id"
+)
+
+// NewID returns a random 128 bit request ID, hex encoded.
+func NewID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithRequestID returns a copy of ctx carrying id, and tags the
+// span in ctx (if any) with it.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		span.SetTag(SpanTag, id)
+	}
+	return identity.WithRequestID(ctx, id)
+}
+
+// FromContext returns the request ID stored in ctx, or an empty string.
+func FromContext(ctx context.Context) string {
+	return identity.RequestID(ctx)
+}
+
+func idFromHeader(h stdhttp.Header) string {
+	if id := h.Get(HeaderName); id != "" && len(id) <= 128 {
+		return id
+	}
+	return NewID()
+}
+
+// Middleware extracts or generates the request ID for each request,
+// stores it in the request context and echoes it on the response.
+func Middleware(next stdhttp.Handler) stdhttp.Handler {
+	return stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		id := FromContext(r.Context())
+		if id == "" {
+			id = idFromHeader(r.Header)
+			r = r.WithContext(WithRequestID(r.Context(), id))
+		}
+		w.Header().Set(HeaderName, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// HTTPToContext moves the request ID from request header to context,
+// generating one if absent. Particularly useful for servers.
+func HTTPToContext() http.RequestFunc {
+	return func(ctx context.Context, r *stdhttp.Request) context.Context {
+		if FromContext(ctx) != "" {
+			return ctx
+		}
+		return WithRequestID(ctx, idFromHeader(r.Header))
+	}
+}
+
+// ContextToHTTP moves the request ID from context to request header.
+// Particularly useful for clients.
+func ContextToHTTP() http.RequestFunc {
+	return func(ctx context.Context, r *stdhttp.Request) context.Context {
+		if id := FromContext(ctx); id != "" {
+			r.Header.Set(HeaderName, id)
+		}
+		return ctx
+	}
+}
+
+// HTTPResponseHeader echoes the request ID in the context on the response.
+func HTTPResponseHeader() http.ServerResponseFunc {
+	return func(ctx context.Context, w stdhttp.ResponseWriter) context.Context {
+		if id := FromContext(ctx); id != "" {
+			w.Header().Set(HeaderName, id)
+		}
+		return ctx
+	}
+}
+
+// GRPCToContext moves the request ID from grpc metadata to context,
+// generating one if absent. Particularly useful for servers.
+func GRPCToContext() grpc.ServerRequestFunc {
+	return func(ctx context.Context, md metadata.MD) context.Context {
+		if FromContext(ctx) != "" {
+			return ctx
+		}
+		if ids := md.Get(metadataKey); len(ids) > 0 && ids[0] != "" {
+			return WithRequestID(ctx, ids[0])
+		}
+		return WithRequestID(ctx, NewID())
+	}
+}
+
+// ContextToGRPC moves the request ID from context to grpc metadata.
+// Particularly useful for clients.
+func ContextToGRPC() grpc.ClientRequestFunc {
+	return func(ctx context.Context, md *metadata.MD) context.Context {
+		if id := FromContext(ctx); id != "" {
+			(*md)[metadataKey] = []string{id}
+		}
+		return ctx
+	}
+}
@@ -0,0 +1,58 @@
+package correlation
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+)
+
+func TestHTTPToContext(t *testing.T) {
+	reqFunc := HTTPToContext()
+
+	// When the header doesn't exist an ID is generated
+	ctx := reqFunc(context.Background(), &http.Request{Header: http.Header{}})
+	if FromContext(ctx) == "" {
+		t.Error("Context should contain a generated request ID")
+	}
+
+	// When the header exists it is used
+	header := http.Header{}
+	header.Set(HeaderName, "abc123")
+	ctx = reqFunc(context.Background(), &http.Request{Header: header})
+	if want, have := "abc123", FromContext(ctx); want != have {
+		t.Errorf("Context doesn't contain the expected request ID; expected: %s, got: %s", want, have)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var seen string
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = FromContext(r.Context())
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(HeaderName, "abc123")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if seen != "abc123" {
+		t.Errorf("Handler did not see the request ID; got %s", seen)
+	}
+	if want, have := "abc123", w.Header().Get(HeaderName); want != have {
+		t.Errorf("Response header does not echo the request ID; expected %s, got %s", want, have)
+	}
+}
+
+func TestGRPCRoundTrip(t *testing.T) {
+	md := metadata.MD{}
+	ctx := WithRequestID(context.Background(), "abc123")
+	ContextToGRPC()(ctx, &md)
+
+	ctx = GRPCToContext()(context.Background(), md)
+	if want, have := "abc123", FromContext(ctx); want != have {
+		t.Errorf("Request ID did not survive grpc metadata; expected %s, got %s", want, have)
+	}
+}
@@ -0,0 +1,249 @@
+// Package crypt implements envelope encryption. Each message is
+// encrypted with a fresh AES-256-GCM data key, and the data key is
+// wrapped by a key encryption key held by a KeyWrapper: AWS KMS, a
+// HashiCorp Vault transit engine, or local keys. Only the wrapped data
+// key is stored, alongside the ciphertext, so the key encryption key
+// never leaves the KMS and rotating it doesn't require re-encrypting
+// data.
+//
+//	env := crypt.New(crypt.NewKMSWrapper(kms.NewFromConfig(awsCfg), "alias/orders"))
+//	ciphertext, err := env.Encrypt(ctx, plaintext, []byte(order.ID))
+//	plaintext, err := env.Decrypt(ctx, ciphertext, []byte(order.ID))
+//
+// Encrypted model columns and stored webhook secrets use long-lived data
+// keys instead: generate them once with GenerateDataKey, store the
+// wrapped keys in configuration, and unwrap them at startup with Keys:
+//
+//	keys, err := env.Keys(ctx, "2024-01", map[string][]byte{"2024-01": wrapped})
+//	model.SetEncryptionKeys(keys)
+package crypt
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/jdotw/go-utils/model"
+)
+
+var (
+	// ErrMalformed is returned when decrypting data that was not produced
+	// by this package.
+	ErrMalformed = errors.New("crypt: malformed ciphertext")
+
+	// ErrDecrypt is returned when ciphertext fails authentication: it was
+	// modified, truncated, or given the wrong additional data.
+	ErrDecrypt = errors.New("crypt: message authentication failed")
+)
+
+// DataKeySize is the size of data keys, selecting AES-256.
+const DataKeySize = 32
+
+// Formats, the first byte of everything this package produces.
+const (
+	formatDataKey byte = 1
+	formatMessage byte = 2
+	formatStream  byte = 3
+)
+
+// KeyWrapper encrypts data keys with a key encryption key.
+type KeyWrapper interface {
+	// Wrap encrypts key with the current key encryption key, returning
+	// the ID of the key used, including its version where the KMS
+	// exposes one.
+	Wrap(ctx context.Context, key []byte) (keyID string, wrapped []byte, err error)
+	// Unwrap decrypts a key wrapped by the key encryption key keyID.
+	Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// Envelope encrypts data with data keys wrapped by a KeyWrapper.
+type Envelope struct {
+	wrapper KeyWrapper
+}
+
+// New returns an Envelope wrapping data keys with wrapper.
+func New(wrapper KeyWrapper) *Envelope {
+	return &Envelope{wrapper: wrapper}
+}
+
+// GenerateDataKey returns a new data key, and the key wrapped for
+// storage. Pass the wrapped key to UnwrapDataKey or Keys to recover it.
+func (e *Envelope) GenerateDataKey(ctx context.Context) (key, wrapped []byte, err error) {
+	return e.newDataKey(ctx, formatDataKey)
+}
+
+// UnwrapDataKey returns the data key of a wrapped key from
+// GenerateDataKey or Rewrap.
+func (e *Envelope) UnwrapDataKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	key, rest, err := e.openHeader(ctx, formatDataKey, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, ErrMalformed
+	}
+	return key, nil
+}
+
+// Rewrap wraps the data key of wrapped with the wrapper's current key
+// encryption key, so data keys can be moved off a retired key without
+// re-encrypting the data they protect.
+func (e *Envelope) Rewrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	key, err := e.UnwrapDataKey(ctx, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	keyID, rewrapped, err := e.wrapper.Wrap(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return appendHeader(nil, formatDataKey, keyID, rewrapped), nil
+}
+
+// Encrypt encrypts plaintext with a new data key. The additional data,
+// which may be nil, is authenticated but not stored; Decrypt must be
+// given the same additional data, binding the ciphertext to, say, the
+// ID of the record holding it.
+func (e *Envelope) Encrypt(ctx context.Context, plaintext, additionalData []byte) ([]byte, error) {
+	key, header, err := e.newDataKey(ctx, formatMessage)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append(header, nonce...)
+	return gcm.Seal(out, nonce, plaintext, messageAAD(header, additionalData)), nil
+}
+
+// Decrypt decrypts ciphertext from Encrypt.
+func (e *Envelope) Decrypt(ctx context.Context, ciphertext, additionalData []byte) ([]byte, error) {
+	key, rest, err := e.openHeader(ctx, formatMessage, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	header := ciphertext[:len(ciphertext)-len(rest)]
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, ErrMalformed
+	}
+	plaintext, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], messageAAD(header, additionalData))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// newDataKey generates a data key and returns it with its header.
+func (e *Envelope) newDataKey(ctx context.Context, format byte) (key, header []byte, err error) {
+	key = make([]byte, DataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, err
+	}
+	keyID, wrapped, err := e.wrapper.Wrap(ctx, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("crypt: wrap data key: %w", err)
+	}
+	return key, appendHeader(nil, format, keyID, wrapped), nil
+}
+
+// openHeader parses a header of format from b, unwraps its data key and
+// returns it with the rest of b.
+func (e *Envelope) openHeader(ctx context.Context, format byte, b []byte) (key, rest []byte, err error) {
+	keyID, wrapped, rest, err := parseHeader(format, b)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err = e.wrapper.Unwrap(ctx, keyID, wrapped)
+	if err != nil {
+		return nil, nil, fmt.Errorf("crypt: unwrap data key: %w", err)
+	}
+	return key, rest, nil
+}
+
+// appendHeader appends the format, key ID and wrapped data key, each
+// variable length field prefixed with its length.
+func appendHeader(b []byte, format byte, keyID string, wrapped []byte) []byte {
+	b = append(b, format)
+	b = appendUvarint(b, uint64(len(keyID)))
+	b = append(b, keyID...)
+	b = appendUvarint(b, uint64(len(wrapped)))
+	return append(b, wrapped...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func parseHeader(format byte, b []byte) (keyID string, wrapped, rest []byte, err error) {
+	if len(b) == 0 || b[0] != format {
+		return "", nil, nil, ErrMalformed
+	}
+	b = b[1:]
+	id, b, ok := readField(b)
+	if !ok {
+		return "", nil, nil, ErrMalformed
+	}
+	wrapped, b, ok = readField(b)
+	if !ok {
+		return "", nil, nil, ErrMalformed
+	}
+	return string(id), wrapped, b, nil
+}
+
+func readField(b []byte) (field, rest []byte, ok bool) {
+	n, size := binary.Uvarint(b)
+	if size <= 0 || n > uint64(len(b)-size) {
+		return nil, nil, false
+	}
+	b = b[size:]
+	return b[:n], b[n:], true
+}
+
+// messageAAD authenticates the header along with the caller's data, so
+// the wrapped key can't be swapped.
+func messageAAD(header, additionalData []byte) []byte {
+	aad := appendUvarint(nil, uint64(len(header)))
+	aad = append(aad, header...)
+	return append(aad, additionalData...)
+}
+
+// Keys unwraps data keys from GenerateDataKey, by key ID, as
+// model.EncryptionKeys encrypting with the key named current. Use it to
+// back EncryptedString columns, such as stored webhook secrets, with
+// keys protected by the KMS.
+func (e *Envelope) Keys(ctx context.Context, current string, wrapped map[string][]byte) (model.EncryptionKeys, error) {
+	if _, ok := wrapped[current]; !ok {
+		return nil, fmt.Errorf("crypt: no wrapped key %q", current)
+	}
+	keys := make(map[string][]byte, len(wrapped))
+	for id, w := range wrapped {
+		key, err := e.UnwrapDataKey(ctx, w)
+		if err != nil {
+			return nil, fmt.Errorf("crypt: key %q: %w", id, err)
+		}
+		keys[id] = key
+	}
+	return model.NewStaticKeys(current, keys), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
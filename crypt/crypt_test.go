@@ -0,0 +1,252 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/jdotw/go-utils/model"
+)
+
+func testKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestEnvelope(t *testing.T) {
+	ctx := context.Background()
+	env := New(NewLocalWrapper(model.NewStaticKeys("k1", map[string][]byte{"k1": testKey(t)})))
+
+	ciphertext, err := env.Encrypt(ctx, []byte("card 4242"), []byte("order-1"))
+	if err != nil {
+		t.Fatalf("Encrypt returned error: %s", err)
+	}
+	if bytes.Contains(ciphertext, []byte("4242")) {
+		t.Errorf("ciphertext contains the plaintext")
+	}
+	plaintext, err := env.Decrypt(ctx, ciphertext, []byte("order-1"))
+	if err != nil || string(plaintext) != "card 4242" {
+		t.Errorf("expected the plaintext, got %q, %v", plaintext, err)
+	}
+
+	if _, err := env.Decrypt(ctx, ciphertext, []byte("order-2")); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("expected ErrDecrypt for other additional data, got %v", err)
+	}
+	tampered := append([]byte(nil), ciphertext...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := env.Decrypt(ctx, tampered, []byte("order-1")); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("expected ErrDecrypt for a modified ciphertext, got %v", err)
+	}
+	if _, err := env.Decrypt(ctx, []byte("plain"), nil); !errors.Is(err, ErrMalformed) {
+		t.Errorf("expected ErrMalformed, got %v", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	old := testKey(t)
+	env := New(NewLocalWrapper(model.NewStaticKeys("k1", map[string][]byte{"k1": old})))
+	dataKey, wrapped, err := env.GenerateDataKey(ctx)
+	if err != nil {
+		t.Fatalf("GenerateDataKey returned error: %s", err)
+	}
+	ciphertext, err := env.Encrypt(ctx, []byte("secret"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// After rotating, old data stays readable and data keys can be rewrapped
+	rotated := New(NewLocalWrapper(model.NewStaticKeys("k2", map[string][]byte{"k1": old, "k2": testKey(t)})))
+	if plaintext, err := rotated.Decrypt(ctx, ciphertext, nil); err != nil || string(plaintext) != "secret" {
+		t.Errorf("expected old data to decrypt, got %q, %v", plaintext, err)
+	}
+	rewrapped, err := rotated.Rewrap(ctx, wrapped)
+	if err != nil {
+		t.Fatalf("Rewrap returned error: %s", err)
+	}
+	keyID, _, _, _ := parseHeader(formatDataKey, rewrapped)
+	if keyID != "k2" {
+		t.Errorf("expected the key to be rewrapped with k2, got %q", keyID)
+	}
+	key, err := rotated.UnwrapDataKey(ctx, rewrapped)
+	if err != nil || !bytes.Equal(key, dataKey) {
+		t.Errorf("expected the same data key, got %v", err)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	ctx := context.Background()
+	env := New(NewLocalWrapper(model.NewStaticKeys("k1", map[string][]byte{"k1": testKey(t)})))
+	_, wrapped, err := env.GenerateDataKey(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := env.Keys(ctx, "2024-01", map[string][]byte{"2024-01": wrapped})
+	if err != nil {
+		t.Fatalf("Keys returned error: %s", err)
+	}
+	model.SetEncryptionKeys(keys)
+	defer model.SetEncryptionKeys(nil)
+
+	stored, err := model.EncryptedString("whsec_123").Value()
+	if err != nil {
+		t.Fatalf("Value returned error: %s", err)
+	}
+	var secret model.EncryptedString
+	if err := secret.Scan(stored); err != nil || secret != "whsec_123" {
+		t.Errorf("expected the webhook secret, got %q, %v", secret, err)
+	}
+
+	if _, err := env.Keys(ctx, "missing", map[string][]byte{"2024-01": wrapped}); err == nil {
+		t.Errorf("expected an error for a missing current key")
+	}
+}
+
+func TestStream(t *testing.T) {
+	ctx := context.Background()
+	env := New(NewLocalWrapper(model.NewStaticKeys("k1", map[string][]byte{"k1": testKey(t)})))
+
+	for _, size := range []int{0, 1, SegmentSize - 1, SegmentSize, SegmentSize + 1, 3*SegmentSize + 17} {
+		plaintext := make([]byte, size)
+		rand.Read(plaintext)
+
+		var buf bytes.Buffer
+		w, err := env.EncryptWriter(ctx, &buf)
+		if err != nil {
+			t.Fatalf("EncryptWriter returned error: %s", err)
+		}
+		// Write in uneven pieces
+		for p := plaintext; len(p) > 0; {
+			n := 1000
+			if n > len(p) {
+				n = len(p)
+			}
+			w.Write(p[:n])
+			p = p[n:]
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close returned error: %s", err)
+		}
+		ciphertext := buf.Bytes()
+
+		r, err := env.DecryptReader(ctx, bytes.NewReader(ciphertext))
+		if err != nil {
+			t.Fatalf("%d: DecryptReader returned error: %s", size, err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(got, plaintext) {
+			t.Errorf("%d: expected the plaintext back, got %d bytes, %v", size, len(got), err)
+		}
+
+		if size > SegmentSize {
+			// Dropping the last segment is detected
+			truncated := ciphertext[:len(ciphertext)-(size%SegmentSize)-16]
+			r, err := env.DecryptReader(ctx, bytes.NewReader(truncated))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.ReadAll(r); !errors.Is(err, ErrDecrypt) {
+				t.Errorf("%d: expected ErrDecrypt for a truncated stream, got %v", size, err)
+			}
+		}
+	}
+}
+
+func TestVaultWrapper(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/v1/transit/encrypt/orders":
+			// Reverse the base64 plaintext as a stand-in for encryption
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{
+				"ciphertext": "vault:v3:" + reverse(body["plaintext"]),
+			}})
+		case "/v1/transit/decrypt/orders":
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{
+				"plaintext": reverse(strings.TrimPrefix(body["ciphertext"], "vault:v3:")),
+			}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	wrapper := NewVaultWrapper(srv.Client(), srv.URL+"/", "token", "/transit/", "orders")
+	keyID, wrapped, err := wrapper.Wrap(ctx, []byte("data key"))
+	if err != nil {
+		t.Fatalf("Wrap returned error: %s", err)
+	}
+	if keyID != "orders:v3" || !strings.HasPrefix(string(wrapped), "vault:v3:") {
+		t.Errorf("unexpected key ID %q and wrapped key %q", keyID, wrapped)
+	}
+	key, err := wrapper.Unwrap(ctx, keyID, wrapped)
+	if err != nil || string(key) != "data key" {
+		t.Errorf("expected the data key, got %q, %v", key, err)
+	}
+
+	if _, _, err := NewVaultWrapper(srv.Client(), srv.URL, "wrong", "transit", "orders").Wrap(ctx, []byte("k")); err == nil {
+		t.Errorf("expected an error for a rejected token")
+	}
+}
+
+func reverse(s string) string {
+	b := []byte(s)
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return string(b)
+}
+
+type fakeKMS struct {
+	decryptKeyID string
+}
+
+func (f *fakeKMS) Encrypt(_ context.Context, in *kms.EncryptInput, _ ...func(*kms.Options)) (*kms.EncryptOutput, error) {
+	return &kms.EncryptOutput{
+		KeyId:          aws.String("arn:aws:kms:us-east-1:123:key/abc"),
+		CiphertextBlob: []byte(base64.StdEncoding.EncodeToString(in.Plaintext)),
+	}, nil
+}
+
+func (f *fakeKMS) Decrypt(_ context.Context, in *kms.DecryptInput, _ ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	f.decryptKeyID = aws.ToString(in.KeyId)
+	plaintext, err := base64.StdEncoding.DecodeString(string(in.CiphertextBlob))
+	return &kms.DecryptOutput{Plaintext: plaintext}, err
+}
+
+func TestKMSWrapper(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeKMS{}
+	env := New(NewKMSWrapper(client, "alias/orders"))
+	ciphertext, err := env.Encrypt(ctx, []byte("hello"), nil)
+	if err != nil {
+		t.Fatalf("Encrypt returned error: %s", err)
+	}
+	plaintext, err := env.Decrypt(ctx, ciphertext, nil)
+	if err != nil || string(plaintext) != "hello" {
+		t.Errorf("expected hello, got %q, %v", plaintext, err)
+	}
+	if client.decryptKeyID != "arn:aws:kms:us-east-1:123:key/abc" {
+		t.Errorf("expected Decrypt to be given the key ARN, got %q", client.decryptKeyID)
+	}
+}
@@ -0,0 +1,230 @@
+package crypt
+
+import (
+	"bufio"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Streams are encrypted in segments of SegmentSize bytes, each sealed
+// with its own nonce: a random prefix, the segment's index and a flag
+// marking the last segment. Segments can't be reordered, and a stream
+// cut short at a segment boundary fails to decrypt rather than being
+// silently truncated.
+
+// SegmentSize is the plaintext size of each segment of a stream.
+const SegmentSize = 64 * 1024
+
+const noncePrefixSize = 7
+
+// EncryptWriter returns a writer encrypting what is written to it to w
+// with a new data key. Close must be called to write the final segment;
+// it does not close w. Decrypt the stream with DecryptReader.
+func (e *Envelope) EncryptWriter(ctx context.Context, w io.Writer) (io.WriteCloser, error) {
+	key, header, err := e.newDataKey(ctx, formatStream)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, noncePrefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(append(header, prefix...)); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{
+		w:      w,
+		stream: newStream(gcm, header, prefix),
+		buf:    make([]byte, 0, SegmentSize),
+	}, nil
+}
+
+// DecryptReader returns a reader decrypting a stream from EncryptWriter
+// read from r. Reads return ErrDecrypt if the stream was modified or
+// truncated.
+func (e *Envelope) DecryptReader(ctx context.Context, r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	header, err := readStreamHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	key, _, err := e.openHeader(ctx, formatStream, header)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, noncePrefixSize)
+	if _, err := io.ReadFull(br, prefix); err != nil {
+		return nil, ErrMalformed
+	}
+	return &decryptReader{
+		r:      br,
+		stream: newStream(gcm, header, prefix),
+		seg:    make([]byte, SegmentSize+gcm.Overhead()),
+	}, nil
+}
+
+// readStreamHeader reads the format byte and the two length prefixed
+// header fields.
+func readStreamHeader(r *bufio.Reader) ([]byte, error) {
+	format, err := r.ReadByte()
+	if err != nil || format != formatStream {
+		return nil, ErrMalformed
+	}
+	header := []byte{format}
+	for i := 0; i < 2; i++ {
+		n, err := binary.ReadUvarint(r)
+		if err != nil || n > 64*1024 {
+			return nil, ErrMalformed
+		}
+		header = appendUvarint(header, n)
+		field := make([]byte, n)
+		if _, err := io.ReadFull(r, field); err != nil {
+			return nil, ErrMalformed
+		}
+		header = append(header, field...)
+	}
+	return header, nil
+}
+
+type stream struct {
+	aead   cipher.AEAD
+	aad    []byte
+	nonce  []byte
+	closed bool
+	index  uint32
+}
+
+func newStream(aead cipher.AEAD, header, prefix []byte) *stream {
+	nonce := make([]byte, aead.NonceSize())
+	copy(nonce, prefix)
+	return &stream{aead: aead, aad: messageAAD(header, nil), nonce: nonce}
+}
+
+// next returns the nonce for the next segment.
+func (s *stream) next(last bool) []byte {
+	binary.BigEndian.PutUint32(s.nonce[noncePrefixSize:], s.index)
+	s.nonce[len(s.nonce)-1] = 0
+	if last {
+		s.nonce[len(s.nonce)-1] = 1
+	}
+	s.index++
+	return s.nonce
+}
+
+type encryptWriter struct {
+	w      io.Writer
+	stream *stream
+	buf    []byte
+	out    []byte
+	err    error
+}
+
+func (w *encryptWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n := len(p)
+	for len(p) > 0 {
+		// A full segment is only sealed once more data arrives, as the
+		// last segment must be sealed as such on Close.
+		if len(w.buf) == SegmentSize {
+			if w.err = w.seal(false); w.err != nil {
+				return 0, w.err
+			}
+		}
+		c := copy(w.buf[len(w.buf):SegmentSize], p)
+		w.buf = w.buf[:len(w.buf)+c]
+		p = p[c:]
+	}
+	return n, nil
+}
+
+func (w *encryptWriter) Close() error {
+	if w.err != nil {
+		if errors.Is(w.err, errClosed) {
+			return nil
+		}
+		return w.err
+	}
+	if err := w.seal(true); err != nil {
+		w.err = err
+		return err
+	}
+	w.err = errClosed
+	return nil
+}
+
+var errClosed = errors.New("crypt: write to closed stream")
+
+func (w *encryptWriter) seal(last bool) error {
+	if w.stream.index == ^uint32(0) {
+		return errors.New("crypt: stream too long")
+	}
+	w.out = w.stream.aead.Seal(w.out[:0], w.stream.next(last), w.buf, w.stream.aad)
+	w.buf = w.buf[:0]
+	_, err := w.w.Write(w.out)
+	return err
+}
+
+type decryptReader struct {
+	r      *bufio.Reader
+	stream *stream
+	seg    []byte
+	plain  []byte
+	err    error
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.open()
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+// open reads and decrypts the next segment. A segment is the last if
+// the stream ends with it.
+func (r *decryptReader) open() error {
+	if r.stream.closed {
+		return io.EOF
+	}
+	n, err := io.ReadFull(r.r, r.seg)
+	last := false
+	switch {
+	case err == io.ErrUnexpectedEOF || err == io.EOF:
+		last = true
+	case err != nil:
+		return err
+	default:
+		if _, err := r.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+	plain, err := r.stream.aead.Open(r.seg[:0], r.stream.next(last), r.seg[:n], r.stream.aad)
+	if err != nil {
+		return ErrDecrypt
+	}
+	r.plain = plain
+	if last {
+		r.stream.closed = true
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/jdotw/go-utils/model"
+)
+
+type localWrapper struct {
+	keys model.EncryptionKeys
+}
+
+// NewLocalWrapper returns a KeyWrapper wrapping data keys with AES-GCM
+// under keys, such as model.NewStaticKeys or secrets.NewEncryptionKeys.
+// The key ID is the ID of the key used, so keys can be rotated by making
+// a new one current while keeping the old ones for unwrapping.
+func NewLocalWrapper(keys model.EncryptionKeys) KeyWrapper {
+	return &localWrapper{keys: keys}
+}
+
+func (w *localWrapper) Wrap(_ context.Context, key []byte) (string, []byte, error) {
+	id, kek, err := w.keys.Current()
+	if err != nil {
+		return "", nil, err
+	}
+	gcm, err := newGCM(kek)
+	if err != nil {
+		return "", nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	return id, gcm.Seal(nonce, nonce, key, []byte(id)), nil
+}
+
+func (w *localWrapper) Unwrap(_ context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	kek, err := w.keys.Key(keyID)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+	key, err := gcm.Open(nil, wrapped[:gcm.NonceSize()], wrapped[gcm.NonceSize():], []byte(keyID))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return key, nil
+}
+
+// KMSClient is the subset of the AWS KMS client used by the KMS
+// wrapper.
+type KMSClient interface {
+	Encrypt(ctx context.Context, params *kms.EncryptInput, optFns ...func(*kms.Options)) (*kms.EncryptOutput, error)
+	Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+type kmsWrapper struct {
+	client KMSClient
+	keyID  string
+}
+
+// NewKMSWrapper returns a KeyWrapper wrapping data keys with the AWS KMS
+// key keyID, which may be a key ID, ARN or alias. The key ID recorded
+// with each wrapped key is the key's ARN, so an alias can be moved to a
+// new key while data keys wrapped by the old one stay readable. KMS
+// rotates key material itself, transparently to callers.
+func NewKMSWrapper(client KMSClient, keyID string) KeyWrapper {
+	return &kmsWrapper{client: client, keyID: keyID}
+}
+
+func (w *kmsWrapper) Wrap(ctx context.Context, key []byte) (string, []byte, error) {
+	out, err := w.client.Encrypt(ctx, &kms.EncryptInput{
+		KeyId:     aws.String(w.keyID),
+		Plaintext: key,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return aws.ToString(out.KeyId), out.CiphertextBlob, nil
+}
+
+func (w *kmsWrapper) Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	out, err := w.client.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:          aws.String(keyID),
+		CiphertextBlob: wrapped,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Plaintext, nil
+}
+
+type vaultWrapper struct {
+	client *http.Client
+	addr   string
+	token  string
+	mount  string
+	key    string
+}
+
+// NewVaultWrapper returns a KeyWrapper wrapping data keys with the
+// HashiCorp Vault transit key named key, in the transit engine mounted
+// at mount. The key ID is the key name and version, "key:v3", so
+// wrapped keys show which version of a rotated transit key they need. A
+// nil client uses http.DefaultClient.
+func NewVaultWrapper(client *http.Client, addr, token, mount, key string) KeyWrapper {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &vaultWrapper{
+		client: client,
+		addr:   strings.TrimSuffix(addr, "/"),
+		token:  token,
+		mount:  strings.Trim(mount, "/"),
+		key:    key,
+	}
+}
+
+type vaultTransitResponse struct {
+	Data struct {
+		Ciphertext string `json:"ciphertext"`
+		Plaintext  string `json:"plaintext"`
+	} `json:"data"`
+}
+
+func (w *vaultWrapper) Wrap(ctx context.Context, key []byte) (string, []byte, error) {
+	resp, err := w.post(ctx, "encrypt", w.key, map[string]string{
+		"plaintext": base64.StdEncoding.EncodeToString(key),
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	// Ciphertexts are "vault:v<version>:<base64>"
+	parts := strings.SplitN(resp.Data.Ciphertext, ":", 3)
+	if len(parts) != 3 || parts[0] != "vault" {
+		return "", nil, fmt.Errorf("vault: unexpected ciphertext format")
+	}
+	return w.key + ":" + parts[1], []byte(resp.Data.Ciphertext), nil
+}
+
+func (w *vaultWrapper) Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	name := keyID
+	if i := strings.LastIndexByte(keyID, ':'); i >= 0 {
+		name = keyID[:i]
+	}
+	resp, err := w.post(ctx, "decrypt", name, map[string]string{
+		"ciphertext": string(wrapped),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+}
+
+func (w *vaultWrapper) post(ctx context.Context, op, key string, body interface{}) (*vaultTransitResponse, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	url := w.addr + "/v1/" + w.mount + "/" + op + "/" + key
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", w.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("vault: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var vr vaultTransitResponse
+	if err := json.NewDecoder(resp.Body).Decode(&vr); err != nil {
+		return nil, fmt.Errorf("vault: %w", err)
+	}
+	return &vr, nil
+}
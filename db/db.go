@@ -0,0 +1,228 @@
+// Package db opens gorm database connections configured the same way in
+// every service: pooled, traced, logged, measured and health checked,
+// retrying the initial connection while the database starts up.
+//
+//	var cfg db.Config
+//	config.Load(&cfg)
+//	cfg.Dialect = postgres.Open
+//	conn, err := db.Open(ctx, cfg, db.Logger(logger), db.Tracer(tracer), db.Health(registry))
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jdotw/go-utils/health"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/secrets"
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// ErrNoDialect is returned by Open when Config.Dialect is not set.
+var ErrNoDialect = errors.New("db: no dialect configured")
+
+// Config configures a connection. Its tags allow loading it with the
+// config package.
+type Config struct {
+	// Name labels the connection's metrics and health check.
+	Name string `json:"name" env:"DB_NAME" default:"default"`
+	// DSN is the data source name passed to Dialect.
+	DSN string `json:"dsn" env:"DATABASE_URL"`
+	// Dialect opens a gorm dialector for a DSN, e.g. postgres.Open.
+	Dialect func(dsn string) gorm.Dialector `json:"-"`
+
+	MaxOpenConns    int           `json:"max_open_conns" env:"DB_MAX_OPEN_CONNS" default:"25"`
+	MaxIdleConns    int           `json:"max_idle_conns" env:"DB_MAX_IDLE_CONNS" default:"25"`
+	ConnMaxLifetime time.Duration `json:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME" default:"30m"`
+	ConnMaxIdleTime time.Duration `json:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME" default:"5m"`
+
+	// ConnectTimeout is how long Open keeps retrying the initial
+	// connection.
+	ConnectTimeout time.Duration `json:"connect_timeout" env:"DB_CONNECT_TIMEOUT" default:"1m"`
+	// SlowThreshold is the duration above which queries are logged as
+	// slow. Zero disables slow query logging.
+	SlowThreshold time.Duration `json:"slow_threshold" env:"DB_SLOW_THRESHOLD" default:"200ms"`
+}
+
+type options struct {
+	logger     log.Factory
+	tracer     opentracing.Tracer
+	registerer prometheus.Registerer
+	health     *health.Registry
+	gormConfig *gorm.Config
+	plugins    []gorm.Plugin
+	secrets    secrets.Provider
+	secretName string
+}
+
+// Option configures Open.
+type Option func(*options)
+
+// Logger logs connection attempts and, through gorm, failed and slow
+// queries.
+func Logger(logger log.Factory) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// Tracer traces every statement with TracingPlugin.
+func Tracer(tracer opentracing.Tracer) Option {
+	return func(o *options) {
+		o.tracer = tracer
+	}
+}
+
+// Metrics registers connection pool metrics. A nil registerer uses
+// prometheus.DefaultRegisterer.
+func Metrics(registerer prometheus.Registerer) Option {
+	return func(o *options) {
+		if registerer == nil {
+			registerer = prometheus.DefaultRegisterer
+		}
+		o.registerer = registerer
+	}
+}
+
+// Health registers a readiness check pinging the database.
+func Health(registry *health.Registry) Option {
+	return func(o *options) {
+		o.health = registry
+	}
+}
+
+// GormConfig is the base gorm configuration. Open replaces its Logger
+// when a Logger option is given.
+func GormConfig(cfg *gorm.Config) Option {
+	return func(o *options) {
+		o.gormConfig = cfg
+	}
+}
+
+// Plugins are registered with db.Use after connecting, e.g. the model
+// package's TenantPlugin.
+func Plugins(plugins ...gorm.Plugin) Option {
+	return func(o *options) {
+		o.plugins = append(o.plugins, plugins...)
+	}
+}
+
+// DSNSecret reads the DSN from a secret rather than Config.DSN, so
+// credentials stay out of the environment.
+func DSNSecret(provider secrets.Provider, name string) Option {
+	return func(o *options) {
+		o.secrets = provider
+		o.secretName = name
+	}
+}
+
+// Open connects to the database described by cfg, retrying with
+// exponential backoff for up to cfg.ConnectTimeout.
+func Open(ctx context.Context, cfg Config, opts ...Option) (*gorm.DB, error) {
+	o := options{gormConfig: &gorm.Config{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if cfg.Dialect == nil {
+		return nil, ErrNoDialect
+	}
+	dsn := cfg.DSN
+	if o.secrets != nil {
+		var err error
+		if dsn, err = secrets.String(ctx, o.secrets, o.secretName); err != nil {
+			return nil, fmt.Errorf("db: read DSN: %w", err)
+		}
+	}
+	gormConfig := *o.gormConfig
+	logger := o.logger
+	if logger == nil {
+		logger = log.NewMockLogFactory()
+	} else {
+		gormConfig.Logger = NewGormLogger(logger, cfg.SlowThreshold)
+	}
+
+	db, sqlDB, err := connect(ctx, cfg, dsn, &gormConfig, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.tracer != nil {
+		if err := db.Use(&TracingPlugin{Tracer: o.tracer}); err != nil {
+			sqlDB.Close()
+			return nil, err
+		}
+	}
+	for _, p := range o.plugins {
+		if err := db.Use(p); err != nil {
+			sqlDB.Close()
+			return nil, err
+		}
+	}
+	if o.registerer != nil {
+		err := o.registerer.Register(collectors.NewDBStatsCollector(sqlDB, cfg.Name))
+		if _, ok := err.(prometheus.AlreadyRegisteredError); err != nil && !ok {
+			sqlDB.Close()
+			return nil, err
+		}
+	}
+	if o.health != nil {
+		o.health.Register("db:"+cfg.Name, health.PingCheck(sqlDB))
+	}
+	return db, nil
+}
+
+const (
+	initialBackoff = 250 * time.Millisecond
+	maxBackoff     = 10 * time.Second
+)
+
+func connect(ctx context.Context, cfg Config, dsn string, gormConfig *gorm.Config, logger log.Factory) (*gorm.DB, *sql.DB, error) {
+	deadline := time.Now().Add(cfg.ConnectTimeout)
+	backoff := initialBackoff
+	for attempt := 1; ; attempt++ {
+		db, sqlDB, err := tryConnect(ctx, cfg, dsn, gormConfig)
+		if err == nil {
+			return db, sqlDB, nil
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return nil, nil, fmt.Errorf("db: connect to %s: %w", cfg.Name, err)
+		}
+		log.Warn(logger.For(ctx), "Failed to connect to database, retrying",
+			zap.String("db", cfg.Name), zap.Int("attempt", attempt), zap.Duration("backoff", backoff), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func tryConnect(ctx context.Context, cfg Config, dsn string, gormConfig *gorm.Config) (*gorm.DB, *sql.DB, error) {
+	db, err := gorm.Open(cfg.Dialect(dsn), gormConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, nil, err
+	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	if err := sqlDB.PingContext(ctx); err != nil {
+		sqlDB.Close()
+		return nil, nil, err
+	}
+	return db, sqlDB, nil
+}
@@ -0,0 +1,208 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jdotw/go-utils/health"
+	"github.com/jdotw/go-utils/lock"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/secrets"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+)
+
+var errUnavailable = errors.New("database starting up")
+
+// flakyDriver is a database/sql driver whose pings fail a number of
+// times before succeeding.
+type flakyDriver struct {
+	mu       sync.Mutex
+	failures int
+	dsns     []string
+}
+
+func (d *flakyDriver) Open(dsn string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dsns = append(d.dsns, dsn)
+	return flakyConn{d}, nil
+}
+
+type flakyConn struct {
+	d *flakyDriver
+}
+
+func (c flakyConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("unsupported")
+}
+
+func (c flakyConn) Close() error {
+	return nil
+}
+
+func (c flakyConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("unsupported")
+}
+
+func (c flakyConn) Ping(context.Context) error {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	if c.d.failures > 0 {
+		c.d.failures--
+		return errUnavailable
+	}
+	return nil
+}
+
+var testDriver = &flakyDriver{}
+
+func init() {
+	sql.Register("db-test-flaky", testDriver)
+}
+
+// flakyDialector is the dummy dialector over the flaky driver.
+type flakyDialector struct {
+	tests.DummyDialector
+	dsn string
+}
+
+func (d flakyDialector) Initialize(db *gorm.DB) error {
+	if err := d.DummyDialector.Initialize(db); err != nil {
+		return err
+	}
+	pool, err := sql.Open("db-test-flaky", d.dsn)
+	db.ConnPool = pool
+	return err
+}
+
+func testConfig(failures int) Config {
+	testDriver.failures = failures
+	testDriver.dsns = nil
+	return Config{
+		Name:           "test",
+		DSN:            "config-dsn",
+		Dialect:        func(dsn string) gorm.Dialector { return flakyDialector{dsn: dsn} },
+		MaxOpenConns:   2,
+		ConnectTimeout: time.Second,
+	}
+}
+
+func TestOpen(t *testing.T) {
+	registry := health.NewRegistry()
+	registerer := prometheus.NewRegistry()
+
+	db, err := Open(context.Background(), testConfig(1), Logger(log.NewMockLogFactory()), Health(registry), Metrics(registerer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	if n := sqlDB.Stats().MaxOpenConnections; n != 2 {
+		t.Errorf("expected pool settings to be applied, got %d max open connections", n)
+	}
+	if _, ok := db.Config.Logger.(*gormLogger); !ok {
+		t.Errorf("expected the gorm logger to be replaced, got %T", db.Config.Logger)
+	}
+	if report := registry.Run(context.Background(), health.Readiness); report.Checks["db:test"].Status != "ok" {
+		t.Errorf("expected a passing database check, got %+v", report)
+	}
+	if families, err := registerer.Gather(); err != nil || len(families) == 0 {
+		t.Errorf("expected pool metrics, got %v, %v", families, err)
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := Open(ctx, Config{}); err != ErrNoDialect {
+		t.Errorf("expected %v, got %v", ErrNoDialect, err)
+	}
+
+	// Retries stop at the connect timeout
+	cfg := testConfig(100)
+	cfg.ConnectTimeout = 100 * time.Millisecond
+	if _, err := Open(ctx, cfg); !errors.Is(err, errUnavailable) {
+		t.Errorf("expected %v, got %v", errUnavailable, err)
+	}
+
+	// The DSN can come from a secret
+	provider := secrets.ProviderFunc(func(_ context.Context, name string) ([]byte, error) {
+		return []byte("secret-dsn"), nil
+	})
+	if _, err := Open(ctx, testConfig(0), DSNSecret(provider, "dsn")); err != nil {
+		t.Fatal(err)
+	}
+	if len(testDriver.dsns) == 0 || testDriver.dsns[0] != "secret-dsn" {
+		t.Errorf("expected the DSN from the secret, got %v", testDriver.dsns)
+	}
+}
+
+type widget struct {
+	ID   string
+	Name string
+}
+
+func TestTracingPlugin(t *testing.T) {
+	tracer := mocktracer.New()
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(&TracingPlugin{Tracer: tracer}); err != nil {
+		t.Fatal(err)
+	}
+
+	parent := tracer.StartSpan("request")
+	ctx := opentracing.ContextWithSpan(context.Background(), parent)
+	db.WithContext(ctx).Where("name = ?", "a").Find(&[]widget{})
+	parent.Finish()
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 2 || spans[0].OperationName != "gorm.query" {
+		t.Fatalf("expected a query span, got %v", spans)
+	}
+	span := spans[0]
+	if span.ParentID != parent.(*mocktracer.MockSpan).SpanContext.SpanID {
+		t.Error("the query span should be a child of the request span")
+	}
+	if span.Tag("db.table") != "widgets" || span.Tag("db.statement") != "SELECT * FROM `widgets` WHERE name = ?" {
+		t.Errorf("unexpected tags: %v", span.Tags())
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	backend := lock.NewMemoryBackend()
+	db, err := Open(context.Background(), testConfig(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A replica holding the lock makes Migrate wait
+	held, err := lock.NewMutex(backend, MigrationLock).TryLock(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	migrated := false
+	migrate := func(ctx context.Context, db *gorm.DB) error {
+		migrated = true
+		return nil
+	}
+	if err := Migrate(ctx, db, backend, migrate); !errors.Is(err, context.DeadlineExceeded) || migrated {
+		t.Errorf("expected Migrate to wait for the lock, got %v", err)
+	}
+
+	held.Unlock(context.Background())
+	if err := Migrate(context.Background(), db, backend, migrate); err != nil || !migrated {
+		t.Errorf("expected Migrate to run once the lock was free, got %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jdotw/go-utils/lock"
+	"gorm.io/gorm"
+)
+
+// MigrationLock names the lock held while migrating.
+const MigrationLock = "db:migrations"
+
+// MigrateFunc applies migrations to db.
+type MigrateFunc func(ctx context.Context, db *gorm.DB) error
+
+// AutoMigrate returns a MigrateFunc running gorm's AutoMigrate for
+// models.
+func AutoMigrate(models ...interface{}) MigrateFunc {
+	return func(ctx context.Context, db *gorm.DB) error {
+		return db.WithContext(ctx).AutoMigrate(models...)
+	}
+}
+
+// Migrate runs migrate while holding MigrationLock in backend, waiting
+// for the lock until ctx is done, so replicas starting together migrate
+// one at a time. The migration's context is cancelled if the lock is
+// lost. A nil backend migrates without locking.
+//
+//	err := db.Migrate(ctx, conn, lock.NewPostgresBackend(sqlDB), db.AutoMigrate(&Order{}, &Invoice{}))
+func Migrate(ctx context.Context, db *gorm.DB, backend lock.Backend, migrate MigrateFunc) error {
+	if backend == nil {
+		return migrate(ctx, db)
+	}
+	return lock.NewMutex(backend, MigrationLock).Do(ctx, func(ctx context.Context) error {
+		return migrate(ctx, db)
+	})
+}
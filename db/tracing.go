@@ -0,0 +1,96 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/jdotw/go-utils/tracing"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"gorm.io/gorm"
+)
+
+const spanKey = "go-utils:span"
+
+// TracingPlugin is a gorm plugin creating a span for each statement,
+// named after the operation and tagged with the table, SQL and rows
+// affected. Spans are children of the span in the statement's context,
+// so use db.WithContext(ctx).
+type TracingPlugin struct {
+	Tracer opentracing.Tracer
+}
+
+func (p *TracingPlugin) Name() string {
+	return "go-utils:tracing"
+}
+
+func (p *TracingPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	register := []func() error{
+		func() error {
+			return cb.Create().Before("gorm:create").Register("go-utils:tracing_before_create", p.before("create"))
+		},
+		func() error {
+			return cb.Create().After("gorm:create").Register("go-utils:tracing_after_create", p.after)
+		},
+		func() error {
+			return cb.Query().Before("gorm:query").Register("go-utils:tracing_before_query", p.before("query"))
+		},
+		func() error { return cb.Query().After("gorm:query").Register("go-utils:tracing_after_query", p.after) },
+		func() error {
+			return cb.Update().Before("gorm:update").Register("go-utils:tracing_before_update", p.before("update"))
+		},
+		func() error {
+			return cb.Update().After("gorm:update").Register("go-utils:tracing_after_update", p.after)
+		},
+		func() error {
+			return cb.Delete().Before("gorm:delete").Register("go-utils:tracing_before_delete", p.before("delete"))
+		},
+		func() error {
+			return cb.Delete().After("gorm:delete").Register("go-utils:tracing_after_delete", p.after)
+		},
+		func() error {
+			return cb.Row().Before("gorm:row").Register("go-utils:tracing_before_row", p.before("row"))
+		},
+		func() error { return cb.Row().After("gorm:row").Register("go-utils:tracing_after_row", p.after) },
+		func() error {
+			return cb.Raw().Before("gorm:raw").Register("go-utils:tracing_before_raw", p.before("raw"))
+		},
+		func() error { return cb.Raw().After("gorm:raw").Register("go-utils:tracing_after_raw", p.after) },
+	}
+	for _, r := range register {
+		if err := r(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *TracingPlugin) before(op string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx, span := tracing.NewChildSpanAndContext(db.Statement.Context, p.Tracer, "gorm."+op)
+		ext.DBType.Set(span, "sql")
+		ext.SpanKindRPCClient.Set(span)
+		db.Statement.Context = ctx
+		db.InstanceSet(spanKey, span)
+	}
+}
+
+func (p *TracingPlugin) after(db *gorm.DB) {
+	v, ok := db.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	span := v.(opentracing.Span)
+	defer span.Finish()
+
+	if db.Statement.Table != "" {
+		span.SetTag("db.table", db.Statement.Table)
+	}
+	ext.DBStatement.Set(span, db.Statement.SQL.String())
+	span.SetTag("db.rows_affected", db.Statement.RowsAffected)
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		ext.Error.Set(span, true)
+		span.LogFields(otlog.Error(db.Error))
+	}
+}
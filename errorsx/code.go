@@ -0,0 +1,224 @@
+package errorsx
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/jdotw/go-utils/recorderrors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Codes identify the kind of an error to clients, and decide its HTTP
+// status and gRPC code. The codes shared with recorderrors have the same
+// values.
+
+// Code identifies the kind of an error.
+type Code string
+
+const (
+	CodeInternal           Code = "internal"
+	CodeInvalidArgument    Code = "invalid_argument"
+	CodeUnauthenticated    Code = "unauthenticated"
+	CodePermissionDenied   Code = "permission_denied"
+	CodeNotFound           Code = Code(recorderrors.CodeNotFound)
+	CodeAlreadyExists      Code = Code(recorderrors.CodeAlreadyExists)
+	CodeConflict           Code = Code(recorderrors.CodeConflict)
+	CodeValidation         Code = Code(recorderrors.CodeValidation)
+	CodePreconditionFailed Code = Code(recorderrors.CodePreconditionFailed)
+	CodeRateLimited        Code = "rate_limited"
+	CodeUnavailable        Code = Code(recorderrors.CodeUnavailable)
+	CodeTimeout            Code = "timeout"
+	CodeCanceled           Code = "canceled"
+	CodeUnimplemented      Code = "unimplemented"
+)
+
+var codeStatuses = map[Code]struct {
+	http int
+	grpc codes.Code
+}{
+	CodeInternal:           {http.StatusInternalServerError, codes.Internal},
+	CodeInvalidArgument:    {http.StatusBadRequest, codes.InvalidArgument},
+	CodeUnauthenticated:    {http.StatusUnauthorized, codes.Unauthenticated},
+	CodePermissionDenied:   {http.StatusForbidden, codes.PermissionDenied},
+	CodeNotFound:           {http.StatusNotFound, codes.NotFound},
+	CodeAlreadyExists:      {http.StatusConflict, codes.AlreadyExists},
+	CodeConflict:           {http.StatusConflict, codes.Aborted},
+	CodeValidation:         {http.StatusBadRequest, codes.InvalidArgument},
+	CodePreconditionFailed: {http.StatusPreconditionFailed, codes.FailedPrecondition},
+	CodeRateLimited:        {http.StatusTooManyRequests, codes.ResourceExhausted},
+	CodeUnavailable:        {http.StatusServiceUnavailable, codes.Unavailable},
+	CodeTimeout:            {http.StatusGatewayTimeout, codes.DeadlineExceeded},
+	CodeCanceled:           {499, codes.Canceled},
+	CodeUnimplemented:      {http.StatusNotImplemented, codes.Unimplemented},
+}
+
+// coded is an error with a code and a message that is safe to show to
+// clients.
+type coded struct {
+	withStack
+	code    Code
+	message string
+}
+
+func (e *coded) Unwrap() error {
+	return e.cause
+}
+
+// Code returns the error's code.
+func (e *coded) Code() Code {
+	return e.code
+}
+
+// StatusCode implements go-kit's StatusCoder, so the transport encoders
+// respond with the code's status.
+func (e *coded) StatusCode() int {
+	return HTTPStatusForCode(e.code)
+}
+
+// NewCode returns an error with code whose message is shown to clients.
+// Declare package-level errors with Sentinel instead.
+func NewCode(code Code, message string) error {
+	return &coded{withStack: withStack{msg: message, stack: callers(1)}, code: code, message: message}
+}
+
+// Sentinel returns an error with code whose message is shown to clients,
+// for declaring package-level errors. Unlike NewCode it captures no
+// stack, as that of package initialization says nothing about where the
+// error was returned; Wrap or WithStack it there instead.
+//
+//	var ErrNoStock = errorsx.Sentinel(errorsx.CodeConflict, "out of stock")
+func Sentinel(code Code, message string) error {
+	return &coded{withStack: withStack{msg: message}, code: code, message: message}
+}
+
+// WithCode wraps err with code and a message that is shown to clients in
+// place of err's, which is only logged. If err is nil, WithCode returns
+// nil.
+func WithCode(err error, code Code, message string) error {
+	if err == nil {
+		return nil
+	}
+	return &coded{withStack: withStack{msg: message, cause: err, stack: callers(1)}, code: code, message: message}
+}
+
+// Internal hides err from clients behind a generic internal error. If err
+// is nil, Internal returns nil.
+func Internal(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &coded{withStack: withStack{msg: "internal error", cause: err, stack: callers(1)}, code: CodeInternal, message: "internal error"}
+}
+
+// CodeOf returns the code of err: the code it was given by NewCode or
+// WithCode, the code of a recorderrors error, or one derived from its
+// status code or context error. Other errors are CodeInternal.
+func CodeOf(err error) Code {
+	if err == nil {
+		return ""
+	}
+	var c *coded
+	if errors.As(err, &c) {
+		return c.code
+	}
+	if code := recorderrors.CodeOf(err); code != "" {
+		return Code(code)
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return CodeTimeout
+	case errors.Is(err, context.Canceled):
+		return CodeCanceled
+	}
+	var sc interface{ StatusCode() int }
+	if errors.As(err, &sc) {
+		return CodeForHTTPStatus(sc.StatusCode())
+	}
+	return CodeInternal
+}
+
+// CodeForHTTPStatus returns the code for an HTTP status, for errors whose
+// status is known but which carry no code of their own.
+func CodeForHTTPStatus(status int) Code {
+	// Prefer the codes that map back to the same status
+	for _, code := range []Code{CodeInvalidArgument, CodeUnauthenticated, CodePermissionDenied, CodeNotFound,
+		CodeConflict, CodePreconditionFailed, CodeRateLimited, CodeUnavailable, CodeTimeout, CodeUnimplemented} {
+		if codeStatuses[code].http == status {
+			return code
+		}
+	}
+	if status >= 400 && status < 500 {
+		return CodeInvalidArgument
+	}
+	return CodeInternal
+}
+
+// Message returns the message of err that is safe to show to clients:
+// the message given to NewCode, WithCode or Internal when err has one,
+// that of a recorderrors error, or err's own message when its status
+// code marks it a client error. Other errors may carry internal detail,
+// such as a database driver's, so they are described by their code's
+// generic message; log err itself for the detail.
+func Message(err error) string {
+	var c *coded
+	if errors.As(err, &c) {
+		return c.message
+	}
+	var re *recorderrors.Error
+	if errors.As(err, &re) {
+		return re.Error()
+	}
+	if code := recorderrors.CodeOf(err); code != "" {
+		return (&recorderrors.Error{Code: code}).Error()
+	}
+	var sc interface{ StatusCode() int }
+	if errors.As(err, &sc) && sc.StatusCode() >= 400 && sc.StatusCode() < 500 {
+		return err.Error()
+	}
+	return codeMessage(CodeOf(err))
+}
+
+// codeMessage is the generic message describing errors with code.
+func codeMessage(code Code) string {
+	if code == CodeInternal {
+		return "internal error"
+	}
+	if msg := http.StatusText(HTTPStatusForCode(code)); msg != "" {
+		return msg
+	}
+	return strings.ReplaceAll(string(code), "_", " ")
+}
+
+// HTTPStatusForCode returns the HTTP status for code.
+func HTTPStatusForCode(code Code) int {
+	if s, ok := codeStatuses[code]; ok {
+		return s.http
+	}
+	return http.StatusInternalServerError
+}
+
+// HTTPStatus returns the HTTP status for err. Errors with a status code
+// keep it; other errors get the status of their code.
+func HTTPStatus(err error) int {
+	var sc interface{ StatusCode() int }
+	if errors.As(err, &sc) {
+		return sc.StatusCode()
+	}
+	return HTTPStatusForCode(CodeOf(err))
+}
+
+// GRPCStatus returns the gRPC status for err, with its code and the
+// message safe to show to clients.
+func GRPCStatus(err error) *status.Status {
+	if err == nil {
+		return status.New(codes.OK, "")
+	}
+	code := codes.Internal
+	if s, ok := codeStatuses[CodeOf(err)]; ok {
+		code = s.grpc
+	}
+	return status.New(code, Message(err))
+}
@@ -0,0 +1,111 @@
+package errorsx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jdotw/go-utils/recorderrors"
+	"google.golang.org/grpc/codes"
+)
+
+type teapotError struct{}
+
+func (teapotError) Error() string   { return "teapot" }
+func (teapotError) StatusCode() int { return http.StatusTeapot }
+
+func TestWithCode(t *testing.T) {
+	cause := errors.New("pq: duplicate key value violates unique constraint \"users_email_key\"")
+	err := fmt.Errorf("creating user: %w", WithCode(cause, CodeAlreadyExists, "a user with that email already exists"))
+
+	if code := CodeOf(err); code != CodeAlreadyExists {
+		t.Errorf("expected %s, got %s", CodeAlreadyExists, code)
+	}
+	if msg := Message(err); msg != "a user with that email already exists" {
+		t.Errorf("unexpected client message %q", msg)
+	}
+	if !strings.Contains(err.Error(), "users_email_key") {
+		t.Errorf("the error's own message should keep the internal detail: %s", err)
+	}
+	if !errors.Is(err, cause) {
+		t.Error("expected the coded error to unwrap to its cause")
+	}
+	if !strings.Contains(Stack(err), "TestWithCode") {
+		t.Errorf("expected a captured stack, got %q", Stack(err))
+	}
+	if HTTPStatus(err) != http.StatusConflict {
+		t.Errorf("expected 409, got %d", HTTPStatus(err))
+	}
+	st := GRPCStatus(err)
+	if st.Code() != codes.AlreadyExists || st.Message() != "a user with that email already exists" {
+		t.Errorf("unexpected gRPC status %s %q", st.Code(), st.Message())
+	}
+	if WithCode(nil, CodeInternal, "") != nil || Internal(nil) != nil {
+		t.Error("wrapping nil should return nil")
+	}
+}
+
+var errOutOfStock = Sentinel(CodeConflict, "out of stock")
+
+func TestSentinel(t *testing.T) {
+	if Stack(errOutOfStock) != "" {
+		t.Errorf("sentinels should not capture a stack, got %q", Stack(errOutOfStock))
+	}
+	err := WithStack(errOutOfStock)
+	if !errors.Is(err, errOutOfStock) || CodeOf(err) != CodeConflict || Message(err) != "out of stock" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if !strings.Contains(Stack(err), "TestSentinel") {
+		t.Errorf("expected the stack of WithStack, got %q", Stack(err))
+	}
+}
+
+func TestCodeOf(t *testing.T) {
+	tests := []struct {
+		err    error
+		code   Code
+		status int
+	}{
+		{NewCode(CodeRateLimited, "slow down"), CodeRateLimited, http.StatusTooManyRequests},
+		{Internal(errors.New("nil pointer")), CodeInternal, http.StatusInternalServerError},
+		{recorderrors.NotFound("order", "1"), CodeNotFound, http.StatusNotFound},
+		{fmt.Errorf("query: %w", context.DeadlineExceeded), CodeTimeout, http.StatusGatewayTimeout},
+		{teapotError{}, CodeInvalidArgument, http.StatusTeapot},
+		{errors.New("boom"), CodeInternal, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if code := CodeOf(tt.err); code != tt.code {
+			t.Errorf("%q: expected code %s, got %s", tt.err, tt.code, code)
+		}
+		if status := HTTPStatus(tt.err); status != tt.status {
+			t.Errorf("%q: expected status %d, got %d", tt.err, tt.status, status)
+		}
+	}
+	if msg := Message(Internal(errors.New("nil pointer"))); msg != "internal error" {
+		t.Errorf("expected internal errors to be hidden, got %q", msg)
+	}
+}
+
+func TestMessage(t *testing.T) {
+	tests := []struct {
+		err     error
+		message string
+	}{
+		{NewCode(CodeRateLimited, "slow down"), "slow down"},
+		{recorderrors.NotFound("order", "1"), "order 1: record not found"},
+		{fmt.Errorf("loading order: %w", recorderrors.ErrNotFound), "record not found"},
+		{teapotError{}, "teapot"},
+		{errors.New("pq: connection refused to 10.0.0.7:5432"), "internal error"},
+		{fmt.Errorf("saving order: %w", errors.New("disk full")), "internal error"},
+		{fmt.Errorf("query: %w", context.DeadlineExceeded), "Gateway Timeout"},
+		{context.Canceled, "canceled"},
+	}
+	for _, tt := range tests {
+		if msg := Message(tt.err); msg != tt.message {
+			t.Errorf("%q: expected message %q, got %q", tt.err, tt.message, msg)
+		}
+	}
+}
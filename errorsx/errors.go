@@ -0,0 +1,124 @@
+package errorsx
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// Captures a stack trace at the point an error is created
+// or wrapped, while remaining compatible with errors.Is/As.
+
+const maxStackDepth = 32
+
+type withStack struct {
+	msg   string
+	cause error
+	stack []uintptr
+}
+
+func (e *withStack) Error() string {
+	if e.cause == nil {
+		return e.msg
+	}
+	if e.msg == "" {
+		return e.cause.Error()
+	}
+	return e.msg + ": " + e.cause.Error()
+}
+
+func (e *withStack) Unwrap() error {
+	return e.cause
+}
+
+// StackTrace returns the program counters captured when the error was created.
+func (e *withStack) StackTrace() []uintptr {
+	return e.stack
+}
+
+// StackTracer is implemented by errors that carry a captured stack.
+type StackTracer interface {
+	StackTrace() []uintptr
+}
+
+func callers(skip int) []uintptr {
+	pcs := make([]uintptr, maxStackDepth)
+	n := runtime.Callers(skip+2, pcs)
+	return pcs[:n]
+}
+
+// New returns an error with the given message and the current stack.
+func New(msg string) error {
+	return &withStack{msg: msg, stack: callers(1)}
+}
+
+// Errorf formats an error message, capturing the current stack.
+// As with fmt.Errorf, the %w verb may be used to wrap a cause.
+func Errorf(format string, args ...interface{}) error {
+	return &withStack{cause: fmt.Errorf(format, args...), stack: callers(1)}
+}
+
+// Wrap annotates err with msg and the current stack. If err is nil, Wrap returns nil.
+func Wrap(err error, msg string) error {
+	if err == nil {
+		return nil
+	}
+	return &withStack{msg: msg, cause: err, stack: callers(1)}
+}
+
+// WithStack annotates err with the current stack without changing its message.
+// If err is nil, or already carries a stack, it is returned unchanged.
+func WithStack(err error) error {
+	if err == nil {
+		return nil
+	}
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if st, ok := e.(StackTracer); ok && len(st.StackTrace()) > 0 {
+			return err
+		}
+	}
+	return &withStack{cause: err, stack: callers(1)}
+}
+
+// Stack returns the formatted stack of the innermost error in err's
+// chain that carries one, or an empty string if none does.
+func Stack(err error) string {
+	var stack []uintptr
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if st, ok := e.(StackTracer); ok && len(st.StackTrace()) > 0 {
+			stack = st.StackTrace()
+		}
+	}
+	return FormatStack(stack)
+}
+
+// FormatStack renders program counters as "function\n\tfile:line" pairs.
+func FormatStack(stack []uintptr) string {
+	if len(stack) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	frames := runtime.CallersFrames(stack)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&sb, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return sb.String()
+}
+
+// Chain returns the messages of err and each error it wraps, outermost first.
+func Chain(err error) []string {
+	var chain []string
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		// Stack-only annotations repeat their cause's message
+		if ws, ok := e.(*withStack); ok && ws.msg == "" {
+			continue
+		}
+		chain = append(chain, e.Error())
+	}
+	return chain
+}
@@ -0,0 +1,44 @@
+package errorsx
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var errBase = errors.New("base")
+
+func TestWrap(t *testing.T) {
+	if Wrap(nil, "context") != nil {
+		t.Error("Wrap of nil should be nil")
+	}
+
+	err := Wrap(errBase, "context")
+	if want, have := "context: base", err.Error(); want != have {
+		t.Errorf("unexpected message; expected %s, got %s", want, have)
+	}
+	if !errors.Is(err, errBase) {
+		t.Error("wrapped error should match its cause")
+	}
+	if !strings.Contains(Stack(err), "TestWrap") {
+		t.Errorf("stack should contain the calling function, got %s", Stack(err))
+	}
+}
+
+func TestErrorf(t *testing.T) {
+	err := Errorf("loading %s: %w", "widget", errBase)
+	if want, have := "loading widget: base", err.Error(); want != have {
+		t.Errorf("unexpected message; expected %s, got %s", want, have)
+	}
+	if !errors.Is(err, errBase) {
+		t.Error("Errorf should wrap the %w operand")
+	}
+}
+
+func TestChain(t *testing.T) {
+	err := Wrap(WithStack(errBase), "outer")
+	chain := Chain(err)
+	if len(chain) != 2 || chain[0] != "outer: base" || chain[1] != "base" {
+		t.Errorf("unexpected chain: %v", chain)
+	}
+}
@@ -0,0 +1,119 @@
+// Package eventbus publishes typed events and subscribes handlers to
+// them over a Bus: in memory for tests and small services, or over the
+// messaging/kafka and messaging/nats brokers. The trace context and
+// request ID travel with each event, so handlers continue the trace of
+// the request that published it.
+//
+//	var OrderCreated = eventbus.NewTopic[Order]("orders.created")
+//
+//	err := OrderCreated.Publish(ctx, bus, order)
+//
+//	sub, err := OrderCreated.Subscribe(bus, func(ctx context.Context, o Order) error {
+//		return reserveStock(ctx, o)
+//	})
+//	defer sub.Unsubscribe()
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jdotw/go-utils/messaging"
+)
+
+// Headers set on published events.
+const (
+	// ContentTypeHeader carries the encoding of the event.
+	ContentTypeHeader = "Content-Type"
+	// EventTypeHeader carries the name of the event's topic.
+	EventTypeHeader = "X-Event-Type"
+)
+
+// Bus publishes messages and delivers them to subscribers.
+type Bus interface {
+	messaging.Publisher
+	// Subscribe calls handler for each message published on topic until
+	// the subscription is cancelled. Handler errors are retried as the
+	// backend allows, as with the messaging consumers.
+	Subscribe(topic string, handler messaging.Handler) (Subscription, error)
+	// Close cancels every subscription and releases the bus's resources.
+	Close() error
+}
+
+// Subscription is a handler subscribed to a topic.
+type Subscription interface {
+	// Unsubscribe stops delivering messages to the handler, waiting for
+	// the message being handled, if any.
+	Unsubscribe() error
+}
+
+// Keyed is implemented by events that should be delivered in order with
+// other events with the same key, such as events about one record.
+type Keyed interface {
+	EventKey() string
+}
+
+// Topic publishes and subscribes to events of type T, encoded as JSON.
+type Topic[T any] struct {
+	Name string
+}
+
+// NewTopic returns the topic called name carrying events of type T.
+func NewTopic[T any](name string) Topic[T] {
+	return Topic[T]{Name: name}
+}
+
+// Message encodes event as a message on the topic.
+func (t Topic[T]) Message(event T) (messaging.Message, error) {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return messaging.Message{}, fmt.Errorf("encode %s event: %w", t.Name, err)
+	}
+	msg := messaging.Message{
+		Topic: t.Name,
+		Value: value,
+		Headers: map[string]string{
+			ContentTypeHeader: "application/json",
+			EventTypeHeader:   t.Name,
+		},
+	}
+	if k, ok := any(event).(Keyed); ok {
+		msg.Key = []byte(k.EventKey())
+	}
+	return msg, nil
+}
+
+// Publish publishes events on the topic in order.
+func (t Topic[T]) Publish(ctx context.Context, publisher messaging.Publisher, events ...T) error {
+	msgs := make([]messaging.Message, len(events))
+	for i, event := range events {
+		msg, err := t.Message(event)
+		if err != nil {
+			return err
+		}
+		msgs[i] = msg
+	}
+	return publisher.Publish(ctx, msgs...)
+}
+
+// Decode decodes the event carried by msg. Errors wrap
+// messaging.ErrPermanent, as retrying won't fix a malformed event.
+func (t Topic[T]) Decode(msg messaging.Message) (T, error) {
+	var event T
+	if err := json.Unmarshal(msg.Value, &event); err != nil {
+		return event, fmt.Errorf("decode %s event: %v: %w", t.Name, err, messaging.ErrPermanent)
+	}
+	return event, nil
+}
+
+// Subscribe calls handler with each event published on the topic.
+func (t Topic[T]) Subscribe(bus Bus, handler func(ctx context.Context, event T) error) (Subscription, error) {
+	return bus.Subscribe(t.Name, func(ctx context.Context, msg messaging.Message) error {
+		event, err := t.Decode(msg)
+		if err != nil {
+			return err
+		}
+		return handler(ctx, event)
+	})
+}
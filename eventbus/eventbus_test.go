@@ -0,0 +1,163 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jdotw/go-utils/correlation"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/messaging"
+	"github.com/jdotw/go-utils/retry"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+type orderCreated struct {
+	ID    string `json:"id"`
+	Total int    `json:"total"`
+}
+
+func (o orderCreated) EventKey() string {
+	return o.ID
+}
+
+var ordersCreated = NewTopic[orderCreated]("orders.created")
+
+func TestMemoryBus(t *testing.T) {
+	tracer := mocktracer.New()
+	bus := NewMemoryBus(log.NewMockLogFactory(), tracer)
+	defer bus.Close()
+
+	var got []orderCreated
+	var requestID string
+	sub, err := ordersCreated.Subscribe(bus, func(ctx context.Context, o orderCreated) error {
+		got = append(got, o)
+		requestID = correlation.FromContext(ctx)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parent := tracer.StartSpan("request")
+	ctx := opentracing.ContextWithSpan(correlation.WithRequestID(context.Background(), "req-1"), parent)
+	if err := ordersCreated.Publish(ctx, bus, orderCreated{ID: "1", Total: 10}, orderCreated{ID: "2", Total: 20}); err != nil {
+		t.Fatal(err)
+	}
+	parent.Finish()
+
+	if len(got) != 2 || got[0].ID != "1" || got[1].Total != 20 {
+		t.Errorf("unexpected events %+v", got)
+	}
+	if requestID != "req-1" {
+		t.Errorf("expected the request ID to propagate, got %q", requestID)
+	}
+
+	traceID := parent.Context().(mocktracer.MockSpanContext).TraceID
+	receives := 0
+	for _, span := range tracer.FinishedSpans() {
+		if span.OperationName != "eventbus.receive" {
+			continue
+		}
+		receives++
+		if span.SpanContext.TraceID != traceID {
+			t.Error("receive span should continue the publisher's trace")
+		}
+	}
+	if receives != 2 {
+		t.Errorf("expected 2 receive spans, got %d", receives)
+	}
+
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	ordersCreated.Publish(context.Background(), bus, orderCreated{ID: "3"})
+	if len(got) != 2 {
+		t.Errorf("unsubscribed handler should not be called, got %+v", got)
+	}
+}
+
+func TestMemoryBusHandlerErrors(t *testing.T) {
+	bus := NewMemoryBus(log.NewMockLogFactory(), mocktracer.New())
+	calls := 0
+	bus.Subscribe("orders.created", func(ctx context.Context, msg messaging.Message) error {
+		calls++
+		panic("boom")
+	})
+	bus.Subscribe("orders.created", func(ctx context.Context, msg messaging.Message) error {
+		calls++
+		return errors.New("failed")
+	})
+	if err := ordersCreated.Publish(context.Background(), bus, orderCreated{ID: "1"}); err != nil {
+		t.Errorf("handler failures should not fail the publisher, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("every subscriber should be called, got %d calls", calls)
+	}
+
+	bus.Close()
+	if err := ordersCreated.Publish(context.Background(), bus, orderCreated{ID: "2"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestMemoryBusUnsubscribeFromHandler(t *testing.T) {
+	bus := NewMemoryBus(log.NewMockLogFactory(), mocktracer.New())
+	defer bus.Close()
+	calls := 0
+	var sub Subscription
+	sub, _ = bus.Subscribe("orders.created", func(ctx context.Context, msg messaging.Message) error {
+		calls++
+		return sub.Unsubscribe()
+	})
+	ordersCreated.Publish(context.Background(), bus, orderCreated{ID: "1"})
+	ordersCreated.Publish(context.Background(), bus, orderCreated{ID: "2"})
+	if calls != 1 {
+		t.Errorf("expected 1 call, got %d", calls)
+	}
+}
+
+func TestRunnerRestarts(t *testing.T) {
+	r := newRunners()
+	r.policy = retry.Policy{InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	failure := errors.New("connection lost")
+	runs := make(chan int, 3)
+	n := 0
+	sub, _ := r.start("orders.created", log.NewMockLogFactory(), func(ctx context.Context) error {
+		n++
+		runs <- n
+		if n < 3 {
+			return failure
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	for i := 1; i <= 3; i++ {
+		select {
+		case <-runs:
+		case <-time.After(time.Second):
+			t.Fatalf("consumer not restarted after %d runs", i-1)
+		}
+	}
+	if err := sub.Unsubscribe(); err != failure {
+		t.Errorf("expected the last failure, got %v", err)
+	}
+}
+
+func TestTopicMessage(t *testing.T) {
+	msg, err := ordersCreated.Message(orderCreated{ID: "1", Total: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg.Key) != "1" || msg.Headers[EventTypeHeader] != "orders.created" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	if _, err := ordersCreated.Decode(messaging.Message{Value: []byte("not json")}); !errors.Is(err, messaging.ErrPermanent) {
+		t.Errorf("expected a permanent decode error, got %v", err)
+	}
+	if have := durableName("billing", "orders.*.>"); have != "billing_orders_any_all" {
+		t.Errorf("unexpected durable name %q", have)
+	}
+}
@@ -0,0 +1,83 @@
+package eventbus
+
+import (
+	"context"
+	"time"
+
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/messaging"
+	"github.com/jdotw/go-utils/messaging/kafka"
+	"github.com/opentracing/opentracing-go"
+)
+
+// KafkaConfig configures a Kafka bus. Its tags allow loading it with the
+// config package.
+type KafkaConfig struct {
+	Brokers []string `json:"brokers" env:"KAFKA_BROKERS" validate:"required"`
+	// GroupID is the consumer group of the service's subscriptions.
+	// Each topic is consumed by the group GroupID.topic, so every
+	// instance of the service shares its subscriptions' messages.
+	GroupID string `json:"group_id" env:"KAFKA_GROUP_ID" validate:"required"`
+	// MaxAttempts is the number of times a message is handled before it
+	// is dead lettered.
+	MaxAttempts int `json:"max_attempts" env:"KAFKA_CONSUMER_MAX_ATTEMPTS" default:"3"`
+	// RetryBackoff is the wait before the first retry, doubling for each
+	// one after.
+	RetryBackoff time.Duration `json:"retry_backoff" env:"KAFKA_CONSUMER_RETRY_BACKOFF" default:"1s"`
+	// DeadLetterSuffix, when set, dead letters messages that fail every
+	// attempt to their topic with this suffix, such as ".dlq".
+	DeadLetterSuffix string `json:"dead_letter_suffix" env:"KAFKA_DEAD_LETTER_SUFFIX"`
+}
+
+type kafkaBus struct {
+	cfg      KafkaConfig
+	producer *kafka.Producer
+	opts     []kafka.Option
+	logger   log.Factory
+	tracer   opentracing.Tracer
+	subs     *runners
+}
+
+// NewKafkaBus returns a Bus over Kafka. Each subscription runs a
+// kafka.Consumer, so messages are delivered at least once, retried and
+// dead lettered as configured.
+func NewKafkaBus(cfg KafkaConfig, logger log.Factory, tracer opentracing.Tracer, opts ...kafka.Option) Bus {
+	return &kafkaBus{
+		cfg:      cfg,
+		producer: kafka.NewProducer(kafka.ProducerConfig{Brokers: cfg.Brokers, MaxAttempts: 5, BatchTimeout: 10 * time.Millisecond}, logger, tracer, opts...),
+		opts:     opts,
+		logger:   logger,
+		tracer:   tracer,
+		subs:     newRunners(),
+	}
+}
+
+func (b *kafkaBus) Publish(ctx context.Context, msgs ...messaging.Message) error {
+	return b.producer.Publish(ctx, msgs...)
+}
+
+func (b *kafkaBus) Subscribe(topic string, handler messaging.Handler) (Subscription, error) {
+	cfg := kafka.ConsumerConfig{
+		Brokers:      b.cfg.Brokers,
+		GroupID:      b.cfg.GroupID + "." + topic,
+		Topics:       []string{topic},
+		MaxAttempts:  b.cfg.MaxAttempts,
+		RetryBackoff: b.cfg.RetryBackoff,
+	}
+	if b.cfg.DeadLetterSuffix != "" {
+		cfg.DeadLetterTopic = topic + b.cfg.DeadLetterSuffix
+	}
+	// A consumer closes its reader when Run returns, so each restart
+	// needs a new one
+	return b.subs.start(topic, b.logger, func(ctx context.Context) error {
+		return kafka.NewConsumer(cfg, handler, b.logger, b.tracer, b.opts...).Run(ctx)
+	})
+}
+
+func (b *kafkaBus) Close() error {
+	err := b.subs.stopAll()
+	if perr := b.producer.Close(); err == nil {
+		err = perr
+	}
+	return err
+}
@@ -0,0 +1,147 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/messaging"
+	"github.com/jdotw/go-utils/tracing"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"go.uber.org/zap"
+)
+
+// ErrClosed is returned when using a closed bus.
+var ErrClosed = errors.New("event bus closed")
+
+// memoryBus delivers messages to its subscribers in process.
+type memoryBus struct {
+	logger log.Factory
+	tracer opentracing.Tracer
+
+	mu     sync.RWMutex
+	subs   map[string][]*memorySubscription
+	closed bool
+}
+
+// NewMemoryBus returns a Bus delivering messages within the process.
+// Publish calls each subscriber in turn before returning, so tests can
+// assert on their effects straight away. Nothing is persisted: handler
+// errors are logged and the message is dropped.
+func NewMemoryBus(logger log.Factory, tracer opentracing.Tracer) Bus {
+	return &memoryBus{
+		logger: logger,
+		tracer: tracer,
+		subs:   make(map[string][]*memorySubscription),
+	}
+}
+
+type memorySubscription struct {
+	bus     *memoryBus
+	topic   string
+	handler messaging.Handler
+
+	mu     sync.Mutex
+	active bool
+}
+
+func (b *memoryBus) Publish(ctx context.Context, msgs ...messaging.Message) error {
+	ctx, span := tracing.NewChildSpanAndContext(ctx, b.tracer, "eventbus.publish")
+	defer span.Finish()
+	ext.SpanKindProducer.Set(span)
+
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return ErrClosed
+	}
+	deliveries := make([][]*memorySubscription, len(msgs))
+	for i, msg := range msgs {
+		deliveries[i] = append([]*memorySubscription(nil), b.subs[msg.Topic]...)
+	}
+	b.mu.RUnlock()
+
+	for i, msg := range msgs {
+		messaging.Inject(ctx, b.tracer, &msg)
+		for _, sub := range deliveries[i] {
+			sub.deliver(msg)
+		}
+	}
+	return nil
+}
+
+func (s *memorySubscription) deliver(msg messaging.Message) {
+	// The handler runs unlocked, so it may publish events of its own or
+	// unsubscribe; a delivery already under way when Unsubscribe is
+	// called still completes
+	s.mu.Lock()
+	active := s.active
+	s.mu.Unlock()
+	if !active {
+		return
+	}
+	// Handlers run outside the publisher's request, as they would with a
+	// broker, but continue its trace
+	ctx, span := messaging.StartConsumerSpan(context.Background(), s.bus.tracer, "eventbus.receive", msg)
+	defer span.Finish()
+	ext.SpanKindConsumer.Set(span)
+	defer func() {
+		if rec := recover(); rec != nil {
+			ext.Error.Set(span, true)
+			log.LogPanic(ctx, s.bus.logger, rec)
+		}
+	}()
+	if err := s.handler(ctx, msg); err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(otlog.Error(err))
+		s.bus.logger.For(ctx).Error("Failed to handle event", zap.String("topic", msg.Topic), zap.Error(err))
+	}
+}
+
+func (b *memoryBus) Subscribe(topic string, handler messaging.Handler) (Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrClosed
+	}
+	sub := &memorySubscription{bus: b, topic: topic, handler: handler, active: true}
+	b.subs[topic] = append(b.subs[topic], sub)
+	return sub, nil
+}
+
+func (s *memorySubscription) Unsubscribe() error {
+	s.bus.mu.Lock()
+	subs := s.bus.subs[s.topic]
+	for i, sub := range subs {
+		if sub == s {
+			s.bus.subs[s.topic] = append(subs[:i:i], subs[i+1:]...)
+			break
+		}
+	}
+	s.bus.mu.Unlock()
+
+	s.mu.Lock()
+	s.active = false
+	s.mu.Unlock()
+	return nil
+}
+
+func (b *memoryBus) Close() error {
+	b.mu.Lock()
+	subs := b.subs
+	b.subs = make(map[string][]*memorySubscription)
+	b.closed = true
+	b.mu.Unlock()
+
+	for _, topicSubs := range subs {
+		for _, sub := range topicSubs {
+			sub.mu.Lock()
+			sub.active = false
+			sub.mu.Unlock()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package eventbus
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/messaging"
+	"github.com/jdotw/go-utils/messaging/nats"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/opentracing/opentracing-go"
+)
+
+// NATSConfig configures a NATS bus. Its tags allow loading it with the
+// config package.
+type NATSConfig struct {
+	// Stream is the JetStream stream capturing the bus's topics.
+	Stream string `json:"stream" env:"NATS_STREAM" validate:"required"`
+	// Group names the service's durable consumers, one per subscribed
+	// topic, shared by every instance of the service.
+	Group string `json:"group" env:"NATS_DURABLE" validate:"required"`
+	// MaxAttempts is the number of times a message is delivered before
+	// it is dead lettered.
+	MaxAttempts int `json:"max_attempts" env:"NATS_CONSUMER_MAX_ATTEMPTS" default:"3"`
+	// RetryBackoff is the redelivery delay after the first failure,
+	// doubling for each one after.
+	RetryBackoff time.Duration `json:"retry_backoff" env:"NATS_CONSUMER_RETRY_BACKOFF" default:"1s"`
+	// AckWait is how long a message may be handled before it is
+	// redelivered.
+	AckWait time.Duration `json:"ack_wait" env:"NATS_CONSUMER_ACK_WAIT" default:"30s"`
+	// DeadLetterSuffix, when set, dead letters messages that fail every
+	// attempt to their topic with this suffix, such as ".dlq".
+	DeadLetterSuffix string `json:"dead_letter_suffix" env:"NATS_DEAD_LETTER_SUFFIX"`
+}
+
+type natsBus struct {
+	nc       *natsgo.Conn
+	cfg      NATSConfig
+	producer *nats.Producer
+	opts     []nats.Option
+	logger   log.Factory
+	tracer   opentracing.Tracer
+	subs     *runners
+}
+
+// NewNATSBus returns a Bus over NATS JetStream. Topics are subjects,
+// which the stream must capture. Each subscription runs a nats.Consumer,
+// so messages are delivered at least once, redelivered and dead
+// lettered as configured.
+func NewNATSBus(nc *natsgo.Conn, cfg NATSConfig, logger log.Factory, tracer opentracing.Tracer, opts ...nats.Option) (Bus, error) {
+	producer, err := nats.NewProducer(nc, logger, tracer, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &natsBus{
+		nc:       nc,
+		cfg:      cfg,
+		producer: producer,
+		opts:     opts,
+		logger:   logger,
+		tracer:   tracer,
+		subs:     newRunners(),
+	}, nil
+}
+
+func (b *natsBus) Publish(ctx context.Context, msgs ...messaging.Message) error {
+	return b.producer.Publish(ctx, msgs...)
+}
+
+func (b *natsBus) Subscribe(topic string, handler messaging.Handler) (Subscription, error) {
+	cfg := nats.ConsumerConfig{
+		Stream:       b.cfg.Stream,
+		Durable:      durableName(b.cfg.Group, topic),
+		Subject:      topic,
+		MaxAttempts:  b.cfg.MaxAttempts,
+		RetryBackoff: b.cfg.RetryBackoff,
+		AckWait:      b.cfg.AckWait,
+		BatchSize:    10,
+	}
+	if b.cfg.DeadLetterSuffix != "" {
+		cfg.DeadLetterTopic = topic + b.cfg.DeadLetterSuffix
+	}
+	c, err := nats.NewConsumer(b.nc, cfg, handler, b.logger, b.tracer, b.opts...)
+	if err != nil {
+		return nil, err
+	}
+	return b.subs.start(topic, b.logger, c.Run)
+}
+
+// Close cancels the subscriptions. The connection is left open for its
+// owner to close.
+func (b *natsBus) Close() error {
+	return b.subs.stopAll()
+}
+
+// durableName returns a JetStream durable name for topic, which may not
+// contain the subject separator or wildcards.
+func durableName(group, topic string) string {
+	return group + "_" + strings.NewReplacer(".", "_", "*", "any", ">", "all").Replace(topic)
+}
@@ -0,0 +1,99 @@
+package eventbus
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/retry"
+	"go.uber.org/zap"
+)
+
+// restartPolicy spaces out restarts of a failed consumer.
+var restartPolicy = retry.Policy{
+	InitialBackoff: time.Second,
+	MaxBackoff:     time.Minute,
+	Multiplier:     2,
+}
+
+// runners tracks the broker consumers run by subscriptions.
+type runners struct {
+	mu     sync.Mutex
+	active map[*runner]struct{}
+	policy retry.Policy
+}
+
+func newRunners() *runners {
+	return &runners{active: make(map[*runner]struct{}), policy: restartPolicy}
+}
+
+// runner runs a consumer until its subscription is cancelled.
+type runner struct {
+	set    *runners
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// start runs run in the background until the returned subscription is
+// cancelled. A consumer that fails is logged, as nothing else waits on
+// it, and restarted with backoff; the backoff resets once a run outlasts
+// the longest wait.
+func (r *runners) start(topic string, logger log.Factory, run func(ctx context.Context) error) (Subscription, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &runner{set: r, cancel: cancel, done: make(chan struct{})}
+	r.mu.Lock()
+	r.active[s] = struct{}{}
+	r.mu.Unlock()
+	go func() {
+		defer close(s.done)
+		attempt := 0
+		for ctx.Err() == nil {
+			started := time.Now()
+			err := run(ctx)
+			if err == nil || ctx.Err() != nil {
+				return
+			}
+			s.err = err
+			if time.Since(started) > r.policy.MaxBackoff {
+				attempt = 0
+			}
+			attempt++
+			wait := r.policy.Backoff(attempt)
+			logger.Bg().Error("Event subscription failed, restarting", zap.String("topic", topic), zap.Duration("backoff", wait), zap.Error(err))
+			select {
+			case <-ctx.Done():
+			case <-time.After(wait):
+			}
+		}
+	}()
+	return s, nil
+}
+
+// Unsubscribe stops the consumer, returning the last error it failed
+// with, if any.
+func (s *runner) Unsubscribe() error {
+	s.cancel()
+	<-s.done
+	s.set.mu.Lock()
+	delete(s.set.active, s)
+	s.set.mu.Unlock()
+	return s.err
+}
+
+func (r *runners) stopAll() error {
+	r.mu.Lock()
+	active := make([]*runner, 0, len(r.active))
+	for s := range r.active {
+		active = append(active, s)
+	}
+	r.mu.Unlock()
+	var err error
+	for _, s := range active {
+		if serr := s.Unsubscribe(); err == nil {
+			err = serr
+		}
+	}
+	return err
+}
@@ -0,0 +1,184 @@
+// Package featureflag decides whether features are enabled for the
+// caller of a request. Flags are evaluated by a Provider for a Subject
+// built from the request's JWT claims and tenant, so features can be
+// rolled out per tenant, per user or to a percentage of either.
+//
+//	provider, err := featureflag.NewFileProvider("flags.yaml")
+//	flags := featureflag.New(featureflag.Chain(featureflag.NewEnvProvider("FEATURE_"), provider), logger, tracer)
+//	if flags.Enabled(ctx, "new-checkout") {
+//		...
+//	}
+//	endpoint = flags.NewMiddleware("new-checkout")(endpoint)
+package featureflag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-kit/kit/endpoint"
+	stdjwt "github.com/golang-jwt/jwt/v4"
+	"github.com/jdotw/go-utils/authn/jwt"
+	"github.com/jdotw/go-utils/errorsx"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/tenant"
+	"github.com/jdotw/go-utils/tracing"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrUnknownFlag is returned by providers that have no value for a
+	// flag.
+	ErrUnknownFlag = errors.New("unknown feature flag")
+
+	// ErrFeatureDisabled is returned by the middleware when its feature is
+	// disabled for the caller. It responds 404, as if the feature didn't
+	// exist.
+	ErrFeatureDisabled = errorsx.Sentinel(errorsx.CodeNotFound, "feature disabled")
+)
+
+// Subject is who a flag is evaluated for.
+type Subject struct {
+	// Key identifies the caller, usually the JWT subject.
+	Key string `json:"key,omitempty"`
+	// Tenant is the caller's tenant ID.
+	Tenant string `json:"tenant,omitempty"`
+	// Claims are the caller's JWT claims, for providers that target on
+	// other attributes.
+	Claims map[string]interface{} `json:"claims,omitempty"`
+}
+
+// SubjectFromContext returns the Subject of the request in ctx, from the
+// claims stored by the authn middleware and the ID stored by the tenant
+// middleware.
+func SubjectFromContext(ctx context.Context) Subject {
+	s := Subject{
+		Key:    jwt.SubjectFromContext(ctx),
+		Tenant: tenant.FromContext(ctx),
+	}
+	if claims, ok := jwt.ClaimsFromContext(ctx).(stdjwt.MapClaims); ok {
+		s.Claims = claims
+	}
+	return s
+}
+
+// Provider evaluates flags. Providers that have no value for a flag
+// return an error matching ErrUnknownFlag.
+type Provider interface {
+	Enabled(ctx context.Context, flag string, subject Subject) (bool, error)
+}
+
+// ProviderFunc adapts a function to a Provider.
+type ProviderFunc func(ctx context.Context, flag string, subject Subject) (bool, error)
+
+// Enabled implements Provider.
+func (f ProviderFunc) Enabled(ctx context.Context, flag string, subject Subject) (bool, error) {
+	return f(ctx, flag, subject)
+}
+
+// reloadable is implemented by providers whose flags can be reloaded at
+// runtime, such as those from NewFileProvider.
+type reloadable interface {
+	Reload(ctx context.Context) error
+}
+
+type chain []Provider
+
+// Chain returns a Provider asking each of providers in turn, until one
+// has a value for the flag. Reloading it reloads each provider that can
+// be.
+func Chain(providers ...Provider) Provider {
+	return chain(providers)
+}
+
+func (c chain) Enabled(ctx context.Context, flag string, subject Subject) (bool, error) {
+	for _, p := range c {
+		enabled, err := p.Enabled(ctx, flag, subject)
+		if errors.Is(err, ErrUnknownFlag) {
+			continue
+		}
+		return enabled, err
+	}
+	return false, fmt.Errorf("%w: %s", ErrUnknownFlag, flag)
+}
+
+// Reload reloads every provider that can be, returning the first
+// failure.
+func (c chain) Reload(ctx context.Context) error {
+	var first error
+	for _, p := range c {
+		if r, ok := p.(reloadable); ok {
+			if err := r.Reload(ctx); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// Flags evaluates flags for the caller of a request.
+type Flags struct {
+	provider Provider
+	logger   log.Factory
+	tracer   opentracing.Tracer
+}
+
+// New returns Flags evaluated by provider.
+func New(provider Provider, logger log.Factory, tracer opentracing.Tracer) *Flags {
+	return &Flags{provider: provider, logger: logger, tracer: tracer}
+}
+
+// Enabled reports whether flag is enabled for the caller in ctx. Unknown
+// flags and provider failures are logged and treat the flag as disabled.
+func (f *Flags) Enabled(ctx context.Context, flag string) bool {
+	return f.EnabledFor(ctx, flag, SubjectFromContext(ctx))
+}
+
+// EnabledFor reports whether flag is enabled for subject, like Enabled.
+func (f *Flags) EnabledFor(ctx context.Context, flag string, subject Subject) bool {
+	ctx, span := tracing.NewChildSpanAndContext(ctx, f.tracer, "FeatureFlag")
+	defer span.Finish()
+	span.SetTag("feature_flag.key", flag)
+
+	enabled, err := f.provider.Enabled(ctx, flag, subject)
+	if err != nil {
+		if errors.Is(err, ErrUnknownFlag) {
+			log.Warn(f.logger.For(ctx), "Unknown feature flag", zap.String("flag", flag))
+		} else {
+			ext.Error.Set(span, true)
+			span.LogFields(otlog.Error(err))
+			f.logger.For(ctx).Error("Failed to evaluate feature flag", zap.String("flag", flag), zap.Error(err))
+		}
+		enabled = false
+	}
+	span.SetTag("feature_flag.enabled", enabled)
+	return enabled
+}
+
+// Reload reloads the flags of providers that can be, such as those from
+// NewFileProvider and Chain, keeping the current flags of any that fail.
+// It implements reload.Reloadable.
+func (f *Flags) Reload(ctx context.Context) error {
+	if r, ok := f.provider.(reloadable); ok {
+		return r.Reload(ctx)
+	}
+	return nil
+}
+
+// NewMiddleware returns endpoint middleware failing requests with
+// ErrFeatureDisabled when flag is disabled for the caller, so it must run
+// after the authn and tenant middleware.
+func (f *Flags) NewMiddleware(flag string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if !f.Enabled(ctx, flag) {
+				f.logger.For(ctx).Info("Feature disabled", zap.String("flag", flag))
+				return nil, ErrFeatureDisabled
+			}
+			return next(ctx, request)
+		}
+	}
+}
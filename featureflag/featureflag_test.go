@@ -0,0 +1,192 @@
+package featureflag
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	stdjwt "github.com/golang-jwt/jwt/v4"
+	"github.com/jdotw/go-utils/authn/jwt"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/tenant"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestRule(t *testing.T) {
+	tests := []struct {
+		rule     Rule
+		subject  Subject
+		expected bool
+	}{
+		{Rule{Enabled: true}, Subject{}, true},
+		{Rule{}, Subject{Key: "alice"}, false},
+		{Rule{Subjects: []string{"alice"}}, Subject{Key: "alice"}, true},
+		{Rule{Tenants: []string{"acme"}}, Subject{Key: "bob", Tenant: "acme"}, true},
+		{Rule{Tenants: []string{"acme"}}, Subject{Key: "bob", Tenant: "globex"}, false},
+		{Rule{Percentage: 100}, Subject{Tenant: "acme"}, true},
+		{Rule{Percentage: 100}, Subject{}, false},
+	}
+	for i, tt := range tests {
+		if enabled := tt.rule.Evaluate("flag", tt.subject); enabled != tt.expected {
+			t.Errorf("%d: expected %v, got %v", i, tt.expected, enabled)
+		}
+	}
+
+	// Rollouts are stable and roughly proportional
+	rule := Rule{Percentage: 30}
+	enabled := 0
+	for i := 0; i < 1000; i++ {
+		s := Subject{Key: string(rune('a'+i%26)) + string(rune('0'+i/26))}
+		if rule.Evaluate("flag", s) {
+			enabled++
+		}
+		if rule.Evaluate("flag", s) != rule.Evaluate("flag", s) {
+			t.Fatal("expected rollouts to be stable")
+		}
+	}
+	if enabled < 200 || enabled > 400 {
+		t.Errorf("expected about 30%% of subjects enabled, got %d/1000", enabled)
+	}
+}
+
+func TestEnvProvider(t *testing.T) {
+	env := map[string]string{
+		"FEATURE_NEW_CHECKOUT": "true",
+		"FEATURE_BETA":         "acme, globex",
+		"FEATURE_ROLLOUT":      "0%",
+		"FEATURE_BROKEN":       "150%",
+	}
+	p := &envProvider{prefix: "FEATURE_", lookup: func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	}}
+	ctx := context.Background()
+	subject := Subject{Key: "alice", Tenant: "globex"}
+
+	for flag, expected := range map[string]bool{"new-checkout": true, "beta": true, "rollout": false} {
+		if enabled, err := p.Enabled(ctx, flag, subject); err != nil || enabled != expected {
+			t.Errorf("%s: expected %v, got %v (%v)", flag, expected, enabled, err)
+		}
+	}
+	if _, err := p.Enabled(ctx, "broken", subject); err == nil || errors.Is(err, ErrUnknownFlag) {
+		t.Errorf("expected an invalid value error, got %v", err)
+	}
+	if _, err := p.Enabled(ctx, "missing", subject); !errors.Is(err, ErrUnknownFlag) {
+		t.Errorf("expected ErrUnknownFlag, got %v", err)
+	}
+}
+
+func TestFileProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flags.yaml")
+	os.WriteFile(path, []byte("new-checkout:\n  tenants: [acme]\nbeta:\n  enabled: true\n"), 0600)
+	p, err := NewFileProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enabled, _ := p.Enabled(context.Background(), "new-checkout", Subject{Tenant: "acme"}); !enabled {
+		t.Error("expected new-checkout to be enabled for acme")
+	}
+
+	// The env provider overrides the file
+	env := &envProvider{prefix: "FEATURE_", lookup: func(k string) (string, bool) {
+		return "false", k == "FEATURE_BETA"
+	}}
+	chain := Chain(env, p)
+	if enabled, err := chain.Enabled(context.Background(), "beta", Subject{}); err != nil || enabled {
+		t.Errorf("expected beta to be disabled by the environment, got %v (%v)", enabled, err)
+	}
+	if enabled, err := chain.Enabled(context.Background(), "new-checkout", Subject{Tenant: "acme"}); err != nil || !enabled {
+		t.Errorf("expected the chain to fall through to the file, got %v (%v)", enabled, err)
+	}
+	if _, err := chain.Enabled(context.Background(), "missing", Subject{}); !errors.Is(err, ErrUnknownFlag) {
+		t.Errorf("expected ErrUnknownFlag, got %v", err)
+	}
+
+	// Reloading the flags reads the file again, keeping the rules if it
+	// no longer parses
+	flags := New(chain, log.NewMockLogFactory(), mocktracer.New())
+	os.WriteFile(path, []byte("new-checkout:\n  tenants: [globex]\n"), 0600)
+	if err := flags.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if flags.EnabledFor(context.Background(), "new-checkout", Subject{Tenant: "acme"}) {
+		t.Error("expected new-checkout to be disabled for acme after reloading")
+	}
+	os.WriteFile(path, []byte("new-checkout: ["), 0600)
+	if err := flags.Reload(context.Background()); err == nil {
+		t.Error("expected an invalid file to fail to reload")
+	}
+	if !flags.EnabledFor(context.Background(), "new-checkout", Subject{Tenant: "globex"}) {
+		t.Error("expected the previous rules to be kept")
+	}
+}
+
+func TestOPAProvider(t *testing.T) {
+	policy := `package flags
+
+default enabled = false
+
+enabled {
+	input.flag == "new-checkout"
+	input.subject.claims.plan == "enterprise"
+}`
+	p, err := NewOPAProvider(policy, "data.flags.enabled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject := Subject{Key: "alice", Claims: map[string]interface{}{"plan": "enterprise"}}
+	if enabled, err := p.Enabled(context.Background(), "new-checkout", subject); err != nil || !enabled {
+		t.Errorf("expected new-checkout to be enabled, got %v (%v)", enabled, err)
+	}
+	if enabled, err := p.Enabled(context.Background(), "beta", subject); err != nil || enabled {
+		t.Errorf("expected beta to be disabled, got %v (%v)", enabled, err)
+	}
+}
+
+type fakeLaunchDarkly struct {
+	context LaunchDarklyContext
+}
+
+func (c *fakeLaunchDarkly) BoolVariation(flag string, context LaunchDarklyContext, defaultValue bool) (bool, error) {
+	c.context = context
+	if flag != "beta" {
+		return defaultValue, ErrLaunchDarklyFlagNotFound
+	}
+	return true, nil
+}
+
+func TestLaunchDarklyProvider(t *testing.T) {
+	client := &fakeLaunchDarkly{}
+	p := Chain(NewLaunchDarklyProvider(client), Rules{"other": {Enabled: true}})
+	subject := Subject{Key: "alice", Tenant: "acme", Claims: map[string]interface{}{"plan": "pro"}}
+
+	if enabled, err := p.Enabled(context.Background(), "beta", subject); err != nil || !enabled {
+		t.Errorf("expected beta to be enabled, got %v (%v)", enabled, err)
+	}
+	if c := client.context; c.Kind != "user" || c.Key != "alice" || c.Attributes["tenant"] != "acme" || c.Attributes["plan"] != "pro" {
+		t.Errorf("unexpected context %+v", c)
+	}
+	if enabled, err := p.Enabled(context.Background(), "other", subject); err != nil || !enabled {
+		t.Errorf("expected flags missing from LaunchDarkly to fall through, got %v (%v)", enabled, err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	flags := New(Rules{"beta": {Tenants: []string{"acme"}}}, log.NewMockLogFactory(), mocktracer.New())
+	next := func(ctx context.Context, request interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+
+	ctx := context.WithValue(context.Background(), jwt.JWTClaimsContextKey, stdjwt.MapClaims{"sub": "alice"})
+	for tenantID, expected := range map[string]error{"acme": nil, "globex": ErrFeatureDisabled} {
+		_, err := flags.NewMiddleware("beta")(next)(tenant.WithID(ctx, tenantID), nil)
+		if err != expected {
+			t.Errorf("%s: expected %v, got %v", tenantID, expected, err)
+		}
+	}
+	if _, err := flags.NewMiddleware("missing")(next)(ctx, nil); err != ErrFeatureDisabled {
+		t.Errorf("expected unknown flags to be disabled, got %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package featureflag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// LaunchDarklyContext is the evaluation context passed to LaunchDarkly: a
+// user context keyed by the subject, with the tenant and claims as
+// attributes.
+type LaunchDarklyContext struct {
+	Kind       string
+	Key        string
+	Attributes map[string]interface{}
+}
+
+// LaunchDarklyClient evaluates boolean flags in LaunchDarkly. It keeps
+// the SDK out of this module: a service wraps its *ldclient.LDClient,
+// building an ldcontext.Context from the LaunchDarklyContext:
+//
+//	func (c ldAdapter) BoolVariation(flag string, lc featureflag.LaunchDarklyContext, def bool) (bool, error) {
+//		b := ldcontext.NewBuilder(lc.Key).Kind(ldcontext.Kind(lc.Kind))
+//		for k, v := range lc.Attributes {
+//			b.SetValue(k, ldvalue.CopyArbitraryValue(v))
+//		}
+//		return c.client.BoolVariation(flag, b.Build(), def)
+//	}
+type LaunchDarklyClient interface {
+	BoolVariation(flag string, context LaunchDarklyContext, defaultValue bool) (bool, error)
+}
+
+// ErrLaunchDarklyFlagNotFound is returned by LaunchDarklyClient
+// implementations for flags LaunchDarkly doesn't have, so Chain falls
+// through to the next provider.
+var ErrLaunchDarklyFlagNotFound = fmt.Errorf("%w in LaunchDarkly", ErrUnknownFlag)
+
+type launchDarklyProvider struct {
+	client LaunchDarklyClient
+}
+
+// NewLaunchDarklyProvider returns a Provider evaluating flags with
+// client. Subjects without a key are evaluated as their tenant.
+func NewLaunchDarklyProvider(client LaunchDarklyClient) Provider {
+	return &launchDarklyProvider{client: client}
+}
+
+func (p *launchDarklyProvider) Enabled(_ context.Context, flag string, subject Subject) (bool, error) {
+	lc := LaunchDarklyContext{Kind: "user", Key: subject.Key, Attributes: make(map[string]interface{}, len(subject.Claims)+1)}
+	if lc.Key == "" {
+		lc.Kind, lc.Key = "tenant", subject.Tenant
+	}
+	if lc.Key == "" {
+		return false, errors.New("launchdarkly: subject has no key or tenant")
+	}
+	for k, v := range subject.Claims {
+		lc.Attributes[k] = v
+	}
+	if subject.Tenant != "" {
+		lc.Attributes["tenant"] = subject.Tenant
+	}
+	return p.client.BoolVariation(flag, lc, false)
+}
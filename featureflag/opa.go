@@ -0,0 +1,48 @@
+package featureflag
+
+import (
+	"context"
+
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// opaInput is the input to flag policies.
+type opaInput struct {
+	Flag    string  `json:"flag"`
+	Subject Subject `json:"subject"`
+}
+
+type opaProvider struct {
+	query rego.PreparedEvalQuery
+}
+
+// NewOPAProvider returns a Provider evaluating query against policy, with
+// the flag and subject as input. Every flag is known to the policy; those
+// it doesn't enable are disabled.
+//
+//	package flags
+//
+//	default enabled = false
+//
+//	enabled {
+//		input.flag == "new-checkout"
+//		input.subject.claims.plan == "enterprise"
+//	}
+func NewOPAProvider(policy string, query string) (Provider, error) {
+	q, err := rego.New(
+		rego.Query(query),
+		rego.Module("flags.rego", policy),
+	).PrepareForEval(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &opaProvider{query: q}, nil
+}
+
+func (p *opaProvider) Enabled(ctx context.Context, flag string, subject Subject) (bool, error) {
+	results, err := p.query.Eval(ctx, rego.EvalInput(opaInput{Flag: flag, Subject: subject}))
+	if err != nil {
+		return false, err
+	}
+	return results.Allowed(), nil
+}
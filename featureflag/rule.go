@@ -0,0 +1,180 @@
+package featureflag
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/ghodss/yaml"
+)
+
+// Rule decides a flag for a subject. A flag is enabled when Enabled is
+// set, when the subject's key or tenant is listed, or when the subject
+// falls in the rollout Percentage.
+type Rule struct {
+	Enabled  bool     `json:"enabled"`
+	Subjects []string `json:"subjects,omitempty"`
+	Tenants  []string `json:"tenants,omitempty"`
+	// Percentage enables the flag for a stable share of subjects, by key
+	// or, for subjects without one, by tenant.
+	Percentage int `json:"percentage,omitempty"`
+}
+
+// Evaluate reports whether r enables flag for subject.
+func (r Rule) Evaluate(flag string, subject Subject) bool {
+	if r.Enabled {
+		return true
+	}
+	if subject.Key != "" && contains(r.Subjects, subject.Key) {
+		return true
+	}
+	if subject.Tenant != "" && contains(r.Tenants, subject.Tenant) {
+		return true
+	}
+	if r.Percentage > 0 {
+		key := subject.Key
+		if key == "" {
+			key = subject.Tenant
+		}
+		return key != "" && bucket(flag, key) < r.Percentage
+	}
+	return false
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// bucket places key in one of 100 buckets for flag. Buckets differ
+// between flags so the same subjects don't get every rollout first.
+func bucket(flag, key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(flag + ":" + key))
+	return int(h.Sum32() % 100)
+}
+
+// Rules is a Provider evaluating flags by their Rule.
+type Rules map[string]Rule
+
+// Enabled implements Provider.
+func (r Rules) Enabled(_ context.Context, flag string, subject Subject) (bool, error) {
+	rule, ok := r[flag]
+	if !ok {
+		return false, fmt.Errorf("%w: %s", ErrUnknownFlag, flag)
+	}
+	return rule.Evaluate(flag, subject), nil
+}
+
+type fileProvider struct {
+	path string
+
+	mu    sync.RWMutex
+	rules Rules
+}
+
+// NewFileProvider returns a Provider with the Rules in a JSON or YAML
+// file, keyed by flag:
+//
+//	new-checkout:
+//	  tenants: [acme]
+//	  percentage: 10
+//
+// Reloading the provider reads the file again.
+func NewFileProvider(path string) (Provider, error) {
+	p := &fileProvider{path: path}
+	if err := p.Reload(context.Background()); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *fileProvider) Enabled(ctx context.Context, flag string, subject Subject) (bool, error) {
+	p.mu.RLock()
+	rules := p.rules
+	p.mu.RUnlock()
+	return rules.Enabled(ctx, flag, subject)
+}
+
+// Reload reads the file again, keeping the current rules if it can't be
+// read or parsed.
+func (p *fileProvider) Reload(context.Context) error {
+	b, err := os.ReadFile(p.path)
+	if err != nil {
+		return err
+	}
+	var rules Rules
+	if err := yaml.Unmarshal(b, &rules); err != nil {
+		return fmt.Errorf("%s: %w", p.path, err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rules = rules
+	return nil
+}
+
+type envProvider struct {
+	prefix string
+	lookup func(string) (string, bool)
+}
+
+// NewEnvProvider returns a Provider reading flags from environment
+// variables, for switching features per deployment. Flag names are upper
+// cased, with anything other than letters and digits replaced by
+// underscores, and prefixed, so "new-checkout" with prefix "FEATURE_"
+// reads FEATURE_NEW_CHECKOUT. Values are booleans, percentages such as
+// "25%", or comma separated tenant IDs.
+func NewEnvProvider(prefix string) Provider {
+	return &envProvider{prefix: prefix, lookup: os.LookupEnv}
+}
+
+func (p *envProvider) Enabled(_ context.Context, flag string, subject Subject) (bool, error) {
+	v, ok := p.lookup(p.prefix + envName(flag))
+	if !ok {
+		return false, fmt.Errorf("%w: %s", ErrUnknownFlag, flag)
+	}
+	rule, err := parseEnvRule(v)
+	if err != nil {
+		return false, fmt.Errorf("%s%s: %w", p.prefix, envName(flag), err)
+	}
+	return rule.Evaluate(flag, subject), nil
+}
+
+func parseEnvRule(v string) (Rule, error) {
+	v = strings.TrimSpace(v)
+	if enabled, err := strconv.ParseBool(v); err == nil {
+		return Rule{Enabled: enabled}, nil
+	}
+	if p := strings.TrimSuffix(v, "%"); p != v {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || n > 100 {
+			return Rule{}, fmt.Errorf("invalid percentage %q", v)
+		}
+		return Rule{Percentage: n}, nil
+	}
+	var tenants []string
+	for _, t := range strings.Split(v, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tenants = append(tenants, t)
+		}
+	}
+	return Rule{Tenants: tenants}, nil
+}
+
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,56 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var errCheckPanicked = errors.New("check panicked")
+
+// Pinger is satisfied by *sql.DB, *sql.Conn and most database clients.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// PingCheck returns a Check that pings a database.
+func PingCheck(db Pinger) Check {
+	return db.PingContext
+}
+
+// HTTPCheck returns a Check that GETs url and expects a 2xx response.
+// A nil client uses http.DefaultClient.
+func HTTPCheck(client *http.Client, url string) Check {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("GET %s: unexpected status %d", url, resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// JWKSCheck returns a Check that the JWKS endpoint used by the jwt
+// Authenticator is reachable.
+func JWKSCheck(client *http.Client, jwksURL string) Check {
+	return HTTPCheck(client, jwksURL)
+}
+
+// OPACheck returns a Check against OPA's health API at baseURL, the same
+// base URL given to opa.NewOPAClient.
+func OPACheck(client *http.Client, baseURL string) Check {
+	return HTTPCheck(client, strings.TrimSuffix(baseURL, "/")+"/health")
+}
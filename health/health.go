@@ -0,0 +1,204 @@
+// Package health provides /livez, /readyz and /healthz handlers backed by
+// a registry of named checks.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds a check registered without a Timeout option.
+const DefaultTimeout = 2 * time.Second
+
+// Check reports whether a dependency is healthy by returning nil.
+// Checks should honour ctx, which carries the check's timeout.
+type Check func(ctx context.Context) error
+
+// Kind selects which endpoints a check contributes to.
+type Kind int
+
+const (
+	// Readiness checks gate /readyz, telling load balancers whether the
+	// service can take traffic. Dependencies belong here.
+	Readiness Kind = 1 << iota
+	// Liveness checks gate /livez, telling the orchestrator whether the
+	// process should be restarted. Keep these to in-process problems.
+	Liveness
+)
+
+// CheckOption configures a registered check.
+type CheckOption func(*check)
+
+// Timeout overrides DefaultTimeout for a check.
+func Timeout(d time.Duration) CheckOption {
+	return func(c *check) {
+		c.timeout = d
+	}
+}
+
+// Kinds overrides the endpoints a check contributes to; the default is
+// Readiness. /healthz always runs every check.
+func Kinds(k Kind) CheckOption {
+	return func(c *check) {
+		c.kinds = k
+	}
+}
+
+type check struct {
+	name    string
+	fn      Check
+	timeout time.Duration
+	kinds   Kind
+}
+
+// Registry holds the checks reported by the health handlers.
+type Registry struct {
+	mu       sync.RWMutex
+	checks   []*check
+	draining bool
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a named check, replacing any existing check of that name.
+func (r *Registry) Register(name string, fn Check, opts ...CheckOption) {
+	c := &check{name: name, fn: fn, timeout: DefaultTimeout, kinds: Readiness}
+	for _, opt := range opts {
+		opt(c)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, existing := range r.checks {
+		if existing.name == name {
+			r.checks[i] = c
+			return
+		}
+	}
+	r.checks = append(r.checks, c)
+}
+
+// SetDraining marks the service as shutting down, which fails /readyz so
+// load balancers stop routing new requests while in-flight ones finish.
+func (r *Registry) SetDraining(draining bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.draining = draining
+}
+
+// Status values reported in Report and CheckResult.
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// CheckResult is the outcome of a single check.
+type CheckResult struct {
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// Report is the JSON body written by the health handlers.
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Run runs the checks of the given kinds concurrently, each bounded by
+// its timeout. A zero kind runs every check.
+func (r *Registry) Run(ctx context.Context, kinds Kind) Report {
+	r.mu.RLock()
+	var checks []*check
+	for _, c := range r.checks {
+		if kinds == 0 || c.kinds&kinds != 0 {
+			checks = append(checks, c)
+		}
+	}
+	draining := r.draining
+	r.mu.RUnlock()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(checks))}
+	if draining && kinds&Readiness != 0 {
+		report.Status = StatusFail
+		report.Checks["draining"] = CheckResult{Status: StatusFail, Error: "service is shutting down"}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c *check) {
+			defer wg.Done()
+			result := runCheck(ctx, c)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[c.name] = result
+			if result.Status != StatusOK {
+				report.Status = StatusFail
+			}
+		}(c)
+	}
+	wg.Wait()
+	return report
+}
+
+func runCheck(ctx context.Context, c *check) (result CheckResult) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	errc := make(chan error, 1)
+	go func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				errc <- errCheckPanicked
+			}
+		}()
+		errc <- c.fn(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		// The check ignored its context; report it rather than waiting
+		err = ctx.Err()
+	}
+	result.DurationMS = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+		return result
+	}
+	result.Status = StatusOK
+	return result
+}
+
+// Handler returns an http.Handler that runs the checks of the given kinds
+// and writes a JSON Report, with a 200 status if all pass and 503 if not.
+func (r *Registry) Handler(kinds Kind) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		report := r.Run(req.Context(), kinds)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		if report.Status != StatusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+}
+
+// Mount registers /livez, /readyz and /healthz on mux.
+func (r *Registry) Mount(mux interface {
+	Handle(pattern string, handler http.Handler)
+}) {
+	mux.Handle("/livez", r.Handler(Liveness))
+	mux.Handle("/readyz", r.Handler(Readiness))
+	mux.Handle("/healthz", r.Handler(0))
+}
@@ -0,0 +1,76 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.Register("process", func(ctx context.Context) error { return nil }, Kinds(Liveness|Readiness))
+	r.Register("db", func(ctx context.Context) error { return errors.New("connection refused") })
+
+	w := httptest.NewRecorder()
+	r.Handler(Liveness).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("livez should pass; got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.Handler(Readiness).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("readyz should fail; got %d", w.Code)
+	}
+	var report Report
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Checks["db"].Error != "connection refused" || report.Checks["process"].Status != StatusOK {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+	r := NewRegistry()
+	r.Register("slow", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}, Timeout(10*time.Millisecond))
+
+	report := r.Run(context.Background(), 0)
+	if report.Status != StatusFail || report.Checks["slow"].Error != context.DeadlineExceeded.Error() {
+		t.Errorf("slow check should time out; got %+v", report)
+	}
+}
+
+func TestDraining(t *testing.T) {
+	r := NewRegistry()
+	r.SetDraining(true)
+	if report := r.Run(context.Background(), Readiness); report.Status != StatusFail {
+		t.Error("readiness should fail while draining")
+	}
+	if report := r.Run(context.Background(), Liveness); report.Status != StatusOK {
+		t.Error("liveness should pass while draining")
+	}
+}
+
+func TestHTTPCheck(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	if err := OPACheck(srv.Client(), srv.URL+"/")(context.Background()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := HTTPCheck(srv.Client(), srv.URL+"/missing")(context.Background()); err == nil {
+		t.Error("expected an error for a 404")
+	}
+}
@@ -0,0 +1,158 @@
+package httpclient
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jdotw/go-utils/log"
+	"go.uber.org/zap"
+)
+
+// ErrCircuitOpen is returned for requests to a host whose circuit is
+// open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// BreakerConfig configures the circuit breaker. Its tags allow loading it
+// with the config package.
+type BreakerConfig struct {
+	// Failures is the number of consecutive failures that opens the
+	// circuit to a host.
+	Failures int `json:"failures" default:"5" validate:"min=1"`
+	// OpenTimeout is how long the circuit stays open before a trial
+	// request is let through.
+	OpenTimeout time.Duration `json:"open_timeout" default:"30s"`
+}
+
+// DefaultBreakerConfig returns the config with the defaults in its tags.
+func DefaultBreakerConfig() BreakerConfig {
+	return BreakerConfig{
+		Failures:    5,
+		OpenTimeout: 30 * time.Second,
+	}
+}
+
+type breakerState int
+
+const (
+	closed breakerState = iota
+	open
+	halfOpen
+)
+
+// breaker is the circuit to one host. Connection errors and 5xx
+// responses count as failures.
+type breaker struct {
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+// allow reports whether a request may be sent. Once the open timeout has
+// passed a single trial request is allowed, whose outcome closes or
+// reopens the circuit.
+func (b *breaker) allow(cfg BreakerConfig, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case open:
+		if now.Sub(b.openedAt) < cfg.OpenTimeout {
+			return false
+		}
+		b.state = halfOpen
+		return true
+	case halfOpen:
+		return false
+	}
+	return true
+}
+
+// release gives up a trial request whose outcome is unknown, so the next
+// request can be the trial instead.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == halfOpen {
+		b.state = open
+	}
+}
+
+// record records the outcome of a request, reporting whether it changed
+// the state of the circuit.
+func (b *breaker) record(cfg BreakerConfig, success bool, now time.Time) (changed bool, state breakerState) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	before := b.state
+	if success {
+		b.state = closed
+		b.failures = 0
+	} else {
+		b.failures++
+		if b.state == halfOpen || b.failures >= cfg.Failures {
+			b.state = open
+			b.openedAt = now
+		}
+	}
+	return b.state != before, b.state
+}
+
+// breakerTransport keeps a circuit per host.
+type breakerTransport struct {
+	next   http.RoundTripper
+	name   string
+	cfg    BreakerConfig
+	logger log.Factory
+	now    func() time.Time
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+func newBreakerTransport(next http.RoundTripper, name string, cfg BreakerConfig, logger log.Factory) *breakerTransport {
+	return &breakerTransport{
+		next:     next,
+		name:     name,
+		cfg:      cfg,
+		logger:   logger,
+		now:      time.Now,
+		breakers: map[string]*breaker{},
+	}
+}
+
+func (t *breakerTransport) breaker(host string) *breaker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.breakers[host]
+	if !ok {
+		b = &breaker{}
+		t.breakers[host] = b
+	}
+	return b
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b := t.breaker(req.URL.Host)
+	if !b.allow(t.cfg, t.now()) {
+		closeBody(req)
+		return nil, ErrCircuitOpen
+	}
+	resp, err := t.next.RoundTrip(req)
+	// Cancellation says nothing about the health of the host
+	if err != nil && req.Context().Err() != nil {
+		b.release()
+		return nil, err
+	}
+	success := err == nil && resp.StatusCode < http.StatusInternalServerError
+	if changed, state := b.record(t.cfg, success, t.now()); changed {
+		fields := []zap.Field{zap.String("client", t.name), zap.String("host", req.URL.Host)}
+		switch state {
+		case open:
+			log.Warn(t.logger.For(req.Context()), "Circuit breaker opened", fields...)
+		case closed:
+			t.logger.For(req.Context()).Info("Circuit breaker closed", fields...)
+		}
+	}
+	return resp, err
+}
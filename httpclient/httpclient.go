@@ -0,0 +1,182 @@
+// Package httpclient builds *http.Client instances for calls to other
+// services. Each client traces its requests, forwards the request ID,
+// records request metrics, and can retry failures, break the circuit to
+// a failing host and attach bearer tokens, either forwarded from the
+// incoming request or obtained with client credentials.
+//
+//	client := httpclient.New("inventory", logger, tracer,
+//		httpclient.Retry(retry.DefaultPolicy()),
+//		httpclient.Breaker(httpclient.DefaultBreakerConfig()),
+//		httpclient.ForwardToken(jwt.TokenFromContext),
+//		httpclient.Metrics(prometheus.DefaultRegisterer),
+//	)
+package httpclient
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/retry"
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Config sizes the client's connection pools and timeouts. Its tags
+// allow loading it with the config package.
+type Config struct {
+	// Timeout limits each call, including retries.
+	Timeout time.Duration `json:"timeout" default:"30s"`
+	// DialTimeout limits establishing a connection.
+	DialTimeout time.Duration `json:"dial_timeout" default:"5s"`
+	// MaxIdleConnsPerHost is the number of idle connections kept open to
+	// each host.
+	MaxIdleConnsPerHost int `json:"max_idle_conns_per_host" default:"16" validate:"min=0"`
+	// MaxConnsPerHost caps the connections to each host. Zero means no
+	// limit.
+	MaxConnsPerHost int `json:"max_conns_per_host" default:"0" validate:"min=0"`
+	// IdleConnTimeout closes idle connections after this long.
+	IdleConnTimeout time.Duration `json:"idle_conn_timeout" default:"90s"`
+}
+
+// DefaultConfig returns the config with the defaults in its tags.
+func DefaultConfig() Config {
+	return Config{
+		Timeout:             30 * time.Second,
+		DialTimeout:         5 * time.Second,
+		MaxIdleConnsPerHost: 16,
+		IdleConnTimeout:     90 * time.Second,
+	}
+}
+
+// Option configures New.
+type Option func(*options)
+
+type options struct {
+	config      Config
+	base        http.RoundTripper
+	retry       *retry.Policy
+	retryOpts   []retry.Option
+	breaker     *BreakerConfig
+	registerer  prometheus.Registerer
+	tokens      TokenSource
+	checkStatus bool
+}
+
+// WithConfig sets the pool sizes and timeouts, which default to
+// DefaultConfig.
+func WithConfig(cfg Config) Option {
+	return func(o *options) {
+		o.config = cfg
+	}
+}
+
+// WithTransport sends requests with base instead of a pooled
+// http.Transport built from the Config.
+func WithTransport(base http.RoundTripper) Option {
+	return func(o *options) {
+		o.base = base
+	}
+}
+
+// Retry retries failed requests by policy. Only idempotent requests, and
+// requests with an Idempotency-Key header, are retried; connection errors
+// and 408, 429 and 5xx gateway responses are retried by default.
+func Retry(policy retry.Policy, opts ...retry.Option) Option {
+	return func(o *options) {
+		o.retry = &policy
+		o.retryOpts = opts
+	}
+}
+
+// Breaker stops sending requests to a host after repeated failures, as
+// configured by cfg, failing them with ErrCircuitOpen instead.
+func Breaker(cfg BreakerConfig) Option {
+	return func(o *options) {
+		o.breaker = &cfg
+	}
+}
+
+// Metrics records request counts and latencies with registerer.
+func Metrics(registerer prometheus.Registerer) Option {
+	return func(o *options) {
+		o.registerer = registerer
+	}
+}
+
+// BearerToken sets the Authorization header of requests that don't have
+// one to a bearer token from src.
+func BearerToken(src TokenSource) Option {
+	return func(o *options) {
+		o.tokens = src
+	}
+}
+
+// ForwardToken sets the Authorization header to the bearer token returned
+// by from, such as jwt.TokenFromContext, so calls made while handling a
+// request act on behalf of its caller.
+func ForwardToken(from func(ctx context.Context) string) Option {
+	return BearerToken(TokenFunc(func(ctx context.Context) (string, error) {
+		return from(ctx), nil
+	}))
+}
+
+// CheckStatus makes responses with a 4xx or 5xx status fail with a
+// *StatusError, closing their body, instead of being returned.
+func CheckStatus() Option {
+	return func(o *options) {
+		o.checkStatus = true
+	}
+}
+
+// New returns a client for calls to the service called name, which
+// labels its spans, logs and metrics.
+func New(name string, logger log.Factory, tracer opentracing.Tracer, opts ...Option) *http.Client {
+	o := options{config: DefaultConfig()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	rt := o.base
+	if rt == nil {
+		rt = newTransport(o.config)
+	}
+	if o.registerer != nil {
+		rt = newMetricsTransport(rt, name, o.registerer)
+	}
+	if o.breaker != nil {
+		rt = newBreakerTransport(rt, name, *o.breaker, logger)
+	}
+	if o.retry != nil {
+		rt = newRetryTransport(rt, *o.retry, o.retryOpts, logger)
+	}
+	if o.checkStatus {
+		rt = statusTransport{next: rt}
+	}
+	rt = tracingTransport{next: rt, name: name, tracer: tracer}
+	rt = headerTransport{next: rt, tokens: o.tokens}
+
+	return &http.Client{
+		Transport: rt,
+		Timeout:   o.config.Timeout,
+	}
+}
+
+func newTransport(cfg Config) *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   cfg.DialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          0,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
@@ -0,0 +1,199 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jdotw/go-utils/correlation"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/retry"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var fastRetry = retry.Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, Multiplier: 1}
+
+func TestRetry(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	c := New("test", log.NewMockLogFactory(), opentracing.NoopTracer{}, Retry(fastRetry))
+	req, _ := http.NewRequest(http.MethodPut, srv.URL, strings.NewReader("payload"))
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); resp.StatusCode != http.StatusOK || string(body) != "payload" {
+		t.Errorf("expected the body to be resent, got %d %q", resp.StatusCode, body)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
+
+	// Non-idempotent requests are sent once, and the last response is
+	// returned when retries run out
+	atomic.StoreInt32(&calls, -10)
+	resp, err = c.Post(srv.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || calls != -9 {
+		t.Errorf("expected a single 503, got %d after %d calls", resp.StatusCode, calls+10)
+	}
+}
+
+func TestCheckStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	c := New("test", log.NewMockLogFactory(), opentracing.NoopTracer{}, CheckStatus())
+	_, err := c.Get(srv.URL)
+	var se *StatusError
+	if !errors.As(err, &se) || se.StatusCode() != http.StatusNotFound {
+		t.Errorf("expected a 404 StatusError, got %v", err)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	c := New("test", log.NewMockLogFactory(), opentracing.NoopTracer{}, Breaker(BreakerConfig{Failures: 2, OpenTimeout: time.Hour}))
+	for i := 0; i < 2; i++ {
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+	if _, err := c.Get(srv.URL); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected the open circuit to stop requests, got %d calls", calls)
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	cfg := BreakerConfig{Failures: 1, OpenTimeout: time.Minute}
+	now := time.Now()
+	var b breaker
+	b.record(cfg, false, now)
+	if b.allow(cfg, now.Add(time.Second)) {
+		t.Error("open circuit should reject requests")
+	}
+	if !b.allow(cfg, now.Add(2*time.Minute)) {
+		t.Error("circuit should allow a trial request after the timeout")
+	}
+	if b.allow(cfg, now.Add(2*time.Minute)) {
+		t.Error("circuit should allow only one trial request")
+	}
+	b.record(cfg, true, now.Add(2*time.Minute))
+	if !b.allow(cfg, now.Add(2*time.Minute)) {
+		t.Error("successful trial should close the circuit")
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	var auth, requestID, traceHeader string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		requestID = r.Header.Get(correlation.HeaderName)
+		traceHeader = r.Header.Get("Mockpfx-Ids-Traceid")
+	}))
+	defer srv.Close()
+
+	tracer := mocktracer.New()
+	c := New("test", log.NewMockLogFactory(), tracer, ForwardToken(func(ctx context.Context) string { return "token" }))
+
+	parent := tracer.StartSpan("parent")
+	ctx := opentracing.ContextWithSpan(correlation.WithRequestID(context.Background(), "req-1"), parent)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if auth != "Bearer token" {
+		t.Errorf("unexpected Authorization header %q", auth)
+	}
+	if requestID != "req-1" {
+		t.Errorf("unexpected request ID %q", requestID)
+	}
+	if traceHeader == "" {
+		t.Error("expected the span to be injected")
+	}
+	spans := tracer.FinishedSpans()
+	if len(spans) != 1 || spans[0].ParentID != parent.Context().(mocktracer.MockSpanContext).SpanID {
+		t.Errorf("expected a client span under the parent, got %v", spans)
+	}
+	if req.Header.Get("Authorization") != "" {
+		t.Error("the caller's request should not be modified")
+	}
+}
+
+func TestClientCredentials(t *testing.T) {
+	var issued int32
+	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, _ := r.BasicAuth(); id != "client" || secret != "secret" || r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		atomic.AddInt32(&issued, 1)
+		w.Write([]byte(`{"access_token":"issued","expires_in":3600}`))
+	}))
+	defer tokenSrv.Close()
+
+	src := NewClientCredentials(ClientCredentialsConfig{TokenURL: tokenSrv.URL, ClientID: "client", ClientSecret: "secret"}, nil)
+	for i := 0; i < 2; i++ {
+		token, err := src.Token(context.Background())
+		if err != nil || token != "issued" {
+			t.Fatalf("unexpected token %q, %v", token, err)
+		}
+	}
+	if issued != 1 {
+		t.Errorf("expected the token to be cached, got %d issued", issued)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	reg := prometheus.NewRegistry()
+	c := New("test", log.NewMockLogFactory(), opentracing.NoopTracer{}, Metrics(reg))
+	resp, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if n, err := testutil.GatherAndCount(reg, "http_client_requests_total", "http_client_request_duration_seconds"); err != nil || n != 2 {
+		t.Errorf("expected 2 series, got %d, %v", n, err)
+	}
+}
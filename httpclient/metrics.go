@@ -0,0 +1,47 @@
+package httpclient
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jdotw/go-utils/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricsTransport records each attempt by client, host, method and
+// status code, with "error" as the code of failed attempts.
+type metricsTransport struct {
+	next     http.RoundTripper
+	name     string
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+func newMetricsTransport(next http.RoundTripper, name string, registerer prometheus.Registerer) metricsTransport {
+	return metricsTransport{
+		next: next,
+		name: name,
+		requests: metrics.MustRegister(registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_client_requests_total",
+			Help: "Number of outgoing HTTP requests, by client, host, method and status code.",
+		}, []string{"client", "host", "method", "code"})),
+		duration: metrics.MustRegister(registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_client_request_duration_seconds",
+			Help:    "Time taken by outgoing HTTP requests, by client, host and method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"client", "host", "method"})),
+	}
+}
+
+func (t metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	t.requests.WithLabelValues(t.name, req.URL.Host, req.Method, code).Inc()
+	t.duration.WithLabelValues(t.name, req.URL.Host, req.Method).Observe(time.Since(start).Seconds())
+	return resp, err
+}
@@ -0,0 +1,103 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenSource provides bearer tokens for outgoing requests. An empty
+// token sends the request without one.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// TokenFunc adapts a function to a TokenSource.
+type TokenFunc func(ctx context.Context) (string, error)
+
+// Token calls f.
+func (f TokenFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// ClientCredentialsConfig configures an OAuth2 client credentials grant.
+// Its tags allow loading it with the config package.
+type ClientCredentialsConfig struct {
+	TokenURL     string   `json:"token_url" env:"OAUTH_TOKEN_URL" validate:"required,url"`
+	ClientID     string   `json:"client_id" env:"OAUTH_CLIENT_ID" validate:"required"`
+	ClientSecret string   `json:"client_secret" env:"OAUTH_CLIENT_SECRET" validate:"required"`
+	Scopes       []string `json:"scopes"`
+	Audience     string   `json:"audience" env:"OAUTH_AUDIENCE"`
+}
+
+// expiryMargin renews tokens this long before they expire.
+const expiryMargin = 30 * time.Second
+
+type clientCredentials struct {
+	cfg    ClientCredentialsConfig
+	client *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewClientCredentials returns a TokenSource obtaining tokens with the
+// client credentials grant, for calls made by the service itself rather
+// than on behalf of a user. Tokens are cached until shortly before they
+// expire. A nil client uses http.DefaultClient.
+func NewClientCredentials(cfg ClientCredentialsConfig, client *http.Client) TokenSource {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &clientCredentials{cfg: cfg, client: client}
+}
+
+func (c *clientCredentials) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.cfg.Scopes, " "))
+	}
+	if c.cfg.Audience != "" {
+		form.Set("audience", c.cfg.Audience)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("client credentials: %w", newStatusError(req, resp))
+	}
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("client credentials: %w", err)
+	}
+	if body.AccessToken == "" {
+		return "", fmt.Errorf("client credentials: no access token in response")
+	}
+	c.token = body.AccessToken
+	c.expires = time.Now().Add(time.Duration(body.ExpiresIn)*time.Second - expiryMargin)
+	return c.token, nil
+}
@@ -0,0 +1,222 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jdotw/go-utils/correlation"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/retry"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"go.uber.org/zap"
+)
+
+// StatusError is returned for responses with an error status when
+// CheckStatus is set.
+type StatusError struct {
+	Method string
+	URL    string
+	Status int
+	// Retry is the wait requested by a Retry-After header, if any.
+	Retry time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s %s: unexpected status %d", e.Method, e.URL, e.Status)
+}
+
+// StatusCode reports the response status, so retry classification and
+// error encoding treat it like any other HTTP failure.
+func (e *StatusError) StatusCode() int {
+	return e.Status
+}
+
+// RetryAfter reports the wait requested by the server.
+func (e *StatusError) RetryAfter() time.Duration {
+	return e.Retry
+}
+
+func newStatusError(req *http.Request, resp *http.Response) *StatusError {
+	e := &StatusError{Method: req.Method, URL: req.URL.Redacted(), Status: resp.StatusCode}
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+		e.Retry = time.Duration(secs) * time.Second
+	}
+	return e
+}
+
+// discard drains and closes a response body so its connection can be
+// reused.
+func discard(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+}
+
+// headerTransport sets the request ID and bearer token headers.
+type headerTransport struct {
+	next   http.RoundTripper
+	tokens TokenSource
+}
+
+func (t headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	req = req.Clone(ctx)
+	if id := correlation.FromContext(ctx); id != "" && req.Header.Get(correlation.HeaderName) == "" {
+		req.Header.Set(correlation.HeaderName, id)
+	}
+	if t.tokens != nil && req.Header.Get("Authorization") == "" {
+		token, err := t.tokens.Token(ctx)
+		if err != nil {
+			closeBody(req)
+			return nil, err
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+	return t.next.RoundTrip(req)
+}
+
+// closeBody closes the request body, which a RoundTripper must do even
+// when it fails.
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+// tracingTransport wraps each call, including its retries, in a client
+// span and injects it into the request headers.
+type tracingTransport struct {
+	next   http.RoundTripper
+	name   string
+	tracer opentracing.Tracer
+}
+
+func (t tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	opts := []opentracing.StartSpanOption{ext.SpanKindRPCClient}
+	if parent := opentracing.SpanFromContext(req.Context()); parent != nil {
+		opts = append(opts, opentracing.ChildOf(parent.Context()))
+	}
+	span := t.tracer.StartSpan("HTTP "+req.Method, opts...)
+	defer span.Finish()
+	ext.Component.Set(span, "httpclient")
+	ext.PeerService.Set(span, t.name)
+	ext.HTTPMethod.Set(span, req.Method)
+	ext.HTTPUrl.Set(span, req.URL.Redacted())
+
+	req = req.Clone(opentracing.ContextWithSpan(req.Context(), span))
+	t.tracer.Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(req.Header))
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(otlog.Error(err))
+		return nil, err
+	}
+	ext.HTTPStatusCode.Set(span, uint16(resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		ext.Error.Set(span, true)
+	}
+	return resp, nil
+}
+
+// statusTransport fails responses with an error status.
+type statusTransport struct {
+	next http.RoundTripper
+}
+
+func (t statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		discard(resp)
+		return nil, newStatusError(req, resp)
+	}
+	return resp, nil
+}
+
+// retryTransport retries idempotent requests by policy.
+type retryTransport struct {
+	next   http.RoundTripper
+	policy retry.Policy
+	opts   []retry.Option
+}
+
+func newRetryTransport(next http.RoundTripper, policy retry.Policy, opts []retry.Option, logger log.Factory) http.RoundTripper {
+	opts = append([]retry.Option{retry.OnRetry(func(ctx context.Context, attempt int, err error, wait time.Duration) {
+		log.Warn(logger.For(ctx), "Retrying failed request", zap.Int("attempt", attempt), zap.Duration("wait", wait), zap.Error(err))
+	})}, opts...)
+	return retryTransport{next: next, policy: policy, opts: opts}
+}
+
+// idempotent reports whether req can safely be sent more than once.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// retryableResponse carries a response with a retryable status through
+// retry.Do, so the last one can be returned to the caller.
+type retryableResponse struct {
+	*StatusError
+	resp *http.Response
+}
+
+func (t retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !idempotent(req) || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		return t.next.RoundTrip(req)
+	}
+
+	var resp *http.Response
+	attempt := 0
+	err := retry.Do(req.Context(), t.policy, func(ctx context.Context) error {
+		attempt++
+		if resp != nil {
+			discard(resp)
+			resp = nil
+		}
+		r := req
+		if attempt > 1 && req.Body != nil && req.Body != http.NoBody {
+			body, err := req.GetBody()
+			if err != nil {
+				return retry.Permanent(err)
+			}
+			r = req.Clone(ctx)
+			r.Body = body
+		}
+		var err error
+		resp, err = t.next.RoundTrip(r)
+		if err != nil {
+			if errors.Is(err, ErrCircuitOpen) {
+				return retry.Permanent(err)
+			}
+			return err
+		}
+		if retry.RetryableStatus(resp.StatusCode) {
+			return &retryableResponse{StatusError: newStatusError(r, resp), resp: resp}
+		}
+		return nil
+	}, t.opts...)
+
+	var rr *retryableResponse
+	if errors.As(err, &rr) {
+		// Out of attempts: return the last response as the server sent it
+		return rr.resp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,112 @@
+// Package identity stores who a request is for in its context: the user,
+// their tenant and roles, and the request ID. The authn, tenant and
+// correlation middleware set these values; logging, authorization input
+// and database tenant scoping read them, so services don't need context
+// keys of their own.
+package identity
+
+import "context"
+
+type contextKey string
+
+const (
+	// UserIDContextKey holds the key used to store the user ID in the context.
+	UserIDContextKey contextKey = "UserID"
+	// TenantIDContextKey holds the key used to store the tenant ID in the context.
+	TenantIDContextKey contextKey = "TenantID"
+	// RolesContextKey holds the key used to store the roles in the context.
+	RolesContextKey contextKey = "Roles"
+	// RequestIDContextKey holds the key used to store the request ID in the context.
+	RequestIDContextKey contextKey = "RequestID"
+)
+
+// Identity is the identity of a request.
+type Identity struct {
+	UserID    string   `json:"user_id,omitempty"`
+	TenantID  string   `json:"tenant_id,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	RequestID string   `json:"request_id,omitempty"`
+}
+
+// FromContext returns the identity stored in ctx. Missing values are
+// empty.
+func FromContext(ctx context.Context) Identity {
+	return Identity{
+		UserID:    UserID(ctx),
+		TenantID:  TenantID(ctx),
+		Roles:     Roles(ctx),
+		RequestID: RequestID(ctx),
+	}
+}
+
+// WithIdentity returns a copy of ctx carrying the non-empty values of id.
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	if id.UserID != "" {
+		ctx = WithUserID(ctx, id.UserID)
+	}
+	if id.TenantID != "" {
+		ctx = WithTenantID(ctx, id.TenantID)
+	}
+	if id.Roles != nil {
+		ctx = WithRoles(ctx, id.Roles)
+	}
+	if id.RequestID != "" {
+		ctx = WithRequestID(ctx, id.RequestID)
+	}
+	return ctx
+}
+
+// WithUserID returns a copy of ctx carrying the user ID.
+func WithUserID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, UserIDContextKey, id)
+}
+
+// UserID returns the user ID stored in ctx, or an empty string.
+func UserID(ctx context.Context) string {
+	id, _ := ctx.Value(UserIDContextKey).(string)
+	return id
+}
+
+// WithTenantID returns a copy of ctx carrying the tenant ID.
+func WithTenantID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, TenantIDContextKey, id)
+}
+
+// TenantID returns the tenant ID stored in ctx, or an empty string.
+func TenantID(ctx context.Context) string {
+	id, _ := ctx.Value(TenantIDContextKey).(string)
+	return id
+}
+
+// WithRoles returns a copy of ctx carrying the roles.
+func WithRoles(ctx context.Context, roles []string) context.Context {
+	return context.WithValue(ctx, RolesContextKey, roles)
+}
+
+// Roles returns the roles stored in ctx, or nil.
+func Roles(ctx context.Context) []string {
+	roles, _ := ctx.Value(RolesContextKey).([]string)
+	return roles
+}
+
+// HasRole reports whether the roles stored in ctx include role.
+func HasRole(ctx context.Context, role string) bool {
+	for _, r := range Roles(ctx) {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID. Use
+// correlation.WithRequestID to also tag the active span.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, RequestIDContextKey, id)
+}
+
+// RequestID returns the request ID stored in ctx, or an empty string.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(RequestIDContextKey).(string)
+	return id
+}
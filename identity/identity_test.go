@@ -0,0 +1,31 @@
+package identity
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestIdentityRoundTrip(t *testing.T) {
+	want := Identity{UserID: "user-1", TenantID: "tenant-1", Roles: []string{"admin", "reader"}, RequestID: "req-1"}
+	ctx := WithIdentity(context.Background(), want)
+	if have := FromContext(ctx); !reflect.DeepEqual(have, want) {
+		t.Errorf("unexpected identity; expected %+v, got %+v", want, have)
+	}
+	if !HasRole(ctx, "admin") {
+		t.Error("HasRole should report a stored role")
+	}
+	if HasRole(ctx, "writer") {
+		t.Error("HasRole should not report a missing role")
+	}
+}
+
+func TestEmptyContext(t *testing.T) {
+	ctx := context.Background()
+	if have := FromContext(ctx); !reflect.DeepEqual(have, Identity{}) {
+		t.Errorf("expected an empty identity, got %+v", have)
+	}
+	if HasRole(ctx, "admin") {
+		t.Error("HasRole should be false without roles")
+	}
+}
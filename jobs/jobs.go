@@ -0,0 +1,189 @@
+// Package jobs implements the asynchronous request pattern for
+// long-running operations. Instead of holding the request open, the
+// endpoint starts a job on a worker pool and responds 202 Accepted with
+// the job and its Location. Clients poll the job's status until it has
+// succeeded or failed:
+//
+//	runner := jobs.NewRunner(jobs.NewGormStore(db), pool, logger)
+//
+//	func makeExportEndpoint(runner *jobs.Runner) endpoint.Endpoint {
+//		return func(ctx context.Context, request interface{}) (interface{}, error) {
+//			req := request.(ExportRequest)
+//			return runner.Accept(ctx, "export", func(ctx context.Context) (interface{}, error) {
+//				return export(ctx, req)
+//			})
+//		}
+//	}
+//
+//	router.Handle(http.MethodGet, "/jobs/{id}", jobs.NewStatusHandler(
+//		endpoint.Chain(authn, authz)(jobs.MakeStatusEndpoint(store))))
+//
+// Jobs run on the pool, so they are lost if the process stops before
+// they finish; they stay Pending or Running and clients should give up
+// polling eventually.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jdotw/go-utils/errorsx"
+	"github.com/jdotw/go-utils/identity"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/model"
+	"github.com/jdotw/go-utils/worker"
+	"go.uber.org/zap"
+)
+
+// Func is the work of a job. Its result is JSON encoded as the job's
+// result.
+type Func func(ctx context.Context) (result interface{}, err error)
+
+// Option configures a Runner.
+type Option func(*options)
+
+type options struct {
+	basePath     string
+	pollInterval time.Duration
+}
+
+// BasePath is the path of the job status endpoint, to which the job ID
+// is appended for the Location header. It defaults to "/jobs".
+func BasePath(path string) Option {
+	return func(o *options) { o.basePath = strings.TrimSuffix(path, "/") }
+}
+
+// PollInterval is sent as the Retry-After of accepted and unfinished
+// jobs, suggesting how often clients poll. It defaults to a second.
+func PollInterval(interval time.Duration) Option {
+	return func(o *options) { o.pollInterval = interval }
+}
+
+// Runner starts jobs on a worker pool, recording their progress in a
+// Store.
+type Runner struct {
+	store  Store
+	pool   *worker.Pool
+	logger log.Factory
+	opts   options
+	now    func() time.Time
+}
+
+// NewRunner returns a Runner running jobs on pool.
+func NewRunner(store Store, pool *worker.Pool, logger log.Factory, opts ...Option) *Runner {
+	o := options{basePath: "/jobs", pollInterval: time.Second}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Runner{store: store, pool: pool, logger: logger, opts: o, now: time.Now}
+}
+
+// Start saves a Pending job of type jobType, owned by the user and
+// tenant of ctx, and submits fn to the pool, waiting for room in its
+// queue until ctx is done. If the job cannot be
+// queued it is marked Failed and the error returned. The job returned is
+// as it was saved; the worker updates its own copy, so poll the Store
+// for progress.
+func (r *Runner) Start(ctx context.Context, jobType string, fn Func) (*Job, error) {
+	job := &Job{
+		ID:       model.NewUUIDv7(),
+		Type:     jobType,
+		Status:   Pending,
+		OwnerID:  identity.UserID(ctx),
+		TenantID: identity.TenantID(ctx),
+	}
+	if err := r.store.Create(ctx, job); err != nil {
+		return nil, err
+	}
+	// The worker gets its own copy, as the caller reads and encodes job
+	// while it runs
+	running := *job
+	err := r.pool.Submit(ctx, func(ctx context.Context) error {
+		return r.run(ctx, &running, fn)
+	})
+	if err != nil {
+		r.fail(ctx, job, err)
+		return nil, err
+	}
+	return job, nil
+}
+
+// Accept starts a job as Start does, returning the 202 Accepted
+// response for it.
+func (r *Runner) Accept(ctx context.Context, jobType string, fn Func) (*AcceptedResponse, error) {
+	job, err := r.Start(ctx, jobType, fn)
+	if err != nil {
+		return nil, err
+	}
+	return &AcceptedResponse{Job: job, location: r.opts.basePath + "/" + job.ID, retryAfter: r.opts.pollInterval}, nil
+}
+
+// run runs fn for job on a worker, saving its progress. The returned
+// error is fn's, so the pool logs and counts the failure.
+func (r *Runner) run(ctx context.Context, job *Job, fn Func) error {
+	job.Status = Running
+	if err := r.store.Update(ctx, job); err != nil {
+		return err
+	}
+	result, err := fn(ctx)
+	if err != nil {
+		r.fail(ctx, job, err)
+		return err
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		r.fail(ctx, job, err)
+		return err
+	}
+	now := r.now()
+	job.Status = Succeeded
+	job.Result = model.NewJSONB(json.RawMessage(b))
+	job.CompletedAt = &now
+	if err := r.store.Update(ctx, job); err != nil {
+		log.FromContextOr(ctx, r.logger).Error("Failed to save job result", zap.String("job_id", job.ID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (r *Runner) fail(ctx context.Context, job *Job, err error) {
+	now := r.now()
+	job.Status = Failed
+	job.Error = errorsx.Message(err)
+	job.ErrorCode = errorsx.CodeOf(err)
+	job.CompletedAt = &now
+	if err := r.store.Update(ctx, job); err != nil {
+		log.FromContextOr(ctx, r.logger).Error("Failed to save job failure", zap.String("job_id", job.ID), zap.Error(err))
+	}
+}
+
+// AcceptedResponse is the 202 Accepted response for a started job,
+// with the job as its body and the job's status endpoint as its
+// Location.
+type AcceptedResponse struct {
+	*Job
+	location   string
+	retryAfter time.Duration
+}
+
+// StatusCode implements go-kit's StatusCoder.
+func (r *AcceptedResponse) StatusCode() int {
+	return http.StatusAccepted
+}
+
+// Headers implements go-kit's Headerer.
+func (r *AcceptedResponse) Headers() http.Header {
+	h := http.Header{"Location": []string{r.location}}
+	setRetryAfter(h, r.retryAfter)
+	return h
+}
+
+func setRetryAfter(h http.Header, d time.Duration) {
+	if secs := int((d + time.Second - 1) / time.Second); secs > 0 {
+		h.Set("Retry-After", strconv.Itoa(secs))
+	}
+}
@@ -0,0 +1,195 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/jdotw/go-utils/errorsx"
+	"github.com/jdotw/go-utils/identity"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/worker"
+	"github.com/opentracing/opentracing-go"
+)
+
+func newTestRunner(t *testing.T, store Store) *Runner {
+	t.Helper()
+	pool := worker.NewPool(worker.Config{Name: "jobs", Workers: 1, QueueSize: 1}, log.NewMockLogFactory(), opentracing.NoopTracer{})
+	t.Cleanup(func() { pool.Shutdown(context.Background()) })
+	return NewRunner(store, pool, log.NewMockLogFactory(), BasePath("/v1/jobs/"), PollInterval(2*time.Second))
+}
+
+func waitFinished(t *testing.T, store Store, id string) *Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := store.Get(context.Background(), id)
+		if err != nil {
+			t.Fatalf("Get returned error: %s", err)
+		}
+		if job.Finished() {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return nil
+}
+
+func TestRunnerAccept(t *testing.T) {
+	store := NewMemoryStore()
+	runner := newTestRunner(t, store)
+
+	release := make(chan struct{})
+	ctx := identity.WithIdentity(context.Background(), identity.Identity{UserID: "user-1", TenantID: "acme"})
+	resp, err := runner.Accept(ctx, "export", func(ctx context.Context) (interface{}, error) {
+		if identity.TenantID(ctx) != "acme" {
+			return nil, errors.New("expected the job to run as the tenant")
+		}
+		<-release
+		return map[string]string{"url": "https://example.com/export.csv"}, nil
+	})
+	if err != nil {
+		t.Fatalf("Accept returned error: %s", err)
+	}
+	if resp.StatusCode() != http.StatusAccepted {
+		t.Errorf("expected status 202, got %d", resp.StatusCode())
+	}
+	if got := resp.Headers().Get("Location"); got != "/v1/jobs/"+resp.ID {
+		t.Errorf("unexpected Location %q", got)
+	}
+	if got := resp.Headers().Get("Retry-After"); got != "2" {
+		t.Errorf("expected Retry-After 2, got %q", got)
+	}
+	if resp.Type != "export" || resp.Finished() {
+		t.Errorf("expected an unfinished export job, got %+v", resp.Job)
+	}
+
+	close(release)
+	job := waitFinished(t, store, resp.ID)
+	if job.Status != Succeeded || job.CompletedAt == nil {
+		t.Fatalf("expected the job to succeed, got %+v", job)
+	}
+	if job.OwnerID != "user-1" || job.TenantID != "acme" {
+		t.Errorf("expected the job to be owned by its starter, got %+v", job)
+	}
+	if string(job.Result.Val) != `{"url":"https://example.com/export.csv"}` {
+		t.Errorf("unexpected result %s", job.Result.Val)
+	}
+}
+
+func TestRunnerAcceptWhileRunning(t *testing.T) {
+	store := NewMemoryStore()
+	runner := newTestRunner(t, store)
+
+	running, release := make(chan struct{}), make(chan struct{})
+	resp, err := runner.Accept(context.Background(), "export", func(ctx context.Context) (interface{}, error) {
+		close(running)
+		<-release
+		return "done", nil
+	})
+	if err != nil {
+		t.Fatalf("Accept returned error: %s", err)
+	}
+	<-running
+
+	// Encoding the response races the worker saving the job's progress
+	// unless they hold separate jobs; run with -race
+	b, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatalf("Marshal returned error: %s", err)
+	}
+	var body Job
+	if err := json.Unmarshal(b, &body); err != nil {
+		t.Fatalf("Unmarshal returned error: %s", err)
+	}
+	if body.Status != Pending {
+		t.Errorf("expected the accepted job to be pending, got %s", body.Status)
+	}
+
+	close(release)
+	if job := waitFinished(t, store, resp.ID); job.Status != Succeeded {
+		t.Errorf("expected the job to succeed, got %+v", job)
+	}
+}
+
+func TestRunnerFailure(t *testing.T) {
+	store := NewMemoryStore()
+	runner := newTestRunner(t, store)
+
+	job, err := runner.Start(context.Background(), "export", func(ctx context.Context) (interface{}, error) {
+		return nil, errorsx.WithCode(errors.New("disk full"), errorsx.CodeUnavailable, "export unavailable")
+	})
+	if err != nil {
+		t.Fatalf("Start returned error: %s", err)
+	}
+	job = waitFinished(t, store, job.ID)
+	if job.Status != Failed || job.Error != "export unavailable" || job.ErrorCode != errorsx.CodeUnavailable {
+		t.Errorf("expected a client safe failure, got %+v", job)
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	store := NewMemoryStore()
+	pending := &Job{ID: "pending", Type: "export", Status: Pending}
+	done := &Job{ID: "done", Type: "export", Status: Succeeded}
+	owned := &Job{ID: "owned", Type: "export", Status: Succeeded, OwnerID: "user-1", TenantID: "acme"}
+	store.Create(context.Background(), pending)
+	store.Create(context.Background(), done)
+	store.Create(context.Background(), owned)
+
+	// Callers are anonymous unless the test header names a user
+	asUser := func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if user, _ := ctx.Value(kithttp.ContextKeyRequestAuthorization).(string); user != "" {
+				ctx = identity.WithIdentity(ctx, identity.Identity{UserID: user, TenantID: "acme"})
+			}
+			return next(ctx, request)
+		}
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/jobs/", NewStatusHandler(asUser(MakeStatusEndpoint(store, PollInterval(3*time.Second)))))
+
+	tests := []struct {
+		id         string
+		user       string
+		status     int
+		retryAfter string
+	}{
+		{"pending", "", http.StatusOK, "3"},
+		{"done", "", http.StatusOK, ""},
+		{"missing", "", http.StatusNotFound, ""},
+		{"owned", "user-1", http.StatusOK, ""},
+		{"owned", "user-2", http.StatusNotFound, ""},
+		{"owned", "", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/jobs/"+tt.id, nil)
+		r.Header.Set("Authorization", tt.user)
+		mux.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s as %q: expected status %d, got %d %s", tt.id, tt.user, tt.status, w.Code, w.Body)
+			continue
+		}
+		if got := w.Header().Get("Retry-After"); got != tt.retryAfter {
+			t.Errorf("%s: expected Retry-After %q, got %q", tt.id, tt.retryAfter, got)
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		var job Job
+		if err := json.NewDecoder(w.Body).Decode(&job); err != nil {
+			t.Fatalf("failed to decode response: %s", err)
+		}
+		if job.ID != tt.id {
+			t.Errorf("expected job %s, got %+v", tt.id, job)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jdotw/go-utils/errorsx"
+	"github.com/jdotw/go-utils/model"
+	"github.com/jdotw/go-utils/recorderrors"
+	"gorm.io/gorm"
+)
+
+// Status is the state of a job.
+type Status string
+
+const (
+	// Pending jobs are queued for a worker.
+	Pending Status = "pending"
+	// Running jobs are being run by a worker.
+	Running Status = "running"
+	// Succeeded jobs finished, and their result is available.
+	Succeeded Status = "succeeded"
+	// Failed jobs returned an error, or could not be queued.
+	Failed Status = "failed"
+)
+
+// Job is the persisted state of a long-running operation, and the body
+// of its status responses. Migrate it to create the jobs table.
+type Job struct {
+	ID     string `json:"id" gorm:"primaryKey;type:uuid"`
+	Type   string `json:"type" gorm:"not null;index"`
+	Status Status `json:"status" gorm:"not null"`
+	// OwnerID and TenantID are the user and tenant that started the
+	// job, who alone may read its status.
+	OwnerID  string `json:"-" gorm:"index"`
+	TenantID string `json:"-" gorm:"index"`
+	// Result is the JSON encoded result of a Succeeded job.
+	Result model.JSONB[json.RawMessage] `json:"result,omitempty"`
+	// Error and ErrorCode describe why a Failed job failed, with the
+	// message and code safe to show to clients.
+	Error       string       `json:"error,omitempty"`
+	ErrorCode   errorsx.Code `json:"error_code,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+	CompletedAt *time.Time   `json:"completed_at,omitempty"`
+}
+
+func (Job) TableName() string {
+	return "jobs"
+}
+
+// Finished reports whether the job has succeeded or failed.
+func (j *Job) Finished() bool {
+	return j.Status == Succeeded || j.Status == Failed
+}
+
+// errNotFound is returned by Store.Get for unknown jobs, mapping to a
+// 404.
+func errNotFound(id string) error {
+	return recorderrors.NotFound("job", id)
+}
+
+// Store persists jobs.
+type Store interface {
+	// Create saves a new job.
+	Create(ctx context.Context, job *Job) error
+	// Update saves job's progress, setting its UpdatedAt.
+	Update(ctx context.Context, job *Job) error
+	// Get returns the job with id, or a recorderrors not found error.
+	Get(ctx context.Context, id string) (*Job, error)
+}
+
+type gormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore returns a Store keeping jobs in the jobs table of db.
+func NewGormStore(db *gorm.DB) Store {
+	return &gormStore{db: db}
+}
+
+func (s *gormStore) Create(ctx context.Context, job *Job) error {
+	return s.db.WithContext(ctx).Create(job).Error
+}
+
+func (s *gormStore) Update(ctx context.Context, job *Job) error {
+	return s.db.WithContext(ctx).Model(job).
+		Select("status", "result", "error", "error_code", "updated_at", "completed_at").Updates(job).Error
+}
+
+func (s *gormStore) Get(ctx context.Context, id string) (*Job, error) {
+	var job Job
+	err := s.db.WithContext(ctx).Where("id = ?", id).Take(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errNotFound(id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+type memoryStore struct {
+	mu   sync.Mutex
+	jobs map[string]Job
+	now  func() time.Time
+}
+
+// NewMemoryStore returns a Store holding jobs in process memory, for
+// tests. Jobs don't survive a restart.
+func NewMemoryStore() Store {
+	return &memoryStore{jobs: make(map[string]Job), now: time.Now}
+}
+
+func (s *memoryStore) Create(_ context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job.CreatedAt = s.now()
+	job.UpdatedAt = job.CreatedAt
+	s.jobs[job.ID] = *job
+	return nil
+}
+
+func (s *memoryStore) Update(_ context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job.UpdatedAt = s.now()
+	s.jobs[job.ID] = *job
+	return nil
+}
+
+func (s *memoryStore) Get(_ context.Context, id string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, errNotFound(id)
+	}
+	return &job, nil
+}
@@ -0,0 +1,79 @@
+package jobs
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/jdotw/go-utils/authn/jwt"
+	"github.com/jdotw/go-utils/identity"
+	"github.com/jdotw/go-utils/transport"
+)
+
+// StatusRequest requests the status of the job with ID.
+type StatusRequest struct {
+	ID string
+}
+
+// StatusResponse is the status of a job. Unfinished jobs carry a
+// Retry-After suggesting when to poll again.
+type StatusResponse struct {
+	*Job
+	retryAfter time.Duration
+}
+
+// Headers implements go-kit's Headerer.
+func (r *StatusResponse) Headers() http.Header {
+	h := http.Header{}
+	if !r.Finished() {
+		setRetryAfter(h, r.retryAfter)
+	}
+	return h
+}
+
+// MakeStatusEndpoint returns an endpoint answering a StatusRequest
+// with a StatusResponse. Unknown jobs, and jobs started by another user
+// or tenant than the caller's, are a recorderrors not found error. Only
+// PollInterval applies among the options.
+func MakeStatusEndpoint(store Store, opts ...Option) endpoint.Endpoint {
+	o := options{pollInterval: time.Second}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(StatusRequest)
+		job, err := store.Get(ctx, req.ID)
+		if err != nil {
+			return nil, err
+		}
+		if job.OwnerID != identity.UserID(ctx) || job.TenantID != identity.TenantID(ctx) {
+			return nil, errNotFound(req.ID)
+		}
+		return &StatusResponse{Job: job, retryAfter: o.pollInterval}, nil
+	}
+}
+
+// DecodeStatusRequest reads the job ID from the "id" path variable,
+// falling back to the last path segment for routers without path
+// variables, such as a "/jobs/" http.ServeMux pattern.
+func DecodeStatusRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	id := transport.PathVars(r)["id"]
+	if id == "" {
+		id = path.Base(r.URL.Path)
+	}
+	return StatusRequest{ID: id}, nil
+}
+
+// NewStatusHandler serves the status endpoint e, typically
+// MakeStatusEndpoint wrapped in the service's authn and authz
+// middlewares. The bearer token is moved to the context before e runs.
+func NewStatusHandler(e endpoint.Endpoint, opts ...kithttp.ServerOption) http.Handler {
+	opts = append([]kithttp.ServerOption{
+		kithttp.ServerBefore(kithttp.PopulateRequestContext, jwt.HTTPAuthorizationToContext(), transport.AcceptLanguageToContext()),
+		kithttp.ServerErrorEncoder(transport.HTTPErrorEncoder),
+	}, opts...)
+	return kithttp.NewServer(e, DecodeStatusRequest, transport.HTTPEncodeResponse, opts...)
+}
@@ -0,0 +1,227 @@
+// Package lock provides distributed mutexes, so one replica at a time
+// runs a migration, a singleton job or any other critical section.
+// Locks are held for a TTL and renewed in the background while held; if
+// a renewal fails the lock is considered lost and the lease's context is
+// cancelled, so the holder stops work it no longer has exclusive
+// access to.
+//
+//	m := lock.NewMutex(lock.NewRedisBackend(client), "billing:invoices", lock.Logger(logger))
+//	err := m.Do(ctx, func(ctx context.Context) error {
+//		return generateInvoices(ctx)
+//	})
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jdotw/go-utils/log"
+	"go.uber.org/zap"
+)
+
+// Defaults applied by NewMutex.
+const (
+	DefaultTTL           = 30 * time.Second
+	DefaultRetryInterval = 250 * time.Millisecond
+)
+
+var (
+	// ErrNotAcquired is returned by TryLock when the lock is held
+	// elsewhere.
+	ErrNotAcquired = errors.New("lock held elsewhere")
+	// ErrLost is the cause of a lease's context being cancelled when the
+	// lock could not be renewed, and is returned by Unlock after it.
+	ErrLost = errors.New("lock lost")
+)
+
+// Backend stores locks. Each holder identifies itself with a random
+// token, so only the holder can renew or release its lock.
+type Backend interface {
+	// Acquire takes the lock called key for ttl, reporting false if it is
+	// held with another token.
+	Acquire(ctx context.Context, key, token string, ttl time.Duration) (bool, error)
+	// Renew extends the lock for ttl, reporting false if it is no longer
+	// held with token.
+	Renew(ctx context.Context, key, token string, ttl time.Duration) (bool, error)
+	// Release gives up the lock if it is held with token.
+	Release(ctx context.Context, key, token string) error
+}
+
+// Option configures NewMutex.
+type Option func(*Mutex)
+
+// TTL sets how long the lock is held without renewal. Renewals happen
+// every third of it. It defaults to DefaultTTL.
+func TTL(d time.Duration) Option {
+	return func(m *Mutex) {
+		m.ttl = d
+	}
+}
+
+// RetryInterval sets how often Lock retries a held lock. It defaults to
+// DefaultRetryInterval.
+func RetryInterval(d time.Duration) Option {
+	return func(m *Mutex) {
+		m.retryInterval = d
+	}
+}
+
+// Logger logs lost locks and failed renewals.
+func Logger(logger log.Factory) Option {
+	return func(m *Mutex) {
+		m.logger = logger
+	}
+}
+
+// Mutex is a distributed lock called name.
+type Mutex struct {
+	backend       Backend
+	name          string
+	ttl           time.Duration
+	retryInterval time.Duration
+	logger        log.Factory
+}
+
+// NewMutex returns the mutex called name, stored in backend.
+func NewMutex(backend Backend, name string, opts ...Option) *Mutex {
+	m := &Mutex{
+		backend:       backend,
+		name:          name,
+		ttl:           DefaultTTL,
+		retryInterval: DefaultRetryInterval,
+		logger:        log.NewMockLogFactory(),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Lease is a held lock.
+type Lease struct {
+	m      *Mutex
+	token  string
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu   sync.Mutex
+	lost bool
+}
+
+// TryLock takes the lock if it is free, failing with ErrNotAcquired
+// otherwise.
+func (m *Mutex) TryLock(ctx context.Context) (*Lease, error) {
+	token := newToken()
+	ok, err := m.backend.Acquire(ctx, m.name, token, m.ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotAcquired
+	}
+	return m.hold(ctx, token), nil
+}
+
+// Lock waits for the lock until ctx is done.
+func (m *Mutex) Lock(ctx context.Context) (*Lease, error) {
+	for {
+		lease, err := m.TryLock(ctx)
+		if !errors.Is(err, ErrNotAcquired) {
+			return lease, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(m.retryInterval):
+		}
+	}
+}
+
+// Do runs fn while holding the lock, waiting for it until ctx is done.
+// fn's context is cancelled if the lock is lost.
+func (m *Mutex) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	lease, err := m.Lock(ctx)
+	if err != nil {
+		return err
+	}
+	ferr := fn(lease.Context())
+	if err := lease.Unlock(context.Background()); ferr == nil {
+		ferr = err
+	}
+	return ferr
+}
+
+func (m *Mutex) hold(ctx context.Context, token string) *Lease {
+	ctx, cancel := context.WithCancel(ctx)
+	l := &Lease{m: m, token: token, ctx: ctx, cancel: cancel, done: make(chan struct{})}
+	go l.renew()
+	return l
+}
+
+// renew extends the lock every third of its TTL until the lease ends,
+// marking it lost once it can't be renewed before it expires.
+func (l *Lease) renew() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.m.ttl / 3)
+	defer ticker.Stop()
+	renewed := time.Now()
+	for {
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		ok, err := l.m.backend.Renew(l.ctx, l.m.name, l.token, l.m.ttl)
+		if l.ctx.Err() != nil {
+			return
+		}
+		switch {
+		case err == nil && ok:
+			renewed = time.Now()
+			continue
+		case err != nil && time.Since(renewed) < l.m.ttl:
+			log.Warn(l.m.logger.Bg(), "Failed to renew lock", zap.String("lock", l.m.name), zap.Error(err))
+			continue
+		}
+		l.m.logger.Bg().Error("Lock lost", zap.String("lock", l.m.name), zap.Error(err))
+		l.mu.Lock()
+		l.lost = true
+		l.mu.Unlock()
+		l.cancel()
+		return
+	}
+}
+
+// Context returns a context cancelled when the lock is lost or released.
+func (l *Lease) Context() context.Context {
+	return l.ctx
+}
+
+// Lost reports whether the lock was lost before it was released.
+func (l *Lease) Lost() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lost
+}
+
+// Unlock stops renewing and releases the lock. It returns ErrLost if the
+// lock was lost while held.
+func (l *Lease) Unlock(ctx context.Context) error {
+	l.cancel()
+	<-l.done
+	if l.Lost() {
+		return ErrLost
+	}
+	return l.m.backend.Release(ctx, l.m.name, l.token)
+}
+
+func newToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
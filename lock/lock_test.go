@@ -0,0 +1,262 @@
+package lock
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+func TestMutex(t *testing.T) {
+	backend := NewMemoryBackend()
+	a := NewMutex(backend, "job", TTL(time.Second))
+	b := NewMutex(backend, "job", TTL(time.Second), RetryInterval(time.Millisecond))
+
+	lease, err := a.TryLock(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.TryLock(context.Background()); !errors.Is(err, ErrNotAcquired) {
+		t.Errorf("expected ErrNotAcquired, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := b.Lock(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected Lock to wait until the deadline, got %v", err)
+	}
+
+	if err := lease.Unlock(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if lease.Context().Err() == nil {
+		t.Error("lease context should be cancelled after Unlock")
+	}
+	ran := false
+	if err := b.Do(context.Background(), func(ctx context.Context) error {
+		ran = true
+		return nil
+	}); err != nil || !ran {
+		t.Errorf("expected Do to run once the lock was free, got %v", err)
+	}
+}
+
+// lossyBackend grants locks but fails to renew them.
+type lossyBackend struct {
+	Backend
+}
+
+func (lossyBackend) Renew(context.Context, string, string, time.Duration) (bool, error) {
+	return false, nil
+}
+
+func TestMutexLost(t *testing.T) {
+	m := NewMutex(lossyBackend{NewMemoryBackend()}, "job", TTL(30*time.Millisecond))
+	lease, err := m.TryLock(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-lease.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("lease context should be cancelled when the lock is lost")
+	}
+	if !lease.Lost() {
+		t.Error("lease should report the lock lost")
+	}
+	if err := lease.Unlock(context.Background()); !errors.Is(err, ErrLost) {
+		t.Errorf("expected ErrLost, got %v", err)
+	}
+}
+
+// fakeRedis implements SET NX and the lock scripts.
+type fakeRedis struct {
+	goredis.Cmdable
+	mu   sync.Mutex
+	keys map[string]string
+	down bool
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{keys: make(map[string]string)}
+}
+
+func (r *fakeRedis) SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) *goredis.BoolCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.down {
+		return goredis.NewBoolResult(false, errors.New("connection refused"))
+	}
+	if _, ok := r.keys[key]; ok {
+		return goredis.NewBoolResult(false, nil)
+	}
+	r.keys[key] = value.(string)
+	return goredis.NewBoolResult(true, nil)
+}
+
+func (r *fakeRedis) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *goredis.Cmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.down {
+		return goredis.NewCmdResult(nil, errors.New("connection refused"))
+	}
+	if r.keys[keys[0]] != args[0] {
+		return goredis.NewCmdResult(int64(0), nil)
+	}
+	if script == releaseScript {
+		delete(r.keys, keys[0])
+	}
+	return goredis.NewCmdResult(int64(1), nil)
+}
+
+func TestRedisBackend(t *testing.T) {
+	ctx := context.Background()
+	r := newFakeRedis()
+	b := NewRedisBackend(r)
+
+	if ok, err := b.Acquire(ctx, "job", "a", time.Second); !ok || err != nil {
+		t.Fatalf("expected to acquire, got %v, %v", ok, err)
+	}
+	if ok, _ := b.Acquire(ctx, "job", "b", time.Second); ok {
+		t.Error("a held lock should not be granted")
+	}
+	if ok, _ := b.Renew(ctx, "job", "b", time.Second); ok {
+		t.Error("only the holder should renew")
+	}
+	if ok, err := b.Renew(ctx, "job", "a", time.Second); !ok || err != nil {
+		t.Errorf("expected the holder to renew, got %v, %v", ok, err)
+	}
+	b.Release(ctx, "job", "b")
+	if _, ok := r.keys["lock:job"]; !ok {
+		t.Error("only the holder should release")
+	}
+	b.Release(ctx, "job", "a")
+	if _, ok := r.keys["lock:job"]; ok {
+		t.Error("the holder should release")
+	}
+}
+
+func TestRedisBackendQuorum(t *testing.T) {
+	ctx := context.Background()
+	r1, r2, r3 := newFakeRedis(), newFakeRedis(), newFakeRedis()
+	b := NewRedisBackend(r1, r2, r3)
+
+	// A minority of instances down doesn't stop locking
+	r3.down = true
+	if ok, err := b.Acquire(ctx, "job", "a", time.Second); !ok || err != nil {
+		t.Fatalf("expected to acquire with a majority, got %v, %v", ok, err)
+	}
+	b.Release(ctx, "job", "a")
+
+	// Without a majority the lock isn't granted, and partial grants are
+	// given back
+	r2.down = true
+	if ok, err := b.Acquire(ctx, "job", "a", time.Second); ok || err == nil {
+		t.Errorf("expected a failure without a majority, got %v, %v", ok, err)
+	}
+	if len(r1.keys) != 0 {
+		t.Errorf("partial grants should be released, got %v", r1.keys)
+	}
+}
+
+// fakeDriver answers the advisory lock queries, granting each key to
+// one connection at a time.
+type fakeDriver struct {
+	mu   sync.Mutex
+	held map[int64]bool
+}
+
+type fakeConn struct {
+	d *fakeDriver
+}
+
+type fakeRows struct {
+	value bool
+	done  bool
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) {
+	return &fakeConn{d: d}, nil
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	key := args[0].Value.(int64)
+	if strings.Contains(query, "pg_try_advisory_lock") {
+		if c.d.held[key] {
+			return &fakeRows{value: false}, nil
+		}
+		c.d.held[key] = true
+		return &fakeRows{value: true}, nil
+	}
+	delete(c.d.held, key)
+	return &fakeRows{value: true}, nil
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"result"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.value
+	return nil
+}
+
+func TestPostgresBackend(t *testing.T) {
+	d := &fakeDriver{held: make(map[int64]bool)}
+	sql.Register("fakelock", d)
+	db, err := sql.Open("fakelock", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	b := NewPostgresBackend(db)
+	if ok, err := b.Acquire(ctx, "job", "a", time.Second); !ok || err != nil {
+		t.Fatalf("expected to acquire, got %v, %v", ok, err)
+	}
+	if ok, _ := b.Acquire(ctx, "job", "b", time.Second); ok {
+		t.Error("a held lock should not be granted")
+	}
+	if ok, _ := b.Renew(ctx, "job", "a", time.Second); !ok {
+		t.Error("expected the holder to renew")
+	}
+	if ok, _ := b.Renew(ctx, "job", "b", time.Second); ok {
+		t.Error("only the holder should renew")
+	}
+	if err := b.Release(ctx, "job", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := b.Acquire(ctx, "job", "b", time.Second); !ok || err != nil {
+		t.Errorf("expected to acquire after release, got %v, %v", ok, err)
+	}
+}
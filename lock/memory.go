@@ -0,0 +1,54 @@
+package lock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	token   string
+	expires time.Time
+}
+
+// memoryBackend holds locks in process.
+type memoryBackend struct {
+	mu    sync.Mutex
+	locks map[string]memoryEntry
+}
+
+// NewMemoryBackend returns a Backend holding locks in process, for tests
+// and single instance services.
+func NewMemoryBackend() Backend {
+	return &memoryBackend{locks: make(map[string]memoryEntry)}
+}
+
+func (b *memoryBackend) Acquire(_ context.Context, key, token string, ttl time.Duration) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if e, ok := b.locks[key]; ok && e.token != token && time.Now().Before(e.expires) {
+		return false, nil
+	}
+	b.locks[key] = memoryEntry{token: token, expires: time.Now().Add(ttl)}
+	return true, nil
+}
+
+func (b *memoryBackend) Renew(_ context.Context, key, token string, ttl time.Duration) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e, ok := b.locks[key]
+	if !ok || e.token != token || time.Now().After(e.expires) {
+		return false, nil
+	}
+	b.locks[key] = memoryEntry{token: token, expires: time.Now().Add(ttl)}
+	return true, nil
+}
+
+func (b *memoryBackend) Release(_ context.Context, key, token string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if e, ok := b.locks[key]; ok && e.token == token {
+		delete(b.locks, key)
+	}
+	return nil
+}
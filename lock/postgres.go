@@ -0,0 +1,86 @@
+package lock
+
+import (
+	"context"
+	"database/sql"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// postgresBackend holds locks as session level advisory locks, each on a
+// connection of its own.
+type postgresBackend struct {
+	db *sql.DB
+
+	mu    sync.Mutex
+	conns map[string]*sql.Conn
+}
+
+// NewPostgresBackend returns a Backend using Postgres advisory locks.
+// Each held lock keeps a connection from db, so the lock is released by
+// the server if the holder dies; the TTL is not used. Renewals check the
+// connection is still alive.
+func NewPostgresBackend(db *sql.DB) Backend {
+	return &postgresBackend{db: db, conns: make(map[string]*sql.Conn)}
+}
+
+// advisoryKey maps a lock name to the 64 bit key of an advisory lock.
+func advisoryKey(key string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return int64(h.Sum64())
+}
+
+func (b *postgresBackend) Acquire(ctx context.Context, key, token string, _ time.Duration) (bool, error) {
+	conn, err := b.db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	var ok bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", advisoryKey(key)).Scan(&ok); err != nil {
+		conn.Close()
+		return false, err
+	}
+	if !ok {
+		conn.Close()
+		return false, nil
+	}
+	b.mu.Lock()
+	b.conns[token] = conn
+	b.mu.Unlock()
+	return true, nil
+}
+
+func (b *postgresBackend) Renew(ctx context.Context, key, token string, _ time.Duration) (bool, error) {
+	b.mu.Lock()
+	conn, ok := b.conns[token]
+	b.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	if err := conn.PingContext(ctx); err != nil {
+		// The session, and with it the lock, is gone
+		b.forget(token)
+		return false, err
+	}
+	return true, nil
+}
+
+func (b *postgresBackend) Release(ctx context.Context, key, token string) error {
+	conn := b.forget(token)
+	if conn == nil {
+		return nil
+	}
+	defer conn.Close()
+	var released bool
+	return conn.QueryRowContext(ctx, "SELECT pg_advisory_unlock($1)", advisoryKey(key)).Scan(&released)
+}
+
+func (b *postgresBackend) forget(token string) *sql.Conn {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	conn := b.conns[token]
+	delete(b.conns, token)
+	return conn
+}
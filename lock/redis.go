@@ -0,0 +1,104 @@
+package lock
+
+import (
+	"context"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// Scripts that only touch the lock when it still holds the caller's
+// token.
+const (
+	renewScript = `if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`
+	releaseScript = `if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`
+)
+
+// redisBackend stores locks as keys holding the owner's token.
+type redisBackend struct {
+	clients []goredis.Cmdable
+	prefix  string
+}
+
+// NewRedisBackend returns a Backend storing locks in Redis under
+// "lock:" keys. Given several independent instances it follows the
+// Redlock approach: a lock is held when a majority of instances grant it
+// well within its TTL, so losing a minority of instances doesn't lose
+// or double-grant locks.
+func NewRedisBackend(clients ...goredis.Cmdable) Backend {
+	return &redisBackend{clients: clients, prefix: "lock:"}
+}
+
+func (b *redisBackend) quorum() int {
+	return len(b.clients)/2 + 1
+}
+
+// clockDrift allows for clock differences between the instances, as in
+// the Redlock algorithm.
+func clockDrift(ttl time.Duration) time.Duration {
+	return ttl/100 + 2*time.Millisecond
+}
+
+func (b *redisBackend) Acquire(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	start := time.Now()
+	granted, failed := 0, 0
+	var lastErr error
+	for _, c := range b.clients {
+		ok, err := c.SetNX(ctx, b.prefix+key, token, ttl).Result()
+		if err != nil {
+			failed++
+			lastErr = err
+			continue
+		}
+		if ok {
+			granted++
+		}
+	}
+	if granted >= b.quorum() && time.Since(start)+clockDrift(ttl) < ttl {
+		return true, nil
+	}
+	// Give back partial grants so the lock is free for others
+	if granted > 0 {
+		b.Release(ctx, key, token)
+	}
+	if granted+failed >= b.quorum() {
+		// The failed instances, not other holders, kept us from a quorum
+		return false, lastErr
+	}
+	return false, nil
+}
+
+func (b *redisBackend) Renew(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	renewed := 0
+	var lastErr error
+	for _, c := range b.clients {
+		n, err := c.Eval(ctx, renewScript, []string{b.prefix + key}, token, ttl.Milliseconds()).Int()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if n == 1 {
+			renewed++
+		}
+	}
+	if renewed >= b.quorum() {
+		return true, nil
+	}
+	return false, lastErr
+}
+
+func (b *redisBackend) Release(ctx context.Context, key, token string) error {
+	var lastErr error
+	for _, c := range b.clients {
+		if err := c.Eval(ctx, releaseScript, []string{b.prefix + key}, token).Err(); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
@@ -0,0 +1,37 @@
+package log
+
+import (
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func logViaHelper(f Factory) {
+	f.Bg().Info("from helper")
+}
+
+func TestCallerSkip(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	f := NewFactory(zap.New(core, zap.AddCaller(), zap.AddCallerSkip(1)))
+
+	logViaHelper(f)
+	logViaHelper(AddCallerSkip(f, 1))
+	logViaHelper(WithCaller(f, false))
+
+	entries := logs.All()
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	if fn := entries[0].Caller.Function; !strings.HasSuffix(fn, "logViaHelper") {
+		t.Errorf("expected caller to be the helper, got %s", fn)
+	}
+	if fn := entries[1].Caller.Function; !strings.HasSuffix(fn, "TestCallerSkip") {
+		t.Errorf("expected caller to be the helper's caller, got %s", fn)
+	}
+	if entries[2].Caller.Defined {
+		t.Error("expected caller annotation to be disabled")
+	}
+}
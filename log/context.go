@@ -0,0 +1,39 @@
+package log
+
+import (
+	"context"
+)
+
+type contextKey string
+
+const (
+	// LoggerContextKey holds the key used to store a Logger in the context.
+	LoggerContextKey contextKey = "Logger"
+)
+
+// WithLogger returns a copy of ctx carrying the given Logger.
+// Use this to stash a logger that has already been enriched
+// with request fields so that code further down the call stack
+// can log without being handed the Factory.
+func WithLogger(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, LoggerContextKey, logger)
+}
+
+// FromContext returns the Logger stored in the context by WithLogger.
+// If no Logger is present a no-op logger is returned so callers
+// never need to nil-check the result.
+func FromContext(ctx context.Context) Logger {
+	if logger, ok := ctx.Value(LoggerContextKey).(Logger); ok {
+		return logger
+	}
+	return mocklogger{}
+}
+
+// FromContextOr returns the Logger stored in the context by WithLogger,
+// falling back to factory.For(ctx) when none is present.
+func FromContextOr(ctx context.Context, factory Factory) Logger {
+	if logger, ok := ctx.Value(LoggerContextKey).(Logger); ok {
+		return logger
+	}
+	return factory.For(ctx)
+}
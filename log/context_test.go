@@ -0,0 +1,50 @@
+package log
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jdotw/go-utils/identity"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestFromContext(t *testing.T) {
+	// No Logger is stored in the context
+	if _, ok := FromContext(context.Background()).(mocklogger); !ok {
+		t.Error("FromContext should return a no-op logger when none is stored")
+	}
+
+	// A Logger is stored in the context
+	l := logger{logger: zap.NewNop()}
+	ctx := WithLogger(context.Background(), l)
+	if got, ok := FromContext(ctx).(logger); !ok || got != l {
+		t.Errorf("FromContext did not return the stored logger; expected %v, got %v", l, got)
+	}
+}
+
+func TestFromContextOr(t *testing.T) {
+	f := NewFactory(zap.NewNop())
+
+	// No Logger is stored in the context, so the factory is used
+	if _, ok := FromContextOr(context.Background(), f).(logger); !ok {
+		t.Error("FromContextOr should fall back to the factory")
+	}
+
+	// A Logger is stored in the context
+	ctx := WithLogger(context.Background(), mocklogger{})
+	if _, ok := FromContextOr(ctx, f).(mocklogger); !ok {
+		t.Error("FromContextOr should prefer the stored logger")
+	}
+}
+
+func TestForIdentityFields(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	f := NewFactory(zap.New(core))
+	ctx := identity.WithTenantID(identity.WithUserID(context.Background(), "user-1"), "tenant-1")
+	f.For(ctx).Info("hello")
+	fields := logs.All()[0].ContextMap()
+	if fields["user_id"] != "user-1" || fields["tenant_id"] != "tenant-1" {
+		t.Errorf("expected identity fields, got %v", fields)
+	}
+}
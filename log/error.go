@@ -0,0 +1,31 @@
+package log
+
+import (
+	"github.com/jdotw/go-utils/errorsx"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// ErrorFields returns the fields used to log err: the error message,
+// its unwrap chain when it wraps other errors, its errorsx code, and the
+// stack captured by the errorsx package when one is available. The
+// message is the full internal one, not the one shown to clients.
+func ErrorFields(err error) []zapcore.Field {
+	if err == nil {
+		return nil
+	}
+	fields := []zapcore.Field{zap.Error(err)}
+	if chain := errorsx.Chain(err); len(chain) > 1 {
+		fields = append(fields, zap.Strings("error_chain", chain))
+	}
+	fields = append(fields, zap.String("error_code", string(errorsx.CodeOf(err))))
+	if stack := errorsx.Stack(err); stack != "" {
+		fields = append(fields, zap.String("error_stack", stack))
+	}
+	return fields
+}
+
+// LogError logs msg at Error level along with the ErrorFields for err.
+func LogError(logger Logger, msg string, err error, fields ...zapcore.Field) {
+	logger.Error(msg, append(fields, ErrorFields(err)...)...)
+}
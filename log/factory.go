@@ -3,6 +3,8 @@ package log
 import (
 	"context"
 
+	"github.com/jdotw/go-utils/correlation"
+	"github.com/jdotw/go-utils/identity"
 	"github.com/opentracing/opentracing-go"
 	"github.com/uber/jaeger-client-go"
 	"go.uber.org/zap"
@@ -15,25 +17,101 @@ type Factory interface {
 	With(fields ...zapcore.Field) Factory
 }
 
+// Namer is implemented by factories that create component factories,
+// such as those returned by NewFactory. Use Named to name any Factory.
+type Namer interface {
+	Named(name string) Factory
+}
+
+// Named returns the component factory of f called name, or f itself if
+// f isn't a Namer.
+func Named(f Factory, name string) Factory {
+	if n, ok := f.(Namer); ok {
+		return n.Named(name)
+	}
+	return f
+}
+
+// Syncer is implemented by factories that buffer entries, such as those
+// returned by Init. Use Sync to flush any Factory.
+type Syncer interface {
+	Sync() error
+}
+
+// Sync flushes f's buffered entries if f is a Syncer. Call it before the
+// service exits.
+func Sync(f Factory) error {
+	if s, ok := f.(Syncer); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// CallerAnnotator is implemented by factories whose caller annotation
+// can be adjusted, such as those returned by NewFactory. Use
+// AddCallerSkip and WithCaller to adjust any Factory.
+type CallerAnnotator interface {
+	AddCallerSkip(skip int) Factory
+	WithCaller(enabled bool) Factory
+}
+
+// AddCallerSkip returns f.AddCallerSkip(skip) if f is a CallerAnnotator,
+// and f otherwise.
+func AddCallerSkip(f Factory, skip int) Factory {
+	if c, ok := f.(CallerAnnotator); ok {
+		return c.AddCallerSkip(skip)
+	}
+	return f
+}
+
+// WithCaller returns f.WithCaller(enabled) if f is a CallerAnnotator,
+// and f otherwise.
+func WithCaller(f Factory, enabled bool) Factory {
+	if c, ok := f.(CallerAnnotator); ok {
+		return c.WithCaller(enabled)
+	}
+	return f
+}
+
+// LevelSetter is implemented by factories whose component levels can be
+// changed at runtime, such as those returned by NewFactory.
+type LevelSetter interface {
+	SetLevel(component string, level zapcore.Level)
+	SetLevels(levels map[string]zapcore.Level)
+}
+
 func NewFactory(logger *zap.Logger) Factory {
-	return factory{logger: logger}
+	return factory{logger: logger, levels: newComponentLevels()}
 }
 
 type factory struct {
 	logger *zap.Logger
+	name   string
+	levels *componentLevels
 }
 
 // Bg creates a context-unaware logger.
 func (b factory) Bg() Logger {
-	return logger(b)
+	return logger{logger: b.logger}
 }
 
 // For returns a context-aware Logger. If the context
 // contains an OpenTracing span, all logging calls are also
-// echo-ed into the span.
+// echo-ed into the span. If the context carries a request ID
+// it is added to every entry.
 func (b factory) For(ctx context.Context) Logger {
+	l := b.logger
+	if id := correlation.FromContext(ctx); id != "" {
+		l = l.With(zap.String(correlation.LogField, id))
+	}
+	if id := identity.UserID(ctx); id != "" {
+		l = l.With(zap.String("user_id", id))
+	}
+	if id := identity.TenantID(ctx); id != "" {
+		l = l.With(zap.String("tenant_id", id))
+	}
 	if span := opentracing.SpanFromContext(ctx); span != nil {
-		logger := spanLogger{span: span, logger: b.logger}
+		logger := spanLogger{span: span, logger: l}
 
 		if jaegerCtx, ok := span.Context().(jaeger.SpanContext); ok {
 			logger.spanFields = []zapcore.Field{
@@ -44,10 +122,59 @@ func (b factory) For(ctx context.Context) Logger {
 
 		return logger
 	}
-	return b.Bg()
+	return logger{logger: l}
 }
 
 // With creates a child logger, and optionally adds some context fields to that logger.
 func (b factory) With(fields ...zapcore.Field) Factory {
-	return factory{logger: b.logger.With(fields...)}
+	return factory{logger: b.logger.With(fields...), name: b.name, levels: b.levels}
+}
+
+// Named creates a child factory for a component of the service, such as "opa"
+// or "authn". Names are joined with dots when nested. The level of each
+// component can be set independently with SetLevel.
+func (b factory) Named(name string) Factory {
+	full := name
+	if b.name != "" {
+		full = b.name + "." + name
+	}
+	l := b.logger.Named(name).WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		// Replace rather than nest the parent's component filter
+		if cc, ok := core.(componentCore); ok {
+			core = cc.Core
+		}
+		return componentCore{Core: core, name: full, levels: b.levels}
+	}))
+	return factory{logger: l, name: full, levels: b.levels}
+}
+
+// SetLevel sets the minimum level logged by the named component and
+// its descendants. It affects loggers that have already been created.
+func (b factory) SetLevel(component string, level zapcore.Level) {
+	b.levels.set(component, level)
+}
+
+// SetLevels replaces every component level with levels in one step, so
+// components left out of levels are unrestricted again. It affects
+// loggers that have already been created.
+func (b factory) SetLevels(levels map[string]zapcore.Level) {
+	b.levels.replace(levels)
+}
+
+// AddCallerSkip creates a child factory whose loggers skip an additional
+// number of stack frames when annotating entries with their caller. Use
+// this when wrapping the Logger in helpers so the reported call site is
+// the helper's caller rather than the helper itself.
+func (b factory) AddCallerSkip(skip int) Factory {
+	return factory{logger: b.logger.WithOptions(zap.AddCallerSkip(skip)), name: b.name, levels: b.levels}
+}
+
+// WithCaller creates a child factory with caller annotation enabled or disabled.
+func (b factory) WithCaller(enabled bool) Factory {
+	return factory{logger: b.logger.WithOptions(zap.WithCaller(enabled)), name: b.name, levels: b.levels}
+}
+
+// Sync flushes any buffered log entries. Call it before the service exits.
+func (b factory) Sync() error {
+	return b.logger.Sync()
 }
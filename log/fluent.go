@@ -0,0 +1,300 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Fluentd / Fluent Bit forward protocol client, shipping
+// entries directly to an aggregator over TCP.
+
+// FluentConfig configures a Fluent forward sink.
+type FluentConfig struct {
+	// Address of the forward input, e.g. "fluentd:24224".
+	Address string
+
+	// Tag is attached to every event, e.g. "service.orders".
+	Tag string
+
+	// FlushInterval is the maximum time an entry waits before being sent.
+	// Defaults to one second.
+	FlushInterval time.Duration
+
+	// BatchSize is the maximum number of entries per forward message.
+	// Defaults to 500.
+	BatchSize int
+
+	// BufferSize is the number of entries queued before backpressure
+	// applies. Defaults to 10000.
+	BufferSize int
+
+	// Block makes writers wait for space when the buffer is full.
+	// By default entries are dropped instead; see FluentDropped.
+	Block bool
+
+	// DialTimeout defaults to five seconds.
+	DialTimeout time.Duration
+}
+
+type fluentEntry struct {
+	ts     time.Time
+	record []byte
+}
+
+type fluentWriter struct {
+	cfg     FluentConfig
+	conn    net.Conn
+	entries chan fluentEntry
+	flush   chan chan struct{}
+}
+
+var fluentDropped uint64
+
+// FluentDropped returns the number of entries dropped because a Fluent
+// sink's buffer was full or the aggregator was unreachable.
+func FluentDropped() uint64 {
+	return atomic.LoadUint64(&fluentDropped)
+}
+
+// FluentSink returns a Sink that sends entries to a Fluentd or Fluent Bit
+// forward input using msgpack encoded Forward mode messages. The connection
+// is re-established with backoff if it fails. Sync flushes pending entries.
+func FluentSink(cfg FluentConfig, level zapcore.LevelEnabler) (Sink, error) {
+	if cfg.Address == "" {
+		return Sink{}, fmt.Errorf("fluent address is required")
+	}
+	if cfg.Tag == "" {
+		return Sink{}, fmt.Errorf("fluent tag is required")
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 10000
+	}
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = 5 * time.Second
+	}
+	w := &fluentWriter{
+		cfg:     cfg,
+		entries: make(chan fluentEntry, cfg.BufferSize),
+		flush:   make(chan chan struct{}),
+	}
+	go w.run()
+
+	encCfg := zap.NewProductionEncoderConfig()
+	// The event time is part of the forward message
+	encCfg.TimeKey = ""
+	return Sink{
+		Encoder: zapcore.NewJSONEncoder(encCfg),
+		Writer:  w,
+		Level:   level,
+	}, nil
+}
+
+// WriteEntry queues an entry for the next forward message.
+func (w *fluentWriter) WriteEntry(ent zapcore.Entry, p []byte) error {
+	e := fluentEntry{ts: ent.Time, record: append([]byte(nil), p...)}
+	if w.cfg.Block {
+		w.entries <- e
+		return nil
+	}
+	select {
+	case w.entries <- e:
+	default:
+		atomic.AddUint64(&fluentDropped, 1)
+	}
+	return nil
+}
+
+func (w *fluentWriter) Write(p []byte) (int, error) {
+	err := w.WriteEntry(zapcore.Entry{Level: zapcore.InfoLevel, Time: time.Now()}, p)
+	return len(p), err
+}
+
+// Sync sends all queued entries.
+func (w *fluentWriter) Sync() error {
+	done := make(chan struct{})
+	select {
+	case w.flush <- done:
+	case <-time.After(w.cfg.FlushInterval):
+		return fmt.Errorf("timed out waiting for fluent flush")
+	}
+	<-done
+	return nil
+}
+
+func (w *fluentWriter) run() {
+	ticker := time.NewTicker(w.cfg.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]fluentEntry, 0, w.cfg.BatchSize)
+	for {
+		select {
+		case e := <-w.entries:
+			batch = append(batch, e)
+			if len(batch) >= w.cfg.BatchSize {
+				w.send(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				w.send(batch)
+				batch = batch[:0]
+			}
+		case done := <-w.flush:
+			for n := len(w.entries); n > 0; n-- {
+				batch = append(batch, <-w.entries)
+			}
+			if len(batch) > 0 {
+				w.send(batch)
+				batch = batch[:0]
+			}
+			close(done)
+		}
+	}
+}
+
+func (w *fluentWriter) send(batch []fluentEntry) {
+	msg, skipped, err := encodeForward(w.cfg.Tag, batch)
+	if skipped > 0 {
+		atomic.AddUint64(&fluentDropped, uint64(skipped))
+		fmt.Fprintf(os.Stderr, "fluent: dropped %d entries that are not JSON objects\n", skipped)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fluent: failed to encode message: %v\n", err)
+		return
+	}
+	if msg == nil {
+		return
+	}
+	backoff := 250 * time.Millisecond
+	for attempt := 0; attempt < 3; attempt++ {
+		if w.conn == nil {
+			w.conn, err = net.DialTimeout("tcp", w.cfg.Address, w.cfg.DialTimeout)
+		}
+		if err == nil {
+			w.conn.SetWriteDeadline(time.Now().Add(w.cfg.DialTimeout))
+			if _, err = w.conn.Write(msg); err == nil {
+				return
+			}
+			w.conn.Close()
+			w.conn = nil
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	atomic.AddUint64(&fluentDropped, uint64(len(batch)-skipped))
+	fmt.Fprintf(os.Stderr, "fluent: send failed, dropped %d entries: %v\n", len(batch)-skipped, err)
+}
+
+// encodeForward encodes a Forward mode message: [tag, [[time, record], ...]].
+// Entries whose record isn't a JSON object are skipped rather than
+// failing the batch, and counted in skipped. The message is nil if every
+// entry was skipped.
+func encodeForward(tag string, batch []fluentEntry) (msg []byte, skipped int, err error) {
+	records := make([]map[string]interface{}, len(batch))
+	for i, e := range batch {
+		if records[i], err = decodeRecord(e.record); err != nil {
+			skipped++
+		}
+	}
+	if skipped == len(batch) {
+		return nil, skipped, nil
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	if err := enc.EncodeArrayLen(2); err != nil {
+		return nil, skipped, err
+	}
+	if err := enc.EncodeString(tag); err != nil {
+		return nil, skipped, err
+	}
+	if err := enc.EncodeArrayLen(len(batch) - skipped); err != nil {
+		return nil, skipped, err
+	}
+	for i, e := range batch {
+		if records[i] == nil {
+			continue
+		}
+		if err := enc.EncodeArrayLen(2); err != nil {
+			return nil, skipped, err
+		}
+		if err := encodeEventTime(enc, e.ts); err != nil {
+			return nil, skipped, err
+		}
+		if err := enc.Encode(records[i]); err != nil {
+			return nil, skipped, err
+		}
+	}
+	return buf.Bytes(), skipped, nil
+}
+
+// decodeRecord decodes an entry's JSON object, keeping numbers exact:
+// integers stay integers rather than becoming float64s, which lose
+// precision above 2^53.
+func decodeRecord(p []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+	var record map[string]interface{}
+	if err := dec.Decode(&record); err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, fmt.Errorf("record is null")
+	}
+	numbers(record)
+	return record, nil
+}
+
+// numbers replaces the json.Numbers in v, which msgpack would encode as
+// strings, with integers where they fit and floats otherwise.
+func numbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return u
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = numbers(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = numbers(e)
+		}
+	}
+	return v
+}
+
+// encodeEventTime writes the forward protocol's EventTime extension
+// (type 0): big-endian seconds and nanoseconds.
+func encodeEventTime(enc *msgpack.Encoder, t time.Time) error {
+	if err := enc.EncodeExtHeader(0, 8); err != nil {
+		return err
+	}
+	var b [8]byte
+	binary.BigEndian.PutUint32(b[:4], uint32(t.Unix()))
+	binary.BigEndian.PutUint32(b[4:], uint32(t.Nanosecond()))
+	_, err := enc.Writer().Write(b[:])
+	return err
+}
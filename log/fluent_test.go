@@ -0,0 +1,171 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type forwardEvent struct {
+	time   time.Time
+	record map[string]interface{}
+}
+
+// decodeForward decodes a Forward mode message written by encodeForward.
+func decodeForward(dec *msgpack.Decoder) (string, []forwardEvent, error) {
+	if n, err := dec.DecodeArrayLen(); err != nil || n != 2 {
+		return "", nil, fmt.Errorf("expected a [tag, entries] message, got %d elements: %v", n, err)
+	}
+	tag, err := dec.DecodeString()
+	if err != nil {
+		return "", nil, err
+	}
+	n, err := dec.DecodeArrayLen()
+	if err != nil {
+		return "", nil, err
+	}
+	events := make([]forwardEvent, n)
+	for i := range events {
+		if n, err := dec.DecodeArrayLen(); err != nil || n != 2 {
+			return "", nil, fmt.Errorf("expected a [time, record] entry, got %d elements: %v", n, err)
+		}
+		if id, l, err := dec.DecodeExtHeader(); err != nil || id != 0 || l != 8 {
+			return "", nil, fmt.Errorf("expected an EventTime, got ext %d of length %d: %v", id, l, err)
+		}
+		var b [8]byte
+		if err := dec.ReadFull(b[:]); err != nil {
+			return "", nil, err
+		}
+		events[i].time = time.Unix(int64(binary.BigEndian.Uint32(b[:4])), int64(binary.BigEndian.Uint32(b[4:])))
+		if events[i].record, err = dec.DecodeMap(); err != nil {
+			return "", nil, err
+		}
+	}
+	return tag, events, nil
+}
+
+func TestEncodeForward(t *testing.T) {
+	ts := time.Unix(1700000000, 123456789)
+	msg, skipped, err := encodeForward("service.orders", []fluentEntry{
+		{ts: ts, record: []byte(`{"msg":"one","order_id":9007199254740993,"max":18446744073709551615,"ratio":0.5}`)},
+		{ts: ts, record: []byte(`{"msg":"truncated`)},
+		{ts: ts, record: []byte(`null`)},
+		{ts: ts, record: []byte(`{"msg":"two","ids":[1,2]}`)},
+	})
+	if err != nil {
+		t.Fatalf("encodeForward returned error: %s", err)
+	}
+	if skipped != 2 {
+		t.Errorf("expected the 2 invalid records to be skipped, got %d", skipped)
+	}
+
+	tag, events, err := decodeForward(msgpack.NewDecoder(bytes.NewReader(msg)))
+	if err != nil {
+		t.Fatalf("Failed to decode message: %s", err)
+	}
+	if tag != "service.orders" {
+		t.Errorf("unexpected tag %q", tag)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	if !events[0].time.Equal(ts) {
+		t.Errorf("unexpected event time %s", events[0].time)
+	}
+	// Integers above 2^53 are kept exactly
+	tests := map[string]interface{}{
+		"msg":      "one",
+		"order_id": int64(9007199254740993),
+		"max":      uint64(18446744073709551615),
+		"ratio":    0.5,
+	}
+	for k, want := range tests {
+		if have := events[0].record[k]; have != want {
+			t.Errorf("unexpected %s; expected %v (%T), got %v (%T)", k, want, want, have, have)
+		}
+	}
+	if ids, ok := events[1].record["ids"].([]interface{}); !ok || fmt.Sprint(ids) != "[1 2]" {
+		t.Errorf("unexpected ids %#v", events[1].record["ids"])
+	}
+
+	if msg, skipped, err := encodeForward("service.orders", []fluentEntry{{ts: ts, record: []byte("{")}}); msg != nil || skipped != 1 || err != nil {
+		t.Errorf("expected no message when every record is skipped, got %d bytes, %d skipped: %v", len(msg), skipped, err)
+	}
+}
+
+func TestFluentSink(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	type message struct {
+		tag    string
+		events []forwardEvent
+	}
+	messages := make(chan message)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		dec := msgpack.NewDecoder(conn)
+		for {
+			if _, err := dec.PeekCode(); err != nil {
+				return
+			}
+			tag, events, err := decodeForward(dec)
+			if err != nil {
+				t.Errorf("Failed to decode message: %s", err)
+				return
+			}
+			messages <- message{tag, events}
+		}
+	}()
+
+	sink, err := FluentSink(FluentConfig{
+		Address:       ln.Addr().String(),
+		Tag:           "service.test",
+		FlushInterval: time.Hour,
+		BatchSize:     2,
+	}, zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Unable to create sink: %s", err)
+	}
+	logger := zap.New(sink.core())
+
+	// A full batch is sent without waiting for the flush interval
+	logger.Info("one", zap.Int64("big", 1<<62+1))
+	logger.Debug("filtered")
+	logger.Error("two")
+	m := <-messages
+	if m.tag != "service.test" || len(m.events) != 2 {
+		t.Fatalf("expected a batch of 2 events tagged service.test, got %d tagged %s", len(m.events), m.tag)
+	}
+	if m.events[0].record["msg"] != "one" || m.events[0].record["big"] != int64(1<<62+1) {
+		t.Errorf("unexpected record %v", m.events[0].record)
+	}
+	if m.events[1].record["level"] != "error" {
+		t.Errorf("unexpected record %v", m.events[1].record)
+	}
+
+	// Sync sends the rest
+	logger.Info("three")
+	done := make(chan error)
+	go func() { done <- logger.Sync() }()
+	m = <-messages
+	if err := <-done; err != nil {
+		t.Fatalf("Sync returned error: %s", err)
+	}
+	if len(m.events) != 1 || m.events[0].record["msg"] != "three" {
+		t.Errorf("expected the remaining entry to be flushed, got %v", m.events)
+	}
+}
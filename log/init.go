@@ -10,17 +10,77 @@ import (
 	"go.uber.org/zap/zapcore"
 )
 
-func Init(service string) (Factory, metrics.Factory) {
+func Init(service string, opts ...Option) (Factory, metrics.Factory) {
 
 	rand.Seed(int64(time.Now().Nanosecond()))
-	rootLogger, _ := zap.NewDevelopment(
+
+	cfg := initConfig{options: Options{Development: true}}
+	for _, opt := range opts {
+		opt.apply(&cfg)
+	}
+	o := cfg.options
+
+	zapOpts := []zap.Option{
 		zap.AddStacktrace(zapcore.FatalLevel),
-		zap.AddCallerSkip(1),
-	)
+		zap.AddCallerSkip(1 + o.CallerSkip),
+	}
+	if o.DisableCaller {
+		zapOpts = append(zapOpts, zap.WithCaller(false))
+	}
+	if len(o.InitialFields) > 0 {
+		zapOpts = append(zapOpts, zap.Fields(o.fields()...))
+	}
+
+	var hookErr error
+	if cfg.errorCounter != nil {
+		var hook func(zapcore.Entry) error
+		hook, hookErr = NewErrorCounterHook(cfg.errorCounter, service)
+		if hookErr == nil {
+			zapOpts = append(zapOpts, zap.Hooks(hook))
+		}
+	}
+
+	var sinkErr error
+	if cfg.buffer != nil {
+		if len(cfg.sinks) == 0 {
+			var sink Sink
+			if sink, sinkErr = o.defaultSink(); sinkErr == nil {
+				cfg.sinks = []Sink{sink}
+			}
+		}
+		cfg.bufferSinks()
+	}
+
+	var rootLogger *zap.Logger
+	if len(cfg.sinks) > 0 {
+		zapOpts = append([]zap.Option{zap.AddCaller()}, zapOpts...)
+		if o.Development {
+			zapOpts = append(zapOpts, zap.Development())
+		}
+		rootLogger = zap.New(cfg.core(), zapOpts...)
+	} else {
+		zapCfg, err := o.zapConfig()
+		if err == nil {
+			rootLogger, err = zapCfg.Build(zapOpts...)
+		}
+		if err != nil {
+			rootLogger, _ = zap.NewDevelopment(zapOpts...)
+			rootLogger.Warn("Invalid log options, using development defaults", zap.Error(err))
+		}
+	}
+
+	if sinkErr != nil {
+		rootLogger.Warn("Invalid log options, logging is unbuffered", zap.Error(sinkErr))
+	}
+	if hookErr != nil {
+		rootLogger.Warn("Failed to register log entry counter", zap.Error(hookErr))
+	}
 
 	serviceLogger := rootLogger.With(zap.String("service", service))
 
 	metricsFactory := prometheus.New().Namespace(metrics.NSOptions{Name: service, Tags: nil})
 
-	return NewFactory(serviceLogger), metricsFactory
+	levels := newComponentLevels()
+	levels.replace(cfg.componentLevels)
+	return factory{logger: serviceLogger, levels: levels}, metricsFactory
 }
@@ -0,0 +1,126 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Per-component level thresholds for loggers created with
+// Named. A component inherits the level of its nearest
+// configured ancestor ("opa.client" falls back to "opa"), and
+// is unrestricted if none is configured.
+//
+// Component levels can only make a logger quieter than the
+// root logger's own level, never more verbose.
+
+type componentLevels struct {
+	mu     sync.RWMutex
+	levels map[string]zapcore.Level
+}
+
+func newComponentLevels() *componentLevels {
+	return &componentLevels{levels: map[string]zapcore.Level{}}
+}
+
+func (c *componentLevels) set(name string, level zapcore.Level) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.levels[name] = level
+}
+
+func (c *componentLevels) replace(levels map[string]zapcore.Level) {
+	copied := make(map[string]zapcore.Level, len(levels))
+	for name, level := range levels {
+		copied[name] = level
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.levels = copied
+}
+
+func (c *componentLevels) enabled(name string, level zapcore.Level) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for n := name; n != ""; {
+		if l, ok := c.levels[n]; ok {
+			return l.Enabled(level)
+		}
+		i := strings.LastIndex(n, ".")
+		if i < 0 {
+			break
+		}
+		n = n[:i]
+	}
+	return true
+}
+
+type componentCore struct {
+	zapcore.Core
+	name   string
+	levels *componentLevels
+}
+
+func (c componentCore) Enabled(level zapcore.Level) bool {
+	return c.levels.enabled(c.name, level) && c.Core.Enabled(level)
+}
+
+func (c componentCore) With(fields []zapcore.Field) zapcore.Core {
+	return componentCore{Core: c.Core.With(fields), name: c.name, levels: c.levels}
+}
+
+func (c componentCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.levels.enabled(c.name, ent.Level) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// ParseLevels parses component levels such as {"opa": "warn"}, for
+// levels read from config.
+func ParseLevels(levels map[string]string) (map[string]zapcore.Level, error) {
+	parsed := make(map[string]zapcore.Level, len(levels))
+	for component, text := range levels {
+		var level zapcore.Level
+		if err := level.UnmarshalText([]byte(text)); err != nil {
+			return nil, fmt.Errorf("log level of %s: %w", component, err)
+		}
+		parsed[component] = level
+	}
+	return parsed, nil
+}
+
+// LevelsFunc loads the component levels, such as from config.
+type LevelsFunc func(ctx context.Context) (map[string]zapcore.Level, error)
+
+// LevelReloader reloads a Factory's component levels. It implements
+// reload.Reloadable, and fails to reload factories that aren't
+// LevelSetters.
+type LevelReloader struct {
+	factory Factory
+	load    LevelsFunc
+}
+
+// NewLevelReloader returns a LevelReloader replacing the component
+// levels of f with those returned by load.
+func NewLevelReloader(f Factory, load LevelsFunc) *LevelReloader {
+	return &LevelReloader{factory: f, load: load}
+}
+
+// Reload loads the component levels and replaces the current ones with
+// them. The current levels are kept if load fails.
+func (r *LevelReloader) Reload(ctx context.Context) error {
+	setter, ok := r.factory.(LevelSetter)
+	if !ok {
+		return fmt.Errorf("log: %T cannot set component levels", r.factory)
+	}
+	levels, err := r.load(ctx)
+	if err != nil {
+		return err
+	}
+	setter.SetLevels(levels)
+	return nil
+}
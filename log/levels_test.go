@@ -0,0 +1,80 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestNamedLevels(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	f := NewFactory(zap.New(core)).(factory)
+
+	opa := f.Named("opa")
+	client := Named(opa, "client")
+	authn := f.Named("authn")
+
+	f.SetLevel("opa", zapcore.ErrorLevel)
+
+	opa.Bg().Info("suppressed")
+	client.Bg().Info("suppressed by ancestor")
+	authn.Bg().Info("kept")
+	opa.Bg().Error("kept")
+
+	if want, have := 2, logs.Len(); want != have {
+		t.Fatalf("unexpected number of entries; expected %d, got %d", want, have)
+	}
+
+	f.SetLevel("opa.client", zapcore.InfoLevel)
+	client.Bg().Info("kept")
+
+	entries := logs.All()
+	if want, have := "opa.client", entries[len(entries)-1].LoggerName; want != have {
+		t.Errorf("unexpected logger name; expected %s, got %s", want, have)
+	}
+}
+
+func TestLevelReloader(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	f := NewFactory(zap.New(core)).(factory)
+	f.SetLevel("opa", zapcore.ErrorLevel)
+	opa := f.Named("opa")
+	authn := f.Named("authn")
+
+	var load error
+	r := NewLevelReloader(f, func(context.Context) (map[string]zapcore.Level, error) {
+		if load != nil {
+			return nil, load
+		}
+		return ParseLevels(map[string]string{"authn": "warn"})
+	})
+	if err := r.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	opa.Bg().Info("kept, as opa is no longer configured")
+	authn.Bg().Info("suppressed")
+
+	load = errors.New("invalid config")
+	if err := r.Reload(context.Background()); err != load {
+		t.Errorf("expected the load error, got %v", err)
+	}
+	authn.Bg().Info("still suppressed")
+
+	if want, have := 1, logs.Len(); want != have {
+		t.Fatalf("unexpected number of entries; expected %d, got %d", want, have)
+	}
+	if _, err := ParseLevels(map[string]string{"opa": "loud"}); err == nil {
+		t.Errorf("expected an invalid level to fail")
+	}
+
+	r = NewLevelReloader(NewMockLogFactory(), func(context.Context) (map[string]zapcore.Level, error) {
+		return nil, nil
+	})
+	if err := r.Reload(context.Background()); err == nil {
+		t.Errorf("expected reloading a factory without component levels to fail")
+	}
+}
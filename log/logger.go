@@ -14,6 +14,23 @@ type Logger interface {
 	With(fields ...zapcore.Field) Logger
 }
 
+// Warner is implemented by loggers with a Warn level, such as those
+// returned by a Factory from NewFactory. Use Warn to warn with any
+// Logger.
+type Warner interface {
+	Warn(msg string, fields ...zapcore.Field)
+}
+
+// Warn logs msg at Warn level if l is a Warner, and at Info level
+// otherwise.
+func Warn(l Logger, msg string, fields ...zapcore.Field) {
+	if w, ok := l.(Warner); ok {
+		w.Warn(msg, fields...)
+		return
+	}
+	l.Info(msg, fields...)
+}
+
 type logger struct {
 	logger *zap.Logger
 }
@@ -22,6 +39,10 @@ func (l logger) Info(msg string, fields ...zapcore.Field) {
 	l.logger.Info(msg, fields...)
 }
 
+func (l logger) Warn(msg string, fields ...zapcore.Field) {
+	l.logger.Warn(msg, fields...)
+}
+
 func (l logger) Error(msg string, fields ...zapcore.Field) {
 	l.logger.Error(msg, fields...)
 }
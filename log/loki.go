@@ -0,0 +1,309 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Asynchronous Grafana Loki push client for clusters
+// without a log-shipping agent.
+
+// LokiConfig configures a Loki sink.
+type LokiConfig struct {
+	// URL is the Loki base URL, e.g. "http://loki:3100".
+	URL string
+
+	// Labels are attached to every stream, e.g. {"service": "orders"}.
+	// A "level" label, and a "logger" label for named loggers, are added
+	// per entry, so entries can be filtered by level and component.
+	Labels map[string]string
+
+	// TenantID is sent as the X-Scope-OrgID header for multi-tenant
+	// Loki deployments and added as a "tenant" label.
+	TenantID string
+
+	// BatchSize is the maximum number of entries per push. Defaults to 1000.
+	BatchSize int
+
+	// BatchWait is the maximum time an entry waits before being pushed.
+	// Defaults to one second.
+	BatchWait time.Duration
+
+	// BufferSize is the number of entries queued before backpressure
+	// applies. Defaults to 10000.
+	BufferSize int
+
+	// Block makes writers wait for space when the buffer is full.
+	// By default entries are dropped instead, keeping logging off the
+	// request hot path; see LokiDropped.
+	Block bool
+
+	// Client is used for pushes. Defaults to a client with a 10 second timeout.
+	Client *http.Client
+}
+
+type lokiEntry struct {
+	level  string
+	logger string
+	ts     time.Time
+	line   string
+}
+
+type lokiWriter struct {
+	cfg     LokiConfig
+	pushURL string
+	entries chan lokiEntry
+	flush   chan chan struct{}
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+var lokiDropped uint64
+
+// LokiDropped returns the number of entries dropped because a Loki
+// sink's buffer was full.
+func LokiDropped() uint64 {
+	return atomic.LoadUint64(&lokiDropped)
+}
+
+// LokiSink returns a Sink that batches entries and pushes them to Loki
+// from a background goroutine. Sync flushes any pending entries, and
+// the returned Sink's Close flushes them and stops the goroutine.
+func LokiSink(cfg LokiConfig, level zapcore.LevelEnabler) (Sink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return Sink{}, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return Sink{}, fmt.Errorf("invalid Loki URL %q", cfg.URL)
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1000
+	}
+	if cfg.BatchWait <= 0 {
+		cfg.BatchWait = time.Second
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 10000
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	w := &lokiWriter{
+		cfg:     cfg,
+		pushURL: strings.TrimRight(cfg.URL, "/") + "/loki/api/v1/push",
+		entries: make(chan lokiEntry, cfg.BufferSize),
+		flush:   make(chan chan struct{}),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go w.run()
+
+	encCfg := zap.NewProductionEncoderConfig()
+	// Loki records the timestamp, and the level is a label
+	encCfg.TimeKey = ""
+	encCfg.LevelKey = ""
+	return Sink{
+		Encoder: zapcore.NewJSONEncoder(encCfg),
+		Writer:  w,
+		Level:   level,
+	}, nil
+}
+
+// WriteEntry queues an entry for the next push.
+func (w *lokiWriter) WriteEntry(ent zapcore.Entry, p []byte) error {
+	e := lokiEntry{
+		level:  ent.Level.String(),
+		logger: ent.LoggerName,
+		ts:     ent.Time,
+		line:   strings.TrimRight(string(p), "\n"),
+	}
+	select {
+	case <-w.stop:
+		atomic.AddUint64(&lokiDropped, 1)
+		return nil
+	default:
+	}
+	if w.cfg.Block {
+		select {
+		case w.entries <- e:
+		case <-w.stopped:
+			atomic.AddUint64(&lokiDropped, 1)
+		}
+		return nil
+	}
+	select {
+	case w.entries <- e:
+	default:
+		atomic.AddUint64(&lokiDropped, 1)
+	}
+	return nil
+}
+
+func (w *lokiWriter) Write(p []byte) (int, error) {
+	err := w.WriteEntry(zapcore.Entry{Level: zapcore.InfoLevel, Time: time.Now()}, p)
+	return len(p), err
+}
+
+// Sync pushes all queued entries, waiting up to BatchWait plus the
+// client timeout.
+func (w *lokiWriter) Sync() error {
+	done := make(chan struct{})
+	select {
+	case w.flush <- done:
+	case <-w.stopped:
+		return nil
+	case <-time.After(w.cfg.BatchWait):
+		return errors.New("timed out waiting for Loki flush")
+	}
+	<-done
+	return nil
+}
+
+// Close pushes all queued entries and stops the background goroutine.
+// Entries written after Close are dropped.
+func (w *lokiWriter) Close() error {
+	w.once.Do(func() { close(w.stop) })
+	<-w.stopped
+	return nil
+}
+
+func (w *lokiWriter) run() {
+	defer close(w.stopped)
+	ticker := time.NewTicker(w.cfg.BatchWait)
+	defer ticker.Stop()
+	batch := make([]lokiEntry, 0, w.cfg.BatchSize)
+	for {
+		select {
+		case e := <-w.entries:
+			batch = append(batch, e)
+			if len(batch) >= w.cfg.BatchSize {
+				w.push(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				w.push(batch)
+				batch = batch[:0]
+			}
+		case done := <-w.flush:
+			// Drain whatever is queued at the time of the flush
+			for n := len(w.entries); n > 0; n-- {
+				batch = append(batch, <-w.entries)
+			}
+			if len(batch) > 0 {
+				w.push(batch)
+				batch = batch[:0]
+			}
+			close(done)
+		case <-w.stop:
+			for n := len(w.entries); n > 0; n-- {
+				batch = append(batch, <-w.entries)
+			}
+			if len(batch) > 0 {
+				w.push(batch)
+			}
+			return
+		}
+	}
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+type lokiPushRequest struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+// labels returns the labels of the stream of e: the configured labels,
+// the tenant, and e's level and logger name.
+func (w *lokiWriter) labels(e lokiEntry) map[string]string {
+	labels := make(map[string]string, len(w.cfg.Labels)+3)
+	for k, v := range w.cfg.Labels {
+		labels[k] = v
+	}
+	if w.cfg.TenantID != "" {
+		labels["tenant"] = w.cfg.TenantID
+	}
+	labels["level"] = e.level
+	if e.logger != "" {
+		labels["logger"] = e.logger
+	}
+	return labels
+}
+
+func (w *lokiWriter) push(batch []lokiEntry) {
+	type streamKey struct{ level, logger string }
+	streams := map[streamKey]int{}
+	req := lokiPushRequest{}
+	for _, e := range batch {
+		key := streamKey{e.level, e.logger}
+		i, ok := streams[key]
+		if !ok {
+			req.Streams = append(req.Streams, lokiStream{Stream: w.labels(e)})
+			i = len(req.Streams) - 1
+			streams[key] = i
+		}
+		req.Streams[i].Values = append(req.Streams[i].Values, [2]string{strconv.FormatInt(e.ts.UnixNano(), 10), e.line})
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "loki: failed to encode push request: %v\n", err)
+		return
+	}
+
+	backoff := 250 * time.Millisecond
+	for attempt := 0; attempt < 3; attempt++ {
+		retry, err := w.send(body)
+		if err == nil {
+			return
+		}
+		if !retry {
+			fmt.Fprintf(os.Stderr, "loki: push failed: %v\n", err)
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	fmt.Fprintf(os.Stderr, "loki: push failed after retries, dropped %d entries\n", len(batch))
+}
+
+func (w *lokiWriter) send(body []byte) (retry bool, err error) {
+	r, err := http.NewRequest(http.MethodPost, w.pushURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	if w.cfg.TenantID != "" {
+		r.Header.Set("X-Scope-OrgID", w.cfg.TenantID)
+	}
+	resp, err := w.cfg.Client.Do(r)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode/100 == 2:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5:
+		return true, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+}
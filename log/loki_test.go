@@ -0,0 +1,155 @@
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLokiSink(t *testing.T) {
+	var pushes []lokiPushRequest
+	var tenant string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req lokiPushRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode push: %s", err)
+		}
+		pushes = append(pushes, req)
+		tenant = r.Header.Get("X-Scope-OrgID")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sink, err := LokiSink(LokiConfig{
+		URL:      srv.URL,
+		Labels:   map[string]string{"service": "test"},
+		TenantID: "acme",
+	}, zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Unable to create sink: %s", err)
+	}
+
+	logger := zap.New(sink.core())
+	logger.Info("one")
+	logger.Error("two")
+	logger.Info("three")
+	if err := logger.Sync(); err != nil {
+		t.Fatalf("Sync returned error: %s", err)
+	}
+
+	if len(pushes) != 1 {
+		t.Fatalf("expected a single push, got %d", len(pushes))
+	}
+	if want, have := "acme", tenant; want != have {
+		t.Errorf("unexpected tenant header; expected %s, got %s", want, have)
+	}
+	streams := pushes[0].Streams
+	if len(streams) != 2 {
+		t.Fatalf("expected a stream per level, got %d", len(streams))
+	}
+	for _, s := range streams {
+		if s.Stream["service"] != "test" || s.Stream["tenant"] != "acme" {
+			t.Errorf("stream missing labels: %v", s.Stream)
+		}
+		if s.Stream["level"] == "info" && len(s.Values) != 2 {
+			t.Errorf("expected 2 info entries, got %d", len(s.Values))
+		}
+	}
+}
+
+func TestLokiSinkLoggerLabel(t *testing.T) {
+	var req lokiPushRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode push: %s", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sink, err := LokiSink(LokiConfig{
+		URL:    srv.URL,
+		Labels: map[string]string{"service": "test", "level": "ignored"},
+	}, zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Unable to create sink: %s", err)
+	}
+	logger := zap.New(sink.core())
+	logger.Info("one")
+	logger.Named("db").Info("two")
+	logger.Named("db").Warn("three")
+	if err := logger.Sync(); err != nil {
+		t.Fatalf("Sync returned error: %s", err)
+	}
+
+	tests := []map[string]string{
+		{"service": "test", "level": "info"},
+		{"service": "test", "level": "info", "logger": "db"},
+		{"service": "test", "level": "warn", "logger": "db"},
+	}
+	if len(req.Streams) != len(tests) {
+		t.Fatalf("expected a stream per level and logger, got %v", req.Streams)
+	}
+	for i, labels := range tests {
+		if s := req.Streams[i]; !reflect.DeepEqual(s.Stream, labels) || len(s.Values) != 1 {
+			t.Errorf("stream %d: expected labels %v with an entry, got %v with %d", i, labels, s.Stream, len(s.Values))
+		}
+	}
+}
+
+func TestLokiSinkClose(t *testing.T) {
+	var mu sync.Mutex
+	var entries int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req lokiPushRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode push: %s", err)
+		}
+		mu.Lock()
+		for _, s := range req.Streams {
+			entries += len(s.Values)
+		}
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sink, err := LokiSink(LokiConfig{URL: srv.URL, BatchWait: time.Hour, Block: true}, zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Unable to create sink: %s", err)
+	}
+	logger := zap.New(sink.core())
+	logger.Info("one")
+	logger.Info("two")
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close returned error: %s", err)
+	}
+
+	w := sink.Writer.(*lokiWriter)
+	select {
+	case <-w.stopped:
+	default:
+		t.Fatal("expected the push goroutine to have stopped")
+	}
+	mu.Lock()
+	if want, have := 2, entries; want != have {
+		t.Errorf("expected %d entries pushed on Close, got %d", want, have)
+	}
+	mu.Unlock()
+
+	// Writes and syncs after Close must not block
+	logger.Info("three")
+	if err := logger.Sync(); err != nil {
+		t.Errorf("Sync after Close returned error: %s", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Errorf("second Close returned error: %s", err)
+	}
+}
@@ -0,0 +1,45 @@
+package log
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap/zapcore"
+)
+
+// ErrorCounter counts Warn, Error and Fatal entries in a Prometheus
+// counter labelled by level and logger name, so alerts can be driven
+// by the log error rate without a log pipeline. A nil registerer uses
+// prometheus.DefaultRegisterer.
+func ErrorCounter(registerer prometheus.Registerer) Option {
+	return optionFunc(func(c *initConfig) {
+		if registerer == nil {
+			registerer = prometheus.DefaultRegisterer
+		}
+		c.errorCounter = registerer
+	})
+}
+
+// NewErrorCounterHook registers the log entry counter with registerer and
+// returns a zap hook that increments it, for use with zap.Hooks when
+// building a logger outside of Init.
+func NewErrorCounterHook(registerer prometheus.Registerer, service string) (func(zapcore.Entry) error, error) {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "log_entries_total",
+		Help:        "Number of log entries at warn level or above.",
+		ConstLabels: prometheus.Labels{"service": service},
+	}, []string{"level", "logger"})
+
+	if err := registerer.Register(counter); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			return nil, err
+		}
+		counter = are.ExistingCollector.(*prometheus.CounterVec)
+	}
+
+	return func(ent zapcore.Entry) error {
+		if ent.Level >= zapcore.WarnLevel {
+			counter.WithLabelValues(ent.Level.String(), ent.LoggerName).Inc()
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,67 @@
+package log
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestErrorCounter(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	var buf bytes.Buffer
+	factory, _ := Init("test", ErrorCounter(registry), Tee(WriterSink(zapcore.AddSync(&buf), zapcore.InfoLevel)))
+
+	factory.Bg().Info("info")
+	Warn(factory.Bg(), "warn")
+	db := Named(factory, "db").Bg()
+	db.Error("error")
+	db.Error("error")
+
+	// A second hook shares the registered counter
+	hook, err := NewErrorCounterHook(registry, "test")
+	if err != nil {
+		t.Fatalf("NewErrorCounterHook returned error: %s", err)
+	}
+	hook(zapcore.Entry{Level: zapcore.DebugLevel})
+	hook(zapcore.Entry{Level: zapcore.ErrorLevel, LoggerName: "db"})
+
+	tests := []struct {
+		level, logger string
+		count         float64
+	}{
+		{"debug", "", 0},
+		{"info", "", 0},
+		{"warn", "", 1},
+		{"error", "db", 3},
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[[2]string]float64{}
+	for _, mf := range families {
+		if mf.GetName() != "log_entries_total" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["service"] != "test" {
+				t.Errorf("expected the service label, got %v", labels)
+			}
+			counts[[2]string{labels["level"], labels["logger"]}] = m.GetCounter().GetValue()
+		}
+	}
+	for _, tt := range tests {
+		if count := counts[[2]string{tt.level, tt.logger}]; count != tt.count {
+			t.Errorf("%s entries of %q: expected %v, got %v", tt.level, tt.logger, tt.count, count)
+		}
+	}
+	if len(counts) != 2 {
+		t.Errorf("expected only the warn and error series, got %v", counts)
+	}
+}
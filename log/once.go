@@ -0,0 +1,24 @@
+package log
+
+import (
+	"sync"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// WarnOnce logs msg with Warn the first time key is seen in this
+// process, and does nothing afterwards. Use it for deprecation
+// warnings and configuration fallbacks on repeated code paths.
+func WarnOnce(l Logger, key string, msg string, fields ...zapcore.Field) {
+	if firstOccurrence(key) {
+		Warn(l, msg, fields...)
+	}
+}
+
+// Keys already logged by WarnOnce, for the lifetime of the process.
+var seenKeys sync.Map
+
+func firstOccurrence(key string) bool {
+	_, loaded := seenKeys.LoadOrStore(key, struct{}{})
+	return !loaded
+}
@@ -0,0 +1,42 @@
+package log
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestWarnOnce(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	f := NewFactory(zap.New(core))
+
+	for i := 0; i < 3; i++ {
+		WarnOnce(f.Bg(), "test-deprecated", "deprecated option used")
+		WarnOnce(f.With(zap.Int("i", i)).Bg(), "test-deprecated", "deprecated option used")
+	}
+	WarnOnce(f.Bg(), "test-fallback", "falling back to default")
+
+	if want, have := 2, logs.FilterMessage("deprecated option used").Len()+logs.FilterMessage("falling back to default").Len(); want != have {
+		t.Errorf("expected one entry per key; expected %d, got %d", want, have)
+	}
+}
+
+// infoLogger is a Logger without a Warn level.
+type infoLogger struct {
+	mocklogger
+	infos *[]string
+}
+
+func (l infoLogger) Info(msg string, fields ...zapcore.Field) {
+	*l.infos = append(*l.infos, msg)
+}
+
+func TestWarnWithoutWarner(t *testing.T) {
+	var infos []string
+	Warn(infoLogger{infos: &infos}, "falling back to info")
+	if len(infos) != 1 {
+		t.Errorf("expected Warn to log at info for loggers without Warn, got %v", infos)
+	}
+}
@@ -0,0 +1,170 @@
+package log
+
+import (
+	"os"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Option configures the root logger built by Init.
+type Option interface {
+	apply(*initConfig)
+}
+
+type optionFunc func(*initConfig)
+
+func (f optionFunc) apply(c *initConfig) {
+	f(c)
+}
+
+type initConfig struct {
+	options         Options
+	sinks           []Sink
+	componentLevels map[string]zapcore.Level
+	errorCounter    prometheus.Registerer
+	buffer          *zapcore.BufferedWriteSyncer
+}
+
+// Options configures the root logger's encoding, level and caller
+// annotation. Passing Options to Init replaces the default, which is
+// zap's development configuration.
+type Options struct {
+	// Encoding is "json" or "console". Defaults to "console" in
+	// development and "json" otherwise. Ignored when Tee is used,
+	// as each Sink has its own encoder.
+	Encoding string
+
+	// Level is the minimum level logged, e.g. "debug" or "warn".
+	// Defaults to "debug" in development and "info" otherwise.
+	// Ignored when Tee is used, as each Sink has its own level.
+	Level string
+
+	// CallerSkip is the number of additional stack frames to skip when
+	// annotating entries with their caller, for services that wrap the
+	// Logger in their own helpers.
+	CallerSkip int
+
+	// DisableCaller turns off caller annotation entirely.
+	DisableCaller bool
+
+	// Development enables zap's development mode: console output,
+	// debug level, and panics on DPanic.
+	Development bool
+
+	// InitialFields are added to every entry.
+	InitialFields map[string]interface{}
+}
+
+func (o Options) apply(c *initConfig) {
+	c.options = o
+}
+
+func (o Options) zapConfig() (zap.Config, error) {
+	var cfg zap.Config
+	if o.Development {
+		cfg = zap.NewDevelopmentConfig()
+	} else {
+		cfg = zap.NewProductionConfig()
+		cfg.Sampling = nil
+	}
+	if o.Encoding != "" {
+		cfg.Encoding = o.Encoding
+	}
+	if o.Level != "" {
+		var level zapcore.Level
+		if err := level.UnmarshalText([]byte(o.Level)); err != nil {
+			return cfg, err
+		}
+		cfg.Level.SetLevel(level)
+	}
+	return cfg, nil
+}
+
+// defaultSink returns a Sink equivalent to the output zap would build
+// from these options, for use when the output needs wrapping.
+func (o Options) defaultSink() (Sink, error) {
+	cfg, err := o.zapConfig()
+	if err != nil {
+		return Sink{}, err
+	}
+	var enc zapcore.Encoder
+	if cfg.Encoding == "console" {
+		enc = zapcore.NewConsoleEncoder(cfg.EncoderConfig)
+	} else {
+		enc = zapcore.NewJSONEncoder(cfg.EncoderConfig)
+	}
+	return Sink{
+		Encoder: enc,
+		Writer:  zapcore.Lock(os.Stderr),
+		Level:   cfg.Level,
+	}, nil
+}
+
+func (o Options) fields() []zapcore.Field {
+	keys := make([]string, 0, len(o.InitialFields))
+	for k := range o.InitialFields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fields := make([]zapcore.Field, 0, len(keys))
+	for _, k := range keys {
+		fields = append(fields, zap.Any(k, o.InitialFields[k]))
+	}
+	return fields
+}
+
+// Tee sends log output to each of the given sinks simultaneously,
+// replacing the default development output. Each sink applies
+// its own level threshold.
+func Tee(sinks ...Sink) Option {
+	return optionFunc(func(c *initConfig) {
+		c.sinks = append(c.sinks, sinks...)
+	})
+}
+
+// ComponentLevel sets the initial level of a component logger
+// created with Named. See LevelSetter.
+func ComponentLevel(component string, level zapcore.Level) Option {
+	return optionFunc(func(c *initConfig) {
+		if c.componentLevels == nil {
+			c.componentLevels = map[string]zapcore.Level{}
+		}
+		c.componentLevels[component] = level
+	})
+}
+
+// Buffered moves log I/O off the calling goroutine by buffering up to
+// size bytes per output and flushing in the background at least every
+// flushInterval. Zero values use zap's defaults (256 kB, 30 seconds).
+// Call Sync during shutdown to flush buffered entries. Sinks
+// that are already asynchronous, such as Loki, are not wrapped.
+func Buffered(size int, flushInterval time.Duration) Option {
+	return optionFunc(func(c *initConfig) {
+		c.buffer = &zapcore.BufferedWriteSyncer{Size: size, FlushInterval: flushInterval}
+	})
+}
+
+func (c *initConfig) bufferSinks() {
+	for i, s := range c.sinks {
+		if _, ok := s.Writer.(EntryWriter); ok {
+			continue
+		}
+		c.sinks[i].Writer = &zapcore.BufferedWriteSyncer{
+			WS:            s.Writer,
+			Size:          c.buffer.Size,
+			FlushInterval: c.buffer.FlushInterval,
+		}
+	}
+}
+
+func (c *initConfig) core() zapcore.Core {
+	cores := make([]zapcore.Core, 0, len(c.sinks))
+	for _, s := range c.sinks {
+		cores = append(cores, s.core())
+	}
+	return zapcore.NewTee(cores...)
+}
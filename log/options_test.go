@@ -0,0 +1,99 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestOptionsZapConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		encoding string
+		level    zapcore.Level
+		err      bool
+	}{
+		{"development", Options{Development: true}, "console", zapcore.DebugLevel, false},
+		{"production", Options{}, "json", zapcore.InfoLevel, false},
+		{"encoding", Options{Development: true, Encoding: "json"}, "json", zapcore.DebugLevel, false},
+		{"level", Options{Level: "warn"}, "json", zapcore.WarnLevel, false},
+		{"invalid level", Options{Level: "loud"}, "", 0, true},
+	}
+	for _, tt := range tests {
+		cfg, err := tt.opts.zapConfig()
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if cfg.Encoding != tt.encoding || cfg.Level.Level() != tt.level {
+			t.Errorf("%s: expected %s at %s, got %s at %s", tt.name, tt.encoding, tt.level, cfg.Encoding, cfg.Level.Level())
+		}
+	}
+}
+
+func TestOptionsFieldsAndCaller(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   Options
+		caller string
+	}{
+		{"caller", Options{}, "log/options_test.go"},
+		{"caller skip", Options{CallerSkip: 1}, "testing/testing.go"},
+		{"disable caller", Options{DisableCaller: true}, ""},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		tt.opts.InitialFields = map[string]interface{}{"region": "us-east-1", "version": 2}
+		factory, _ := Init("test", tt.opts, Tee(WriterSink(zapcore.AddSync(&buf), zapcore.InfoLevel)))
+		factory.Bg().Info("hello")
+
+		var entry map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatalf("%s: entry is not JSON: %q", tt.name, buf.String())
+		}
+		if entry["region"] != "us-east-1" || entry["version"] != float64(2) || entry["service"] != "test" {
+			t.Errorf("%s: expected the initial fields, got %v", tt.name, entry)
+		}
+		caller, _ := entry["caller"].(string)
+		if tt.caller == "" && caller != "" || !strings.Contains(caller, tt.caller) {
+			t.Errorf("%s: expected caller %q, got %q", tt.name, tt.caller, caller)
+		}
+	}
+}
+
+func TestBuffered(t *testing.T) {
+	var buf bytes.Buffer
+	entries := &recordingEntryWriter{}
+	factory, _ := Init("test", Buffered(0, time.Hour), Tee(
+		WriterSink(zapcore.AddSync(&buf), zapcore.InfoLevel),
+		Sink{Writer: entries, Level: zapcore.InfoLevel},
+	))
+
+	factory.Bg().Info("one")
+	factory.Bg().Error("two")
+	if buf.Len() != 0 {
+		t.Errorf("expected entries to be buffered until Sync, got %q", buf.String())
+	}
+	// Entry writers are asynchronous already, so they aren't buffered
+	if msgs := messages(t, &entries.Buffer); len(msgs) != 2 {
+		t.Errorf("expected entry writers to get entries unbuffered, got %v", msgs)
+	}
+
+	if err := Sync(factory); err != nil {
+		t.Fatalf("Sync returned error: %s", err)
+	}
+	if msgs := messages(t, &buf); strings.Join(msgs, ",") != "one,two" {
+		t.Errorf("expected Sync to flush the buffered entries, got %v", msgs)
+	}
+}
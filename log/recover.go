@@ -0,0 +1,51 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// RecoverAndLog recovers from a panic and logs the panic value and
+// stack at Error level. It must be deferred directly:
+//
+//	go func() {
+//		defer log.RecoverAndLog(ctx, logger)
+//		...
+//	}()
+func RecoverAndLog(ctx context.Context, factory Factory) {
+	if r := recover(); r != nil {
+		LogPanic(ctx, factory, r)
+	}
+}
+
+// RecoverLogAndRepanic is like RecoverAndLog but re-panics with the
+// original value after logging, for call sites where the panic must
+// still propagate.
+func RecoverLogAndRepanic(ctx context.Context, factory Factory) {
+	if r := recover(); r != nil {
+		LogPanic(ctx, factory, r)
+		panic(r)
+	}
+}
+
+// LogPanic logs a value returned by recover() along with the current
+// stack. It is intended for code that recovers itself, such as the
+// transport recovery middleware.
+func LogPanic(ctx context.Context, factory Factory, recovered interface{}) {
+	factory.For(ctx).Error("Recovered from panic", PanicFields(recovered)...)
+}
+
+// PanicFields returns the fields used to log a recovered panic value.
+func PanicFields(recovered interface{}) []zapcore.Field {
+	fields := make([]zapcore.Field, 0, 2)
+	if err, ok := recovered.(error); ok {
+		fields = append(fields, zap.Error(err))
+	} else {
+		fields = append(fields, zap.String("panic", fmt.Sprint(recovered)))
+	}
+	return append(fields, zap.ByteString("stack", debug.Stack()))
+}
@@ -0,0 +1,71 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRecoverAndLog(t *testing.T) {
+	boom := errors.New("boom")
+	tests := []struct {
+		name    string
+		recover func(context.Context, Factory)
+		value   interface{}
+		field   string
+		repanic bool
+	}{
+		{"error", RecoverAndLog, boom, "error", false},
+		{"value", RecoverAndLog, "nil map", "panic", false},
+		{"repanic error", RecoverLogAndRepanic, boom, "error", true},
+		{"repanic value", RecoverLogAndRepanic, 42, "panic", true},
+	}
+	for _, tt := range tests {
+		core, logs := observer.New(zapcore.DebugLevel)
+		factory := NewFactory(zap.New(core))
+
+		var repanicked interface{}
+		func() {
+			defer func() { repanicked = recover() }()
+			defer tt.recover(context.Background(), factory)
+			panic(tt.value)
+		}()
+
+		if tt.repanic && repanicked != tt.value {
+			t.Errorf("%s: expected a panic with %v, got %v", tt.name, tt.value, repanicked)
+		}
+		if !tt.repanic && repanicked != nil {
+			t.Errorf("%s: expected the panic to be swallowed, got %v", tt.name, repanicked)
+		}
+		entries := logs.All()
+		if len(entries) != 1 || entries[0].Level != zapcore.ErrorLevel {
+			t.Fatalf("%s: expected an error entry, got %v", tt.name, entries)
+		}
+		fields := entries[0].ContextMap()
+		if _, ok := fields[tt.field]; !ok {
+			t.Errorf("%s: expected a %s field, got %v", tt.name, tt.field, fields)
+		}
+		if stack, _ := fields["stack"].(string); !strings.Contains(stack, "TestRecoverAndLog") {
+			t.Errorf("%s: expected the panicking stack, got %q", tt.name, stack)
+		}
+	}
+}
+
+func TestRecoverAndLogWithoutPanic(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	factory := NewFactory(zap.New(core))
+	func() {
+		defer RecoverAndLog(context.Background(), factory)
+	}()
+	func() {
+		defer RecoverLogAndRepanic(context.Background(), factory)
+	}()
+	if logs.Len() != 0 {
+		t.Errorf("expected nothing logged without a panic, got %v", logs.All())
+	}
+}
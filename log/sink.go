@@ -0,0 +1,136 @@
+package log
+
+import (
+	"io"
+	"os"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Sink is a single log destination used with the Tee option.
+type Sink struct {
+	// Encoder formats entries for this sink. Defaults to a JSON encoder
+	// using zap's production encoder config.
+	Encoder zapcore.Encoder
+
+	// Writer receives the encoded entries.
+	Writer zapcore.WriteSyncer
+
+	// Level is the minimum level written to this sink. Defaults to Info.
+	Level zapcore.LevelEnabler
+}
+
+// Close releases the sink's writer, for example stopping the
+// background goroutine of a Loki sink. It is a no-op unless the
+// writer implements io.Closer.
+func (s Sink) Close() error {
+	if c, ok := s.Writer.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (s Sink) core() zapcore.Core {
+	enc := s.Encoder
+	if enc == nil {
+		enc = zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	}
+	lvl := s.Level
+	if lvl == nil {
+		lvl = zapcore.InfoLevel
+	}
+	if ew, ok := s.Writer.(EntryWriter); ok {
+		return entryCore{LevelEnabler: lvl, enc: enc, out: s.Writer, ew: ew}
+	}
+	return zapcore.NewCore(enc, s.Writer, lvl)
+}
+
+// StdoutSink returns a Sink writing JSON to stdout at or above level.
+func StdoutSink(level zapcore.LevelEnabler) Sink {
+	return Sink{
+		Writer: zapcore.Lock(os.Stdout),
+		Level:  level,
+	}
+}
+
+// StderrSink returns a Sink writing JSON to stderr at or above level.
+func StderrSink(level zapcore.LevelEnabler) Sink {
+	return Sink{
+		Writer: zapcore.Lock(os.Stderr),
+		Level:  level,
+	}
+}
+
+// FileSink returns a Sink appending JSON to the file at path at or
+// above level, creating the file if necessary.
+func FileSink(path string, level zapcore.LevelEnabler) (Sink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return Sink{}, err
+	}
+	return Sink{
+		Writer: zapcore.Lock(f),
+		Level:  level,
+	}, nil
+}
+
+// WriterSink returns a Sink writing JSON to an arbitrary writer,
+// such as a connection to a remote collector, at or above level.
+func WriterSink(w zapcore.WriteSyncer, level zapcore.LevelEnabler) Sink {
+	return Sink{
+		Writer: zapcore.Lock(w),
+		Level:  level,
+	}
+}
+
+// EntryWriter is implemented by sink writers that need the entry
+// metadata as well as the encoded bytes, for example to map the
+// level to a syslog priority. Sink uses WriteEntry in preference
+// to Write when its Writer implements this interface.
+type EntryWriter interface {
+	WriteEntry(ent zapcore.Entry, p []byte) error
+}
+
+type entryCore struct {
+	zapcore.LevelEnabler
+	enc zapcore.Encoder
+	out zapcore.WriteSyncer
+	ew  EntryWriter
+}
+
+func (c entryCore) With(fields []zapcore.Field) zapcore.Core {
+	enc := c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	return entryCore{LevelEnabler: c.LevelEnabler, enc: enc, out: c.out, ew: c.ew}
+}
+
+func (c entryCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c entryCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	err = c.ew.WriteEntry(ent, buf.Bytes())
+	buf.Free()
+	if err != nil {
+		return err
+	}
+	if ent.Level > zapcore.ErrorLevel {
+		// Flush before a panic or fatal exit, as zap's ioCore does
+		c.Sync()
+	}
+	return nil
+}
+
+func (c entryCore) Sync() error {
+	return c.out.Sync()
+}
@@ -0,0 +1,77 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// messages returns the messages of the JSON entries written to buf.
+func messages(t *testing.T, buf *bytes.Buffer) []string {
+	t.Helper()
+	var msgs []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("entry is not JSON: %q", line)
+		}
+		msgs = append(msgs, entry["msg"].(string))
+	}
+	return msgs
+}
+
+type recordingEntryWriter struct {
+	bytes.Buffer
+	levels []zapcore.Level
+}
+
+func (w *recordingEntryWriter) WriteEntry(ent zapcore.Entry, p []byte) error {
+	w.levels = append(w.levels, ent.Level)
+	_, err := w.Write(p)
+	return err
+}
+
+func (w *recordingEntryWriter) Sync() error {
+	return nil
+}
+
+func TestTee(t *testing.T) {
+	var info, warn, errs bytes.Buffer
+	entries := &recordingEntryWriter{}
+	factory, _ := Init("test", Tee(
+		WriterSink(zapcore.AddSync(&info), zapcore.InfoLevel),
+		WriterSink(zapcore.AddSync(&warn), zapcore.WarnLevel),
+		WriterSink(zapcore.AddSync(&errs), zapcore.ErrorLevel),
+		Sink{Writer: entries, Level: zapcore.WarnLevel},
+	))
+
+	logger := factory.Bg()
+	logger.Info("info")
+	Warn(logger, "warn")
+	logger.Error("error")
+
+	tests := []struct {
+		name string
+		buf  *bytes.Buffer
+		msgs []string
+	}{
+		{"info", &info, []string{"info", "warn", "error"}},
+		{"warn", &warn, []string{"warn", "error"}},
+		{"error", &errs, []string{"error"}},
+		{"entry writer", &entries.Buffer, []string{"warn", "error"}},
+	}
+	for _, tt := range tests {
+		if msgs := messages(t, tt.buf); strings.Join(msgs, ",") != strings.Join(tt.msgs, ",") {
+			t.Errorf("%s sink: expected %v, got %v", tt.name, tt.msgs, msgs)
+		}
+	}
+	if len(entries.levels) != 2 || entries.levels[0] != zapcore.WarnLevel || entries.levels[1] != zapcore.ErrorLevel {
+		t.Errorf("expected the entry writer to get each entry's level, got %v", entries.levels)
+	}
+}
@@ -24,6 +24,11 @@ func (sl spanLogger) Info(msg string, fields ...zapcore.Field) {
 	sl.logger.Info(msg, append(sl.spanFields, fields...)...)
 }
 
+func (sl spanLogger) Warn(msg string, fields ...zapcore.Field) {
+	sl.logToSpan("warn", msg, fields...)
+	sl.logger.Warn(msg, append(sl.spanFields, fields...)...)
+}
+
 func (sl spanLogger) Error(msg string, fields ...zapcore.Field) {
 	sl.logToSpan("error", msg, fields...)
 	sl.logger.Error(msg, append(sl.spanFields, fields...)...)
@@ -0,0 +1,68 @@
+package log
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSyslogSink(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %s", err)
+	}
+	defer pc.Close()
+
+	sink, err := SyslogSink(SyslogConfig{
+		Network:  "udp",
+		Address:  pc.LocalAddr().String(),
+		Facility: FacilityLocal0,
+		AppName:  "test",
+		Hostname: "host",
+	}, zapcore.InfoLevel)
+	if err != nil {
+		t.Fatalf("Unable to create sink: %s", err)
+	}
+
+	logger := zap.New(sink.core())
+	logger.Error("something failed", zap.String("key", "value"))
+
+	buf := make([]byte, 1024)
+	pc.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Failed to read syslog message: %s", err)
+	}
+	msg := string(buf[:n])
+
+	// local0 (16) * 8 + error (3)
+	if !strings.HasPrefix(msg, "<131>1 ") {
+		t.Errorf("unexpected priority header: %s", msg)
+	}
+	if !strings.Contains(msg, " host test ") {
+		t.Errorf("message should contain hostname and app name: %s", msg)
+	}
+	if !strings.Contains(msg, `"msg":"something failed"`) || !strings.Contains(msg, `"key":"value"`) {
+		t.Errorf("message should contain the encoded entry: %s", msg)
+	}
+}
+
+func TestSyslogHeaderLimits(t *testing.T) {
+	w := &syslogWriter{cfg: SyslogConfig{Network: "udp", AppName: "test", Hostname: "host"}}
+	ent := zapcore.Entry{
+		Level:      zapcore.InfoLevel,
+		Time:       time.Now(),
+		LoggerName: "orders.fulfilment.warehouse allocation.reservations",
+	}
+	fields := strings.SplitN(string(w.format(ent, []byte("{}\n"))), " ", 8)
+	if len(fields) != 8 {
+		t.Fatalf("malformed message: %q", fields)
+	}
+	if want, have := "orders.fulfilment.warehouse_allo", fields[5]; want != have {
+		t.Errorf("unexpected MSGID; expected %s, got %s", want, have)
+	}
+}
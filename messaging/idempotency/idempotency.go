@@ -0,0 +1,146 @@
+// Package idempotency makes message handlers safe to run on at-least-once
+// brokers by skipping messages whose ID has already been handled:
+//
+//	store := idempotency.NewRedisStore(client, "orders-consumer:")
+//	handler := idempotency.NewHandler(store, handleOrder, logger)
+//	consumer := kafka.NewConsumer(cfg, handler, logger, tracer)
+//
+// A message is claimed for a lease before the handler runs and marked
+// done, for the TTL, once it succeeds. If the handler fails the claim is
+// released so the broker's retry runs it again; if the consumer crashes
+// the lease expires. A duplicate arriving while the original is being
+// handled fails with ErrInProgress and is retried by the broker.
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/messaging"
+	"github.com/jdotw/go-utils/outbox"
+	"go.uber.org/zap"
+)
+
+// ErrInProgress is returned for a message another consumer is handling.
+var ErrInProgress = errors.New("message is being handled by another consumer")
+
+// Status is the state of a message ID in a Store.
+type Status int
+
+const (
+	// Claimed means the caller now holds the message and should handle
+	// it.
+	Claimed Status = iota
+	// InProgress means another consumer holds an unexpired claim.
+	InProgress
+	// Done means the message has already been handled.
+	Done
+)
+
+// Store records which message IDs have been handled.
+type Store interface {
+	// Claim atomically claims id for lease unless it is claimed or done.
+	Claim(ctx context.Context, id string, lease time.Duration) (Status, error)
+	// Complete marks a claimed id done for ttl.
+	Complete(ctx context.Context, id string, ttl time.Duration) error
+	// Release drops a claim on id that has not completed.
+	Release(ctx context.Context, id string) error
+}
+
+// IDFunc returns a message's ID, or an empty string if it has none.
+type IDFunc func(msg messaging.Message) string
+
+// ByHeader returns an IDFunc reading the named header.
+func ByHeader(name string) IDFunc {
+	return func(msg messaging.Message) string {
+		return msg.Headers[name]
+	}
+}
+
+// Default option values.
+const (
+	DefaultTTL   = 24 * time.Hour
+	DefaultLease = 5 * time.Minute
+)
+
+// Option configures NewHandler.
+type Option func(*options)
+
+type options struct {
+	ttl   time.Duration
+	lease time.Duration
+	id    IDFunc
+}
+
+// TTL is how long handled IDs are remembered, which should exceed the
+// longest time a broker may redeliver a message. It defaults to
+// DefaultTTL.
+func TTL(d time.Duration) Option {
+	return func(o *options) {
+		o.ttl = d
+	}
+}
+
+// Lease is how long a claim lasts, which should exceed the longest time
+// the handler takes. It defaults to DefaultLease.
+func Lease(d time.Duration) Option {
+	return func(o *options) {
+		o.lease = d
+	}
+}
+
+// ID sets how message IDs are read. It defaults to the outbox.IDHeader
+// set on messages published through the outbox.
+func ID(fn IDFunc) Option {
+	return func(o *options) {
+		o.id = fn
+	}
+}
+
+// NewHandler returns a handler running handler at most once per message
+// ID. Messages without an ID are passed through. Store failures are
+// returned so the broker retries the message, and logged with logger
+// along with skipped duplicates.
+func NewHandler(store Store, handler messaging.Handler, logger log.Factory, opts ...Option) messaging.Handler {
+	o := options{
+		ttl:   DefaultTTL,
+		lease: DefaultLease,
+		id:    ByHeader(outbox.IDHeader),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return func(ctx context.Context, msg messaging.Message) error {
+		id := o.id(msg)
+		if id == "" {
+			return handler(ctx, msg)
+		}
+		status, err := store.Claim(ctx, id, o.lease)
+		if err != nil {
+			logger.For(ctx).Error("Failed to claim message", zap.String("message_id", id), zap.Error(err))
+			return err
+		}
+		switch status {
+		case Done:
+			logger.For(ctx).Info("Skipping duplicate message", zap.String("message_id", id), zap.String("topic", msg.Topic))
+			return nil
+		case InProgress:
+			return ErrInProgress
+		}
+
+		if err := handler(ctx, msg); err != nil {
+			if rerr := store.Release(ctx, id); rerr != nil {
+				logger.For(ctx).Error("Failed to release message claim", zap.String("message_id", id), zap.Error(rerr))
+			}
+			return err
+		}
+		if err := store.Complete(ctx, id, o.ttl); err != nil {
+			// The side effects have happened; the claim's lease still
+			// guards against duplicates until it expires.
+			logger.For(ctx).Error("Failed to mark message handled", zap.String("message_id", id), zap.Error(err))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,105 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/messaging"
+	"github.com/jdotw/go-utils/outbox"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+)
+
+func TestHandler(t *testing.T) {
+	store := NewMemoryStore()
+	calls := 0
+	fail := false
+	handler := NewHandler(store, func(ctx context.Context, msg messaging.Message) error {
+		calls++
+		if fail {
+			return errors.New("handler failed")
+		}
+		return nil
+	}, log.NewMockLogFactory())
+	ctx := context.Background()
+	msg := messaging.Message{Topic: "orders", Headers: map[string]string{outbox.IDHeader: "1"}}
+
+	fail = true
+	if err := handler(ctx, msg); err == nil {
+		t.Fatal("expected handler error")
+	}
+	fail = false
+	if err := handler(ctx, msg); err != nil || calls != 2 {
+		t.Fatalf("expected failed message to be retried, got %v after %d calls", err, calls)
+	}
+	if err := handler(ctx, msg); err != nil || calls != 2 {
+		t.Errorf("expected duplicate to be skipped, got %v after %d calls", err, calls)
+	}
+
+	if _, err := store.Claim(ctx, "2", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	msg.Headers[outbox.IDHeader] = "2"
+	if err := handler(ctx, msg); !errors.Is(err, ErrInProgress) {
+		t.Errorf("expected ErrInProgress, got %v", err)
+	}
+
+	if err := handler(ctx, messaging.Message{Topic: "orders"}); err != nil || calls != 3 {
+		t.Errorf("expected message without ID to pass through, got %v after %d calls", err, calls)
+	}
+}
+
+func TestMemoryStoreLeaseExpiry(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := NewMemoryStore().(*memoryStore)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if status, _ := s.Claim(ctx, "1", time.Minute); status != Claimed {
+		t.Fatalf("expected Claimed, got %v", status)
+	}
+	now = now.Add(time.Minute)
+	if status, _ := s.Claim(ctx, "1", time.Minute); status != Claimed {
+		t.Errorf("expected expired claim to be taken over, got %v", status)
+	}
+	s.Complete(ctx, "1", time.Hour)
+	if status, _ := s.Claim(ctx, "1", time.Minute); status != Done {
+		t.Errorf("expected Done, got %v", status)
+	}
+
+	// Expired IDs are swept on a later claim
+	now = now.Add(2 * time.Hour)
+	s.Claim(ctx, "2", time.Minute)
+	if _, ok := s.entries["1"]; ok || len(s.entries) != 1 {
+		t.Errorf("expected expired IDs to be swept, got %v", s.entries)
+	}
+}
+
+func TestPostgresStoreClaimSQL(t *testing.T) {
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statements []string
+	record := func(db *gorm.DB) {
+		statements = append(statements, db.Statement.SQL.String())
+	}
+	if err := db.Callback().Create().After("gorm:create").Register("test:record", record); err != nil {
+		t.Fatal(err)
+	}
+	s := NewPostgresStore(db)
+	if _, err := s.Claim(context.Background(), "1", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if len(statements) != 1 {
+		t.Fatalf("expected one insert, got %v", statements)
+	}
+	want := "ON CONFLICT (`id`) DO UPDATE SET `done`=`excluded`.`done`,`expires_at`=`excluded`.`expires_at` WHERE `processed_messages`.`expires_at` < ?"
+	if !strings.Contains(statements[0], want) {
+		t.Errorf("unexpected claim SQL: %s", statements[0])
+	}
+}
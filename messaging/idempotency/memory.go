@@ -0,0 +1,68 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	done    bool
+	expires time.Time
+}
+
+type memoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+// NewMemoryStore returns a Store holding IDs in process memory, for
+// tests and single replica consumers. Expired IDs are dropped by a
+// periodic sweep on claim.
+func NewMemoryStore() Store {
+	return &memoryStore{entries: make(map[string]memoryEntry), now: time.Now}
+}
+
+func (s *memoryStore) Claim(_ context.Context, id string, lease time.Duration) (Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if now.Sub(s.lastSweep) > time.Minute {
+		s.sweep(now)
+	}
+	if e, ok := s.entries[id]; ok && now.Before(e.expires) {
+		if e.done {
+			return Done, nil
+		}
+		return InProgress, nil
+	}
+	s.entries[id] = memoryEntry{expires: now.Add(lease)}
+	return Claimed, nil
+}
+
+func (s *memoryStore) Complete(_ context.Context, id string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[id] = memoryEntry{done: true, expires: s.now().Add(ttl)}
+	return nil
+}
+
+func (s *memoryStore) Release(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[id]; ok && !e.done {
+		delete(s.entries, id)
+	}
+	return nil
+}
+
+func (s *memoryStore) sweep(now time.Time) {
+	for id, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, id)
+		}
+	}
+	s.lastSweep = now
+}
@@ -0,0 +1,84 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ProcessedMessage is a message ID recorded by the Postgres store.
+// Migrate it to create the processed_messages table.
+type ProcessedMessage struct {
+	ID        string    `gorm:"primaryKey"`
+	Done      bool      `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
+
+func (ProcessedMessage) TableName() string {
+	return "processed_messages"
+}
+
+// PostgresStore is a Store keeping IDs in the processed_messages table.
+// Claims and completions are written in their own statements, not in
+// the handler's transaction, so a crash between the handler committing
+// and Complete leaves the message to be handled again once its lease
+// expires. Expired rows are removed by Purge.
+type PostgresStore struct {
+	db  *gorm.DB
+	now func() time.Time
+}
+
+// NewPostgresStore returns a PostgresStore using db.
+func NewPostgresStore(db *gorm.DB) *PostgresStore {
+	return &PostgresStore{db: db, now: time.Now}
+}
+
+func (s *PostgresStore) Claim(ctx context.Context, id string, lease time.Duration) (Status, error) {
+	now := s.now()
+	// Insert the claim, taking over an existing row only if it expired.
+	res := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"done", "expires_at"}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Lt{Column: clause.Column{Table: "processed_messages", Name: "expires_at"}, Value: now},
+		}},
+	}).Create(&ProcessedMessage{ID: id, ExpiresAt: now.Add(lease)})
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	if res.RowsAffected == 1 {
+		return Claimed, nil
+	}
+
+	var existing ProcessedMessage
+	err := s.db.WithContext(ctx).Select("done").Take(&existing, "id = ?", id).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		// Purged since the insert; let the broker retry.
+		return InProgress, nil
+	case err != nil:
+		return 0, err
+	case existing.Done:
+		return Done, nil
+	}
+	return InProgress, nil
+}
+
+func (s *PostgresStore) Complete(ctx context.Context, id string, ttl time.Duration) error {
+	return s.db.WithContext(ctx).Model(&ProcessedMessage{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"done": true, "expires_at": s.now().Add(ttl)}).Error
+}
+
+func (s *PostgresStore) Release(ctx context.Context, id string) error {
+	return s.db.WithContext(ctx).Where("id = ? AND NOT done", id).Delete(&ProcessedMessage{}).Error
+}
+
+// Purge deletes expired IDs. Run it periodically, e.g. from the
+// scheduler.
+func (s *PostgresStore) Purge(ctx context.Context) (int64, error) {
+	res := s.db.WithContext(ctx).Where("expires_at < ?", s.now()).Delete(&ProcessedMessage{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,53 @@
+package idempotency
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var claimScript = redis.NewScript(`
+local v = redis.call("GET", KEYS[1])
+if v == "done" then
+	return 2
+elseif v then
+	return 1
+end
+redis.call("SET", KEYS[1], "processing", "PX", ARGV[1])
+return 0
+`)
+
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == "processing" then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+type redisStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedisStore returns a Store keeping IDs in Redis under prefix, with
+// expiry handled by Redis.
+func NewRedisStore(client redis.Cmdable, prefix string) Store {
+	return &redisStore{client: client, prefix: prefix}
+}
+
+func (s *redisStore) Claim(ctx context.Context, id string, lease time.Duration) (Status, error) {
+	n, err := claimScript.Run(ctx, s.client, []string{s.prefix + id}, lease.Milliseconds()).Int()
+	if err != nil {
+		return 0, err
+	}
+	return Status(n), nil
+}
+
+func (s *redisStore) Complete(ctx context.Context, id string, ttl time.Duration) error {
+	return s.client.Set(ctx, s.prefix+id, "done", ttl).Err()
+}
+
+func (s *redisStore) Release(ctx context.Context, id string) error {
+	return releaseScript.Run(ctx, s.client, []string{s.prefix + id}).Err()
+}
@@ -0,0 +1,213 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/messaging"
+	"github.com/jdotw/go-utils/metrics"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"github.com/prometheus/client_golang/prometheus"
+	kafkago "github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// ConsumerConfig configures a Consumer. Its tags allow loading it with
+// the config package.
+type ConsumerConfig struct {
+	Brokers []string `json:"brokers" env:"KAFKA_BROKERS" validate:"required"`
+	GroupID string   `json:"group_id" env:"KAFKA_GROUP_ID" validate:"required"`
+	Topics  []string `json:"topics" env:"KAFKA_TOPICS" validate:"required"`
+	// MaxAttempts is the number of times a message is handled before it
+	// is dead lettered.
+	MaxAttempts int `json:"max_attempts" env:"KAFKA_CONSUMER_MAX_ATTEMPTS" default:"3"`
+	// RetryBackoff is the wait before the first retry, doubling for each
+	// one after.
+	RetryBackoff time.Duration `json:"retry_backoff" env:"KAFKA_CONSUMER_RETRY_BACKOFF" default:"1s"`
+	// DeadLetterTopic receives messages that fail every attempt. Without
+	// one, they are logged and skipped.
+	DeadLetterTopic string `json:"dead_letter_topic" env:"KAFKA_DEAD_LETTER_TOPIC"`
+}
+
+type reader interface {
+	FetchMessage(ctx context.Context) (kafkago.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafkago.Message) error
+	Close() error
+}
+
+// Consumer runs a handler over the messages of a consumer group. Offsets
+// are committed once a message is handled, dead lettered or skipped, so
+// messages are delivered at least once.
+type Consumer struct {
+	cfg        ConsumerConfig
+	reader     reader
+	handler    messaging.Handler
+	deadLetter messaging.Publisher
+	// dlq is the dead letter producer created by NewConsumer, if it is
+	// used, closed when Run returns
+	dlq    *Producer
+	logger log.Factory
+	tracer opentracing.Tracer
+
+	consumed *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+}
+
+// NewConsumer returns a Consumer for cfg calling handler.
+func NewConsumer(cfg ConsumerConfig, handler messaging.Handler, logger log.Factory, tracer opentracing.Tracer, opts ...Option) *Consumer {
+	r := kafkago.NewReader(kafkago.ReaderConfig{
+		Brokers:     cfg.Brokers,
+		GroupID:     cfg.GroupID,
+		GroupTopics: cfg.Topics,
+		MaxBytes:    10e6,
+	})
+	if cfg.DeadLetterTopic == "" {
+		return newConsumer(cfg, r, handler, logger, tracer, opts...)
+	}
+	// Options given later replace this default publisher
+	dlq := NewProducer(ProducerConfig{Brokers: cfg.Brokers, MaxAttempts: 5}, logger, tracer, opts...)
+	c := newConsumer(cfg, r, handler, logger, tracer, append([]Option{DeadLetterPublisher(dlq)}, opts...)...)
+	if c.deadLetter == messaging.Publisher(dlq) {
+		c.dlq = dlq
+	} else {
+		dlq.Close()
+	}
+	return c
+}
+
+func newConsumer(cfg ConsumerConfig, r reader, handler messaging.Handler, logger log.Factory, tracer opentracing.Tracer, opts ...Option) *Consumer {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+	c := &Consumer{
+		cfg:        cfg,
+		reader:     r,
+		handler:    handler,
+		deadLetter: o.deadLetter,
+		logger:     logger,
+		tracer:     tracer,
+	}
+	if o.registerer != nil {
+		c.consumed = metrics.MustRegister(o.registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kafka_messages_consumed_total",
+			Help: "Number of messages consumed, by topic and result.",
+		}, []string{"topic", "result"}))
+		c.latency = metrics.MustRegister(o.registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "kafka_consume_duration_seconds",
+			Help: "Time taken to handle a message, including retries, by topic.",
+		}, []string{"topic"}))
+	}
+	return c
+}
+
+// Run consumes messages until ctx is cancelled, returning nil, or the
+// consumer fails. It closes the reader, and the dead letter producer it
+// created, before returning.
+func (c *Consumer) Run(ctx context.Context) error {
+	defer c.reader.Close()
+	if c.dlq != nil {
+		defer c.dlq.Close()
+	}
+	for {
+		m, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err := c.process(ctx, m); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err := c.reader.CommitMessages(ctx, m); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// process handles m, retrying and then dead lettering it. It only fails
+// if the message can't be dead lettered, so it must not be committed.
+func (c *Consumer) process(ctx context.Context, m kafkago.Message) error {
+	msg := fromKafka(m)
+	ctx, span := messaging.StartConsumerSpan(ctx, c.tracer, "kafka.consume", msg)
+	defer span.Finish()
+	ext.SpanKindConsumer.Set(span)
+	span.SetTag("kafka.partition", m.Partition)
+	span.SetTag("kafka.offset", m.Offset)
+	logger := c.logger.For(ctx).With(
+		zap.String("topic", m.Topic),
+		zap.Int("partition", m.Partition),
+		zap.Int64("offset", m.Offset),
+	)
+
+	start := time.Now()
+	attempts, err := c.handle(ctx, msg, logger)
+	if ctx.Err() != nil {
+		// Shutting down; leave the message uncommitted for redelivery
+		return ctx.Err()
+	}
+	result := "ok"
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(otlog.Error(err))
+		result = "skipped"
+		if c.cfg.DeadLetterTopic != "" && c.deadLetter != nil {
+			result = "dead_lettered"
+			if dlErr := c.deadLetter.Publish(ctx, c.deadLetterMessage(msg, attempts, err)); dlErr != nil {
+				logger.Error("Failed to dead letter message", zap.NamedError("handler_error", err), zap.Error(dlErr))
+				return dlErr
+			}
+		}
+		logger.Error("Failed to handle message", zap.String("result", result), zap.Error(err))
+	}
+	if c.consumed != nil {
+		c.consumed.WithLabelValues(m.Topic, result).Inc()
+		c.latency.WithLabelValues(m.Topic).Observe(time.Since(start).Seconds())
+	}
+	return nil
+}
+
+// handle calls the handler until it succeeds, fails permanently or runs
+// out of attempts, returning the number of attempts made.
+func (c *Consumer) handle(ctx context.Context, msg messaging.Message, logger log.Logger) (int, error) {
+	backoff := c.cfg.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := c.handler(ctx, msg)
+		if err == nil || errors.Is(err, messaging.ErrPermanent) || attempt >= c.cfg.MaxAttempts {
+			return attempt, err
+		}
+		log.Warn(logger, "Retrying message", zap.Int("attempt", attempt), zap.Duration("backoff", backoff), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return attempt, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (c *Consumer) deadLetterMessage(msg messaging.Message, attempts int, err error) messaging.Message {
+	headers := make(map[string]string, len(msg.Headers)+3)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[messaging.ErrorHeader] = err.Error()
+	headers[messaging.OriginalTopicHeader] = msg.Topic
+	headers[messaging.AttemptsHeader] = strconv.Itoa(attempts)
+	return messaging.Message{Topic: c.cfg.DeadLetterTopic, Key: msg.Key, Value: msg.Value, Headers: headers}
+}
@@ -0,0 +1,61 @@
+// Package kafka publishes and consumes Kafka messages with tracing,
+// structured logging, metrics, retries and dead lettering, using the
+// broker neutral types of the messaging package.
+//
+//	producer := kafka.NewProducer(kafka.ProducerConfig{Brokers: brokers}, logger, tracer)
+//	err := producer.Publish(ctx, messaging.Message{Topic: "orders", Key: []byte(id), Value: body})
+//
+//	consumer := kafka.NewConsumer(kafka.ConsumerConfig{
+//		Brokers: brokers, GroupID: "billing", Topics: []string{"orders"}, DeadLetterTopic: "orders.dlq",
+//	}, handleOrder, logger, tracer)
+//	err := consumer.Run(ctx)
+package kafka
+
+import (
+	"github.com/jdotw/go-utils/messaging"
+	"github.com/prometheus/client_golang/prometheus"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+type options struct {
+	registerer prometheus.Registerer
+	deadLetter messaging.Publisher
+}
+
+// Option configures a Producer or Consumer.
+type Option func(*options)
+
+// Metrics registers message counters and latency histograms. A nil
+// registerer uses prometheus.DefaultRegisterer.
+func Metrics(registerer prometheus.Registerer) Option {
+	return func(o *options) {
+		if registerer == nil {
+			registerer = prometheus.DefaultRegisterer
+		}
+		o.registerer = registerer
+	}
+}
+
+// DeadLetterPublisher publishes a Consumer's dead lettered messages. It
+// defaults to a Producer on the consumer's brokers.
+func DeadLetterPublisher(p messaging.Publisher) Option {
+	return func(o *options) {
+		o.deadLetter = p
+	}
+}
+
+func toKafka(msg messaging.Message) kafkago.Message {
+	headers := make([]kafkago.Header, 0, len(msg.Headers))
+	for k, v := range msg.Headers {
+		headers = append(headers, kafkago.Header{Key: k, Value: []byte(v)})
+	}
+	return kafkago.Message{Topic: msg.Topic, Key: msg.Key, Value: msg.Value, Headers: headers}
+}
+
+func fromKafka(m kafkago.Message) messaging.Message {
+	headers := make(map[string]string, len(m.Headers))
+	for _, h := range m.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	return messaging.Message{Topic: m.Topic, Key: m.Key, Value: m.Value, Headers: headers, Time: m.Time}
+}
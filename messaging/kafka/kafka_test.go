@@ -0,0 +1,155 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/messaging"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+type fakeWriter struct {
+	written []kafkago.Message
+	err     error
+}
+
+func (w *fakeWriter) WriteMessages(_ context.Context, msgs ...kafkago.Message) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.written = append(w.written, msgs...)
+	return nil
+}
+
+func (w *fakeWriter) Close() error {
+	return nil
+}
+
+// fakeReader serves messages, then blocks until cancelled.
+type fakeReader struct {
+	messages  []kafkago.Message
+	committed []int64
+	cancel    context.CancelFunc
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafkago.Message, error) {
+	if len(r.messages) == 0 {
+		r.cancel()
+		<-ctx.Done()
+		return kafkago.Message{}, ctx.Err()
+	}
+	m := r.messages[0]
+	r.messages = r.messages[1:]
+	return m, nil
+}
+
+func (r *fakeReader) CommitMessages(_ context.Context, msgs ...kafkago.Message) error {
+	for _, m := range msgs {
+		r.committed = append(r.committed, m.Offset)
+	}
+	return nil
+}
+
+func (r *fakeReader) Close() error {
+	return nil
+}
+
+func TestProducer(t *testing.T) {
+	tracer := mocktracer.New()
+	w := &fakeWriter{}
+	registerer := prometheus.NewRegistry()
+	p := newProducer(w, log.NewMockLogFactory(), tracer, Metrics(registerer))
+
+	parent := tracer.StartSpan("request")
+	ctx := opentracing.ContextWithSpan(context.Background(), parent)
+	if err := p.Publish(ctx, messaging.Message{Topic: "orders", Key: []byte("1"), Value: []byte("{}")}); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.written) != 1 || w.written[0].Topic != "orders" || len(w.written[0].Headers) == 0 {
+		t.Fatalf("expected a message with trace headers, got %+v", w.written)
+	}
+
+	w.err = errors.New("broker unavailable")
+	if err := p.Publish(ctx, messaging.Message{Topic: "orders"}); err != w.err {
+		t.Errorf("expected %v, got %v", w.err, err)
+	}
+	if n := testutil.ToFloat64(p.produced.WithLabelValues("orders", "error")); n != 1 {
+		t.Errorf("expected 1 failed message, got %v", n)
+	}
+}
+
+func TestConsumer(t *testing.T) {
+	tracer := mocktracer.New()
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &fakeReader{cancel: cancel, messages: []kafkago.Message{
+		{Topic: "orders", Offset: 1, Value: []byte("ok")},
+		{Topic: "orders", Offset: 2, Value: []byte("flaky")},
+		{Topic: "orders", Offset: 3, Value: []byte("bad")},
+		{Topic: "orders", Offset: 4, Value: []byte("broken")},
+	}}
+	dlq := &fakeWriter{}
+	cfg := ConsumerConfig{GroupID: "billing", MaxAttempts: 3, RetryBackoff: time.Millisecond, DeadLetterTopic: "orders.dlq"}
+
+	calls := make(map[string]int)
+	handler := func(ctx context.Context, msg messaging.Message) error {
+		calls[string(msg.Value)]++
+		switch string(msg.Value) {
+		case "flaky":
+			if calls["flaky"] < 2 {
+				return errors.New("timeout")
+			}
+		case "bad":
+			return fmt.Errorf("decode: %w", messaging.ErrPermanent)
+		case "broken":
+			return errors.New("always fails")
+		}
+		return nil
+	}
+	c := newConsumer(cfg, r, handler, log.NewMockLogFactory(), tracer, DeadLetterPublisher(newProducer(dlq, log.NewMockLogFactory(), tracer)))
+	if err := c.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls["ok"] != 1 || calls["flaky"] != 2 || calls["bad"] != 1 || calls["broken"] != 3 {
+		t.Errorf("unexpected handler calls: %v", calls)
+	}
+	if len(r.committed) != 4 {
+		t.Errorf("expected every message to be committed, got %v", r.committed)
+	}
+	if len(dlq.written) != 2 {
+		t.Fatalf("expected 2 dead lettered messages, got %d", len(dlq.written))
+	}
+	dead := fromKafka(dlq.written[1])
+	if dead.Topic != "orders.dlq" || string(dead.Value) != "broken" ||
+		dead.Headers[messaging.OriginalTopicHeader] != "orders" ||
+		dead.Headers[messaging.ErrorHeader] != "always fails" ||
+		dead.Headers[messaging.AttemptsHeader] != "3" {
+		t.Errorf("unexpected dead lettered message: %+v", dead)
+	}
+}
+
+func TestConsumerDeadLetterFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := &fakeReader{cancel: cancel, messages: []kafkago.Message{{Topic: "orders", Offset: 1}}}
+	dlq := &fakeWriter{err: errors.New("broker unavailable")}
+	cfg := ConsumerConfig{MaxAttempts: 1, DeadLetterTopic: "orders.dlq"}
+	handler := func(context.Context, messaging.Message) error { return errors.New("failed") }
+	tracer := mocktracer.New()
+
+	c := newConsumer(cfg, r, handler, log.NewMockLogFactory(), tracer, DeadLetterPublisher(newProducer(dlq, log.NewMockLogFactory(), tracer)))
+	if err := c.Run(ctx); err != dlq.err {
+		t.Errorf("expected %v, got %v", dlq.err, err)
+	}
+	if len(r.committed) != 0 {
+		t.Errorf("a message that couldn't be dead lettered should not be committed, got %v", r.committed)
+	}
+}
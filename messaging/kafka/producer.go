@@ -0,0 +1,114 @@
+package kafka
+
+import (
+	"context"
+	"time"
+
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/messaging"
+	"github.com/jdotw/go-utils/metrics"
+	"github.com/jdotw/go-utils/tracing"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"github.com/prometheus/client_golang/prometheus"
+	kafkago "github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// ProducerConfig configures a Producer. Its tags allow loading it with
+// the config package.
+type ProducerConfig struct {
+	Brokers []string `json:"brokers" env:"KAFKA_BROKERS" validate:"required"`
+	// MaxAttempts is the number of times a write is tried before failing.
+	MaxAttempts int `json:"max_attempts" env:"KAFKA_PRODUCER_MAX_ATTEMPTS" default:"5"`
+	// BatchTimeout is how long messages wait to be batched.
+	BatchTimeout time.Duration `json:"batch_timeout" env:"KAFKA_PRODUCER_BATCH_TIMEOUT" default:"10ms"`
+}
+
+type writer interface {
+	WriteMessages(ctx context.Context, msgs ...kafkago.Message) error
+	Close() error
+}
+
+// Producer publishes messages, waiting for all in-sync replicas to
+// acknowledge them. Messages with the same key go to the same partition.
+type Producer struct {
+	writer writer
+	logger log.Factory
+	tracer opentracing.Tracer
+
+	produced *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+}
+
+// NewProducer returns a Producer for cfg.
+func NewProducer(cfg ProducerConfig, logger log.Factory, tracer opentracing.Tracer, opts ...Option) *Producer {
+	w := &kafkago.Writer{
+		Addr:         kafkago.TCP(cfg.Brokers...),
+		Balancer:     &kafkago.Hash{},
+		MaxAttempts:  cfg.MaxAttempts,
+		BatchTimeout: cfg.BatchTimeout,
+		RequiredAcks: kafkago.RequireAll,
+	}
+	return newProducer(w, logger, tracer, opts...)
+}
+
+func newProducer(w writer, logger log.Factory, tracer opentracing.Tracer, opts ...Option) *Producer {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	p := &Producer{writer: w, logger: logger, tracer: tracer}
+	if o.registerer != nil {
+		p.produced = metrics.MustRegister(o.registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kafka_messages_produced_total",
+			Help: "Number of messages published, by topic and result.",
+		}, []string{"topic", "result"}))
+		p.latency = metrics.MustRegister(o.registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "kafka_produce_duration_seconds",
+			Help: "Time taken to publish a batch of messages, by result.",
+		}, []string{"result"}))
+	}
+	return p
+}
+
+// Publish writes msgs, adding the trace context and request ID to their
+// headers.
+func (p *Producer) Publish(ctx context.Context, msgs ...messaging.Message) error {
+	ctx, span := tracing.NewChildSpanAndContext(ctx, p.tracer, "kafka.produce")
+	defer span.Finish()
+	ext.SpanKindProducer.Set(span)
+	span.SetTag("message_bus.count", len(msgs))
+
+	km := make([]kafkago.Message, len(msgs))
+	for i, msg := range msgs {
+		messaging.Inject(ctx, p.tracer, &msg)
+		km[i] = toKafka(msg)
+	}
+	if len(msgs) == 1 {
+		span.SetTag("message_bus.destination", msgs[0].Topic)
+	}
+
+	start := time.Now()
+	err := p.writer.WriteMessages(ctx, km...)
+	result := "ok"
+	if err != nil {
+		result = "error"
+		ext.Error.Set(span, true)
+		span.LogFields(otlog.Error(err))
+		p.logger.For(ctx).Error("Failed to publish messages", zap.Int("count", len(msgs)), zap.Error(err))
+	}
+	if p.produced != nil {
+		p.latency.WithLabelValues(result).Observe(time.Since(start).Seconds())
+		for _, msg := range msgs {
+			p.produced.WithLabelValues(msg.Topic, result).Inc()
+		}
+	}
+	return err
+}
+
+// Close flushes pending messages and closes the connection.
+func (p *Producer) Close() error {
+	return p.writer.Close()
+}
@@ -0,0 +1,84 @@
+// Package messaging holds the types shared by the broker packages,
+// messaging/kafka and messaging/nats, so services can swap brokers
+// without changing their handlers.
+package messaging
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jdotw/go-utils/correlation"
+	"github.com/opentracing/opentracing-go"
+)
+
+// Headers set on dead lettered messages.
+const (
+	// ErrorHeader carries the handler error on dead lettered messages.
+	ErrorHeader = "X-Error"
+	// OriginalTopicHeader carries the topic a dead lettered message was
+	// consumed from.
+	OriginalTopicHeader = "X-Original-Topic"
+	// AttemptsHeader carries the number of times a dead lettered message
+	// was handled.
+	AttemptsHeader = "X-Attempts"
+)
+
+// Message is a message published to or consumed from a broker.
+type Message struct {
+	Topic   string
+	Key     []byte
+	Value   []byte
+	Headers map[string]string
+	// Time is when the message was published, set on consumed messages.
+	Time time.Time
+}
+
+// Handler processes a consumed message. Returning an error retries the
+// message and eventually dead letters it.
+type Handler func(ctx context.Context, msg Message) error
+
+// Publisher publishes messages.
+type Publisher interface {
+	Publish(ctx context.Context, msgs ...Message) error
+}
+
+// ErrPermanent marks handler errors that retrying can't fix, such as
+// malformed messages, so they are dead lettered straight away.
+//
+//	return fmt.Errorf("decode order: %w", messaging.ErrPermanent)
+var ErrPermanent = errors.New("permanent failure")
+
+// Inject adds the span and request ID in ctx to msg's headers, so
+// consumers continue the trace. It copies the headers first, leaving the
+// caller's map untouched.
+func Inject(ctx context.Context, tracer opentracing.Tracer, msg *Message) {
+	headers := make(map[string]string, len(msg.Headers)+4)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	msg.Headers = headers
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		tracer.Inject(span.Context(), opentracing.TextMap, opentracing.TextMapCarrier(msg.Headers))
+	}
+	if id := correlation.FromContext(ctx); id != "" {
+		msg.Headers[correlation.HeaderName] = id
+	}
+}
+
+// StartConsumerSpan starts a span for handling msg, following from the
+// span that published it, and returns a context carrying the span and
+// the message's request ID.
+func StartConsumerSpan(ctx context.Context, tracer opentracing.Tracer, name string, msg Message) (context.Context, opentracing.Span) {
+	var opts []opentracing.StartSpanOption
+	if sc, err := tracer.Extract(opentracing.TextMap, opentracing.TextMapCarrier(msg.Headers)); err == nil {
+		opts = append(opts, opentracing.FollowsFrom(sc))
+	}
+	span := tracer.StartSpan(name, opts...)
+	span.SetTag("message_bus.destination", msg.Topic)
+	if id := msg.Headers[correlation.HeaderName]; id != "" {
+		ctx = correlation.WithRequestID(ctx, id)
+		span.SetTag(correlation.SpanTag, id)
+	}
+	return opentracing.ContextWithSpan(ctx, span), span
+}
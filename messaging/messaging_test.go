@@ -0,0 +1,40 @@
+package messaging
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jdotw/go-utils/correlation"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestTracePropagation(t *testing.T) {
+	tracer := mocktracer.New()
+	parent := tracer.StartSpan("publish")
+	ctx := opentracing.ContextWithSpan(context.Background(), parent)
+	ctx = correlation.WithRequestID(ctx, "req-1")
+
+	headers := map[string]string{"Content-Type": "application/json"}
+	msg := Message{Topic: "orders", Headers: headers}
+	Inject(ctx, tracer, &msg)
+	if msg.Headers[correlation.HeaderName] != "req-1" || msg.Headers["Content-Type"] != "application/json" {
+		t.Errorf("expected the request ID header, got %v", msg.Headers)
+	}
+	if len(headers) != 1 {
+		t.Errorf("expected the caller's headers to be left untouched, got %v", headers)
+	}
+
+	ctx, span := StartConsumerSpan(context.Background(), tracer, "consume", msg)
+	span.Finish()
+	if correlation.FromContext(ctx) != "req-1" {
+		t.Error("the consumer context should carry the request ID")
+	}
+	consumed := span.(*mocktracer.MockSpan)
+	if consumed.SpanContext.TraceID != parent.(*mocktracer.MockSpan).SpanContext.TraceID {
+		t.Error("the consumer span should continue the publisher's trace")
+	}
+	if consumed.Tag("message_bus.destination") != "orders" {
+		t.Errorf("unexpected tags: %v", consumed.Tags())
+	}
+}
@@ -0,0 +1,230 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/messaging"
+	"github.com/jdotw/go-utils/metrics"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// ConsumerConfig configures a Consumer. Its tags allow loading it with
+// the config package.
+type ConsumerConfig struct {
+	Stream string `json:"stream" env:"NATS_STREAM" validate:"required"`
+	// Durable names the JetStream consumer, which is created or updated
+	// to match this config, and shared by every instance of the service.
+	Durable string `json:"durable" env:"NATS_DURABLE" validate:"required"`
+	// Subject filters the stream's messages, and may use wildcards.
+	Subject string `json:"subject" env:"NATS_SUBJECT" validate:"required"`
+	// MaxAttempts is the number of times a message is delivered before
+	// it is dead lettered.
+	MaxAttempts int `json:"max_attempts" env:"NATS_CONSUMER_MAX_ATTEMPTS" default:"3"`
+	// RetryBackoff is the redelivery delay after the first failure,
+	// doubling for each one after.
+	RetryBackoff time.Duration `json:"retry_backoff" env:"NATS_CONSUMER_RETRY_BACKOFF" default:"1s"`
+	// AckWait is how long a message may be handled before JetStream
+	// redelivers it.
+	AckWait time.Duration `json:"ack_wait" env:"NATS_CONSUMER_ACK_WAIT" default:"30s"`
+	// BatchSize is the number of messages fetched at a time.
+	BatchSize int `json:"batch_size" env:"NATS_CONSUMER_BATCH_SIZE" default:"10"`
+	// DeadLetterTopic receives messages that fail every attempt. Without
+	// one, they are logged and terminated.
+	DeadLetterTopic string `json:"dead_letter_topic" env:"NATS_DEAD_LETTER_TOPIC"`
+}
+
+// errAckTimeout is the dead letter error for messages whose final
+// attempt wasn't acknowledged within the ack wait.
+var errAckTimeout = errors.New("not acknowledged within the ack wait")
+
+// ackable is the part of a JetStream message the consumer acknowledges.
+type ackable interface {
+	Ack(opts ...natsgo.AckOpt) error
+	NakWithDelay(delay time.Duration, opts ...natsgo.AckOpt) error
+	Term(opts ...natsgo.AckOpt) error
+	Metadata() (*natsgo.MsgMetadata, error)
+}
+
+// Consumer runs a handler over a durable JetStream pull consumer.
+// Failed messages are redelivered by JetStream with a growing delay,
+// then dead lettered, so messages are delivered at least once and
+// retries don't hold up other messages.
+type Consumer struct {
+	cfg        ConsumerConfig
+	js         natsgo.JetStreamContext
+	handler    messaging.Handler
+	deadLetter messaging.Publisher
+	logger     log.Factory
+	tracer     opentracing.Tracer
+
+	consumed *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+}
+
+// NewConsumer returns a Consumer for cfg calling handler.
+func NewConsumer(nc *natsgo.Conn, cfg ConsumerConfig, handler messaging.Handler, logger log.Factory, tracer opentracing.Tracer, opts ...Option) (*Consumer, error) {
+	js, err := nc.JetStream()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.DeadLetterTopic != "" {
+		// Options given later replace this default publisher
+		opts = append([]Option{DeadLetterPublisher(newProducer(js, logger, tracer, opts...))}, opts...)
+	}
+	c := newConsumer(cfg, handler, logger, tracer, opts...)
+	c.js = js
+	return c, nil
+}
+
+func newConsumer(cfg ConsumerConfig, handler messaging.Handler, logger log.Factory, tracer opentracing.Tracer, opts ...Option) *Consumer {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+	if cfg.BatchSize < 1 {
+		cfg.BatchSize = 1
+	}
+	c := &Consumer{
+		cfg:        cfg,
+		handler:    handler,
+		deadLetter: o.deadLetter,
+		logger:     logger,
+		tracer:     tracer,
+	}
+	if o.registerer != nil {
+		c.consumed = metrics.MustRegister(o.registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nats_messages_consumed_total",
+			Help: "Number of messages consumed, by subject and result.",
+		}, []string{"subject", "result"}))
+		c.latency = metrics.MustRegister(o.registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "nats_consume_duration_seconds",
+			Help: "Time taken to handle a message, by subject.",
+		}, []string{"subject"}))
+	}
+	return c
+}
+
+// Run consumes messages until ctx is cancelled, returning nil, or the
+// consumer fails.
+func (c *Consumer) Run(ctx context.Context) error {
+	cc := &natsgo.ConsumerConfig{
+		Durable:       c.cfg.Durable,
+		FilterSubject: c.cfg.Subject,
+		AckPolicy:     natsgo.AckExplicitPolicy,
+		AckWait:       c.cfg.AckWait,
+		// A final attempt that times out is redelivered once more, to be
+		// dead lettered rather than dropped by JetStream
+		MaxDeliver: c.cfg.MaxAttempts + 1,
+	}
+	if _, err := c.js.ConsumerInfo(c.cfg.Stream, c.cfg.Durable); errors.Is(err, natsgo.ErrConsumerNotFound) {
+		_, err = c.js.AddConsumer(c.cfg.Stream, cc)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else if _, err := c.js.UpdateConsumer(c.cfg.Stream, cc); err != nil {
+		return err
+	}
+
+	sub, err := c.js.PullSubscribe(c.cfg.Subject, c.cfg.Durable, natsgo.Bind(c.cfg.Stream, c.cfg.Durable))
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		msgs, err := sub.Fetch(c.cfg.BatchSize, natsgo.Context(ctx))
+		if ctx.Err() != nil {
+			return nil
+		}
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, natsgo.ErrTimeout) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, m := range msgs {
+			if err := c.process(ctx, fromNATS(m), m); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+}
+
+// process handles one delivery of msg, acknowledging, redelivering or
+// dead lettering it. It only fails if the message can't be dead
+// lettered, leaving it for JetStream to redeliver.
+func (c *Consumer) process(ctx context.Context, msg messaging.Message, m ackable) error {
+	attempt := 1
+	if md, err := m.Metadata(); err == nil {
+		attempt = int(md.NumDelivered)
+	}
+	ctx, span := messaging.StartConsumerSpan(ctx, c.tracer, "nats.consume", msg)
+	defer span.Finish()
+	ext.SpanKindConsumer.Set(span)
+	span.SetTag("nats.attempt", attempt)
+	logger := c.logger.For(ctx).With(zap.String("subject", msg.Topic), zap.Int("attempt", attempt))
+
+	start := time.Now()
+	err := errAckTimeout
+	if attempt <= c.cfg.MaxAttempts {
+		err = c.handler(ctx, msg)
+	}
+	result := "ok"
+	switch {
+	case err == nil:
+		m.Ack()
+	case !errors.Is(err, messaging.ErrPermanent) && attempt < c.cfg.MaxAttempts:
+		result = "retried"
+		backoff := c.cfg.RetryBackoff << (attempt - 1)
+		log.Warn(logger, "Retrying message", zap.Duration("backoff", backoff), zap.Error(err))
+		m.NakWithDelay(backoff)
+	default:
+		result = "terminated"
+		if c.cfg.DeadLetterTopic != "" && c.deadLetter != nil {
+			result = "dead_lettered"
+			if dlErr := c.deadLetter.Publish(ctx, c.deadLetterMessage(msg, attempt, err)); dlErr != nil {
+				logger.Error("Failed to dead letter message", zap.NamedError("handler_error", err), zap.Error(dlErr))
+				return dlErr
+			}
+		}
+		logger.Error("Failed to handle message", zap.String("result", result), zap.Error(err))
+		m.Term()
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(otlog.Error(err))
+	}
+	if c.consumed != nil {
+		c.consumed.WithLabelValues(msg.Topic, result).Inc()
+		c.latency.WithLabelValues(msg.Topic).Observe(time.Since(start).Seconds())
+	}
+	return nil
+}
+
+func (c *Consumer) deadLetterMessage(msg messaging.Message, attempts int, err error) messaging.Message {
+	headers := make(map[string]string, len(msg.Headers)+3)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[messaging.ErrorHeader] = err.Error()
+	headers[messaging.OriginalTopicHeader] = msg.Topic
+	headers[messaging.AttemptsHeader] = strconv.Itoa(attempts)
+	return messaging.Message{Topic: c.cfg.DeadLetterTopic, Key: msg.Key, Value: msg.Value, Headers: headers}
+}
@@ -0,0 +1,141 @@
+// Package nats publishes and consumes NATS and JetStream messages with
+// tracing, structured logging, metrics, redelivery and dead lettering.
+// Its Producer and Consumer mirror those of messaging/kafka and use the
+// same messaging types, so services can swap brokers.
+//
+//	nc, err := nats.Connect(cfg, logger)
+//	producer, err := nats.NewProducer(nc, logger, tracer)
+//	err = producer.Publish(ctx, messaging.Message{Topic: "orders.created", Value: body})
+//
+//	consumer, err := nats.NewConsumer(nc, nats.ConsumerConfig{
+//		Stream: "ORDERS", Durable: "billing", Subject: "orders.>", DeadLetterTopic: "orders.dlq",
+//	}, handleOrder, logger, tracer)
+//	err = consumer.Run(ctx)
+package nats
+
+import (
+	"context"
+	"time"
+
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/messaging"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// Config configures a connection. Its tags allow loading it with the
+// config package.
+type Config struct {
+	URL  string `json:"url" env:"NATS_URL" default:"nats://localhost:4222"`
+	Name string `json:"name" env:"NATS_CLIENT_NAME"`
+	// ReconnectWait is the wait between reconnection attempts, which
+	// continue until the connection is closed.
+	ReconnectWait time.Duration `json:"reconnect_wait" env:"NATS_RECONNECT_WAIT" default:"2s"`
+	// ReconnectBufferSize bounds the messages published while
+	// disconnected, which are sent once reconnected.
+	ReconnectBufferSize int `json:"reconnect_buffer_size" env:"NATS_RECONNECT_BUFFER_SIZE" default:"8388608"`
+}
+
+// Connect connects to cfg.URL, reconnecting forever after disconnects
+// and logging connection state changes.
+func Connect(cfg Config, logger log.Factory) (*natsgo.Conn, error) {
+	return natsgo.Connect(cfg.URL,
+		natsgo.Name(cfg.Name),
+		natsgo.MaxReconnects(-1),
+		natsgo.ReconnectWait(cfg.ReconnectWait),
+		natsgo.ReconnectBufSize(cfg.ReconnectBufferSize),
+		natsgo.DisconnectErrHandler(func(nc *natsgo.Conn, err error) {
+			log.Warn(logger.Bg(), "Disconnected from NATS", zap.Error(err))
+		}),
+		natsgo.ReconnectHandler(func(nc *natsgo.Conn) {
+			logger.Bg().Info("Reconnected to NATS", zap.String("url", nc.ConnectedUrlRedacted()))
+		}),
+		natsgo.ClosedHandler(func(nc *natsgo.Conn) {
+			logger.Bg().Info("NATS connection closed")
+		}),
+		natsgo.ErrorHandler(func(nc *natsgo.Conn, sub *natsgo.Subscription, err error) {
+			subject := ""
+			if sub != nil {
+				subject = sub.Subject
+			}
+			logger.Bg().Error("NATS error", zap.String("subject", subject), zap.Error(err))
+		}),
+	)
+}
+
+type options struct {
+	registerer prometheus.Registerer
+	deadLetter messaging.Publisher
+}
+
+// Option configures a Producer or Consumer.
+type Option func(*options)
+
+// Metrics registers message counters and latency histograms. A nil
+// registerer uses prometheus.DefaultRegisterer.
+func Metrics(registerer prometheus.Registerer) Option {
+	return func(o *options) {
+		if registerer == nil {
+			registerer = prometheus.DefaultRegisterer
+		}
+		o.registerer = registerer
+	}
+}
+
+// DeadLetterPublisher publishes a Consumer's dead lettered messages. It
+// defaults to a Producer on the consumer's connection.
+func DeadLetterPublisher(p messaging.Publisher) Option {
+	return func(o *options) {
+		o.deadLetter = p
+	}
+}
+
+// Subscribe handles core NATS messages on subject, sharing them among
+// subscribers with the same queue group if queue is set. Core NATS
+// delivers at most once, so handler errors are logged and the message is
+// dropped; use a Consumer for redelivery.
+func Subscribe(nc *natsgo.Conn, subject, queue string, handler messaging.Handler, logger log.Factory, tracer opentracing.Tracer) (*natsgo.Subscription, error) {
+	return nc.QueueSubscribe(subject, queue, func(m *natsgo.Msg) {
+		msg := fromNATS(m)
+		ctx, span := messaging.StartConsumerSpan(context.Background(), tracer, "nats.receive", msg)
+		defer span.Finish()
+		ext.SpanKindConsumer.Set(span)
+		if err := handler(ctx, msg); err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(otlog.Error(err))
+			logger.For(ctx).Error("Failed to handle message", zap.String("subject", m.Subject), zap.Error(err))
+		}
+	})
+}
+
+func toNATS(msg messaging.Message) *natsgo.Msg {
+	m := natsgo.NewMsg(msg.Topic)
+	m.Data = msg.Value
+	for k, v := range msg.Headers {
+		m.Header.Set(k, v)
+	}
+	if len(msg.Key) > 0 {
+		// NATS has no keys; carry them as a header so they survive a round trip
+		m.Header.Set(KeyHeader, string(msg.Key))
+	}
+	return m
+}
+
+// KeyHeader carries Message.Key, which NATS has no equivalent of.
+const KeyHeader = "X-Message-Key"
+
+func fromNATS(m *natsgo.Msg) messaging.Message {
+	msg := messaging.Message{Topic: m.Subject, Value: m.Data, Headers: make(map[string]string, len(m.Header))}
+	for k := range m.Header {
+		if k == KeyHeader {
+			msg.Key = []byte(m.Header.Get(k))
+			continue
+		}
+		msg.Headers[k] = m.Header.Get(k)
+	}
+	return msg
+}
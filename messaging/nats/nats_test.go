@@ -0,0 +1,137 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/messaging"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+type fakePublisher struct {
+	published []*natsgo.Msg
+	err       error
+}
+
+func (p *fakePublisher) PublishMsg(m *natsgo.Msg, _ ...natsgo.PubOpt) (*natsgo.PubAck, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	p.published = append(p.published, m)
+	return &natsgo.PubAck{}, nil
+}
+
+type fakeMsg struct {
+	delivered uint64
+	acked     string
+	delay     time.Duration
+}
+
+func (m *fakeMsg) Ack(...natsgo.AckOpt) error {
+	m.acked = "ack"
+	return nil
+}
+
+func (m *fakeMsg) NakWithDelay(delay time.Duration, _ ...natsgo.AckOpt) error {
+	m.acked, m.delay = "nak", delay
+	return nil
+}
+
+func (m *fakeMsg) Term(...natsgo.AckOpt) error {
+	m.acked = "term"
+	return nil
+}
+
+func (m *fakeMsg) Metadata() (*natsgo.MsgMetadata, error) {
+	return &natsgo.MsgMetadata{NumDelivered: m.delivered}, nil
+}
+
+func TestMessageConversion(t *testing.T) {
+	msg := messaging.Message{Topic: "orders.created", Key: []byte("42"), Value: []byte("{}"), Headers: map[string]string{"uber-trace-id": "x"}}
+	if got := fromNATS(toNATS(msg)); !reflect.DeepEqual(got, msg) {
+		t.Errorf("expected %+v, got %+v", msg, got)
+	}
+}
+
+func TestProducer(t *testing.T) {
+	tracer := mocktracer.New()
+	js := &fakePublisher{}
+	p := newProducer(js, log.NewMockLogFactory(), tracer)
+	ctx := opentracing.ContextWithSpan(context.Background(), tracer.StartSpan("request"))
+
+	if err := p.Publish(ctx, messaging.Message{Topic: "a"}, messaging.Message{Topic: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(js.published) != 2 || js.published[1].Subject != "b" || len(js.published[0].Header) == 0 {
+		t.Errorf("expected 2 messages with trace headers, got %+v", js.published)
+	}
+
+	js.err = errors.New("no responders")
+	if err := p.Publish(ctx, messaging.Message{Topic: "a"}); err != js.err {
+		t.Errorf("expected %v, got %v", js.err, err)
+	}
+}
+
+func TestConsumerProcess(t *testing.T) {
+	tracer := mocktracer.New()
+	dlq := &fakePublisher{}
+	cfg := ConsumerConfig{MaxAttempts: 3, RetryBackoff: time.Second, DeadLetterTopic: "orders.dlq"}
+	failing := errors.New("timeout")
+	handler := func(_ context.Context, msg messaging.Message) error {
+		switch string(msg.Value) {
+		case "bad":
+			return fmt.Errorf("decode: %w", messaging.ErrPermanent)
+		case "flaky":
+			return failing
+		}
+		return nil
+	}
+	c := newConsumer(cfg, handler, log.NewMockLogFactory(), tracer, DeadLetterPublisher(newProducer(dlq, log.NewMockLogFactory(), tracer)))
+	ctx := context.Background()
+
+	tests := []struct {
+		value     string
+		delivered uint64
+		acked     string
+		delay     time.Duration
+		dead      int
+	}{
+		{"ok", 1, "ack", 0, 0},
+		{"flaky", 1, "nak", time.Second, 0},
+		{"flaky", 2, "nak", 2 * time.Second, 0},
+		{"flaky", 3, "term", 0, 1},
+		{"bad", 1, "term", 0, 2},
+		{"ok", 4, "term", 0, 3},
+	}
+	for _, tt := range tests {
+		m := &fakeMsg{delivered: tt.delivered}
+		if err := c.process(ctx, messaging.Message{Topic: "orders", Value: []byte(tt.value)}, m); err != nil {
+			t.Fatal(err)
+		}
+		if m.acked != tt.acked || m.delay != tt.delay || len(dlq.published) != tt.dead {
+			t.Errorf("%s delivery %d: expected %s after %v with %d dead lettered, got %s after %v with %d",
+				tt.value, tt.delivered, tt.acked, tt.delay, tt.dead, m.acked, m.delay, len(dlq.published))
+		}
+	}
+	dead := fromNATS(dlq.published[0])
+	if dead.Topic != "orders.dlq" || dead.Headers[messaging.ErrorHeader] != "timeout" || dead.Headers[messaging.AttemptsHeader] != "3" {
+		t.Errorf("unexpected dead lettered message: %+v", dead)
+	}
+
+	// A message that can't be dead lettered is left for redelivery
+	dlq.err = errors.New("no responders")
+	m := &fakeMsg{delivered: 3}
+	if err := c.process(ctx, messaging.Message{Topic: "orders", Value: []byte("flaky")}, m); err != dlq.err {
+		t.Errorf("expected %v, got %v", dlq.err, err)
+	}
+	if m.acked != "" {
+		t.Errorf("the message should not be acknowledged, got %s", m.acked)
+	}
+}
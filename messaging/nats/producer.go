@@ -0,0 +1,92 @@
+package nats
+
+import (
+	"context"
+	"time"
+
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/messaging"
+	"github.com/jdotw/go-utils/metrics"
+	"github.com/jdotw/go-utils/tracing"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// publisher publishes a message, waiting for JetStream to store it.
+type publisher interface {
+	PublishMsg(m *natsgo.Msg, opts ...natsgo.PubOpt) (*natsgo.PubAck, error)
+}
+
+// Producer publishes messages to JetStream streams, waiting for each to
+// be stored, so a nil error means the message won't be lost.
+type Producer struct {
+	js     publisher
+	logger log.Factory
+	tracer opentracing.Tracer
+
+	produced *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+}
+
+// NewProducer returns a Producer publishing on nc.
+func NewProducer(nc *natsgo.Conn, logger log.Factory, tracer opentracing.Tracer, opts ...Option) (*Producer, error) {
+	js, err := nc.JetStream()
+	if err != nil {
+		return nil, err
+	}
+	return newProducer(js, logger, tracer, opts...), nil
+}
+
+func newProducer(js publisher, logger log.Factory, tracer opentracing.Tracer, opts ...Option) *Producer {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	p := &Producer{js: js, logger: logger, tracer: tracer}
+	if o.registerer != nil {
+		p.produced = metrics.MustRegister(o.registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nats_messages_produced_total",
+			Help: "Number of messages published, by subject and result.",
+		}, []string{"subject", "result"}))
+		p.latency = metrics.MustRegister(o.registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "nats_produce_duration_seconds",
+			Help: "Time taken to publish a message, by result.",
+		}, []string{"result"}))
+	}
+	return p
+}
+
+// Publish publishes msgs in order, with their topics as subjects, adding
+// the trace context and request ID to their headers. It stops at the
+// first failure.
+func (p *Producer) Publish(ctx context.Context, msgs ...messaging.Message) error {
+	ctx, span := tracing.NewChildSpanAndContext(ctx, p.tracer, "nats.produce")
+	defer span.Finish()
+	ext.SpanKindProducer.Set(span)
+	span.SetTag("message_bus.count", len(msgs))
+
+	for _, msg := range msgs {
+		messaging.Inject(ctx, p.tracer, &msg)
+		start := time.Now()
+		_, err := p.js.PublishMsg(toNATS(msg), natsgo.Context(ctx))
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+		if p.produced != nil {
+			p.produced.WithLabelValues(msg.Topic, result).Inc()
+			p.latency.WithLabelValues(result).Observe(time.Since(start).Seconds())
+		}
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(otlog.Error(err))
+			p.logger.For(ctx).Error("Failed to publish message", zap.String("subject", msg.Topic), zap.Error(err))
+			return err
+		}
+	}
+	return nil
+}
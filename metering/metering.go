@@ -0,0 +1,163 @@
+// Package metering counts requests per consumer, a JWT subject or a
+// hash of an API key, in hourly, daily or monthly windows. Counts are kept in Redis or
+// Postgres so every replica sees the same usage, and are exported as
+// per-consumer Prometheus counters. The middleware rejects requests
+// over a consumer's quota with a 429.
+//
+//	meter := metering.NewMeter(metering.NewRedisStore(client, "usage:"), metering.Month,
+//		metering.Metrics(prometheus.DefaultRegisterer, "orders"))
+//	quota := func(ctx context.Context, consumer string) (int64, error) {
+//		return plans.MonthlyRequests(ctx, consumer)
+//	}
+//	endpoint = metering.NewMiddleware(meter, metering.KeyBySubject, quota, logger)(endpoint)
+package metering
+
+import (
+	"context"
+	"time"
+
+	"github.com/jdotw/go-utils/clock"
+	"github.com/jdotw/go-utils/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Window is the period over which usage is counted. Windows follow the
+// UTC calendar, so a monthly quota resets at the start of each month.
+type Window string
+
+const (
+	Hour  Window = "hour"
+	Day   Window = "day"
+	Month Window = "month"
+)
+
+// Start returns the start of the window containing t. Unknown windows
+// are treated as Day.
+func (w Window) Start(t time.Time) time.Time {
+	t = t.UTC()
+	switch w {
+	case Hour:
+		return t.Truncate(time.Hour)
+	case Month:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// End returns the end of the window starting at start, which is the
+// start of the next one.
+func (w Window) End(start time.Time) time.Time {
+	switch w {
+	case Hour:
+		return start.Add(time.Hour)
+	case Month:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// Usage is a consumer's request count in a window. Migrate it to create
+// the api_usage table used by NewGormStore.
+type Usage struct {
+	Consumer  string    `json:"consumer" gorm:"primaryKey"`
+	Window    Window    `json:"window" gorm:"primaryKey;column:period"`
+	Start     time.Time `json:"start" gorm:"primaryKey;column:period_start"`
+	Count     int64     `json:"count" gorm:"not null"`
+	UpdatedAt time.Time `json:"-"`
+	// End is when the window ends and the count resets.
+	End time.Time `json:"end" gorm:"-"`
+}
+
+func (Usage) TableName() string {
+	return "api_usage"
+}
+
+// Option configures a Meter.
+type Option func(*Meter)
+
+// WithClock makes the Meter place requests in windows by c rather than
+// the system clock.
+func WithClock(c clock.Clock) Option {
+	return func(m *Meter) {
+		m.clock = c
+	}
+}
+
+// Metrics registers per-consumer request and rejection counters with
+// registerer, under namespace when it isn't empty. Each consumer is a
+// label value, so only use it where consumers number in the thousands
+// at most.
+func Metrics(registerer prometheus.Registerer, namespace string) Option {
+	return func(m *Meter) {
+		if registerer == nil {
+			registerer = prometheus.DefaultRegisterer
+		}
+		m.requests = metrics.MustRegister(registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "metering_requests_total",
+			Help:      "Number of requests counted towards usage, by consumer.",
+		}, []string{"consumer"}))
+		m.exceeded = metrics.MustRegister(registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "metering_quota_exceeded_total",
+			Help:      "Number of requests rejected for exceeding the consumer's quota, by consumer.",
+		}, []string{"consumer"}))
+	}
+}
+
+// Meter counts consumers' requests in the current window.
+type Meter struct {
+	store    Store
+	window   Window
+	clock    clock.Clock
+	requests *prometheus.CounterVec
+	exceeded *prometheus.CounterVec
+}
+
+// NewMeter returns a Meter counting usage per window in store.
+func NewMeter(store Store, window Window, opts ...Option) *Meter {
+	m := &Meter{store: store, window: window, clock: clock.New()}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Add adds n requests to consumer's usage in the current window, and
+// returns the usage. A negative n takes back requests, such as those
+// rejected for exceeding the quota.
+func (m *Meter) Add(ctx context.Context, consumer string, n int64) (Usage, error) {
+	usage, err := m.add(ctx, consumer, n)
+	if err == nil && n > 0 {
+		m.observe(consumer, n)
+	}
+	return usage, err
+}
+
+func (m *Meter) add(ctx context.Context, consumer string, n int64) (Usage, error) {
+	start := m.window.Start(m.clock.Now())
+	count, err := m.store.Add(ctx, consumer, m.window, start, n)
+	if err != nil {
+		return Usage{}, err
+	}
+	return Usage{Consumer: consumer, Window: m.window, Start: start, End: m.window.End(start), Count: count}, nil
+}
+
+// observe counts n requests by consumer in the exported metrics.
+func (m *Meter) observe(consumer string, n int64) {
+	if m.requests != nil {
+		m.requests.WithLabelValues(consumer).Add(float64(n))
+	}
+}
+
+// Usage returns consumer's usage in the current window.
+func (m *Meter) Usage(ctx context.Context, consumer string) (Usage, error) {
+	start := m.window.Start(m.clock.Now())
+	count, err := m.store.Get(ctx, consumer, m.window, start)
+	if err != nil {
+		return Usage{}, err
+	}
+	return Usage{Consumer: consumer, Window: m.window, Start: start, End: m.window.End(start), Count: count}, nil
+}
@@ -0,0 +1,194 @@
+package metering
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jdotw/go-utils/clock"
+	"github.com/jdotw/go-utils/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	goredis "github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+)
+
+func TestWindow(t *testing.T) {
+	at := time.Date(2024, 1, 31, 10, 7, 30, 0, time.FixedZone("AEDT", 11*60*60))
+	tests := map[Window][2]time.Time{
+		Hour:  {time.Date(2024, 1, 30, 23, 0, 0, 0, time.UTC), time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)},
+		Day:   {time.Date(2024, 1, 30, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)},
+		Month: {time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for w, expected := range tests {
+		start := w.Start(at)
+		if !start.Equal(expected[0]) || !w.End(start).Equal(expected[1]) {
+			t.Errorf("%s: expected %s to %s, got %s to %s", w, expected[0], expected[1], start, w.End(start))
+		}
+	}
+}
+
+func TestMiddlewareEnforcesQuota(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC))
+	registry := prometheus.NewRegistry()
+	meter := NewMeter(NewMemoryStore(), Hour, WithClock(clk), Metrics(registry, "test"))
+	e := NewMiddleware(meter, KeyByAPIKey, FixedQuota(2), log.NewMockLogFactory())(
+		func(context.Context, interface{}) (interface{}, error) { return "ok", nil },
+	)
+	ctx := context.WithValue(context.Background(), APIKeyContextKey, "key-1")
+
+	for i := 0; i < 2; i++ {
+		if _, err := e(ctx, nil); err != nil {
+			t.Fatalf("request %d: expected to be allowed, got %v", i, err)
+		}
+	}
+	clk.Advance(15 * time.Minute)
+	_, err := e(ctx, nil)
+	var qe *QuotaExceededError
+	if !errors.As(err, &qe) {
+		t.Fatalf("expected a QuotaExceededError, got %v", err)
+	}
+	if qe.StatusCode() != 429 || qe.RetryAfter() != 45*time.Minute || qe.Headers().Get("X-Quota-Reset") != "1709290800" {
+		t.Errorf("unexpected error %+v with headers %v", qe, qe.Headers())
+	}
+	if usage, _ := meter.Usage(ctx, HashAPIKey("key-1")); usage.Count != 2 {
+		t.Errorf("expected rejected requests not to count, got %d", usage.Count)
+	}
+
+	// Other consumers and unidentified requests aren't affected
+	if _, err := e(context.WithValue(context.Background(), APIKeyContextKey, "key-2"), nil); err != nil {
+		t.Errorf("expected another consumer to be allowed, got %v", err)
+	}
+	if _, err := e(context.Background(), nil); err != nil {
+		t.Errorf("expected unmetered requests to be allowed, got %v", err)
+	}
+
+	// The quota resets with the window
+	clk.Advance(45 * time.Minute)
+	if _, err := e(ctx, nil); err != nil {
+		t.Errorf("expected the quota to reset, got %v", err)
+	}
+
+	if n := testutil.ToFloat64(meter.requests.WithLabelValues(HashAPIKey("key-1"))); n != 3 {
+		t.Errorf("expected 3 requests counted, got %v", n)
+	}
+	if n := testutil.ToFloat64(meter.exceeded.WithLabelValues(HashAPIKey("key-1"))); n != 1 {
+		t.Errorf("expected 1 rejection counted, got %v", n)
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Add(context.Context, string, Window, time.Time, int64) (int64, error) {
+	return 0, errors.New("connection refused")
+}
+
+func (failingStore) Get(context.Context, string, Window, time.Time) (int64, error) {
+	return 0, errors.New("connection refused")
+}
+
+func TestMiddlewareAllowsOnStoreFailure(t *testing.T) {
+	e := NewMiddleware(NewMeter(failingStore{}, Day), KeyByAPIKey, FixedQuota(1), log.NewMockLogFactory())(
+		func(context.Context, interface{}) (interface{}, error) { return "ok", nil },
+	)
+	ctx := context.WithValue(context.Background(), APIKeyContextKey, "key-1")
+	if _, err := e(ctx, nil); err != nil {
+		t.Errorf("expected the request to be allowed, got %v", err)
+	}
+}
+
+type fakeRedis struct {
+	goredis.Cmdable
+	counts  map[string]int64
+	expires map[string]time.Time
+}
+
+func (r *fakeRedis) IncrBy(ctx context.Context, key string, n int64) *goredis.IntCmd {
+	r.counts[key] += n
+	return goredis.NewIntResult(r.counts[key], nil)
+}
+
+func (r *fakeRedis) ExpireAt(ctx context.Context, key string, at time.Time) *goredis.BoolCmd {
+	r.expires[key] = at
+	return goredis.NewBoolResult(true, nil)
+}
+
+func (r *fakeRedis) Get(ctx context.Context, key string) *goredis.StringCmd {
+	n, ok := r.counts[key]
+	if !ok {
+		return goredis.NewStringResult("", goredis.Nil)
+	}
+	return goredis.NewStringResult(strconv.FormatInt(n, 10), nil)
+}
+
+func TestMemoryStoreExpires(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+	start := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	s.Add(ctx, "key-1", Hour, start, 1)
+	s.Add(ctx, "key-2", Day, Day.Start(start), 1)
+
+	// The previous window stays readable
+	next := start.Add(time.Hour)
+	s.Add(ctx, "key-1", Hour, next, 1)
+	if n, _ := s.Get(ctx, "key-1", Hour, start); n != 1 {
+		t.Errorf("expected the previous window to be kept, got %d", n)
+	}
+
+	s.Add(ctx, "key-1", Hour, next.Add(time.Hour), 1)
+	if n, _ := s.Get(ctx, "key-1", Hour, start); n != 0 {
+		t.Errorf("expected the expired window to be dropped, got %d", n)
+	}
+	if n, _ := s.Get(ctx, "key-2", Day, Day.Start(start)); n != 1 {
+		t.Errorf("expected the unexpired daily window to be kept, got %d", n)
+	}
+	if n := len(s.(*memoryStore).counts); n != 3 {
+		t.Errorf("expected 3 counts held, got %d", n)
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	client := &fakeRedis{counts: map[string]int64{}, expires: map[string]time.Time{}}
+	s := NewRedisStore(client, "usage:")
+	ctx := context.Background()
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	if n, err := s.Get(ctx, "key-1", Day, start); err != nil || n != 0 {
+		t.Errorf("expected no usage, got %d, %v", n, err)
+	}
+	s.Add(ctx, "key-1", Day, start, 1)
+	if n, err := s.Add(ctx, "key-1", Day, start, 2); err != nil || n != 3 {
+		t.Errorf("expected 3, got %d, %v", n, err)
+	}
+	if n, err := s.Get(ctx, "key-1", Day, start); err != nil || n != 3 {
+		t.Errorf("expected 3, got %d, %v", n, err)
+	}
+	key := "usage:key-1:day:1709251200"
+	if at := client.expires[key]; !at.Equal(time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected %s to expire a day after the window, got %v", key, client.expires)
+	}
+}
+
+func TestGormStore(t *testing.T) {
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sql string
+	db.Callback().Create().After("gorm:create").Register("test:record", func(db *gorm.DB) {
+		sql = db.Statement.SQL.String()
+	})
+
+	s := NewGormStore(db)
+	if _, err := s.Add(context.Background(), "key-1", Day, time.Now(), 1); err != nil {
+		t.Fatal(err)
+	}
+	expected := "ON CONFLICT (`consumer`,`period`,`period_start`) DO UPDATE SET `count`=`api_usage`.`count` + `excluded`.`count`,`updated_at`=`excluded`.`updated_at` RETURNING `count`"
+	if !strings.HasPrefix(sql, "INSERT INTO `api_usage`") || !strings.HasSuffix(strings.TrimSpace(sql), expected) {
+		t.Errorf("unexpected SQL: %s", sql)
+	}
+}
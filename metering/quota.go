@@ -0,0 +1,148 @@
+package metering
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/jdotw/go-utils/authn/jwt"
+	"github.com/jdotw/go-utils/log"
+	"go.uber.org/zap"
+)
+
+// KeyFunc identifies the consumer making an endpoint request. Returning
+// an empty key leaves the request unmetered.
+type KeyFunc func(ctx context.Context, request interface{}) string
+
+// KeyBySubject identifies consumers by the subject (sub) claim of the
+// JWT parsed by the authn middleware, which must run first.
+func KeyBySubject(ctx context.Context, _ interface{}) string {
+	return jwt.SubjectFromContext(ctx)
+}
+
+type contextKey string
+
+// APIKeyContextKey holds the key used to store the API key in the
+// context.
+const APIKeyContextKey contextKey = "APIKey"
+
+// APIKeyToContext moves the API key in the named request header to
+// context, for KeyByAPIKey.
+func APIKeyToContext(header string) kithttp.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if v := r.Header.Get(header); v != "" {
+			return context.WithValue(ctx, APIKeyContextKey, v)
+		}
+		return ctx
+	}
+}
+
+// KeyByAPIKey identifies consumers by the API key moved to context by
+// APIKeyToContext. The consumer is a hash of the key, HashAPIKey, as it
+// is used in metric labels, logs and stores. Authenticate the key before
+// metering by it, or clients can spread requests over made up keys.
+func KeyByAPIKey(ctx context.Context, _ interface{}) string {
+	key, _ := ctx.Value(APIKeyContextKey).(string)
+	if key == "" {
+		return ""
+	}
+	return HashAPIKey(key)
+}
+
+// HashAPIKey returns the consumer KeyByAPIKey uses for key, for looking
+// up the usage of a key.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "key_" + hex.EncodeToString(sum[:16])
+}
+
+// QuotaFunc returns the number of requests consumer may make per
+// window, such as from its plan. Zero or less is unlimited.
+type QuotaFunc func(ctx context.Context, consumer string) (int64, error)
+
+// FixedQuota allows every consumer limit requests per window.
+func FixedQuota(limit int64) QuotaFunc {
+	return func(context.Context, string) (int64, error) {
+		return limit, nil
+	}
+}
+
+// QuotaExceededError is returned for requests over the consumer's quota.
+// It maps to a 429 status with Retry-After set to the end of the window.
+type QuotaExceededError struct {
+	Usage Usage
+	Limit int64
+
+	retryAfter time.Duration
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("quota of %d requests per %s exceeded", e.Limit, e.Usage.Window)
+}
+
+// StatusCode implements go-kit's StatusCoder.
+func (e *QuotaExceededError) StatusCode() int {
+	return http.StatusTooManyRequests
+}
+
+// RetryAfter returns how long until the window ends and the quota
+// resets.
+func (e *QuotaExceededError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// Headers implements go-kit's Headerer.
+func (e *QuotaExceededError) Headers() http.Header {
+	h := http.Header{}
+	h.Set("X-Quota-Limit", strconv.FormatInt(e.Limit, 10))
+	h.Set("X-Quota-Remaining", "0")
+	h.Set("X-Quota-Reset", strconv.FormatInt(e.Usage.End.Unix(), 10))
+	return h
+}
+
+// NewMiddleware returns an endpoint middleware counting each request
+// against its consumer's usage and, when quota is not nil, rejecting
+// those over the consumer's quota with a *QuotaExceededError. Rejected
+// requests don't count towards usage. If the store or quota fails,
+// requests are allowed and the failure logged.
+func NewMiddleware(m *Meter, key KeyFunc, quota QuotaFunc, logger log.Factory) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			consumer := key(ctx, request)
+			if consumer == "" {
+				return next(ctx, request)
+			}
+			var limit int64
+			if quota != nil {
+				var err error
+				if limit, err = quota(ctx, consumer); err != nil {
+					logger.For(ctx).Error("Failed to read quota, allowing request", zap.String("consumer", consumer), zap.Error(err))
+				}
+			}
+			usage, err := m.add(ctx, consumer, 1)
+			if err != nil {
+				logger.For(ctx).Error("Failed to meter request, allowing request", zap.String("consumer", consumer), zap.Error(err))
+				return next(ctx, request)
+			}
+			if limit > 0 && usage.Count > limit {
+				if _, err := m.add(ctx, consumer, -1); err != nil {
+					log.Warn(logger.For(ctx), "Failed to uncount rejected request", zap.String("consumer", consumer), zap.Error(err))
+				}
+				if m.exceeded != nil {
+					m.exceeded.WithLabelValues(consumer).Inc()
+				}
+				logger.For(ctx).Info("Quota exceeded", zap.String("consumer", consumer), zap.Int64("limit", limit))
+				usage.Count = limit
+				return nil, &QuotaExceededError{Usage: usage, Limit: limit, retryAfter: usage.End.Sub(m.clock.Now())}
+			}
+			m.observe(consumer, 1)
+			return next(ctx, request)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package metering
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Store persists request counts by consumer and window.
+type Store interface {
+	// Add adds n to consumer's count in the window starting at start,
+	// returning the new count.
+	Add(ctx context.Context, consumer string, window Window, start time.Time, n int64) (int64, error)
+	// Get returns consumer's count in the window starting at start, or
+	// zero if it has made no requests.
+	Get(ctx context.Context, consumer string, window Window, start time.Time) (int64, error)
+}
+
+type redisStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedisStore returns a Store keeping counts in Redis under prefix.
+// Counts expire a window after their window ends, so the previous
+// window's usage remains readable.
+func NewRedisStore(client redis.Cmdable, prefix string) Store {
+	return &redisStore{client: client, prefix: prefix}
+}
+
+func (s *redisStore) key(consumer string, window Window, start time.Time) string {
+	return s.prefix + consumer + ":" + string(window) + ":" + strconv.FormatInt(start.Unix(), 10)
+}
+
+func (s *redisStore) Add(ctx context.Context, consumer string, window Window, start time.Time, n int64) (int64, error) {
+	key := s.key(consumer, window, start)
+	count, err := s.client.IncrBy(ctx, key, n).Result()
+	if err != nil {
+		return 0, err
+	}
+	end := window.End(start)
+	if err := s.client.ExpireAt(ctx, key, window.End(end)).Err(); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (s *redisStore) Get(ctx context.Context, consumer string, window Window, start time.Time) (int64, error) {
+	count, err := s.client.Get(ctx, s.key(consumer, window, start)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return count, err
+}
+
+type gormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore returns a Store keeping counts in the api_usage table of
+// db, which must support upserts returning the updated row, as Postgres
+// does.
+func NewGormStore(db *gorm.DB) Store {
+	return &gormStore{db: db}
+}
+
+func (s *gormStore) Add(ctx context.Context, consumer string, window Window, start time.Time, n int64) (int64, error) {
+	usage := Usage{Consumer: consumer, Window: window, Start: start.UTC(), Count: n}
+	err := s.db.WithContext(ctx).Clauses(
+		clause.OnConflict{
+			Columns: []clause.Column{{Name: "consumer"}, {Name: "period"}, {Name: "period_start"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"count":      gorm.Expr("? + ?", clause.Column{Table: "api_usage", Name: "count"}, clause.Column{Table: "excluded", Name: "count"}),
+				"updated_at": gorm.Expr("?", clause.Column{Table: "excluded", Name: "updated_at"}),
+			}),
+		},
+		clause.Returning{Columns: []clause.Column{{Name: "count"}}},
+	).Create(&usage).Error
+	if err != nil {
+		return 0, err
+	}
+	return usage.Count, nil
+}
+
+func (s *gormStore) Get(ctx context.Context, consumer string, window Window, start time.Time) (int64, error) {
+	var usage Usage
+	err := s.db.WithContext(ctx).
+		Where("consumer = ? AND period = ? AND period_start = ?", consumer, window, start.UTC()).
+		Take(&usage).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return usage.Count, nil
+}
+
+type usageKey struct {
+	consumer string
+	window   Window
+	start    int64
+}
+
+type memoryStore struct {
+	mu     sync.Mutex
+	counts map[usageKey]int64
+	swept  int64
+}
+
+// NewMemoryStore returns a Store holding counts in process memory, for
+// tests and single replica services. Like NewRedisStore, counts are
+// dropped a window after their window ends.
+func NewMemoryStore() Store {
+	return &memoryStore{counts: make(map[usageKey]int64)}
+}
+
+func (s *memoryStore) Add(_ context.Context, consumer string, window Window, start time.Time, n int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if start.Unix() > s.swept {
+		// A new window has started, so older ones may have expired
+		s.sweep(start)
+		s.swept = start.Unix()
+	}
+	k := usageKey{consumer, window, start.Unix()}
+	s.counts[k] += n
+	return s.counts[k], nil
+}
+
+// sweep drops counts whose window ended a window before now.
+func (s *memoryStore) sweep(now time.Time) {
+	for k := range s.counts {
+		if !k.window.End(k.window.End(time.Unix(k.start, 0).UTC())).After(now) {
+			delete(s.counts, k)
+		}
+	}
+}
+
+func (s *memoryStore) Get(_ context.Context, consumer string, window Window, start time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[usageKey{consumer, window, start.Unix()}], nil
+}
@@ -0,0 +1,160 @@
+// Package metrics instruments endpoints with Prometheus RED metrics
+// (rate, errors and duration) and exposes the collected metrics. Samples
+// recorded inside a sampled trace carry its trace ID as an exemplar, so
+// dashboards can jump from a latency spike to an example trace.
+//
+//	red := metrics.NewRED(prometheus.DefaultRegisterer, "orders")
+//	endpoint = red.Middleware("GetOrder")(endpoint)
+//	mux.Handle("/metrics", metrics.Handler(prometheus.DefaultGatherer))
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/uber/jaeger-client-go"
+)
+
+// RED records the request count, error count and duration of endpoints,
+// labelled by endpoint name.
+type RED struct {
+	requests *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// NewRED registers RED collectors with registerer, under namespace when
+// it isn't empty. Collectors already registered by another RED with the
+// same namespace are shared. A nil registerer uses
+// prometheus.DefaultRegisterer.
+func NewRED(registerer prometheus.Registerer, namespace string) *RED {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+	return &RED{
+		requests: MustRegister(registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "endpoint_requests_total",
+			Help:      "Number of requests handled, by endpoint.",
+		}, []string{"endpoint"})),
+		errors: MustRegister(registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "endpoint_errors_total",
+			Help:      "Number of failed requests, by endpoint and class: client for 4xx errors and server for the rest.",
+		}, []string{"endpoint", "class"})),
+		duration: MustRegister(registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "endpoint_request_duration_seconds",
+			Help:      "Time taken to handle requests, by endpoint.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"endpoint"})),
+	}
+}
+
+// Middleware returns endpoint middleware recording requests to the
+// endpoint called name.
+func (r *RED) Middleware(name string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			start := time.Now()
+			defer func() {
+				exemplar := exemplarLabels(ctx)
+				add(r.requests.WithLabelValues(name), exemplar)
+				if err != nil {
+					add(r.errors.WithLabelValues(name, errorClass(err)), exemplar)
+				}
+				observe(r.duration.WithLabelValues(name), time.Since(start).Seconds(), exemplar)
+			}()
+			return next(ctx, request)
+		}
+	}
+}
+
+// statusCoder is implemented by errors that map to an HTTP status, like
+// go-kit's StatusCoder.
+type statusCoder interface {
+	StatusCode() int
+}
+
+func errorClass(err error) string {
+	var sc statusCoder
+	if errors.As(err, &sc) && sc.StatusCode() >= 400 && sc.StatusCode() < 500 {
+		return "client"
+	}
+	return "server"
+}
+
+// exemplarLabels returns the exemplar labels for the sampled trace in
+// ctx, or nil.
+func exemplarLabels(ctx context.Context) prometheus.Labels {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return nil
+	}
+	if sc, ok := span.Context().(jaeger.SpanContext); ok && sc.IsSampled() {
+		return prometheus.Labels{"trace_id": sc.TraceID().String()}
+	}
+	return nil
+}
+
+func add(c prometheus.Counter, exemplar prometheus.Labels) {
+	if ea, ok := c.(prometheus.ExemplarAdder); ok && exemplar != nil {
+		ea.AddWithExemplar(1, exemplar)
+		return
+	}
+	c.Inc()
+}
+
+func observe(o prometheus.Observer, v float64, exemplar prometheus.Labels) {
+	if eo, ok := o.(prometheus.ExemplarObserver); ok && exemplar != nil {
+		eo.ObserveWithExemplar(v, exemplar)
+		return
+	}
+	o.Observe(v)
+}
+
+// Register registers c with registerer, returning the already registered
+// collector when there is one, so collectors can be shared. It fails if
+// registration does, or if the registered collector is of another type.
+func Register[T prometheus.Collector](registerer prometheus.Registerer, c T) (T, error) {
+	err := registerer.Register(c)
+	if err == nil {
+		return c, nil
+	}
+	var are prometheus.AlreadyRegisteredError
+	if !errors.As(err, &are) {
+		return c, err
+	}
+	existing, ok := are.ExistingCollector.(T)
+	if !ok {
+		return c, fmt.Errorf("metrics: collector already registered as %T", are.ExistingCollector)
+	}
+	return existing, nil
+}
+
+// MustRegister is like Register but panics if it fails, for collectors
+// created during startup.
+func MustRegister[T prometheus.Collector](registerer prometheus.Registerer, c T) T {
+	c, err := Register(registerer, c)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Handler exposes the metrics gathered by gatherer, in the OpenMetrics
+// format when scrapers accept it so exemplars are included. A nil
+// gatherer uses prometheus.DefaultGatherer.
+func Handler(gatherer prometheus.Gatherer) http.Handler {
+	if gatherer == nil {
+		gatherer = prometheus.DefaultGatherer
+	}
+	return promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/uber/jaeger-client-go"
+)
+
+type notFoundError struct{}
+
+func (notFoundError) Error() string   { return "not found" }
+func (notFoundError) StatusCode() int { return http.StatusNotFound }
+
+func TestRED(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	red := NewRED(registry, "test")
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), jaeger.NewNullReporter())
+	defer closer.Close()
+
+	results := []error{nil, notFoundError{}, errors.New("boom")}
+	i := 0
+	e := red.Middleware("GetOrder")(func(ctx context.Context, request interface{}) (interface{}, error) {
+		err := results[i]
+		i++
+		return nil, err
+	})
+	span := tracer.StartSpan("request")
+	ctx := opentracing.ContextWithSpan(context.Background(), span)
+	for range results {
+		e(ctx, nil)
+	}
+
+	if n := testutil.ToFloat64(red.requests.WithLabelValues("GetOrder")); n != 3 {
+		t.Errorf("expected 3 requests, got %v", n)
+	}
+	for class, expected := range map[string]float64{"client": 1, "server": 1} {
+		if n := testutil.ToFloat64(red.errors.WithLabelValues("GetOrder", class)); n != expected {
+			t.Errorf("expected %v %s errors, got %v", expected, class, n)
+		}
+	}
+
+	// A second RED shares the collectors
+	if NewRED(registry, "test").requests != red.requests {
+		t.Error("expected collectors to be shared")
+	}
+
+	// Exemplars are exposed in the OpenMetrics format
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=0.0.1")
+	w := httptest.NewRecorder()
+	Handler(registry).ServeHTTP(w, req)
+	traceID := span.Context().(jaeger.SpanContext).TraceID().String()
+	if body := w.Body.String(); !strings.Contains(body, `test_endpoint_requests_total{endpoint="GetOrder"} 3.0 # {trace_id="`+traceID+`"}`) {
+		t.Errorf("expected an exemplar with the trace ID:\n%s", body)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	opts := prometheus.CounterOpts{Name: "jobs_total", Help: "Jobs."}
+	first := MustRegister(registry, prometheus.NewCounterVec(opts, []string{"pool"}))
+	second, err := Register(registry, prometheus.NewCounterVec(opts, []string{"pool"}))
+	if err != nil || second != first {
+		t.Errorf("expected the registered collector, got %v, %v", second, err)
+	}
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "jobs_total", Help: "Jobs."}, []string{"pool"})
+	if _, err := Register(registry, gauge); err == nil || !strings.Contains(err.Error(), "CounterVec") {
+		t.Error("expected an error registering a collector of another type")
+	}
+}
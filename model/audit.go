@@ -0,0 +1,89 @@
+package model
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/jdotw/go-utils/authn/jwt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Audited records who created and last updated a record. Register
+// AuditPlugin to have the fields stamped from the request context.
+type Audited struct {
+	CreatedBy string `json:"created_by,omitempty"`
+	UpdatedBy string `json:"updated_by,omitempty"`
+}
+
+// AuditPlugin is a gorm plugin that sets CreatedBy and UpdatedBy on
+// models that have them, from the subject of the JWT in the statement's
+// context. Queries must carry the request context with WithContext.
+//
+//	db.Use(&model.AuditPlugin{})
+type AuditPlugin struct {
+	// Subject returns the acting user for ctx. It defaults to the JWT
+	// subject claim.
+	Subject func(ctx context.Context) string
+}
+
+func (p *AuditPlugin) Name() string {
+	return "go-utils:audit"
+}
+
+func (p *AuditPlugin) Initialize(db *gorm.DB) error {
+	if p.Subject == nil {
+		p.Subject = jwt.SubjectFromContext
+	}
+	if err := db.Callback().Create().Before("gorm:create").Register("go-utils:audit_create", p.beforeCreate); err != nil {
+		return err
+	}
+	return db.Callback().Update().Before("gorm:update").Register("go-utils:audit_update", p.beforeUpdate)
+}
+
+func (p *AuditPlugin) beforeCreate(db *gorm.DB) {
+	if db.Statement.Schema == nil {
+		return
+	}
+	ctx := db.Statement.Context
+	subject := p.Subject(ctx)
+	if subject == "" {
+		return
+	}
+	for _, name := range []string{"CreatedBy", "UpdatedBy"} {
+		if field := db.Statement.Schema.LookUpField(name); field != nil {
+			setIfZero(ctx, field, db.Statement.ReflectValue, subject)
+		}
+	}
+}
+
+func (p *AuditPlugin) beforeUpdate(db *gorm.DB) {
+	if db.Statement.Schema == nil || db.Statement.Schema.LookUpField("UpdatedBy") == nil {
+		return
+	}
+	if subject := p.Subject(db.Statement.Context); subject != "" {
+		db.Statement.SetColumn("UpdatedBy", subject, true)
+	}
+}
+
+// setIfZero sets field on a struct, or each struct in a slice, where it
+// hasn't been set explicitly.
+func setIfZero(ctx context.Context, field *schema.Field, rv reflect.Value, value interface{}) {
+	eachStruct(rv, func(rv reflect.Value) {
+		if _, zero := field.ValueOf(ctx, rv); zero {
+			field.Set(ctx, rv, value)
+		}
+	})
+}
+
+// eachStruct calls fn with rv, or each element of rv if it is a slice.
+func eachStruct(rv reflect.Value, fn func(reflect.Value)) {
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			eachStruct(reflect.Indirect(rv.Index(i)), fn)
+		}
+	case reflect.Struct:
+		fn(rv)
+	}
+}
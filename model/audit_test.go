@@ -0,0 +1,43 @@
+package model
+
+import (
+	"context"
+	"testing"
+
+	stdjwt "github.com/golang-jwt/jwt/v4"
+	"github.com/jdotw/go-utils/authn/jwt"
+)
+
+type auditedWidget struct {
+	Defaults
+	Audited
+	Name string
+}
+
+func TestAuditPlugin(t *testing.T) {
+	db := dryRunDB(t)
+	if err := db.Use(&AuditPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.WithValue(context.Background(), jwt.JWTClaimsContextKey, stdjwt.MapClaims{"sub": "user-1"})
+
+	widgets := []auditedWidget{{Name: "a"}, {Name: "b", Audited: Audited{CreatedBy: "importer"}}}
+	db.WithContext(ctx).Create(&widgets)
+	if widgets[0].CreatedBy != "user-1" || widgets[0].UpdatedBy != "user-1" {
+		t.Errorf("audit fields not stamped on create: %+v", widgets[0].Audited)
+	}
+	if widgets[1].CreatedBy != "importer" {
+		t.Errorf("explicit CreatedBy should be kept; got %q", widgets[1].CreatedBy)
+	}
+
+	stmt := db.WithContext(ctx).Model(&auditedWidget{}).Where("id = ?", "1").Updates(map[string]interface{}{"name": "c"}).Statement
+	found := false
+	for _, v := range stmt.Vars {
+		if v == "user-1" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("UpdatedBy not set on update: %s %v", stmt.SQL.String(), stmt.Vars)
+	}
+}
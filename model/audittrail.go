@@ -0,0 +1,410 @@
+package model
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/jdotw/go-utils/authn/jwt"
+	"github.com/jdotw/go-utils/log"
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Change-data audit trail
+
+// Audit operations recorded in AuditRecord.Operation.
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// AuditRecord is a before and after image of a changed row.
+type AuditRecord struct {
+	ID        string                        `json:"id" gorm:"primaryKey"`
+	Table     string                        `json:"table" gorm:"index:idx_audit_records_row"`
+	RowID     string                        `json:"row_id" gorm:"index:idx_audit_records_row"`
+	Operation string                        `json:"operation"`
+	Before    JSONB[map[string]interface{}] `json:"before"`
+	After     JSONB[map[string]interface{}] `json:"after"`
+	Diff      JSONB[map[string]AuditChange] `json:"diff"`
+	Actor     string                        `json:"actor,omitempty"`
+	TraceID   string                        `json:"trace_id,omitempty"`
+	CreatedAt time.Time                     `json:"created_at" gorm:"index"`
+}
+
+// AuditChange is the old and new value of a changed column.
+type AuditChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// AuditTrailPlugin is a gorm plugin recording an AuditRecord for each row
+// created, updated or deleted in the tables of Models. Records are
+// written asynchronously, off the request path, so they are recorded
+// once the statement succeeds even if its transaction later rolls back;
+// use with care where that matters. EncryptedString columns are
+// recorded as AuditRedacted rather than their plaintext. Migrate
+// AuditRecord to create the audit table.
+//
+//	audit := &model.AuditTrailPlugin{Models: []interface{}{&Account{}}, Logger: logger}
+//	db.Use(audit)
+//	defer audit.Close()
+type AuditTrailPlugin struct {
+	// Models lists the models to audit.
+	Models []interface{}
+	// Actor returns the user making a change. It defaults to the JWT
+	// subject claim.
+	Actor func(ctx context.Context) string
+	// Write stores records. It defaults to inserting them into the
+	// audit_records table.
+	Write func(ctx context.Context, records []AuditRecord) error
+	// Logger reports records that fail to write or are dropped.
+	Logger log.Factory
+	// BufferSize is the number of records held for writing before new
+	// ones are dropped. It defaults to 1000.
+	BufferSize int
+
+	tables  map[string]bool
+	mu      sync.RWMutex
+	closed  bool
+	records chan AuditRecord
+	done    chan struct{}
+}
+
+// AuditRedacted replaces the values of encrypted columns in audit
+// images.
+const AuditRedacted = "[encrypted]"
+
+const auditBeforeKey = "go-utils:audit_before"
+
+func (p *AuditTrailPlugin) Name() string {
+	return "go-utils:audit_trail"
+}
+
+func (p *AuditTrailPlugin) Initialize(db *gorm.DB) error {
+	p.tables = make(map[string]bool)
+	for _, m := range p.Models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(m); err != nil {
+			return err
+		}
+		p.tables[stmt.Schema.Table] = true
+	}
+	if p.Actor == nil {
+		p.Actor = jwt.SubjectFromContext
+	}
+	if p.Write == nil {
+		writer := db.Session(&gorm.Session{NewDB: true})
+		p.Write = func(ctx context.Context, records []AuditRecord) error {
+			return writer.WithContext(ctx).Create(&records).Error
+		}
+	}
+	if p.Logger == nil {
+		p.Logger = log.NewMockLogFactory()
+	}
+	if p.BufferSize < 1 {
+		p.BufferSize = 1000
+	}
+	p.records = make(chan AuditRecord, p.BufferSize)
+	p.done = make(chan struct{})
+	go p.run()
+
+	cb := db.Callback()
+	if err := cb.Create().After("gorm:create").Register("go-utils:audit_trail_create", p.afterCreate); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("go-utils:audit_trail_before_update", p.snapshotBefore); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Register("go-utils:audit_trail_update", p.afterUpdate); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("go-utils:audit_trail_before_delete", p.snapshotBefore); err != nil {
+		return err
+	}
+	return cb.Delete().After("gorm:delete").Register("go-utils:audit_trail_delete", p.afterDelete)
+}
+
+// Close stops accepting records and waits for buffered ones to be
+// written. Changes made after Close are not recorded.
+func (p *AuditTrailPlugin) Close() error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.records)
+	}
+	p.mu.Unlock()
+	<-p.done
+	return nil
+}
+
+func (p *AuditTrailPlugin) run() {
+	defer close(p.done)
+	for record := range p.records {
+		// Batch whatever else is already waiting
+		batch := []AuditRecord{record}
+		for len(batch) < 100 {
+			select {
+			case r, ok := <-p.records:
+				if !ok {
+					p.write(batch)
+					return
+				}
+				batch = append(batch, r)
+				continue
+			default:
+			}
+			break
+		}
+		p.write(batch)
+	}
+}
+
+func (p *AuditTrailPlugin) write(batch []AuditRecord) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := p.Write(ctx, batch); err != nil {
+		p.Logger.Bg().Error("Failed to write audit records", zap.Int("count", len(batch)), zap.Error(err))
+	}
+}
+
+func (p *AuditTrailPlugin) emit(db *gorm.DB, op string, rowID string, before, after map[string]interface{}) {
+	ctx := db.Statement.Context
+	before = redactEncrypted(db.Statement.Schema, before)
+	after = redactEncrypted(db.Statement.Schema, after)
+	record := AuditRecord{
+		ID:        NewUUIDv7(),
+		Table:     db.Statement.Schema.Table,
+		RowID:     rowID,
+		Operation: op,
+		Before:    NewJSONB(before),
+		After:     NewJSONB(after),
+		Diff:      NewJSONB(diffRows(before, after)),
+		Actor:     p.Actor(ctx),
+		TraceID:   traceID(ctx),
+		CreatedAt: time.Now(),
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		p.Logger.For(ctx).Error("Audit trail closed, dropping record", zap.String("table", record.Table), zap.String("row_id", rowID))
+		return
+	}
+	select {
+	case p.records <- record:
+	default:
+		p.Logger.For(ctx).Error("Audit buffer full, dropping record", zap.String("table", record.Table), zap.String("row_id", rowID))
+	}
+}
+
+var encryptedStringType = reflect.TypeOf(EncryptedString(""))
+
+// redactEncrypted replaces the values of EncryptedString columns, which
+// are plaintext in images built from structs and ciphertext in images
+// loaded from the database.
+func redactEncrypted(s *schema.Schema, row map[string]interface{}) map[string]interface{} {
+	for _, f := range s.Fields {
+		t := f.FieldType
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t != encryptedStringType {
+			continue
+		}
+		if v, ok := row[f.DBName]; ok && v != nil {
+			row[f.DBName] = AuditRedacted
+		}
+	}
+	return row
+}
+
+func (p *AuditTrailPlugin) audited(db *gorm.DB) bool {
+	s := db.Statement.Schema
+	return db.Error == nil && s != nil && s.PrioritizedPrimaryField != nil && p.tables[s.Table]
+}
+
+func (p *AuditTrailPlugin) afterCreate(db *gorm.DB) {
+	if !p.audited(db) {
+		return
+	}
+	ctx := db.Statement.Context
+	s := db.Statement.Schema
+	eachStruct(db.Statement.ReflectValue, func(rv reflect.Value) {
+		after := structRow(ctx, s, rv)
+		p.emit(db, AuditCreate, rowID(after[s.PrioritizedPrimaryField.DBName]), nil, after)
+	})
+}
+
+// snapshotBefore loads the rows an update or delete is about to change.
+func (p *AuditTrailPlugin) snapshotBefore(db *gorm.DB) {
+	if !p.audited(db) {
+		return
+	}
+	query, ok := p.targetQuery(db)
+	if !ok {
+		return
+	}
+	var rows []map[string]interface{}
+	if err := query.Find(&rows).Error; err != nil {
+		p.Logger.For(db.Statement.Context).Error("Failed to load audit before images", zap.Error(err))
+		return
+	}
+	db.InstanceSet(auditBeforeKey, rows)
+}
+
+func (p *AuditTrailPlugin) afterUpdate(db *gorm.DB) {
+	before, ok := p.before(db)
+	if !ok || len(before) == 0 {
+		return
+	}
+	pk := db.Statement.Schema.PrioritizedPrimaryField.DBName
+	ids := make([]interface{}, len(before))
+	for i, row := range before {
+		ids[i] = row[pk]
+	}
+	var after []map[string]interface{}
+	err := p.session(db).Model(db.Statement.Model).
+		Where(clause.IN{Column: clause.Column{Table: clause.CurrentTable, Name: pk}, Values: ids}).
+		Find(&after).Error
+	if err != nil {
+		p.Logger.For(db.Statement.Context).Error("Failed to load audit after images", zap.Error(err))
+		return
+	}
+	afterByID := make(map[string]map[string]interface{}, len(after))
+	for _, row := range after {
+		afterByID[rowID(row[pk])] = normalizeRow(row)
+	}
+	for _, row := range before {
+		id := rowID(row[pk])
+		p.emit(db, AuditUpdate, id, normalizeRow(row), afterByID[id])
+	}
+}
+
+func (p *AuditTrailPlugin) afterDelete(db *gorm.DB) {
+	before, ok := p.before(db)
+	if !ok {
+		return
+	}
+	pk := db.Statement.Schema.PrioritizedPrimaryField.DBName
+	for _, row := range before {
+		p.emit(db, AuditDelete, rowID(row[pk]), normalizeRow(row), nil)
+	}
+}
+
+func (p *AuditTrailPlugin) before(db *gorm.DB) ([]map[string]interface{}, bool) {
+	if !p.audited(db) {
+		return nil, false
+	}
+	v, ok := db.InstanceGet(auditBeforeKey)
+	if !ok {
+		return nil, false
+	}
+	rows, ok := v.([]map[string]interface{})
+	return rows, ok
+}
+
+// session returns a fresh session on the statement's connection, so
+// snapshots see the statement's transaction.
+func (p *AuditTrailPlugin) session(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true, Context: db.Statement.Context, SkipHooks: true})
+}
+
+// targetQuery builds a query for the rows the statement will change,
+// from its WHERE clause and the primary key of its model, if set.
+func (p *AuditTrailPlugin) targetQuery(db *gorm.DB) (*gorm.DB, bool) {
+	stmt := db.Statement
+	query := p.session(db).Model(stmt.Model)
+	scoped := false
+	if where, ok := stmt.Clauses["WHERE"]; ok {
+		if w, ok := where.Expression.(clause.Where); ok && len(w.Exprs) > 0 {
+			query.Statement.AddClause(clause.Where{Exprs: w.Exprs})
+			scoped = true
+		}
+	}
+	pk := stmt.Schema.PrioritizedPrimaryField
+	if stmt.ReflectValue.Kind() == reflect.Struct {
+		if v, zero := pk.ValueOf(stmt.Context, stmt.ReflectValue); !zero {
+			query = query.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: pk.DBName}, Value: v})
+			scoped = true
+		}
+	}
+	return query, scoped
+}
+
+func structRow(ctx context.Context, s *schema.Schema, rv reflect.Value) map[string]interface{} {
+	row := make(map[string]interface{}, len(s.Fields))
+	for _, f := range s.Fields {
+		if f.DBName == "" {
+			continue
+		}
+		v, _ := f.ValueOf(ctx, rv)
+		row[f.DBName] = v
+	}
+	return row
+}
+
+// normalizeRow converts driver byte slices to strings so images encode
+// as readable JSON.
+func normalizeRow(row map[string]interface{}) map[string]interface{} {
+	for k, v := range row {
+		if b, ok := v.([]byte); ok {
+			row[k] = string(b)
+		}
+	}
+	return row
+}
+
+func rowID(v interface{}) string {
+	switch id := v.(type) {
+	case string:
+		return id
+	case []byte:
+		return string(id)
+	case nil:
+		return ""
+	}
+	b, _ := NewJSONB(v).Value()
+	s, _ := b.(string)
+	return s
+}
+
+// diffRows returns the columns whose values differ between two images.
+func diffRows(before, after map[string]interface{}) map[string]AuditChange {
+	diff := make(map[string]AuditChange)
+	for k, v := range after {
+		if old, ok := before[k]; !ok || !sameValue(old, v) {
+			diff[k] = AuditChange{From: before[k], To: v}
+		}
+	}
+	for k, v := range before {
+		if _, ok := after[k]; !ok {
+			diff[k] = AuditChange{From: v}
+		}
+	}
+	return diff
+}
+
+func sameValue(a, b interface{}) bool {
+	if ta, ok := a.(time.Time); ok {
+		if tb, ok := b.(time.Time); ok {
+			return ta.Equal(tb)
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func traceID(ctx context.Context) string {
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		if sc, ok := span.Context().(jaeger.SpanContext); ok {
+			return sc.TraceID().String()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,151 @@
+package model
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func auditedDB(t *testing.T) (*gorm.DB, *AuditTrailPlugin, *[]AuditRecord) {
+	t.Helper()
+	db := dryRunDB(t)
+	var mu sync.Mutex
+	var written []AuditRecord
+	p := &AuditTrailPlugin{
+		Models: []interface{}{&widget{}},
+		Actor:  func(context.Context) string { return "user-1" },
+		Write: func(_ context.Context, records []AuditRecord) error {
+			mu.Lock()
+			defer mu.Unlock()
+			written = append(written, records...)
+			return nil
+		},
+	}
+	if err := db.Use(p); err != nil {
+		t.Fatal(err)
+	}
+	return db, p, &written
+}
+
+func TestAuditTrailCreate(t *testing.T) {
+	db, p, written := auditedDB(t)
+
+	w := widget{Name: "a"}
+	w.ID = "w1"
+	if err := db.Create(&w).Error; err != nil {
+		t.Fatal(err)
+	}
+	p.Close()
+
+	if len(*written) != 1 {
+		t.Fatalf("expected one record, got %d", len(*written))
+	}
+	r := (*written)[0]
+	if r.Table != "widgets" || r.RowID != "w1" || r.Operation != AuditCreate || r.Actor != "user-1" || r.ID == "" {
+		t.Errorf("unexpected record: %+v", r)
+	}
+	if r.Before.Val != nil || r.After.Val["name"] != "a" {
+		t.Errorf("unexpected images: before %v, after %v", r.Before.Val, r.After.Val)
+	}
+	if c, ok := r.Diff.Val["name"]; !ok || c.From != nil || c.To != "a" {
+		t.Errorf("unexpected diff: %v", r.Diff.Val)
+	}
+}
+
+func TestAuditTrailUpdate(t *testing.T) {
+	db, p, written := auditedDB(t)
+
+	// The before image is loaded first, then the after image
+	images := [][]map[string]interface{}{
+		{{"id": "w1", "name": []byte("a")}},
+		{{"id": "w1", "name": []byte("b")}},
+	}
+	var queries int
+	err := db.Callback().Query().Replace("gorm:query", func(db *gorm.DB) {
+		reflect.ValueOf(db.Statement.Dest).Elem().Set(reflect.ValueOf(images[queries]))
+		queries++
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := widget{}
+	w.ID = "w1"
+	if err := db.Model(&w).Update("name", "b").Error; err != nil {
+		t.Fatal(err)
+	}
+	p.Close()
+
+	if len(*written) != 1 {
+		t.Fatalf("expected one record, got %d", len(*written))
+	}
+	r := (*written)[0]
+	if r.RowID != "w1" || r.Operation != AuditUpdate {
+		t.Errorf("unexpected record: %+v", r)
+	}
+	expected := map[string]AuditChange{"name": {From: "a", To: "b"}}
+	if !reflect.DeepEqual(r.Diff.Val, expected) {
+		t.Errorf("expected diff %v, got %v", expected, r.Diff.Val)
+	}
+}
+
+func TestAuditTrailIgnoresOtherModels(t *testing.T) {
+	db, p, written := auditedDB(t)
+
+	if err := db.Create(&Audited{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	p.Close()
+
+	if len(*written) != 0 {
+		t.Errorf("unaudited models should not be recorded: %+v", *written)
+	}
+}
+
+type secretWidget struct {
+	Defaults
+	Name   string
+	Secret EncryptedString
+}
+
+func TestAuditTrailRedactsEncrypted(t *testing.T) {
+	SetEncryptionKeys(NewStaticKeys("k1", map[string][]byte{"k1": make([]byte, 32)}))
+	defer SetEncryptionKeys(nil)
+	db, p, written := auditedDB(t)
+	p.tables["secret_widgets"] = true
+
+	w := secretWidget{Name: "a", Secret: "hunter2"}
+	w.ID = "w1"
+	if err := db.Create(&w).Error; err != nil {
+		t.Fatal(err)
+	}
+	p.Close()
+
+	if len(*written) != 1 {
+		t.Fatalf("expected one record, got %d", len(*written))
+	}
+	r := (*written)[0]
+	if r.After.Val["secret"] != AuditRedacted || r.Diff.Val["secret"].To != AuditRedacted {
+		t.Errorf("expected the encrypted column to be redacted, got %v and %v", r.After.Val, r.Diff.Val)
+	}
+}
+
+func TestAuditTrailAfterClose(t *testing.T) {
+	db, p, written := auditedDB(t)
+	p.Close()
+
+	w := widget{Name: "a"}
+	w.ID = "w1"
+	if err := db.Create(&w).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(*written) != 0 {
+		t.Errorf("expected changes after Close to be dropped, got %+v", *written)
+	}
+}
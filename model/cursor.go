@@ -0,0 +1,214 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Keyset (cursor) pagination. Rather than skipping rows with OFFSET,
+// each page seeks past the sort key and ID of the last row seen, so
+// pages stay stable while rows are inserted and deleted.
+
+// ErrInvalidCursor is returned for a cursor that can't be decoded.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// CursorRequest selects a page of a cursor paginated list. An empty
+// Cursor selects the first page.
+type CursorRequest struct {
+	Cursor string `json:"cursor,omitempty" query:"cursor"`
+	Limit  int    `json:"limit" query:"limit" default:"20" validate:"min=1,max=100"`
+}
+
+// CursorOrder is the order of a cursor paginated list: a sort column,
+// with the ID column breaking ties so every row has a unique position.
+type CursorOrder struct {
+	Column   string
+	Desc     bool
+	IDColumn string // defaults to "id"
+}
+
+// cursor is the position encoded in an opaque cursor string.
+type cursor struct {
+	Key    interface{} `json:"k"`
+	ID     interface{} `json:"i"`
+	Before bool        `json:"b,omitempty"`
+}
+
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	// Numbers are kept exact until they are converted to the column's
+	// type by typed
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var c cursor
+	if err := dec.Decode(&c); err != nil || c.ID == nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// typed converts a decoded cursor value back to the Go type of field,
+// such as int64 or time.Time, so it compares like the column.
+func typed(field *schema.Field, v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	ptr := reflect.New(field.FieldType)
+	if err := json.Unmarshal(b, ptr.Interface()); err != nil {
+		return nil, err
+	}
+	return ptr.Elem().Interface(), nil
+}
+
+// CursorPage is a page of a cursor paginated list. It implements
+// transport.Paginated, so HTTPEncodePageResponse adds next and prev
+// Link headers for it.
+type CursorPage[T any] struct {
+	Items      []T    `json:"items"`
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+}
+
+func (p CursorPage[T]) PageInfo() PageInfo {
+	return PageInfo{Limit: p.Limit, Count: len(p.Items), NextCursor: p.NextCursor, PrevCursor: p.PrevCursor}
+}
+
+// cursorError is a 400 error wrapping ErrInvalidCursor.
+type cursorError struct{}
+
+func (cursorError) Error() string {
+	return ErrInvalidCursor.Error()
+}
+
+func (cursorError) Unwrap() error {
+	return ErrInvalidCursor
+}
+
+// StatusCode implements go-kit's StatusCoder.
+func (cursorError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// FindCursorPage loads the page of rows matched by db that req selects,
+// in the given order, with cursors for the neighbouring pages. An
+// undecodable cursor fails with an error matching ErrInvalidCursor that
+// maps to a 400 status.
+//
+//	page, err := model.FindCursorPage[Widget](ctx, db, req, model.CursorOrder{Column: "created_at", Desc: true})
+func FindCursorPage[T any](ctx context.Context, db *gorm.DB, req CursorRequest, order CursorOrder) (CursorPage[T], error) {
+	if order.IDColumn == "" {
+		order.IDColumn = "id"
+	}
+	limit := req.Limit
+	if limit < 1 {
+		limit = DefaultPageLimit
+	}
+	if limit > MaxPageLimit {
+		limit = MaxPageLimit
+	}
+
+	keyField, idField, err := cursorFields[T](db, order)
+	if err != nil {
+		return CursorPage[T]{}, err
+	}
+	var after *cursor
+	if req.Cursor != "" {
+		c, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return CursorPage[T]{}, cursorError{}
+		}
+		if c.Key, err = typed(keyField, c.Key); err != nil {
+			return CursorPage[T]{}, cursorError{}
+		}
+		if c.ID, err = typed(idField, c.ID); err != nil {
+			return CursorPage[T]{}, cursorError{}
+		}
+		after = c
+	}
+	backward := after != nil && after.Before
+
+	// Walking backwards reverses the order, and the rows are flipped back below
+	desc := order.Desc != backward
+	q := db.WithContext(ctx).Model(new(T))
+	if after != nil {
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		q = q.Where(clause.Expr{
+			SQL:  "(?, ?) " + op + " (?, ?)",
+			Vars: []interface{}{clause.Column{Name: order.Column}, clause.Column{Name: order.IDColumn}, after.Key, after.ID},
+		})
+	}
+	q = q.Order(clause.OrderByColumn{Column: clause.Column{Name: order.Column}, Desc: desc}).
+		Order(clause.OrderByColumn{Column: clause.Column{Name: order.IDColumn}, Desc: desc}).
+		Limit(limit + 1)
+
+	var items []T
+	if err := q.Find(&items).Error; err != nil {
+		return CursorPage[T]{}, err
+	}
+	more := len(items) > limit
+	if more {
+		items = items[:limit]
+	}
+	if backward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	page := CursorPage[T]{Items: items, Limit: limit}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	if len(items) == 0 {
+		return page, nil
+	}
+	position := func(item T, before bool) string {
+		rv := reflect.Indirect(reflect.ValueOf(item))
+		key, _ := keyField.ValueOf(ctx, rv)
+		id, _ := idField.ValueOf(ctx, rv)
+		return encodeCursor(cursor{Key: key, ID: id, Before: before})
+	}
+	if more || backward {
+		page.NextCursor = position(items[len(items)-1], false)
+	}
+	if after != nil && !backward || backward && more {
+		page.PrevCursor = position(items[0], true)
+	}
+	return page, nil
+}
+
+// cursorFields looks up the sort key and ID fields of the model schema.
+func cursorFields[T any](db *gorm.DB, order CursorOrder) (*schema.Field, *schema.Field, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, nil, err
+	}
+	s := stmt.Schema
+	keyField, idField := s.LookUpField(order.Column), s.LookUpField(order.IDColumn)
+	if keyField == nil || idField == nil {
+		return nil, nil, errors.New("model: cursor columns not found on " + s.Name)
+	}
+	return keyField, idField, nil
+}
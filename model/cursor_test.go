@@ -0,0 +1,127 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+)
+
+// stubRows makes queries on db build their SQL and return rows instead
+// of touching a database.
+func stubRows(t *testing.T, db *gorm.DB, rows []widget) *string {
+	t.Helper()
+	var sql string
+	err := db.Callback().Query().Replace("gorm:query", func(db *gorm.DB) {
+		callbacks.BuildQuerySQL(db)
+		sql = db.Statement.SQL.String()
+		reflect.ValueOf(db.Statement.Dest).Elem().Set(reflect.ValueOf(rows))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &sql
+}
+
+func TestFindCursorPage(t *testing.T) {
+	db := dryRunDB(t)
+	rows := []widget{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	for i := range rows {
+		rows[i].ID = string(rune('1' + i))
+	}
+	sql := stubRows(t, db, rows)
+	order := CursorOrder{Column: "name"}
+	ctx := context.Background()
+
+	// A full page plus one means there is a next page
+	page, err := FindCursorPage[widget](ctx, db, CursorRequest{Limit: 2}, order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 2 || page.NextCursor == "" || page.PrevCursor != "" {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+	if !strings.HasSuffix(*sql, "ORDER BY `name`,`id` LIMIT 3") {
+		t.Errorf("unexpected SQL: %s", *sql)
+	}
+
+	c, _ := decodeCursor(page.NextCursor)
+	if c.Key != "b" || c.ID != "2" || c.Before {
+		t.Errorf("unexpected next cursor: %+v", c)
+	}
+
+	// Following the next cursor seeks past the last row
+	page, err = FindCursorPage[widget](ctx, db, CursorRequest{Limit: 5, Cursor: page.NextCursor}, order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(*sql, "(`name`, `id`) > (?, ?)") || page.PrevCursor == "" || page.NextCursor != "" {
+		t.Errorf("unexpected seek: %s %+v", *sql, page)
+	}
+
+	// Following a prev cursor walks backwards and restores the order
+	page, err = FindCursorPage[widget](ctx, db, CursorRequest{Limit: 5, Cursor: page.PrevCursor}, order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(*sql, "(`name`, `id`) < (?, ?)") || !strings.Contains(*sql, "ORDER BY `name` DESC,`id` DESC") {
+		t.Errorf("unexpected backward seek: %s", *sql)
+	}
+	if page.Items[0].Name != "c" || page.NextCursor == "" {
+		t.Errorf("backward page should be reversed with a next cursor: %+v", page)
+	}
+}
+
+func TestFindCursorPageInvalidCursor(t *testing.T) {
+	db := dryRunDB(t)
+	_, err := FindCursorPage[widget](context.Background(), db, CursorRequest{Cursor: "!!"}, CursorOrder{Column: "name"})
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("unexpected error; expected %v, got %v", ErrInvalidCursor, err)
+	}
+}
+
+type ledgerEntry struct {
+	ID        int64
+	CreatedAt time.Time
+}
+
+func TestFindCursorPageTypedKeys(t *testing.T) {
+	ts := time.Date(2023, 11, 14, 22, 13, 20, 123456789, time.UTC)
+	big := int64(1<<62 + 1)
+	tests := []struct {
+		name   string
+		column string
+		key    interface{}
+	}{
+		{"large int64", "id", big},
+		{"time", "created_at", ts},
+	}
+	for _, tt := range tests {
+		db := dryRunDB(t)
+		var vars []interface{}
+		err := db.Callback().Query().Replace("gorm:query", func(db *gorm.DB) {
+			callbacks.BuildQuerySQL(db)
+			vars = db.Statement.Vars
+			reflect.ValueOf(db.Statement.Dest).Elem().Set(reflect.ValueOf([]ledgerEntry{{ID: big, CreatedAt: ts}, {}}))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		order := CursorOrder{Column: tt.column}
+		page, err := FindCursorPage[ledgerEntry](context.Background(), db, CursorRequest{Limit: 1}, order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := FindCursorPage[ledgerEntry](context.Background(), db, CursorRequest{Limit: 1, Cursor: page.NextCursor}, order); err != nil {
+			t.Fatal(err)
+		}
+		if len(vars) < 2 || !reflect.DeepEqual(vars[0], tt.key) || vars[1] != big {
+			t.Errorf("%s: expected the seek to use %#v and ID %d, got %#v", tt.name, tt.key, big, vars)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package model
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Encrypted-at-rest columns
+
+// EncryptionKeys supplies the AES keys used by EncryptedString. Keys are
+// 16, 24 or 32 bytes, selecting AES-128, AES-192 or AES-256.
+type EncryptionKeys interface {
+	// Current returns the ID and key used to encrypt new values.
+	Current() (id string, key []byte, err error)
+	// Key returns the key with the given ID, for decrypting values
+	// written before a rotation.
+	Key(id string) ([]byte, error)
+}
+
+// ErrNoEncryptionKeys is returned when EncryptedString is used before
+// SetEncryptionKeys.
+var ErrNoEncryptionKeys = errors.New("model: no encryption keys configured")
+
+// ErrUnknownKey is returned when a value was encrypted with a key ID the
+// EncryptionKeys doesn't have.
+var ErrUnknownKey = errors.New("model: unknown encryption key")
+
+var encryptionKeys struct {
+	sync.RWMutex
+	keys EncryptionKeys
+}
+
+// SetEncryptionKeys sets the keys used by EncryptedString for the whole
+// service. Call it once during startup, for example with keys loaded from
+// the secrets provider or data keys unwrapped by crypt.Envelope.Keys.
+func SetEncryptionKeys(keys EncryptionKeys) {
+	encryptionKeys.Lock()
+	defer encryptionKeys.Unlock()
+	encryptionKeys.keys = keys
+}
+
+func currentEncryptionKeys() (EncryptionKeys, error) {
+	encryptionKeys.RLock()
+	defer encryptionKeys.RUnlock()
+	if encryptionKeys.keys == nil {
+		return nil, ErrNoEncryptionKeys
+	}
+	return encryptionKeys.keys, nil
+}
+
+type staticKeys struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewStaticKeys returns EncryptionKeys holding keys by ID, encrypting with
+// the one named current. To rotate, add a new key, make it current and
+// keep the old ones until every value has been rewritten.
+func NewStaticKeys(current string, keys map[string][]byte) EncryptionKeys {
+	return &staticKeys{current: current, keys: keys}
+}
+
+func (k *staticKeys) Current() (string, []byte, error) {
+	key, err := k.Key(k.current)
+	return k.current, key, err
+}
+
+func (k *staticKeys) Key(id string) ([]byte, error) {
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// EncryptedString is a string column encrypted with AES-GCM on write and
+// decrypted on read. The stored form is "<key id>:<base64 nonce and
+// ciphertext>", so values written under older keys stay readable after
+// a rotation. Use it for PII; encrypted columns can't be searched.
+//
+// It marshals to JSON as AuditRedacted, so records returned by an API or
+// logged don't leak the plaintext. Convert it to a string to expose the
+// value deliberately. Unmarshalling accepts the plaintext as usual.
+type EncryptedString string
+
+// MarshalJSON implements json.Marshaler, redacting the value.
+func (s EncryptedString) MarshalJSON() ([]byte, error) {
+	return json.Marshal(AuditRedacted)
+}
+
+// Value implements driver.Valuer.
+func (s EncryptedString) Value() (driver.Value, error) {
+	keys, err := currentEncryptionKeys()
+	if err != nil {
+		return nil, err
+	}
+	id, key, err := keys.Current()
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(id, ":") {
+		return nil, fmt.Errorf("model: encryption key ID %q contains a colon", id)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	// The key ID is authenticated so a value can't be replayed under another key
+	sealed := gcm.Seal(nonce, nonce, []byte(s), []byte(id))
+	return id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Scan implements sql.Scanner. NULL scans as an empty string.
+func (s *EncryptedString) Scan(src interface{}) error {
+	var stored string
+	switch v := src.(type) {
+	case nil:
+		*s = ""
+		return nil
+	case []byte:
+		stored = string(v)
+	case string:
+		stored = v
+	default:
+		return fmt.Errorf("model: cannot scan %T into EncryptedString", src)
+	}
+
+	id, encoded, ok := strings.Cut(stored, ":")
+	if !ok {
+		return errors.New("model: encrypted value has no key ID")
+	}
+	keys, err := currentEncryptionKeys()
+	if err != nil {
+		return err
+	}
+	key, err := keys.Key(id)
+	if err != nil {
+		return err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return errors.New("model: encrypted value is too short")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(id))
+	if err != nil {
+		return err
+	}
+	*s = EncryptedString(plain)
+	return nil
+}
+
+// GormDataType implements schema.GormDataTypeInterface. Ciphertext is
+// longer than the plaintext, so a text column is used.
+func (EncryptedString) GormDataType() string {
+	return "text"
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
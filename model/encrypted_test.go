@@ -0,0 +1,61 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEncryptedString(t *testing.T) {
+	oldKey, newKey := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	SetEncryptionKeys(NewStaticKeys("k1", map[string][]byte{"k1": oldKey}))
+	defer SetEncryptionKeys(nil)
+
+	v, err := EncryptedString("4111 1111 1111 1111").Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := v.(string)
+	if !strings.HasPrefix(stored, "k1:") || strings.Contains(stored, "4111") {
+		t.Errorf("unexpected stored value: %s", stored)
+	}
+
+	// After rotation, values under the old key still decrypt
+	SetEncryptionKeys(NewStaticKeys("k2", map[string][]byte{"k1": oldKey, "k2": newKey}))
+	var s EncryptedString
+	if err := s.Scan([]byte(stored)); err != nil || s != "4111 1111 1111 1111" {
+		t.Errorf("unexpected decrypted value: %q, %v", s, err)
+	}
+
+	// Tampering with the key ID fails authentication
+	tampered := "k2" + strings.TrimPrefix(stored, "k1")
+	if err := s.Scan(tampered); err == nil {
+		t.Error("expected an error decrypting under the wrong key")
+	}
+
+	SetEncryptionKeys(NewStaticKeys("k2", map[string][]byte{"k2": newKey}))
+	if err := s.Scan(stored); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("unexpected error; expected %v, got %v", ErrUnknownKey, err)
+	}
+}
+
+func TestEncryptedStringJSON(t *testing.T) {
+	type customer struct {
+		Name string          `json:"name"`
+		Card EncryptedString `json:"card"`
+	}
+	b, err := json.Marshal(customer{Name: "Ada", Card: "4111 1111 1111 1111"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := `{"name":"Ada","card":"[encrypted]"}`, string(b); want != have {
+		t.Errorf("unexpected JSON; expected %s, got %s", want, have)
+	}
+
+	var c customer
+	if err := json.Unmarshal([]byte(`{"card":"4111 1111 1111 1111"}`), &c); err != nil || c.Card != "4111 1111 1111 1111" {
+		t.Errorf("unexpected unmarshalled value: %q, %v", c.Card, err)
+	}
+}
@@ -0,0 +1,147 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Enumerable is implemented by string-backed enum types, listing their
+// allowed values.
+//
+//	type Status string
+//
+//	const (
+//		StatusActive   Status = "active"
+//		StatusArchived Status = "archived"
+//	)
+//
+//	func (Status) Values() []Status {
+//		return []Status{StatusActive, StatusArchived}
+//	}
+type Enumerable[T any] interface {
+	~string
+	Values() []T
+}
+
+// Enum holds a value of an Enumerable type, rejecting values outside
+// the type's set when read from JSON, query parameters or the database
+// and when written to the database. The zero Enum is stored as NULL.
+//
+//	type Widget struct {
+//		model.Defaults
+//		Status model.Enum[Status]
+//	}
+type Enum[T Enumerable[T]] struct {
+	Val T
+}
+
+// NewEnum returns an Enum holding v, or an *EnumError if v is not one of
+// T's values.
+func NewEnum[T Enumerable[T]](v T) (Enum[T], error) {
+	e := Enum[T]{Val: v}
+	return e, e.Validate()
+}
+
+// EnumError reports a value outside an enum's set. It maps to a 400
+// status.
+type EnumError struct {
+	Value   string
+	Allowed []string
+}
+
+func (e *EnumError) Error() string {
+	return fmt.Sprintf("%q is not one of %s", e.Value, strings.Join(e.Allowed, ", "))
+}
+
+// StatusCode implements go-kit's StatusCoder.
+func (e *EnumError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// Validate returns an *EnumError if the value is not one of T's values.
+func (e Enum[T]) Validate() error {
+	var allowed []string
+	for _, v := range e.Val.Values() {
+		if v == e.Val {
+			return nil
+		}
+		allowed = append(allowed, string(v))
+	}
+	return &EnumError{Value: string(e.Val), Allowed: allowed}
+}
+
+// IsZero reports whether the Enum is unset.
+func (e Enum[T]) IsZero() bool {
+	return e.Val == ""
+}
+
+func (e Enum[T]) String() string {
+	return string(e.Val)
+}
+
+// Value implements driver.Valuer.
+func (e Enum[T]) Value() (driver.Value, error) {
+	if e.IsZero() {
+		return nil, nil
+	}
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return string(e.Val), nil
+}
+
+// Scan implements sql.Scanner.
+func (e *Enum[T]) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		e.Val = ""
+		return nil
+	case []byte:
+		return e.UnmarshalText(v)
+	case string:
+		return e.UnmarshalText([]byte(v))
+	}
+	return fmt.Errorf("model: cannot scan %T into Enum", src)
+}
+
+func (e Enum[T]) MarshalText() ([]byte, error) {
+	return []byte(e.Val), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, so query parameters
+// bound by the transport package are validated too.
+func (e *Enum[T]) UnmarshalText(b []byte) error {
+	v := Enum[T]{Val: T(b)}
+	if err := v.Validate(); err != nil {
+		return err
+	}
+	*e = v
+	return nil
+}
+
+func (e Enum[T]) MarshalJSON() ([]byte, error) {
+	if e.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(string(e.Val))
+}
+
+func (e *Enum[T]) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		e.Val = ""
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	return e.UnmarshalText([]byte(s))
+}
+
+// GormDataType implements schema.GormDataTypeInterface.
+func (Enum[T]) GormDataType() string {
+	return "string"
+}
@@ -0,0 +1,49 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+type status string
+
+func (status) Values() []status {
+	return []status{"active", "archived"}
+}
+
+func TestEnumJSON(t *testing.T) {
+	var v struct {
+		Status Enum[status] `json:"status"`
+	}
+	if err := json.Unmarshal([]byte(`{"status":"active"}`), &v); err != nil || v.Status.Val != "active" {
+		t.Errorf("unexpected result: %+v, %v", v, err)
+	}
+
+	var enumErr *EnumError
+	if err := json.Unmarshal([]byte(`{"status":"deleted"}`), &v); !errors.As(err, &enumErr) {
+		t.Errorf("expected an EnumError, got %v", err)
+	}
+
+	b, _ := json.Marshal(v)
+	if want, have := `{"status":"active"}`, string(b); want != have {
+		t.Errorf("unexpected JSON; expected %s, got %s", want, have)
+	}
+}
+
+func TestEnumValuer(t *testing.T) {
+	if v, err := (Enum[status]{}).Value(); v != nil || err != nil {
+		t.Errorf("zero Enum should be NULL; got %v, %v", v, err)
+	}
+	if _, err := (Enum[status]{Val: "bogus"}).Value(); err == nil {
+		t.Error("expected an error writing an invalid value")
+	}
+
+	var e Enum[status]
+	if err := e.Scan([]byte("archived")); err != nil || e.Val != "archived" {
+		t.Errorf("unexpected scan result: %v, %v", e, err)
+	}
+	if _, err := NewEnum[status]("bogus"); err == nil {
+		t.Error("NewEnum should reject invalid values")
+	}
+}
@@ -0,0 +1,50 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var widgetFilters = Filterable{
+	"name":       {OpEq, OpIn, OpContains},
+	"created_at": {OpGte},
+}
+
+func TestFilterableScope(t *testing.T) {
+	db := dryRunDB(t)
+	req := FilterRequest{
+		Filter: []string{"name:in:a|b", "created_at:gte:2024-01-01T00:00:00Z", "name:contains:50%"},
+		Sort:   "-created_at",
+	}
+	stmt := db.Scopes(widgetFilters.Scope(req)).Find(&[]widget{}).Statement
+	sql := stmt.SQL.String()
+	for _, want := range []string{
+		"`widgets`.`name` IN (?,?)",
+		"`widgets`.`created_at` >= ?",
+		"`widgets`.`name` LIKE ? ESCAPE '\\'",
+		"ORDER BY `created_at` DESC",
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("SQL missing %q: %s", want, sql)
+		}
+	}
+	if have := stmt.Vars[len(stmt.Vars)-1]; have != `%50\%%` {
+		t.Errorf("LIKE value not escaped: %v", have)
+	}
+}
+
+func TestFilterableRejects(t *testing.T) {
+	db := dryRunDB(t)
+	for _, expr := range []string{
+		"password:eq:x",      // field not allowed
+		"created_at:eq:2024", // operator not allowed
+		"name",               // malformed
+	} {
+		err := db.Scopes(widgetFilters.Scope(FilterRequest{Filter: []string{expr}})).Find(&[]widget{}).Error
+		var filterErr *FilterError
+		if !errors.As(err, &filterErr) {
+			t.Errorf("%s: expected a FilterError, got %v", expr, err)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// IDs generated in Go rather than by the database
+
+// GeneratedID is an alternative to ID for models whose IDs are assigned
+// by IDPlugin, so the database needs no uuid-ossp or pgcrypto extension.
+type GeneratedID struct {
+	ID string `json:"id" gorm:"primaryKey;type:uuid"`
+}
+
+// NewUUIDv7 returns a time-ordered RFC 9562 version 7 UUID. IDs created
+// later sort later, which keeps primary key index inserts local.
+func NewUUIDv7() string {
+	var b [16]byte
+	putTimestamp(b[:], time.Now())
+	rand.Read(b[6:])
+	b[6] = b[6]&0x0f | 0x70 // version 7
+	b[8] = b[8]&0x3f | 0x80 // RFC 9562 variant
+
+	var s [36]byte
+	hex.Encode(s[0:8], b[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], b[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], b[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], b[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], b[10:])
+	return string(s[:])
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID returns a ULID: a 26 character, lexicographically sortable ID
+// with a millisecond timestamp and 80 random bits. ULIDs need a text
+// column rather than a uuid one.
+func NewULID() string {
+	var b [16]byte
+	putTimestamp(b[:], time.Now())
+	rand.Read(b[6:])
+
+	// Encode the 128 bits as 26 base32 characters, most significant first
+	var s [26]byte
+	var acc uint32
+	bits := 2 // pad to 130 bits so the first character holds the top 3
+	i := 0
+	for _, c := range b {
+		acc = acc<<8 | uint32(c)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			s[i] = crockford[(acc>>uint(bits))&0x1f]
+			i++
+		}
+	}
+	return string(s[:])
+}
+
+// putTimestamp writes t as 48 bits of Unix milliseconds.
+func putTimestamp(b []byte, t time.Time) {
+	ms := uint64(t.UnixMilli())
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+}
+
+// IDPlugin is a gorm plugin that assigns IDs to new records whose ID
+// field is empty, using Generate.
+//
+//	db.Use(&model.IDPlugin{Generate: model.NewUUIDv7})
+type IDPlugin struct {
+	// Generate returns a new ID. It defaults to NewUUIDv7.
+	Generate func() string
+}
+
+func (p *IDPlugin) Name() string {
+	return "go-utils:id"
+}
+
+func (p *IDPlugin) Initialize(db *gorm.DB) error {
+	if p.Generate == nil {
+		p.Generate = NewUUIDv7
+	}
+	return db.Callback().Create().Before("gorm:create").Register("go-utils:id", p.beforeCreate)
+}
+
+func (p *IDPlugin) beforeCreate(db *gorm.DB) {
+	if db.Statement.Schema == nil {
+		return
+	}
+	field := db.Statement.Schema.LookUpField("ID")
+	if field == nil {
+		return
+	}
+	ctx := db.Statement.Context
+	eachStruct(db.Statement.ReflectValue, func(rv reflect.Value) {
+		if _, zero := field.ValueOf(ctx, rv); zero {
+			field.Set(ctx, rv, p.Generate())
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestNewUUIDv7(t *testing.T) {
+	re := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	a := NewUUIDv7()
+	time.Sleep(2 * time.Millisecond)
+	b := NewUUIDv7()
+	if !re.MatchString(a) {
+		t.Errorf("not a version 7 UUID: %s", a)
+	}
+	if a >= b {
+		t.Errorf("UUIDs should be time ordered: %s >= %s", a, b)
+	}
+}
+
+func TestNewULID(t *testing.T) {
+	re := regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+	a := NewULID()
+	time.Sleep(2 * time.Millisecond)
+	b := NewULID()
+	if !re.MatchString(a) {
+		t.Errorf("not a ULID: %s", a)
+	}
+	if a >= b {
+		t.Errorf("ULIDs should be time ordered: %s >= %s", a, b)
+	}
+
+	// The timestamp occupies the first 10 characters
+	var ms int64
+	for _, c := range a[:10] {
+		ms = ms<<5 | int64(indexCrockford(c))
+	}
+	if d := time.Since(time.UnixMilli(ms)); d < 0 || d > time.Second {
+		t.Errorf("unexpected ULID timestamp: %s", time.UnixMilli(ms))
+	}
+}
+
+func indexCrockford(c rune) int {
+	for i, r := range crockford {
+		if r == c {
+			return i
+		}
+	}
+	return -1
+}
+
+type generatedWidget struct {
+	GeneratedID
+	Name string
+}
+
+func TestIDPlugin(t *testing.T) {
+	db := dryRunDB(t)
+	if err := db.Use(&IDPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	widgets := []generatedWidget{{Name: "a"}, {GeneratedID: GeneratedID{ID: "fixed"}}}
+	db.WithContext(context.Background()).Create(&widgets)
+	if len(widgets[0].ID) != 36 {
+		t.Errorf("ID not generated: %q", widgets[0].ID)
+	}
+	if widgets[1].ID != "fixed" {
+		t.Errorf("explicit ID should be kept; got %q", widgets[1].ID)
+	}
+}
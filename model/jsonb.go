@@ -0,0 +1,76 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// JSONB stores a value of type T as a JSON column, jsonb on Postgres.
+// It marshals to and from JSON as the bare value, so it can be used in
+// API responses directly.
+//
+//	type Widget struct {
+//		model.Defaults
+//		Metadata model.JSONB[map[string]string]
+//	}
+type JSONB[T any] struct {
+	Val T
+}
+
+// NewJSONB returns a JSONB holding v.
+func NewJSONB[T any](v T) JSONB[T] {
+	return JSONB[T]{Val: v}
+}
+
+// Value implements driver.Valuer.
+func (j JSONB[T]) Value() (driver.Value, error) {
+	b, err := json.Marshal(j.Val)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner. NULL scans as the zero value of T.
+func (j *JSONB[T]) Scan(src interface{}) error {
+	var zero T
+	j.Val = zero
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, &j.Val)
+	case string:
+		return json.Unmarshal([]byte(v), &j.Val)
+	}
+	return fmt.Errorf("model: cannot scan %T into JSONB", src)
+}
+
+func (j JSONB[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(j.Val)
+}
+
+func (j *JSONB[T]) UnmarshalJSON(b []byte) error {
+	return json.Unmarshal(b, &j.Val)
+}
+
+// GormDataType implements schema.GormDataTypeInterface.
+func (JSONB[T]) GormDataType() string {
+	return "json"
+}
+
+// GormDBDataType implements migrator.GormDataTypeInterface, choosing
+// jsonb on Postgres.
+func (JSONB[T]) GormDBDataType(db *gorm.DB, _ *schema.Field) string {
+	switch db.Dialector.Name() {
+	case "postgres":
+		return "JSONB"
+	case "sqlserver":
+		return "NVARCHAR(MAX)"
+	}
+	return "JSON"
+}
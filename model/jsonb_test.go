@@ -0,0 +1,36 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+type metadata struct {
+	Color string `json:"color"`
+}
+
+func TestJSONB(t *testing.T) {
+	j := NewJSONB(metadata{Color: "red"})
+	v, err := j.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := `{"color":"red"}`, v; want != have {
+		t.Errorf("unexpected value; expected %s, got %v", want, have)
+	}
+
+	var scanned JSONB[metadata]
+	if err := scanned.Scan([]byte(`{"color":"blue"}`)); err != nil || scanned.Val.Color != "blue" {
+		t.Errorf("unexpected scan result: %+v, %v", scanned, err)
+	}
+	if err := scanned.Scan(nil); err != nil || scanned.Val.Color != "" {
+		t.Errorf("NULL should scan as the zero value: %+v, %v", scanned, err)
+	}
+
+	b, _ := json.Marshal(struct {
+		Metadata JSONB[metadata] `json:"metadata"`
+	}{j})
+	if want, have := `{"metadata":{"color":"red"}}`, string(b); want != have {
+		t.Errorf("unexpected JSON; expected %s, got %s", want, have)
+	}
+}
@@ -1,23 +1,33 @@
 package model
 
 import (
-	"database/sql"
 	"time"
+
+	"gorm.io/gorm"
 )
 
+// DeletedAt marks a record as soft deleted. It is gorm.DeletedAt, so
+// gorm excludes deleted records from queries and Delete sets it rather
+// than removing the row. Like the sql.NullTime it replaces, it has Time
+// and Valid fields, and keeps the DeletedAt JSON key. Unlike
+// sql.NullTime, which encoded as an object with Time and Valid, its
+// value encodes as a time, or null when the record isn't deleted; this
+// is a breaking change for clients reading DeletedAt.Valid.
+type DeletedAt = gorm.DeletedAt
+
 type ID struct {
 	ID string `json:"id" gorm:"primaryKey;unique;type:uuid;default:uuid_generate_v4();"`
 }
 
 type Timestamps struct {
-	CreatedAt time.Time    `json:"created_at"`
-	UpdatedAt time.Time    `json:"updated_at"`
-	DeletedAt sql.NullTime `gorm:"index"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	DeletedAt DeletedAt `gorm:"index"`
 }
 
 type Defaults struct {
-	ID        string       `json:"id" gorm:"primaryKey;unique;type:uuid;default:uuid_generate_v4();"`
-	CreatedAt time.Time    `json:"created_at"`
-	UpdatedAt time.Time    `json:"updated_at"`
-	DeletedAt sql.NullTime `gorm:"index"`
+	ID        string    `json:"id" gorm:"primaryKey;unique;type:uuid;default:uuid_generate_v4();"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	DeletedAt DeletedAt `gorm:"index"`
 }
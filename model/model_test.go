@@ -0,0 +1,42 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDefaultsJSON(t *testing.T) {
+	ts := time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+	tests := []struct {
+		name  string
+		value interface{}
+		json  string
+	}{
+		{"defaults", Defaults{ID: "1", CreatedAt: ts, UpdatedAt: ts},
+			`{"id":"1","created_at":"2023-11-14T22:13:20Z","updated_at":"2023-11-14T22:13:20Z","DeletedAt":null}`},
+		{"deleted defaults", Defaults{ID: "1", CreatedAt: ts, UpdatedAt: ts, DeletedAt: DeletedAt{Time: ts, Valid: true}},
+			`{"id":"1","created_at":"2023-11-14T22:13:20Z","updated_at":"2023-11-14T22:13:20Z","DeletedAt":"2023-11-14T22:13:20Z"}`},
+		{"embedded", widget{Defaults: Defaults{ID: "1", CreatedAt: ts, UpdatedAt: ts}, Name: "a"},
+			`{"id":"1","created_at":"2023-11-14T22:13:20Z","updated_at":"2023-11-14T22:13:20Z","DeletedAt":null,"Name":"a"}`},
+		{"timestamps", Timestamps{CreatedAt: ts, UpdatedAt: ts, DeletedAt: DeletedAt{Time: ts, Valid: true}},
+			`{"created_at":"2023-11-14T22:13:20Z","updated_at":"2023-11-14T22:13:20Z","DeletedAt":"2023-11-14T22:13:20Z"}`},
+	}
+	for _, tt := range tests {
+		b, err := json.Marshal(tt.value)
+		if err != nil {
+			t.Fatalf("%s: marshal returned error: %s", tt.name, err)
+		}
+		if string(b) != tt.json {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.json, b)
+		}
+	}
+
+	var d Defaults
+	if err := json.Unmarshal([]byte(`{"id":"1","DeletedAt":"2023-11-14T22:13:20Z"}`), &d); err != nil {
+		t.Fatalf("unmarshal returned error: %s", err)
+	}
+	if !d.DeletedAt.Valid || !d.DeletedAt.Time.Equal(ts) {
+		t.Errorf("expected DeletedAt to round trip, got %+v", d.DeletedAt)
+	}
+}
@@ -0,0 +1,126 @@
+package model
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/jdotw/go-utils/page"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Offset pagination for list queries
+
+// Page size limits applied by PageRequest.Normalize.
+const (
+	DefaultPageLimit = page.DefaultLimit
+	MaxPageLimit     = page.MaxLimit
+)
+
+// PageRequest selects a page of a list and its order. It is defined in
+// the page package so transport can decode it without importing model.
+type PageRequest = page.Request
+
+// SortField is one field of a sort expression.
+type SortField = page.SortField
+
+// ParseSort parses a sort expression such as "-created_at,name".
+func ParseSort(sort string) []SortField {
+	return page.ParseSort(sort)
+}
+
+// SortError reports a sort on a field that isn't sortable. It maps to a
+// 400 status.
+type SortError struct {
+	Field string
+}
+
+func (e *SortError) Error() string {
+	return "cannot sort by " + e.Field
+}
+
+// StatusCode implements go-kit's StatusCoder.
+func (e *SortError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// Paginate is a scope applying the request's page and sort to a query.
+// Only columns listed in sortable may be sorted on; sorting on any other
+// adds a *SortError to the query.
+//
+//	db.Scopes(model.Paginate(req, "created_at", "name")).Find(&widgets)
+func Paginate(req PageRequest, sortable ...string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		req = req.Normalize()
+		db = OrderBy(req.Sort, sortable...)(db)
+		return db.Offset(req.Offset()).Limit(req.Limit)
+	}
+}
+
+// OrderBy is a scope applying a sort expression such as
+// "-created_at,name". Only columns listed in sortable may be sorted on;
+// sorting on any other adds a *SortError to the query.
+func OrderBy(sort string, sortable ...string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		for _, f := range ParseSort(sort) {
+			if !contains(sortable, f.Field) {
+				db.AddError(&SortError{Field: f.Field})
+				return db
+			}
+			db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: f.Field}, Desc: f.Desc})
+		}
+		return db
+	}
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// PageInfo describes the position of a page within a list.
+type PageInfo = page.Info
+
+// PageResponse is a page of items with the total number of items in the
+// list. It implements transport.Paginated, so HTTPEncodePageResponse adds
+// Link headers for it.
+type PageResponse[T any] struct {
+	Items []T   `json:"items"`
+	Total int64 `json:"total"`
+	Page  int   `json:"page"`
+	Limit int   `json:"limit"`
+}
+
+// NewPageResponse returns the response for a page of items.
+func NewPageResponse[T any](items []T, total int64, req PageRequest) PageResponse[T] {
+	if items == nil {
+		items = []T{}
+	}
+	req = req.Normalize()
+	return PageResponse[T]{Items: items, Total: total, Page: req.Page, Limit: req.Limit}
+}
+
+func (p PageResponse[T]) PageInfo() PageInfo {
+	return PageInfo{Total: &p.Total, Page: p.Page, Limit: p.Limit, Count: len(p.Items)}
+}
+
+// FindPage counts the rows matched by db and loads the requested page of
+// them, sorted on the sortable columns requested.
+//
+//	page, err := model.FindPage[Widget](ctx, db.Where("owner = ?", owner), req, "created_at")
+func FindPage[T any](ctx context.Context, db *gorm.DB, req PageRequest, sortable ...string) (PageResponse[T], error) {
+	var items []T
+	var total int64
+	db = db.WithContext(ctx).Model(new(T))
+	if err := db.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return PageResponse[T]{}, err
+	}
+	if err := db.Scopes(Paginate(req, sortable...)).Find(&items).Error; err != nil {
+		return PageResponse[T]{}, err
+	}
+	return NewPageResponse(items, total, req), nil
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPaginate(t *testing.T) {
+	db := dryRunDB(t)
+	req := PageRequest{Page: 3, Limit: 10, Sort: "-created_at,name"}
+
+	stmt := db.Scopes(Paginate(req, "created_at", "name")).Find(&[]widget{}).Statement
+	if sql := stmt.SQL.String(); !strings.HasSuffix(sql, "ORDER BY `created_at` DESC,`name` LIMIT 10 OFFSET 20") {
+		t.Errorf("unexpected SQL: %s", sql)
+	}
+
+	var sortErr *SortError
+	err := db.Scopes(Paginate(PageRequest{Sort: "password"}, "name")).Find(&[]widget{}).Error
+	if !errors.As(err, &sortErr) || sortErr.Field != "password" {
+		t.Errorf("unexpected error; expected a SortError, got %v", err)
+	}
+}
+
+func TestPageRequestNormalize(t *testing.T) {
+	if p := (PageRequest{Limit: 1000}).Normalize(); p.Page != 1 || p.Limit != MaxPageLimit {
+		t.Errorf("unexpected normalized request: %+v", p)
+	}
+	if p := (PageRequest{}).Normalize(); p.Limit != DefaultPageLimit {
+		t.Errorf("unexpected default limit: %d", p.Limit)
+	}
+}
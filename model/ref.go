@@ -0,0 +1,168 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Sequential external references
+
+// Ref is a mixin adding a human friendly, monotonically increasing
+// reference alongside a model's UUID primary key, for invoice number
+// style identifiers. RefPlugin assigns it on create. Snowflake
+// references exceed the 53 bits a JavaScript number holds exactly, so
+// Ref is encoded as a JSON string.
+type Ref struct {
+	Ref int64 `json:"ref,string" gorm:"uniqueIndex;not null"`
+}
+
+// RefGenerator returns the next reference for a table.
+type RefGenerator func(ctx context.Context, db *gorm.DB, table string) (int64, error)
+
+// ErrNoRefGenerator is returned by RefPlugin when Generate is not set.
+var ErrNoRefGenerator = errors.New("ref plugin requires a generator")
+
+// ErrInvalidNode is returned by NewSnowflake for node IDs out of range.
+var ErrInvalidNode = errors.New("snowflake node must be between 0 and 1023")
+
+// snowflakeEpoch is the start of snowflake timestamps, 2020-01-01 UTC.
+const snowflakeEpoch = 1577836800000
+
+// Snowflake generates 63 bit IDs from a millisecond timestamp, a 10 bit
+// node ID and a 12 bit sequence. IDs from one node always increase;
+// across nodes they are ordered to within clock skew. Each running
+// instance needs its own node ID.
+type Snowflake struct {
+	node int64
+
+	mu   sync.Mutex
+	last int64
+	seq  int64
+	now  func() time.Time
+}
+
+// NewSnowflake returns a Snowflake for node, between 0 and 1023.
+func NewSnowflake(node int64) (*Snowflake, error) {
+	if node < 0 || node > 1023 {
+		return nil, ErrInvalidNode
+	}
+	return &Snowflake{node: node, now: time.Now}, nil
+}
+
+// Next returns the next ID, waiting for the next millisecond when 4096
+// IDs have been issued in the current one.
+func (s *Snowflake) Next() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ms := s.now().UnixMilli() - snowflakeEpoch
+	if ms < s.last {
+		// The clock went backwards; keep counting from the last time seen
+		ms = s.last
+	}
+	if ms == s.last {
+		s.seq = (s.seq + 1) & 0xfff
+		if s.seq == 0 {
+			for ms <= s.last {
+				time.Sleep(100 * time.Microsecond)
+				ms = s.now().UnixMilli() - snowflakeEpoch
+			}
+		}
+	} else {
+		s.seq = 0
+	}
+	s.last = ms
+	return ms<<22 | s.node<<12 | s.seq
+}
+
+// Generator returns a RefGenerator issuing snowflake IDs.
+func (s *Snowflake) Generator() RefGenerator {
+	return func(context.Context, *gorm.DB, string) (int64, error) {
+		return s.Next(), nil
+	}
+}
+
+// RefSequence returns the name of the PostgreSQL sequence used for a
+// table's references.
+func RefSequence(table string) string {
+	return table + "_ref_seq"
+}
+
+// SequenceGenerator is a RefGenerator taking references from a
+// PostgreSQL sequence per table, created by CreateRefSequences. Unlike
+// snowflakes, sequence references are small and dense, though a rolled
+// back insert leaves a gap.
+func SequenceGenerator(ctx context.Context, db *gorm.DB, table string) (int64, error) {
+	var ref int64
+	err := db.WithContext(ctx).Raw("SELECT nextval(?)", RefSequence(table)).Scan(&ref).Error
+	return ref, err
+}
+
+// CreateRefSequences creates the sequences SequenceGenerator uses for
+// models, if they don't exist. Call it alongside AutoMigrate.
+func CreateRefSequences(db *gorm.DB, models ...interface{}) error {
+	for _, m := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(m); err != nil {
+			return err
+		}
+		seq := RefSequence(stmt.Schema.Table)
+		if err := db.Exec(fmt.Sprintf("CREATE SEQUENCE IF NOT EXISTS %s", db.Statement.Quote(seq))).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RefPlugin is a gorm plugin that assigns references to new records
+// whose Ref field is zero, using Generate.
+//
+//	db.Use(&model.RefPlugin{Generate: model.SequenceGenerator})
+type RefPlugin struct {
+	// Generate returns a new reference and is required. For snowflakes,
+	// use the Generator of a Snowflake with this instance's node ID.
+	Generate RefGenerator
+}
+
+func (p *RefPlugin) Name() string {
+	return "go-utils:ref"
+}
+
+func (p *RefPlugin) Initialize(db *gorm.DB) error {
+	if p.Generate == nil {
+		return ErrNoRefGenerator
+	}
+	return db.Callback().Create().Before("gorm:create").Register("go-utils:ref", p.beforeCreate)
+}
+
+func (p *RefPlugin) beforeCreate(db *gorm.DB) {
+	if db.Statement.Schema == nil {
+		return
+	}
+	field := db.Statement.Schema.LookUpField("Ref")
+	if field == nil {
+		return
+	}
+	ctx := db.Statement.Context
+	conn := db.Session(&gorm.Session{NewDB: true})
+	eachStruct(db.Statement.ReflectValue, func(rv reflect.Value) {
+		if db.Error != nil {
+			return
+		}
+		if _, zero := field.ValueOf(ctx, rv); !zero {
+			return
+		}
+		ref, err := p.Generate(ctx, conn, db.Statement.Schema.Table)
+		if err != nil {
+			db.AddError(err)
+			return
+		}
+		db.AddError(field.Set(ctx, rv, ref))
+	})
+}
@@ -0,0 +1,97 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type invoice struct {
+	GeneratedID
+	Ref
+}
+
+func TestSnowflake(t *testing.T) {
+	if _, err := NewSnowflake(1024); err != ErrInvalidNode {
+		t.Errorf("expected %v, got %v", ErrInvalidNode, err)
+	}
+
+	s, err := NewSnowflake(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return clock }
+
+	a, b := s.Next(), s.Next()
+	if b != a+1 {
+		t.Errorf("IDs in the same millisecond should differ by sequence; got %d then %d", a, b)
+	}
+	if node := a >> 12 & 0x3ff; node != 3 {
+		t.Errorf("expected node 3, got %d", node)
+	}
+
+	// A clock moving backwards doesn't reissue IDs
+	clock = clock.Add(-time.Second)
+	if c := s.Next(); c <= b {
+		t.Errorf("IDs should keep increasing when the clock goes back; got %d after %d", c, b)
+	}
+
+	clock = clock.Add(time.Hour)
+	if d := s.Next(); d>>22 != clock.UnixMilli()-snowflakeEpoch {
+		t.Errorf("unexpected timestamp in %d", d)
+	}
+}
+
+func TestRefPlugin(t *testing.T) {
+	db := dryRunDB(t)
+	if err := db.Use(&RefPlugin{}); err != ErrNoRefGenerator {
+		t.Errorf("expected ErrNoRefGenerator, got %v", err)
+	}
+	var next int64 = 100
+	var tables []string
+	err := db.Use(&RefPlugin{Generate: func(_ context.Context, _ *gorm.DB, table string) (int64, error) {
+		tables = append(tables, table)
+		next++
+		return next, nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invoices := []invoice{{}, {Ref: Ref{Ref: 7}}, {}}
+	if err := db.Create(&invoices).Error; err != nil {
+		t.Fatal(err)
+	}
+	if invoices[0].Ref.Ref != 101 || invoices[1].Ref.Ref != 7 || invoices[2].Ref.Ref != 102 {
+		t.Errorf("unexpected refs: %+v", invoices)
+	}
+	if len(tables) != 2 || tables[0] != "invoices" {
+		t.Errorf("unexpected tables: %v", tables)
+	}
+
+	b, err := json.Marshal(invoices[0].Ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"ref":"101"}`; string(b) != expected {
+		t.Errorf("expected %s, got %s", expected, b)
+	}
+}
+
+func TestCreateRefSequences(t *testing.T) {
+	db := dryRunDB(t)
+	var sql string
+	db.Callback().Raw().Replace("gorm:raw", func(db *gorm.DB) {
+		sql = db.Statement.SQL.String()
+	})
+	if err := CreateRefSequences(db, &invoice{}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "CREATE SEQUENCE IF NOT EXISTS `invoices_ref_seq`"; sql != expected {
+		t.Errorf("expected %q, got %q", expected, sql)
+	}
+}
@@ -0,0 +1,152 @@
+// Package repository provides a generic CRUD Repository backed by gorm,
+// so services don't each re-implement the same data access layer.
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/model"
+	"github.com/jdotw/go-utils/recorderrors"
+	"github.com/jdotw/go-utils/tracing"
+	"github.com/opentracing/opentracing-go"
+	tag "github.com/opentracing/opentracing-go/ext"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Scope narrows a query, as accepted by gorm's Scopes.
+type Scope = func(*gorm.DB) *gorm.DB
+
+// Repository stores entities of type T, identified by string IDs.
+// Operations on missing (or soft deleted) entities return
+// recorderrors.ErrNotFound.
+type Repository[T any] interface {
+	Create(ctx context.Context, entity *T) error
+	Get(ctx context.Context, id string) (*T, error)
+	List(ctx context.Context, req model.PageRequest, scopes ...Scope) (model.PageResponse[T], error)
+	Update(ctx context.Context, entity *T) error
+	Delete(ctx context.Context, id string) error
+}
+
+// Option configures a gorm Repository.
+type Option func(*options)
+
+type options struct {
+	sortable []string
+}
+
+// Sortable lists the columns List may sort on.
+func Sortable(columns ...string) Option {
+	return func(o *options) {
+		o.sortable = append(o.sortable, columns...)
+	}
+}
+
+type gormRepository[T any] struct {
+	db       *gorm.DB
+	logger   log.Factory
+	tracer   opentracing.Tracer
+	sortable []string
+}
+
+// NewGormRepository returns a Repository storing T with gorm. Each
+// operation runs in a child span, and models embedding model.Timestamps
+// are soft deleted.
+//
+//	widgets := repository.NewGormRepository[Widget](db, logger, tracer, repository.Sortable("created_at", "name"))
+func NewGormRepository[T any](db *gorm.DB, logger log.Factory, tracer opentracing.Tracer, opts ...Option) Repository[T] {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &gormRepository[T]{db: db, logger: logger, tracer: tracer, sortable: o.sortable}
+}
+
+func (r *gormRepository[T]) Create(ctx context.Context, entity *T) error {
+	ctx, span := r.startSpan(ctx, "Create")
+	defer span.Finish()
+
+	if err := r.conn(ctx).Create(entity).Error; err != nil {
+		return r.fail(ctx, span, "Failed to create record", err)
+	}
+	return nil
+}
+
+func (r *gormRepository[T]) Get(ctx context.Context, id string) (*T, error) {
+	ctx, span := r.startSpan(ctx, "Get")
+	defer span.Finish()
+
+	var entity T
+	if err := r.conn(ctx).Where("id = ?", id).First(&entity).Error; err != nil {
+		return nil, r.fail(ctx, span, "Failed to get record", err)
+	}
+	return &entity, nil
+}
+
+func (r *gormRepository[T]) List(ctx context.Context, req model.PageRequest, scopes ...Scope) (model.PageResponse[T], error) {
+	ctx, span := r.startSpan(ctx, "List")
+	defer span.Finish()
+
+	page, err := model.FindPage[T](ctx, r.conn(ctx).Scopes(scopes...), req, r.sortable...)
+	if err != nil {
+		return page, r.fail(ctx, span, "Failed to list records", err)
+	}
+	return page, nil
+}
+
+func (r *gormRepository[T]) Update(ctx context.Context, entity *T) error {
+	ctx, span := r.startSpan(ctx, "Update")
+	defer span.Finish()
+
+	// Select("*") writes zero values too, so the stored record matches entity
+	result := r.conn(ctx).Model(entity).Select("*").Omit("created_at").Updates(entity)
+	if result.Error == nil && result.RowsAffected == 0 {
+		result.Error = recorderrors.ErrNotFound
+	}
+	if result.Error != nil {
+		return r.fail(ctx, span, "Failed to update record", result.Error)
+	}
+	return nil
+}
+
+func (r *gormRepository[T]) Delete(ctx context.Context, id string) error {
+	ctx, span := r.startSpan(ctx, "Delete")
+	defer span.Finish()
+
+	result := r.conn(ctx).Where("id = ?", id).Delete(new(T))
+	if result.Error == nil && result.RowsAffected == 0 {
+		result.Error = recorderrors.ErrNotFound
+	}
+	if result.Error != nil {
+		return r.fail(ctx, span, "Failed to delete record", result.Error)
+	}
+	return nil
+}
+
+// conn returns the database handle for ctx, joining any transaction
+// started with model.WithTx.
+func (r *gormRepository[T]) conn(ctx context.Context) *gorm.DB {
+	return model.DBFromContext(ctx, r.db)
+}
+
+func (r *gormRepository[T]) startSpan(ctx context.Context, op string) (context.Context, opentracing.Span) {
+	ctx, span := tracing.NewChildSpanAndContext(ctx, r.tracer, "Repository."+op)
+	var entity T
+	if stmt := (&gorm.Statement{DB: r.db}); stmt.Parse(&entity) == nil {
+		tag.DBType.Set(span, "sql")
+		span.SetTag("db.table", stmt.Schema.Table)
+	}
+	return ctx, span
+}
+
+// fail maps gorm's not found error, and logs and records other errors.
+func (r *gormRepository[T]) fail(ctx context.Context, span opentracing.Span, msg string, err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, recorderrors.ErrNotFound) {
+		return recorderrors.ErrNotFound
+	}
+	tag.Error.Set(span, true)
+	r.logger.For(ctx).Error(msg, zap.Error(err))
+	return err
+}
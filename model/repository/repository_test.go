@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/model"
+	"github.com/jdotw/go-utils/recorderrors"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+)
+
+type widget struct {
+	model.Defaults
+	Name string
+}
+
+func newTestRepository(t *testing.T) (Repository[widget], *mocktracer.MockTracer) {
+	t.Helper()
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer := mocktracer.New()
+	return NewGormRepository[widget](db, log.NewMockLogFactory(), tracer, Sortable("name")), tracer
+}
+
+func TestRepositoryNotFound(t *testing.T) {
+	repo, _ := newTestRepository(t)
+	ctx := context.Background()
+
+	// Dry runs match no rows
+	if err := repo.Delete(ctx, "1"); err != recorderrors.ErrNotFound {
+		t.Errorf("unexpected Delete error; expected %v, got %v", recorderrors.ErrNotFound, err)
+	}
+	if err := repo.Update(ctx, &widget{Defaults: model.Defaults{ID: "1"}}); err != recorderrors.ErrNotFound {
+		t.Errorf("unexpected Update error; expected %v, got %v", recorderrors.ErrNotFound, err)
+	}
+}
+
+func TestRepositorySpans(t *testing.T) {
+	repo, tracer := newTestRepository(t)
+	if err := repo.Create(context.Background(), &widget{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.List(context.Background(), model.PageRequest{Sort: "name"}); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 2 {
+		t.Fatalf("unexpected span count; expected 2, got %d", len(spans))
+	}
+	if want, have := "Repository.Create", spans[0].OperationName; want != have {
+		t.Errorf("unexpected operation; expected %s, got %s", want, have)
+	}
+	if want, have := "widgets", spans[0].Tag("db.table"); want != have {
+		t.Errorf("unexpected table tag; expected %s, got %v", want, have)
+	}
+}
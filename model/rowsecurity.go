@@ -0,0 +1,81 @@
+package model
+
+import (
+	"context"
+
+	stdjwt "github.com/golang-jwt/jwt/v4"
+	"github.com/jdotw/go-utils/authn/jwt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Row level security
+
+// RowFilter returns a predicate matching the rows the caller in ctx may
+// see. A nil predicate allows every row. Besides the filters below, the
+// opa package's Authorizor.NewRowFilter derives one from a policy.
+type RowFilter func(ctx context.Context) (clause.Expression, error)
+
+// DenyAll is a predicate matching no rows.
+var DenyAll clause.Expression = clause.Expr{SQL: "1 = 0"}
+
+// OwnerFilter matches rows whose column holds the caller's JWT subject.
+// Anonymous callers see no rows.
+func OwnerFilter(column string) RowFilter {
+	return func(ctx context.Context) (clause.Expression, error) {
+		sub := jwt.SubjectFromContext(ctx)
+		if sub == "" {
+			return DenyAll, nil
+		}
+		return clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: column}, Value: sub}, nil
+	}
+}
+
+// ClaimFilter matches rows whose column holds the value of a claim of
+// the caller's JWT, or any of its values if the claim is a list. Callers
+// without the claim see no rows.
+func ClaimFilter(column, claim string) RowFilter {
+	return func(ctx context.Context) (clause.Expression, error) {
+		claims, _ := jwt.ClaimsFromContext(ctx).(stdjwt.MapClaims)
+		col := clause.Column{Table: clause.CurrentTable, Name: column}
+		switch v := claims[claim].(type) {
+		case nil:
+			return DenyAll, nil
+		case []interface{}:
+			if len(v) == 0 {
+				return DenyAll, nil
+			}
+			return clause.IN{Column: col, Values: v}, nil
+		default:
+			return clause.Eq{Column: col, Value: v}, nil
+		}
+	}
+}
+
+// RowSecurity is a scope restricting a statement to rows matched by any
+// of filters, evaluated against the statement's context. Apply it more
+// than once to require several policies. Statements fail if a filter
+// does, rather than fetching unfiltered rows.
+//
+//	db.WithContext(ctx).Scopes(model.RowSecurity(model.OwnerFilter("owner_id"))).Find(&docs)
+func RowSecurity(filters ...RowFilter) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		ctx := db.Statement.Context
+		exprs := make([]clause.Expression, 0, len(filters))
+		for _, f := range filters {
+			expr, err := f(ctx)
+			if err != nil {
+				db.AddError(err)
+				return db
+			}
+			if expr == nil {
+				return db
+			}
+			exprs = append(exprs, expr)
+		}
+		if len(exprs) == 0 {
+			return db.Where(DenyAll)
+		}
+		return db.Where(clause.Or(exprs...))
+	}
+}
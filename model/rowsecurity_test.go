@@ -0,0 +1,52 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	stdjwt "github.com/golang-jwt/jwt/v4"
+	"github.com/jdotw/go-utils/authn/jwt"
+	"gorm.io/gorm/clause"
+)
+
+func TestRowSecurity(t *testing.T) {
+	db := dryRunDB(t)
+	claims := stdjwt.MapClaims{"sub": "alice", "groups": []interface{}{"a", "b"}}
+	ctx := context.WithValue(context.Background(), jwt.JWTClaimsContextKey, claims)
+	errFilter := errors.New("filter failed")
+	allowAll := func(context.Context) (clause.Expression, error) { return nil, nil }
+	failing := func(context.Context) (clause.Expression, error) { return nil, errFilter }
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		filters  []RowFilter
+		expected string
+	}{
+		{"owner", ctx, []RowFilter{OwnerFilter("owner_id")},
+			"SELECT * FROM `widgets` WHERE `widgets`.`owner_id` = \"alice\" AND `widgets`.`deleted_at` IS NULL"},
+		{"anonymous", context.Background(), []RowFilter{OwnerFilter("owner_id")},
+			"SELECT * FROM `widgets` WHERE 1 = 0 AND `widgets`.`deleted_at` IS NULL"},
+		{"any of", ctx, []RowFilter{OwnerFilter("owner_id"), ClaimFilter("group_id", "groups")},
+			"SELECT * FROM `widgets` WHERE (`widgets`.`owner_id` = \"alice\" OR `widgets`.`group_id` IN (\"a\",\"b\")) AND `widgets`.`deleted_at` IS NULL"},
+		{"missing claim", ctx, []RowFilter{ClaimFilter("tenant_id", "tenant_id")},
+			"SELECT * FROM `widgets` WHERE 1 = 0 AND `widgets`.`deleted_at` IS NULL"},
+		{"allow all", ctx, []RowFilter{OwnerFilter("owner_id"), allowAll},
+			"SELECT * FROM `widgets` WHERE `widgets`.`deleted_at` IS NULL"},
+		{"no filters", ctx, nil,
+			"SELECT * FROM `widgets` WHERE 1 = 0 AND `widgets`.`deleted_at` IS NULL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt := db.WithContext(tt.ctx).Scopes(RowSecurity(tt.filters...)).Find(&[]widget{}).Statement
+			if sql := db.Dialector.Explain(stmt.SQL.String(), stmt.Vars...); sql != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, sql)
+			}
+		})
+	}
+
+	if err := db.WithContext(ctx).Scopes(RowSecurity(failing)).Find(&[]widget{}).Error; err != errFilter {
+		t.Errorf("expected %v, got %v", errFilter, err)
+	}
+}
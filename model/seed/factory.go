@@ -0,0 +1,84 @@
+package seed
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jdotw/go-utils/model"
+	"gorm.io/gorm"
+)
+
+// Factory builds distinct model values for tests.
+//
+//	accounts := seed.NewFactory(func(n int) Account {
+//		return Account{Defaults: seed.Defaults(), Name: fmt.Sprintf("account-%d", n)}
+//	})
+//	a := accounts.Create(t, tx, func(a *Account) { a.Plan = "pro" })
+type Factory[T any] struct {
+	build func(n int) T
+
+	mu sync.Mutex
+	n  int
+}
+
+// NewFactory returns a Factory calling build with 1, 2, 3... for each
+// value it builds.
+func NewFactory[T any](build func(n int) T) *Factory[T] {
+	return &Factory[T]{build: build}
+}
+
+// Build returns a new value with overrides applied.
+func (f *Factory[T]) Build(overrides ...func(*T)) T {
+	f.mu.Lock()
+	f.n++
+	n := f.n
+	f.mu.Unlock()
+
+	v := f.build(n)
+	for _, o := range overrides {
+		o(&v)
+	}
+	return v
+}
+
+// BuildN returns count new values with overrides applied to each.
+func (f *Factory[T]) BuildN(count int, overrides ...func(*T)) []T {
+	vs := make([]T, count)
+	for i := range vs {
+		vs[i] = f.Build(overrides...)
+	}
+	return vs
+}
+
+// Create builds a value and inserts it, failing the test if the insert
+// fails.
+func (f *Factory[T]) Create(t testing.TB, db *gorm.DB, overrides ...func(*T)) T {
+	t.Helper()
+	v := f.Build(overrides...)
+	Load(t, db, &v)
+	return v
+}
+
+// Defaults returns a model.Defaults with a new ID and the current time,
+// so fixtures don't depend on database defaults.
+func Defaults() model.Defaults {
+	now := now()
+	return model.Defaults{ID: model.NewUUIDv7(), CreatedAt: now, UpdatedAt: now}
+}
+
+// ID returns a model.ID with a new ID.
+func ID() model.ID {
+	return model.ID{ID: model.NewUUIDv7()}
+}
+
+// GeneratedID returns a model.GeneratedID with a new ID.
+func GeneratedID() model.GeneratedID {
+	return model.GeneratedID{ID: model.NewUUIDv7()}
+}
+
+// now is truncated to the microsecond precision databases store, so
+// fixtures compare equal to the rows read back.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
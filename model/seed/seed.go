@@ -0,0 +1,52 @@
+// Package seed loads fixtures for database tests. Each test runs in a
+// transaction that is rolled back when it finishes, so tests share a
+// database without seeing each other's rows.
+//
+//	func TestAccounts(t *testing.T) {
+//		ctx, tx := seed.Run(t, db, &Account{Defaults: seed.Defaults(), Name: "a"})
+//		...
+//	}
+package seed
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jdotw/go-utils/model"
+	"gorm.io/gorm"
+)
+
+// Begin starts a transaction that is rolled back when the test ends.
+func Begin(t testing.TB, db *gorm.DB) *gorm.DB {
+	t.Helper()
+	tx := db.Begin()
+	if tx.Error != nil {
+		t.Fatalf("seed: begin transaction: %v", tx.Error)
+	}
+	t.Cleanup(func() {
+		tx.Rollback()
+	})
+	return tx
+}
+
+// Load inserts fixtures in order, failing the test if any insert fails.
+// Fixtures are pointers to models or slices of models, so the rows they
+// depend on can be listed first.
+func Load(t testing.TB, db *gorm.DB, fixtures ...interface{}) {
+	t.Helper()
+	for _, f := range fixtures {
+		if err := db.Create(f).Error; err != nil {
+			t.Fatalf("seed: load %T: %v", f, err)
+		}
+	}
+}
+
+// Run begins a rolled back transaction, loads fixtures into it and
+// returns it with a context carrying it as the ambient transaction, so
+// code using model.DBFromContext sees the fixtures.
+func Run(t testing.TB, db *gorm.DB, fixtures ...interface{}) (context.Context, *gorm.DB) {
+	t.Helper()
+	tx := Begin(t, db)
+	Load(t, tx, fixtures...)
+	return context.WithValue(context.Background(), model.TxContextKey, tx), tx
+}
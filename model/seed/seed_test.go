@@ -0,0 +1,152 @@
+package seed
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jdotw/go-utils/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+)
+
+// recordingDriver is a database/sql driver that records statements
+// without a database.
+type recordingDriver struct {
+	mu  sync.Mutex
+	log []string
+}
+
+func (d *recordingDriver) record(s string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.log = append(d.log, s)
+}
+
+func (d *recordingDriver) Open(string) (driver.Conn, error) {
+	return &recordingConn{d}, nil
+}
+
+type recordingConn struct {
+	d *recordingDriver
+}
+
+func (c *recordingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("unsupported")
+}
+
+func (c *recordingConn) Close() error {
+	return nil
+}
+
+func (c *recordingConn) Begin() (driver.Tx, error) {
+	c.d.record("BEGIN")
+	return c, nil
+}
+
+func (c *recordingConn) Commit() error {
+	c.d.record("COMMIT")
+	return nil
+}
+
+func (c *recordingConn) Rollback() error {
+	c.d.record("ROLLBACK")
+	return nil
+}
+
+func (c *recordingConn) Exec(query string, _ []driver.Value) (driver.Result, error) {
+	c.d.record(query)
+	return driver.RowsAffected(1), nil
+}
+
+func (c *recordingConn) Query(query string, _ []driver.Value) (driver.Rows, error) {
+	c.d.record(query)
+	return noRows{}, nil
+}
+
+// noRows answers RETURNING clauses with no rows.
+type noRows struct{}
+
+func (noRows) Columns() []string {
+	return nil
+}
+
+func (noRows) Close() error {
+	return nil
+}
+
+func (noRows) Next([]driver.Value) error {
+	return io.EOF
+}
+
+var testDriver = &recordingDriver{}
+
+func init() {
+	sql.Register("seed-test-recording", testDriver)
+}
+
+type widget struct {
+	model.Defaults
+	Name string
+}
+
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	testDriver.log = nil
+	sqlDB, err := sql.Open("seed-test-recording", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{ConnPool: sqlDB, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestRun(t *testing.T) {
+	db := testDB(t)
+
+	t.Run("fixtures", func(t *testing.T) {
+		ctx, tx := Run(t, db, &widget{Defaults: Defaults(), Name: "a"}, &[]widget{{Defaults: Defaults(), Name: "b"}})
+		if model.DBFromContext(ctx, db).Statement.ConnPool != tx.Statement.ConnPool {
+			t.Error("the context should carry the fixture transaction")
+		}
+	})
+
+	log := testDriver.log
+	if len(log) != 4 || log[0] != "BEGIN" || log[3] != "ROLLBACK" {
+		t.Fatalf("fixtures should be loaded in a rolled back transaction: %q", log)
+	}
+	if !strings.Contains(log[1], "INSERT INTO `widgets`") || !strings.Contains(log[2], "INSERT INTO `widgets`") {
+		t.Errorf("expected fixtures to be inserted in order: %q", log)
+	}
+}
+
+func TestFactory(t *testing.T) {
+	f := NewFactory(func(n int) widget {
+		return widget{Defaults: Defaults(), Name: strings.Repeat("w", n)}
+	})
+
+	a := f.Build()
+	b := f.Build(func(w *widget) { w.Name = "override" })
+	if a.Name != "w" || b.Name != "override" {
+		t.Errorf("unexpected names: %q, %q", a.Name, b.Name)
+	}
+	if a.ID == "" || a.ID == b.ID || a.CreatedAt.IsZero() {
+		t.Errorf("built values should have distinct IDs and timestamps: %+v, %+v", a, b)
+	}
+	if ws := f.BuildN(2); len(ws) != 2 || ws[0].Name != "www" || ws[1].Name != "wwww" {
+		t.Errorf("unexpected values: %+v", ws)
+	}
+
+	db := testDB(t)
+	tx := Begin(t, db)
+	if w := f.Create(t, tx); w.Name != "wwwww" {
+		t.Errorf("unexpected created value: %+v", w)
+	}
+}
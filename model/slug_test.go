@@ -0,0 +1,103 @@
+package model
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jdotw/go-utils/tenant"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+)
+
+type article struct {
+	Defaults
+	Slugged
+	Title string
+}
+
+func (a article) SlugSource() string {
+	return a.Title
+}
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"Hello, World!":                "hello-world",
+		"  Crème Brûlée  ":             "creme-brulee",
+		"100% Go -- v2":                "100-go-v2",
+		"日本語":                          "",
+		strings.Repeat("a", 70):        strings.Repeat("a", MaxSlugLength),
+		strings.Repeat("a", 63) + " b": strings.Repeat("a", 63),
+	}
+	for s, expected := range tests {
+		if slug := Slugify(s); slug != expected {
+			t.Errorf("Slugify(%q): expected %q, got %q", s, expected, slug)
+		}
+	}
+}
+
+func TestSlugPlugin(t *testing.T) {
+	db := dryRunDB(t)
+	if err := db.Use(&SlugPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	var sql string
+	err := db.Callback().Query().Replace("gorm:query", func(db *gorm.DB) {
+		callbacks.BuildQuerySQL(db)
+		sql = db.Dialector.Explain(db.Statement.SQL.String(), db.Statement.Vars...)
+		*db.Statement.Dest.(*[]string) = []string{"my-post", "my-post-2"}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	articles := []article{{Title: "My Post"}, {Title: "My Post"}, {Title: "Other", Slugged: Slugged{Slug: "custom"}}}
+	if err := db.Create(&articles).Error; err != nil {
+		t.Fatal(err)
+	}
+	if articles[0].Slug != "my-post-3" || articles[1].Slug != "my-post-4" || articles[2].Slug != "custom" {
+		t.Errorf("unexpected slugs: %q, %q, %q", articles[0].Slug, articles[1].Slug, articles[2].Slug)
+	}
+	if expected := "SELECT `slug` FROM `articles` WHERE (`slug` = \"my-post\" OR `slug` LIKE \"my-post-%\")"; sql != expected {
+		t.Errorf("expected %s, got %s", expected, sql)
+	}
+}
+
+type tenantedArticle struct {
+	Defaults
+	Tenanted
+	Slugged
+	Title string
+}
+
+func (a tenantedArticle) SlugSource() string {
+	return a.Title
+}
+
+func TestSlugPluginAcrossTenants(t *testing.T) {
+	db := tenantDB(t)
+	if err := db.Use(&SlugPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	var sql string
+	err := db.Callback().Query().Replace("gorm:query", func(db *gorm.DB) {
+		callbacks.BuildQuerySQL(db)
+		sql = db.Statement.SQL.String()
+		// Another tenant already has the slug
+		*db.Statement.Dest.(*[]string) = []string{"my-post"}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := tenantedArticle{Title: "My Post"}
+	if err := db.WithContext(tenant.WithID(context.Background(), "acme")).Create(&a).Error; err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sql, "tenant_id") {
+		t.Errorf("the slug lookup should span tenants, as the unique index does: %s", sql)
+	}
+	if a.Slug != "my-post-2" {
+		t.Errorf("expected the slug to be suffixed, got %q", a.Slug)
+	}
+}
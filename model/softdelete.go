@@ -0,0 +1,52 @@
+package model
+
+import (
+	"context"
+
+	"github.com/jdotw/go-utils/recorderrors"
+	"gorm.io/gorm"
+)
+
+// Soft delete scopes and helpers
+
+// WithDeleted is a scope including soft deleted records in a query.
+//
+//	db.Scopes(model.WithDeleted).Find(&widgets)
+func WithDeleted(db *gorm.DB) *gorm.DB {
+	return db.Unscoped()
+}
+
+// OnlyDeleted is a scope restricting a query to soft deleted records.
+func OnlyDeleted(db *gorm.DB) *gorm.DB {
+	return db.Unscoped().Where("deleted_at IS NOT NULL")
+}
+
+// RestoreByID clears DeletedAt on the soft deleted record of model's type
+// with the given ID, returning recorderrors.ErrNotFound if there is none.
+//
+//	err := model.RestoreByID(ctx, db, &Widget{}, id)
+func RestoreByID(ctx context.Context, db *gorm.DB, model interface{}, id string) error {
+	result := db.WithContext(ctx).Unscoped().Model(model).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return recorderrors.ErrNotFound
+	}
+	return nil
+}
+
+// PurgeByID permanently deletes the record of model's type with the
+// given ID, whether or not it has been soft deleted.
+func PurgeByID(ctx context.Context, db *gorm.DB, model interface{}, id string) error {
+	result := db.WithContext(ctx).Unscoped().Where("id = ?", id).Delete(model)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return recorderrors.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package model
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jdotw/go-utils/recorderrors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+)
+
+type widget struct {
+	Defaults
+	Name string
+}
+
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestSoftDeleteScopes(t *testing.T) {
+	db := dryRunDB(t)
+
+	stmt := db.Find(&[]widget{}).Statement
+	if sql := stmt.SQL.String(); !strings.Contains(sql, "`deleted_at` IS NULL") {
+		t.Errorf("default queries should exclude deleted records: %s", sql)
+	}
+
+	stmt = db.Scopes(WithDeleted).Find(&[]widget{}).Statement
+	if sql := stmt.SQL.String(); strings.Contains(sql, "deleted_at") {
+		t.Errorf("WithDeleted should include deleted records: %s", sql)
+	}
+
+	stmt = db.Scopes(OnlyDeleted).Find(&[]widget{}).Statement
+	if sql := stmt.SQL.String(); !strings.Contains(sql, "deleted_at IS NOT NULL") || strings.Contains(sql, "IS NULL AND") {
+		t.Errorf("OnlyDeleted should select deleted records: %s", sql)
+	}
+
+	stmt = db.Delete(&widget{}, "id = ?", "1").Statement
+	if sql := stmt.SQL.String(); !strings.HasPrefix(sql, "UPDATE") {
+		t.Errorf("Delete should soft delete: %s", sql)
+	}
+}
+
+func TestRestoreByID(t *testing.T) {
+	db := dryRunDB(t)
+	var sql string
+	db.Callback().Update().After("gorm:update").Register("test:capture", func(db *gorm.DB) {
+		sql = db.Statement.SQL.String()
+	})
+
+	// Dry runs affect no rows
+	if err := RestoreByID(context.Background(), db, &widget{}, "1"); err != recorderrors.ErrNotFound {
+		t.Errorf("unexpected error; expected %v, got %v", recorderrors.ErrNotFound, err)
+	}
+	if !strings.Contains(sql, "SET `deleted_at`=?") || !strings.Contains(sql, "deleted_at IS NOT NULL") {
+		t.Errorf("unexpected restore statement: %s", sql)
+	}
+}
@@ -0,0 +1,163 @@
+package model
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/jdotw/go-utils/identity"
+	"github.com/jdotw/go-utils/tenant"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Tenanted scopes a record to a tenant. Register TenantPlugin to have
+// queries filtered and inserts stamped with the tenant in context.
+type Tenanted struct {
+	TenantID string `json:"tenant_id" gorm:"index;not null"`
+}
+
+// ErrCrossTenant is returned when creating or saving a record for a
+// tenant other than the one in context, or updating its tenant_id.
+var ErrCrossTenant = errors.New("record belongs to another tenant")
+
+const skipTenantKey = "go-utils:skip_tenant"
+
+// AllTenants is a scope disabling tenant filtering for a statement, for
+// administrative and background jobs that work across tenants.
+func AllTenants(db *gorm.DB) *gorm.DB {
+	return db.Set(skipTenantKey, true)
+}
+
+// TenantPlugin is a gorm plugin that scopes every statement on models
+// with a TenantID field to the tenant in the statement's context: queries,
+// updates and deletes get WHERE tenant_id = ?, and inserts have TenantID
+// set. Upserts, such as from Save, only update rows of the tenant, with
+// the tenant added to their ON CONFLICT DO UPDATE WHERE, so a conflicting
+// row of another tenant is left as it is. Statements without a tenant
+// fail with tenant.ErrMissingTenant rather than touching every tenant's
+// data. Raw SQL is not scoped, nor are upserts on MySQL, whose ON
+// DUPLICATE KEY UPDATE has no WHERE.
+//
+//	db.Use(&model.TenantPlugin{})
+type TenantPlugin struct{}
+
+func (p *TenantPlugin) Name() string {
+	return "go-utils:tenant"
+}
+
+func (p *TenantPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().Before("gorm:create").Register("go-utils:tenant_create", p.beforeCreate); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("gorm:query").Register("go-utils:tenant_query", p.scope); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("go-utils:tenant_update", p.beforeUpdate); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("go-utils:tenant_delete", p.scope); err != nil {
+		return err
+	}
+	return cb.Row().Before("gorm:row").Register("go-utils:tenant_row", p.scope)
+}
+
+// tenantFor returns the tenant to scope the statement to, or ok false
+// when the statement is not tenant scoped.
+func tenantFor(db *gorm.DB) (id string, ok bool) {
+	if db.Statement.Schema == nil || db.Statement.Schema.LookUpField("TenantID") == nil {
+		return "", false
+	}
+	if skip, _ := db.Get(skipTenantKey); skip == true {
+		return "", false
+	}
+	id = identity.TenantID(db.Statement.Context)
+	if id == "" {
+		db.AddError(tenant.ErrMissingTenant)
+		return "", false
+	}
+	return id, true
+}
+
+func (p *TenantPlugin) scope(db *gorm.DB) {
+	id, ok := tenantFor(db)
+	if !ok {
+		return
+	}
+	field := db.Statement.Schema.LookUpField("TenantID")
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: id},
+	}})
+}
+
+func (p *TenantPlugin) beforeCreate(db *gorm.DB) {
+	id, ok := tenantFor(db)
+	if !ok {
+		return
+	}
+	ctx := db.Statement.Context
+	field := db.Statement.Schema.LookUpField("TenantID")
+	setIfZero(ctx, field, db.Statement.ReflectValue, id)
+	if crossTenant(db, field, id) {
+		db.AddError(ErrCrossTenant)
+		return
+	}
+	// Upserts update the conflicting row, which may be another tenant's
+	if c, ok := db.Statement.Clauses["ON CONFLICT"]; ok {
+		if onConflict, ok := c.Expression.(clause.OnConflict); ok && !onConflict.DoNothing {
+			onConflict.Where.Exprs = append(onConflict.Where.Exprs,
+				clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: id})
+			db.Statement.AddClause(onConflict)
+		}
+	}
+}
+
+// beforeUpdate scopes updates to the tenant, and rejects saving a record
+// with another tenant's TenantID, or updating tenant_id to another
+// tenant's, either of which would move it to that tenant.
+func (p *TenantPlugin) beforeUpdate(db *gorm.DB) {
+	id, ok := tenantFor(db)
+	if !ok {
+		return
+	}
+	field := db.Statement.Schema.LookUpField("TenantID")
+	if crossTenant(db, field, id) || crossTenantUpdate(db.Statement.Dest, field, id) {
+		db.AddError(ErrCrossTenant)
+		return
+	}
+	p.scope(db)
+}
+
+// crossTenantUpdate reports whether the values of Update or Updates set
+// the tenant to one other than id, by column or field name in a map, or
+// by a struct's TenantID.
+func crossTenantUpdate(dest interface{}, field *schema.Field, id string) bool {
+	if m, ok := dest.(map[string]interface{}); ok {
+		for _, name := range []string{field.DBName, field.Name} {
+			if v, ok := m[name]; ok && v != id {
+				return true
+			}
+		}
+		return false
+	}
+	rv := reflect.Indirect(reflect.ValueOf(dest))
+	if rv.Kind() != reflect.Struct {
+		return false
+	}
+	fv := rv.FieldByName(field.Name)
+	return fv.IsValid() && fv.Kind() == reflect.String && fv.String() != "" && fv.String() != id
+}
+
+// crossTenant reports whether a record of the statement has a TenantID
+// other than id. Records without one are not checked.
+func crossTenant(db *gorm.DB, field *schema.Field, id string) bool {
+	ctx := db.Statement.Context
+	cross := false
+	eachStruct(db.Statement.ReflectValue, func(rv reflect.Value) {
+		if v, zero := field.ValueOf(ctx, rv); !zero && v != id {
+			cross = true
+		}
+	})
+	return cross
+}
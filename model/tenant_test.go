@@ -0,0 +1,132 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jdotw/go-utils/tenant"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type tenantedWidget struct {
+	Defaults
+	Tenanted
+	Name string
+}
+
+func tenantDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := dryRunDB(t)
+	if err := db.Use(&TenantPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestTenantPluginScopesQueries(t *testing.T) {
+	db := tenantDB(t)
+	ctx := tenant.WithID(context.Background(), "acme")
+
+	stmt := db.WithContext(ctx).Find(&[]tenantedWidget{}).Statement
+	if sql := stmt.SQL.String(); !strings.Contains(sql, "`tenanted_widgets`.`tenant_id` = ?") || stmt.Vars[0] != "acme" {
+		t.Errorf("query not scoped to tenant: %s %v", sql, stmt.Vars)
+	}
+
+	stmt = db.WithContext(ctx).Where("id = ?", "1").Delete(&tenantedWidget{}).Statement
+	if sql := stmt.SQL.String(); !strings.Contains(sql, "tenant_id") {
+		t.Errorf("delete not scoped to tenant: %s", sql)
+	}
+
+	stmt = db.WithContext(ctx).Scopes(AllTenants).Find(&[]tenantedWidget{}).Statement
+	if sql := stmt.SQL.String(); strings.Contains(sql, "tenant_id") {
+		t.Errorf("AllTenants should not scope: %s", sql)
+	}
+
+	if err := db.Find(&[]tenantedWidget{}).Error; !errors.Is(err, tenant.ErrMissingTenant) {
+		t.Errorf("unexpected error without a tenant; expected %v, got %v", tenant.ErrMissingTenant, err)
+	}
+}
+
+func TestTenantPluginStampsCreates(t *testing.T) {
+	db := tenantDB(t)
+	ctx := tenant.WithID(context.Background(), "acme")
+
+	w := tenantedWidget{Name: "a"}
+	if err := db.WithContext(ctx).Create(&w).Error; err != nil {
+		t.Fatal(err)
+	}
+	if w.TenantID != "acme" {
+		t.Errorf("unexpected tenant; expected acme, got %q", w.TenantID)
+	}
+
+	other := tenantedWidget{Name: "b", Tenanted: Tenanted{TenantID: "globex"}}
+	if err := db.WithContext(ctx).Create(&other).Error; !errors.Is(err, ErrCrossTenant) {
+		t.Errorf("unexpected error; expected %v, got %v", ErrCrossTenant, err)
+	}
+}
+
+func TestTenantPluginScopesUpserts(t *testing.T) {
+	db := tenantDB(t)
+	ctx := tenant.WithID(context.Background(), "acme")
+
+	// Saving slices and upserting insert with ON CONFLICT DO UPDATE, which
+	// must not update a conflicting row of another tenant
+	widgets := []tenantedWidget{{Defaults: Defaults{ID: "globex-widget"}, Name: "a"}}
+	stmt := db.WithContext(ctx).Save(&widgets).Statement
+	if sql := stmt.SQL.String(); !strings.Contains(sql, "DO UPDATE SET") || !strings.Contains(sql, "WHERE `tenanted_widgets`.`tenant_id` = ?") {
+		t.Errorf("upsert not scoped to tenant: %s", sql)
+	}
+	if stmt.Vars[len(stmt.Vars)-1] != "acme" {
+		t.Errorf("upsert scoped to the wrong tenant: %v", stmt.Vars)
+	}
+
+	stmt = db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&tenantedWidget{Name: "b"}).Statement
+	if sql := stmt.SQL.String(); !strings.Contains(sql, "WHERE `tenanted_widgets`.`tenant_id` = ?") {
+		t.Errorf("upsert not scoped to tenant: %s", sql)
+	}
+
+	stmt = db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&tenantedWidget{Name: "c"}).Statement
+	if sql := stmt.SQL.String(); strings.Contains(sql, "WHERE") {
+		t.Errorf("inserts doing nothing on conflict need no scope: %s", sql)
+	}
+
+	// Saving a record updates it, scoped to the tenant, and may not move it
+	// to another tenant
+	w := tenantedWidget{Defaults: Defaults{ID: "globex-widget"}, Name: "d"}
+	stmt = db.WithContext(ctx).Save(&w).Statement
+	if sql := stmt.SQL.String(); !strings.Contains(sql, "`tenanted_widgets`.`tenant_id` = ?") {
+		t.Errorf("save not scoped to tenant: %s", sql)
+	}
+	w.TenantID = "globex"
+	if err := db.WithContext(ctx).Save(&w).Error; !errors.Is(err, ErrCrossTenant) {
+		t.Errorf("unexpected error saving another tenant's record; expected %v, got %v", ErrCrossTenant, err)
+	}
+}
+
+func TestTenantPluginRejectsTenantUpdates(t *testing.T) {
+	db := tenantDB(t)
+	ctx := tenant.WithID(context.Background(), "acme")
+	w := &tenantedWidget{Defaults: Defaults{ID: "1"}}
+
+	updates := map[string]func(tx *gorm.DB) *gorm.DB{
+		"update column":  func(tx *gorm.DB) *gorm.DB { return tx.Update("tenant_id", "globex") },
+		"updates map":    func(tx *gorm.DB) *gorm.DB { return tx.Updates(map[string]interface{}{"TenantID": "globex"}) },
+		"updates struct": func(tx *gorm.DB) *gorm.DB { return tx.Updates(tenantedWidget{Tenanted: Tenanted{TenantID: "globex"}}) },
+		"update columns": func(tx *gorm.DB) *gorm.DB { return tx.UpdateColumns(map[string]interface{}{"tenant_id": nil}) },
+	}
+	for name, update := range updates {
+		if err := update(db.WithContext(ctx).Model(w)).Error; !errors.Is(err, ErrCrossTenant) {
+			t.Errorf("%s: expected %v, got %v", name, ErrCrossTenant, err)
+		}
+	}
+
+	if err := db.WithContext(ctx).Model(w).Updates(map[string]interface{}{"tenant_id": "acme", "name": "a"}).Error; err != nil {
+		t.Errorf("updating within the tenant returned error: %v", err)
+	}
+	if err := db.WithContext(ctx).Model(w).Updates(tenantedWidget{Name: "b"}).Error; err != nil {
+		t.Errorf("updating without a tenant returned error: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package model
+
+import (
+	"context"
+
+	"github.com/opentracing/opentracing-go"
+	tag "github.com/opentracing/opentracing-go/ext"
+	"gorm.io/gorm"
+)
+
+type contextKey string
+
+const (
+	// TxContextKey holds the key used to store the ambient transaction in the context.
+	TxContextKey contextKey = "Tx"
+)
+
+// WithTx runs fn in a transaction, committing if it returns nil and
+// rolling back if it returns an error or panics. The transaction is
+// stored in the ctx passed to fn, so repositories and DBFromContext join
+// it; calling WithTx again inside fn nests using a savepoint. When ctx
+// carries a span, the transaction gets a child span tagged with its
+// outcome.
+//
+//	err := model.WithTx(ctx, db, func(ctx context.Context, tx *gorm.DB) error {
+//		if err := orders.Create(ctx, order); err != nil {
+//			return err
+//		}
+//		return tx.Model(&stock).Update("count", gorm.Expr("count - 1")).Error
+//	})
+func WithTx(ctx context.Context, db *gorm.DB, fn func(ctx context.Context, tx *gorm.DB) error) (err error) {
+	returned := false
+	if parent := opentracing.SpanFromContext(ctx); parent != nil {
+		span := parent.Tracer().StartSpan("Transaction", opentracing.ChildOf(parent.Context()))
+		ctx = opentracing.ContextWithSpan(ctx, span)
+		defer func() {
+			// A panic leaves returned false; gorm has rolled back by now
+			if returned && err == nil {
+				span.SetTag("db.tx.outcome", "committed")
+			} else {
+				span.SetTag("db.tx.outcome", "rolled_back")
+				tag.Error.Set(span, true)
+			}
+			span.Finish()
+		}()
+	}
+
+	err = DBFromContext(ctx, db).Transaction(func(tx *gorm.DB) error {
+		return fn(context.WithValue(ctx, TxContextKey, tx), tx)
+	})
+	returned = true
+	return err
+}
+
+// DBFromContext returns the transaction stored in ctx by WithTx, or db
+// when there is none, bound to ctx.
+func DBFromContext(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if tx, ok := ctx.Value(TxContextKey).(*gorm.DB); ok {
+		return tx.WithContext(ctx)
+	}
+	return db.WithContext(ctx)
+}
@@ -0,0 +1,154 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+)
+
+// recordingDriver is a database/sql driver that records transaction
+// statements without a database.
+type recordingDriver struct {
+	mu  sync.Mutex
+	log []string
+}
+
+func (d *recordingDriver) record(s string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.log = append(d.log, s)
+}
+
+func (d *recordingDriver) Open(string) (driver.Conn, error) {
+	return &recordingConn{d}, nil
+}
+
+type recordingConn struct {
+	d *recordingDriver
+}
+
+func (c *recordingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("unsupported")
+}
+
+func (c *recordingConn) Close() error {
+	return nil
+}
+
+func (c *recordingConn) Begin() (driver.Tx, error) {
+	c.d.record("BEGIN")
+	return c, nil
+}
+
+func (c *recordingConn) Commit() error {
+	c.d.record("COMMIT")
+	return nil
+}
+
+func (c *recordingConn) Rollback() error {
+	c.d.record("ROLLBACK")
+	return nil
+}
+
+func (c *recordingConn) Exec(query string, _ []driver.Value) (driver.Result, error) {
+	c.d.record(query)
+	return driver.RowsAffected(0), nil
+}
+
+// savepointDialector adds savepoint support to the dummy dialector.
+type savepointDialector struct {
+	tests.DummyDialector
+}
+
+func (savepointDialector) SavePoint(tx *gorm.DB, name string) error {
+	return tx.Exec("SAVEPOINT " + name).Error
+}
+
+func (savepointDialector) RollbackTo(tx *gorm.DB, name string) error {
+	return tx.Exec("ROLLBACK TO SAVEPOINT " + name).Error
+}
+
+var txDriver = &recordingDriver{}
+
+func init() {
+	sql.Register("model-test-recording", txDriver)
+}
+
+func txDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	txDriver.log = nil
+	sqlDB, err := sql.Open("model-test-recording", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(savepointDialector{}, &gorm.Config{ConnPool: sqlDB, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestWithTx(t *testing.T) {
+	db := txDB(t)
+	tracer := mocktracer.New()
+	ctx := opentracing.ContextWithSpan(context.Background(), tracer.StartSpan("request"))
+
+	errInner := errors.New("inner failed")
+	err := WithTx(ctx, db, func(ctx context.Context, tx *gorm.DB) error {
+		if DBFromContext(ctx, db).Statement.ConnPool != tx.Statement.ConnPool {
+			t.Error("DBFromContext should return the ambient transaction")
+		}
+		// The nested transaction fails, rolling back to its savepoint only
+		if err := WithTx(ctx, db, func(ctx context.Context, tx *gorm.DB) error {
+			return errInner
+		}); err != errInner {
+			t.Errorf("unexpected nested error; expected %v, got %v", errInner, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := strings.Join(txDriver.log, "; ")
+	if !strings.HasPrefix(log, "BEGIN; SAVEPOINT ") || !strings.Contains(log, "; ROLLBACK TO SAVEPOINT ") || !strings.HasSuffix(log, "; COMMIT") {
+		t.Errorf("unexpected statements: %s", log)
+	}
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 2 {
+		t.Fatalf("unexpected span count; expected 2, got %d", len(spans))
+	}
+	if want, have := "rolled_back", spans[0].Tag("db.tx.outcome"); want != have {
+		t.Errorf("unexpected nested outcome; expected %s, got %v", want, have)
+	}
+	if want, have := "committed", spans[1].Tag("db.tx.outcome"); want != have {
+		t.Errorf("unexpected outcome; expected %s, got %v", want, have)
+	}
+}
+
+func TestWithTxRollsBackOnPanic(t *testing.T) {
+	db := txDB(t)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("the panic should propagate")
+			}
+		}()
+		WithTx(context.Background(), db, func(ctx context.Context, tx *gorm.DB) error {
+			panic("boom")
+		})
+	}()
+	if want, have := "BEGIN; ROLLBACK", strings.Join(txDriver.log, "; "); want != have {
+		t.Errorf("unexpected statements; expected %s, got %s", want, have)
+	}
+}
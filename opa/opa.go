@@ -4,12 +4,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptrace"
 	"strings"
 
+	"github.com/jdotw/go-utils/httpclient"
 	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/retry"
 	"github.com/opentracing/opentracing-go"
 	"go.uber.org/zap"
 )
@@ -19,23 +22,65 @@ type OPAClient interface {
 }
 
 type opaClient struct {
-	logger  log.Factory
-	tracer  opentracing.Tracer
-	baseURL string
+	logger    log.Factory
+	tracer    opentracing.Tracer
+	baseURL   string
+	client    *http.Client
+	retry     *retry.Policy
+	retryOpts []retry.Option
 }
 
-func NewOPAClient(logger log.Factory, tracer opentracing.Tracer, baseURL string) OPAClient {
-	var c OPAClient
+// Option configures the client returned by NewOPAClient.
+type Option func(*opaClient)
 
-	c = &opaClient{
+// Retry retries failed queries by policy. Connection errors and 408,
+// 429 and 5xx gateway responses are retried by default.
+func Retry(policy retry.Policy, opts ...retry.Option) Option {
+	return func(c *opaClient) {
+		c.retry = &policy
+		c.retryOpts = opts
+	}
+}
+
+// HTTPClient sends queries with client. It defaults to an httpclient
+// client named "opa".
+func HTTPClient(client *http.Client) Option {
+	return func(c *opaClient) {
+		c.client = client
+	}
+}
+
+func NewOPAClient(logger log.Factory, tracer opentracing.Tracer, baseURL string, opts ...Option) OPAClient {
+	c := &opaClient{
 		logger:  logger,
 		tracer:  tracer,
 		baseURL: baseURL,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.client == nil {
+		c.client = httpclient.New("opa", logger, tracer)
+	}
 
 	return c
 }
 
+// StatusError is returned when OPA responds with an error status.
+type StatusError struct {
+	Status int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("opa: unexpected status %d", e.Status)
+}
+
+// StatusCode reports the status OPA responded with, so retry
+// classification treats it like any other HTTP failure.
+func (e *StatusError) StatusCode() int {
+	return e.Status
+}
+
 type QueryRequest struct {
 	Input *interface{} `json:"input"`
 }
@@ -47,7 +92,7 @@ func (c *opaClient) Query(ctx context.Context, query string, data interface{}, r
 			c.logger.Bg().Info("connection re-use", zap.Bool("reused", info.Reused))
 		},
 	}
-	traceCtx := httptrace.WithClientTrace(context.Background(), clientTrace)
+	traceCtx := httptrace.WithClientTrace(ctx, clientTrace)
 
 	jsonStr, err := json.Marshal(&QueryRequest{Input: &data})
 	if err != nil {
@@ -57,22 +102,17 @@ func (c *opaClient) Query(ctx context.Context, query string, data interface{}, r
 
 	queryPath := strings.ReplaceAll(query, ".", "/")
 
-	req, err := http.NewRequestWithContext(traceCtx, http.MethodPost, c.baseURL+"/v1/"+queryPath, bytes.NewBuffer(jsonStr))
-	if err != nil {
-		c.logger.For(ctx).Error("Failed to create request", zap.Error(err))
+	var responseData []byte
+	post := func(ctx context.Context) error {
+		responseData, err = c.post(ctx, traceCtx, c.baseURL+"/v1/"+queryPath, jsonStr)
 		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
-
-	r, err := http.DefaultClient.Do(req)
-	if err != nil {
-		c.logger.For(ctx).Error("Failed to perform request", zap.Error(err))
-		return err
+	if c.retry != nil {
+		err = retry.Do(ctx, *c.retry, post, c.retryOpts...)
+	} else {
+		err = post(ctx)
 	}
-
-	responseData, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		c.logger.For(ctx).Error("Failed to read response body", zap.Error(err))
 		return err
 	}
 
@@ -84,3 +124,31 @@ func (c *opaClient) Query(ctx context.Context, query string, data interface{}, r
 
 	return nil
 }
+
+// post sends body to url, returning the response body.
+func (c *opaClient) post(ctx context.Context, traceCtx context.Context, url string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(traceCtx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		c.logger.For(ctx).Error("Failed to create request", zap.Error(err))
+		return nil, retry.Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	r, err := c.client.Do(req)
+	if err != nil {
+		c.logger.For(ctx).Error("Failed to perform request", zap.Error(err))
+		return nil, err
+	}
+	defer r.Body.Close()
+
+	responseData, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		c.logger.For(ctx).Error("Failed to read response body", zap.Error(err))
+		return nil, err
+	}
+	if r.StatusCode >= http.StatusBadRequest {
+		c.logger.For(ctx).Error("Unexpected response status", zap.Int("status", r.StatusCode))
+		return nil, &StatusError{Status: r.StatusCode}
+	}
+	return responseData, nil
+}
@@ -0,0 +1,50 @@
+package opa
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/retry"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestQueryRetry(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/v1/data/authz/allow" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"result": true}`))
+	}))
+	defer srv.Close()
+
+	policy := retry.Policy{MaxAttempts: 2, InitialBackoff: time.Millisecond}
+	c := NewOPAClient(log.NewMockLogFactory(), mocktracer.New(), srv.URL, Retry(policy))
+	var resp struct {
+		Result bool `json:"result"`
+	}
+	if err := c.Query(context.Background(), "data.authz.allow", nil, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Result || requests != 2 {
+		t.Errorf("expected the result on the second request, got %v after %d", resp.Result, requests)
+	}
+
+	// Without retries the status is returned
+	requests = 0
+	c = NewOPAClient(log.NewMockLogFactory(), mocktracer.New(), srv.URL)
+	var se *StatusError
+	if err := c.Query(context.Background(), "data.authz.allow", nil, &resp); !errors.As(err, &se) || se.Status != http.StatusServiceUnavailable {
+		t.Errorf("expected a 503 StatusError, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+// Package outbox implements the transactional outbox pattern: messages
+// are written to an outbox table in the same transaction as the business
+// change that produced them, and a Relay publishes them afterwards. A
+// message is published if and only if its transaction commits, at least
+// once.
+//
+//	err := model.WithTx(ctx, db, func(ctx context.Context, tx *gorm.DB) error {
+//		if err := tx.Create(&order).Error; err != nil {
+//			return err
+//		}
+//		return outbox.Write(ctx, tx, tracer, messaging.Message{Topic: "orders", Key: []byte(order.ID), Value: body})
+//	})
+//
+//	relay := outbox.NewRelay(db, producer, logger, tracer)
+//	go relay.Run(ctx)
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/jdotw/go-utils/messaging"
+	"github.com/jdotw/go-utils/model"
+	"github.com/opentracing/opentracing-go"
+	"gorm.io/gorm"
+)
+
+// IDHeader carries the outbox event ID on published messages. Messages
+// can be published more than once, so consumers that need exactly once
+// processing should skip repeats, e.g. with messaging/idempotency.
+const IDHeader = "X-Outbox-ID"
+
+// Event is a message waiting in, or published from, the outbox. Migrate
+// it to create the outbox_events table.
+type Event struct {
+	ID      string                         `json:"id" gorm:"primaryKey;type:uuid"`
+	Topic   string                         `json:"topic" gorm:"not null"`
+	Key     []byte                         `json:"key"`
+	Payload []byte                         `json:"payload"`
+	Headers model.JSONB[map[string]string] `json:"headers"`
+	// CreatedAt orders events for publishing.
+	CreatedAt time.Time `json:"created_at" gorm:"index:idx_outbox_events_pending,where:published_at IS NULL"`
+	// PublishedAt marks the event delivered to the broker.
+	PublishedAt *time.Time `json:"published_at" gorm:"index"`
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error"`
+}
+
+func (Event) TableName() string {
+	return "outbox_events"
+}
+
+// Message returns the event as a message to publish.
+func (e Event) Message() messaging.Message {
+	headers := make(map[string]string, len(e.Headers.Val)+1)
+	for k, v := range e.Headers.Val {
+		headers[k] = v
+	}
+	headers[IDHeader] = e.ID
+	return messaging.Message{Topic: e.Topic, Key: e.Key, Value: e.Payload, Headers: headers}
+}
+
+// Write adds msgs to the outbox in tx, the business transaction. The
+// trace context in ctx is saved with them, so the relay's publish spans
+// link back to the request that wrote them.
+func Write(ctx context.Context, tx *gorm.DB, tracer opentracing.Tracer, msgs ...messaging.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	events := make([]Event, len(msgs))
+	now := time.Now()
+	for i, msg := range msgs {
+		messaging.Inject(ctx, tracer, &msg)
+		events[i] = Event{
+			ID:      model.NewUUIDv7(),
+			Topic:   msg.Topic,
+			Key:     msg.Key,
+			Payload: msg.Value,
+			Headers: model.NewJSONB(msg.Headers),
+			// Events written together keep their order
+			CreatedAt: now.Add(time.Duration(i) * time.Microsecond),
+		}
+	}
+	return tx.WithContext(ctx).Create(&events).Error
+}
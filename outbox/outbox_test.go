@@ -0,0 +1,129 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/messaging"
+	"github.com/jdotw/go-utils/model"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/utils/tests"
+)
+
+type fakePublisher struct {
+	published []messaging.Message
+	failOn    string
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, msgs ...messaging.Message) error {
+	for _, msg := range msgs {
+		if msg.Headers[IDHeader] == p.failOn {
+			return errors.New("broker unavailable")
+		}
+		p.published = append(p.published, msg)
+	}
+	return nil
+}
+
+// stubDB returns a dry run database whose queries return events and
+// which records the SQL of other statements.
+func stubDB(t *testing.T, events []Event) (*gorm.DB, *[]string) {
+	t.Helper()
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statements []string
+	record := func(db *gorm.DB) {
+		statements = append(statements, db.Dialector.Explain(db.Statement.SQL.String(), db.Statement.Vars...))
+	}
+	err = db.Callback().Query().Replace("gorm:query", func(db *gorm.DB) {
+		callbacks.BuildQuerySQL(db)
+		record(db)
+		*db.Statement.Dest.(*[]Event) = events
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Callback().Create().After("gorm:create").Register("test:record", record); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("test:record", record); err != nil {
+		t.Fatal(err)
+	}
+	return db, &statements
+}
+
+func TestWrite(t *testing.T) {
+	db, statements := stubDB(t, nil)
+	tracer := mocktracer.New()
+	span := tracer.StartSpan("handler")
+	ctx := opentracing.ContextWithSpan(context.Background(), span)
+
+	err := Write(ctx, db, tracer,
+		messaging.Message{Topic: "orders", Key: []byte("1"), Value: []byte("{}")},
+		messaging.Message{Topic: "orders", Key: []byte("2"), Value: []byte("{}")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*statements) != 1 || !strings.HasPrefix((*statements)[0], "INSERT INTO `outbox_events`") {
+		t.Fatalf("expected a single insert, got %v", *statements)
+	}
+	if !strings.Contains((*statements)[0], "mockpfx-ids-traceid") {
+		t.Errorf("expected the trace context to be stored with the events: %s", (*statements)[0])
+	}
+}
+
+func TestRelayBatch(t *testing.T) {
+	tracer := mocktracer.New()
+	msg := messaging.Message{Topic: "orders"}
+	messaging.Inject(opentracing.ContextWithSpan(context.Background(), tracer.StartSpan("handler")), tracer, &msg)
+	events := []Event{
+		{ID: "a", Topic: "orders", Headers: model.NewJSONB(msg.Headers)},
+		{ID: "b", Topic: "orders"},
+		{ID: "c", Topic: "orders"},
+	}
+	db, statements := stubDB(t, events)
+	publisher := &fakePublisher{failOn: "b"}
+	r := NewRelay(db, publisher, log.NewMockLogFactory(), tracer, BatchSize(10))
+
+	n, err := r.relayBatch(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected relaying to stop at the failed event, published %d", n)
+	}
+	if len(publisher.published) != 1 || publisher.published[0].Headers[IDHeader] != "a" {
+		t.Errorf("unexpected messages published: %v", publisher.published)
+	}
+	if len(*statements) != 3 {
+		t.Fatalf("expected a select and two updates, got %v", *statements)
+	}
+	if s := (*statements)[0]; !strings.HasSuffix(s, "WHERE published_at IS NULL ORDER BY created_at LIMIT 10 FOR UPDATE SKIP LOCKED") {
+		t.Errorf("unexpected select: %s", s)
+	}
+	if s := (*statements)[1]; !strings.Contains(s, "SET `published_at`=") || !strings.HasSuffix(s, "WHERE id = \"a\"") {
+		t.Errorf("expected event a to be marked published: %s", s)
+	}
+	if s := (*statements)[2]; !strings.Contains(s, "`attempts`=attempts + 1") || !strings.Contains(s, "broker unavailable") || !strings.HasSuffix(s, "WHERE id = \"b\"") {
+		t.Errorf("expected the failure to be recorded on event b: %s", s)
+	}
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected two relay spans, got %d", len(spans))
+	}
+	if spans[0].ParentID == 0 {
+		t.Error("expected the relay span to follow from the writer's span")
+	}
+	if spans[1].Tag("error") != true {
+		t.Error("expected the failed publish to be tagged as an error")
+	}
+}
@@ -0,0 +1,165 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/messaging"
+	"github.com/jdotw/go-utils/model"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Relay publishes outbox events in the order they were written. Several
+// replicas can run relays: each batch is claimed with SELECT ... FOR
+// UPDATE SKIP LOCKED, so an event is only published by one of them at a
+// time.
+type Relay struct {
+	db        *gorm.DB
+	publisher messaging.Publisher
+	logger    log.Factory
+	tracer    opentracing.Tracer
+
+	batchSize    int
+	pollInterval time.Duration
+	retention    time.Duration
+}
+
+// RelayOption configures a Relay.
+type RelayOption func(*Relay)
+
+// BatchSize is the number of events claimed at a time. It defaults to
+// 100.
+func BatchSize(n int) RelayOption {
+	return func(r *Relay) {
+		r.batchSize = n
+	}
+}
+
+// PollInterval is the wait between polls when the outbox is empty or
+// publishing fails. It defaults to one second.
+func PollInterval(d time.Duration) RelayOption {
+	return func(r *Relay) {
+		r.pollInterval = d
+	}
+}
+
+// Retention is how long published events are kept before Run deletes
+// them. It defaults to a week; zero keeps them forever.
+func Retention(d time.Duration) RelayOption {
+	return func(r *Relay) {
+		r.retention = d
+	}
+}
+
+// NewRelay returns a Relay publishing the outbox in db with publisher,
+// such as a Kafka or NATS Producer.
+func NewRelay(db *gorm.DB, publisher messaging.Publisher, logger log.Factory, tracer opentracing.Tracer, opts ...RelayOption) *Relay {
+	r := &Relay{
+		db:           db,
+		publisher:    publisher,
+		logger:       logger,
+		tracer:       tracer,
+		batchSize:    100,
+		pollInterval: time.Second,
+		retention:    7 * 24 * time.Hour,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Run publishes events until ctx is cancelled. It polls while the
+// outbox is empty and publishes back to back while it isn't.
+func (r *Relay) Run(ctx context.Context) {
+	lastPurge := time.Time{}
+	for {
+		var published int
+		err := model.WithTx(ctx, r.db, func(ctx context.Context, tx *gorm.DB) error {
+			var err error
+			published, err = r.relayBatch(ctx, tx)
+			return err
+		})
+		if err != nil && ctx.Err() == nil {
+			r.logger.Bg().Error("Failed to relay outbox events", zap.Error(err))
+		}
+		if r.retention > 0 && time.Since(lastPurge) > time.Hour {
+			if err := r.Purge(ctx, r.retention); err != nil && ctx.Err() == nil {
+				r.logger.Bg().Error("Failed to purge outbox events", zap.Error(err))
+			}
+			lastPurge = time.Now()
+		}
+		if published == r.batchSize && err == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.pollInterval):
+		}
+	}
+}
+
+// relayBatch claims and publishes a batch of events in tx, marking each
+// published. It stops at the first failure so events stay in order,
+// recording the error on the event. It returns the number published.
+func (r *Relay) relayBatch(ctx context.Context, tx *gorm.DB) (int, error) {
+	var events []Event
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("published_at IS NULL").
+		Order("created_at").
+		Limit(r.batchSize).
+		Find(&events).Error
+	if err != nil {
+		return 0, err
+	}
+
+	for i, e := range events {
+		if err := r.publish(ctx, e); err != nil {
+			update := tx.Model(&Event{}).Where("id = ?", e.ID).Updates(map[string]interface{}{
+				"attempts":   gorm.Expr("attempts + 1"),
+				"last_error": err.Error(),
+			})
+			return i, update.Error
+		}
+		now := time.Now()
+		if err := tx.Model(&Event{}).Where("id = ?", e.ID).Update("published_at", &now).Error; err != nil {
+			return i, err
+		}
+	}
+	return len(events), nil
+}
+
+// publish publishes e in a span following from the one that wrote it.
+func (r *Relay) publish(ctx context.Context, e Event) error {
+	msg := e.Message()
+	opts := []opentracing.StartSpanOption{}
+	if sc, err := r.tracer.Extract(opentracing.TextMap, opentracing.TextMapCarrier(msg.Headers)); err == nil {
+		opts = append(opts, opentracing.FollowsFrom(sc))
+	}
+	span := r.tracer.StartSpan("outbox.relay", opts...)
+	defer span.Finish()
+	span.SetTag("message_bus.destination", e.Topic)
+	span.SetTag("outbox.event_id", e.ID)
+	span.SetTag("outbox.attempts", e.Attempts)
+
+	if err := r.publisher.Publish(opentracing.ContextWithSpan(ctx, span), msg); err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(otlog.Error(err))
+		return err
+	}
+	return nil
+}
+
+// Purge deletes events published more than olderThan ago.
+func (r *Relay) Purge(ctx context.Context, olderThan time.Duration) error {
+	return r.db.WithContext(ctx).
+		Where("published_at < ?", time.Now().Add(-olderThan)).
+		Delete(&Event{}).Error
+}
@@ -0,0 +1,80 @@
+// Package page holds the pagination parameters shared by the model and
+// transport packages, so either can use them without depending on the
+// other.
+package page
+
+import "strings"
+
+// Size limits applied by Request.Normalize.
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// Request selects a page of a list and its order. Sort is a comma
+// separated list of fields, each prefixed with - for descending order,
+// e.g. "-created_at,name". The tags let transport.HTTPDecodeParamsRequest
+// bind and validate it from the query string.
+type Request struct {
+	Page  int    `json:"page" query:"page" default:"1" validate:"min=1"`
+	Limit int    `json:"limit" query:"limit" default:"20" validate:"min=1,max=100"`
+	Sort  string `json:"sort,omitempty" query:"sort"`
+}
+
+// Normalize applies the default page and limit to unset values and
+// clamps the limit to MaxLimit, for requests that didn't come through
+// the validating decoders.
+func (p Request) Normalize() Request {
+	if p.Page < 1 {
+		p.Page = 1
+	}
+	if p.Limit < 1 {
+		p.Limit = DefaultLimit
+	}
+	if p.Limit > MaxLimit {
+		p.Limit = MaxLimit
+	}
+	return p
+}
+
+// Offset returns the number of items preceding the requested page.
+func (p Request) Offset() int {
+	p = p.Normalize()
+	return (p.Page - 1) * p.Limit
+}
+
+// SortField is one field of a sort expression.
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// SortFields parses Sort.
+func (p Request) SortFields() []SortField {
+	return ParseSort(p.Sort)
+}
+
+// ParseSort parses a sort expression such as "-created_at,name".
+func ParseSort(sort string) []SortField {
+	var fields []SortField
+	for _, part := range strings.Split(sort, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		f := SortField{Field: strings.TrimPrefix(part, "-")}
+		f.Desc = f.Field != part
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// Info describes the position of a page within a list.
+type Info struct {
+	Total      *int64
+	Page       int
+	Limit      int
+	Count      int
+	NextCursor string
+	PrevCursor string
+}
@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jdotw/go-utils/clock"
+	"github.com/jdotw/go-utils/log"
+	"go.uber.org/zap"
+)
+
+// fallbackRetryInterval is how long the fallback limiter is used after
+// the primary fails before the primary is tried again.
+const fallbackRetryInterval = 5 * time.Second
+
+type fallbackLimiter struct {
+	primary  Limiter
+	fallback Limiter
+	logger   log.Factory
+
+	mu        sync.Mutex
+	downUntil time.Time
+	clock     clock.Clock
+}
+
+// NewFallbackLimiter returns a Limiter that uses primary, typically a
+// Redis limiter, and switches to fallback, typically an in-memory one,
+// while primary is failing. Limits are then enforced per replica rather
+// than not at all. Primary is retried every few seconds.
+func NewFallbackLimiter(primary, fallback Limiter, logger log.Factory, opts ...Option) Limiter {
+	return &fallbackLimiter{
+		primary:  primary,
+		fallback: fallback,
+		logger:   logger,
+		clock:    newOptions(opts).clock,
+	}
+}
+
+func (l *fallbackLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	l.mu.Lock()
+	down := l.clock.Now().Before(l.downUntil)
+	l.mu.Unlock()
+	if down {
+		return l.fallback.Allow(ctx, key)
+	}
+
+	result, err := l.primary.Allow(ctx, key)
+	if err == nil {
+		return result, nil
+	}
+	l.mu.Lock()
+	l.downUntil = l.clock.Now().Add(fallbackRetryInterval)
+	l.mu.Unlock()
+	l.logger.For(ctx).Error("Rate limiter failed, using local fallback", zap.Error(err))
+	return l.fallback.Allow(ctx, key)
+}
@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jdotw/go-utils/clock"
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type memoryLimiter struct {
+	rate      Rate
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	clock     clock.Clock
+}
+
+// NewMemoryLimiter returns a token bucket Limiter holding state in
+// process memory. Limits are per replica.
+func NewMemoryLimiter(rate Rate, opts ...Option) Limiter {
+	return &memoryLimiter{
+		rate:    rate,
+		buckets: map[string]*bucket{},
+		clock:   newOptions(opts).clock,
+	}
+}
+
+func (l *memoryLimiter) Allow(_ context.Context, key string) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	l.sweep(now)
+
+	capacity := float64(l.rate.Limit)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+float64(now.Sub(b.last).Nanoseconds())*l.rate.tokensPerNano())
+	b.last = now
+
+	result := Result{Limit: l.rate.Limit}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration(math.Ceil((1 - b.tokens) / l.rate.tokensPerNano()))
+	}
+	result.Remaining = int(b.tokens)
+	return result, nil
+}
+
+// sweep drops buckets that have refilled completely, as they are
+// indistinguishable from new ones. It runs at most once per period.
+func (l *memoryLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.rate.Per {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= l.rate.Per {
+			delete(l.buckets, key)
+		}
+	}
+}
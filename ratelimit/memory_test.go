@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jdotw/go-utils/clock"
+	"github.com/jdotw/go-utils/log"
+)
+
+func TestMemoryLimiter(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	l := NewMemoryLimiter(PerSecond(2), WithClock(clk))
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if r, _ := l.Allow(ctx, "a"); !r.Allowed {
+			t.Fatalf("request %d should be allowed", i)
+		}
+	}
+	r, _ := l.Allow(ctx, "a")
+	if r.Allowed || r.RetryAfter != 500*time.Millisecond {
+		t.Errorf("expected to be limited for 500ms, got %+v", r)
+	}
+	if r, _ := l.Allow(ctx, "b"); !r.Allowed {
+		t.Error("keys should be limited independently")
+	}
+
+	clk.Advance(500 * time.Millisecond)
+	if r, _ := l.Allow(ctx, "a"); !r.Allowed {
+		t.Error("bucket should have refilled a token")
+	}
+}
+
+func TestSlidingWindowLimiter(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	l := NewSlidingWindowLimiter(PerSecond(2), WithClock(clk))
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if r, _ := l.Allow(ctx, "a"); !r.Allowed {
+			t.Fatalf("request %d should be allowed", i)
+		}
+	}
+	r, _ := l.Allow(ctx, "a")
+	if r.Allowed || r.RetryAfter <= time.Second {
+		t.Errorf("expected to be limited past the window, got %+v", r)
+	}
+	if r, _ := l.Allow(ctx, "b"); !r.Allowed {
+		t.Error("keys should be limited independently")
+	}
+
+	// A quarter into the next window, 1.5 of the previous count remains.
+	clk.Advance(1250 * time.Millisecond)
+	if r, _ := l.Allow(ctx, "a"); !r.Allowed || r.Remaining != 0 {
+		t.Errorf("expected one request to be allowed, got %+v", r)
+	}
+	if r, _ := l.Allow(ctx, "a"); r.Allowed || r.RetryAfter != 250*time.Millisecond {
+		t.Errorf("expected to be limited for 250ms, got %+v", r)
+	}
+}
+
+type failingLimiter struct{ calls int }
+
+func (l *failingLimiter) Allow(context.Context, string) (Result, error) {
+	l.calls++
+	return Result{}, errors.New("connection refused")
+}
+
+func TestFallbackLimiter(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	primary := &failingLimiter{}
+	local := NewMemoryLimiter(PerSecond(1), WithClock(clk))
+	l := NewFallbackLimiter(primary, local, log.NewMockLogFactory(), WithClock(clk))
+	ctx := context.Background()
+
+	if r, err := l.Allow(ctx, "a"); err != nil || !r.Allowed {
+		t.Fatalf("expected fallback to allow, got %+v, %v", r, err)
+	}
+	if r, _ := l.Allow(ctx, "a"); r.Allowed {
+		t.Error("fallback should enforce the limit")
+	}
+	if primary.calls != 1 {
+		t.Errorf("primary should not be retried immediately, got %d calls", primary.calls)
+	}
+
+	clk.Advance(fallbackRetryInterval)
+	l.Allow(ctx, "a")
+	if primary.calls != 2 {
+		t.Errorf("primary should be retried after the interval, got %d calls", primary.calls)
+	}
+}
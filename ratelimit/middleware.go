@@ -0,0 +1,44 @@
+package ratelimit
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/jdotw/go-utils/authn/jwt"
+	"github.com/jdotw/go-utils/log"
+	"go.uber.org/zap"
+)
+
+// KeyFunc derives the rate limit key for an endpoint request.
+// Returning an empty key exempts the request from limiting.
+type KeyFunc func(ctx context.Context, request interface{}) string
+
+// KeyBySubject keys requests by the subject (sub) claim of the JWT parsed
+// by the authn middleware, which must run first.
+func KeyBySubject(ctx context.Context, _ interface{}) string {
+	return jwt.SubjectFromContext(ctx)
+}
+
+// NewMiddleware returns an endpoint middleware that limits requests per
+// key, returning a *LimitExceededError when the limit is reached. If the
+// limiter fails, requests are allowed and the failure logged.
+func NewMiddleware(limiter Limiter, key KeyFunc, logger log.Factory) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			k := key(ctx, request)
+			if k == "" {
+				return next(ctx, request)
+			}
+			result, err := limiter.Allow(ctx, k)
+			if err != nil {
+				logger.For(ctx).Error("Rate limiter failed, allowing request", zap.Error(err))
+				return next(ctx, request)
+			}
+			if !result.Allowed {
+				logger.For(ctx).Info("Rate limit exceeded", zap.String("key", k))
+				return nil, &LimitExceededError{Result: result}
+			}
+			return next(ctx, request)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jdotw/go-utils/clock"
+)
+
+// Rate limiting shared by the HTTP and endpoint middlewares. Each key
+// (a client IP, JWT subject, API key...) has a token bucket holding up
+// to Rate.Limit tokens, refilled evenly over Rate.Per, or a sliding
+// window allowing Rate.Limit requests in any period of Rate.Per. Redis
+// limiters hold limits across replicas; wrap them with
+// NewFallbackLimiter to keep limiting locally when Redis is down.
+
+// Rate is the number of requests allowed per period. Limit is also
+// the burst size.
+type Rate struct {
+	Limit int
+	Per   time.Duration
+}
+
+// PerSecond returns a Rate of n requests per second.
+func PerSecond(n int) Rate {
+	return Rate{Limit: n, Per: time.Second}
+}
+
+// PerMinute returns a Rate of n requests per minute.
+func PerMinute(n int) Rate {
+	return Rate{Limit: n, Per: time.Minute}
+}
+
+// tokensPerNano is the refill rate of the bucket.
+func (r Rate) tokensPerNano() float64 {
+	return float64(r.Limit) / float64(r.Per.Nanoseconds())
+}
+
+// Result is the outcome of a single Allow call.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// Limiter decides whether a request identified by key may proceed.
+type Limiter interface {
+	Allow(ctx context.Context, key string) (Result, error)
+}
+
+// Option configures the in-memory and fallback limiters.
+type Option func(*options)
+
+type options struct {
+	clock clock.Clock
+}
+
+// WithClock makes a limiter tell the time with c rather than the system
+// clock, so tests can refill buckets and slide windows without sleeping.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{clock: clock.New()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// LimitExceededError is returned when a request is rate limited. It maps
+// to a 429 status with a Retry-After header in the HTTP error encoders.
+type LimitExceededError struct {
+	Result Result
+}
+
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("rate limit exceeded, retry after %s", e.Result.RetryAfter)
+}
+
+// StatusCode implements go-kit's StatusCoder.
+func (e *LimitExceededError) StatusCode() int {
+	return http.StatusTooManyRequests
+}
+
+// RetryAfter returns how long the client should wait before retrying.
+func (e *LimitExceededError) RetryAfter() time.Duration {
+	return e.Result.RetryAfter
+}
+
+// Headers implements go-kit's Headerer.
+func (e *LimitExceededError) Headers() http.Header {
+	h := http.Header{}
+	SetHeaders(h, e.Result)
+	return h
+}
+
+// SetHeaders adds the conventional rate limit headers for result to h.
+func SetHeaders(h http.Header, result Result) {
+	h.Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	if !result.Allowed {
+		h.Set("Retry-After", strconv.Itoa(retryAfterSeconds(result.RetryAfter)))
+	}
+}
+
+// retryAfterSeconds rounds up, as Retry-After has second granularity.
+func retryAfterSeconds(d time.Duration) int {
+	secs := int((d + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	return secs
+}
@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// The bucket is stored as a hash of tokens and last refill time
+// (microseconds, from the Redis server clock so replicas agree).
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local data = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(data[1]) or capacity
+local ts = tonumber(data[2]) or now
+tokens = math.min(capacity, tokens + (now - ts) * rate)
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) / rate)
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", tostring(now))
+redis.call("PEXPIRE", KEYS[1], math.ceil(capacity / rate / 1000) + 1000)
+return {allowed, math.floor(tokens), retry}
+`)
+
+type redisLimiter struct {
+	client redis.Scripter
+	rate   Rate
+	prefix string
+}
+
+// NewRedisLimiter returns a token bucket Limiter storing state in Redis,
+// so limits hold across replicas. Keys are stored under prefix.
+func NewRedisLimiter(client redis.Scripter, rate Rate, prefix string) Limiter {
+	return &redisLimiter{client: client, rate: rate, prefix: prefix}
+}
+
+func (l *redisLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	tokensPerMicro := l.rate.tokensPerNano() * 1000
+	values, err := tokenBucketScript.Run(ctx, l.client, []string{l.prefix + key}, l.rate.Limit, tokensPerMicro).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{
+		Allowed:    values[0] == 1,
+		Limit:      l.rate.Limit,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Microsecond,
+	}, nil
+}
@@ -0,0 +1,181 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jdotw/go-utils/clock"
+	"github.com/redis/go-redis/v9"
+)
+
+// Sliding window limiters count requests in fixed windows of Rate.Per
+// and weight the previous window's count by how much of it still
+// overlaps the sliding window. Unlike the token bucket they allow no
+// burst above Rate.Limit at a window boundary.
+
+type window struct {
+	start int64 // window number, now / Per
+	curr  int
+	prev  int
+}
+
+// estimate is the weighted request count at elapsed into the window.
+func (w *window) estimate(elapsed, per time.Duration) float64 {
+	return float64(w.prev)*(1-float64(elapsed)/float64(per)) + float64(w.curr)
+}
+
+// slidingRetryAfter is how long until the estimate drops below limit.
+func slidingRetryAfter(limit, curr, prev int, elapsed, per time.Duration) time.Duration {
+	if curr >= limit {
+		// Wait for the next window, then for enough of curr to slide out.
+		next := per - elapsed
+		return next + time.Duration(math.Ceil((1-float64(limit)/float64(curr))*float64(per))) + 1
+	}
+	f := 1 - float64(limit-curr)/float64(prev)
+	retry := time.Duration(math.Ceil(f*float64(per))) - elapsed
+	if retry < 1 {
+		retry = 1
+	}
+	return retry
+}
+
+type slidingWindowLimiter struct {
+	rate      Rate
+	mu        sync.Mutex
+	windows   map[string]*window
+	lastSweep int64
+	clock     clock.Clock
+}
+
+// NewSlidingWindowLimiter returns a sliding window Limiter holding state
+// in process memory. Limits are per replica.
+func NewSlidingWindowLimiter(rate Rate, opts ...Option) Limiter {
+	return &slidingWindowLimiter{
+		rate:    rate,
+		windows: map[string]*window{},
+		clock:   newOptions(opts).clock,
+	}
+}
+
+func (l *slidingWindowLimiter) Allow(_ context.Context, key string) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now().UnixNano()
+	per := l.rate.Per.Nanoseconds()
+	start := now / per
+	elapsed := time.Duration(now % per)
+
+	w, ok := l.windows[key]
+	if !ok {
+		w = &window{start: start}
+		l.windows[key] = w
+	}
+	l.advance(w, start)
+
+	result := Result{Limit: l.rate.Limit}
+	est := w.estimate(elapsed, l.rate.Per)
+	if est < float64(l.rate.Limit) {
+		w.curr++
+		est++
+		result.Allowed = true
+	} else {
+		result.RetryAfter = slidingRetryAfter(l.rate.Limit, w.curr, w.prev, elapsed, l.rate.Per)
+	}
+	result.Remaining = int(math.Max(0, float64(l.rate.Limit)-math.Ceil(est)))
+	l.sweep(start)
+	return result, nil
+}
+
+// advance rolls w forward to window start.
+func (l *slidingWindowLimiter) advance(w *window, start int64) {
+	switch {
+	case start == w.start:
+	case start == w.start+1:
+		w.prev, w.curr = w.curr, 0
+	default:
+		w.prev, w.curr = 0, 0
+	}
+	w.start = start
+}
+
+// sweep drops windows with no requests in the current or previous
+// window, as they are indistinguishable from new ones. It runs at most
+// once per window.
+func (l *slidingWindowLimiter) sweep(start int64) {
+	if start == l.lastSweep {
+		return
+	}
+	l.lastSweep = start
+	for key, w := range l.windows {
+		if w.start < start-1 {
+			delete(l.windows, key)
+		}
+	}
+}
+
+// The window is stored as a hash of window number and the current and
+// previous counts, using the Redis server clock so replicas agree.
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local per = tonumber(ARGV[2])
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local start = math.floor(now / per)
+local elapsed = now % per
+local data = redis.call("HMGET", KEYS[1], "start", "curr", "prev")
+local wstart = tonumber(data[1]) or start
+local curr = tonumber(data[2]) or 0
+local prev = tonumber(data[3]) or 0
+if start == wstart + 1 then
+	prev = curr
+	curr = 0
+elseif start ~= wstart then
+	prev = 0
+	curr = 0
+end
+local allowed = 0
+if prev * (1 - elapsed / per) + curr < limit then
+	curr = curr + 1
+	allowed = 1
+end
+redis.call("HSET", KEYS[1], "start", start, "curr", curr, "prev", prev)
+redis.call("PEXPIRE", KEYS[1], math.ceil(per * 2 / 1000) + 1000)
+return {allowed, curr, prev, elapsed}
+`)
+
+type redisSlidingWindowLimiter struct {
+	client redis.Scripter
+	rate   Rate
+	prefix string
+}
+
+// NewRedisSlidingWindowLimiter returns a sliding window Limiter storing
+// state in Redis, so limits hold across replicas. Keys are stored under
+// prefix.
+func NewRedisSlidingWindowLimiter(client redis.Scripter, rate Rate, prefix string) Limiter {
+	return &redisSlidingWindowLimiter{client: client, rate: rate, prefix: prefix}
+}
+
+func (l *redisSlidingWindowLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	perMicros := l.rate.Per.Microseconds()
+	values, err := slidingWindowScript.Run(ctx, l.client, []string{l.prefix + key}, l.rate.Limit, perMicros).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	curr, prev := int(values[1]), int(values[2])
+	elapsed := time.Duration(values[3]) * time.Microsecond
+	w := window{curr: curr, prev: prev}
+	result := Result{
+		Allowed: values[0] == 1,
+		Limit:   l.rate.Limit,
+	}
+	est := w.estimate(elapsed, l.rate.Per)
+	result.Remaining = int(math.Max(0, float64(l.rate.Limit)-math.Ceil(est)))
+	if !result.Allowed {
+		result.RetryAfter = slidingRetryAfter(l.rate.Limit, curr, prev, elapsed, l.rate.Per)
+	}
+	return result, nil
+}
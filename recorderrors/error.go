@@ -1,5 +1,181 @@
+// Package recorderrors defines the errors services return for records:
+// sentinels to match with errors.Is, and an Error type carrying a code
+// and metadata, such as the resource and its ID or the invalid fields,
+// that the HTTP and gRPC encoders put in responses.
+//
+//	return recorderrors.NotFound("order", id)
+//	return recorderrors.Invalid(recorderrors.FieldError{Field: "email", Message: "is already used"})
+//
+//	if errors.Is(err, recorderrors.ErrNotFound) {
+//		...
+//	}
 package recorderrors
 
-import "errors"
+import (
+	"errors"
+	"strings"
+	"time"
+)
 
-var ErrNotFound = errors.New("record not found")
+var (
+	ErrNotFound           = errors.New("record not found")
+	ErrAlreadyExists      = errors.New("record already exists")
+	ErrConflict           = errors.New("record conflict")
+	ErrValidation         = errors.New("invalid record")
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrUnavailable        = errors.New("unavailable")
+)
+
+// Code identifies the kind of an error to clients.
+type Code string
+
+const (
+	CodeNotFound           Code = "not_found"
+	CodeAlreadyExists      Code = "already_exists"
+	CodeConflict           Code = "conflict"
+	CodeValidation         Code = "validation_failed"
+	CodePreconditionFailed Code = "precondition_failed"
+	CodeUnavailable        Code = "unavailable"
+)
+
+var sentinels = map[Code]error{
+	CodeNotFound:           ErrNotFound,
+	CodeAlreadyExists:      ErrAlreadyExists,
+	CodeConflict:           ErrConflict,
+	CodeValidation:         ErrValidation,
+	CodePreconditionFailed: ErrPreconditionFailed,
+	CodeUnavailable:        ErrUnavailable,
+}
+
+// sentinelCodes orders the sentinels for CodeOf, so an error matching
+// more than one always gets the same code.
+var sentinelCodes = []Code{
+	CodeNotFound,
+	CodeAlreadyExists,
+	CodeConflict,
+	CodeValidation,
+	CodePreconditionFailed,
+	CodeUnavailable,
+}
+
+// FieldError describes a single invalid field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule,omitempty"`
+	Message string `json:"message"`
+}
+
+// Error is a record error with its code and metadata. It matches the
+// sentinel for its code with errors.Is.
+type Error struct {
+	Code Code
+	// Resource is the type of record, such as "order".
+	Resource string
+	// ID identifies the record.
+	ID string
+	// Message describes the error to clients. It defaults to the
+	// sentinel's text.
+	Message string
+	// Fields lists invalid fields of validation errors.
+	Fields []FieldError
+	// RetryIn is when unavailable records may be retried, if known.
+	RetryIn time.Duration
+	// Err is the underlying cause, which is not shown to clients.
+	Err error
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if msg == "" {
+		if sentinel, ok := sentinels[e.Code]; ok {
+			msg = sentinel.Error()
+		} else {
+			msg = string(e.Code)
+		}
+	}
+	if e.Resource != "" {
+		subject := e.Resource
+		if e.ID != "" {
+			subject += " " + e.ID
+		}
+		msg = subject + ": " + msg
+	}
+	if len(e.Fields) > 0 {
+		fields := make([]string, len(e.Fields))
+		for i, f := range e.Fields {
+			fields[i] = f.Field + " " + f.Message
+		}
+		msg += ": " + strings.Join(fields, ", ")
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the sentinel for e's code.
+func (e *Error) Is(target error) bool {
+	sentinel, ok := sentinels[e.Code]
+	return ok && sentinel == target
+}
+
+// FieldErrors returns the invalid fields, for the transport encoders.
+func (e *Error) FieldErrors() []FieldError {
+	return e.Fields
+}
+
+// RetryAfter returns RetryIn, for the transport encoders' Retry-After.
+func (e *Error) RetryAfter() time.Duration {
+	return e.RetryIn
+}
+
+// NotFound returns an ErrNotFound error for the resource with id.
+func NotFound(resource, id string) error {
+	return &Error{Code: CodeNotFound, Resource: resource, ID: id}
+}
+
+// AlreadyExists returns an ErrAlreadyExists error for the resource with
+// id.
+func AlreadyExists(resource, id string) error {
+	return &Error{Code: CodeAlreadyExists, Resource: resource, ID: id}
+}
+
+// Conflict returns an ErrConflict error for the resource with id, such as
+// a concurrent modification.
+func Conflict(resource, id, message string) error {
+	return &Error{Code: CodeConflict, Resource: resource, ID: id, Message: message}
+}
+
+// Invalid returns an ErrValidation error listing the invalid fields.
+func Invalid(fields ...FieldError) error {
+	return &Error{Code: CodeValidation, Fields: fields}
+}
+
+// PreconditionFailed returns an ErrPreconditionFailed error, such as for
+// a stale If-Match version.
+func PreconditionFailed(resource, id, message string) error {
+	return &Error{Code: CodePreconditionFailed, Resource: resource, ID: id, Message: message}
+}
+
+// Unavailable returns an ErrUnavailable error that may be retried after
+// retryIn, when non-zero.
+func Unavailable(message string, retryIn time.Duration, cause error) error {
+	return &Error{Code: CodeUnavailable, Message: message, RetryIn: retryIn, Err: cause}
+}
+
+// CodeOf returns the code of err: the Code of an Error in its chain, or
+// the code of the first sentinel it matches, in the order they are
+// declared. It returns an empty code for other errors.
+func CodeOf(err error) Code {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	for _, code := range sentinelCodes {
+		if errors.Is(err, sentinels[code]) {
+			return code
+		}
+	}
+	return ""
+}
@@ -0,0 +1,70 @@
+package recorderrors
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestError(t *testing.T) {
+	cause := errors.New("duplicate key")
+	tests := []struct {
+		err      error
+		sentinel error
+		code     Code
+		message  string
+	}{
+		{NotFound("order", "42"), ErrNotFound, CodeNotFound, "order 42: record not found"},
+		{AlreadyExists("order", "42"), ErrAlreadyExists, CodeAlreadyExists, "order 42: record already exists"},
+		{Conflict("order", "42", "modified concurrently"), ErrConflict, CodeConflict, "order 42: modified concurrently"},
+		{Invalid(FieldError{Field: "email", Message: "is required"}), ErrValidation, CodeValidation, "invalid record: email is required"},
+		{PreconditionFailed("order", "", "stale version"), ErrPreconditionFailed, CodePreconditionFailed, "order: stale version"},
+		{Unavailable("", time.Second, cause), ErrUnavailable, CodeUnavailable, "unavailable"},
+		{fmt.Errorf("loading: %w", ErrNotFound), ErrNotFound, CodeNotFound, "loading: record not found"},
+	}
+	for _, tt := range tests {
+		if !errors.Is(tt.err, tt.sentinel) {
+			t.Errorf("%q should match %q", tt.err, tt.sentinel)
+		}
+		if code := CodeOf(tt.err); code != tt.code {
+			t.Errorf("%q: expected code %s, got %s", tt.err, tt.code, code)
+		}
+		if msg := tt.err.Error(); msg != tt.message {
+			t.Errorf("expected message %q, got %q", tt.message, msg)
+		}
+	}
+
+	if errors.Is(NotFound("order", "42"), ErrConflict) {
+		t.Error("errors should only match their own sentinel")
+	}
+	if !errors.Is(Unavailable("", 0, cause), cause) {
+		t.Error("errors should unwrap to their cause")
+	}
+	if CodeOf(errors.New("boom")) != "" {
+		t.Error("other errors should have no code")
+	}
+}
+
+// multiError matches several sentinels with errors.Is.
+type multiError []error
+
+func (e multiError) Error() string { return "multiple errors" }
+
+func (e multiError) Is(target error) bool {
+	for _, err := range e {
+		if err == target {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCodeOfMultipleSentinels(t *testing.T) {
+	err := multiError{ErrUnavailable, ErrConflict, ErrNotFound}
+	for i := 0; i < 20; i++ {
+		if want, have := CodeNotFound, CodeOf(err); want != have {
+			t.Fatalf("unexpected code; expected %s, got %s", want, have)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/tracing"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	goredis "github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// hook traces and logs commands. Spans record command names but not
+// arguments, which may hold keys and values that shouldn't leave the
+// service.
+type hook struct {
+	tracer opentracing.Tracer
+	logger log.Factory
+	addr   string
+	db     int
+}
+
+func (h *hook) DialHook(next goredis.DialHook) goredis.DialHook {
+	return next
+}
+
+func (h *hook) ProcessHook(next goredis.ProcessHook) goredis.ProcessHook {
+	return func(ctx context.Context, cmd goredis.Cmder) error {
+		ctx, span := h.startSpan(ctx, "redis."+cmd.Name())
+		defer span.Finish()
+		err := next(ctx, cmd)
+		h.finish(ctx, span, cmd.Name(), err)
+		return err
+	}
+}
+
+func (h *hook) ProcessPipelineHook(next goredis.ProcessPipelineHook) goredis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []goredis.Cmder) error {
+		ctx, span := h.startSpan(ctx, "redis.pipeline")
+		defer span.Finish()
+		names := make([]string, len(cmds))
+		for i, cmd := range cmds {
+			names[i] = cmd.Name()
+		}
+		span.SetTag("db.statement", strings.Join(names, " "))
+		span.SetTag("redis.pipeline_length", len(cmds))
+		err := next(ctx, cmds)
+		h.finish(ctx, span, "pipeline", err)
+		return err
+	}
+}
+
+func (h *hook) startSpan(ctx context.Context, name string) (context.Context, opentracing.Span) {
+	ctx, span := tracing.NewChildSpanAndContext(ctx, h.tracer, name)
+	ext.DBType.Set(span, "redis")
+	ext.DBInstance.Set(span, strconv.Itoa(h.db))
+	ext.PeerAddress.Set(span, h.addr)
+	ext.SpanKindRPCClient.Set(span)
+	return ctx, span
+}
+
+func (h *hook) finish(ctx context.Context, span opentracing.Span, name string, err error) {
+	// Nil is a cache miss, not a failure
+	if err == nil || errors.Is(err, goredis.Nil) {
+		return
+	}
+	ext.Error.Set(span, true)
+	span.LogFields(otlog.Error(err))
+	h.logger.For(ctx).Error("Redis command failed", zap.String("command", name), zap.Error(err))
+}
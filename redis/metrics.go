@@ -0,0 +1,49 @@
+package redis
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// poolCollector exports a client's connection pool statistics.
+type poolCollector struct {
+	client *goredis.Client
+
+	hits, misses, timeouts, stale *prometheus.Desc
+	total, idle                   *prometheus.Desc
+}
+
+func newPoolCollector(client *goredis.Client, name string) *poolCollector {
+	labels := prometheus.Labels{"redis_name": name}
+	desc := func(metric, help string) *prometheus.Desc {
+		return prometheus.NewDesc("redis_pool_"+metric, help, nil, labels)
+	}
+	return &poolCollector{
+		client:   client,
+		hits:     desc("hits_total", "Number of times a free connection was found in the pool."),
+		misses:   desc("misses_total", "Number of times a free connection was not found in the pool."),
+		timeouts: desc("timeouts_total", "Number of times waiting for a connection timed out."),
+		stale:    desc("stale_connections_total", "Number of stale connections removed from the pool."),
+		total:    desc("connections", "Number of connections in the pool."),
+		idle:     desc("idle_connections", "Number of idle connections in the pool."),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.timeouts
+	ch <- c.stale
+	ch <- c.total
+	ch <- c.idle
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.client.PoolStats()
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(s.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(s.Misses))
+	ch <- prometheus.MustNewConstMetric(c.timeouts, prometheus.CounterValue, float64(s.Timeouts))
+	ch <- prometheus.MustNewConstMetric(c.stale, prometheus.CounterValue, float64(s.StaleConns))
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(s.TotalConns))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(s.IdleConns))
+}
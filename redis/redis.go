@@ -0,0 +1,142 @@
+// Package redis creates go-redis clients configured the same way in
+// every service: traced, logged, measured and health checked. The
+// clients back the cache and rate limit stores.
+//
+//	var cfg redis.Config
+//	config.Load(&cfg)
+//	client, err := redis.NewClient(cfg, redis.Logger(logger), redis.Tracer(tracer), redis.Health(registry))
+//	store := cache.NewRedisStore(client, "myservice:")
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"github.com/jdotw/go-utils/health"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/secrets"
+	"github.com/opentracing/opentracing-go"
+	"github.com/prometheus/client_golang/prometheus"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// Config configures a client. Its tags allow loading it with the config
+// package.
+type Config struct {
+	// Name labels the client's metrics and health check.
+	Name     string `json:"name" env:"REDIS_NAME" default:"default"`
+	Addr     string `json:"addr" env:"REDIS_ADDR" default:"localhost:6379"`
+	Username string `json:"username" env:"REDIS_USERNAME"`
+	Password string `json:"password" env:"REDIS_PASSWORD"`
+	DB       int    `json:"db" env:"REDIS_DB"`
+	TLS      bool   `json:"tls" env:"REDIS_TLS"`
+
+	PoolSize     int           `json:"pool_size" env:"REDIS_POOL_SIZE" default:"10"`
+	MinIdleConns int           `json:"min_idle_conns" env:"REDIS_MIN_IDLE_CONNS"`
+	DialTimeout  time.Duration `json:"dial_timeout" env:"REDIS_DIAL_TIMEOUT" default:"5s"`
+	ReadTimeout  time.Duration `json:"read_timeout" env:"REDIS_READ_TIMEOUT" default:"3s"`
+	WriteTimeout time.Duration `json:"write_timeout" env:"REDIS_WRITE_TIMEOUT" default:"3s"`
+}
+
+type options struct {
+	logger     log.Factory
+	tracer     opentracing.Tracer
+	registerer prometheus.Registerer
+	health     *health.Registry
+	secrets    secrets.Provider
+	secretName string
+}
+
+// Option configures NewClient.
+type Option func(*options)
+
+// Logger logs failed commands.
+func Logger(logger log.Factory) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// Tracer traces every command and pipeline.
+func Tracer(tracer opentracing.Tracer) Option {
+	return func(o *options) {
+		o.tracer = tracer
+	}
+}
+
+// Metrics registers connection pool metrics. A nil registerer uses
+// prometheus.DefaultRegisterer.
+func Metrics(registerer prometheus.Registerer) Option {
+	return func(o *options) {
+		if registerer == nil {
+			registerer = prometheus.DefaultRegisterer
+		}
+		o.registerer = registerer
+	}
+}
+
+// Health registers a readiness check pinging the server.
+func Health(registry *health.Registry) Option {
+	return func(o *options) {
+		o.health = registry
+	}
+}
+
+// PasswordSecret reads the password from a secret rather than
+// Config.Password.
+func PasswordSecret(provider secrets.Provider, name string) Option {
+	return func(o *options) {
+		o.secrets = provider
+		o.secretName = name
+	}
+}
+
+// NewClient returns a client for cfg. Connections are made lazily, so
+// an unreachable server fails commands and the health check rather than
+// NewClient.
+func NewClient(cfg Config, opts ...Option) (*goredis.Client, error) {
+	o := options{logger: log.NewMockLogFactory(), tracer: opentracing.NoopTracer{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	password := cfg.Password
+	if o.secrets != nil {
+		var err error
+		if password, err = secrets.String(context.Background(), o.secrets, o.secretName); err != nil {
+			return nil, fmt.Errorf("redis: read password: %w", err)
+		}
+	}
+
+	ro := &goredis.Options{
+		Addr:         cfg.Addr,
+		Username:     cfg.Username,
+		Password:     password,
+		DB:           cfg.DB,
+		PoolSize:     cfg.PoolSize,
+		MinIdleConns: cfg.MinIdleConns,
+		DialTimeout:  cfg.DialTimeout,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+	}
+	if cfg.TLS {
+		ro.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	client := goredis.NewClient(ro)
+	client.AddHook(&hook{tracer: o.tracer, logger: o.logger, addr: cfg.Addr, db: cfg.DB})
+
+	if o.registerer != nil {
+		err := o.registerer.Register(newPoolCollector(client, cfg.Name))
+		if _, ok := err.(prometheus.AlreadyRegisteredError); err != nil && !ok {
+			client.Close()
+			return nil, err
+		}
+	}
+	if o.health != nil {
+		o.health.Register("redis:"+cfg.Name, func(ctx context.Context) error {
+			return client.Ping(ctx).Err()
+		})
+	}
+	return client, nil
+}
@@ -0,0 +1,81 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jdotw/go-utils/health"
+	"github.com/jdotw/go-utils/log"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/prometheus/client_golang/prometheus"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+func TestHook(t *testing.T) {
+	tracer := mocktracer.New()
+	h := &hook{tracer: tracer, logger: log.NewMockLogFactory(), addr: "localhost:6379"}
+	parent := tracer.StartSpan("request")
+	ctx := opentracing.ContextWithSpan(context.Background(), parent)
+
+	errFailed := errors.New("connection reset")
+	results := []error{nil, goredis.Nil, errFailed}
+	for _, result := range results {
+		process := h.ProcessHook(func(context.Context, goredis.Cmder) error { return result })
+		if err := process(ctx, goredis.NewStringCmd(ctx, "get", "key")); err != result {
+			t.Errorf("expected %v, got %v", result, err)
+		}
+	}
+	pipeline := h.ProcessPipelineHook(func(context.Context, []goredis.Cmder) error { return nil })
+	pipeline(ctx, []goredis.Cmder{goredis.NewStatusCmd(ctx, "set", "a", 1), goredis.NewIntCmd(ctx, "incr", "b")})
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 4 {
+		t.Fatalf("expected 4 spans, got %d", len(spans))
+	}
+	for i, expected := range []bool{false, false, true} {
+		failed := spans[i].Tag("error") == true
+		if spans[i].OperationName != "redis.get" || failed != expected {
+			t.Errorf("span %d: unexpected %s with tags %v", i, spans[i].OperationName, spans[i].Tags())
+		}
+		if spans[i].ParentID != parent.(*mocktracer.MockSpan).SpanContext.SpanID {
+			t.Errorf("span %d should be a child of the request span", i)
+		}
+	}
+	if spans[3].OperationName != "redis.pipeline" || spans[3].Tag("db.statement") != "set incr" {
+		t.Errorf("unexpected pipeline span %s with tags %v", spans[3].OperationName, spans[3].Tags())
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	// Reserve an address nothing listens on
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	registry := health.NewRegistry()
+	registerer := prometheus.NewRegistry()
+	cfg := Config{Name: "test", Addr: addr, PoolSize: 1, DialTimeout: time.Second}
+	client, err := NewClient(cfg, Health(registry), Metrics(registerer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if report := registry.Run(context.Background(), health.Readiness); report.Checks["redis:test"].Status == "ok" {
+		t.Errorf("expected a failing redis check, got %+v", report)
+	}
+	families, err := registerer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 6 {
+		t.Errorf("expected 6 pool metrics, got %d", len(families))
+	}
+}
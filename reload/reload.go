@@ -0,0 +1,221 @@
+// Package reload refreshes a running service's configuration without a
+// restart. Subsystems implement Reloadable and are registered with a
+// Reloader, which reloads them all on SIGHUP, when a watched config file
+// changes, or when Reload is called. Each subsystem loads and checks its
+// new configuration before swapping it in, so a bad change leaves it
+// running with the previous one.
+//
+//	levels := log.NewLevelReloader(logger, func(ctx context.Context) (map[string]zapcore.Level, error) {
+//		var cfg Config
+//		err := config.Load(&cfg, config.Files("config.yaml"))
+//		return cfg.LogLevels, err
+//	})
+//	r := reload.New(logger, reload.WatchFiles(10*time.Second, "config.yaml"))
+//	r.Register("log", levels)
+//	r.Register("flags", flags)
+//	r.Register("jwks", &authenticator)
+//	go r.Run(ctx)
+package reload
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jdotw/go-utils/clock"
+	"github.com/jdotw/go-utils/log"
+	"go.uber.org/zap"
+)
+
+// Reloadable is implemented by subsystems whose configuration can be
+// refreshed at runtime. Reload loads the new configuration and swaps it
+// in atomically, keeping the current one if anything fails.
+type Reloadable interface {
+	Reload(ctx context.Context) error
+}
+
+// Func adapts a function to a Reloadable.
+type Func func(ctx context.Context) error
+
+// Reload implements Reloadable.
+func (f Func) Reload(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Error is returned by Reloader.Reload when subsystems fail to reload,
+// with each failure keyed by the subsystem's name.
+type Error map[string]error
+
+func (e Error) Error() string {
+	msgs := make([]string, 0, len(e))
+	for name, err := range e {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", name, err))
+	}
+	sort.Strings(msgs)
+	return "reload failed: " + strings.Join(msgs, "; ")
+}
+
+type options struct {
+	signals  []os.Signal
+	files    []string
+	interval time.Duration
+	clock    clock.Clock
+}
+
+// Option configures a Reloader.
+type Option func(*options)
+
+// Signals overrides the signals that trigger a reload, which default to
+// SIGHUP. No signals leaves reloads to file changes and Reload.
+func Signals(signals ...os.Signal) Option {
+	return func(o *options) {
+		o.signals = signals
+	}
+}
+
+// WatchFiles reloads when any of files is modified, created or removed,
+// checking every interval. Editors and config map updates that replace a
+// file are seen as modifications.
+func WatchFiles(interval time.Duration, files ...string) Option {
+	return func(o *options) {
+		o.interval = interval
+		o.files = append(o.files, files...)
+	}
+}
+
+// WithClock makes the Reloader poll watched files on c rather than the
+// system clock.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+type subsystem struct {
+	name string
+	r    Reloadable
+}
+
+// Reloader reloads registered subsystems together.
+type Reloader struct {
+	logger log.Factory
+	opts   options
+
+	mu         sync.Mutex
+	subsystems []subsystem
+}
+
+// New returns a Reloader with no subsystems registered.
+func New(logger log.Factory, opts ...Option) *Reloader {
+	o := options{
+		signals: []os.Signal{syscall.SIGHUP},
+		clock:   clock.New(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Reloader{logger: logger, opts: o}
+}
+
+// Register adds r to the subsystems reloaded, under name. Subsystems are
+// reloaded in the order they are registered.
+func (rl *Reloader) Register(name string, r Reloadable) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.subsystems = append(rl.subsystems, subsystem{name: name, r: r})
+}
+
+// Reload reloads every subsystem, one reload at a time. A subsystem
+// failing doesn't stop the others reloading; the failures are logged
+// and returned as an Error.
+func (rl *Reloader) Reload(ctx context.Context) error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	failed := Error{}
+	for _, s := range rl.subsystems {
+		if err := s.r.Reload(ctx); err != nil {
+			rl.logger.For(ctx).Error("Failed to reload, keeping previous configuration", zap.String("subsystem", s.name), zap.Error(err))
+			failed[s.name] = err
+			continue
+		}
+		rl.logger.For(ctx).Info("Reloaded configuration", zap.String("subsystem", s.name))
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// Run reloads on the configured signals and file changes until ctx is
+// done, then returns nil.
+func (rl *Reloader) Run(ctx context.Context) error {
+	sigc := make(chan os.Signal, 1)
+	if len(rl.opts.signals) > 0 {
+		signal.Notify(sigc, rl.opts.signals...)
+		defer signal.Stop(sigc)
+	}
+
+	var tick <-chan time.Time
+	var files map[string]fileState
+	if len(rl.opts.files) > 0 && rl.opts.interval > 0 {
+		files = statFiles(rl.opts.files)
+		tick = rl.opts.clock.After(rl.opts.interval)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case sig := <-sigc:
+			rl.logger.Bg().Info("Reloading configuration", zap.Stringer("signal", sig))
+			rl.Reload(ctx)
+		case <-tick:
+			current := statFiles(rl.opts.files)
+			if changed := changedFiles(files, current); len(changed) > 0 {
+				rl.logger.Bg().Info("Reloading configuration", zap.Strings("changed", changed))
+				rl.Reload(ctx)
+			}
+			files = current
+			tick = rl.opts.clock.After(rl.opts.interval)
+		}
+	}
+}
+
+// fileState is what a watched file looked like when last checked.
+// Missing files are left out of the states.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFiles(paths []string) map[string]fileState {
+	states := make(map[string]fileState, len(paths))
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			states[path] = fileState{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return states
+}
+
+func changedFiles(before, after map[string]fileState) []string {
+	var changed []string
+	for path, s := range after {
+		if prev, ok := before[path]; !ok || !prev.modTime.Equal(s.modTime) || prev.size != s.size {
+			changed = append(changed, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,120 @@
+package reload
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jdotw/go-utils/clock"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/tracing"
+)
+
+func TestReload(t *testing.T) {
+	rate := 0.5
+	sampler, err := tracing.NewSampler(1, func(context.Context) (float64, error) { return rate, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	failure := errors.New("policy does not compile")
+	var order []string
+	r := New(log.NewMockLogFactory())
+	r.Register("tracing", sampler)
+	r.Register("opa", Func(func(context.Context) error {
+		order = append(order, "opa")
+		return failure
+	}))
+	r.Register("flags", Func(func(context.Context) error {
+		order = append(order, "flags")
+		return nil
+	}))
+
+	err = r.Reload(context.Background())
+	var reloadErr Error
+	if !errors.As(err, &reloadErr) || len(reloadErr) != 1 || reloadErr["opa"] != failure {
+		t.Fatalf("expected only opa to fail, got %v", err)
+	}
+	if len(order) != 2 || order[1] != "flags" {
+		t.Errorf("expected every subsystem to reload in order, got %v", order)
+	}
+	if sampler.Rate() != 0.5 {
+		t.Errorf("expected the sampling rate to be reloaded, got %v", sampler.Rate())
+	}
+
+	rate = 2
+	if err := r.Reload(context.Background()); err == nil {
+		t.Error("expected an invalid sampling rate to fail")
+	}
+	if sampler.Rate() != 0.5 {
+		t.Errorf("expected the previous sampling rate to be kept, got %v", sampler.Rate())
+	}
+}
+
+func TestRunWatchesFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte("level: info\n"), 0600)
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	r := New(log.NewMockLogFactory(), Signals(), WatchFiles(time.Second, path), WithClock(clk))
+	reloads := make(chan struct{}, 1)
+	r.Register("log", Func(func(context.Context) error {
+		reloads <- struct{}{}
+		return nil
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- r.Run(ctx) }()
+
+	clk.BlockUntil(1)
+	clk.Advance(time.Second)
+	clk.BlockUntil(1)
+	select {
+	case <-reloads:
+		t.Fatal("expected no reload while the file is unchanged")
+	default:
+	}
+
+	os.WriteFile(path, []byte("level: debug\n"), 0600)
+	clk.Advance(time.Second)
+	select {
+	case <-reloads:
+	case <-time.After(time.Second):
+		t.Fatal("expected a reload after the file changed")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("expected Run to return nil, got %v", err)
+	}
+}
+
+func TestRunReloadsOnSignal(t *testing.T) {
+	r := New(log.NewMockLogFactory(), Signals(syscall.SIGUSR1))
+	reloads := make(chan struct{}, 1)
+	r.Register("jwks", Func(func(context.Context) error {
+		reloads <- struct{}{}
+		return nil
+	}))
+	// Catch the signal here too, as its default action exits
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGUSR1)
+	defer signal.Stop(sigc)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+
+	// Run may not have subscribed to the signal yet, so keep sending it
+	for {
+		syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+		select {
+		case <-reloads:
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package retry
+
+import "sync"
+
+// Budget limits retries to a share of calls, like gRPC's retry
+// throttling. It holds up to max tokens, starting full. Each failed call
+// takes a token and each successful one returns ratio of a token, and
+// retries are allowed while more than half the tokens remain. While a
+// dependency is healthy, this allows roughly one retry per 1/ratio calls;
+// while it is down, retries stop after a few failures.
+type Budget struct {
+	mu     sync.Mutex
+	max    float64
+	ratio  float64
+	tokens float64
+}
+
+// NewBudget returns a full Budget of max tokens, refilled by ratio of a
+// token per successful call.
+func NewBudget(max, ratio float64) *Budget {
+	return &Budget{max: max, ratio: ratio, tokens: max}
+}
+
+func (b *Budget) record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if success {
+		b.tokens += b.ratio
+		if b.tokens > b.max {
+			b.tokens = b.max
+		}
+		return
+	}
+	b.tokens--
+	if b.tokens < 0 {
+		b.tokens = 0
+	}
+}
+
+func (b *Budget) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens > b.max/2
+}
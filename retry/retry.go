@@ -0,0 +1,254 @@
+// Package retry retries failed operations with exponential backoff and
+// jitter. A Policy says how often and how long to wait, a Classifier
+// which errors are worth retrying, and a Budget caps retries across
+// calls so a struggling dependency isn't buried under them. The same
+// types configure the endpoint middleware, the OPA client and outbound
+// HTTP clients.
+//
+//	policy := retry.DefaultPolicy()
+//	err := retry.Do(ctx, policy, func(ctx context.Context) error {
+//		return callInventory(ctx)
+//	}, retry.WithBudget(retry.NewBudget(10, 0.1)))
+//
+//	endpoint = retry.NewMiddleware(policy, logger)(endpoint)
+package retry
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/jdotw/go-utils/log"
+	"go.uber.org/zap"
+)
+
+// Policy configures retries. Its tags allow loading it with the config
+// package.
+type Policy struct {
+	// MaxAttempts is the number of attempts, including the first. One
+	// disables retries.
+	MaxAttempts int `json:"max_attempts" default:"3" validate:"min=1"`
+	// InitialBackoff is the wait before the first retry.
+	InitialBackoff time.Duration `json:"initial_backoff" default:"100ms"`
+	// MaxBackoff caps the wait between attempts.
+	MaxBackoff time.Duration `json:"max_backoff" default:"5s"`
+	// Multiplier grows the wait after each retry.
+	Multiplier float64 `json:"multiplier" default:"2" validate:"min=1"`
+	// Jitter randomizes each wait by up to this fraction of it, so
+	// clients that failed together don't retry together.
+	Jitter float64 `json:"jitter" default:"0.2" validate:"min=0,max=1"`
+}
+
+// DefaultPolicy returns the policy with the defaults in its tags.
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts:    3,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// Backoff returns the wait after the given failed attempt, counting from
+// one, before jitter.
+func (p Policy) Backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	d := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		return p.MaxBackoff
+	}
+	return time.Duration(d)
+}
+
+// wait returns the jittered wait after the given failed attempt.
+func (p Policy) wait(attempt int) time.Duration {
+	d := p.Backoff(attempt)
+	if p.Jitter > 0 && d > 0 {
+		delta := p.Jitter * float64(d)
+		d = time.Duration(float64(d) - delta + rand.Float64()*2*delta)
+	}
+	return d
+}
+
+// Classifier reports whether err is worth retrying.
+type Classifier func(err error) bool
+
+// statusCoder is implemented by errors that map to an HTTP status, like
+// go-kit's StatusCoder.
+type statusCoder interface {
+	StatusCode() int
+}
+
+// retryAfterer is implemented by errors that know when to retry, like
+// transport.RetryAfterer.
+type retryAfterer interface {
+	RetryAfter() time.Duration
+}
+
+// ErrPermanent wraps errors that must not be retried, whatever the
+// classifier says.
+var ErrPermanent = errors.New("permanent error")
+
+// permanentError marks an error as not retryable.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+func (e *permanentError) Is(target error) bool {
+	return target == ErrPermanent
+}
+
+// Permanent marks err as not retryable.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// DefaultClassifier retries everything except cancellation, errors
+// marked Permanent and errors with an HTTP status other than 408, 429,
+// 502, 503 and 504.
+func DefaultClassifier(err error) bool {
+	if errors.Is(err, ErrPermanent) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var sc statusCoder
+	if errors.As(err, &sc) {
+		return RetryableStatus(sc.StatusCode())
+	}
+	return true
+}
+
+// RetryableStatus reports whether a response with the HTTP status code
+// is worth retrying.
+func RetryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+type options struct {
+	classify Classifier
+	budget   *Budget
+	onRetry  func(ctx context.Context, attempt int, err error, wait time.Duration)
+}
+
+// Option configures Do and the middleware.
+type Option func(*options)
+
+// Classify decides which errors are retried. It defaults to
+// DefaultClassifier.
+func Classify(c Classifier) Option {
+	return func(o *options) {
+		o.classify = c
+	}
+}
+
+// WithBudget limits retries with b, which is usually shared by every
+// caller of a dependency.
+func WithBudget(b *Budget) Option {
+	return func(o *options) {
+		o.budget = b
+	}
+}
+
+// OnRetry is called before waiting to retry a failed attempt.
+func OnRetry(f func(ctx context.Context, attempt int, err error, wait time.Duration)) Option {
+	return func(o *options) {
+		o.onRetry = f
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{classify: DefaultClassifier}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Do calls fn until it succeeds, fails with an error that isn't
+// retryable, the policy's attempts or the budget run out, or ctx is done.
+// It returns fn's last error. Errors that carry a retry hint, such as
+// rate limit errors, wait at least as long as the hint.
+func Do(ctx context.Context, policy Policy, fn func(ctx context.Context) error, opts ...Option) error {
+	o := newOptions(opts)
+	return do(ctx, policy, o, fn)
+}
+
+func do(ctx context.Context, policy Policy, o options, fn func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if o.budget != nil {
+			o.budget.record(err == nil)
+		}
+		if err == nil {
+			return nil
+		}
+		if attempt >= policy.MaxAttempts || !o.classify(err) {
+			return err
+		}
+		if o.budget != nil && !o.budget.allow() {
+			return err
+		}
+
+		wait := policy.wait(attempt)
+		var ra retryAfterer
+		if errors.As(err, &ra) && ra.RetryAfter() > wait {
+			wait = ra.RetryAfter()
+		}
+		if o.onRetry != nil {
+			o.onRetry(ctx, attempt, err, wait)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// NewMiddleware returns endpoint middleware retrying the endpoint by
+// policy. Only idempotent endpoints should be retried.
+func NewMiddleware(policy Policy, logger log.Factory, opts ...Option) endpoint.Middleware {
+	o := newOptions(opts)
+	onRetry := o.onRetry
+	o.onRetry = func(ctx context.Context, attempt int, err error, wait time.Duration) {
+		log.Warn(logger.For(ctx), "Retrying failed request", zap.Int("attempt", attempt), zap.Duration("wait", wait), zap.Error(err))
+		if onRetry != nil {
+			onRetry(ctx, attempt, err, wait)
+		}
+	}
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			err = do(ctx, policy, o, func(ctx context.Context) error {
+				var err error
+				response, err = next(ctx, request)
+				return err
+			})
+			return response, err
+		}
+	}
+}
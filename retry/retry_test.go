@@ -0,0 +1,172 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jdotw/go-utils/log"
+)
+
+type statusError int
+
+func (e statusError) Error() string   { return http.StatusText(int(e)) }
+func (e statusError) StatusCode() int { return int(e) }
+
+type throttledError time.Duration
+
+func (e throttledError) Error() string             { return "throttled" }
+func (e throttledError) RetryAfter() time.Duration { return time.Duration(e) }
+
+func fastPolicy(attempts int) Policy {
+	return Policy{MaxAttempts: attempts, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, Multiplier: 2}
+}
+
+func TestBackoff(t *testing.T) {
+	p := DefaultPolicy()
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond}
+	for i, d := range expected {
+		if b := p.Backoff(i + 1); b != d {
+			t.Errorf("attempt %d: expected %s, got %s", i+1, d, b)
+		}
+	}
+	if b := p.Backoff(20); b != p.MaxBackoff {
+		t.Errorf("expected backoff capped at %s, got %s", p.MaxBackoff, b)
+	}
+	for i := 0; i < 100; i++ {
+		if w := p.wait(1); w < 80*time.Millisecond || w > 120*time.Millisecond {
+			t.Fatalf("expected jitter within 20%%, got %s", w)
+		}
+	}
+}
+
+func TestDefaultClassifier(t *testing.T) {
+	tests := map[error]bool{
+		errors.New("connection reset"):              true,
+		statusError(http.StatusServiceUnavailable):  true,
+		statusError(http.StatusTooManyRequests):     true,
+		statusError(http.StatusBadRequest):          false,
+		statusError(http.StatusInternalServerError): false,
+		Permanent(errors.New("invalid")):            false,
+		context.Canceled:                            false,
+	}
+	for err, expected := range tests {
+		if retryable := DefaultClassifier(err); retryable != expected {
+			t.Errorf("%v: expected %v, got %v", err, expected, retryable)
+		}
+	}
+}
+
+func TestDo(t *testing.T) {
+	attempts := 0
+	err := Do(context.Background(), fastPolicy(3), func(ctx context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("connection reset")
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Errorf("expected success on the third attempt, got %v after %d", err, attempts)
+	}
+
+	// Attempts run out
+	errFailed := errors.New("connection reset")
+	attempts = 0
+	err = Do(context.Background(), fastPolicy(3), func(ctx context.Context) error {
+		attempts++
+		return errFailed
+	})
+	if err != errFailed || attempts != 3 {
+		t.Errorf("expected the last error after 3 attempts, got %v after %d", err, attempts)
+	}
+
+	// Errors that aren't retryable
+	attempts = 0
+	err = Do(context.Background(), fastPolicy(3), func(ctx context.Context) error {
+		attempts++
+		return statusError(http.StatusNotFound)
+	})
+	if attempts != 1 {
+		t.Errorf("expected no retries of a 404, got %d attempts", attempts)
+	}
+
+	// Custom classification
+	attempts = 0
+	Do(context.Background(), fastPolicy(3), func(ctx context.Context) error {
+		attempts++
+		return statusError(http.StatusNotFound)
+	}, Classify(func(error) bool { return true }))
+	if attempts != 3 {
+		t.Errorf("expected the classifier to allow retries, got %d attempts", attempts)
+	}
+}
+
+func TestDoRetryAfter(t *testing.T) {
+	var waits []time.Duration
+	attempts := 0
+	Do(context.Background(), fastPolicy(2), func(ctx context.Context) error {
+		attempts++
+		return throttledError(20 * time.Millisecond)
+	}, OnRetry(func(ctx context.Context, attempt int, err error, wait time.Duration) {
+		waits = append(waits, wait)
+	}))
+	if len(waits) != 1 || waits[0] != 20*time.Millisecond {
+		t.Errorf("expected to wait for the retry hint, waited %v", waits)
+	}
+}
+
+func TestDoContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := Policy{MaxAttempts: 5, InitialBackoff: time.Hour}
+	attempts := 0
+	errFailed := errors.New("connection reset")
+	err := Do(ctx, policy, func(ctx context.Context) error {
+		attempts++
+		cancel()
+		return errFailed
+	})
+	if err != errFailed || attempts != 1 {
+		t.Errorf("expected cancellation to stop retries, got %v after %d attempts", err, attempts)
+	}
+}
+
+func TestBudget(t *testing.T) {
+	b := NewBudget(4, 0.5)
+	attempts := 0
+	fail := func(ctx context.Context) error {
+		attempts++
+		return errors.New("connection reset")
+	}
+
+	// Two failures leave half the tokens, so the third attempt isn't made
+	Do(context.Background(), fastPolicy(10), fail, WithBudget(b))
+	if attempts != 2 {
+		t.Errorf("expected the budget to stop retries after 2 attempts, got %d", attempts)
+	}
+
+	// Successes refill the budget
+	for i := 0; i < 4; i++ {
+		b.record(true)
+	}
+	if !b.allow() {
+		t.Error("expected successes to refill the budget")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	attempts := 0
+	next := func(ctx context.Context, request interface{}) (interface{}, error) {
+		attempts++
+		if attempts == 1 {
+			return nil, statusError(http.StatusServiceUnavailable)
+		}
+		return "ok", nil
+	}
+	response, err := NewMiddleware(fastPolicy(3), log.NewMockLogFactory())(next)(context.Background(), nil)
+	if err != nil || response != "ok" || attempts != 2 {
+		t.Errorf("expected success on the second attempt, got %v, %v after %d", response, err, attempts)
+	}
+}
@@ -0,0 +1,252 @@
+// Package saga orchestrates operations spanning several services as a
+// sequence of steps, each with a compensation that undoes it. If a step
+// fails, the steps before it are compensated in reverse order. Progress
+// is saved after every step, so a saga interrupted by a crash is resumed
+// by Resume:
+//
+//	orders := saga.New("place-order", saga.NewGormStore(db), logger, tracer, []saga.Step[PlaceOrder]{
+//		{Name: "reserve-stock", Do: reserveStock, Compensate: releaseStock},
+//		{Name: "charge-card", Do: chargeCard, Compensate: refundCard},
+//		{Name: "confirm-order", Do: confirmOrder},
+//	})
+//	id, err := orders.Start(ctx, PlaceOrder{OrderID: order.ID})
+//
+//	// At startup and periodically
+//	err := orders.Resume(ctx)
+//
+// A step may run more than once if the process stops before its
+// progress is saved, so steps and compensations must be idempotent.
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/model"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"go.uber.org/zap"
+)
+
+// ErrCompensationFailed is returned when a compensation fails. The
+// instance stays Compensating and Resume retries it.
+var ErrCompensationFailed = errors.New("saga compensation failed")
+
+// Step is one step of a saga over data of type T. Do may update data;
+// the updated data is saved and passed to later steps and to
+// compensations.
+type Step[T any] struct {
+	Name string
+	Do   func(ctx context.Context, data *T) error
+	// Compensate undoes Do. It may be nil for steps with nothing to undo,
+	// typically the last.
+	Compensate func(ctx context.Context, data *T) error
+}
+
+// Option configures a Saga.
+type Option func(*options)
+
+type options struct {
+	staleAfter time.Duration
+}
+
+// StaleAfter is how long an unfinished instance goes without progress
+// before Resume takes it over. It must exceed the longest step. It
+// defaults to a minute.
+func StaleAfter(d time.Duration) Option {
+	return func(o *options) {
+		o.staleAfter = d
+	}
+}
+
+// Saga is a named sequence of steps over data of type T.
+type Saga[T any] struct {
+	name   string
+	steps  []Step[T]
+	store  Store
+	logger log.Factory
+	tracer opentracing.Tracer
+	opts   options
+	now    func() time.Time
+}
+
+// New returns a Saga called name, which identifies its instances in
+// store, so it must be stable across releases, as must the order of
+// steps.
+func New[T any](name string, store Store, logger log.Factory, tracer opentracing.Tracer, steps []Step[T], opts ...Option) *Saga[T] {
+	o := options{staleAfter: time.Minute}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Saga[T]{name: name, steps: steps, store: store, logger: logger, tracer: tracer, opts: o, now: time.Now}
+}
+
+// Start saves a new instance over data and runs it. It returns the
+// instance ID, and the error of the step that failed, wrapped, if the
+// saga was compensated.
+func (s *Saga[T]) Start(ctx context.Context, data T) (string, error) {
+	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "saga:"+s.name)
+	defer span.Finish()
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	trace := map[string]string{}
+	s.tracer.Inject(span.Context(), opentracing.TextMap, opentracing.TextMapCarrier(trace))
+	inst := &Instance{
+		ID:     model.NewUUIDv7(),
+		Saga:   s.name,
+		Status: Running,
+		Data:   b,
+		Trace:  model.NewJSONB(trace),
+	}
+	span.SetTag("saga.id", inst.ID)
+	if err := s.store.Create(ctx, inst); err != nil {
+		return "", err
+	}
+	return inst.ID, s.execute(ctx, span, inst, data)
+}
+
+// Resume runs the instances of s left unfinished by a stopped process.
+// Each is taken over by one caller, so every replica may call Resume.
+// It returns the first store or compensation error; failed sagas that
+// were compensated are not errors.
+func (s *Saga[T]) Resume(ctx context.Context) error {
+	insts, err := s.store.Stale(ctx, s.name, s.now().Add(-s.opts.staleAfter))
+	if err != nil {
+		return err
+	}
+	var first error
+	for i := range insts {
+		inst := &insts[i]
+		ok, err := s.store.Claim(ctx, inst)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := s.resume(ctx, inst); err != nil && first == nil && !errors.As(err, new(*StepError)) {
+			first = err
+		}
+	}
+	return first
+}
+
+func (s *Saga[T]) resume(ctx context.Context, inst *Instance) error {
+	var opts []opentracing.StartSpanOption
+	if sc, err := s.tracer.Extract(opentracing.TextMap, opentracing.TextMapCarrier(inst.Trace.Val)); err == nil {
+		opts = append(opts, opentracing.FollowsFrom(sc))
+	}
+	span := s.tracer.StartSpan("saga:"+s.name+":resume", opts...)
+	defer span.Finish()
+	span.SetTag("saga.id", inst.ID)
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	var data T
+	if err := inst.decode(&data); err != nil {
+		return fmt.Errorf("saga %s: decode instance %s: %w", s.name, inst.ID, err)
+	}
+	s.logger.For(ctx).Info("Resuming saga", zap.String("saga", s.name), zap.String("saga_id", inst.ID),
+		zap.String("status", string(inst.Status)), zap.Int("step", inst.Step))
+	return s.execute(ctx, span, inst, data)
+}
+
+// StepError is returned when a step failed and the saga was
+// compensated.
+type StepError struct {
+	Saga string
+	Step string
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("saga %s: step %s: %v", e.Saga, e.Step, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// execute runs inst from where it is, saving progress after each step.
+func (s *Saga[T]) execute(ctx context.Context, span opentracing.Span, inst *Instance, data T) error {
+	var failed error
+	for inst.Status == Running && inst.Step < len(s.steps) {
+		step := s.steps[inst.Step]
+		if err := s.runStep(ctx, step.Name, func(ctx context.Context) error { return step.Do(ctx, &data) }); err != nil {
+			s.logger.For(ctx).Error("Saga step failed, compensating", zap.String("saga", s.name),
+				zap.String("saga_id", inst.ID), zap.String("step", step.Name), zap.Error(err))
+			failed = &StepError{Saga: s.name, Step: step.Name, Err: err}
+			inst.Status = Compensating
+			inst.FailedStep = step.Name
+			inst.Error = err.Error()
+			inst.Step--
+		} else {
+			inst.Step++
+		}
+		if err := s.save(ctx, inst, data); err != nil {
+			return err
+		}
+	}
+	if inst.Status == Running {
+		inst.Status = Completed
+		return s.store.Update(ctx, inst)
+	}
+
+	for inst.Status == Compensating && inst.Step >= 0 {
+		step := s.steps[inst.Step]
+		if step.Compensate != nil {
+			if err := s.runStep(ctx, step.Name+":compensate", func(ctx context.Context) error { return step.Compensate(ctx, &data) }); err != nil {
+				s.logger.For(ctx).Error("Saga compensation failed", zap.String("saga", s.name),
+					zap.String("saga_id", inst.ID), zap.String("step", step.Name), zap.Error(err))
+				ext.Error.Set(span, true)
+				return fmt.Errorf("%w: saga %s: step %s: %v", ErrCompensationFailed, s.name, step.Name, err)
+			}
+		}
+		inst.Step--
+		if err := s.save(ctx, inst, data); err != nil {
+			return err
+		}
+	}
+	inst.Status = Compensated
+	if err := s.store.Update(ctx, inst); err != nil {
+		return err
+	}
+	ext.Error.Set(span, true)
+	if failed == nil {
+		// Compensation resumed after a restart
+		failed = &StepError{Saga: s.name, Step: inst.FailedStep, Err: errors.New(inst.Error)}
+	}
+	return failed
+}
+
+func (s *Saga[T]) save(ctx context.Context, inst *Instance, data T) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	inst.Data = b
+	return s.store.Update(ctx, inst)
+}
+
+// runStep runs fn in a child span named after the step.
+func (s *Saga[T]) runStep(ctx context.Context, name string, fn func(ctx context.Context) error) (err error) {
+	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "saga:"+s.name+":"+name)
+	defer span.Finish()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(otlog.Error(err))
+		}
+	}()
+	return fn(ctx)
+}
@@ -0,0 +1,133 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jdotw/go-utils/log"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+type order struct {
+	Log []string
+}
+
+// recordingSteps returns steps appending to the data's log, failing at
+// the named step.
+func recordingSteps(failAt string) []Step[order] {
+	step := func(name string, compensate bool) Step[order] {
+		s := Step[order]{
+			Name: name,
+			Do: func(ctx context.Context, o *order) error {
+				if name == failAt {
+					return errors.New(name + " failed")
+				}
+				o.Log = append(o.Log, name)
+				return nil
+			},
+		}
+		if compensate {
+			s.Compensate = func(ctx context.Context, o *order) error {
+				o.Log = append(o.Log, "undo "+name)
+				return nil
+			}
+		}
+		return s
+	}
+	return []Step[order]{step("reserve", true), step("charge", true), step("confirm", false)}
+}
+
+func TestSagaCompletes(t *testing.T) {
+	store := NewMemoryStore().(*memoryStore)
+	tracer := mocktracer.New()
+	s := New("order", store, log.NewMockLogFactory(), tracer, recordingSteps(""))
+
+	id, err := s.Start(context.Background(), order{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst := store.insts[id]
+	var data order
+	inst.decode(&data)
+	if inst.Status != Completed || strings.Join(data.Log, ",") != "reserve,charge,confirm" {
+		t.Errorf("unexpected instance %s %v", inst.Status, data.Log)
+	}
+
+	spans := tracer.FinishedSpans()
+	root := spans[len(spans)-1]
+	if root.OperationName != "saga:order" || len(spans) != 4 {
+		t.Fatalf("expected a saga span and three step spans, got %d", len(spans))
+	}
+	for _, span := range spans[:3] {
+		if span.ParentID != root.SpanContext.SpanID {
+			t.Errorf("expected step span %s to be a child of the saga span", span.OperationName)
+		}
+	}
+}
+
+func TestSagaCompensates(t *testing.T) {
+	store := NewMemoryStore().(*memoryStore)
+	s := New("order", store, log.NewMockLogFactory(), mocktracer.New(), recordingSteps("confirm"))
+
+	id, err := s.Start(context.Background(), order{})
+	var stepErr *StepError
+	if !errors.As(err, &stepErr) || stepErr.Step != "confirm" {
+		t.Fatalf("expected confirm step error, got %v", err)
+	}
+	inst := store.insts[id]
+	var data order
+	inst.decode(&data)
+	want := "reserve,charge,undo charge,undo reserve"
+	if inst.Status != Compensated || strings.Join(data.Log, ",") != want {
+		t.Errorf("unexpected instance %s %v", inst.Status, data.Log)
+	}
+}
+
+func TestSagaResume(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore().(*memoryStore)
+	store.now = func() time.Time { return now }
+	tracer := mocktracer.New()
+	s := New("order", store, log.NewMockLogFactory(), tracer, recordingSteps(""), StaleAfter(time.Minute))
+	s.now = func() time.Time { return now }
+
+	// An instance interrupted after its first step
+	started := tracer.StartSpan("saga:order")
+	trace := map[string]string{}
+	tracer.Inject(started.Context(), opentracing.TextMap, opentracing.TextMapCarrier(trace))
+	started.Finish()
+	inst := &Instance{ID: "1", Saga: "order", Status: Running, Step: 1, Data: []byte(`{"Log":["reserve"]}`)}
+	inst.Trace.Val = trace
+	store.Create(context.Background(), inst)
+
+	if err := s.Resume(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if store.insts["1"].Status != Running {
+		t.Fatal("expected a recently updated instance to be left alone")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if err := s.Resume(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	resumed := store.insts["1"]
+	var data order
+	resumed.decode(&data)
+	if resumed.Status != Completed || strings.Join(data.Log, ",") != "reserve,charge,confirm" {
+		t.Errorf("unexpected instance %s %v", resumed.Status, data.Log)
+	}
+	linked := false
+	for _, span := range tracer.FinishedSpans() {
+		if span.OperationName == "saga:order:resume" {
+			linked = span.ParentID == started.Context().(mocktracer.MockSpanContext).SpanID
+		}
+	}
+	if !linked {
+		t.Error("expected a resume span following from the original saga span")
+	}
+}
@@ -0,0 +1,166 @@
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/jdotw/go-utils/model"
+	"gorm.io/gorm"
+)
+
+// Status is the state of a saga instance.
+type Status string
+
+const (
+	// Running instances are executing their steps.
+	Running Status = "running"
+	// Compensating instances are undoing the steps that completed before
+	// one failed.
+	Compensating Status = "compensating"
+	// Completed instances ran every step.
+	Completed Status = "completed"
+	// Compensated instances failed and had their steps undone.
+	Compensated Status = "compensated"
+)
+
+// Instance is the persisted state of one run of a saga. Migrate it to
+// create the saga_instances table.
+type Instance struct {
+	ID   string `json:"id" gorm:"primaryKey;type:uuid"`
+	Saga string `json:"saga" gorm:"not null;index:idx_saga_instances_pending,priority:1"`
+	// Status and Step locate the instance in its saga: the next step to
+	// run while Running, and the next to compensate while Compensating.
+	Status Status `json:"status" gorm:"not null;index:idx_saga_instances_pending,priority:2"`
+	Step   int    `json:"step"`
+	// Data is the saga's JSON encoded data after the last completed step.
+	Data []byte `json:"data"`
+	// FailedStep and Error are the step failure that triggered
+	// compensation.
+	FailedStep string `json:"failed_step"`
+	Error      string `json:"error"`
+	// Trace is the span context of the run that started the saga, linked
+	// from the spans of runs that resume it.
+	Trace     model.JSONB[map[string]string] `json:"trace"`
+	CreatedAt time.Time                      `json:"created_at"`
+	UpdatedAt time.Time                      `json:"updated_at" gorm:"index:idx_saga_instances_pending,priority:3"`
+}
+
+func (Instance) TableName() string {
+	return "saga_instances"
+}
+
+func (i *Instance) finished() bool {
+	return i.Status == Completed || i.Status == Compensated
+}
+
+func (i *Instance) decode(v interface{}) error {
+	return json.Unmarshal(i.Data, v)
+}
+
+// Store persists saga instances.
+type Store interface {
+	// Create saves a new instance.
+	Create(ctx context.Context, inst *Instance) error
+	// Update saves inst's progress, setting its UpdatedAt.
+	Update(ctx context.Context, inst *Instance) error
+	// Stale returns the unfinished instances of saga not updated since
+	// before.
+	Stale(ctx context.Context, saga string, before time.Time) ([]Instance, error)
+	// Claim takes over a stale instance by bumping its UpdatedAt,
+	// returning false if another process updated it first.
+	Claim(ctx context.Context, inst *Instance) (bool, error)
+}
+
+type gormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore returns a Store keeping instances in the saga_instances
+// table of db.
+func NewGormStore(db *gorm.DB) Store {
+	return &gormStore{db: db}
+}
+
+func (s *gormStore) Create(ctx context.Context, inst *Instance) error {
+	return s.db.WithContext(ctx).Create(inst).Error
+}
+
+func (s *gormStore) Update(ctx context.Context, inst *Instance) error {
+	return s.db.WithContext(ctx).Model(inst).Select("status", "step", "data", "failed_step", "error", "updated_at").Updates(inst).Error
+}
+
+func (s *gormStore) Stale(ctx context.Context, saga string, before time.Time) ([]Instance, error) {
+	var insts []Instance
+	err := s.db.WithContext(ctx).
+		Where("saga = ? AND status IN ? AND updated_at < ?", saga, []Status{Running, Compensating}, before).
+		Order("updated_at").Find(&insts).Error
+	return insts, err
+}
+
+func (s *gormStore) Claim(ctx context.Context, inst *Instance) (bool, error) {
+	now := time.Now()
+	res := s.db.WithContext(ctx).Model(&Instance{}).
+		Where("id = ? AND updated_at = ?", inst.ID, inst.UpdatedAt).
+		Update("updated_at", now)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return false, res.Error
+	}
+	inst.UpdatedAt = now
+	return true, nil
+}
+
+type memoryStore struct {
+	mu    sync.Mutex
+	insts map[string]Instance
+	now   func() time.Time
+}
+
+// NewMemoryStore returns a Store holding instances in process memory,
+// for tests. Instances don't survive a restart.
+func NewMemoryStore() Store {
+	return &memoryStore{insts: make(map[string]Instance), now: time.Now}
+}
+
+func (s *memoryStore) Create(_ context.Context, inst *Instance) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inst.CreatedAt = s.now()
+	inst.UpdatedAt = inst.CreatedAt
+	s.insts[inst.ID] = *inst
+	return nil
+}
+
+func (s *memoryStore) Update(_ context.Context, inst *Instance) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inst.UpdatedAt = s.now()
+	s.insts[inst.ID] = *inst
+	return nil
+}
+
+func (s *memoryStore) Stale(_ context.Context, saga string, before time.Time) ([]Instance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var insts []Instance
+	for _, inst := range s.insts {
+		if inst.Saga == saga && !inst.finished() && inst.UpdatedAt.Before(before) {
+			insts = append(insts, inst)
+		}
+	}
+	return insts, nil
+}
+
+func (s *memoryStore) Claim(_ context.Context, inst *Instance) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.insts[inst.ID]
+	if !ok || !stored.UpdatedAt.Equal(inst.UpdatedAt) {
+		return false, nil
+	}
+	stored.UpdatedAt = s.now()
+	s.insts[inst.ID] = stored
+	inst.UpdatedAt = stored.UpdatedAt
+	return true, nil
+}
@@ -0,0 +1,93 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Locker elects the replica that runs a tick of a job. Acquire reports
+// whether the caller claimed the tick, and so should run it. Because
+// ticks are claimed rather than held, a replica whose clock is a little
+// behind cannot run a tick that has already run elsewhere.
+type Locker interface {
+	Acquire(ctx context.Context, job string, tick time.Time) (bool, error)
+}
+
+// owner identifies this replica in lock records.
+func owner() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// RedisLocker claims ticks with SET NX. Claims expire after TTL.
+type RedisLocker struct {
+	client goredis.Cmdable
+	prefix string
+	owner  string
+
+	// TTL is how long a claim is kept. It must be longer than the clock
+	// skew between replicas, and defaults to an hour.
+	TTL time.Duration
+}
+
+// NewRedisLocker returns a RedisLocker storing claims under prefix.
+func NewRedisLocker(client goredis.Cmdable, prefix string) *RedisLocker {
+	return &RedisLocker{client: client, prefix: prefix, owner: owner(), TTL: time.Hour}
+}
+
+// Acquire implements Locker.
+func (l *RedisLocker) Acquire(ctx context.Context, job string, tick time.Time) (bool, error) {
+	key := fmt.Sprintf("%sscheduler:%s:%d", l.prefix, job, tick.Unix())
+	ok, err := l.client.SetNX(ctx, key, l.owner, l.TTL).Result()
+	if err != nil {
+		return false, err
+	}
+	return ok, nil
+}
+
+// Lock records the last tick of a job claimed in Postgres. Migrate it to
+// create the scheduler_locks table.
+type Lock struct {
+	Job       string    `gorm:"primaryKey"`
+	Tick      time.Time `gorm:"not null"`
+	Owner     string    `gorm:"not null"`
+	UpdatedAt time.Time
+}
+
+func (Lock) TableName() string {
+	return "scheduler_locks"
+}
+
+// PostgresLocker claims ticks by upserting the job's Lock, only when the
+// stored tick is older than the one being claimed.
+type PostgresLocker struct {
+	db    *gorm.DB
+	owner string
+}
+
+// NewPostgresLocker returns a PostgresLocker storing claims in db.
+func NewPostgresLocker(db *gorm.DB) *PostgresLocker {
+	return &PostgresLocker{db: db, owner: owner()}
+}
+
+// Acquire implements Locker.
+func (l *PostgresLocker) Acquire(ctx context.Context, job string, tick time.Time) (bool, error) {
+	lock := Lock{Job: job, Tick: tick.UTC(), Owner: l.owner}
+	result := l.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "job"}},
+		DoUpdates: clause.AssignmentColumns([]string{"tick", "owner", "updated_at"}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Lt{Column: clause.Column{Table: "scheduler_locks", Name: "tick"}, Value: clause.Column{Table: "excluded", Name: "tick"}},
+		}},
+	}).Create(&lock)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
@@ -0,0 +1,315 @@
+// Package scheduler runs cron style jobs in process. Each run gets its
+// own trace span, a run is skipped while the previous one is still going,
+// and runs can be jittered to spread load. With a Locker, replicas
+// coordinate so that only one of them runs each scheduled tick; with
+// WithLock, a job runs on only one replica at a time.
+//
+//	s := scheduler.New(logger, tracer, scheduler.WithLocker(scheduler.NewRedisLocker(client, "billing:")))
+//	s.Add("invoices", "0 * * * *", sendInvoices, scheduler.Jitter(time.Minute))
+//	s.Add("heartbeat", "@every 30s", heartbeat)
+//	err := s.Run(ctx)
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jdotw/go-utils/clock"
+	"github.com/jdotw/go-utils/lock"
+	"github.com/jdotw/go-utils/log"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+)
+
+// ErrDuplicateJob is returned when adding a job whose name is taken.
+var ErrDuplicateJob = errors.New("duplicate job name")
+
+// Job is a scheduled unit of work. Its context is cancelled when Run's
+// context is, or when the job's Timeout passes.
+type Job func(ctx context.Context) error
+
+// Schedule returns the next time a job runs after t.
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// Every is a schedule aligned to multiples of its interval since the
+// Unix epoch, so replicas agree on its ticks.
+type Every time.Duration
+
+// Next implements Schedule.
+func (e Every) Next(t time.Time) time.Time {
+	d := time.Duration(e)
+	return t.Truncate(d).Add(d)
+}
+
+// Parse parses a standard five field cron spec, a descriptor such as
+// @hourly, or "@every <duration>".
+func Parse(spec string) (Schedule, error) {
+	if s := strings.TrimPrefix(spec, "@every "); s != spec {
+		d, err := time.ParseDuration(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("invalid schedule %q: interval must be positive", spec)
+		}
+		return Every(d), nil
+	}
+	s, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+	}
+	return s, nil
+}
+
+type options struct {
+	locker   Locker
+	lock     lock.Backend
+	lockOpts []lock.Option
+	clock    clock.Clock
+}
+
+// Option configures a Scheduler.
+type Option func(*options)
+
+// WithLocker makes replicas coordinate through l, so each tick of a job
+// runs on only one of them.
+func WithLocker(l Locker) Option {
+	return func(o *options) {
+		o.locker = l
+	}
+}
+
+// WithLock makes each run hold a distributed lock named after its job,
+// renewed while it runs, so a job never runs on two replicas at once
+// even when a run outlasts its interval. A replica skips a tick while
+// another holds the lock, and a run's context is cancelled if the lock
+// is lost.
+func WithLock(backend lock.Backend, opts ...lock.Option) Option {
+	return func(o *options) {
+		o.lock = backend
+		o.lockOpts = opts
+	}
+}
+
+// WithClock makes the scheduler wait for ticks and jitter on c rather
+// than the system clock, so tests can run jobs by advancing a
+// clock.Fake.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+type jobOptions struct {
+	jitter  time.Duration
+	timeout time.Duration
+}
+
+// JobOption configures a job.
+type JobOption func(*jobOptions)
+
+// Jitter delays each run by a random duration up to d.
+func Jitter(d time.Duration) JobOption {
+	return func(o *jobOptions) {
+		o.jitter = d
+	}
+}
+
+// Timeout cancels a run's context after d.
+func Timeout(d time.Duration) JobOption {
+	return func(o *jobOptions) {
+		o.timeout = d
+	}
+}
+
+type job struct {
+	name     string
+	schedule Schedule
+	run      Job
+	opts     jobOptions
+	running  int32
+}
+
+// Scheduler runs jobs on their schedules.
+type Scheduler struct {
+	logger   log.Factory
+	tracer   opentracing.Tracer
+	locker   Locker
+	lock     lock.Backend
+	lockOpts []lock.Option
+
+	mu    sync.Mutex
+	jobs  map[string]*job
+	clock clock.Clock
+}
+
+// New returns an empty Scheduler.
+func New(logger log.Factory, tracer opentracing.Tracer, opts ...Option) *Scheduler {
+	o := options{clock: clock.New()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Scheduler{
+		logger:   logger,
+		tracer:   tracer,
+		locker:   o.locker,
+		lock:     o.lock,
+		lockOpts: append([]lock.Option{lock.Logger(logger)}, o.lockOpts...),
+		jobs:     make(map[string]*job),
+		clock:    o.clock,
+	}
+}
+
+// Add schedules fn as name on spec, as parsed by Parse. Jobs must be
+// added before Run.
+func (s *Scheduler) Add(name, spec string, fn Job, opts ...JobOption) error {
+	schedule, err := Parse(spec)
+	if err != nil {
+		return err
+	}
+	return s.AddSchedule(name, schedule, fn, opts...)
+}
+
+// AddSchedule schedules fn as name on schedule.
+func (s *Scheduler) AddSchedule(name string, schedule Schedule, fn Job, opts ...JobOption) error {
+	j := &job{name: name, schedule: schedule, run: fn}
+	for _, opt := range opts {
+		opt(&j.opts)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateJob, name)
+	}
+	s.jobs[name] = j
+	return nil
+}
+
+// Run runs the jobs until ctx is cancelled, then waits for running jobs
+// to return.
+func (s *Scheduler) Run(ctx context.Context) error {
+	s.mu.Lock()
+	jobs := make([]*job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		jobs = append(jobs, j)
+	}
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, j := range jobs {
+		wg.Add(1)
+		go func(j *job) {
+			defer wg.Done()
+			s.loop(ctx, j, &wg)
+		}(j)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// loop starts j at each tick of its schedule, skipping ticks while a
+// previous run is still going.
+func (s *Scheduler) loop(ctx context.Context, j *job, wg *sync.WaitGroup) {
+	for {
+		tick := j.schedule.Next(s.clock.Now())
+		if tick.IsZero() {
+			return
+		}
+		timer := s.clock.NewTimer(tick.Sub(s.clock.Now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+		if !atomic.CompareAndSwapInt32(&j.running, 0, 1) {
+			log.Warn(s.logger.Bg(), "Skipping job run, previous run still in progress", zap.String("job", j.name), zap.Time("tick", tick))
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer atomic.StoreInt32(&j.running, 0)
+			s.runJob(ctx, j, tick)
+		}()
+	}
+}
+
+// runJob runs the tick of j, after its jitter and once it holds the
+// tick's lock.
+func (s *Scheduler) runJob(ctx context.Context, j *job, tick time.Time) {
+	if j.opts.jitter > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.clock.After(time.Duration(rand.Int63n(int64(j.opts.jitter)))):
+		}
+	}
+
+	if s.locker != nil {
+		ok, err := s.locker.Acquire(ctx, j.name, tick)
+		if err != nil {
+			s.logger.Bg().Error("Failed to acquire job lock", zap.String("job", j.name), zap.Error(err))
+			return
+		}
+		if !ok {
+			// Another replica has the tick
+			return
+		}
+	}
+
+	if s.lock != nil {
+		lease, err := lock.NewMutex(s.lock, "scheduler:"+j.name, s.lockOpts...).TryLock(ctx)
+		if errors.Is(err, lock.ErrNotAcquired) {
+			// Another replica is running the job
+			return
+		}
+		if err != nil {
+			s.logger.Bg().Error("Failed to acquire job lock", zap.String("job", j.name), zap.Error(err))
+			return
+		}
+		defer lease.Unlock(context.Background())
+		ctx = lease.Context()
+	}
+
+	span := s.tracer.StartSpan("scheduler." + j.name)
+	defer span.Finish()
+	span.SetTag("job", j.name)
+	span.SetTag("tick", tick.UTC().Format(time.RFC3339))
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	if j.opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, j.opts.timeout)
+		defer cancel()
+	}
+
+	start := s.clock.Now()
+	if err := s.call(ctx, j); err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(otlog.Error(err))
+		s.logger.For(ctx).Error("Job failed", zap.String("job", j.name), zap.Duration("duration", s.clock.Since(start)), zap.Error(err))
+		return
+	}
+	s.logger.For(ctx).Info("Job finished", zap.String("job", j.name), zap.Duration("duration", s.clock.Since(start)))
+}
+
+func (s *Scheduler) call(ctx context.Context, j *job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.LogPanic(ctx, s.logger, r)
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return j.run(ctx)
+}
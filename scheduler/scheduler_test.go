@@ -0,0 +1,266 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jdotw/go-utils/clock"
+	"github.com/jdotw/go-utils/lock"
+	"github.com/jdotw/go-utils/log"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	goredis "github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+)
+
+func TestParse(t *testing.T) {
+	at := time.Date(2024, 3, 1, 10, 7, 30, 0, time.UTC)
+	tests := map[string]time.Time{
+		"0 * * * *":    time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC),
+		"@daily":       time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC),
+		"@every 5m":    time.Date(2024, 3, 1, 10, 10, 0, 0, time.UTC),
+		"*/15 * * * *": time.Date(2024, 3, 1, 10, 15, 0, 0, time.UTC),
+	}
+	for spec, expected := range tests {
+		s, err := Parse(spec)
+		if err != nil {
+			t.Errorf("%s: %v", spec, err)
+			continue
+		}
+		if next := s.Next(at); !next.Equal(expected) {
+			t.Errorf("%s: expected %s, got %s", spec, expected, next)
+		}
+	}
+	for _, spec := range []string{"* * *", "@every -1s", "@every soon"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("%s: expected an error", spec)
+		}
+	}
+}
+
+func TestAddDuplicate(t *testing.T) {
+	s := New(log.NewMockLogFactory(), mocktracer.New())
+	noop := func(context.Context) error { return nil }
+	if err := s.Add("job", "@hourly", noop); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add("job", "@daily", noop); !errors.Is(err, ErrDuplicateJob) {
+		t.Errorf("expected ErrDuplicateJob, got %v", err)
+	}
+}
+
+func TestRunPreventsOverlap(t *testing.T) {
+	tracer := mocktracer.New()
+	clk := clock.NewFake(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC))
+	s := New(log.NewMockLogFactory(), tracer, WithClock(clk))
+
+	var running, overlapped, runs int32
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	s.AddSchedule("slow", Every(time.Minute), func(ctx context.Context) error {
+		if atomic.AddInt32(&running, 1) > 1 {
+			atomic.StoreInt32(&overlapped, 1)
+		}
+		atomic.AddInt32(&runs, 1)
+		started <- struct{}{}
+		<-release
+		atomic.AddInt32(&running, -1)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	clk.BlockUntil(1)
+	clk.Advance(time.Minute)
+	<-started
+
+	// Ticks while the first run is still going are skipped
+	for i := 0; i < 3; i++ {
+		clk.BlockUntil(1)
+		clk.Advance(time.Minute)
+	}
+	clk.BlockUntil(1)
+	close(release)
+	cancel()
+
+	if err := <-done; err != context.Canceled {
+		t.Errorf("expected Run to return the context's error, got %v", err)
+	}
+	if overlapped != 0 {
+		t.Error("expected runs not to overlap")
+	}
+	if runs != 1 {
+		t.Errorf("expected ticks to be skipped while running, ran %d times", runs)
+	}
+	if running != 0 {
+		t.Error("expected Run to wait for running jobs")
+	}
+	for _, span := range tracer.FinishedSpans() {
+		if span.OperationName != "scheduler.slow" || span.Tag("job") != "slow" {
+			t.Errorf("unexpected span %s with tags %v", span.OperationName, span.Tags())
+		}
+	}
+}
+
+func TestRunJitter(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC))
+	s := New(log.NewMockLogFactory(), mocktracer.New(), WithClock(clk))
+
+	ran := make(chan time.Time, 1)
+	s.AddSchedule("jittered", Every(time.Hour), func(ctx context.Context) error {
+		ran <- clk.Now()
+		return nil
+	}, Jitter(time.Minute))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	clk.BlockUntil(1)
+	clk.Advance(time.Hour)
+
+	// The next tick's timer and the jitter delay
+	clk.BlockUntil(2)
+	select {
+	case <-ran:
+		t.Fatal("expected the run to wait for its jitter")
+	default:
+	}
+	clk.Advance(time.Minute)
+	at := <-ran
+	if tick := time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC); at.Before(tick) || !at.Before(tick.Add(2*time.Minute)) {
+		t.Errorf("expected the run to be delayed by under a minute, ran at %s", at)
+	}
+}
+
+type fakeLocker struct {
+	mu      sync.Mutex
+	claimed map[string]bool
+}
+
+func (l *fakeLocker) Acquire(ctx context.Context, job string, tick time.Time) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := job + tick.String()
+	if l.claimed[key] {
+		return false, nil
+	}
+	l.claimed[key] = true
+	return true, nil
+}
+
+func TestRunJobWithLocker(t *testing.T) {
+	locker := &fakeLocker{claimed: make(map[string]bool)}
+	var runs int32
+	fn := func(context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return errors.New("failed")
+	}
+
+	// Two replicas share the locker
+	tracer := mocktracer.New()
+	replicas := []*Scheduler{
+		New(log.NewMockLogFactory(), tracer, WithLocker(locker)),
+		New(log.NewMockLogFactory(), tracer, WithLocker(locker)),
+	}
+	tick := time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC)
+	for _, s := range replicas {
+		s.AddSchedule("job", Every(time.Hour), fn, Jitter(time.Millisecond))
+		s.runJob(context.Background(), s.jobs["job"], tick)
+	}
+	if runs != 1 {
+		t.Errorf("expected the tick to run on one replica, ran %d times", runs)
+	}
+	if spans := tracer.FinishedSpans(); len(spans) != 1 || spans[0].Tag("error") != true {
+		t.Errorf("expected one failed span, got %v", spans)
+	}
+}
+
+func TestRunJobWithLock(t *testing.T) {
+	backend := lock.NewMemoryBackend()
+	var runs int32
+	started, release := make(chan struct{}), make(chan struct{})
+	fn := func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		close(started)
+		<-release
+		return nil
+	}
+
+	// The first replica is still running when the second replica's tick
+	// comes around
+	replicas := []*Scheduler{
+		New(log.NewMockLogFactory(), mocktracer.New(), WithLock(backend)),
+		New(log.NewMockLogFactory(), mocktracer.New(), WithLock(backend)),
+	}
+	for _, s := range replicas {
+		s.AddSchedule("job", Every(time.Hour), fn)
+	}
+	done := make(chan struct{})
+	go func() {
+		replicas[0].runJob(context.Background(), replicas[0].jobs["job"], time.Now())
+		close(done)
+	}()
+	<-started
+	replicas[1].runJob(context.Background(), replicas[1].jobs["job"], time.Now().Add(time.Hour))
+	close(release)
+	<-done
+	if runs != 1 {
+		t.Errorf("expected the job to run on one replica at a time, ran %d times", runs)
+	}
+}
+
+// setNXClient stubs SetNX on a redis client.
+type setNXClient struct {
+	goredis.Cmdable
+	keys map[string]time.Duration
+}
+
+func (c *setNXClient) SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) *goredis.BoolCmd {
+	_, exists := c.keys[key]
+	c.keys[key] = ttl
+	return goredis.NewBoolResult(!exists, nil)
+}
+
+func TestRedisLocker(t *testing.T) {
+	client := &setNXClient{keys: make(map[string]time.Duration)}
+	l := NewRedisLocker(client, "svc:")
+	tick := time.Unix(1709290800, 0)
+
+	for i, expected := range []bool{true, false} {
+		ok, err := l.Acquire(context.Background(), "job", tick)
+		if err != nil || ok != expected {
+			t.Errorf("attempt %d: expected %v, got %v (%v)", i, expected, ok, err)
+		}
+	}
+	if ttl, ok := client.keys["svc:scheduler:job:1709290800"]; !ok || ttl != time.Hour {
+		t.Errorf("unexpected keys %v", client.keys)
+	}
+}
+
+func TestPostgresLocker(t *testing.T) {
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sql string
+	db.Callback().Create().After("gorm:create").Register("test:record", func(db *gorm.DB) {
+		sql = db.Statement.SQL.String()
+	})
+
+	l := NewPostgresLocker(db)
+	if _, err := l.Acquire(context.Background(), "job", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	expected := "ON CONFLICT (`job`) DO UPDATE SET `tick`=`excluded`.`tick`,`owner`=`excluded`.`owner`,`updated_at`=`excluded`.`updated_at` WHERE `scheduler_locks`.`tick` < `excluded`.`tick`"
+	if !strings.HasPrefix(sql, "INSERT INTO `scheduler_locks`") || !strings.HasSuffix(strings.TrimSpace(sql), expected) {
+		t.Errorf("unexpected SQL: %s", sql)
+	}
+}
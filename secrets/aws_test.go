@@ -0,0 +1,69 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignV4(t *testing.T) {
+	// The example request from the AWS Signature Version 4 documentation
+	req, err := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	creds := AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signV4(req, nil, creds, "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, " +
+		"SignedHeaders=content-type;host;x-amz-date, " +
+		"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+	if auth := req.Header.Get("Authorization"); auth != expected {
+		t.Errorf("expected %s, got %s", expected, auth)
+	}
+}
+
+func TestAWSSecretsManagerProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" ||
+			!strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") ||
+			r.Header.Get("X-Amz-Security-Token") != "session" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var in struct{ SecretId string }
+		json.NewDecoder(r.Body).Decode(&in)
+		switch in.SecretId {
+		case "db":
+			w.Write([]byte(`{"SecretString": "{\"username\": \"app\", \"password\": \"hunter2\"}"}`))
+		case "key":
+			w.Write([]byte(`{"SecretBinary": "AAEC"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type": "ResourceNotFoundException", "message": "not found"}`))
+		}
+	}))
+	defer srv.Close()
+
+	p := NewAWSSecretsManagerProvider(srv.Client(), "us-east-1", AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "session"})
+	p.(*awsProvider).endpoint = srv.URL
+	ctx := context.Background()
+
+	if v, err := String(ctx, p, "db#password"); err != nil || v != "hunter2" {
+		t.Errorf("unexpected secret %q, %v", v, err)
+	}
+	if v, err := p.Get(ctx, "key"); err != nil || string(v) != "\x00\x01\x02" {
+		t.Errorf("unexpected binary secret %q, %v", v, err)
+	}
+	for _, name := range []string{"missing", "db#missing"} {
+		if _, err := p.Get(ctx, name); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: expected %v, got %v", name, ErrNotFound, err)
+		}
+	}
+}
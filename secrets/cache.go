@@ -0,0 +1,133 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jdotw/go-utils/log"
+	"go.uber.org/zap"
+)
+
+// RotateFunc is called with the new value when a cached secret changes.
+type RotateFunc func(name string, value []byte)
+
+type cacheEntry struct {
+	value   []byte
+	fetched time.Time
+}
+
+// Cache is a Provider caching another's secrets for a TTL. When a
+// refresh fails, the last value is served so an outage of the
+// underlying provider doesn't take the service down with it.
+type Cache struct {
+	provider Provider
+	ttl      time.Duration
+	logger   log.Factory
+	now      func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]cacheEntry
+	callbacks map[string][]RotateFunc
+}
+
+// NewCache returns a Cache over provider.
+func NewCache(provider Provider, ttl time.Duration, logger log.Factory) *Cache {
+	return &Cache{
+		provider:  provider,
+		ttl:       ttl,
+		logger:    logger,
+		now:       time.Now,
+		entries:   make(map[string]cacheEntry),
+		callbacks: make(map[string][]RotateFunc),
+	}
+}
+
+// Get returns the named secret, reading it from the underlying provider
+// if it isn't cached or has expired.
+func (c *Cache) Get(ctx context.Context, name string) ([]byte, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[name]
+	c.mu.Unlock()
+	if ok && c.now().Sub(entry.fetched) < c.ttl {
+		return entry.value, nil
+	}
+
+	value, err := c.fetch(ctx, name)
+	if err != nil {
+		if ok {
+			c.logger.For(ctx).Error("Failed to refresh secret, serving cached value", zap.String("secret", name), zap.Error(err))
+			return entry.value, nil
+		}
+		return nil, err
+	}
+	return value, nil
+}
+
+// OnRotate registers fn to be called when the named secret changes, for
+// example to reconnect to a database with a new password.
+func (c *Cache) OnRotate(name string, fn RotateFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.callbacks[name] = append(c.callbacks[name], fn)
+}
+
+// Refresh rereads every cached secret, calling rotation callbacks for
+// those that changed. It returns the last error encountered.
+func (c *Cache) Refresh(ctx context.Context) error {
+	c.mu.Lock()
+	names := make([]string, 0, len(c.entries))
+	for name := range c.entries {
+		names = append(names, name)
+	}
+	c.mu.Unlock()
+
+	var lastErr error
+	for _, name := range names {
+		if _, err := c.fetch(ctx, name); err != nil {
+			c.logger.For(ctx).Error("Failed to refresh secret", zap.String("secret", name), zap.Error(err))
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// Watch calls Refresh every interval until ctx is cancelled, so
+// rotations are noticed even for secrets that are rarely read.
+func (c *Cache) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		c.Refresh(ctx)
+	}
+}
+
+func (c *Cache) fetch(ctx context.Context, name string) ([]byte, error) {
+	value, err := c.provider.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	old, cached := c.entries[name]
+	c.entries[name] = cacheEntry{value: value, fetched: c.now()}
+	var callbacks []RotateFunc
+	if cached && !bytes.Equal(old.value, value) {
+		callbacks = append(callbacks, c.callbacks[name]...)
+	}
+	c.mu.Unlock()
+
+	if len(callbacks) > 0 {
+		c.logger.For(ctx).Info("Secret rotated", zap.String("secret", name))
+	}
+	for _, fn := range callbacks {
+		fn(name, value)
+	}
+	return value, nil
+}
@@ -0,0 +1,66 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jdotw/go-utils/log"
+)
+
+func TestCache(t *testing.T) {
+	value, reads := "v1", 0
+	errUnavailable := errors.New("unavailable")
+	var failing bool
+	p := ProviderFunc(func(context.Context, string) ([]byte, error) {
+		reads++
+		if failing {
+			return nil, errUnavailable
+		}
+		return []byte(value), nil
+	})
+	c := NewCache(p, time.Minute, log.NewMockLogFactory())
+	clock := time.Unix(0, 0)
+	c.now = func() time.Time { return clock }
+	ctx := context.Background()
+
+	var rotated []string
+	c.OnRotate("key", func(name string, v []byte) {
+		rotated = append(rotated, string(v))
+	})
+
+	// Reads within the TTL are served from the cache
+	for i := 0; i < 2; i++ {
+		if v, err := String(ctx, c, "key"); err != nil || v != "v1" {
+			t.Fatalf("unexpected secret %q, %v", v, err)
+		}
+	}
+	if reads != 1 {
+		t.Errorf("expected 1 read, got %d", reads)
+	}
+
+	// Refresh notices rotation
+	value = "v2"
+	if err := c.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 1 || rotated[0] != "v2" {
+		t.Errorf("expected one rotation to v2, got %v", rotated)
+	}
+
+	// A failed refresh of an expired secret serves the cached value
+	failing = true
+	clock = clock.Add(2 * time.Minute)
+	if v, err := String(ctx, c, "key"); err != nil || v != "v2" {
+		t.Errorf("expected the cached value, got %q, %v", v, err)
+	}
+	if err := c.Refresh(ctx); err != errUnavailable {
+		t.Errorf("expected %v, got %v", errUnavailable, err)
+	}
+
+	// Secrets never read successfully fail
+	if _, err := c.Get(ctx, "other"); err != errUnavailable {
+		t.Errorf("expected %v, got %v", errUnavailable, err)
+	}
+}
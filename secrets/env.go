@@ -0,0 +1,39 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+type envProvider struct {
+	prefix string
+	lookup func(string) (string, bool)
+}
+
+// NewEnvProvider returns a Provider reading environment variables. Names
+// are upper cased, with anything other than letters and digits replaced
+// by underscores, and prefixed, so "db-password" with prefix "APP_" reads
+// APP_DB_PASSWORD.
+func NewEnvProvider(prefix string) Provider {
+	return &envProvider{prefix: prefix, lookup: os.LookupEnv}
+}
+
+func (p *envProvider) Get(_ context.Context, name string) ([]byte, error) {
+	v, ok := p.lookup(p.prefix + envName(name))
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return []byte(v), nil
+}
+
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, name)
+}
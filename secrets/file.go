@@ -0,0 +1,38 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type fileProvider struct {
+	dir string
+}
+
+// NewFileProvider returns a Provider reading secrets from files in dir,
+// such as Kubernetes secret volumes or Docker secrets. A trailing newline
+// is removed. Names may not leave dir.
+func NewFileProvider(dir string) Provider {
+	return &fileProvider{dir: dir}
+}
+
+func (p *fileProvider) Get(_ context.Context, name string) ([]byte, error) {
+	path := filepath.Join(p.dir, name)
+	if rel, err := filepath.Rel(p.dir, path); err != nil || strings.HasPrefix(rel, "..") {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	b = bytes.TrimSuffix(b, []byte("\n"))
+	return bytes.TrimSuffix(b, []byte("\r")), nil
+}
@@ -0,0 +1,56 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jdotw/go-utils/model"
+)
+
+// keyFetchTimeout bounds secret reads made by EncryptionKeys, whose
+// methods take no context.
+const keyFetchTimeout = 10 * time.Second
+
+type encryptionKeys struct {
+	provider Provider
+	current  func(ctx context.Context) (string, error)
+}
+
+// NewEncryptionKeys returns model.EncryptionKeys reading keys from
+// provider, with secret names as key IDs; the names may not contain
+// colons. The ID of the key to encrypt with is itself read from the
+// secret named current, so rotating is a matter of adding a key and
+// updating that secret. Use a Cache as the provider; keys are read on
+// every encryption and decryption.
+//
+//	model.SetEncryptionKeys(secrets.NewEncryptionKeys(cache, "column-key-current"))
+func NewEncryptionKeys(provider Provider, current string) model.EncryptionKeys {
+	return &encryptionKeys{
+		provider: provider,
+		current: func(ctx context.Context) (string, error) {
+			return String(ctx, provider, current)
+		},
+	}
+}
+
+func (k *encryptionKeys) Current() (string, []byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), keyFetchTimeout)
+	defer cancel()
+	id, err := k.current(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	key, err := k.provider.Get(ctx, id)
+	return id, key, err
+}
+
+func (k *encryptionKeys) Key(id string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), keyFetchTimeout)
+	defer cancel()
+	key, err := k.provider.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, model.ErrUnknownKey
+	}
+	return key, err
+}
@@ -0,0 +1,48 @@
+// Package secrets reads secrets such as signing keys, database
+// credentials and encryption keys from a Provider: environment
+// variables, files, HashiCorp Vault or AWS Secrets Manager. Wrap a
+// Provider in a Cache to avoid a round trip per read and to be told when
+// a secret is rotated.
+//
+//	provider := secrets.NewCache(secrets.NewVaultProvider(nil, addr, token, "secret"), 5*time.Minute, logger)
+//	go provider.Watch(ctx, time.Minute)
+//	password, err := secrets.String(ctx, provider, "db#password")
+package secrets
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotFound is returned when a provider has no secret by the given
+// name.
+var ErrNotFound = errors.New("secret not found")
+
+// Provider reads secrets by name. How names map to secrets depends on
+// the provider.
+type Provider interface {
+	Get(ctx context.Context, name string) ([]byte, error)
+}
+
+// ProviderFunc adapts a function to a Provider.
+type ProviderFunc func(ctx context.Context, name string) ([]byte, error)
+
+func (f ProviderFunc) Get(ctx context.Context, name string) ([]byte, error) {
+	return f(ctx, name)
+}
+
+// String returns the named secret as a string.
+func String(ctx context.Context, p Provider, name string) (string, error) {
+	b, err := p.Get(ctx, name)
+	return string(b), err
+}
+
+// KeyFunc returns a function reading the named secret on each call, for
+// keys that may be rotated, such as JWT signing keys:
+//
+//	jwt.NewKeySigner(kid, secrets.KeyFunc(provider, "jwt-signing-key"), method, claims)
+func KeyFunc(p Provider, name string) func(ctx context.Context) ([]byte, error) {
+	return func(ctx context.Context) ([]byte, error) {
+		return p.Get(ctx, name)
+	}
+}
@@ -0,0 +1,73 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdotw/go-utils/model"
+)
+
+func TestEnvProvider(t *testing.T) {
+	p := &envProvider{prefix: "APP_", lookup: func(name string) (string, bool) {
+		if name == "APP_DB_PASSWORD" {
+			return "hunter2", true
+		}
+		return "", false
+	}}
+	ctx := context.Background()
+
+	if v, err := String(ctx, p, "db-password"); err != nil || v != "hunter2" {
+		t.Errorf("unexpected secret %q, %v", v, err)
+	}
+	if _, err := p.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v, got %v", ErrNotFound, err)
+	}
+}
+
+func TestFileProvider(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "db-password"), []byte("hunter2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p := NewFileProvider(dir)
+	ctx := context.Background()
+
+	if v, err := String(ctx, p, "db-password"); err != nil || v != "hunter2" {
+		t.Errorf("unexpected secret %q, %v", v, err)
+	}
+	for _, name := range []string{"missing", "../" + filepath.Base(dir) + "/db-password/../../etc/passwd"} {
+		if _, err := p.Get(ctx, name); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: expected %v, got %v", name, ErrNotFound, err)
+		}
+	}
+}
+
+func TestEncryptionKeys(t *testing.T) {
+	stored := map[string]string{
+		"current": "key-2",
+		"key-1":   "0123456789abcdef",
+		"key-2":   "fedcba9876543210",
+	}
+	p := ProviderFunc(func(_ context.Context, name string) ([]byte, error) {
+		v, ok := stored[name]
+		if !ok {
+			return nil, ErrNotFound
+		}
+		return []byte(v), nil
+	})
+	keys := NewEncryptionKeys(p, "current")
+
+	id, key, err := keys.Current()
+	if err != nil || id != "key-2" || string(key) != stored["key-2"] {
+		t.Errorf("unexpected current key %s %q, %v", id, key, err)
+	}
+	if key, err := keys.Key("key-1"); err != nil || string(key) != stored["key-1"] {
+		t.Errorf("unexpected key %q, %v", key, err)
+	}
+	if _, err := keys.Key("key-3"); err != model.ErrUnknownKey {
+		t.Errorf("expected %v, got %v", model.ErrUnknownKey, err)
+	}
+}
@@ -0,0 +1,89 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+type vaultProvider struct {
+	client *http.Client
+	addr   string
+	token  string
+	mount  string
+}
+
+// NewVaultProvider returns a Provider reading a HashiCorp Vault KV
+// version 2 secrets engine mounted at mount. Names are a secret path and
+// field, "path/to/secret#field", the field defaulting to "value". A nil
+// client uses http.DefaultClient.
+func NewVaultProvider(client *http.Client, addr, token, mount string) Provider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &vaultProvider{
+		client: client,
+		addr:   strings.TrimSuffix(addr, "/"),
+		token:  token,
+		mount:  strings.Trim(mount, "/"),
+	}
+}
+
+type vaultResponse struct {
+	Data struct {
+		Data map[string]interface{} `json:"data"`
+	} `json:"data"`
+}
+
+func (p *vaultProvider) Get(ctx context.Context, name string) ([]byte, error) {
+	path, field := splitField(name, "value")
+	url := p.addr + "/v1/" + p.mount + "/data/" + strings.TrimPrefix(path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("vault: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var vr vaultResponse
+	if err := json.NewDecoder(resp.Body).Decode(&vr); err != nil {
+		return nil, fmt.Errorf("vault: %w", err)
+	}
+	return fieldValue(vr.Data.Data, name, field)
+}
+
+// splitField splits "name#field", returning def when there is no field.
+func splitField(name, def string) (string, string) {
+	if i := strings.LastIndexByte(name, '#'); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return name, def
+}
+
+// fieldValue returns a field of a JSON secret, with strings returned as
+// is and anything else as JSON.
+func fieldValue(data map[string]interface{}, name, field string) ([]byte, error) {
+	v, ok := data[field]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if s, ok := v.(string); ok {
+		return []byte(s), nil
+	}
+	return json.Marshal(v)
+}
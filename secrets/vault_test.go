@@ -0,0 +1,47 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVaultProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1/secret/data/app/db" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"data": {"data": {"value": "v", "password": "hunter2", "port": 5432}, "metadata": {"version": 3}}}`))
+	}))
+	defer srv.Close()
+	p := NewVaultProvider(srv.Client(), srv.URL+"/", "token", "/secret/")
+	ctx := context.Background()
+
+	tests := map[string]string{
+		"app/db":          "v",
+		"app/db#password": "hunter2",
+		"app/db#port":     "5432",
+	}
+	for name, expected := range tests {
+		if v, err := String(ctx, p, name); err != nil || v != expected {
+			t.Errorf("%s: expected %q, got %q, %v", name, expected, v, err)
+		}
+	}
+	for _, name := range []string{"app/missing", "app/db#missing"} {
+		if _, err := p.Get(ctx, name); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: expected %v, got %v", name, ErrNotFound, err)
+		}
+	}
+
+	p = NewVaultProvider(srv.Client(), srv.URL, "wrong", "secret")
+	if _, err := p.Get(ctx, "app/db"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a permission error, got %v", err)
+	}
+}
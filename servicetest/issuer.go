@@ -0,0 +1,84 @@
+package servicetest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v4"
+	"github.com/jdotw/go-utils/authn/jwt"
+)
+
+const issuerKeyID = "servicetest"
+
+// Issuer mints RS256 tokens and serves the matching JWKS, standing in for
+// the identity provider of a jwt.Authenticator.
+type Issuer struct {
+	// URL is the JWKS URL to pass to jwt.NewAuthenticator.
+	URL string
+
+	key *rsa.PrivateKey
+}
+
+// NewIssuer generates a signing key and serves its JWKS until the test
+// ends.
+func NewIssuer(t testing.TB) *Issuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("servicetest: generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: issuerKeyID},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("servicetest: creating certificate: %v", err)
+	}
+	jwks, err := json.Marshal(jwt.Jwks{Keys: []jwt.JSONWebKeys{{
+		Kty: "RSA",
+		Kid: issuerKeyID,
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		X5c: []string{base64.StdEncoding.EncodeToString(cert)},
+	}}})
+	if err != nil {
+		t.Fatalf("servicetest: encoding JWKS: %v", err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jwks)
+	}))
+	t.Cleanup(srv.Close)
+	return &Issuer{URL: srv.URL, key: key}
+}
+
+// Token returns a signed token carrying claims. An expiry an hour from
+// now is added unless claims sets exp.
+func (i *Issuer) Token(t testing.TB, claims gojwt.MapClaims) string {
+	t.Helper()
+	c := gojwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()}
+	for k, v := range claims {
+		c[k] = v
+	}
+	token := gojwt.NewWithClaims(gojwt.SigningMethodRS256, c)
+	token.Header["kid"] = issuerKeyID
+	signed, err := token.SignedString(i.key)
+	if err != nil {
+		t.Fatalf("servicetest: signing token: %v", err)
+	}
+	return signed
+}
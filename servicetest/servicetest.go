@@ -0,0 +1,180 @@
+// Package servicetest runs endpoints behind the real HTTP transport,
+// JWT authentication and in-process OPA authorization for end-to-end
+// tests:
+//
+//	h := servicetest.New(t)
+//	h.Handle(http.MethodPost, "/widgets", makeCreateWidgetEndpoint(svc),
+//		transport.HTTPDecodeJSONRequest[CreateWidgetRequest])
+//	token := h.Token(t, "alice", "admin")
+//	resp := h.Do(t, http.MethodPost, "/widgets", CreateWidgetRequest{Name: "w"}, token)
+//	if resp.StatusCode != http.StatusCreated { ... }
+package servicetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+	gojwt "github.com/golang-jwt/jwt/v4"
+	"github.com/jdotw/go-utils/authn/jwt"
+	"github.com/jdotw/go-utils/authz/opa"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/tracing"
+	"github.com/jdotw/go-utils/transport"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+// DefaultPolicy allows any authenticated caller except those with the
+// "denied" role, which lets tests exercise both outcomes without a
+// policy of their own.
+const DefaultPolicy = `
+package servicetest
+
+default allow = false
+
+allow {
+	input.identity.user_id != ""
+	not denied
+}
+
+denied {
+	input.identity.roles[_] == "denied"
+}
+`
+
+// DefaultQuery is the query evaluated against DefaultPolicy.
+const DefaultQuery = "data.servicetest.allow"
+
+// Option configures a Harness.
+type Option func(*options)
+
+type options struct {
+	policy string
+	query  string
+	before []kithttp.ServerOption
+}
+
+// Policy replaces DefaultPolicy and DefaultQuery.
+func Policy(policy, query string) Option {
+	return func(o *options) {
+		o.policy = policy
+		o.query = query
+	}
+}
+
+// ServerOptions adds go-kit server options, such as extra ServerBefore
+// functions, to every handler.
+func ServerOptions(opts ...kithttp.ServerOption) Option {
+	return func(o *options) {
+		o.before = append(o.before, opts...)
+	}
+}
+
+// Harness is an httptest server wrapping endpoints in the same
+// middleware a service uses.
+type Harness struct {
+	Logger log.Factory
+	Tracer *mocktracer.MockTracer
+	Issuer *Issuer
+	Server *httptest.Server
+
+	router *transport.Router
+	authn  endpoint.Middleware
+	authz  endpoint.Middleware
+	opts   options
+}
+
+// New starts a Harness that is closed when the test ends.
+func New(t testing.TB, opts ...Option) *Harness {
+	t.Helper()
+	o := options{policy: DefaultPolicy, query: DefaultQuery}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	h := &Harness{
+		Logger: log.NewMockLogFactory(),
+		Tracer: mocktracer.New(),
+		Issuer: NewIssuer(t),
+		opts:   o,
+	}
+	authenticator := jwt.NewAuthenticator(h.Logger, h.Tracer, h.Issuer.URL)
+	h.authn = authenticator.NewMiddleware()
+	authorizor := opa.NewAuthorizor(h.Logger, h.Tracer)
+	h.authz = authorizor.NewInProcessMiddleware(o.policy, o.query)
+
+	h.router = transport.NewRouter(tracing.NewServeMux(h.Tracer))
+	h.Server = httptest.NewServer(h.router)
+	t.Cleanup(h.Server.Close)
+	return h
+}
+
+// Handle serves e for method requests to pattern, behind authentication
+// and authorization. Register routes before making requests.
+func (h *Harness) Handle(method, pattern string, e endpoint.Endpoint, dec kithttp.DecodeRequestFunc) {
+	h.HandleUnauthenticated(method, pattern, endpoint.Chain(h.authn, h.authz)(e), dec)
+}
+
+// HandleUnauthenticated serves e for method requests to pattern without
+// authentication or authorization, as for public endpoints.
+func (h *Harness) HandleUnauthenticated(method, pattern string, e endpoint.Endpoint, dec kithttp.DecodeRequestFunc) {
+	opts := append([]kithttp.ServerOption{
+		kithttp.ServerBefore(kithttp.PopulateRequestContext, jwt.HTTPAuthorizationToContext(), transport.AcceptLanguageToContext()),
+		kithttp.ServerErrorEncoder(transport.HTTPErrorEncoder),
+	}, h.opts.before...)
+	h.router.Handle(method, pattern, kithttp.NewServer(e, dec, transport.HTTPEncodeResponse, opts...))
+}
+
+// Token returns a token for subject holding roles.
+func (h *Harness) Token(t testing.TB, subject string, roles ...string) string {
+	t.Helper()
+	claims := gojwt.MapClaims{"sub": subject}
+	if len(roles) > 0 {
+		claims["roles"] = roles
+	}
+	return h.Issuer.Token(t, claims)
+}
+
+// Do sends a request to the harness, JSON encoding body unless it is nil
+// and authenticating with token unless it is empty. The response body is
+// closed when the test ends.
+func (h *Harness) Do(t testing.TB, method, path string, body interface{}, token string) *http.Response {
+	t.Helper()
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("servicetest: encoding body: %v", err)
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, h.Server.URL+path, r)
+	if err != nil {
+		t.Fatalf("servicetest: creating request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := h.Server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("servicetest: %s %s: %v", method, path, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// DecodeJSON decodes the body of resp into v.
+func DecodeJSON(t testing.TB, resp *http.Response, v interface{}) {
+	t.Helper()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("servicetest: decoding response: %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package servicetest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/jdotw/go-utils/identity"
+	"github.com/jdotw/go-utils/transport"
+)
+
+type greetRequest struct {
+	Greeting string `json:"greeting"`
+}
+
+type greetResponse struct {
+	Message string `json:"message"`
+}
+
+func greet(ctx context.Context, request interface{}) (interface{}, error) {
+	req := request.(greetRequest)
+	return greetResponse{Message: req.Greeting + " " + identity.UserID(ctx)}, nil
+}
+
+func TestHarness(t *testing.T) {
+	h := New(t)
+	dec := transport.HTTPDecodeJSONRequest[greetRequest]
+	h.Handle(http.MethodPost, "/greet", greet, dec)
+	h.HandleUnauthenticated(http.MethodPost, "/public", greet, dec)
+
+	resp := h.Do(t, http.MethodPost, "/greet", greetRequest{Greeting: "hello"}, h.Token(t, "alice"))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var body greetResponse
+	DecodeJSON(t, resp, &body)
+	if body.Message != "hello alice" {
+		t.Errorf("unexpected response %q", body.Message)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		token  string
+		status int
+	}{
+		{"missing token", "/greet", "", http.StatusUnauthorized},
+		{"malformed token", "/greet", "not.a.token", http.StatusUnauthorized},
+		{"denied by policy", "/greet", h.Token(t, "bob", "denied"), http.StatusForbidden},
+		{"public", "/public", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := h.Do(t, http.MethodPost, tt.path, greetRequest{Greeting: "hi"}, tt.token)
+			if resp.StatusCode != tt.status {
+				t.Errorf("expected %d, got %d", tt.status, resp.StatusCode)
+			}
+		})
+	}
+}
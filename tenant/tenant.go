@@ -0,0 +1,94 @@
+package tenant
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/go-kit/kit/endpoint"
+	stdjwt "github.com/golang-jwt/jwt/v4"
+	"github.com/jdotw/go-utils/authn/jwt"
+	"github.com/jdotw/go-utils/errorsx"
+	"github.com/jdotw/go-utils/identity"
+	"github.com/opentracing/opentracing-go"
+)
+
+// Tenant identification for multi-tenant services. The tenant ID is
+// stored in the context, usually from a claim of the caller's JWT, and
+// used to scope database access.
+
+const (
+	// TenantIDContextKey holds the key used to store the tenant ID in the
+	// context. It is the identity package's key.
+	TenantIDContextKey = identity.TenantIDContextKey
+
+	// DefaultClaim is the JWT claim read by NewMiddleware by default.
+	DefaultClaim = "tenant_id"
+
+	// BaggageKey is the tracing baggage item carrying the tenant ID to
+	// downstream services, for observability only.
+	BaggageKey = "tenant-id"
+)
+
+// ErrMissingTenant is returned when a request has no tenant. It responds
+// 403.
+var ErrMissingTenant = errorsx.Sentinel(errorsx.CodePermissionDenied, "tenant not present")
+
+// WithID returns a copy of ctx carrying the tenant ID.
+func WithID(ctx context.Context, id string) context.Context {
+	return identity.WithTenantID(ctx, id)
+}
+
+// FromContext returns the tenant ID stored in ctx, or an empty string.
+func FromContext(ctx context.Context) string {
+	return identity.TenantID(ctx)
+}
+
+// claim is the claim name set by the last NewMiddleware, read by
+// Resolve.
+var claim atomic.Value
+
+func init() {
+	claim.Store(DefaultClaim)
+}
+
+// Resolve returns the tenant of ctx: the ID stored with WithID, else
+// the claim of the parsed JWT named by NewMiddleware (DefaultClaim
+// unless configured). It returns an empty string when none is found.
+// The BaggageKey item is never used, as callers can set baggage with
+// request headers.
+func Resolve(ctx context.Context) string {
+	if id := FromContext(ctx); id != "" {
+		return id
+	}
+	if claims, ok := jwt.ClaimsFromContext(ctx).(stdjwt.MapClaims); ok {
+		if id, _ := claims[claim.Load().(string)].(string); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// NewMiddleware returns endpoint middleware that stores the tenant ID
+// from the named claim of the parsed JWT, so it must run after the authn
+// middleware, and sets it as tracing baggage. Requests without the claim
+// fail with ErrMissingTenant. An empty claim name uses DefaultClaim.
+// The claim name is also the one Resolve reads.
+func NewMiddleware(name string) endpoint.Middleware {
+	if name == "" {
+		name = DefaultClaim
+	}
+	claim.Store(name)
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			claims, _ := jwt.ClaimsFromContext(ctx).(stdjwt.MapClaims)
+			id, _ := claims[name].(string)
+			if id == "" {
+				return nil, ErrMissingTenant
+			}
+			if span := opentracing.SpanFromContext(ctx); span != nil {
+				span.SetBaggageItem(BaggageKey, id)
+			}
+			return next(WithID(ctx, id), request)
+		}
+	}
+}
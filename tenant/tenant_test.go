@@ -0,0 +1,59 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+
+	stdjwt "github.com/golang-jwt/jwt/v4"
+	"github.com/jdotw/go-utils/authn/jwt"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestMiddleware(t *testing.T) {
+	var got string
+	e := NewMiddleware("")(func(ctx context.Context, request interface{}) (interface{}, error) {
+		got = FromContext(ctx)
+		return nil, nil
+	})
+
+	ctx := context.WithValue(context.Background(), jwt.JWTClaimsContextKey, stdjwt.MapClaims{"tenant_id": "acme"})
+	if _, err := e(ctx, nil); err != nil || got != "acme" {
+		t.Errorf("unexpected result; got %q, %v", got, err)
+	}
+	if _, err := e(context.Background(), nil); err != ErrMissingTenant {
+		t.Errorf("unexpected error; expected %v, got %v", ErrMissingTenant, err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tracer := mocktracer.New()
+	span := tracer.StartSpan("test")
+	span.SetBaggageItem(BaggageKey, "from-baggage")
+	traced := opentracing.ContextWithSpan(context.Background(), span)
+	claims := context.WithValue(traced, jwt.JWTClaimsContextKey, stdjwt.MapClaims{"tenant_id": "from-claims"})
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"none", context.Background(), ""},
+		{"baggage", traced, ""},
+		{"claims", claims, "from-claims"},
+		{"context", WithID(claims, "from-context"), "from-context"},
+	}
+	for _, tt := range tests {
+		if got := Resolve(tt.ctx); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+
+	// Resolve reads the claim configured by NewMiddleware
+	NewMiddleware("org_id")
+	defer NewMiddleware("")
+	org := context.WithValue(context.Background(), jwt.JWTClaimsContextKey, stdjwt.MapClaims{"tenant_id": "acme", "org_id": "globex"})
+	if got := Resolve(org); got != "globex" {
+		t.Errorf("expected the configured claim, got %q", got)
+	}
+}
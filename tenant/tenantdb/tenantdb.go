@@ -0,0 +1,295 @@
+// Package tenantdb routes database access to a per-tenant schema or
+// database. A Registry resolves the tenant from the context, opens that
+// tenant's connection pool with db.Open on first use and reuses it for
+// later requests:
+//
+//	var cfg db.Config
+//	config.Load(&cfg)
+//	cfg.Dialect = postgres.Open
+//	registry := tenantdb.NewRegistry(cfg, tenantdb.SchemaDSN(cfg.DSN),
+//		tenantdb.DBOptions(db.Logger(logger), db.Tracer(tracer)))
+//	defer registry.Close()
+//
+//	func (r *repo) Get(ctx context.Context, id string) (*Order, error) {
+//		conn, err := r.registry.DB(ctx)
+//		...
+//	}
+//
+// Use SchemaDSN for a schema per tenant in one database and DatabaseDSN
+// for a database per tenant. Each tenant gets its own pool sized by the
+// db.Config, so size it for one tenant's share of the load.
+package tenantdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/jdotw/go-utils/db"
+	"github.com/jdotw/go-utils/tenant"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidTenant is returned for tenant IDs that are unsafe to use
+	// in a schema or database name.
+	ErrInvalidTenant = errors.New("invalid tenant ID")
+
+	// ErrClosed is returned after the registry is closed.
+	ErrClosed = errors.New("tenant registry closed")
+)
+
+var validTenant = regexp.MustCompile(`^[A-Za-z0-9_-]{1,63}$`)
+
+// DSNFunc returns the DSN of a tenant's schema or database.
+type DSNFunc func(tenantID string) (string, error)
+
+// SchemaDSN returns a DSNFunc adding a search_path for the tenant's
+// SchemaName to a Postgres URL DSN, so unqualified table names resolve
+// to the tenant's schema.
+func SchemaDSN(base string) DSNFunc {
+	return func(id string) (string, error) {
+		if !validTenant.MatchString(id) {
+			return "", ErrInvalidTenant
+		}
+		u, err := url.Parse(base)
+		if err != nil {
+			return "", fmt.Errorf("tenantdb: parse DSN: %w", err)
+		}
+		q := u.Query()
+		q.Set("search_path", `"`+SchemaName(id)+`"`)
+		u.RawQuery = q.Encode()
+		return u.String(), nil
+	}
+}
+
+// SchemaName returns the schema used for a tenant by SchemaDSN. Quote it
+// when creating the schema, as tenant IDs may contain hyphens.
+func SchemaName(tenantID string) string {
+	return "tenant_" + tenantID
+}
+
+// DatabaseDSN returns a DSNFunc replacing "{tenant}" in template with
+// the tenant ID, e.g. "postgres://app@db/orders_{tenant}".
+func DatabaseDSN(template string) DSNFunc {
+	return func(id string) (string, error) {
+		if !validTenant.MatchString(id) {
+			return "", ErrInvalidTenant
+		}
+		return strings.ReplaceAll(template, "{tenant}", id), nil
+	}
+}
+
+// Option configures a Registry.
+type Option func(*options)
+
+type options struct {
+	dbOpts  []db.Option
+	resolve func(ctx context.Context) string
+}
+
+// DBOptions are passed to db.Open for every tenant's connection.
+func DBOptions(opts ...db.Option) Option {
+	return func(o *options) {
+		o.dbOpts = append(o.dbOpts, opts...)
+	}
+}
+
+// Resolver overrides tenant.Resolve as the way the tenant is found in a
+// context.
+func Resolver(resolve func(ctx context.Context) string) Option {
+	return func(o *options) {
+		o.resolve = resolve
+	}
+}
+
+// conn is a tenant's connection, opened once by the first caller while
+// later callers wait for it.
+type conn struct {
+	ready chan struct{}
+	db    *gorm.DB
+	err   error
+}
+
+// Registry holds a lazily opened connection pool per tenant.
+type Registry struct {
+	cfg  db.Config
+	dsn  DSNFunc
+	opts options
+
+	mu     sync.Mutex
+	conns  map[string]*conn
+	closed bool
+}
+
+// NewRegistry returns a Registry opening tenant connections described
+// by cfg, with the DSN for each tenant from dsn. cfg.DSN is not used
+// directly.
+func NewRegistry(cfg db.Config, dsn DSNFunc, opts ...Option) *Registry {
+	o := options{resolve: tenant.Resolve}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Registry{cfg: cfg, dsn: dsn, opts: o, conns: make(map[string]*conn)}
+}
+
+// DB returns the connection of the tenant of ctx, bound to ctx. It
+// fails with tenant.ErrMissingTenant when ctx has no tenant.
+func (r *Registry) DB(ctx context.Context) (*gorm.DB, error) {
+	id := r.opts.resolve(ctx)
+	if id == "" {
+		return nil, tenant.ErrMissingTenant
+	}
+	conn, err := r.ForTenant(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return conn.WithContext(tenant.WithID(ctx, id)), nil
+}
+
+// ForTenant returns the connection of tenant id, opening it if needed,
+// for work outside a tenant's request such as migrating every tenant.
+func (r *Registry) ForTenant(ctx context.Context, id string) (*gorm.DB, error) {
+	for {
+		db, err := r.forTenant(ctx, id)
+		if err != errEvicted {
+			return db, err
+		}
+	}
+}
+
+// errEvicted is returned to callers waiting on a connection that was
+// evicted while it opened, so they open it again.
+var errEvicted = errors.New("tenant connection evicted")
+
+func (r *Registry) forTenant(ctx context.Context, id string) (*gorm.DB, error) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil, ErrClosed
+	}
+	c, ok := r.conns[id]
+	if !ok {
+		c = &conn{ready: make(chan struct{})}
+		r.conns[id] = c
+	}
+	r.mu.Unlock()
+	if !ok {
+		db, err := r.open(ctx, id)
+		// Publish under the lock, so Evict and Close either see the
+		// connection opened and close it, or leave closing it to us.
+		r.mu.Lock()
+		evicted := r.conns[id] != c
+		if err != nil && !evicted {
+			// Let the next caller retry rather than caching the failure.
+			delete(r.conns, id)
+		}
+		var stale *gorm.DB
+		if err == nil && evicted {
+			stale, db, err = db, nil, errEvicted
+			if r.closed {
+				err = ErrClosed
+			}
+		}
+		c.db, c.err = db, err
+		close(c.ready)
+		r.mu.Unlock()
+		if stale != nil {
+			closeDB(stale)
+		}
+	}
+	select {
+	case <-c.ready:
+		return c.db, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (r *Registry) open(ctx context.Context, id string) (*gorm.DB, error) {
+	dsn, err := r.dsn(id)
+	if err != nil {
+		return nil, err
+	}
+	cfg := r.cfg
+	cfg.Name = r.cfg.Name + ":" + id
+	cfg.DSN = dsn
+	return db.Open(ctx, cfg, r.opts.dbOpts...)
+}
+
+// Tenants returns the tenants with an open connection.
+func (r *Registry) Tenants() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := make([]string, 0, len(r.conns))
+	for id := range r.conns {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Evict closes the connection of tenant id, e.g. after the tenant is
+// deleted. It is reopened if used again. A connection still opening is
+// closed by its opener once it is ready.
+func (r *Registry) Evict(id string) error {
+	r.mu.Lock()
+	c := r.conns[id]
+	delete(r.conns, id)
+	opened := c != nil && c.opened()
+	r.mu.Unlock()
+	if !opened {
+		return nil
+	}
+	return closeConn(c)
+}
+
+// Close closes every tenant's connection.
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	var conns []*conn
+	for _, c := range r.conns {
+		if c.opened() {
+			conns = append(conns, c)
+		}
+	}
+	r.conns = make(map[string]*conn)
+	r.closed = true
+	r.mu.Unlock()
+	var first error
+	for _, c := range conns {
+		if err := closeConn(c); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// opened reports whether c has finished opening. The opener publishes
+// c under the registry lock, which callers must hold.
+func (c *conn) opened() bool {
+	select {
+	case <-c.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+func closeConn(c *conn) error {
+	if c.err != nil {
+		return nil
+	}
+	return closeDB(c.db)
+}
+
+func closeDB(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
@@ -0,0 +1,193 @@
+package tenantdb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jdotw/go-utils/db"
+	"github.com/jdotw/go-utils/tenant"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+)
+
+// countingDriver records the DSNs it opens.
+type countingDriver struct {
+	mu   sync.Mutex
+	dsns map[string]int
+}
+
+func (d *countingDriver) Open(dsn string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dsns[dsn]++
+	return testConn{}, nil
+}
+
+type testConn struct{}
+
+func (testConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("unsupported") }
+func (testConn) Close() error                        { return nil }
+func (testConn) Begin() (driver.Tx, error)           { return nil, errors.New("unsupported") }
+func (testConn) Ping(context.Context) error          { return nil }
+
+var testDriver = &countingDriver{dsns: map[string]int{}}
+
+func init() {
+	sql.Register("tenantdb-test", testDriver)
+}
+
+type testDialector struct {
+	tests.DummyDialector
+	dsn string
+}
+
+func (d testDialector) Initialize(db *gorm.DB) error {
+	if err := d.DummyDialector.Initialize(db); err != nil {
+		return err
+	}
+	pool, err := sql.Open("tenantdb-test", d.dsn)
+	db.ConnPool = pool
+	return err
+}
+
+func testConfig() db.Config {
+	return db.Config{
+		Name:           "test",
+		Dialect:        func(dsn string) gorm.Dialector { return testDialector{dsn: dsn} },
+		MaxOpenConns:   2,
+		ConnectTimeout: time.Second,
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry(testConfig(), DatabaseDSN("db/orders_{tenant}"))
+	defer r.Close()
+
+	if _, err := r.DB(context.Background()); !errors.Is(err, tenant.ErrMissingTenant) {
+		t.Errorf("expected ErrMissingTenant, got %v", err)
+	}
+
+	ctx := tenant.WithID(context.Background(), "acme")
+	var wg sync.WaitGroup
+	conns := make([]*gorm.DB, 10)
+	for i := range conns {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conn, err := r.DB(ctx)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			conns[i] = conn
+		}(i)
+	}
+	wg.Wait()
+	for _, conn := range conns[1:] {
+		if conn == nil || conn.ConnPool != conns[0].ConnPool {
+			t.Fatal("expected concurrent callers to share one pool")
+		}
+	}
+	if tenant.FromContext(conns[0].Statement.Context) != "acme" {
+		t.Error("expected connection to be bound to the tenant's context")
+	}
+
+	other, err := r.DB(tenant.WithID(context.Background(), "globex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.ConnPool == conns[0].ConnPool {
+		t.Error("expected tenants to have separate pools")
+	}
+	tenants := r.Tenants()
+	sort.Strings(tenants)
+	if strings.Join(tenants, ",") != "acme,globex" {
+		t.Errorf("unexpected tenants %v", tenants)
+	}
+
+	if _, err := r.DB(tenant.WithID(context.Background(), "../etc")); !errors.Is(err, ErrInvalidTenant) {
+		t.Errorf("expected ErrInvalidTenant, got %v", err)
+	}
+	if err := r.Evict("acme"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.DB(ctx); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestRegistryEvictWhileOpening(t *testing.T) {
+	opening := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	dsn := func(id string) (string, error) {
+		// Only the first open blocks
+		once.Do(func() {
+			close(opening)
+			<-release
+		})
+		return "db/evict_" + id, nil
+	}
+	r := NewRegistry(testConfig(), dsn)
+
+	type result struct {
+		db  *gorm.DB
+		err error
+	}
+	done := make(chan result)
+	go func() {
+		conn, err := r.ForTenant(context.Background(), "acme")
+		done <- result{conn, err}
+	}()
+	<-opening
+	if err := r.Evict("acme"); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	res := <-done
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	sqlDB, _ := res.db.DB()
+	if err := sqlDB.Ping(); err != nil {
+		t.Errorf("expected an open connection after eviction, got %v", err)
+	}
+
+	opening, release, once = make(chan struct{}), make(chan struct{}), sync.Once{}
+	go func() {
+		conn, err := r.ForTenant(context.Background(), "globex")
+		done <- result{conn, err}
+	}()
+	<-opening
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	if res := <-done; !errors.Is(res.err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", res.err)
+	}
+}
+
+func TestSchemaDSN(t *testing.T) {
+	dsn, err := SchemaDSN("postgres://app@db:5432/orders?sslmode=disable")("acme-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "postgres://app@db:5432/orders?search_path=%22tenant_acme-1%22&sslmode=disable"
+	if dsn != want {
+		t.Errorf("expected %s, got %s", want, dsn)
+	}
+	if _, err := SchemaDSN("postgres://db/orders")("a;b"); !errors.Is(err, ErrInvalidTenant) {
+		t.Errorf("expected ErrInvalidTenant, got %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package testinfra
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// Postgres starts PostgreSQL and sets DATABASE_URL, read by db.Config.
+func Postgres(t testing.TB, opts ...Option) *Container {
+	t.Helper()
+	c := start(t, spec{
+		image: "postgres:14-alpine",
+		env: map[string]string{
+			"POSTGRES_USER":     "test",
+			"POSTGRES_PASSWORD": "test",
+			"POSTGRES_DB":       "test",
+		},
+		port: "5432/tcp",
+		wait: func(port nat.Port) wait.Strategy {
+			// Postgres restarts once after initialising the database.
+			return wait.ForAll(
+				wait.ForLog("database system is ready to accept connections").WithOccurrence(2),
+				wait.ForListeningPort(port),
+			)
+		},
+	}, opts)
+	t.Setenv("DATABASE_URL", PostgresDSN(c))
+	return c
+}
+
+// PostgresDSN returns the DSN of a container started by Postgres.
+func PostgresDSN(c *Container) string {
+	return fmt.Sprintf("postgres://test:test@%s/test?sslmode=disable", c.Addr())
+}
+
+// Redis starts Redis and sets REDIS_ADDR, read by redis.Config.
+func Redis(t testing.TB, opts ...Option) *Container {
+	t.Helper()
+	c := start(t, spec{
+		image: "redis:7-alpine",
+		port:  "6379/tcp",
+		wait: func(port nat.Port) wait.Strategy {
+			return wait.ForAll(
+				wait.ForLog("Ready to accept connections"),
+				wait.ForListeningPort(port),
+			)
+		},
+	}, opts)
+	t.Setenv("REDIS_ADDR", c.Addr())
+	return c
+}
+
+// OPA starts an OPA server loaded with policies, keyed by policy ID, and
+// sets OPA_HOST and OPA_PORT, read by the authz sidecar middleware.
+func OPA(t testing.TB, policies map[string]string, opts ...Option) *Container {
+	t.Helper()
+	c := start(t, spec{
+		// Pinned to the version of the OPA library go-utils builds against
+		image: "openpolicyagent/opa:0.35.0",
+		cmd:   []string{"run", "--server", "--addr", ":8181"},
+		port:  "8181/tcp",
+		wait: func(port nat.Port) wait.Strategy {
+			return wait.ForHTTP("/health").WithPort(port)
+		},
+	}, opts)
+	for id, policy := range policies {
+		putPolicy(t, c, id, policy)
+	}
+	t.Setenv("OPA_HOST", c.Host)
+	t.Setenv("OPA_PORT", fmt.Sprint(c.Port))
+	return c
+}
+
+func putPolicy(t testing.TB, c *Container, id, policy string) {
+	t.Helper()
+	url := fmt.Sprintf("http://%s/v1/policies/%s", c.Addr(), id)
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPut, url, strings.NewReader(policy))
+	if err != nil {
+		t.Fatalf("testinfra: loading policy %s: %v", id, err)
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("testinfra: loading policy %s: %v", id, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var body bytes.Buffer
+		body.ReadFrom(resp.Body)
+		t.Fatalf("testinfra: loading policy %s: %s: %s", id, resp.Status, body.String())
+	}
+}
+
+// Jaeger starts the Jaeger all-in-one image and sets JAEGER_ENDPOINT,
+// read by tracing.Init, to its collector. Container.Port is the query
+// UI and API port.
+func Jaeger(t testing.TB, opts ...Option) *Container {
+	t.Helper()
+	c := start(t, spec{
+		image: "jaegertracing/all-in-one:1.38",
+		port:  "16686/tcp",
+		ports: []string{"14268/tcp"},
+		wait: func(port nat.Port) wait.Strategy {
+			return wait.ForHTTP("/").WithPort(port)
+		},
+	}, opts)
+	collector, err := c.MappedPort(context.Background(), "14268/tcp")
+	if err != nil {
+		t.Fatalf("testinfra: jaeger collector port: %v", err)
+	}
+	t.Setenv("JAEGER_ENDPOINT", fmt.Sprintf("http://%s:%d/api/traces", c.Host, collector.Int()))
+	return c
+}
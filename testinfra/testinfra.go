@@ -0,0 +1,158 @@
+// Package testinfra starts throwaway containers for integration tests
+// and points the config loader at them by setting the environment
+// variables the repo's Config structs read. Containers are removed when
+// the test ends. Tests are skipped under -short or when Docker is not
+// available.
+//
+//	func TestRepository(t *testing.T) {
+//		testinfra.Postgres(t)
+//		var cfg db.Config
+//		config.Load(&cfg) // DSN now points at the container
+//		...
+//	}
+//
+// As they set environment variables, the helpers can't be used from
+// parallel tests.
+//
+// testinfra is a module of its own, github.com/jdotw/go-utils/testinfra,
+// so services importing go-utils don't inherit the Docker client and
+// its dependencies.
+package testinfra
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// DefaultStartupTimeout is how long a container may take to become
+// ready.
+const DefaultStartupTimeout = 2 * time.Minute
+
+// Container is a running container.
+type Container struct {
+	testcontainers.Container
+
+	// Host and Port locate the container's main port from the test.
+	Host string
+	Port int
+}
+
+// Addr returns Host:Port.
+func (c *Container) Addr() string {
+	return net.JoinHostPort(c.Host, fmt.Sprint(c.Port))
+}
+
+// Option configures a container.
+type Option func(*options)
+
+type options struct {
+	image          string
+	env            map[string]string
+	startupTimeout time.Duration
+}
+
+// Image overrides the default image of a container.
+func Image(image string) Option {
+	return func(o *options) {
+		o.image = image
+	}
+}
+
+// Env sets environment variables in the container.
+func Env(env map[string]string) Option {
+	return func(o *options) {
+		for k, v := range env {
+			o.env[k] = v
+		}
+	}
+}
+
+// StartupTimeout overrides DefaultStartupTimeout.
+func StartupTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.startupTimeout = d
+	}
+}
+
+// spec describes a container to start.
+type spec struct {
+	image string
+	env   map[string]string
+	cmd   []string
+	port  string
+	ports []string
+	wait  func(port nat.Port) wait.Strategy
+}
+
+// start runs s until ready, terminating it when the test ends.
+func start(t testing.TB, s spec, opts []Option) *Container {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("testinfra: skipping container in short mode")
+	}
+
+	o := options{image: s.image, env: map[string]string{}, startupTimeout: DefaultStartupTimeout}
+	for k, v := range s.env {
+		o.env[k] = v
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), o.startupTimeout)
+	defer cancel()
+	requireDocker(ctx, t)
+
+	port := nat.Port(s.port)
+	c, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        o.image,
+			Env:          o.env,
+			Cmd:          s.cmd,
+			ExposedPorts: append([]string{s.port}, s.ports...),
+			WaitingFor:   s.wait(port),
+		},
+		Started: true,
+	})
+	if c != nil {
+		t.Cleanup(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := c.Terminate(ctx); err != nil {
+				t.Logf("testinfra: terminating %s: %v", o.image, err)
+			}
+		})
+	}
+	if err != nil {
+		t.Fatalf("testinfra: starting %s: %v", o.image, err)
+	}
+
+	host, err := c.Host(ctx)
+	if err != nil {
+		t.Fatalf("testinfra: %s host: %v", o.image, err)
+	}
+	mapped, err := c.MappedPort(ctx, port)
+	if err != nil {
+		t.Fatalf("testinfra: %s port: %v", o.image, err)
+	}
+	return &Container{Container: c, Host: host, Port: mapped.Int()}
+}
+
+// requireDocker skips the test when no Docker daemon is reachable.
+func requireDocker(ctx context.Context, t testing.TB) {
+	t.Helper()
+	provider, err := testcontainers.NewDockerProvider()
+	if err != nil {
+		t.Skipf("testinfra: docker not available: %v", err)
+	}
+	if err := provider.Health(ctx); err != nil {
+		t.Skipf("testinfra: docker not available: %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package testinfra
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jdotw/go-utils/config"
+	"github.com/jdotw/go-utils/redis"
+)
+
+func TestRedis(t *testing.T) {
+	c := Redis(t)
+
+	var cfg redis.Config
+	if err := config.Load(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Addr != c.Addr() {
+		t.Errorf("expected REDIS_ADDR %s, got %s", c.Addr(), cfg.Addr)
+	}
+	client, err := redis.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		t.Errorf("ping failed: %v", err)
+	}
+}
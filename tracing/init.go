@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/jdotw/go-utils/correlation"
 	"github.com/jdotw/go-utils/log"
 	"github.com/opentracing/opentracing-go"
 	"github.com/uber/jaeger-client-go/config"
@@ -13,7 +14,12 @@ import (
 	"go.uber.org/zap"
 )
 
-func Init(serviceName string, metricsFactory metrics.Factory, logger log.Factory) opentracing.Tracer {
+func Init(serviceName string, metricsFactory metrics.Factory, logger log.Factory, opts ...Option) opentracing.Tracer {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	cfg := &config.Configuration{
 		Sampler: &config.SamplerConfig{},
 	}
@@ -30,11 +36,15 @@ func Init(serviceName string, metricsFactory metrics.Factory, logger log.Factory
 	jaegerLogger := jaegerLoggerAdapter{logger.Bg()}
 
 	metricsFactory = metricsFactory.Namespace(metrics.NSOptions{Name: serviceName, Tags: nil})
-	tracer, _, err := cfg.NewTracer(
+	tracerOpts := []config.Option{
 		config.Logger(jaegerLogger),
 		config.Metrics(metricsFactory),
 		config.Observer(rpcmetrics.NewObserver(metricsFactory, rpcmetrics.DefaultNameNormalizer)),
-	)
+	}
+	if o.sampler != nil {
+		tracerOpts = append(tracerOpts, config.Sampler(o.sampler))
+	}
+	tracer, _, err := cfg.NewTracer(tracerOpts...)
 	if err != nil {
 		logger.Bg().Fatal("Failed to initialize tracer", zap.Error(err))
 	}
@@ -63,6 +73,9 @@ func NewChildSpanAndContext(ctx context.Context, tracer opentracing.Tracer, name
 	} else {
 		span = tracer.StartSpan(name)
 	}
+	if id := correlation.FromContext(ctx); id != "" {
+		span.SetTag(correlation.SpanTag, id)
+	}
 	ctx = opentracing.ContextWithSpan(ctx, span)
 	return ctx, span
 }
@@ -3,11 +3,13 @@ package tracing
 import (
 	"net/http"
 
+	"github.com/jdotw/go-utils/correlation"
 	"github.com/opentracing-contrib/go-stdlib/nethttp"
 	"github.com/opentracing/opentracing-go"
 )
 
-// Wraps http.ServeMux for tracing per request
+// Wraps http.ServeMux for tracing per request.
+// Each request is also assigned a correlation ID.
 
 func NewServeMux(tracer opentracing.Tracer) *TracedServeMux {
 	return &TracedServeMux{
@@ -24,7 +26,7 @@ type TracedServeMux struct {
 func (tm *TracedServeMux) Handle(pattern string, handler http.Handler) {
 	middleware := nethttp.Middleware(
 		tm.tracer,
-		handler,
+		correlation.Middleware(handler),
 		nethttp.OperationNameFunc(func(r *http.Request) string {
 			return "HTTP " + r.Method + " " + pattern
 		}))
@@ -0,0 +1,105 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/uber/jaeger-client-go"
+)
+
+type options struct {
+	sampler jaeger.Sampler
+}
+
+// Option configures Init.
+type Option func(*options)
+
+// WithSampler samples traces with sampler rather than the sampler
+// configured by the JAEGER_SAMPLER_* environment variables, such as a
+// Sampler whose rate is reloaded at runtime.
+func WithSampler(sampler jaeger.Sampler) Option {
+	return func(o *options) {
+		o.sampler = sampler
+	}
+}
+
+// RateFunc loads the share of traces to sample, from 0 to 1, such as from
+// config.
+type RateFunc func(ctx context.Context) (float64, error)
+
+// Sampler is a jaeger.Sampler sampling a share of traces that can be
+// changed while the tracer runs. It implements reload.Reloadable.
+type Sampler struct {
+	load RateFunc
+
+	mu      sync.RWMutex
+	rate    float64
+	sampler jaeger.Sampler
+}
+
+// NewSampler returns a Sampler sampling rate of traces, reloading the
+// rate with load.
+func NewSampler(rate float64, load RateFunc) (*Sampler, error) {
+	s := &Sampler{load: load}
+	if err := s.SetRate(rate); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Rate returns the share of traces sampled.
+func (s *Sampler) Rate() float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.rate
+}
+
+// SetRate samples rate of traces from now on. A rate of 1 samples every
+// trace and 0 none.
+func (s *Sampler) SetRate(rate float64) error {
+	var sampler jaeger.Sampler
+	switch {
+	case rate < 0 || rate > 1:
+		return fmt.Errorf("sampling rate %v is not between 0 and 1", rate)
+	case rate == 0 || rate == 1:
+		sampler = jaeger.NewConstSampler(rate == 1)
+	default:
+		p, err := jaeger.NewProbabilisticSampler(rate)
+		if err != nil {
+			return err
+		}
+		sampler = p
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rate = rate
+	s.sampler = sampler
+	return nil
+}
+
+// Reload loads the sampling rate and samples with it from now on. The
+// current rate is kept if load fails or returns an invalid rate.
+func (s *Sampler) Reload(ctx context.Context) error {
+	rate, err := s.load(ctx)
+	if err != nil {
+		return err
+	}
+	return s.SetRate(rate)
+}
+
+// IsSampled implements jaeger.Sampler.
+func (s *Sampler) IsSampled(id jaeger.TraceID, operation string) (bool, []jaeger.Tag) {
+	s.mu.RLock()
+	sampler := s.sampler
+	s.mu.RUnlock()
+	return sampler.IsSampled(id, operation)
+}
+
+// Close implements jaeger.Sampler.
+func (s *Sampler) Close() {}
+
+// Equal implements jaeger.Sampler.
+func (s *Sampler) Equal(other jaeger.Sampler) bool {
+	return s == other
+}
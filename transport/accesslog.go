@@ -0,0 +1,160 @@
+package transport
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jdotw/go-utils/log"
+	"go.uber.org/zap"
+)
+
+// Access logging
+
+// AccessLogFormat selects the text format written by AccessLogWriter.
+type AccessLogFormat int
+
+const (
+	// AccessLogCombined is the Apache/NCSA Combined Log Format.
+	AccessLogCombined AccessLogFormat = iota
+	// AccessLogCommon is the Apache/NCSA Common Log Format.
+	AccessLogCommon
+)
+
+// AccessLogOption configures NewAccessLogMiddleware.
+type AccessLogOption func(*accessLog)
+
+// AccessLogWriter additionally writes each request to w in the given
+// format, for tools such as fail2ban or GoAccess that expect it. Writes
+// are serialized, so w need not be safe for concurrent use.
+func AccessLogWriter(w io.Writer, format AccessLogFormat) AccessLogOption {
+	return func(a *accessLog) {
+		a.writer = w
+		a.format = format
+	}
+}
+
+type accessLog struct {
+	logger log.Factory
+	mu     sync.Mutex
+	writer io.Writer
+	format AccessLogFormat
+}
+
+// NewAccessLogMiddleware returns HTTP middleware that logs each request
+// once it completes, with its method, path, status, response size and
+// duration as structured fields.
+func NewAccessLogMiddleware(logger log.Factory, options ...AccessLogOption) func(http.Handler) http.Handler {
+	a := &accessLog{logger: logger}
+	for _, option := range options {
+		option(a)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			sw := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+			next.ServeHTTP(sw, r)
+			duration := time.Since(start)
+
+			a.logger.For(r.Context()).Info("HTTP request",
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.Int("status", sw.code),
+				zap.Int64("bytes", sw.bytes),
+				zap.Duration("duration", duration),
+				zap.String("remote_addr", r.RemoteAddr),
+			)
+			if a.writer != nil {
+				a.write(r, sw, start)
+			}
+		})
+	}
+}
+
+func (a *accessLog) write(r *http.Request, sw *statusRecorder, start time.Time) {
+	user := "-"
+	if u, _, ok := r.BasicAuth(); ok && u != "" {
+		user = u
+	}
+	size := "-"
+	if sw.bytes > 0 {
+		size = strconv.FormatInt(sw.bytes, 10)
+	}
+	line := fmt.Sprintf("%s - %s [%s] %q %d %s",
+		KeyByIP(r), user, start.Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method+" "+r.RequestURI+" "+r.Proto, sw.code, size)
+	if a.format == AccessLogCombined {
+		line += fmt.Sprintf(" %q %q", orDash(r.Referer()), orDash(r.UserAgent()))
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := io.WriteString(a.writer, line+"\n"); err != nil {
+		log.Warn(a.logger.Bg(), "Failed to write access log", zap.Error(err))
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// statusRecorder records the status and size of a response written
+// through a ResponseWriter.
+type statusRecorder struct {
+	http.ResponseWriter
+	code        int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.code = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush passes through to the underlying writer so streaming responses
+// still work.
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack passes through to the underlying writer so WebSocket upgrades
+// still work. A hijacked connection is logged as switching protocols.
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("transport: response writer does not support hijacking")
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil && !w.wroteHeader {
+		w.code = http.StatusSwitchingProtocols
+		w.wroteHeader = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
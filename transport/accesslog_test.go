@@ -0,0 +1,55 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/jdotw/go-utils/log"
+)
+
+func TestAccessLogCombined(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewAccessLogMiddleware(log.NewMockLogFactory(), AccessLogWriter(&buf, AccessLogCombined))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("hello"))
+		}),
+	)
+	r := httptest.NewRequest(http.MethodPost, "/widgets?x=1", nil)
+	r.Header.Set("User-Agent", "test-agent")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	re := regexp.MustCompile(`^192\.0\.2\.1 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "POST /widgets\?x=1 HTTP/1\.1" 201 5 "-" "test-agent"\n$`)
+	if !re.Match(buf.Bytes()) {
+		t.Errorf("unexpected access log line: %q", buf.String())
+	}
+}
+
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, nil
+}
+
+func TestAccessLogHijack(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewAccessLogMiddleware(log.NewMockLogFactory(), AccessLogWriter(&buf, AccessLogCommon))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, _, err := w.(http.Hijacker).Hijack(); err != nil {
+				t.Errorf("expected hijacking to pass through, got %v", err)
+			}
+		}),
+	)
+	h.ServeHTTP(hijackRecorder{httptest.NewRecorder()}, httptest.NewRequest(http.MethodGet, "/ws", nil))
+
+	if !bytes.Contains(buf.Bytes(), []byte(`"GET /ws HTTP/1.1" 101 -`)) {
+		t.Errorf("expected the hijacked request to be logged as 101, got %q", buf.String())
+	}
+}
@@ -0,0 +1,211 @@
+package transport
+
+import (
+	"context"
+	"encoding"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Binding of path variables and query parameters into tagged
+// struct fields:
+//
+//	type GetWidgetRequest struct {
+//		ID     string    `path:"id"`
+//		Limit  int       `query:"limit" default:"20"`
+//		Since  time.Time `query:"since"`
+//		Status string    `query:"status,required" enum:"active,archived"`
+//	}
+//
+// Supported field types are strings, bools, integers, floats,
+// time.Time (RFC 3339), time.Duration, slices of these for
+// repeated query parameters, and any type implementing
+// encoding.TextUnmarshaler (such as UUID and enum types).
+
+// PathVars returns the path variables for a request. It defaults to
+// gorilla/mux's Vars and may be replaced to support other routers.
+var PathVars = mux.Vars
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+)
+
+// BindParams populates the fields of the struct pointed to by dst from
+// the request's path variables and query parameters. Conversion failures
+// are returned as a *DecodeError with a 400 status.
+func BindParams(r *http.Request, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("transport: BindParams requires a pointer to a struct, got %T", dst)
+	}
+	return bindStruct(v.Elem(), PathVars(r), r.URL.Query())
+}
+
+func bindStruct(v reflect.Value, pathVars map[string]string, query url.Values) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			// Embedded structs, such as PageParams, are bound in place
+			if err := bindStruct(v.Field(i), pathVars, query); err != nil {
+				return err
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		var name string
+		var values []string
+		var required bool
+		if tag, ok := field.Tag.Lookup("path"); ok {
+			name = tag
+			required = true
+			if value, ok := pathVars[name]; ok {
+				values = []string{value}
+			}
+		} else if tag, ok := field.Tag.Lookup("query"); ok {
+			parts := strings.Split(tag, ",")
+			name = parts[0]
+			for _, opt := range parts[1:] {
+				if opt == "required" {
+					required = true
+				}
+			}
+			values = query[name]
+		} else {
+			continue
+		}
+
+		if len(values) == 0 {
+			if def, ok := field.Tag.Lookup("default"); ok {
+				values = []string{def}
+			} else if required {
+				return &DecodeError{Status: http.StatusBadRequest, Field: name, Reason: "is required"}
+			} else {
+				continue
+			}
+		}
+		if allowed, ok := field.Tag.Lookup("enum"); ok {
+			for _, value := range values {
+				if !containsString(strings.Split(allowed, ","), value) {
+					return &DecodeError{Status: http.StatusBadRequest, Field: name, Reason: "must be one of " + allowed}
+				}
+			}
+		}
+		if err := setField(v.Field(i), values); err != nil {
+			return &DecodeError{Status: http.StatusBadRequest, Field: name, Reason: err.Error(), Err: err}
+		}
+	}
+	return nil
+}
+
+// HTTPDecodeParamsRequest is a request decoder that binds path variables
+// and query parameters into a T using BindParams, then checks it with
+// the configured Validator.
+func HTTPDecodeParamsRequest[T any](ctx context.Context, r *http.Request) (interface{}, error) {
+	var request T
+	if err := BindParams(r, &request); err != nil {
+		return nil, err
+	}
+	if err := validateRequest(ctx, request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func setField(f reflect.Value, values []string) error {
+	if f.Kind() == reflect.Slice && f.Type().Elem().Kind() != reflect.Uint8 && !f.Addr().Type().Implements(textUnmarshalerType) {
+		slice := reflect.MakeSlice(f.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setValue(slice.Index(i), value); err != nil {
+				return err
+			}
+		}
+		f.Set(slice)
+		return nil
+	}
+	return setValue(f, values[0])
+}
+
+func setValue(f reflect.Value, value string) error {
+	if f.Kind() == reflect.Ptr {
+		ptr := reflect.New(f.Type().Elem())
+		if err := setValue(ptr.Elem(), value); err != nil {
+			return err
+		}
+		f.Set(ptr)
+		return nil
+	}
+	if f.CanAddr() && f.Addr().Type().Implements(textUnmarshalerType) {
+		if err := f.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("is invalid: %v", err)
+		}
+		return nil
+	}
+	switch f.Type() {
+	case timeType:
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("must be an RFC 3339 time")
+		}
+		f.Set(reflect.ValueOf(t))
+		return nil
+	case durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("must be a duration")
+		}
+		f.SetInt(int64(d))
+		return nil
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("must be a boolean")
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be an integer")
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be a non-negative integer")
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be a number")
+		}
+		f.SetFloat(n)
+	default:
+		return fmt.Errorf("has unsupported type %s", f.Type())
+	}
+	return nil
+}
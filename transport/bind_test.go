@@ -0,0 +1,71 @@
+package transport
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type colour string
+
+func (c *colour) UnmarshalText(b []byte) error {
+	switch string(b) {
+	case "red", "blue":
+		*c = colour(b)
+		return nil
+	}
+	return errors.New("unknown colour")
+}
+
+type listWidgetsRequest struct {
+	OwnerID string    `path:"owner"`
+	Limit   int       `query:"limit" default:"20"`
+	Since   time.Time `query:"since"`
+	Status  string    `query:"status" enum:"active,archived"`
+	Tags    []string  `query:"tag"`
+	Colour  *colour   `query:"colour"`
+	Active  bool      `query:"active,required"`
+}
+
+func bindRequest(t *testing.T, url string) (listWidgetsRequest, error) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, url, nil)
+	r = mux.SetURLVars(r, map[string]string{"owner": "o1"})
+	var req listWidgetsRequest
+	err := BindParams(r, &req)
+	return req, err
+}
+
+func TestBindParams(t *testing.T) {
+	req, err := bindRequest(t, "/?since=2021-01-02T03:04:05Z&status=active&tag=a&tag=b&colour=red&active=true")
+	if err != nil {
+		t.Fatalf("BindParams returned error: %s", err)
+	}
+	if req.OwnerID != "o1" || req.Limit != 20 || req.Since.Year() != 2021 || req.Status != "active" ||
+		strings.Join(req.Tags, ",") != "a,b" || req.Colour == nil || *req.Colour != "red" || !req.Active {
+		t.Errorf("unexpected bound request: %+v", req)
+	}
+
+	tests := []struct {
+		url   string
+		field string
+	}{
+		{"/?active=true&limit=ten", "limit"},
+		{"/?active=true&status=deleted", "status"},
+		{"/?active=true&colour=green", "colour"},
+		{"/?active=true&since=yesterday", "since"},
+		{"/", "active"},
+	}
+	for _, tt := range tests {
+		_, err := bindRequest(t, tt.url)
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) || decodeErr.Field != tt.field || decodeErr.Status != http.StatusBadRequest {
+			t.Errorf("expected a 400 DecodeError for %s on %s, got %v", tt.url, tt.field, err)
+		}
+	}
+}
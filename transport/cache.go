@@ -0,0 +1,160 @@
+package transport
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jdotw/go-utils/cache"
+	"github.com/jdotw/go-utils/log"
+	"go.uber.org/zap"
+)
+
+// GET response caching
+
+// ResponseCache is HTTP middleware that caches successful GET responses
+// in a cache.Store, keyed by path, query and the configured Vary request
+// headers. Cached responses carry Age and X-Cache headers; responses that
+// set cookies or Cache-Control no-store/private are never cached.
+// Requests with an Authorization header bypass the cache unless it
+// varies on Authorization, so one caller's response is never served to
+// another.
+type ResponseCache struct {
+	store  cache.Store
+	ttl    time.Duration
+	vary   []string
+	logger log.Factory
+}
+
+// ResponseCacheOption configures a ResponseCache.
+type ResponseCacheOption func(*ResponseCache)
+
+// CacheVary adds request headers whose values select different cached
+// responses, such as Accept or Authorization.
+func CacheVary(headers ...string) ResponseCacheOption {
+	return func(c *ResponseCache) {
+		for _, h := range headers {
+			c.vary = append(c.vary, http.CanonicalHeaderKey(h))
+		}
+	}
+}
+
+// NewResponseCache returns a ResponseCache keeping responses for ttl.
+func NewResponseCache(store cache.Store, ttl time.Duration, logger log.Factory, options ...ResponseCacheOption) *ResponseCache {
+	c := &ResponseCache{store: store, ttl: ttl, logger: logger}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+type cachedResponse struct {
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header"`
+	Body     []byte      `json:"body"`
+	StoredAt time.Time   `json:"stored_at"`
+}
+
+// Middleware wraps next with the cache.
+func (c *ResponseCache) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || strings.Contains(r.Header.Get("Cache-Control"), "no-store") ||
+			(r.Header.Get("Authorization") != "" && !c.varies("Authorization")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+		key := c.key(r)
+
+		if data, ok, err := c.store.Get(ctx, key); err != nil {
+			c.logger.For(ctx).Error("Failed to read response cache", zap.Error(err))
+		} else if ok {
+			var cached cachedResponse
+			if err := json.Unmarshal(data, &cached); err == nil {
+				copyHeaders(w.Header(), cached.Header)
+				w.Header().Set("Age", strconv.Itoa(int(time.Since(cached.StoredAt).Seconds())))
+				w.Header().Set("X-Cache", "HIT")
+				w.WriteHeader(cached.Status)
+				w.Write(cached.Body)
+				return
+			}
+		}
+
+		bw := newBufferedResponseWriter()
+		next.ServeHTTP(bw, r)
+		if bw.code == http.StatusOK && cacheable(bw.header) {
+			if bw.header.Get("Cache-Control") == "" {
+				bw.header.Set("Cache-Control", "max-age="+strconv.Itoa(int(c.ttl.Seconds())))
+			}
+			for _, h := range c.vary {
+				bw.header.Add("Vary", h)
+			}
+			data, _ := json.Marshal(cachedResponse{Status: bw.code, Header: bw.header, Body: bw.buf.Bytes(), StoredAt: time.Now()})
+			if err := c.store.Set(ctx, key, data, c.ttl); err != nil {
+				c.logger.For(ctx).Error("Failed to write response cache", zap.Error(err))
+			}
+		}
+		copyHeaders(w.Header(), bw.header)
+		w.Header().Set("X-Cache", "MISS")
+		w.WriteHeader(bw.code)
+		w.Write(bw.buf.Bytes())
+	})
+}
+
+// Invalidate drops every cached response for path, whatever its query
+// or varying headers. Call it after writes that change the resource.
+func (c *ResponseCache) Invalidate(ctx context.Context, path string) error {
+	return c.store.DeletePrefix(ctx, path+"?")
+}
+
+// InvalidateOnWrite returns middleware that invalidates the request path
+// after successful non-GET requests, for mounting on a resource's routes.
+func (c *ResponseCache) InvalidateOnWrite(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		sw := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		if sw.code < 300 {
+			if err := c.Invalidate(r.Context(), r.URL.Path); err != nil {
+				c.logger.For(r.Context()).Error("Failed to invalidate response cache", zap.Error(err))
+			}
+		}
+	})
+}
+
+func (c *ResponseCache) varies(header string) bool {
+	for _, h := range c.vary {
+		if h == header {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *ResponseCache) key(r *http.Request) string {
+	key := r.URL.Path + "?" + r.URL.RawQuery
+	if len(c.vary) == 0 {
+		return key
+	}
+	h := sha256.New()
+	for _, name := range c.vary {
+		h.Write([]byte(name + ":" + strings.Join(r.Header.Values(name), ",") + "\n"))
+	}
+	return key + "#" + base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:12])
+}
+
+func cacheable(h http.Header) bool {
+	if h.Get("Set-Cookie") != "" {
+		return false
+	}
+	cc := h.Get("Cache-Control")
+	return !strings.Contains(cc, "no-store") && !strings.Contains(cc, "private")
+}
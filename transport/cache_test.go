@@ -0,0 +1,75 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jdotw/go-utils/cache"
+	"github.com/jdotw/go-utils/log"
+)
+
+func TestResponseCache(t *testing.T) {
+	calls := 0
+	c := NewResponseCache(cache.NewMemoryStore(), time.Minute, log.NewMockLogFactory(), CacheVary("Accept"))
+	h := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(r.Header.Get("Accept")))
+	}))
+
+	get := func(accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/widgets?page=1", nil)
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := get("a"); w.Header().Get("X-Cache") != "MISS" || w.Header().Get("Cache-Control") != "max-age=60" {
+		t.Errorf("unexpected headers: %v", w.Header())
+	}
+	if w := get("a"); w.Header().Get("X-Cache") != "HIT" || w.Body.String() != "a" || w.Header().Get("Age") == "" {
+		t.Errorf("expected a cache hit; got %v %q", w.Header(), w.Body.String())
+	}
+	if w := get("b"); w.Body.String() != "b" {
+		t.Errorf("varying header should select a different entry; got %q", w.Body.String())
+	}
+	if calls != 2 {
+		t.Errorf("unexpected handler calls; expected 2, got %d", calls)
+	}
+
+	c.Invalidate(context.Background(), "/widgets")
+	if w := get("a"); w.Header().Get("X-Cache") != "MISS" {
+		t.Error("expected a miss after invalidation")
+	}
+}
+
+func TestResponseCacheAuthorization(t *testing.T) {
+	get := func(h http.Handler, auth string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/me", nil)
+		r.Header.Set("Authorization", auth)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	})
+
+	h := NewResponseCache(cache.NewMemoryStore(), time.Minute, log.NewMockLogFactory()).Middleware(echo)
+	get(h, "Bearer a")
+	if w := get(h, "Bearer b"); w.Body.String() != "Bearer b" || w.Header().Get("X-Cache") != "" {
+		t.Errorf("expected authorized requests to bypass the cache, got %v %q", w.Header(), w.Body.String())
+	}
+
+	h = NewResponseCache(cache.NewMemoryStore(), time.Minute, log.NewMockLogFactory(), CacheVary("Authorization")).Middleware(echo)
+	get(h, "Bearer a")
+	if w := get(h, "Bearer a"); w.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("expected a hit when varying on Authorization, got %v", w.Header())
+	}
+	if w := get(h, "Bearer b"); w.Body.String() != "Bearer b" {
+		t.Errorf("expected another caller's response not to be served, got %q", w.Body.String())
+	}
+}
@@ -0,0 +1,119 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// Strict JSON request decoding
+
+// DefaultMaxBodyBytes is the request body limit used by HTTPDecodeJSONRequest.
+const DefaultMaxBodyBytes int64 = 1 << 20
+
+// DecodeError describes why a request could not be decoded. It carries
+// the HTTP status to respond with (400, 413 or 415) and, where known,
+// the offending field.
+type DecodeError struct {
+	Status int    `json:"-"`
+	Field  string `json:"field,omitempty"`
+	Reason string `json:"reason"`
+	Err    error  `json:"-"`
+}
+
+func (e *DecodeError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("invalid request: %s: %s", e.Field, e.Reason)
+	}
+	return "invalid request: " + e.Reason
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode implements go-kit's StatusCoder.
+func (e *DecodeError) StatusCode() int {
+	return e.Status
+}
+
+// HTTPDecodeJSONRequest is a request decoder for JSON bodies of type T.
+// It requires an application/json Content-Type, rejects unknown fields
+// and trailing data, and limits the body to DefaultMaxBodyBytes. Failures
+// are returned as a *DecodeError, and the decoded request is then
+// checked by the configured Validator.
+//
+//	kithttp.NewServer(e, transport.HTTPDecodeJSONRequest[CreateWidgetRequest], ...)
+func HTTPDecodeJSONRequest[T any](ctx context.Context, r *http.Request) (interface{}, error) {
+	return decodeJSON[T](ctx, r, DefaultMaxBodyBytes)
+}
+
+// NewHTTPJSONRequestDecoder is like HTTPDecodeJSONRequest with a custom
+// body size limit.
+func NewHTTPJSONRequestDecoder[T any](maxBodyBytes int64) kithttp.DecodeRequestFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		return decodeJSON[T](ctx, r, maxBodyBytes)
+	}
+}
+
+func decodeJSON[T any](ctx context.Context, r *http.Request, maxBodyBytes int64) (T, error) {
+	var request T
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != ContentTypeJSON {
+		return request, &DecodeError{
+			Status: http.StatusUnsupportedMediaType,
+			Reason: "content type must be " + ContentTypeJSON,
+			Err:    ErrUnsupportedMediaType,
+		}
+	}
+
+	dec := json.NewDecoder(limitBody(nil, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&request); err != nil {
+		return request, jsonDecodeError(err)
+	}
+	if dec.More() {
+		return request, &DecodeError{Status: http.StatusBadRequest, Reason: "body must contain a single JSON value"}
+	}
+	return request, validateRequest(ctx, request)
+}
+
+// unknownField returns the field named by a DisallowUnknownFields
+// error. encoding/json has no typed error for this, so the message is
+// the only way to recognise it.
+func unknownField(err error) (string, bool) {
+	const prefix = "json: unknown field "
+	msg := err.Error()
+	if !strings.HasPrefix(msg, prefix) {
+		return "", false
+	}
+	return strings.Trim(strings.TrimPrefix(msg, prefix), `"`), true
+}
+
+func jsonDecodeError(err error) *DecodeError {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, io.EOF):
+		return &DecodeError{Status: http.StatusBadRequest, Reason: "body must not be empty", Err: err}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &DecodeError{Status: http.StatusBadRequest, Reason: "body contains malformed JSON", Err: err}
+	case errors.As(err, &syntaxErr):
+		return &DecodeError{Status: http.StatusBadRequest, Reason: fmt.Sprintf("body contains malformed JSON at offset %d", syntaxErr.Offset), Err: err}
+	case errors.As(err, &typeErr):
+		return &DecodeError{Status: http.StatusBadRequest, Field: typeErr.Field, Reason: "must be of type " + typeErr.Type.String(), Err: err}
+	case errors.Is(err, ErrBodyTooLarge):
+		return &DecodeError{Status: http.StatusRequestEntityTooLarge, Reason: "body is too large", Err: err}
+	}
+	if field, ok := unknownField(err); ok {
+		return &DecodeError{Status: http.StatusBadRequest, Field: field, Reason: "unknown field", Err: err}
+	}
+	return &DecodeError{Status: http.StatusBadRequest, Reason: err.Error(), Err: err}
+}
@@ -0,0 +1,99 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type createWidgetRequest struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestHTTPDecodeJSONRequest(t *testing.T) {
+	tests := []struct {
+		contentType string
+		body        string
+		status      int
+		field       string
+	}{
+		{"application/json", `{"name":"sprocket","count":2}`, 0, ""},
+		{"application/json; charset=utf-8", `{"name":"sprocket"}`, 0, ""},
+		{"text/plain", `{"name":"sprocket"}`, http.StatusUnsupportedMediaType, ""},
+		{"application/json", ``, http.StatusBadRequest, ""},
+		{"application/json", `{"name":`, http.StatusBadRequest, ""},
+		{"application/json", `{"name":"sprocket","colour":"red"}`, http.StatusBadRequest, "colour"},
+		{"application/json", `{"count":"two"}`, http.StatusBadRequest, "count"},
+		{"application/json", `{"name":"a"}{"name":"b"}`, http.StatusBadRequest, ""},
+		{"application/json", `{"name":"` + strings.Repeat("x", int(DefaultMaxBodyBytes)) + `"}`, http.StatusRequestEntityTooLarge, ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+		r.Header.Set("Content-Type", tt.contentType)
+		request, err := HTTPDecodeJSONRequest[createWidgetRequest](context.Background(), r)
+
+		if tt.status == 0 {
+			if err != nil {
+				t.Errorf("unexpected error for %.40q: %s", tt.body, err)
+			} else if request.(createWidgetRequest).Name != "sprocket" {
+				t.Errorf("unexpected request for %.40q: %+v", tt.body, request)
+			}
+			continue
+		}
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Errorf("expected a DecodeError for %.40q, got %v", tt.body, err)
+			continue
+		}
+		if decodeErr.Status != tt.status || decodeErr.Field != tt.field {
+			t.Errorf("unexpected error for %.40q; expected %d %q, got %d %q", tt.body, tt.status, tt.field, decodeErr.Status, decodeErr.Field)
+		}
+	}
+}
+
+type signupRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Plan  string `json:"plan" validate:"oneof=free pro"`
+}
+
+func TestHTTPDecodeJSONRequestValidation(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"email":"nope","plan":"gold"}`))
+	r.Header.Set("Content-Type", "application/json")
+	_, err := HTTPDecodeJSONRequest[signupRequest](context.Background(), r)
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	if len(validationErr.Fields) != 2 || validationErr.Fields[0].Field != "email" || validationErr.Fields[1].Field != "plan" {
+		t.Errorf("unexpected field errors: %+v", validationErr.Fields)
+	}
+
+	w := httptest.NewRecorder()
+	HTTPErrorEncoder(context.Background(), err, w)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"rule":"email"`) {
+		t.Errorf("expected a 400 response listing field errors, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHTTPJSONRequestDecoderLimit(t *testing.T) {
+	body := `{"name":"sprocket"}`
+	decode := NewHTTPJSONRequestDecoder[createWidgetRequest](int64(len(body)))
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	if _, err := decode(context.Background(), r); err != nil {
+		t.Errorf("expected a body at the limit to decode, got %s", err)
+	}
+
+	decode = NewHTTPJSONRequestDecoder[createWidgetRequest](int64(len(body) - 1))
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	_, err := decode(context.Background(), r)
+	if !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("expected ErrBodyTooLarge for a body over the limit, got %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/jdotw/go-utils/correlation"
+)
+
+// Response encoding hooks and envelopes
+
+// PreEncodeHook transforms a response before HTTPEncodeResponse encodes
+// it, returning the value to encode in its place. Status and headers are
+// taken from the original response, before any hooks run.
+type PreEncodeHook func(ctx context.Context, response interface{}) (interface{}, error)
+
+// PostEncodeHook runs after HTTPEncodeResponse has written a response,
+// with the original response and any encoding error.
+type PostEncodeHook func(ctx context.Context, w http.ResponseWriter, response interface{}, err error)
+
+var encodeHooks struct {
+	sync.RWMutex
+	pre  []PreEncodeHook
+	post []PostEncodeHook
+}
+
+// AddPreEncodeHook adds a hook run by HTTPEncodeResponse for the whole
+// service. Hooks run in the order added. Call it during startup.
+func AddPreEncodeHook(hook PreEncodeHook) {
+	encodeHooks.Lock()
+	defer encodeHooks.Unlock()
+	encodeHooks.pre = append(encodeHooks.pre, hook)
+}
+
+// AddPostEncodeHook adds a hook run by HTTPEncodeResponse for the whole
+// service. Hooks run in the order added. Call it during startup.
+func AddPostEncodeHook(hook PostEncodeHook) {
+	encodeHooks.Lock()
+	defer encodeHooks.Unlock()
+	encodeHooks.post = append(encodeHooks.post, hook)
+}
+
+func applyPreEncodeHooks(ctx context.Context, response interface{}) (interface{}, error) {
+	encodeHooks.RLock()
+	hooks := encodeHooks.pre
+	encodeHooks.RUnlock()
+	var err error
+	for _, hook := range hooks {
+		if response, err = hook(ctx, response); err != nil {
+			return nil, err
+		}
+	}
+	return response, nil
+}
+
+func postEncodeHooks() []PostEncodeHook {
+	encodeHooks.RLock()
+	defer encodeHooks.RUnlock()
+	return encodeHooks.post
+}
+
+// Envelope wraps a response body as {"data": ..., "meta": {...}}.
+type Envelope struct {
+	Data interface{}            `json:"data" msgpack:"data"`
+	Meta map[string]interface{} `json:"meta,omitempty" msgpack:"meta,omitempty"`
+}
+
+// EnvelopeHook is a PreEncodeHook wrapping every response in an Envelope
+// whose meta carries the request ID.
+//
+//	transport.AddPreEncodeHook(transport.EnvelopeHook)
+func EnvelopeHook(ctx context.Context, response interface{}) (interface{}, error) {
+	env := Envelope{Data: response, Meta: map[string]interface{}{}}
+	if id := correlation.FromContext(ctx); id != "" {
+		env.Meta["request_id"] = id
+	}
+	return env, nil
+}
@@ -0,0 +1,34 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jdotw/go-utils/correlation"
+)
+
+func TestEnvelopeHook(t *testing.T) {
+	defer func(pre []PreEncodeHook, post []PostEncodeHook) {
+		encodeHooks.pre, encodeHooks.post = pre, post
+	}(encodeHooks.pre, encodeHooks.post)
+
+	AddPreEncodeHook(EnvelopeHook)
+	var posted interface{}
+	AddPostEncodeHook(func(ctx context.Context, w http.ResponseWriter, response interface{}, err error) {
+		posted = response
+	})
+
+	ctx := correlation.WithRequestID(context.Background(), "abc")
+	w := httptest.NewRecorder()
+	if err := HTTPEncodeResponse(ctx, w, map[string]string{"name": "widget"}); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := `{"data":{"name":"widget"},"meta":{"request_id":"abc"}}`+"\n", w.Body.String(); want != have {
+		t.Errorf("unexpected body; expected %s, got %s", want, have)
+	}
+	if posted == nil {
+		t.Error("post-encode hook was not called")
+	}
+}
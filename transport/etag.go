@@ -0,0 +1,117 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// ETag generation and conditional GET (If-None-Match) handling
+
+type etagContextKey string
+
+const (
+	// IfNoneMatchContextKey holds the key used to store the If-None-Match header in the context.
+	IfNoneMatchContextKey etagContextKey = "IfNoneMatch"
+)
+
+// IfNoneMatchToContext moves the If-None-Match request header to context,
+// for use by encoders created with NewETagEncoder. Pass it to the server
+// as a ServerBefore option, along with kithttp.PopulateRequestContext so
+// the request method is available.
+func IfNoneMatchToContext() kithttp.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if v := r.Header.Get("If-None-Match"); v != "" {
+			return context.WithValue(ctx, IfNoneMatchContextKey, v)
+		}
+		return ctx
+	}
+}
+
+// NewETagEncoder wraps a response encoder so successful GET and HEAD
+// responses carry an ETag computed from the encoded body. When the
+// request's If-None-Match matches, a 304 Not Modified is written
+// instead of the body. Weak ETags (W/"...") are generated when weak
+// is true, for responses whose encoding may vary without the resource
+// changing.
+func NewETagEncoder(next kithttp.EncodeResponseFunc, weak bool) kithttp.EncodeResponseFunc {
+	return func(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+		if method, ok := ctx.Value(kithttp.ContextKeyRequestMethod).(string); ok &&
+			method != http.MethodGet && method != http.MethodHead {
+			return next(ctx, w, response)
+		}
+
+		bw := newBufferedResponseWriter()
+		if err := next(ctx, bw, response); err != nil {
+			return err
+		}
+		copyHeaders(w.Header(), bw.header)
+		if bw.code < 200 || bw.code > 299 {
+			w.WriteHeader(bw.code)
+			_, err := w.Write(bw.buf.Bytes())
+			return err
+		}
+
+		sum := sha256.Sum256(bw.buf.Bytes())
+		etag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+		if weak {
+			etag = "W/" + etag
+		}
+		w.Header().Set("ETag", etag)
+
+		if inm, ok := ctx.Value(IfNoneMatchContextKey).(string); ok && etagMatches(inm, etag) {
+			// A 304 carries no body or content headers
+			w.Header().Del("Content-Type")
+			w.Header().Del("Content-Length")
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+		w.WriteHeader(bw.code)
+		_, err := w.Write(bw.buf.Bytes())
+		return err
+	}
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag
+// using the weak comparison required by RFC 7232.
+func etagMatches(ifNoneMatch string, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	target := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == target {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferedResponseWriter captures a response so it can be inspected
+// before being written to the client.
+type bufferedResponseWriter struct {
+	header http.Header
+	code   int
+	buf    bytes.Buffer
+}
+
+func newBufferedResponseWriter() *bufferedResponseWriter {
+	return &bufferedResponseWriter{header: http.Header{}, code: http.StatusOK}
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	return w.buf.Write(b)
+}
+
+func (w *bufferedResponseWriter) WriteHeader(code int) {
+	w.code = code
+}
@@ -0,0 +1,47 @@
+package transport
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+func TestHTTPEncodeFileResponse(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Range", "bytes=6-10")
+	ctx := FileRequestToContext()(context.Background(), r)
+	ctx = context.WithValue(ctx, kithttp.ContextKeyRequestMethod, http.MethodGet)
+
+	w := httptest.NewRecorder()
+	err := HTTPEncodeFileResponse(ctx, w, FileResponse{
+		Body:        strings.NewReader("hello world"),
+		ContentType: "text/plain",
+		Filename:    "greeting.txt",
+	})
+	if err != nil {
+		t.Fatalf("encoder returned error: %s", err)
+	}
+	if w.Code != http.StatusPartialContent || w.Body.String() != "world" {
+		t.Errorf("expected a partial response, got %d %q", w.Code, w.Body.String())
+	}
+	if want, have := `attachment; filename=greeting.txt`, w.Header().Get("Content-Disposition"); want != have {
+		t.Errorf("unexpected Content-Disposition; expected %s, got %s", want, have)
+	}
+
+	// Non-seekable bodies are streamed in full
+	w = httptest.NewRecorder()
+	err = HTTPEncodeFileResponse(context.Background(), w, FileResponse{
+		Body: ioutil.NopCloser(strings.NewReader("streamed")),
+	})
+	if err != nil || w.Code != http.StatusOK || w.Body.String() != "streamed" {
+		t.Errorf("unexpected streamed response: %d %q %v", w.Code, w.Body.String(), err)
+	}
+	if !w.Flushed {
+		t.Error("streamed response should be flushed")
+	}
+}
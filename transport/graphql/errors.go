@@ -0,0 +1,82 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/recorderrors"
+	"github.com/jdotw/go-utils/transport"
+	"go.uber.org/zap"
+)
+
+// Errors are reported with the same taxonomy as the HTTP and gRPC
+// transports: the status comes from the transport status registry and
+// the code from errorsx, and both are added to the error's extensions
+// along with any field errors and the resource of recorderrors errors.
+// Extensions set by the resolver's own error are kept.
+
+// Extension keys added to GraphQL errors.
+const (
+	ExtensionCode     = "code"
+	ExtensionStatus   = "status"
+	ExtensionFields   = "fields"
+	ExtensionResource = "resource"
+	ExtensionID       = "id"
+)
+
+// Extensions returns the GraphQL error extensions describing err.
+func Extensions(err error) map[string]interface{} {
+	ext := map[string]interface{}{
+		ExtensionCode:   transport.ErrorCode(err),
+		ExtensionStatus: transport.HTTPStatusForError(err),
+	}
+	var fe transport.FieldErrorer
+	if errors.As(err, &fe) && len(fe.FieldErrors()) > 0 {
+		ext[ExtensionFields] = fe.FieldErrors()
+	}
+	var re *recorderrors.Error
+	if errors.As(err, &re) && re.Resource != "" {
+		ext[ExtensionResource] = re.Resource
+		ext[ExtensionID] = re.ID
+	}
+	return ext
+}
+
+// queryError returns err, rejected before execution, as a GraphQL error.
+func queryError(err error) *gqlerrors.QueryError {
+	return &gqlerrors.QueryError{
+		Err:        err,
+		Message:    transport.ErrorMessage(err),
+		Extensions: Extensions(err),
+	}
+}
+
+// mapError adds the extensions of a resolver's error to qe, replacing
+// its message with the one safe to show to clients. Errors from parsing
+// and validating the query are left unchanged.
+func (h *Handler) mapError(ctx context.Context, qe *gqlerrors.QueryError) {
+	err := qe.ResolverError
+	if err == nil {
+		return
+	}
+	qe.Message = transport.ErrorMessage(err)
+	ext := Extensions(err)
+	for k, v := range qe.Extensions {
+		ext[k] = v
+	}
+	qe.Extensions = ext
+	h.logError(ctx, err, qe)
+}
+
+// logError logs server errors, which clients may only see as an
+// internal error.
+func (h *Handler) logError(ctx context.Context, err error, qe *gqlerrors.QueryError) {
+	if status, _ := qe.Extensions[ExtensionStatus].(int); status < http.StatusInternalServerError {
+		return
+	}
+	fields := append(log.ErrorFields(err), zap.Any("path", qe.Path))
+	h.logger.For(ctx).Error("GraphQL request failed", fields...)
+}
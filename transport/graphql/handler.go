@@ -0,0 +1,131 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	graphql "github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+	"github.com/jdotw/go-utils/authn/jwt"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/transport"
+)
+
+// Serves a GraphQL schema over HTTP. Queries are executed by an
+// endpoint, so the same authentication and authorization middlewares
+// guarding the service's other endpoints guard its GraphQL API:
+//
+//	schema, err := graphql.ParseSchema(sdl, &resolver{}, tracer)
+//	h := graphql.NewHandler(schema, logger,
+//		graphql.HandlerMiddleware(authenticator.NewMiddleware(), authorizor.NewInProcessMiddleware(policy, query)))
+//	router.Handle(http.MethodPost, "/graphql", h)
+//
+// A request rejected by a middleware is answered with the status of
+// its error; resolver errors are reported in the response alongside
+// any data, with the error's code and status as extensions.
+
+// Request is a GraphQL request. It is the request passed to the
+// middlewares, so policies can match on the operation name.
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// Handler is an http.Handler executing GraphQL requests against a schema.
+type Handler struct {
+	schema      *graphql.Schema
+	logger      log.Factory
+	middlewares []endpoint.Middleware
+	e           endpoint.Endpoint
+}
+
+// HandlerOption configures a Handler.
+type HandlerOption func(*Handler)
+
+// HandlerMiddleware wraps query execution in the given endpoint
+// middlewares, outermost first, such as the JWT authenticator and OPA
+// authorizor. The bearer token is moved to the context beforehand.
+func HandlerMiddleware(middlewares ...endpoint.Middleware) HandlerOption {
+	return func(h *Handler) { h.middlewares = append(h.middlewares, middlewares...) }
+}
+
+// NewHandler returns a Handler for schema. Parse the schema with
+// ParseSchema for per-resolver tracing spans.
+func NewHandler(schema *graphql.Schema, logger log.Factory, options ...HandlerOption) *Handler {
+	h := &Handler{
+		schema: schema,
+		logger: logger,
+	}
+	for _, option := range options {
+		option(h)
+	}
+	e := h.execute
+	for i := len(h.middlewares) - 1; i >= 0; i-- {
+		e = h.middlewares[i](e)
+	}
+	h.e = e
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := jwt.HTTPAuthorizationToContext()(r.Context(), r)
+
+	req, err := decodeRequest(ctx, r)
+	if err != nil {
+		h.writeError(ctx, w, err)
+		return
+	}
+	resp, err := h.e(ctx, req)
+	if err != nil {
+		h.writeError(ctx, w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// execute runs the query, mapping resolver errors to the shared error
+// taxonomy.
+func (h *Handler) execute(ctx context.Context, request interface{}) (interface{}, error) {
+	req := request.(Request)
+	resp := h.schema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+	for _, qe := range resp.Errors {
+		h.mapError(ctx, qe)
+	}
+	return resp, nil
+}
+
+// writeError answers a request rejected before execution with the
+// status of err and a GraphQL error response.
+func (h *Handler) writeError(ctx context.Context, w http.ResponseWriter, err error) {
+	qe := queryError(err)
+	h.logError(ctx, err, qe)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(transport.HTTPStatusForError(err))
+	json.NewEncoder(w).Encode(graphql.Response{Errors: []*gqlerrors.QueryError{qe}})
+}
+
+func decodeRequest(ctx context.Context, r *http.Request) (Request, error) {
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req := Request{Query: q.Get("query"), OperationName: q.Get("operationName")}
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				return Request{}, &transport.ValidationError{Fields: []transport.FieldError{{Field: "variables", Message: "must be a JSON object"}}}
+			}
+		}
+		return req, nil
+	case http.MethodPost:
+		req, err := transport.HTTPDecodeJSONRequest[Request](ctx, r)
+		if err != nil {
+			return Request{}, err
+		}
+		return req.(Request), nil
+	default:
+		return Request{}, transport.ErrMethodNotAllowed
+	}
+}
@@ -0,0 +1,173 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/jdotw/go-utils/authn/jwt"
+	"github.com/jdotw/go-utils/errorsx"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/recorderrors"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+const testSchema = `
+	schema { query: Query }
+	type Query {
+		whoami: String!
+		widget(id: ID!): String!
+	}
+`
+
+type testResolver struct{}
+
+func (testResolver) Whoami(ctx context.Context) string {
+	return ctx.Value(jwt.JWTClaimsContextKey).(string)
+}
+
+func (testResolver) Widget(args struct{ ID string }) (string, error) {
+	if args.ID == "missing" {
+		return "", recorderrors.NotFound("widget", args.ID)
+	}
+	return "widget " + args.ID, nil
+}
+
+// fakeAuthn accepts any token and exposes it as the claims
+func fakeAuthn(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		token, ok := ctx.Value(jwt.JWTContextKey).(string)
+		if !ok {
+			return nil, jwt.ErrTokenContextMissing
+		}
+		return next(context.WithValue(ctx, jwt.JWTClaimsContextKey, token), request)
+	}
+}
+
+type testResponse struct {
+	Data   map[string]string `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+func do(t *testing.T, h http.Handler, token string, req Request) (int, testResponse) {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	r := httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	var resp testResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %s", err)
+	}
+	return w.Code, resp
+}
+
+func TestHandler(t *testing.T) {
+	tracer := mocktracer.New()
+	schema, err := ParseSchema(testSchema, &testResolver{}, tracer)
+	if err != nil {
+		t.Fatalf("ParseSchema returned error: %s", err)
+	}
+	var authorized []Request
+	authz := func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			authorized = append(authorized, request.(Request))
+			return next(ctx, request)
+		}
+	}
+	h := NewHandler(schema, log.NewMockLogFactory(), HandlerMiddleware(fakeAuthn, authz))
+
+	// Unauthenticated requests are rejected with the taxonomy's status
+	code, resp := do(t, h, "", Request{Query: "{ whoami }"})
+	if code != http.StatusUnauthorized {
+		t.Errorf("expected status 401, got %d", code)
+	}
+	if len(resp.Errors) != 1 || resp.Errors[0].Extensions["code"] != "unauthenticated" {
+		t.Errorf("expected an unauthenticated error, got %+v", resp.Errors)
+	}
+	if len(authorized) != 0 {
+		t.Errorf("expected authz not to run, got %d calls", len(authorized))
+	}
+
+	code, resp = do(t, h, "alice", Request{Query: "query Me { whoami }", OperationName: "Me"})
+	if code != http.StatusOK || resp.Data["whoami"] != "alice" || len(resp.Errors) != 0 {
+		t.Errorf("expected alice, got %d %+v", code, resp)
+	}
+	if len(authorized) != 1 || authorized[0].OperationName != "Me" {
+		t.Errorf("expected authz to see the request, got %+v", authorized)
+	}
+
+	// Resolver errors are reported with their code and status
+	tracer.Reset()
+	code, resp = do(t, h, "alice", Request{Query: `{ widget(id: "missing") }`})
+	if code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", code)
+	}
+	if len(resp.Errors) != 1 {
+		t.Fatalf("expected 1 error, got %+v", resp.Errors)
+	}
+	ext := resp.Errors[0].Extensions
+	if ext["code"] != "not_found" || ext["status"] != float64(http.StatusNotFound) || ext["resource"] != "widget" || ext["id"] != "missing" {
+		t.Errorf("unexpected extensions %+v", ext)
+	}
+
+	var fieldSpan *mocktracer.MockSpan
+	for _, span := range tracer.FinishedSpans() {
+		if span.OperationName == "graphql:Query.widget" {
+			fieldSpan = span
+		}
+	}
+	if fieldSpan == nil {
+		t.Fatalf("expected a resolver span, got %+v", tracer.FinishedSpans())
+	}
+	if fieldSpan.Tag("error") != true {
+		t.Errorf("expected the resolver span to be marked as an error")
+	}
+}
+
+func TestHandlerGet(t *testing.T) {
+	schema, err := ParseSchema(testSchema, &testResolver{}, mocktracer.New())
+	if err != nil {
+		t.Fatalf("ParseSchema returned error: %s", err)
+	}
+	h := NewHandler(schema, log.NewMockLogFactory())
+
+	r := httptest.NewRequest(http.MethodGet, `/graphql?query=query+W($id:ID!){widget(id:$id)}&variables={"id":"7"}`, nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	var resp testResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK || resp.Data["widget"] != "widget 7" {
+		t.Errorf("expected widget 7, got %d %+v", w.Code, resp)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, `/graphql?query={widget(id:"1")}&variables=nope`, nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for invalid variables, got %d", w.Code)
+	}
+}
+
+func TestExtensions(t *testing.T) {
+	ext := Extensions(errors.New("boom"))
+	if ext["code"] != errorsx.CodeInternal || ext["status"] != http.StatusInternalServerError {
+		t.Errorf("unexpected extensions %+v", ext)
+	}
+	ext = Extensions(jwt.ErrTokenExpired)
+	if ext["code"] != errorsx.CodeUnauthenticated || ext["status"] != http.StatusUnauthorized {
+		t.Errorf("unexpected extensions %+v", ext)
+	}
+}
@@ -0,0 +1,87 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+	"github.com/graph-gophers/graphql-go/introspection"
+	"github.com/graph-gophers/graphql-go/trace/tracer"
+	"github.com/jdotw/go-utils/tracing"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+)
+
+// Tracer traces GraphQL execution with an opentracing.Tracer: a span
+// for each request, and a child span for each non-trivial resolver.
+type Tracer struct {
+	tracer opentracing.Tracer
+}
+
+var (
+	_ tracer.Tracer           = Tracer{}
+	_ tracer.ValidationTracer = Tracer{}
+)
+
+// NewTracer returns a Tracer creating spans with tracer.
+func NewTracer(tracer opentracing.Tracer) Tracer {
+	return Tracer{tracer: tracer}
+}
+
+// ParseSchema parses schema with resolver, tracing execution with tracer.
+func ParseSchema(schema string, resolver interface{}, tracer opentracing.Tracer, opts ...graphql.SchemaOpt) (*graphql.Schema, error) {
+	opts = append([]graphql.SchemaOpt{graphql.Tracer(NewTracer(tracer))}, opts...)
+	return graphql.ParseSchema(schema, resolver, opts...)
+}
+
+func (t Tracer) TraceQuery(ctx context.Context, queryString string, operationName string, variables map[string]interface{}, varTypes map[string]*introspection.Type) (context.Context, func([]*gqlerrors.QueryError)) {
+	name := "graphql"
+	if operationName != "" {
+		name += ":" + operationName
+	}
+	ctx, span := tracing.NewChildSpanAndContext(ctx, t.tracer, name)
+	span.SetTag("graphql.query", queryString)
+	if operationName != "" {
+		span.SetTag("graphql.operation", operationName)
+	}
+	return ctx, func(errs []*gqlerrors.QueryError) {
+		if len(errs) > 0 {
+			ext.Error.Set(span, true)
+			for _, err := range errs {
+				span.LogFields(otlog.Error(err))
+			}
+		}
+		span.Finish()
+	}
+}
+
+func (t Tracer) TraceField(ctx context.Context, label, typeName, fieldName string, trivial bool, args map[string]interface{}) (context.Context, func(*gqlerrors.QueryError)) {
+	if trivial {
+		return ctx, func(*gqlerrors.QueryError) {}
+	}
+	ctx, span := tracing.NewChildSpanAndContext(ctx, t.tracer, fmt.Sprintf("graphql:%s.%s", typeName, fieldName))
+	span.SetTag("graphql.type", typeName)
+	span.SetTag("graphql.field", fieldName)
+	return ctx, func(err *gqlerrors.QueryError) {
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(otlog.Error(err))
+		}
+		span.Finish()
+	}
+}
+
+func (t Tracer) TraceValidation(ctx context.Context) func([]*gqlerrors.QueryError) {
+	_, span := tracing.NewChildSpanAndContext(ctx, t.tracer, "graphql:validate")
+	return func(errs []*gqlerrors.QueryError) {
+		if len(errs) > 0 {
+			ext.Error.Set(span, true)
+			for _, err := range errs {
+				span.LogFields(otlog.Error(err))
+			}
+		}
+		span.Finish()
+	}
+}
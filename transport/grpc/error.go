@@ -0,0 +1,129 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/jdotw/go-utils/correlation"
+	"github.com/jdotw/go-utils/recorderrors"
+	"github.com/jdotw/go-utils/transport"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	stdgrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// gRPC error encoding sharing the HTTP transport's error taxonomy.
+// Errors are first mapped to an HTTP status using the transport
+// status registry, then to the equivalent gRPC code, so both
+// transports report the same error identically.
+
+// EncodeError converts err into a gRPC status error. Errors that already
+// carry a gRPC status are returned unchanged. Field errors are attached
+// as a BadRequest detail and the request ID, if any, as RequestInfo.
+// recorderrors errors add their code as ErrorInfo, their resource as
+// ResourceInfo and their retry hint as RetryInfo.
+func EncodeError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if errors.Is(err, context.Canceled) {
+		return status.Error(codes.Canceled, err.Error())
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+
+	st := status.New(CodeForHTTPStatus(transport.HTTPStatusForError(err)), transport.ErrorMessage(err))
+
+	var fe transport.FieldErrorer
+	if errors.As(err, &fe) && len(fe.FieldErrors()) > 0 {
+		br := &errdetails.BadRequest{}
+		for _, f := range fe.FieldErrors() {
+			br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       f.Field,
+				Description: f.Message,
+			})
+		}
+		if withDetails, derr := st.WithDetails(br); derr == nil {
+			st = withDetails
+		}
+	}
+	if code := recorderrors.CodeOf(err); code != "" {
+		st = withDetail(st, &errdetails.ErrorInfo{Reason: string(code)})
+	}
+	var re *recorderrors.Error
+	if errors.As(err, &re) {
+		if re.Resource != "" {
+			st = withDetail(st, &errdetails.ResourceInfo{ResourceType: re.Resource, ResourceName: re.ID})
+		}
+		if re.RetryIn > 0 {
+			st = withDetail(st, &errdetails.RetryInfo{RetryDelay: durationpb.New(re.RetryIn)})
+		}
+	}
+	if id := correlation.FromContext(ctx); id != "" {
+		if withDetails, derr := st.WithDetails(&errdetails.RequestInfo{RequestId: id}); derr == nil {
+			st = withDetails
+		}
+	}
+	return st.Err()
+}
+
+func withDetail(st *status.Status, detail protoiface.MessageV1) *status.Status {
+	if withDetails, err := st.WithDetails(detail); err == nil {
+		return withDetails
+	}
+	return st
+}
+
+// UnaryServerErrorInterceptor encodes errors returned by unary handlers
+// with EncodeError.
+func UnaryServerErrorInterceptor() stdgrpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *stdgrpc.UnaryServerInfo, handler stdgrpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		return resp, EncodeError(ctx, err)
+	}
+}
+
+// StreamServerErrorInterceptor encodes errors returned by stream handlers
+// with EncodeError.
+func StreamServerErrorInterceptor() stdgrpc.StreamServerInterceptor {
+	return func(srv interface{}, ss stdgrpc.ServerStream, info *stdgrpc.StreamServerInfo, handler stdgrpc.StreamHandler) error {
+		return EncodeError(ss.Context(), handler(srv, ss))
+	}
+}
+
+// CodeForHTTPStatus maps an HTTP status code to the equivalent gRPC code.
+func CodeForHTTPStatus(code int) codes.Code {
+	switch code {
+	case http.StatusOK, http.StatusCreated, http.StatusAccepted, http.StatusNoContent:
+		return codes.OK
+	case http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	case http.StatusNotImplemented, http.StatusMethodNotAllowed:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable, http.StatusBadGateway:
+		return codes.Unavailable
+	}
+	return codes.Internal
+}
@@ -0,0 +1,93 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jdotw/go-utils/authzerrors"
+	"github.com/jdotw/go-utils/correlation"
+	"github.com/jdotw/go-utils/recorderrors"
+	"github.com/jdotw/go-utils/transport"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestEncodeError(t *testing.T) {
+	tests := []struct {
+		err  error
+		code codes.Code
+	}{
+		{recorderrors.ErrNotFound, codes.NotFound},
+		{fmt.Errorf("loading: %w", recorderrors.ErrNotFound), codes.NotFound},
+		{recorderrors.AlreadyExists("order", "1"), codes.AlreadyExists},
+		{recorderrors.PreconditionFailed("order", "1", "stale version"), codes.FailedPrecondition},
+		{recorderrors.Invalid(), codes.InvalidArgument},
+		{authzerrors.ErrDeniedByPolicy, codes.PermissionDenied},
+		{context.DeadlineExceeded, codes.DeadlineExceeded},
+		{errors.New("boom"), codes.Internal},
+		{status.Error(codes.Aborted, "aborted"), codes.Aborted},
+	}
+	for _, tt := range tests {
+		if have := status.Code(EncodeError(context.Background(), tt.err)); have != tt.code {
+			t.Errorf("unexpected code for %q; expected %s, got %s", tt.err, tt.code, have)
+		}
+	}
+}
+
+func TestEncodeErrorDetails(t *testing.T) {
+	ctx := correlation.WithRequestID(context.Background(), "abc123")
+	err := &transport.ValidationError{Fields: []transport.FieldError{{Field: "email", Message: "is required"}}}
+
+	st := status.Convert(EncodeError(ctx, err))
+	if st.Code() != codes.InvalidArgument {
+		t.Errorf("unexpected code; expected %s, got %s", codes.InvalidArgument, st.Code())
+	}
+	var sawFields, sawRequest bool
+	for _, d := range st.Details() {
+		switch d := d.(type) {
+		case *errdetails.BadRequest:
+			sawFields = len(d.FieldViolations) == 1 && d.FieldViolations[0].Field == "email"
+		case *errdetails.RequestInfo:
+			sawRequest = d.RequestId == "abc123"
+		}
+	}
+	if !sawFields || !sawRequest {
+		t.Errorf("missing error details: %v", st.Details())
+	}
+}
+
+func TestEncodeRecordErrorDetails(t *testing.T) {
+	err := fmt.Errorf("loading: %w", recorderrors.NotFound("order", "42"))
+
+	st := status.Convert(EncodeError(context.Background(), err))
+	if st.Code() != codes.NotFound {
+		t.Errorf("unexpected code; expected %s, got %s", codes.NotFound, st.Code())
+	}
+	var sawReason, sawResource bool
+	for _, d := range st.Details() {
+		switch d := d.(type) {
+		case *errdetails.ErrorInfo:
+			sawReason = d.Reason == "not_found"
+		case *errdetails.ResourceInfo:
+			sawResource = d.ResourceType == "order" && d.ResourceName == "42"
+		}
+	}
+	if !sawReason || !sawResource {
+		t.Errorf("missing error details: %v", st.Details())
+	}
+
+	st = status.Convert(EncodeError(context.Background(), recorderrors.Unavailable("replica lagging", 2*time.Second, nil)))
+	var sawRetry bool
+	for _, d := range st.Details() {
+		if d, ok := d.(*errdetails.RetryInfo); ok {
+			sawRetry = d.RetryDelay.AsDuration() == 2*time.Second
+		}
+	}
+	if st.Code() != codes.Unavailable || !sawRetry {
+		t.Errorf("expected an unavailable status with retry info, got %s %v", st.Code(), st.Details())
+	}
+}
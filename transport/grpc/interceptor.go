@@ -0,0 +1,165 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/jdotw/go-utils/authn/jwt"
+	"github.com/jdotw/go-utils/correlation"
+	"github.com/jdotw/go-utils/log"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"go.uber.org/zap"
+	stdgrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// metadataCarrier adapts grpc metadata to an opentracing TextMap carrier.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) ForeachKey(handler func(key, val string) error) error {
+	for k, vs := range c {
+		for _, v := range vs {
+			if err := handler(k, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c metadataCarrier) Set(key, val string) {
+	// grpc metadata keys must be lower case.
+	key = strings.ToLower(key)
+	c[key] = append(c[key], val)
+}
+
+// serverContext starts a server span for method, joined to the caller's
+// trace if the metadata carries one, and moves the request ID and JWT
+// from the metadata to the context.
+func serverContext(ctx context.Context, tracer opentracing.Tracer, method string) (context.Context, opentracing.Span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	parent, _ := tracer.Extract(opentracing.TextMap, metadataCarrier(md))
+	span := tracer.StartSpan(method, ext.RPCServerOption(parent))
+	ext.Component.Set(span, "grpc")
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	ctx = correlation.GRPCToContext()(ctx, md)
+	ctx = jwt.GRPCToContext()(ctx, md)
+	return ctx, span
+}
+
+func finishSpan(span opentracing.Span, err error) {
+	code := status.Code(err)
+	span.SetTag("grpc.code", code.String())
+	if isServerError(code) {
+		ext.Error.Set(span, true)
+		span.LogFields(otlog.Error(err))
+	}
+	span.Finish()
+}
+
+// UnaryServerTracingInterceptor starts a span for each call and stores
+// the request ID and bearer token from the metadata in the context.
+func UnaryServerTracingInterceptor(tracer opentracing.Tracer) stdgrpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *stdgrpc.UnaryServerInfo, handler stdgrpc.UnaryHandler) (interface{}, error) {
+		ctx, span := serverContext(ctx, tracer, info.FullMethod)
+		resp, err := handler(ctx, req)
+		finishSpan(span, err)
+		return resp, err
+	}
+}
+
+// StreamServerTracingInterceptor is the stream equivalent of
+// UnaryServerTracingInterceptor.
+func StreamServerTracingInterceptor(tracer opentracing.Tracer) stdgrpc.StreamServerInterceptor {
+	return func(srv interface{}, ss stdgrpc.ServerStream, info *stdgrpc.StreamServerInfo, handler stdgrpc.StreamHandler) error {
+		ctx, span := serverContext(ss.Context(), tracer, info.FullMethod)
+		err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		finishSpan(span, err)
+		return err
+	}
+}
+
+func logCall(ctx context.Context, logger log.Factory, method string, start time.Time, err error) {
+	code := status.Code(err)
+	fields := []zap.Field{
+		zap.String("method", method),
+		zap.String("code", code.String()),
+		zap.Duration("duration", time.Since(start)),
+	}
+	if isServerError(code) {
+		logger.For(ctx).Error("gRPC request failed", append(fields, zap.Error(err))...)
+		return
+	}
+	logger.For(ctx).Info("gRPC request", fields...)
+}
+
+// UnaryServerLoggingInterceptor logs each call with its method, status
+// code and duration. Server errors are logged at error level.
+func UnaryServerLoggingInterceptor(logger log.Factory) stdgrpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *stdgrpc.UnaryServerInfo, handler stdgrpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logCall(ctx, logger, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// StreamServerLoggingInterceptor is the stream equivalent of
+// UnaryServerLoggingInterceptor.
+func StreamServerLoggingInterceptor(logger log.Factory) stdgrpc.StreamServerInterceptor {
+	return func(srv interface{}, ss stdgrpc.ServerStream, info *stdgrpc.StreamServerInfo, handler stdgrpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		logCall(ss.Context(), logger, info.FullMethod, start, err)
+		return err
+	}
+}
+
+// UnaryServerEndpointInterceptor runs the endpoint middleware returned
+// by mw for each call's method around the handler, so the authn, authz,
+// recovery and metrics middleware written for go-kit endpoints apply to
+// gRPC services too.
+func UnaryServerEndpointInterceptor(mw func(method string) endpoint.Middleware) stdgrpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *stdgrpc.UnaryServerInfo, handler stdgrpc.UnaryHandler) (interface{}, error) {
+		return mw(info.FullMethod)(endpoint.Endpoint(handler))(ctx, req)
+	}
+}
+
+// StreamServerEndpointInterceptor is the stream equivalent of
+// UnaryServerEndpointInterceptor. The middleware sees a nil request and
+// the context it passes on becomes the stream's context.
+func StreamServerEndpointInterceptor(mw func(method string) endpoint.Middleware) stdgrpc.StreamServerInterceptor {
+	return func(srv interface{}, ss stdgrpc.ServerStream, info *stdgrpc.StreamServerInfo, handler stdgrpc.StreamHandler) error {
+		e := mw(info.FullMethod)(func(ctx context.Context, _ interface{}) (interface{}, error) {
+			return nil, handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		})
+		_, err := e(ss.Context(), nil)
+		return err
+	}
+}
+
+// serverStream overrides the context of a grpc.ServerStream.
+type serverStream struct {
+	stdgrpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// isServerError reports whether code denotes a failure of the server
+// rather than of the request.
+func isServerError(code codes.Code) bool {
+	switch code {
+	case codes.Unknown, codes.Internal, codes.Unavailable, codes.DataLoss, codes.DeadlineExceeded, codes.Unimplemented:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,275 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/metrics"
+	"github.com/jdotw/go-utils/transport"
+	"github.com/opentracing/opentracing-go"
+	"go.uber.org/zap"
+	stdgrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// gRPC server bootstrap mirroring transport.Serve. NewServer assembles a
+// grpc.Server whose interceptors, outermost first, are:
+//
+//	tracing -> logging -> error encoding -> metrics -> recovery -> authn -> authz
+//
+// so every call is traced and logged with its final status code, errors
+// use the shared error taxonomy, and panics and auth failures are counted
+// like any other error.
+
+// ServerOption configures NewServer.
+type ServerOption func(*serverConfig)
+
+type serverConfig struct {
+	authn       endpoint.Middleware
+	authz       func(method string) endpoint.Middleware
+	red         *metrics.RED
+	reflection  bool
+	grpcOptions []stdgrpc.ServerOption
+	unary       []stdgrpc.UnaryServerInterceptor
+	stream      []stdgrpc.StreamServerInterceptor
+	gracePeriod time.Duration
+	drainDelay  time.Duration
+}
+
+// Authn authenticates every call with mw, such as the JWT parser from
+// authn/jwt. The bearer token is read from the authorization metadata.
+func Authn(mw endpoint.Middleware) ServerOption {
+	return func(c *serverConfig) {
+		c.authn = mw
+	}
+}
+
+// Authz authorizes each call with the middleware returned by mw for the
+// call's full method name, such as an OPA policy per method.
+func Authz(mw func(method string) endpoint.Middleware) ServerOption {
+	return func(c *serverConfig) {
+		c.authz = mw
+	}
+}
+
+// Metrics records RED metrics for each call, labelled with the full
+// method name.
+func Metrics(red *metrics.RED) ServerOption {
+	return func(c *serverConfig) {
+		c.red = red
+	}
+}
+
+// WithoutReflection disables the server reflection service, which is
+// registered by default.
+func WithoutReflection() ServerOption {
+	return func(c *serverConfig) {
+		c.reflection = false
+	}
+}
+
+// GRPCOptions passes options through to grpc.NewServer, such as
+// credentials or message size limits.
+func GRPCOptions(opts ...stdgrpc.ServerOption) ServerOption {
+	return func(c *serverConfig) {
+		c.grpcOptions = append(c.grpcOptions, opts...)
+	}
+}
+
+// UnaryInterceptors appends interceptors that run after the standard
+// ones, just before the handler.
+func UnaryInterceptors(interceptors ...stdgrpc.UnaryServerInterceptor) ServerOption {
+	return func(c *serverConfig) {
+		c.unary = append(c.unary, interceptors...)
+	}
+}
+
+// StreamInterceptors appends stream interceptors that run after the
+// standard ones, just before the handler.
+func StreamInterceptors(interceptors ...stdgrpc.StreamServerInterceptor) ServerOption {
+	return func(c *serverConfig) {
+		c.stream = append(c.stream, interceptors...)
+	}
+}
+
+// GracePeriod sets how long in-flight calls have to finish after Serve's
+// context is done before remaining connections are closed.
+func GracePeriod(d time.Duration) ServerOption {
+	return func(c *serverConfig) {
+		c.gracePeriod = d
+	}
+}
+
+// DrainDelay keeps serving for d after Serve's context is done, with the
+// health service reporting NOT_SERVING, so load balancers stop routing
+// to the instance before it stops.
+func DrainDelay(d time.Duration) ServerOption {
+	return func(c *serverConfig) {
+		c.drainDelay = d
+	}
+}
+
+// Server is a grpc.Server with the standard health service registered.
+type Server struct {
+	*stdgrpc.Server
+
+	// Health is the standard gRPC health service. The overall status is
+	// SERVING until Serve begins shutting down; set per-service statuses
+	// with Health.SetServingStatus.
+	Health *grpchealth.Server
+
+	logger      log.Factory
+	gracePeriod time.Duration
+	drainDelay  time.Duration
+}
+
+// NewServer returns a Server with the logging, tracing, error encoding,
+// metrics, recovery, authn and authz interceptors installed, and the
+// health and reflection services registered. Register your services on
+// it and call Serve.
+func NewServer(logger log.Factory, tracer opentracing.Tracer, opts ...ServerOption) *Server {
+	c := &serverConfig{
+		reflection:  true,
+		gracePeriod: transport.DefaultGracePeriod,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	mw := c.middleware(logger)
+	unary := append([]stdgrpc.UnaryServerInterceptor{
+		UnaryServerTracingInterceptor(tracer),
+		UnaryServerLoggingInterceptor(logger),
+		UnaryServerErrorInterceptor(),
+		UnaryServerEndpointInterceptor(mw),
+	}, c.unary...)
+	stream := append([]stdgrpc.StreamServerInterceptor{
+		StreamServerTracingInterceptor(tracer),
+		StreamServerLoggingInterceptor(logger),
+		StreamServerErrorInterceptor(),
+		StreamServerEndpointInterceptor(mw),
+	}, c.stream...)
+	grpcOptions := append([]stdgrpc.ServerOption{
+		stdgrpc.ChainUnaryInterceptor(unary...),
+		stdgrpc.ChainStreamInterceptor(stream...),
+	}, c.grpcOptions...)
+
+	s := &Server{
+		Server:      stdgrpc.NewServer(grpcOptions...),
+		Health:      grpchealth.NewServer(),
+		logger:      logger,
+		gracePeriod: c.gracePeriod,
+		drainDelay:  c.drainDelay,
+	}
+	healthpb.RegisterHealthServer(s.Server, s.Health)
+	if c.reflection {
+		reflection.Register(s.Server)
+	}
+	return s
+}
+
+// unauthenticated reports whether method belongs to the health or
+// reflection services, which are served without authn and authz like
+// the HTTP health endpoints.
+func unauthenticated(method string) bool {
+	return strings.HasPrefix(method, "/grpc.health.v1.Health/") ||
+		strings.HasPrefix(method, "/grpc.reflection.")
+}
+
+// middleware returns the endpoint middleware chain for a method:
+// metrics, recovery, authn then authz.
+func (c *serverConfig) middleware(logger log.Factory) func(method string) endpoint.Middleware {
+	recovery := transport.NewRecoveryEndpointMiddleware(logger)
+	return func(method string) endpoint.Middleware {
+		var chain []endpoint.Middleware
+		if c.red != nil {
+			chain = append(chain, c.red.Middleware(method))
+		}
+		chain = append(chain, recoverAbort, recovery)
+		if unauthenticated(method) {
+			return endpoint.Chain(chain[0], chain[1:]...)
+		}
+		if c.authn != nil {
+			chain = append(chain, c.authn)
+		}
+		if c.authz != nil {
+			chain = append(chain, c.authz(method))
+		}
+		return endpoint.Chain(chain[0], chain[1:]...)
+	}
+}
+
+// recoverAbort converts http.ErrAbortHandler panics, which the shared
+// recovery middleware lets through for net/http, such as chaos aborts,
+// into Aborted errors, as grpc-go doesn't recover panics.
+func recoverAbort(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				if rec != http.ErrAbortHandler {
+					panic(rec)
+				}
+				response = nil
+				err = status.Error(codes.Aborted, "call aborted")
+			}
+		}()
+		return next(ctx, request)
+	}
+}
+
+// Serve listens on addr and serves s until ctx is done, then stops it
+// gracefully within the grace period. It returns nil after a clean
+// shutdown.
+func Serve(ctx context.Context, addr string, s *Server) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return ServeListener(ctx, ln, s)
+}
+
+// ServeListener is like Serve with an existing listener.
+func ServeListener(ctx context.Context, ln net.Listener, s *Server) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.Server.Serve(ln)
+	}()
+	s.logger.Bg().Info("gRPC server listening", zap.String("addr", ln.Addr().String()))
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	s.logger.Bg().Info("Shutting down gRPC server", zap.Duration("grace_period", s.gracePeriod))
+	s.Health.Shutdown()
+	if s.drainDelay > 0 {
+		time.Sleep(s.drainDelay)
+	}
+	stopped := make(chan struct{})
+	go func() {
+		s.Server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(s.gracePeriod):
+		log.Warn(s.logger.Bg(), "Grace period expired, closing remaining gRPC connections")
+		s.Server.Stop()
+	}
+	if err := <-errc; err != nil && !errors.Is(err, stdgrpc.ErrServerStopped) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/jdotw/go-utils/authn/jwt"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/metrics"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/prometheus/client_golang/prometheus"
+	stdgrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// echoService is a unary service reusing the health messages so the test
+// needs no generated code.
+func echoService(handler func(ctx context.Context) error) *stdgrpc.ServiceDesc {
+	return &stdgrpc.ServiceDesc{
+		ServiceName: "test.Echo",
+		HandlerType: (*interface{})(nil),
+		Methods: []stdgrpc.MethodDesc{{
+			MethodName: "Echo",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor stdgrpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(healthpb.HealthCheckRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				h := func(ctx context.Context, req interface{}) (interface{}, error) {
+					if err := handler(ctx); err != nil {
+						return nil, err
+					}
+					return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+				}
+				return interceptor(ctx, in, &stdgrpc.UnaryServerInfo{FullMethod: "/test.Echo/Echo"}, h)
+			},
+		}},
+	}
+}
+
+func requireToken(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		if _, ok := ctx.Value(jwt.JWTContextKey).(string); !ok {
+			return nil, jwt.ErrTokenContextMissing
+		}
+		return next(ctx, request)
+	}
+}
+
+func TestServer(t *testing.T) {
+	tracer := mocktracer.New()
+	reg := prometheus.NewRegistry()
+	red := metrics.NewRED(reg, "test")
+	s := NewServer(log.NewMockLogFactory(), tracer, Authn(requireToken), Metrics(red), GracePeriod(time.Second))
+	s.RegisterService(echoService(func(ctx context.Context) error {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if len(md.Get("panic")) > 0 {
+			panic("boom")
+		}
+		if len(md.Get("abort")) > 0 {
+			panic(http.ErrAbortHandler)
+		}
+		return nil
+	}), struct{}{})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- ServeListener(ctx, ln, s) }()
+
+	conn, err := stdgrpc.Dial(ln.Addr().String(), stdgrpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Health is served without a token
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("expected SERVING health, got %v, %v", resp, err)
+	}
+
+	call := func(ctx context.Context) error {
+		return conn.Invoke(ctx, "/test.Echo/Echo", &healthpb.HealthCheckRequest{}, &healthpb.HealthCheckResponse{})
+	}
+	if have := status.Code(call(context.Background())); have != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated without a token, got %s", have)
+	}
+
+	authed := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer token")
+	if err := call(authed); err != nil {
+		t.Errorf("unexpected error with a token: %v", err)
+	}
+	if have := status.Code(call(metadata.AppendToOutgoingContext(authed, "panic", "1"))); have != codes.Internal {
+		t.Errorf("expected Internal after a panic, got %s", have)
+	}
+	// An aborted call fails rather than crashing the server
+	if have := status.Code(call(metadata.AppendToOutgoingContext(authed, "abort", "1"))); have != codes.Aborted {
+		t.Errorf("expected Aborted after an abort, got %s", have)
+	}
+
+	// The unauthenticated call, the panic and the abort
+	if have := errorCount(t, reg); have != 3 {
+		t.Errorf("expected 3 errors recorded, got %v", have)
+	}
+	if have := len(tracer.FinishedSpans()); have != 5 {
+		t.Errorf("expected 5 spans, got %d", have)
+	}
+
+	cancel()
+	if err := <-errc; err != nil {
+		t.Errorf("unexpected error from ServeListener: %v", err)
+	}
+}
+
+func errorCount(t *testing.T, g prometheus.Gatherer) float64 {
+	families, err := g.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n float64
+	for _, f := range families {
+		if f.GetName() != "test_endpoint_errors_total" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			n += m.GetCounter().GetValue()
+		}
+	}
+	return n
+}
+
+func TestStreamServerEndpointInterceptor(t *testing.T) {
+	type key struct{}
+	mw := func(string) endpoint.Middleware {
+		return func(next endpoint.Endpoint) endpoint.Endpoint {
+			return func(ctx context.Context, request interface{}) (interface{}, error) {
+				return next(context.WithValue(ctx, key{}, "set"), request)
+			}
+		}
+	}
+	want := errors.New("done")
+	handler := func(srv interface{}, ss stdgrpc.ServerStream) error {
+		if ss.Context().Value(key{}) != "set" {
+			t.Error("expected the middleware's context on the stream")
+		}
+		return want
+	}
+	err := StreamServerEndpointInterceptor(mw)(nil, &serverStream{ctx: context.Background()}, &stdgrpc.StreamServerInfo{FullMethod: "/test.Echo/Stream"}, handler)
+	if !errors.Is(err, want) {
+		t.Errorf("expected the handler's error, got %v", err)
+	}
+}
@@ -3,33 +3,170 @@ package transport
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 
-	"github.com/jdotw/go-utils/authzerrors"
-	"github.com/jdotw/go-utils/recorderrors"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/jdotw/go-utils/errorsx"
+	"github.com/jdotw/go-utils/log"
+	"go.uber.org/zap"
 )
 
 // Response Encoder (Generic)
 
-func HTTPEncodeResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+// HTTPEncodeResponse writes response as JSON, or as msgpack or protobuf
+// when the request's Accept header prefers them (available when the server
+// uses kithttp.PopulateRequestContext). Responses implementing go-kit's
+// Headerer have their headers added, and responses implementing StatusCoder
+// set the status code. A 204 No Content status writes no body. Hooks added
+// with AddPreEncodeHook and AddPostEncodeHook run around the encoding.
+func HTTPEncodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) (err error) {
+	if hooks := postEncodeHooks(); len(hooks) > 0 {
+		defer func() {
+			for _, hook := range hooks {
+				hook(ctx, w, response, err)
+			}
+		}()
+	}
 	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if headerer, ok := response.(kithttp.Headerer); ok {
+		copyHeaders(w.Header(), headerer.Headers())
+	}
+	code := http.StatusOK
+	if sc, ok := response.(kithttp.StatusCoder); ok {
+		code = sc.StatusCode()
+	}
+	if code == http.StatusNoContent {
+		w.WriteHeader(code)
+		return nil
+	}
+	body, err := applyPreEncodeHooks(ctx, response)
+	if err != nil {
+		return err
+	}
+	accept, _ := ctx.Value(kithttp.ContextKeyRequestAccept).(string)
+	contentType := negotiateContentType(accept, body)
+	if contentType != ContentTypeJSON {
+		b, err := marshalResponse(contentType, body)
+		if err != nil {
+			return err
+		}
+		w.Header().Add("Content-Type", contentType)
+		w.WriteHeader(code)
+		_, err = w.Write(b)
+		return err
+	}
 	w.Header().Add("Content-Type", "application/json")
-	return json.NewEncoder(w).Encode(response)
+	w.WriteHeader(code)
+	return json.NewEncoder(w).Encode(body)
+}
+
+func copyHeaders(dst, src http.Header) {
+	for k, values := range src {
+		for _, v := range values {
+			dst.Add(k, v)
+		}
+	}
 }
 
 // Error Encoder
 
 type HTTPErrorResponse struct {
 	Error string `json:"error,omitempty"`
+	// Code is the errorsx code of the error. Resource and ID are set
+	// from recorderrors errors.
+	Code     errorsx.Code `json:"code,omitempty"`
+	Resource string       `json:"resource,omitempty"`
+	ID       string       `json:"id,omitempty"`
+	Fields   []FieldError `json:"fields,omitempty"`
 }
 
+// HTTPErrorEncoder writes err as an HTTPErrorResponse, or as problem
+// details when SetErrorFormat selected them, with the status from
+// HTTPStatusForError. Errors given a client message by errorsx show that
+// message rather than their own, and with SetErrorMessages every error
+// shows the localized message for its code. 5xx errors are logged when
+// SetErrorLogger is set.
 func HTTPErrorEncoder(ctx context.Context, err error, w http.ResponseWriter) {
-	if err == recorderrors.ErrNotFound {
-		w.WriteHeader(http.StatusNotFound)
-	} else if err == authzerrors.ErrDeniedByPolicy {
-		w.WriteHeader(http.StatusUnauthorized)
-	} else {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(HTTPErrorResponse{Error: err.Error()})
+	if errorFormat == ErrorFormatProblem {
+		HTTPProblemErrorEncoder(ctx, err, w)
+		return
+	}
+	code := errorStatusCode(err, w)
+	logServerError(ctx, err, code)
+	resp := HTTPErrorResponse{Error: errorMessage(ctx, err, w.Header()), Code: ErrorCode(err), Fields: fieldErrorsOf(err)}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if re := recordErrorOf(err); re != nil {
+		resp.Resource, resp.ID = re.Resource, re.ID
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+var errorLogger log.Factory
+
+// SetErrorLogger sets the Factory used by the error encoders to log
+// server errors (5xx), with the request's trace and request ID. Call it
+// once during startup.
+func SetErrorLogger(logger log.Factory) {
+	errorLogger = logger
+}
+
+func logServerError(ctx context.Context, err error, code int) {
+	if errorLogger == nil || code < http.StatusInternalServerError {
+		return
+	}
+	// For(ctx) already adds the trace ID of the request's span
+	fields := append(log.ErrorFields(err), zap.Int("status", code))
+	errorLogger.For(ctx).Error("Request failed", fields...)
+}
+
+// errorStatusCode returns the status code for err, honouring go-kit's
+// StatusCoder ahead of the status registry, and adds the headers of
+// errors implementing Headerer to w, along with any Retry-After.
+func errorStatusCode(err error, w http.ResponseWriter) int {
+	var headerer kithttp.Headerer
+	if errors.As(err, &headerer) {
+		copyHeaders(w.Header(), headerer.Headers())
+	}
+	code := HTTPStatusForError(err)
+	setRetryAfter(err, code, w.Header())
+	return code
+}
+
+// ErrorMessage returns the message of err that is safe to show to
+// clients, as errorsx.Message does. Errors without a code that the status
+// registry maps to a client error (4xx) keep their own message, as
+// errors are registered to describe them to clients.
+func ErrorMessage(err error) string {
+	if errorsx.CodeOf(err) == errorsx.CodeInternal {
+		if status := httpStatusForError(err); status >= 400 && status < 500 {
+			return err.Error()
+		}
+	}
+	return errorsx.Message(err)
+}
+
+// ErrorCode returns the errorsx code describing err to clients. Errors
+// without a code that the status registry maps to a status other than
+// 500 take the code of that status.
+func ErrorCode(err error) errorsx.Code {
+	code := errorsx.CodeOf(err)
+	if code == errorsx.CodeInternal {
+		if status := HTTPStatusForError(err); status != http.StatusInternalServerError {
+			return errorsx.CodeForHTTPStatus(status)
+		}
+	}
+	return code
+}
+
+// HTTPStatusForError returns the HTTP status code for err, honouring
+// go-kit's StatusCoder ahead of the status registry. Other transports
+// use it to mirror the HTTP mapping.
+func HTTPStatusForError(err error) int {
+	var sc kithttp.StatusCoder
+	if errors.As(err, &sc) {
+		return sc.StatusCode()
 	}
+	return httpStatusForError(err)
 }
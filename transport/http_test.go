@@ -0,0 +1,251 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/jdotw/go-utils/authn/jwt"
+	"github.com/jdotw/go-utils/authzerrors"
+	"github.com/jdotw/go-utils/errorsx"
+	"github.com/jdotw/go-utils/featureflag"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/recorderrors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestHTTPErrorEncoder(t *testing.T) {
+	tests := []struct {
+		err       error
+		code      int
+		message   string
+		errorCode errorsx.Code
+	}{
+		{recorderrors.ErrNotFound, http.StatusNotFound, "record not found", errorsx.CodeNotFound},
+		{fmt.Errorf("loading widget: %w", recorderrors.ErrNotFound), http.StatusNotFound, "record not found", errorsx.CodeNotFound},
+		{authzerrors.ErrDeniedByPolicy, http.StatusForbidden, "denied by policy agent", errorsx.CodePermissionDenied},
+		{jwt.ErrTokenContextMissing, http.StatusUnauthorized, "JWT not present", errorsx.CodeUnauthenticated},
+		{jwt.ErrTokenExpired, http.StatusUnauthorized, "JWT is expired", errorsx.CodeUnauthenticated},
+		{featureflag.ErrFeatureDisabled, http.StatusNotFound, "feature disabled", errorsx.CodeNotFound},
+		// Registered errors without a code take the code of their status
+		{ErrMethodNotAllowed, http.StatusMethodNotAllowed, ErrMethodNotAllowed.Error(), errorsx.CodeForHTTPStatus(http.StatusMethodNotAllowed)},
+		{ErrRequestTimeout, http.StatusRequestTimeout, ErrRequestTimeout.Error(), errorsx.CodeForHTTPStatus(http.StatusRequestTimeout)},
+		// Errors without a client message don't leak their detail
+		{errors.New("pq: connection refused"), http.StatusInternalServerError, "internal error", errorsx.CodeInternal},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		HTTPErrorEncoder(context.Background(), tt.err, w)
+
+		if w.Code != tt.code {
+			t.Errorf("unexpected status for %q; expected %d, got %d", tt.err, tt.code, w.Code)
+		}
+		if want, have := "application/json", w.Header().Get("Content-Type"); want != have {
+			t.Errorf("unexpected content type for %q; expected %s, got %s", tt.err, want, have)
+		}
+		var body HTTPErrorResponse
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Errorf("body for %q is not a JSON error response: %s", tt.err, err)
+		}
+		if body.Error != tt.message {
+			t.Errorf("unexpected error message; expected %s, got %s", tt.message, body.Error)
+		}
+		if body.Code != tt.errorCode {
+			t.Errorf("unexpected code for %q; expected %s, got %s", tt.err, tt.errorCode, body.Code)
+		}
+
+		w = httptest.NewRecorder()
+		HTTPProblemErrorEncoder(context.Background(), tt.err, w)
+		var problem ProblemDetails
+		if err := json.NewDecoder(w.Body).Decode(&problem); err != nil {
+			t.Fatalf("body for %q is not a problem document: %s", tt.err, err)
+		}
+		if problem.Code != tt.errorCode {
+			t.Errorf("unexpected problem code for %q; expected %s, got %s", tt.err, tt.errorCode, problem.Code)
+		}
+	}
+}
+
+func TestHTTPErrorEncoderRecordError(t *testing.T) {
+	w := httptest.NewRecorder()
+	HTTPErrorEncoder(context.Background(), recorderrors.Conflict("order", "42", "modified concurrently"), w)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("unexpected status; expected %d, got %d", http.StatusConflict, w.Code)
+	}
+	var body HTTPErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Code != errorsx.CodeConflict || body.Resource != "order" || body.ID != "42" {
+		t.Errorf("unexpected error response: %+v", body)
+	}
+}
+
+func TestHTTPErrorEncoderHidesInternalDetail(t *testing.T) {
+	w := httptest.NewRecorder()
+	err := errorsx.WithCode(errors.New("dial tcp 10.0.0.7:5432: connection refused"), errorsx.CodeUnavailable, "try again later")
+	HTTPErrorEncoder(context.Background(), err, w)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("unexpected status; expected %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	var body HTTPErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error != "try again later" || body.Code != errorsx.CodeUnavailable {
+		t.Errorf("unexpected error response: %+v", body)
+	}
+}
+
+func TestHTTPProblemErrorEncoder(t *testing.T) {
+	ctx := context.WithValue(context.Background(), kithttp.ContextKeyRequestPath, "/widgets/1")
+	w := httptest.NewRecorder()
+	HTTPProblemErrorEncoder(ctx, recorderrors.ErrNotFound, w)
+
+	if want, have := ProblemContentType, w.Header().Get("Content-Type"); want != have {
+		t.Errorf("unexpected content type; expected %s, got %s", want, have)
+	}
+	var problem ProblemDetails
+	if err := json.NewDecoder(w.Body).Decode(&problem); err != nil {
+		t.Fatalf("body is not a problem document: %s", err)
+	}
+	if problem.Status != http.StatusNotFound || problem.Title != "Not Found" || problem.Instance != "/widgets/1" || problem.Code != errorsx.CodeNotFound {
+		t.Errorf("unexpected problem document: %+v", problem)
+	}
+}
+
+type validationError struct{ field string }
+
+func (e *validationError) Error() string { return "invalid " + e.field }
+
+var errConflict = errors.New("conflict")
+
+// restoreErrorStatuses undoes any RegisterErrorStatus calls made by
+// the test once it finishes.
+func restoreErrorStatuses(t *testing.T) {
+	errorStatusesMu.RLock()
+	saved := append([]errorStatus(nil), errorStatuses...)
+	errorStatusesMu.RUnlock()
+	t.Cleanup(func() {
+		errorStatusesMu.Lock()
+		errorStatuses = saved
+		errorStatusesMu.Unlock()
+	})
+}
+
+func TestRegisterErrorStatus(t *testing.T) {
+	restoreErrorStatuses(t)
+	RegisterErrorStatus(errConflict, http.StatusConflict)
+	RegisterErrorStatus(reflect.TypeOf(&validationError{}), http.StatusBadRequest)
+
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{fmt.Errorf("saving: %w", errConflict), http.StatusConflict},
+		{fmt.Errorf("decoding: %w", &validationError{field: "name"}), http.StatusBadRequest},
+		{recorderrors.ErrNotFound, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if have := httpStatusForError(tt.err); have != tt.code {
+			t.Errorf("unexpected status for %q; expected %d, got %d", tt.err, tt.code, have)
+		}
+	}
+}
+
+type createdResponse struct {
+	ID string `json:"id"`
+}
+
+func (r createdResponse) StatusCode() int { return http.StatusCreated }
+
+func (r createdResponse) Headers() http.Header {
+	return http.Header{"Location": []string{"/widgets/" + r.ID}}
+}
+
+type emptyResponse struct{}
+
+func (r emptyResponse) StatusCode() int { return http.StatusNoContent }
+
+type teapotError struct{}
+
+func (e teapotError) Error() string   { return "teapot" }
+func (e teapotError) StatusCode() int { return http.StatusTeapot }
+
+func TestHTTPEncodeResponseStatusCoder(t *testing.T) {
+	w := httptest.NewRecorder()
+	if err := HTTPEncodeResponse(context.Background(), w, createdResponse{ID: "1"}); err != nil {
+		t.Fatalf("HTTPEncodeResponse returned error: %s", err)
+	}
+	if w.Code != http.StatusCreated {
+		t.Errorf("unexpected status; expected %d, got %d", http.StatusCreated, w.Code)
+	}
+	if want, have := "/widgets/1", w.Header().Get("Location"); want != have {
+		t.Errorf("unexpected Location header; expected %s, got %s", want, have)
+	}
+
+	w = httptest.NewRecorder()
+	HTTPEncodeResponse(context.Background(), w, emptyResponse{})
+	if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+		t.Errorf("expected an empty 204 response, got %d with %q", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	HTTPErrorEncoder(context.Background(), fmt.Errorf("brewing: %w", teapotError{}), w)
+	if w.Code != http.StatusTeapot {
+		t.Errorf("unexpected error status; expected %d, got %d", http.StatusTeapot, w.Code)
+	}
+}
+
+func TestETagEncoder(t *testing.T) {
+	enc := NewETagEncoder(HTTPEncodeResponse, false)
+	response := createdResponse{ID: "1"}
+
+	w := httptest.NewRecorder()
+	ctx := context.WithValue(context.Background(), kithttp.ContextKeyRequestMethod, http.MethodGet)
+	enc(ctx, w, struct{ Name string }{"widget"})
+	etag := w.Header().Get("ETag")
+	if etag == "" || w.Code != http.StatusOK || w.Body.Len() == 0 {
+		t.Fatalf("expected a 200 response with an ETag, got %d %q", w.Code, etag)
+	}
+
+	w = httptest.NewRecorder()
+	ctx = context.WithValue(ctx, IfNoneMatchContextKey, `"other", `+etag)
+	enc(ctx, w, struct{ Name string }{"widget"})
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("expected an empty 304 response, got %d with %q", w.Code, w.Body.String())
+	}
+
+	// Non-GET requests are not tagged
+	w = httptest.NewRecorder()
+	ctx = context.WithValue(context.Background(), kithttp.ContextKeyRequestMethod, http.MethodPost)
+	enc(ctx, w, response)
+	if w.Header().Get("ETag") != "" {
+		t.Error("POST responses should not carry an ETag")
+	}
+}
+
+func TestHTTPErrorEncoderLogsServerErrors(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	SetErrorLogger(log.NewFactory(zap.New(core)))
+	defer SetErrorLogger(nil)
+
+	HTTPErrorEncoder(context.Background(), recorderrors.ErrNotFound, httptest.NewRecorder())
+	HTTPErrorEncoder(context.Background(), errors.New("boom"), httptest.NewRecorder())
+
+	if want, have := 1, logs.Len(); want != have {
+		t.Fatalf("unexpected log entries; expected %d, got %d", want, have)
+	}
+	if have := logs.All()[0].ContextMap()["status"]; have != int64(http.StatusInternalServerError) {
+		t.Errorf("unexpected status field: %v", have)
+	}
+}
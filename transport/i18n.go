@@ -0,0 +1,137 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/jdotw/go-utils/errorsx"
+	"golang.org/x/text/language"
+)
+
+// Localized error messages. Once SetErrorMessages is called, the HTTP
+// error encoders describe each error with the message for its errorsx
+// code in the language the client prefers, rather than the error's own
+// text, so clients see consistent translated messages and internal
+// error text never leaves the service:
+//
+//	transport.SetErrorMessages(transport.NewErrorMessages(language.English, map[language.Tag]map[errorsx.Code]string{
+//		language.English: transport.EnglishErrorMessages,
+//		language.German: {
+//			errorsx.CodeNotFound:    "Nicht gefunden",
+//			errorsx.CodeRateLimited: "Zu viele Anfragen, bitte später erneut versuchen",
+//		},
+//	}))
+//
+// Servers pass AcceptLanguageToContext as a ServerBefore option so the
+// encoders see the request's Accept-Language header.
+
+type languageContextKey string
+
+const (
+	// AcceptLanguageContextKey holds the key used to store the
+	// Accept-Language header in the context.
+	AcceptLanguageContextKey languageContextKey = "AcceptLanguage"
+)
+
+// AcceptLanguageToContext moves the Accept-Language request header to
+// context, for the error encoders to select the language of error
+// messages.
+func AcceptLanguageToContext() kithttp.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if v := r.Header.Get("Accept-Language"); v != "" {
+			return context.WithValue(ctx, AcceptLanguageContextKey, v)
+		}
+		return ctx
+	}
+}
+
+// EnglishErrorMessages are client messages for each errorsx code.
+var EnglishErrorMessages = map[errorsx.Code]string{
+	errorsx.CodeInternal:           "Something went wrong. Please try again later.",
+	errorsx.CodeInvalidArgument:    "The request is invalid.",
+	errorsx.CodeUnauthenticated:    "Authentication is required.",
+	errorsx.CodePermissionDenied:   "You don't have permission to do that.",
+	errorsx.CodeNotFound:           "The requested resource was not found.",
+	errorsx.CodeAlreadyExists:      "The resource already exists.",
+	errorsx.CodeConflict:           "The request conflicts with the current state of the resource.",
+	errorsx.CodeValidation:         "Some fields are invalid.",
+	errorsx.CodePreconditionFailed: "The resource has changed since it was read.",
+	errorsx.CodeRateLimited:        "Too many requests. Please try again later.",
+	errorsx.CodeUnavailable:        "The service is unavailable. Please try again later.",
+	errorsx.CodeTimeout:            "The request timed out.",
+	errorsx.CodeCanceled:           "The request was canceled.",
+	errorsx.CodeUnimplemented:      "This operation is not supported.",
+}
+
+// ErrorMessages is a catalog of client messages by language and
+// errorsx code.
+type ErrorMessages struct {
+	tags     []language.Tag
+	messages []map[errorsx.Code]string
+	matcher  language.Matcher
+}
+
+// NewErrorMessages returns ErrorMessages for the languages of catalog.
+// Clients accepting none of them get the fallback language, and codes
+// missing from a language use the fallback language's message.
+func NewErrorMessages(fallback language.Tag, catalog map[language.Tag]map[errorsx.Code]string) *ErrorMessages {
+	m := &ErrorMessages{
+		tags:     []language.Tag{fallback},
+		messages: []map[errorsx.Code]string{catalog[fallback]},
+	}
+	others := make([]language.Tag, 0, len(catalog))
+	for tag := range catalog {
+		if tag != fallback {
+			others = append(others, tag)
+		}
+	}
+	sort.Slice(others, func(i, j int) bool { return others[i].String() < others[j].String() })
+	for _, tag := range others {
+		m.tags = append(m.tags, tag)
+		m.messages = append(m.messages, catalog[tag])
+	}
+	m.matcher = language.NewMatcher(m.tags)
+	return m
+}
+
+// Message returns the message for code in the language best matching
+// acceptLanguage, an Accept-Language header, along with that language.
+// Codes without a message in either that or the fallback language are
+// described by the status text of the code's HTTP status.
+func (m *ErrorMessages) Message(acceptLanguage string, code errorsx.Code) (string, language.Tag) {
+	i := 0
+	if tags, _, err := language.ParseAcceptLanguage(acceptLanguage); err == nil && len(tags) > 0 {
+		_, i, _ = m.matcher.Match(tags...)
+	}
+	if msg, ok := m.messages[i][code]; ok {
+		return msg, m.tags[i]
+	}
+	if msg, ok := m.messages[0][code]; ok {
+		return msg, m.tags[0]
+	}
+	return http.StatusText(errorsx.HTTPStatusForCode(code)), m.tags[0]
+}
+
+var errorMessages *ErrorMessages
+
+// SetErrorMessages sets the catalog used by the HTTP error encoders to
+// describe errors to clients, or nil to show errors' own messages. Call
+// it once during startup.
+func SetErrorMessages(m *ErrorMessages) {
+	errorMessages = m
+}
+
+// errorMessage returns the message describing err to the client,
+// localized by its ErrorCode when SetErrorMessages is set, and sets the
+// response's Content-Language to match.
+func errorMessage(ctx context.Context, err error, h http.Header) string {
+	if errorMessages == nil {
+		return ErrorMessage(err)
+	}
+	accept, _ := ctx.Value(AcceptLanguageContextKey).(string)
+	msg, tag := errorMessages.Message(accept, ErrorCode(err))
+	h.Set("Content-Language", tag.String())
+	return msg
+}
@@ -0,0 +1,102 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jdotw/go-utils/errorsx"
+	"github.com/jdotw/go-utils/recorderrors"
+	"golang.org/x/text/language"
+)
+
+func TestErrorMessages(t *testing.T) {
+	m := NewErrorMessages(language.English, map[language.Tag]map[errorsx.Code]string{
+		language.English: EnglishErrorMessages,
+		language.German:  {errorsx.CodeNotFound: "Nicht gefunden"},
+		language.French:  {errorsx.CodeNotFound: "Introuvable"},
+	})
+	tests := []struct {
+		accept string
+		code   errorsx.Code
+		msg    string
+		lang   string
+	}{
+		{"de-DE,de;q=0.9,en;q=0.8", errorsx.CodeNotFound, "Nicht gefunden", "de"},
+		{"fr-CA", errorsx.CodeNotFound, "Introuvable", "fr"},
+		{"en-GB;q=0.5,fr;q=0.9", errorsx.CodeNotFound, "Introuvable", "fr"},
+		{"ja", errorsx.CodeNotFound, EnglishErrorMessages[errorsx.CodeNotFound], "en"},
+		{"", errorsx.CodeNotFound, EnglishErrorMessages[errorsx.CodeNotFound], "en"},
+		{"not a header", errorsx.CodeNotFound, EnglishErrorMessages[errorsx.CodeNotFound], "en"},
+		// Codes missing from a language fall back to English
+		{"de", errorsx.CodeRateLimited, EnglishErrorMessages[errorsx.CodeRateLimited], "en"},
+		{"de", errorsx.Code("teapot"), "Internal Server Error", "en"},
+	}
+	for _, tt := range tests {
+		msg, lang := m.Message(tt.accept, tt.code)
+		if msg != tt.msg || lang.String() != tt.lang {
+			t.Errorf("%q, %s: expected %q in %s, got %q in %s", tt.accept, tt.code, tt.msg, tt.lang, msg, lang)
+		}
+	}
+}
+
+func TestHTTPErrorEncoderLocalizes(t *testing.T) {
+	SetErrorMessages(NewErrorMessages(language.English, map[language.Tag]map[errorsx.Code]string{
+		language.English: EnglishErrorMessages,
+		language.German: {
+			errorsx.CodeNotFound: "Nicht gefunden",
+			errorsx.CodeInternal: "Etwas ist schiefgelaufen",
+		},
+	}))
+	defer SetErrorMessages(nil)
+
+	r := httptest.NewRequest(http.MethodGet, "/widgets/1", nil)
+	r.Header.Set("Accept-Language", "de-CH, en;q=0.5")
+	ctx := AcceptLanguageToContext()(context.Background(), r)
+
+	tests := []struct {
+		err error
+		msg string
+	}{
+		{recorderrors.NotFound("widget", "1"), "Nicht gefunden"},
+		{errors.New("pq: relation \"widgets\" does not exist"), "Etwas ist schiefgelaufen"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		HTTPErrorEncoder(ctx, tt.err, w)
+		var body HTTPErrorResponse
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Error != tt.msg {
+			t.Errorf("expected %q for %q, got %q", tt.msg, tt.err, body.Error)
+		}
+		if want, have := "de", w.Header().Get("Content-Language"); want != have {
+			t.Errorf("unexpected Content-Language; expected %s, got %s", want, have)
+		}
+	}
+
+	// Registered errors without a code are described by their status
+	w := httptest.NewRecorder()
+	HTTPErrorEncoder(context.Background(), ErrMethodNotAllowed, w)
+	var body HTTPErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if want := EnglishErrorMessages[errorsx.CodeForHTTPStatus(http.StatusMethodNotAllowed)]; body.Error != want {
+		t.Errorf("expected %q for a 405, got %q", want, body.Error)
+	}
+
+	w = httptest.NewRecorder()
+	HTTPProblemErrorEncoder(context.Background(), recorderrors.NotFound("widget", "1"), w)
+	var problem ProblemDetails
+	if err := json.NewDecoder(w.Body).Decode(&problem); err != nil {
+		t.Fatal(err)
+	}
+	if want := EnglishErrorMessages[errorsx.CodeNotFound]; problem.Detail != want || problem.Code != errorsx.CodeNotFound {
+		t.Errorf("expected detail %q without Accept-Language, got %+v", want, problem)
+	}
+}
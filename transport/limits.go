@@ -0,0 +1,156 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrRequestTimeout is returned to clients whose request was not handled
+// within the route's timeout. It maps to a 408 status.
+var ErrRequestTimeout = errors.New("request timed out")
+
+// ErrBodyTooLarge is returned to clients whose request body exceeds the
+// route's limit. It maps to a 413 status.
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// NewTimeoutMiddleware returns HTTP middleware that bounds the wrapped
+// handler to timeout. The deadline is set on the request context so
+// downstream calls can give up early; if the handler has not finished
+// when it passes, the client receives a 408 via HTTPErrorEncoder and
+// anything the handler writes afterwards is discarded. Responses are
+// buffered, so don't use it on streaming routes such as SSE.
+func NewTimeoutMiddleware(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{header: make(http.Header)}
+			done := make(chan struct{})
+			panicked := make(chan interface{}, 1)
+			go func() {
+				defer func() {
+					if rec := recover(); rec != nil {
+						panicked <- rec
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case rec := <-panicked:
+				// Re-panic on the serving goroutine so recovery middleware sees it
+				panic(rec)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				copyHeaders(w.Header(), tw.header)
+				if tw.status == 0 {
+					tw.status = http.StatusOK
+				}
+				w.WriteHeader(tw.status)
+				w.Write(tw.body.Bytes())
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.timedOut = true
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					HTTPErrorEncoder(ctx, ErrRequestTimeout, w)
+				}
+			}
+		})
+	}
+}
+
+// timeoutWriter buffers a handler's response so it can be dropped if the
+// handler overruns its deadline.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	body     bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.status != 0 {
+		return
+	}
+	tw.status = status
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.body.Write(p)
+}
+
+// NewBodyLimitMiddleware returns HTTP middleware that caps request bodies
+// at maxBytes. Requests declaring a larger Content-Length are rejected
+// with a 413 up front; others have their body wrapped so that reading
+// past the limit fails, which the request decoders report as a 413.
+func NewBodyLimitMiddleware(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				HTTPErrorEncoder(r.Context(), ErrBodyTooLarge, w)
+				return
+			}
+			r.Body = limitBody(w, r.Body, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// limitBody is like http.MaxBytesReader, but reading past n bytes fails
+// with ErrBodyTooLarge so callers can recognise it with errors.Is. When
+// w is non-nil the connection is closed after the response, as the rest
+// of the body is not read.
+func limitBody(w http.ResponseWriter, body io.ReadCloser, n int64) io.ReadCloser {
+	return &limitedBody{ReadCloser: body, w: w, n: n}
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	w http.ResponseWriter
+	n int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.n < 0 {
+		return 0, ErrBodyTooLarge
+	}
+	// Read one byte past the limit to tell a body of exactly n bytes
+	// from a longer one
+	if int64(len(p)) > b.n+1 {
+		p = p[:b.n+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.n -= int64(n)
+	if b.n < 0 {
+		if b.w != nil {
+			b.w.Header().Set("Connection", "close")
+		}
+		return n + int(b.n), ErrBodyTooLarge
+	}
+	return n, err
+}
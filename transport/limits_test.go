@@ -0,0 +1,59 @@
+package transport
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeoutMiddleware(t *testing.T) {
+	h := NewTimeoutMiddleware(10 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		w.Write([]byte("too late"))
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusRequestTimeout {
+		t.Errorf("unexpected status; expected %d, got %d", http.StatusRequestTimeout, w.Code)
+	}
+	if strings.Contains(w.Body.String(), "too late") {
+		t.Error("writes after the timeout should be discarded")
+	}
+
+	h = NewTimeoutMiddleware(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Test", "1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("ok"))
+	}))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusCreated || w.Body.String() != "ok" || w.Header().Get("X-Test") != "1" {
+		t.Errorf("unexpected response; got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	h := NewBodyLimitMiddleware(4)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			HTTPErrorEncoder(r.Context(), jsonDecodeError(err), w)
+		}
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("too long")))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("unexpected status; expected %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+
+	// Without a Content-Length the limit is enforced while reading
+	r := httptest.NewRequest(http.MethodPost, "/", io.NopCloser(strings.NewReader("too long")))
+	r.ContentLength = -1
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("unexpected status; expected %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+}
@@ -0,0 +1,210 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// multipart/form-data upload decoding
+
+// MultipartOptions limits and configures upload decoding.
+type MultipartOptions struct {
+	// MaxBytes limits the whole request body. Defaults to 32 MB.
+	MaxBytes int64
+
+	// MaxValueBytes limits each non-file form value. Defaults to 64 kB.
+	MaxValueBytes int64
+
+	// AllowedTypes restricts the sniffed content type of each file,
+	// e.g. "image/png" or "image/*". Empty allows any type.
+	AllowedTypes []string
+
+	// TempDir is where HTTPDecodeMultipartRequest spools files.
+	// Defaults to os.TempDir().
+	TempDir string
+}
+
+func (o MultipartOptions) withDefaults() MultipartOptions {
+	if o.MaxBytes <= 0 {
+		o.MaxBytes = 32 << 20
+	}
+	if o.MaxValueBytes <= 0 {
+		o.MaxValueBytes = 64 << 10
+	}
+	return o
+}
+
+// FilePart describes an uploaded file.
+type FilePart struct {
+	Field    string `json:"field"`
+	Filename string `json:"filename"`
+
+	// ContentType is sniffed from the file's content, while
+	// DeclaredContentType is what the client sent.
+	ContentType         string `json:"content_type"`
+	DeclaredContentType string `json:"declared_content_type,omitempty"`
+
+	// Size is only known once the file has been read, so it is zero
+	// in StreamMultipart callbacks.
+	Size int64 `json:"size"`
+
+	// Path of the spooled file, set by HTTPDecodeMultipartRequest.
+	Path string `json:"-"`
+}
+
+// Open opens a file spooled by HTTPDecodeMultipartRequest.
+func (f FilePart) Open() (*os.File, error) {
+	return os.Open(f.Path)
+}
+
+// MultipartRequest is the result of HTTPDecodeMultipartRequest.
+type MultipartRequest struct {
+	Values map[string][]string
+	Files  []FilePart
+}
+
+// RemoveAll deletes the spooled files. Call it once the endpoint is done
+// with them.
+func (m *MultipartRequest) RemoveAll() error {
+	var firstErr error
+	for _, f := range m.Files {
+		if err := os.Remove(f.Path); err != nil && firstErr == nil && !os.IsNotExist(err) {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// StreamMultipart reads a multipart/form-data request part by part without
+// buffering files. Form values are passed to onValue and each file to
+// onFile along with a reader positioned at its start; the reader is only
+// valid until onFile returns. Either callback may be nil.
+func StreamMultipart(r *http.Request, opts MultipartOptions, onValue func(name, value string) error, onFile func(part FilePart, body io.Reader) error) error {
+	opts = opts.withDefaults()
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		return &DecodeError{Status: http.StatusUnsupportedMediaType, Reason: "content type must be multipart/form-data", Err: ErrUnsupportedMediaType}
+	}
+	r.Body = limitBody(nil, r.Body, opts.MaxBytes)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return &DecodeError{Status: http.StatusBadRequest, Reason: err.Error(), Err: err}
+	}
+
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return multipartError(err)
+		}
+		name := p.FormName()
+		if p.FileName() == "" {
+			value, err := ioutil.ReadAll(io.LimitReader(p, opts.MaxValueBytes+1))
+			if err != nil {
+				return multipartError(err)
+			}
+			if int64(len(value)) > opts.MaxValueBytes {
+				return &DecodeError{Status: http.StatusRequestEntityTooLarge, Field: name, Reason: "value is too large"}
+			}
+			if onValue != nil {
+				if err := onValue(name, string(value)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		// Sniff the content type from the first 512 bytes
+		head := make([]byte, 512)
+		n, err := io.ReadFull(p, head)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return multipartError(err)
+		}
+		head = head[:n]
+		part := FilePart{
+			Field:               name,
+			Filename:            p.FileName(),
+			ContentType:         http.DetectContentType(head),
+			DeclaredContentType: p.Header.Get("Content-Type"),
+		}
+		if !contentTypeAllowed(part.ContentType, opts.AllowedTypes) {
+			return &DecodeError{Status: http.StatusUnsupportedMediaType, Field: name, Reason: "file type " + part.ContentType + " is not allowed"}
+		}
+		if onFile != nil {
+			if err := onFile(part, io.MultiReader(bytes.NewReader(head), p)); err != nil {
+				return multipartError(err)
+			}
+		}
+	}
+}
+
+// HTTPDecodeMultipartRequest returns a request decoder that spools uploaded
+// files to temporary files and returns a *MultipartRequest describing them.
+// The endpoint is responsible for calling RemoveAll.
+func HTTPDecodeMultipartRequest(opts MultipartOptions) kithttp.DecodeRequestFunc {
+	return func(_ context.Context, r *http.Request) (interface{}, error) {
+		req := &MultipartRequest{Values: map[string][]string{}}
+		err := StreamMultipart(r, opts,
+			func(name, value string) error {
+				req.Values[name] = append(req.Values[name], value)
+				return nil
+			},
+			func(part FilePart, body io.Reader) error {
+				f, err := ioutil.TempFile(opts.TempDir, "upload-*")
+				if err != nil {
+					return err
+				}
+				part.Path = f.Name()
+				part.Size, err = io.Copy(f, body)
+				// Record the file before checking errors so RemoveAll cleans it up
+				req.Files = append(req.Files, part)
+				if cerr := f.Close(); err == nil {
+					err = cerr
+				}
+				return err
+			})
+		if err != nil {
+			req.RemoveAll()
+			return nil, err
+		}
+		return req, nil
+	}
+}
+
+func contentTypeAllowed(contentType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	for _, a := range allowed {
+		if a == mediaType {
+			return true
+		}
+		if strings.HasSuffix(a, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(a, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+func multipartError(err error) error {
+	var decodeErr *DecodeError
+	if errors.As(err, &decodeErr) {
+		return err
+	}
+	if errors.Is(err, ErrBodyTooLarge) {
+		return &DecodeError{Status: http.StatusRequestEntityTooLarge, Reason: "body is too large", Err: err}
+	}
+	return &DecodeError{Status: http.StatusBadRequest, Reason: err.Error(), Err: err}
+}
@@ -0,0 +1,63 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func multipartRequest(t *testing.T, file []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("title", "avatar")
+	fw, _ := mw.CreateFormFile("image", "avatar.png")
+	fw.Write(file)
+	mw.Close()
+	r := httptest.NewRequest(http.MethodPost, "/", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func TestHTTPDecodeMultipartRequest(t *testing.T) {
+	dec := HTTPDecodeMultipartRequest(MultipartOptions{AllowedTypes: []string{"image/*"}, TempDir: t.TempDir()})
+
+	request, err := dec(context.Background(), multipartRequest(t, pngHeader))
+	if err != nil {
+		t.Fatalf("decoder returned error: %s", err)
+	}
+	req := request.(*MultipartRequest)
+	defer req.RemoveAll()
+
+	if req.Values["title"][0] != "avatar" || len(req.Files) != 1 {
+		t.Fatalf("unexpected request: %+v", req)
+	}
+	f := req.Files[0]
+	if f.ContentType != "image/png" || f.Size != int64(len(pngHeader)) || f.Filename != "avatar.png" {
+		t.Errorf("unexpected file metadata: %+v", f)
+	}
+	if content, _ := ioutil.ReadFile(f.Path); !bytes.Equal(content, pngHeader) {
+		t.Errorf("spooled file content does not match upload")
+	}
+
+	// Disallowed types are rejected
+	_, err = dec(context.Background(), multipartRequest(t, []byte("plain text")))
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) || decodeErr.Status != http.StatusUnsupportedMediaType {
+		t.Errorf("expected a 415 DecodeError, got %v", err)
+	}
+
+	// Oversized bodies are rejected
+	dec = HTTPDecodeMultipartRequest(MultipartOptions{MaxBytes: 100, TempDir: t.TempDir()})
+	_, err = dec(context.Background(), multipartRequest(t, bytes.Repeat([]byte("x"), 1000)))
+	if !errors.As(err, &decodeErr) || decodeErr.Status != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected a 413 DecodeError, got %v", err)
+	}
+}
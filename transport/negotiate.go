@@ -0,0 +1,150 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// Content negotiation between JSON, msgpack and protobuf
+
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeMsgpack  = "application/msgpack"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// ErrUnsupportedMediaType is returned by request decoders when the
+// request body's Content-Type cannot be decoded. It maps to a 415 status.
+var ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+// negotiateContentType picks the response content type from an Accept
+// header. Protobuf is only chosen for responses that are proto messages.
+func negotiateContentType(accept string, response interface{}) string {
+	_, isProto := response.(proto.Message)
+	for _, mediaType := range parseAccept(accept) {
+		switch mediaType {
+		case ContentTypeJSON, "application/*", "*/*":
+			return ContentTypeJSON
+		case ContentTypeMsgpack, "application/x-msgpack":
+			return ContentTypeMsgpack
+		case ContentTypeProtobuf, "application/protobuf":
+			if isProto {
+				return ContentTypeProtobuf
+			}
+		}
+	}
+	return ContentTypeJSON
+}
+
+// parseAccept returns the media types in an Accept header ordered by
+// descending quality, excluding those with q=0.
+func parseAccept(accept string) []string {
+	type weighted struct {
+		mediaType string
+		q         float64
+	}
+	var types []weighted
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			types = append(types, weighted{mediaType, q})
+		}
+	}
+	sort.SliceStable(types, func(i, j int) bool { return types[i].q > types[j].q })
+	result := make([]string, len(types))
+	for i, t := range types {
+		result[i] = t.mediaType
+	}
+	return result
+}
+
+func marshalResponse(contentType string, response interface{}) ([]byte, error) {
+	switch contentType {
+	case ContentTypeMsgpack:
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		enc.SetCustomStructTag("json")
+		err := enc.Encode(response)
+		return buf.Bytes(), err
+	case ContentTypeProtobuf:
+		return proto.Marshal(response.(proto.Message))
+	}
+	return json.Marshal(response)
+}
+
+// NewHTTPRequestDecoder returns a request decoder that decodes the body
+// into the value returned by newRequest according to the request's
+// Content-Type: JSON (the default when absent), msgpack, or protobuf
+// when the value is a proto message. The decoded value is then checked
+// by the configured Validator.
+func NewHTTPRequestDecoder(newRequest func() interface{}) kithttp.DecodeRequestFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		request := newRequest()
+		if err := decodeBody(r, request); err != nil {
+			return nil, err
+		}
+		if err := validateRequest(ctx, request); err != nil {
+			return nil, err
+		}
+		return request, nil
+	}
+}
+
+func decodeBody(r *http.Request, v interface{}) error {
+	contentType := ContentTypeJSON
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err != nil {
+			return ErrUnsupportedMediaType
+		}
+		contentType = mediaType
+	}
+	switch contentType {
+	case ContentTypeJSON:
+		return json.NewDecoder(r.Body).Decode(v)
+	case ContentTypeMsgpack, "application/x-msgpack":
+		dec := msgpack.NewDecoder(r.Body)
+		dec.SetCustomStructTag("json")
+		return dec.Decode(v)
+	case ContentTypeProtobuf, "application/protobuf":
+		m, ok := v.(proto.Message)
+		if !ok {
+			return ErrUnsupportedMediaType
+		}
+		b, err := ioutil.ReadAll(io.LimitReader(r.Body, maxProtobufBody+1))
+		if err != nil {
+			return err
+		}
+		if len(b) > maxProtobufBody {
+			return ErrBodyTooLarge
+		}
+		return proto.Unmarshal(b, m)
+	}
+	return ErrUnsupportedMediaType
+}
+
+// maxProtobufBody limits protobuf request bodies, which are read whole.
+// Larger bodies fail with ErrBodyTooLarge.
+const maxProtobufBody = 32 << 20
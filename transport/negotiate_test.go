@@ -0,0 +1,100 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type widget struct {
+	Name string `json:"name"`
+}
+
+func TestNegotiateContentType(t *testing.T) {
+	tests := []struct {
+		accept   string
+		response interface{}
+		want     string
+	}{
+		{"", widget{}, ContentTypeJSON},
+		{"application/msgpack", widget{}, ContentTypeMsgpack},
+		{"application/json;q=0.5, application/msgpack", widget{}, ContentTypeMsgpack},
+		{"application/x-protobuf", widget{}, ContentTypeJSON},
+		{"application/x-protobuf", wrapperspb.String("x"), ContentTypeProtobuf},
+		{"application/msgpack;q=0, */*", widget{}, ContentTypeJSON},
+	}
+	for _, tt := range tests {
+		if have := negotiateContentType(tt.accept, tt.response); have != tt.want {
+			t.Errorf("unexpected content type for %q; expected %s, got %s", tt.accept, tt.want, have)
+		}
+	}
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	ctx := context.WithValue(context.Background(), kithttp.ContextKeyRequestAccept, ContentTypeMsgpack)
+	w := httptest.NewRecorder()
+	if err := HTTPEncodeResponse(ctx, w, widget{Name: "sprocket"}); err != nil {
+		t.Fatalf("HTTPEncodeResponse returned error: %s", err)
+	}
+	if want, have := ContentTypeMsgpack, w.Header().Get("Content-Type"); want != have {
+		t.Fatalf("unexpected content type; expected %s, got %s", want, have)
+	}
+	var raw map[string]interface{}
+	if err := msgpack.Unmarshal(w.Body.Bytes(), &raw); err != nil || raw["name"] != "sprocket" {
+		t.Fatalf("response is not msgpack using json field names: %v %v", raw, err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(w.Body.Bytes()))
+	r.Header.Set("Content-Type", ContentTypeMsgpack)
+	decoded, err := NewHTTPRequestDecoder(func() interface{} { return &widget{} })(context.Background(), r)
+	if err != nil {
+		t.Fatalf("decoder returned error: %s", err)
+	}
+	if decoded.(*widget).Name != "sprocket" {
+		t.Errorf("unexpected decoded request: %+v", decoded)
+	}
+}
+
+func TestProtobufBodyLimit(t *testing.T) {
+	decode := NewHTTPRequestDecoder(func() interface{} { return &wrapperspb.StringValue{} })
+	tests := []struct {
+		name string
+		body []byte
+		err  error
+	}{
+		{"within limit", mustMarshalProto(t, wrapperspb.String("sprocket")), nil},
+		{"too large", []byte(strings.Repeat("x", maxProtobufBody+1)), ErrBodyTooLarge},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tt.body))
+		r.Header.Set("Content-Type", ContentTypeProtobuf)
+		decoded, err := decode(context.Background(), r)
+		if err != tt.err {
+			t.Errorf("%s: expected error %v, got %v", tt.name, tt.err, err)
+			continue
+		}
+		if err == nil && decoded.(*wrapperspb.StringValue).GetValue() != "sprocket" {
+			t.Errorf("%s: unexpected decoded request: %v", tt.name, decoded)
+		}
+	}
+	if status := HTTPStatusForError(ErrBodyTooLarge); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected a 413, got %d", status)
+	}
+}
+
+func mustMarshalProto(t *testing.T, m proto.Message) []byte {
+	t.Helper()
+	b, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
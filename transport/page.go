@@ -0,0 +1,164 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/jdotw/go-utils/page"
+)
+
+// Standard pagination envelope for list endpoints
+
+// PageParams are the pagination query parameters accepted by list
+// endpoints. Embed it in a request struct decoded with
+// HTTPDecodeParamsRequest, or decode it alone with DecodePageParams.
+// The page, limit and sort parameters, and their limits, are those of
+// PageRequest. Cursor, when present, takes precedence over Page.
+type PageParams struct {
+	PageRequest
+	Cursor string `json:"cursor,omitempty" query:"cursor"`
+}
+
+// PageRequest selects a page of a list and its order. It is the same
+// type as model.PageRequest, defined in the page package so transport
+// needn't import model.
+type PageRequest = page.Request
+
+// DecodePageParams binds and validates the pagination query parameters.
+func DecodePageParams(r *http.Request) (PageParams, error) {
+	var p PageParams
+	if err := BindParams(r, &p); err != nil {
+		return p, err
+	}
+	return p, validateRequest(r.Context(), p)
+}
+
+// PageInfo describes the position of a page within a list. It is shared
+// with the model package so model.PageResponse is Paginated too.
+type PageInfo = page.Info
+
+// Paginated is implemented by paged responses, letting
+// HTTPEncodePageResponse add Link headers.
+type Paginated interface {
+	PageInfo() PageInfo
+}
+
+// Page is the standard paginated response envelope. Total is omitted
+// when counting is too expensive; cursor-paginated lists set NextCursor
+// instead of Page.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	Total      *int64 `json:"total,omitempty"`
+	Page       int    `json:"page,omitempty"`
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+}
+
+// NewPage returns an offset paginated response for params.
+// Pass a negative total when it is unknown.
+func NewPage[T any](items []T, total int64, params PageParams) Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+	p := Page[T]{Items: items, Page: params.Page, Limit: params.Limit}
+	if total >= 0 {
+		p.Total = &total
+	}
+	return p
+}
+
+// NewCursorPage returns a cursor paginated response.
+func NewCursorPage[T any](items []T, nextCursor, prevCursor string, limit int) Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+	return Page[T]{Items: items, Limit: limit, NextCursor: nextCursor, PrevCursor: prevCursor}
+}
+
+func (p Page[T]) PageInfo() PageInfo {
+	return PageInfo{
+		Total:      p.Total,
+		Page:       p.Page,
+		Limit:      p.Limit,
+		Count:      len(p.Items),
+		NextCursor: p.NextCursor,
+		PrevCursor: p.PrevCursor,
+	}
+}
+
+// HTTPEncodePageResponse encodes a Paginated response with HTTPEncodeResponse,
+// adding RFC 8288 Link headers for the first, previous, next and last pages.
+// The links are relative to the request URI, which is available when the
+// server uses kithttp.PopulateRequestContext.
+func HTTPEncodePageResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if p, ok := response.(Paginated); ok {
+		if uri, ok := ctx.Value(kithttp.ContextKeyRequestURI).(string); ok {
+			if link := pageLinks(uri, p.PageInfo()); link != "" {
+				w.Header().Set("Link", link)
+			}
+		}
+	}
+	return HTTPEncodeResponse(ctx, w, response)
+}
+
+func pageLinks(uri string, info PageInfo) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return ""
+	}
+	var links []string
+	link := func(rel string, set map[string]string) {
+		q := u.Query()
+		for k, v := range set {
+			if v == "" {
+				q.Del(k)
+			} else {
+				q.Set(k, v)
+			}
+		}
+		lu := *u
+		lu.RawQuery = q.Encode()
+		links = append(links, "<"+lu.String()+`>; rel="`+rel+`"`)
+	}
+	limit := strconv.Itoa(info.Limit)
+
+	if info.NextCursor != "" || info.PrevCursor != "" {
+		if info.PrevCursor != "" {
+			link("prev", map[string]string{"cursor": info.PrevCursor, "limit": limit, "page": ""})
+		}
+		if info.NextCursor != "" {
+			link("next", map[string]string{"cursor": info.NextCursor, "limit": limit, "page": ""})
+		}
+		return strings.Join(links, ", ")
+	}
+
+	if info.Page < 1 || info.Limit < 1 {
+		return ""
+	}
+	page := func(n int) map[string]string {
+		return map[string]string{"page": strconv.Itoa(n), "limit": limit, "cursor": ""}
+	}
+	link("first", page(1))
+	if info.Page > 1 {
+		link("prev", page(info.Page-1))
+	}
+	if info.Total != nil {
+		last := int((*info.Total + int64(info.Limit) - 1) / int64(info.Limit))
+		if last < 1 {
+			last = 1
+		}
+		if info.Page < last {
+			link("next", page(info.Page+1))
+		}
+		link("last", page(last))
+	} else if info.Count == info.Limit {
+		// Without a total, a full page implies there may be more
+		link("next", page(info.Page+1))
+	}
+	return strings.Join(links, ", ")
+}
@@ -0,0 +1,70 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/jdotw/go-utils/model"
+)
+
+type listRequest struct {
+	PageParams
+	Status string `query:"status"`
+}
+
+func TestDecodePageParams(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/widgets?page=3&sort=-name&cursor=abc&status=active", nil)
+	request, err := HTTPDecodeParamsRequest[listRequest](context.Background(), r)
+	if err != nil {
+		t.Fatalf("decoder returned error: %s", err)
+	}
+	req := request.(listRequest)
+	if req.Page != 3 || req.Limit != 20 || req.Sort != "-name" || req.Cursor != "abc" || req.Status != "active" || req.Offset() != 40 {
+		t.Errorf("unexpected page params: %+v", req)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/widgets?limit=1000", nil)
+	if _, err := DecodePageParams(r); err == nil {
+		t.Error("expected an error for a limit above the maximum")
+	}
+}
+
+func TestHTTPEncodePageResponse(t *testing.T) {
+	ctx := context.WithValue(context.Background(), kithttp.ContextKeyRequestURI, "/widgets?page=2&limit=2&status=active")
+	page := NewPage([]string{"c", "d"}, 5, PageParams{PageRequest: PageRequest{Page: 2, Limit: 2}})
+
+	w := httptest.NewRecorder()
+	if err := HTTPEncodePageResponse(ctx, w, page); err != nil {
+		t.Fatalf("encoder returned error: %s", err)
+	}
+	link := w.Header().Get("Link")
+	for _, want := range []string{
+		`</widgets?limit=2&page=1&status=active>; rel="first"`,
+		`</widgets?limit=2&page=1&status=active>; rel="prev"`,
+		`</widgets?limit=2&page=3&status=active>; rel="next"`,
+		`</widgets?limit=2&page=3&status=active>; rel="last"`,
+	} {
+		if !strings.Contains(link, want) {
+			t.Errorf("Link header %q does not contain %q", link, want)
+		}
+	}
+	if !strings.Contains(w.Body.String(), `"total":5`) {
+		t.Errorf("unexpected body: %s", w.Body.String())
+	}
+}
+
+func TestHTTPEncodePageResponseModel(t *testing.T) {
+	ctx := context.WithValue(context.Background(), kithttp.ContextKeyRequestURI, "/widgets?page=2&limit=10")
+	w := httptest.NewRecorder()
+	page := model.NewPageResponse([]string{"a"}, 25, model.PageRequest{Page: 2, Limit: 10})
+	if err := HTTPEncodePageResponse(ctx, w, page); err != nil {
+		t.Fatal(err)
+	}
+	if link := w.Header().Get("Link"); !strings.Contains(link, `page=3>; rel="last"`) {
+		t.Errorf("unexpected Link header: %s", link)
+	}
+}
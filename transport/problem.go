@@ -0,0 +1,99 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/jdotw/go-utils/errorsx"
+	"github.com/jdotw/go-utils/recorderrors"
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+)
+
+// RFC 7807 Problem Details error encoding
+
+const ProblemContentType = "application/problem+json"
+
+type ProblemDetails struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	TraceID  string `json:"trace_id,omitempty"`
+
+	// Code, Resource and ResourceID are extension members: the errorsx
+	// code of the error, and the record of recorderrors errors.
+	Code       errorsx.Code `json:"code,omitempty"`
+	Resource   string       `json:"resource,omitempty"`
+	ResourceID string       `json:"resource_id,omitempty"`
+
+	// Errors lists invalid request fields, as an extension member.
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// ErrorFormat selects the body written by HTTPErrorEncoder.
+type ErrorFormat int
+
+const (
+	// ErrorFormatJSON writes an HTTPErrorResponse. This is the default.
+	ErrorFormatJSON ErrorFormat = iota
+
+	// ErrorFormatProblem writes RFC 7807 ProblemDetails.
+	ErrorFormatProblem
+)
+
+var errorFormat = ErrorFormatJSON
+
+// SetErrorFormat selects the error body format used by HTTPErrorEncoder
+// for the whole service. Call it once during startup.
+func SetErrorFormat(format ErrorFormat) {
+	errorFormat = format
+}
+
+// HTTPProblemErrorEncoder writes err as application/problem+json.
+// The instance is the request path when the go-kit server was created
+// with kithttp.ServerBefore(kithttp.PopulateRequestContext).
+func HTTPProblemErrorEncoder(ctx context.Context, err error, w http.ResponseWriter) {
+	code := errorStatusCode(err, w)
+	logServerError(ctx, err, code)
+	problem := ProblemDetails{
+		Type:    "about:blank",
+		Title:   http.StatusText(code),
+		Status:  code,
+		Detail:  errorMessage(ctx, err, w.Header()),
+		TraceID: traceIDFromContext(ctx),
+		Code:    ErrorCode(err),
+		Errors:  fieldErrorsOf(err),
+	}
+	if re := recordErrorOf(err); re != nil {
+		problem.Resource, problem.ResourceID = re.Resource, re.ID
+	}
+	if path, ok := ctx.Value(kithttp.ContextKeyRequestPath).(string); ok {
+		problem.Instance = path
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(problem)
+}
+
+func traceIDFromContext(ctx context.Context) string {
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		if jaegerCtx, ok := span.Context().(jaeger.SpanContext); ok {
+			return jaegerCtx.TraceID().String()
+		}
+	}
+	return ""
+}
+
+// recordErrorOf returns the recorderrors.Error in err's chain, or nil.
+func recordErrorOf(err error) *recorderrors.Error {
+	var re *recorderrors.Error
+	if errors.As(err, &re) {
+		return re
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package transport
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/ratelimit"
+	"go.uber.org/zap"
+)
+
+// RateLimitKeyFunc derives the rate limit key for an HTTP request.
+// Returning an empty key exempts the request from limiting.
+type RateLimitKeyFunc func(r *http.Request) string
+
+// KeyByIP keys requests by the client's IP address as seen by the server.
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// KeyByForwardedIP keys requests by the first address in X-Forwarded-For,
+// falling back to KeyByIP. Only use it behind a proxy that sets the header,
+// as clients can otherwise spoof it.
+func KeyByForwardedIP(r *http.Request) string {
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		return strings.TrimSpace(strings.Split(xff, ",")[0])
+	}
+	return KeyByIP(r)
+}
+
+// NewRateLimitMiddleware returns HTTP middleware that limits requests per
+// key. Limited requests receive a 429 with Retry-After via HTTPErrorEncoder;
+// allowed requests carry X-RateLimit headers. For per-subject limits, which
+// need the parsed JWT, use ratelimit.NewMiddleware on the endpoint instead.
+func NewRateLimitMiddleware(limiter ratelimit.Limiter, key RateLimitKeyFunc, logger log.Factory) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k := key(r)
+			if k == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx := r.Context()
+			result, err := limiter.Allow(ctx, k)
+			if err != nil {
+				logger.For(ctx).Error("Rate limiter failed, allowing request", zap.Error(err))
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !result.Allowed {
+				logger.For(ctx).Info("Rate limit exceeded", zap.String("key", k))
+				HTTPErrorEncoder(ctx, &ratelimit.LimitExceededError{Result: result}, w)
+				return
+			}
+			ratelimit.SetHeaders(w.Header(), result)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
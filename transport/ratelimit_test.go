@@ -0,0 +1,31 @@
+package transport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/ratelimit"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	h := NewRateLimitMiddleware(ratelimit.NewMemoryLimiter(ratelimit.PerMinute(1)), KeyByIP, log.NewMockLogFactory())(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "1" {
+		t.Errorf("first request should be allowed, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("unexpected status; expected %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if want, have := "60", w.Header().Get("Retry-After"); want != have {
+		t.Errorf("unexpected Retry-After; expected %s, got %s", want, have)
+	}
+}
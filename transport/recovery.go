@@ -0,0 +1,70 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/jdotw/go-utils/log"
+	"github.com/opentracing/opentracing-go"
+	tag "github.com/opentracing/opentracing-go/ext"
+)
+
+// ErrPanicRecovered is returned to clients in place of a recovered panic,
+// so the panic value is logged but never leaked. It maps to a 500 status.
+var ErrPanicRecovered = errors.New("internal server error")
+
+// NewRecoveryMiddleware returns HTTP middleware that recovers panics in the
+// wrapped handler, logs them with a stack trace, marks the active span as
+// errored and responds with a 500 via HTTPErrorEncoder.
+func NewRecoveryMiddleware(logger log.Factory) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				if rec == http.ErrAbortHandler {
+					// Deliberate abort, let net/http handle it
+					panic(rec)
+				}
+				ctx := r.Context()
+				recordPanic(ctx, logger, rec)
+				HTTPErrorEncoder(ctx, ErrPanicRecovered, w)
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// NewRecoveryEndpointMiddleware returns endpoint middleware that recovers
+// panics, logs them with a stack trace, marks the active span as errored
+// and returns ErrPanicRecovered. Like NewRecoveryMiddleware, it lets
+// http.ErrAbortHandler through, so servers other than net/http must
+// recover it themselves, as the grpc package's server does.
+func NewRecoveryEndpointMiddleware(logger log.Factory) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			defer func() {
+				if rec := recover(); rec != nil {
+					if rec == http.ErrAbortHandler {
+						panic(rec)
+					}
+					recordPanic(ctx, logger, rec)
+					response = nil
+					err = ErrPanicRecovered
+				}
+			}()
+			return next(ctx, request)
+		}
+	}
+}
+
+func recordPanic(ctx context.Context, logger log.Factory, rec interface{}) {
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		tag.Error.Set(span, true)
+	}
+	log.LogPanic(ctx, logger, rec)
+}
@@ -0,0 +1,46 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jdotw/go-utils/log"
+)
+
+func TestRecoveryMiddleware(t *testing.T) {
+	h := NewRecoveryMiddleware(log.NewMockLogFactory())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("something went wrong")
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("unexpected status; expected %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestRecoveryEndpointMiddleware(t *testing.T) {
+	e := NewRecoveryEndpointMiddleware(log.NewMockLogFactory())(func(ctx context.Context, request interface{}) (interface{}, error) {
+		panic("something went wrong")
+	})
+
+	response, err := e(context.Background(), struct{}{})
+	if response != nil || err != ErrPanicRecovered {
+		t.Errorf("expected ErrPanicRecovered, got %v, %v", response, err)
+	}
+}
+
+func TestRecoveryEndpointMiddlewarePassesAborts(t *testing.T) {
+	e := NewRecoveryEndpointMiddleware(log.NewMockLogFactory())(func(ctx context.Context, request interface{}) (interface{}, error) {
+		panic(http.ErrAbortHandler)
+	})
+
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Errorf("expected http.ErrAbortHandler to be re-panicked, got %v", rec)
+		}
+	}()
+	e(context.Background(), struct{}{})
+}
@@ -0,0 +1,49 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	w := httptest.NewRecorder()
+	HTTPErrorEncoder(context.Background(), &UnavailableError{RetryIn: 1500 * time.Millisecond}, w)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "2" {
+		t.Errorf("unexpected response; got %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// Maintenance mode supplies the interval for errors without one
+	restoreErrorStatuses(t)
+	RegisterErrorStatus(errTestUnavailable, http.StatusServiceUnavailable)
+	SetMaintenance(time.Minute)
+	defer ClearMaintenance()
+	w = httptest.NewRecorder()
+	HTTPErrorEncoder(context.Background(), errTestUnavailable, w)
+	if want, have := "60", w.Header().Get("Retry-After"); want != have {
+		t.Errorf("unexpected Retry-After; expected %q, got %q", want, have)
+	}
+}
+
+var errTestUnavailable = errors.New("unavailable")
+
+func TestMaintenanceMiddleware(t *testing.T) {
+	h := NewMaintenanceMiddleware("/livez")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	SetMaintenance(30 * time.Second)
+	defer ClearMaintenance()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/widgets", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "30" {
+		t.Errorf("unexpected response; got %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("exempt path should be served; got %d", w.Code)
+	}
+}
@@ -0,0 +1,115 @@
+package transport
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Method routing with 405 and automatic OPTIONS responses
+
+// ErrMethodNotAllowed is returned to clients using a method a route does
+// not handle. It maps to a 405 status.
+var ErrMethodNotAllowed = errors.New("method not allowed")
+
+// MethodHandler dispatches requests to a handler per HTTP method. GET
+// handlers also serve HEAD. OPTIONS is answered with the Allow header
+// unless registered explicitly, and other methods receive a 405 with
+// Allow via HTTPErrorEncoder.
+type MethodHandler map[string]http.Handler
+
+func (m MethodHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h, ok := m[r.Method]; ok {
+		h.ServeHTTP(w, r)
+		return
+	}
+	if h, ok := m[http.MethodGet]; ok && r.Method == http.MethodHead {
+		h.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Allow", m.allow())
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	HTTPErrorEncoder(r.Context(), ErrMethodNotAllowed, w)
+}
+
+func (m MethodHandler) allow() string {
+	methods := make([]string, 0, len(m)+2)
+	for method := range m {
+		methods = append(methods, method)
+	}
+	if _, ok := m[http.MethodGet]; ok {
+		if _, ok := m[http.MethodHead]; !ok {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	if _, ok := m[http.MethodOptions]; !ok {
+		methods = append(methods, http.MethodOptions)
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
+
+// Router registers handlers by method and pattern on an underlying mux,
+// such as a tracing.TracedServeMux or http.ServeMux, grouping them into
+// a MethodHandler per pattern. Register all routes before serving.
+//
+//	router := transport.NewRouter(tracing.NewServeMux(tracer))
+//	router.Handle(http.MethodGet, "/widgets", listWidgetsHandler)
+//	router.Handle(http.MethodPost, "/widgets", createWidgetHandler)
+type Router struct {
+	mux    Mux
+	routes map[string]MethodHandler
+}
+
+// Mux is the subset of http.ServeMux used by Router.
+type Mux interface {
+	Handle(pattern string, handler http.Handler)
+	ServeHTTP(w http.ResponseWriter, r *http.Request)
+}
+
+// NewRouter returns a Router registering routes on mux.
+func NewRouter(mux Mux) *Router {
+	return &Router{mux: mux, routes: make(map[string]MethodHandler)}
+}
+
+// Handle registers handler for method requests to pattern.
+func (rt *Router) Handle(method, pattern string, handler http.Handler) {
+	mh, ok := rt.routes[pattern]
+	if !ok {
+		mh = MethodHandler{}
+		rt.routes[pattern] = mh
+		rt.mux.Handle(pattern, mh)
+	}
+	mh[strings.ToUpper(method)] = handler
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mux.ServeHTTP(w, r)
+}
+
+// Route is a method and pattern registered on a Router.
+type Route struct {
+	Method  string
+	Pattern string
+}
+
+// Routes returns the registered routes sorted by pattern, then method.
+func (rt *Router) Routes() []Route {
+	var routes []Route
+	for pattern, mh := range rt.routes {
+		for method := range mh {
+			routes = append(routes, Route{Method: method, Pattern: pattern})
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
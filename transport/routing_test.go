@@ -0,0 +1,35 @@
+package transport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+	router := NewRouter(http.NewServeMux())
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	router.Handle(http.MethodGet, "/widgets", ok)
+	router.Handle(http.MethodPost, "/widgets", ok)
+
+	tests := []struct {
+		method string
+		status int
+		allow  string
+	}{
+		{http.MethodGet, http.StatusOK, ""},
+		{http.MethodHead, http.StatusOK, ""},
+		{http.MethodOptions, http.StatusNoContent, "GET, HEAD, OPTIONS, POST"},
+		{http.MethodDelete, http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS, POST"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tt.method, "/widgets", nil))
+		if w.Code != tt.status {
+			t.Errorf("%s: unexpected status; expected %d, got %d", tt.method, tt.status, w.Code)
+		}
+		if have := w.Header().Get("Allow"); have != tt.allow {
+			t.Errorf("%s: unexpected Allow; expected %q, got %q", tt.method, tt.allow, have)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/jdotw/go-utils/health"
+	"github.com/jdotw/go-utils/log"
+	"github.com/opentracing/opentracing-go"
+	"go.uber.org/zap"
+)
+
+// Graceful HTTP server bootstrap
+
+// Defaults applied by Serve.
+const (
+	DefaultReadHeaderTimeout = 10 * time.Second
+	DefaultReadTimeout       = 30 * time.Second
+	DefaultWriteTimeout      = 60 * time.Second
+	DefaultIdleTimeout       = 120 * time.Second
+	DefaultGracePeriod       = 30 * time.Second
+)
+
+// ServeOption configures Serve.
+type ServeOption func(*serveConfig)
+
+type serveConfig struct {
+	server      *http.Server
+	gracePeriod time.Duration
+	drainDelay  time.Duration
+	signals     []os.Signal
+	logger      log.Factory
+	tracer      opentracing.Tracer
+	health      *health.Registry
+	closers     []io.Closer
+}
+
+// ServeTimeouts overrides the server's read, write and idle timeouts.
+// A zero value leaves the corresponding default in place.
+func ServeTimeouts(read, write, idle time.Duration) ServeOption {
+	return func(c *serveConfig) {
+		if read > 0 {
+			c.server.ReadTimeout = read
+		}
+		if write > 0 {
+			c.server.WriteTimeout = write
+		}
+		if idle > 0 {
+			c.server.IdleTimeout = idle
+		}
+	}
+}
+
+// ServeGracePeriod sets how long in-flight requests have to finish after a
+// shutdown signal before remaining connections are closed.
+func ServeGracePeriod(d time.Duration) ServeOption {
+	return func(c *serveConfig) {
+		c.gracePeriod = d
+	}
+}
+
+// ServeDrainDelay keeps accepting requests for d after a shutdown signal,
+// with /readyz failing, so load balancers stop routing to the instance
+// before its listener closes. Use it with ServeHealth.
+func ServeDrainDelay(d time.Duration) ServeOption {
+	return func(c *serveConfig) {
+		c.drainDelay = d
+	}
+}
+
+// ServeSignals overrides the signals that trigger shutdown, which default
+// to SIGINT and SIGTERM.
+func ServeSignals(signals ...os.Signal) ServeOption {
+	return func(c *serveConfig) {
+		c.signals = signals
+	}
+}
+
+// ServeLogger logs server lifecycle events and syncs the logger on exit.
+func ServeLogger(logger log.Factory) ServeOption {
+	return func(c *serveConfig) {
+		c.logger = logger
+	}
+}
+
+// ServeTracer closes the tracer on exit, flushing buffered spans, if it
+// implements io.Closer as the Jaeger tracer does.
+func ServeTracer(tracer opentracing.Tracer) ServeOption {
+	return func(c *serveConfig) {
+		c.tracer = tracer
+	}
+}
+
+// ServeHealth marks the registry as draining on shutdown so /readyz fails.
+func ServeHealth(registry *health.Registry) ServeOption {
+	return func(c *serveConfig) {
+		c.health = registry
+	}
+}
+
+// ServeClosers closes additional resources on exit, after the server has
+// stopped and before the tracer and logger are flushed.
+func ServeClosers(closers ...io.Closer) ServeOption {
+	return func(c *serveConfig) {
+		c.closers = append(c.closers, closers...)
+	}
+}
+
+// ServeHTTPServer applies fn to the underlying http.Server before it
+// starts, for settings not covered by the other options.
+func ServeHTTPServer(fn func(*http.Server)) ServeOption {
+	return func(c *serveConfig) {
+		fn(c.server)
+	}
+}
+
+// Serve listens on addr and serves handler until ctx is cancelled or a
+// shutdown signal arrives, then drains connections within the grace
+// period and flushes tracing and logging before returning. It returns nil
+// after a clean shutdown.
+//
+//	err := transport.Serve(ctx, ":8080", mux,
+//		transport.ServeLogger(logger),
+//		transport.ServeTracer(tracer),
+//		transport.ServeHealth(checks),
+//	)
+func Serve(ctx context.Context, addr string, handler http.Handler, opts ...ServeOption) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return ServeListener(ctx, ln, handler, opts...)
+}
+
+// ServeListener is like Serve with an existing listener.
+func ServeListener(ctx context.Context, ln net.Listener, handler http.Handler, opts ...ServeOption) error {
+	c := &serveConfig{
+		server: &http.Server{
+			Handler:           handler,
+			ReadHeaderTimeout: DefaultReadHeaderTimeout,
+			ReadTimeout:       DefaultReadTimeout,
+			WriteTimeout:      DefaultWriteTimeout,
+			IdleTimeout:       DefaultIdleTimeout,
+		},
+		gracePeriod: DefaultGracePeriod,
+		signals:     []os.Signal{os.Interrupt, syscall.SIGTERM},
+		logger:      log.NewMockLogFactory(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	defer c.flush()
+
+	ctx, stop := signal.NotifyContext(ctx, c.signals...)
+	defer stop()
+
+	if c.server.TLSConfig != nil {
+		ln = tls.NewListener(ln, c.server.TLSConfig)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.server.Serve(ln)
+	}()
+	c.logger.Bg().Info("HTTP server listening", zap.String("addr", ln.Addr().String()))
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+
+	c.logger.Bg().Info("Shutting down HTTP server", zap.Duration("grace_period", c.gracePeriod))
+	if c.health != nil {
+		c.health.SetDraining(true)
+	}
+	if c.drainDelay > 0 {
+		time.Sleep(c.drainDelay)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), c.gracePeriod)
+	defer cancel()
+	err := c.server.Shutdown(shutdownCtx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Warn(c.logger.Bg(), "Grace period expired, closing remaining connections")
+		err = c.server.Close()
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return err
+}
+
+func (c *serveConfig) flush() {
+	for _, closer := range c.closers {
+		if err := closer.Close(); err != nil {
+			c.logger.Bg().Error("Failed to close resource", zap.Error(err))
+		}
+	}
+	if closer, ok := c.tracer.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			c.logger.Bg().Error("Failed to flush tracer", zap.Error(err))
+		}
+	}
+	log.Sync(c.logger)
+}
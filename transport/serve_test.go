@@ -0,0 +1,56 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jdotw/go-utils/health"
+)
+
+func TestServeListenerDrains(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+
+	checks := health.NewRegistry()
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- ServeListener(ctx, ln, handler, ServeHealth(checks), ServeGracePeriod(time.Second))
+	}()
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		body <- string(b)
+	}()
+
+	<-started
+	cancel()
+	if want, have := "done", <-body; want != have {
+		t.Errorf("in-flight request should complete; expected %q, got %q", want, have)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if report := checks.Run(context.Background(), health.Readiness); report.Status != health.StatusFail {
+		t.Error("readiness should fail after shutdown")
+	}
+}
@@ -0,0 +1,165 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// Server-Sent Events streaming
+
+// ErrStreamingUnsupported is returned when the ResponseWriter cannot flush.
+var ErrStreamingUnsupported = errors.New("streaming unsupported")
+
+// SSEEvent is a single server-sent event. Data is written as-is when it
+// is a string or []byte, and JSON encoded otherwise.
+type SSEEvent struct {
+	ID    string
+	Event string
+	Data  interface{}
+	Retry time.Duration
+}
+
+// SSEWriter frames and flushes events to a client.
+type SSEWriter struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+// NewSSEWriter writes the event stream response headers and returns a
+// writer for sending events.
+func NewSSEWriter(w http.ResponseWriter) (*SSEWriter, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, ErrStreamingUnsupported
+	}
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	// Disable response buffering in nginx based proxies
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return &SSEWriter{w: w, flusher: flusher}, nil
+}
+
+// Send writes and flushes a single event.
+func (s *SSEWriter) Send(e SSEEvent) error {
+	var data string
+	switch d := e.Data.(type) {
+	case nil:
+	case string:
+		data = d
+	case []byte:
+		data = string(d)
+	default:
+		b, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		data = string(b)
+	}
+
+	var b strings.Builder
+	if e.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", sanitizeSSEField(e.ID))
+	}
+	if e.Event != "" {
+		fmt.Fprintf(&b, "event: %s\n", sanitizeSSEField(e.Event))
+	}
+	if e.Retry > 0 {
+		fmt.Fprintf(&b, "retry: %d\n", e.Retry.Milliseconds())
+	}
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// Comment writes a comment line, which clients ignore. It is used for
+// heartbeats that keep idle connections open through proxies.
+func (s *SSEWriter) Comment(text string) error {
+	return s.write(": " + sanitizeSSEField(text) + "\n\n")
+}
+
+func (s *SSEWriter) write(frame string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.w.Write([]byte(frame)); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+func sanitizeSSEField(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// NewSSEEncoder returns a response encoder for endpoints that return a
+// <-chan SSEEvent. Events are streamed until the channel is closed or
+// the request context is cancelled, with a heartbeat comment sent after
+// each idle interval (zero disables heartbeats).
+//
+// The producer must close the channel when it is done. If the client
+// disconnects first, the remaining events are drained and discarded so
+// a producer blocked sending doesn't leak, but producers should still
+// stop early by selecting on the request context.
+func NewSSEEncoder(heartbeat time.Duration) kithttp.EncodeResponseFunc {
+	return func(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+		events, ok := response.(<-chan SSEEvent)
+		if !ok {
+			return fmt.Errorf("transport: SSE encoder requires a <-chan SSEEvent, got %T", response)
+		}
+		closed := false
+		defer func() {
+			if !closed {
+				go drainSSEEvents(events)
+			}
+		}()
+		sse, err := NewSSEWriter(w)
+		if err != nil {
+			return err
+		}
+
+		var tick <-chan time.Time
+		if heartbeat > 0 {
+			ticker := time.NewTicker(heartbeat)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case e, ok := <-events:
+				if !ok {
+					closed = true
+					return nil
+				}
+				if err := sse.Send(e); err != nil {
+					return err
+				}
+			case <-tick:
+				if err := sse.Comment("heartbeat"); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func drainSSEEvents(events <-chan SSEEvent) {
+	for range events {
+	}
+}
@@ -0,0 +1,65 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSSEEncoder(t *testing.T) {
+	events := make(chan SSEEvent, 2)
+	events <- SSEEvent{ID: "1", Event: "progress", Data: map[string]int{"done": 50}}
+	events <- SSEEvent{Data: "line one\nline two"}
+	close(events)
+
+	w := httptest.NewRecorder()
+	if err := NewSSEEncoder(0)(context.Background(), w, (<-chan SSEEvent)(events)); err != nil {
+		t.Fatalf("encoder returned error: %s", err)
+	}
+
+	want := "id: 1\nevent: progress\ndata: {\"done\":50}\n\ndata: line one\ndata: line two\n\n"
+	if have := w.Body.String(); have != want {
+		t.Errorf("unexpected stream; expected %q, got %q", want, have)
+	}
+	if w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Errorf("unexpected content type %s", w.Header().Get("Content-Type"))
+	}
+}
+
+func TestSSEEncoderClientDisconnect(t *testing.T) {
+	sent := make(chan struct{})
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The producer ignores the request context, so it is still
+		// sending after the client has gone
+		events := make(chan SSEEvent)
+		go func() {
+			defer close(done)
+			defer close(events)
+			events <- SSEEvent{Data: "first"}
+			close(sent)
+			<-r.Context().Done()
+			events <- SSEEvent{Data: "second"}
+		}()
+		NewSSEEncoder(0)(r.Context(), w, (<-chan SSEEvent)(events))
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-sent
+	cancel()
+	resp.Body.Close()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the producer to finish after the client disconnected")
+	}
+}
@@ -0,0 +1,87 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+
+	"github.com/jdotw/go-utils/recorderrors"
+)
+
+// Registry mapping errors to HTTP status codes, consulted by
+// HTTPErrorEncoder and HTTPProblemErrorEncoder. Later
+// registrations take precedence over earlier ones, so services
+// can override the defaults below. Errors that carry their own
+// status, such as errorsx codes or go-kit StatusCoders, don't need
+// registering.
+
+type errorStatus struct {
+	match  func(error) bool
+	status int
+}
+
+var (
+	errorStatusesMu sync.RWMutex
+	errorStatuses   []errorStatus
+)
+
+func init() {
+	RegisterErrorStatus(recorderrors.ErrNotFound, http.StatusNotFound)
+	RegisterErrorStatus(recorderrors.ErrAlreadyExists, http.StatusConflict)
+	RegisterErrorStatus(recorderrors.ErrConflict, http.StatusConflict)
+	RegisterErrorStatus(recorderrors.ErrValidation, http.StatusBadRequest)
+	RegisterErrorStatus(recorderrors.ErrPreconditionFailed, http.StatusPreconditionFailed)
+	RegisterErrorStatus(recorderrors.ErrUnavailable, http.StatusServiceUnavailable)
+	RegisterErrorStatus(ErrPanicRecovered, http.StatusInternalServerError)
+	RegisterErrorStatus(ErrUnsupportedMediaType, http.StatusUnsupportedMediaType)
+	RegisterErrorStatus(ErrRequestTimeout, http.StatusRequestTimeout)
+	RegisterErrorStatus(ErrBodyTooLarge, http.StatusRequestEntityTooLarge)
+	RegisterErrorStatus(ErrMethodNotAllowed, http.StatusMethodNotAllowed)
+}
+
+// RegisterErrorStatus maps errors to an HTTP status code. The target is
+// either an error value, matched with errors.Is, or the reflect.Type of
+// an error type, matched with errors.As:
+//
+//	transport.RegisterErrorStatus(ErrConflict, http.StatusConflict)
+//	transport.RegisterErrorStatus(reflect.TypeOf(&ValidationError{}), http.StatusBadRequest)
+func RegisterErrorStatus(target interface{}, status int) {
+	switch t := target.(type) {
+	case reflect.Type:
+		errorType := reflect.TypeOf((*error)(nil)).Elem()
+		if !t.Implements(errorType) {
+			panic(fmt.Sprintf("transport: %s does not implement error", t))
+		}
+		RegisterErrorStatusFunc(func(err error) bool {
+			ptr := reflect.New(t)
+			return errors.As(err, ptr.Interface())
+		}, status)
+	case error:
+		RegisterErrorStatusFunc(func(err error) bool {
+			return errors.Is(err, t)
+		}, status)
+	default:
+		panic(fmt.Sprintf("transport: cannot register error status for %T", target))
+	}
+}
+
+// RegisterErrorStatusFunc maps errors for which match returns true to an
+// HTTP status code.
+func RegisterErrorStatusFunc(match func(error) bool, status int) {
+	errorStatusesMu.Lock()
+	defer errorStatusesMu.Unlock()
+	errorStatuses = append(errorStatuses, errorStatus{match: match, status: status})
+}
+
+func httpStatusForError(err error) int {
+	errorStatusesMu.RLock()
+	defer errorStatusesMu.RUnlock()
+	for i := len(errorStatuses) - 1; i >= 0; i-- {
+		if errorStatuses[i].match(err) {
+			return errorStatuses[i].status
+		}
+	}
+	return http.StatusInternalServerError
+}
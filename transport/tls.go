@@ -0,0 +1,171 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/jdotw/go-utils/log"
+	"go.uber.org/zap"
+)
+
+// TLS serving with certificate hot-reload and client certificates
+
+// CertReloader serves a certificate loaded from disk, reloading it when
+// the files change so rotated certificates are picked up without a
+// restart. Use its GetCertificate method with ServeTLS.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	logger   log.Factory
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewCertReloader loads the certificate and key at the given paths.
+func NewCertReloader(certFile, keyFile string, logger log.Factory) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the certificate and key from disk. On failure the
+// previously loaded certificate is kept.
+func (r *CertReloader) Reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+// Watch polls the files every interval and reloads them when either has
+// been modified, until ctx is cancelled. Reload failures are logged and
+// retried on the next change.
+func (r *CertReloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		modTime, err := r.latestModTime()
+		if err != nil {
+			r.logger.Bg().Error("Failed to stat certificate", zap.Error(err))
+			continue
+		}
+		r.mu.RLock()
+		changed := modTime.After(r.modTime)
+		r.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		if err := r.Reload(); err != nil {
+			r.logger.Bg().Error("Failed to reload certificate", zap.String("cert", r.certFile), zap.Error(err))
+			// Don't retry until the files change again
+			r.mu.Lock()
+			r.modTime = modTime
+			r.mu.Unlock()
+			continue
+		}
+		r.logger.Bg().Info("Reloaded certificate", zap.String("cert", r.certFile))
+	}
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *CertReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// ServeTLS serves HTTPS using getCertificate, which may be a
+// CertReloader's GetCertificate, an autocert.Manager's or one backed by a
+// secret store. TLS 1.2 is the minimum version.
+func ServeTLS(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) ServeOption {
+	return func(c *serveConfig) {
+		c.tlsConfig().GetCertificate = getCertificate
+	}
+}
+
+// ServeClientCerts requests client certificates signed by clientCAs.
+// With required false, clients without a certificate are still served
+// and authentication is left to the handler; a certificate that is
+// presented must verify either way. Use with ServeTLS.
+func ServeClientCerts(clientCAs *x509.CertPool, required bool) ServeOption {
+	return func(c *serveConfig) {
+		cfg := c.tlsConfig()
+		cfg.ClientCAs = clientCAs
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		if required {
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+}
+
+func (c *serveConfig) tlsConfig() *tls.Config {
+	if c.server.TLSConfig == nil {
+		c.server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return c.server.TLSConfig
+}
+
+type tlsContextKey string
+
+const (
+	// ClientCertificateContextKey holds the key used to store the verified client certificate in the context.
+	ClientCertificateContextKey tlsContextKey = "ClientCertificate"
+)
+
+// ClientCertificateToContext moves the verified client certificate of an
+// mTLS connection to context, for authenticators to read with
+// ClientCertificateFromContext. Pass it to the server as a ServerBefore
+// option.
+func ClientCertificateToContext() kithttp.RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			return ctx
+		}
+		return context.WithValue(ctx, ClientCertificateContextKey, r.TLS.VerifiedChains[0][0])
+	}
+}
+
+// ClientCertificateFromContext returns the certificate stored by
+// ClientCertificateToContext, or nil.
+func ClientCertificateFromContext(ctx context.Context) *x509.Certificate {
+	cert, _ := ctx.Value(ClientCertificateContextKey).(*x509.Certificate)
+	return cert
+}
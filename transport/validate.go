@@ -0,0 +1,83 @@
+package transport
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jdotw/go-utils/recorderrors"
+	"github.com/jdotw/go-utils/validate"
+)
+
+// Validation of decoded requests. The request decoders in this
+// package run the configured Validator after decoding, so struct
+// tags such as `validate:"required,email"` produce 400 responses
+// listing each failing field.
+
+// Validator validates a decoded request, returning a *ValidationError
+// describing any invalid fields.
+type Validator interface {
+	Validate(request interface{}) error
+}
+
+// ContextValidator is implemented by Validators needing the request's
+// context, such as for rules scoped to its tenant. The decoders call
+// ValidateContext in place of Validate when it is implemented.
+type ContextValidator interface {
+	ValidateContext(ctx context.Context, request interface{}) error
+}
+
+// FieldError describes a single invalid request field. It is the
+// recorderrors type, so record validation errors carry the same detail.
+type FieldError = recorderrors.FieldError
+
+// FieldErrorer is implemented by errors that carry field level detail,
+// which the HTTP error encoders include in the response body.
+type FieldErrorer interface {
+	FieldErrors() []FieldError
+}
+
+// ValidationError is returned when a request fails validation.
+// It maps to a 400 status. It is the validate package's Error, so
+// requests and records report invalid fields alike.
+type ValidationError = validate.Error
+
+func (e *DecodeError) FieldErrors() []FieldError {
+	if e.Field == "" {
+		return nil
+	}
+	return []FieldError{{Field: e.Field, Message: e.Reason}}
+}
+
+var requestValidator Validator = NewPlaygroundValidator()
+
+// SetValidator replaces the Validator used by the request decoders.
+// Passing nil disables validation.
+func SetValidator(v Validator) {
+	requestValidator = v
+}
+
+func validateRequest(ctx context.Context, request interface{}) error {
+	if requestValidator == nil {
+		return nil
+	}
+	if cv, ok := requestValidator.(ContextValidator); ok {
+		return cv.ValidateContext(ctx, request)
+	}
+	return requestValidator.Validate(request)
+}
+
+// fieldErrorsOf returns the field errors carried by err, if any.
+func fieldErrorsOf(err error) []FieldError {
+	var fe FieldErrorer
+	if errors.As(err, &fe) {
+		return fe.FieldErrors()
+	}
+	return nil
+}
+
+// NewPlaygroundValidator returns the default Validator: a
+// validate.Validator without a database, backed by
+// go-playground/validator and reporting fields by their JSON names.
+func NewPlaygroundValidator() Validator {
+	return validate.New()
+}
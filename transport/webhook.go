@@ -0,0 +1,47 @@
+package transport
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/webhook"
+	"go.uber.org/zap"
+)
+
+// NewWebhookMiddleware returns HTTP middleware that verifies webhook
+// signatures with verifier before calling next. Rejected requests receive
+// a 401 (or 413 for oversized payloads) via HTTPErrorEncoder; accepted
+// requests reach next with the body intact.
+func NewWebhookMiddleware(verifier *webhook.Verifier, logger log.Factory) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			if _, err := verifier.VerifyRequest(r); err != nil {
+				if webhookRejection(err) {
+					logger.For(ctx).Info("Webhook rejected", zap.Error(err))
+				} else {
+					logger.For(ctx).Error("Failed to verify webhook", zap.Error(err))
+				}
+				HTTPErrorEncoder(ctx, err, w)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func webhookRejection(err error) bool {
+	for _, target := range []error{
+		webhook.ErrMissingSignature,
+		webhook.ErrInvalidSignature,
+		webhook.ErrTimestampOutOfRange,
+		webhook.ErrReplayed,
+		webhook.ErrPayloadTooLarge,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package transport
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/webhook"
+)
+
+func TestWebhookMiddleware(t *testing.T) {
+	var received string
+	h := NewWebhookMiddleware(webhook.NewVerifier([]string{"secret"}), log.NewMockLogFactory())(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			received = string(b)
+		}),
+	)
+
+	r := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader("{}"))
+	if err := webhook.NewSigner("secret").SignRequest(r); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || received != "{}" {
+		t.Errorf("signed webhook should reach the handler, got %d with body %q", w.Code, received)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader("{}")))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("unexpected status; expected %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
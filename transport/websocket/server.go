@@ -0,0 +1,237 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/gorilla/websocket"
+	"github.com/jdotw/go-utils/authn/jwt"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/tracing"
+	"github.com/jdotw/go-utils/transport"
+	"github.com/opentracing/opentracing-go"
+	tag "github.com/opentracing/opentracing-go/ext"
+	"go.uber.org/zap"
+)
+
+// Bridges WebSocket messages to a go-kit endpoint. The JWT is
+// authenticated during the handshake, so unauthenticated clients
+// receive a normal HTTP error rather than an upgraded connection.
+// Each inbound message is decoded, passed to the endpoint in its
+// own span, and the response encoded back to the client.
+
+// DecodeMessageFunc converts an inbound message into an endpoint request.
+type DecodeMessageFunc func(ctx context.Context, messageType int, data []byte) (request interface{}, err error)
+
+// EncodeMessageFunc converts an endpoint response into an outbound message.
+type EncodeMessageFunc func(ctx context.Context, response interface{}) (messageType int, data []byte, err error)
+
+// TokenExtractor finds the JWT in the handshake request.
+type TokenExtractor func(r *http.Request) (token string, ok bool)
+
+// HeaderTokenExtractor reads a bearer token from the Authorization header.
+func HeaderTokenExtractor(r *http.Request) (string, bool) {
+	parts := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "bearer") {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// QueryTokenExtractor reads the token from a query parameter, for browser
+// clients which cannot set headers on WebSocket requests.
+func QueryTokenExtractor(param string) TokenExtractor {
+	return func(r *http.Request) (string, bool) {
+		token := r.URL.Query().Get(param)
+		return token, token != ""
+	}
+}
+
+// AnyTokenExtractor tries each extractor in turn.
+func AnyTokenExtractor(extractors ...TokenExtractor) TokenExtractor {
+	return func(r *http.Request) (string, bool) {
+		for _, extract := range extractors {
+			if token, ok := extract(r); ok {
+				return token, ok
+			}
+		}
+		return "", false
+	}
+}
+
+// Server is an http.Handler serving a single endpoint over WebSocket.
+type Server struct {
+	e            endpoint.Endpoint
+	dec          DecodeMessageFunc
+	enc          EncodeMessageFunc
+	logger       log.Factory
+	tracer       opentracing.Tracer
+	authn        endpoint.Middleware
+	extractor    TokenExtractor
+	upgrader     websocket.Upgrader
+	pingInterval time.Duration
+}
+
+// ServerOption configures a Server.
+type ServerOption func(*Server)
+
+// ServerAuthenticator authenticates the handshake with the given JWT
+// parsing middleware, such as jwt.Authenticator.NewMiddleware(). The
+// resulting claims are in the context of every message.
+func ServerAuthenticator(authn endpoint.Middleware) ServerOption {
+	return func(s *Server) { s.authn = authn }
+}
+
+// ServerTokenExtractor sets how the JWT is found in the handshake request.
+// Defaults to the Authorization header, falling back to an access_token
+// query parameter.
+func ServerTokenExtractor(extractor TokenExtractor) ServerOption {
+	return func(s *Server) { s.extractor = extractor }
+}
+
+// ServerUpgrader sets the websocket.Upgrader, e.g. to restrict origins.
+func ServerUpgrader(upgrader websocket.Upgrader) ServerOption {
+	return func(s *Server) { s.upgrader = upgrader }
+}
+
+// ServerPingInterval sets how often keepalive pings are sent. Defaults to
+// 30 seconds; connections without a pong for twice this are closed.
+func ServerPingInterval(interval time.Duration) ServerOption {
+	return func(s *Server) { s.pingInterval = interval }
+}
+
+// NewServer returns a WebSocket server for the endpoint.
+func NewServer(e endpoint.Endpoint, dec DecodeMessageFunc, enc EncodeMessageFunc, logger log.Factory, tracer opentracing.Tracer, options ...ServerOption) *Server {
+	s := &Server{
+		e:            e,
+		dec:          dec,
+		enc:          enc,
+		logger:       logger,
+		tracer:       tracer,
+		extractor:    AnyTokenExtractor(HeaderTokenExtractor, QueryTokenExtractor("access_token")),
+		pingInterval: 30 * time.Second,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.authn != nil {
+		if token, ok := s.extractor(r); ok {
+			ctx = context.WithValue(ctx, jwt.JWTContextKey, token)
+		}
+		authenticated, err := s.authn(func(ctx context.Context, _ interface{}) (interface{}, error) {
+			return ctx, nil
+		})(ctx, nil)
+		if err != nil {
+			transport.HTTPErrorEncoder(ctx, err, w)
+			return
+		}
+		ctx = authenticated.(context.Context)
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already written an error response
+		s.logger.For(ctx).Error("WebSocket upgrade failed", zap.Error(err))
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.keepalive(ctx, conn)
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				s.logger.For(ctx).Info("WebSocket closed", zap.Error(err))
+			}
+			return
+		}
+		if err := s.handle(ctx, conn, messageType, data); err != nil {
+			s.logger.For(ctx).Error("Failed to write WebSocket message", zap.Error(err))
+			return
+		}
+	}
+}
+
+func (s *Server) handle(ctx context.Context, conn *websocket.Conn, messageType int, data []byte) error {
+	ctx, span := tracing.NewChildSpanAndContext(ctx, s.tracer, "WebSocketMessage")
+	defer span.Finish()
+
+	request, err := s.dec(ctx, messageType, data)
+	if err != nil {
+		return s.writeError(ctx, conn, err)
+	}
+	response, err := s.e(ctx, request)
+	if err != nil {
+		tag.Error.Set(span, true)
+		return s.writeError(ctx, conn, err)
+	}
+	messageType, data, err = s.enc(ctx, response)
+	if err != nil {
+		return s.writeError(ctx, conn, err)
+	}
+	return conn.WriteMessage(messageType, data)
+}
+
+// writeError sends err to the client as a JSON error message,
+// matching the HTTP error response body. Like it, the message is the
+// client-safe transport.ErrorMessage; err itself is only logged.
+func (s *Server) writeError(ctx context.Context, conn *websocket.Conn, err error) error {
+	s.logger.For(ctx).Info("WebSocket message failed", zap.Error(err))
+	return conn.WriteJSON(transport.HTTPErrorResponse{Error: transport.ErrorMessage(err), Code: transport.ErrorCode(err)})
+}
+
+func (s *Server) keepalive(ctx context.Context, conn *websocket.Conn) {
+	if s.pingInterval <= 0 {
+		return
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * s.pingInterval))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * s.pingInterval))
+	})
+	go func() {
+		ticker := time.NewTicker(s.pingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				deadline := time.Now().Add(s.pingInterval)
+				if err := conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// DecodeJSONMessage returns a DecodeMessageFunc that unmarshals JSON
+// messages into the value returned by newRequest.
+func DecodeJSONMessage(newRequest func() interface{}) DecodeMessageFunc {
+	return func(_ context.Context, _ int, data []byte) (interface{}, error) {
+		request := newRequest()
+		if err := json.Unmarshal(data, request); err != nil {
+			return nil, err
+		}
+		return request, nil
+	}
+}
+
+// EncodeJSONMessage is an EncodeMessageFunc that sends responses as JSON text messages.
+func EncodeJSONMessage(_ context.Context, response interface{}) (int, []byte, error) {
+	data, err := json.Marshal(response)
+	return websocket.TextMessage, data, err
+}
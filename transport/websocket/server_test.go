@@ -0,0 +1,90 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/gorilla/websocket"
+	"github.com/jdotw/go-utils/authn/jwt"
+	"github.com/jdotw/go-utils/errorsx"
+	"github.com/jdotw/go-utils/log"
+	"github.com/jdotw/go-utils/transport"
+	"github.com/opentracing/opentracing-go"
+)
+
+type echoRequest struct {
+	Text string `json:"text"`
+}
+
+var errNoToken = errors.New("no token")
+
+// fakeAuthn accepts any token and exposes it as the claims
+func fakeAuthn(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		token, ok := ctx.Value(jwt.JWTContextKey).(string)
+		if !ok {
+			return nil, errNoToken
+		}
+		return next(context.WithValue(ctx, jwt.JWTClaimsContextKey, token), request)
+	}
+}
+
+func TestServer(t *testing.T) {
+	e := func(ctx context.Context, request interface{}) (interface{}, error) {
+		claims := ctx.Value(jwt.JWTClaimsContextKey).(string)
+		if request.(*echoRequest).Text == "fail" {
+			return nil, errors.New("pq: connection refused")
+		}
+		return echoRequest{Text: claims + ":" + request.(*echoRequest).Text}, nil
+	}
+	s := NewServer(e,
+		DecodeJSONMessage(func() interface{} { return &echoRequest{} }),
+		EncodeJSONMessage,
+		log.NewMockLogFactory(),
+		opentracing.NoopTracer{},
+		ServerAuthenticator(fakeAuthn),
+	)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	// Handshake without a token is rejected
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil || resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected the handshake to be rejected, got %v", err)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?access_token=alice", nil)
+	if err != nil {
+		t.Fatalf("Dial returned error: %s", err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteJSON(echoRequest{Text: "hello"}); err != nil {
+		t.Fatalf("WriteJSON returned error: %s", err)
+	}
+	var reply echoRequest
+	if err := conn.ReadJSON(&reply); err != nil {
+		t.Fatalf("ReadJSON returned error: %s", err)
+	}
+	if want, have := "alice:hello", reply.Text; want != have {
+		t.Errorf("unexpected reply; expected %s, got %s", want, have)
+	}
+
+	// Internal errors are not shown to the client
+	if err := conn.WriteJSON(echoRequest{Text: "fail"}); err != nil {
+		t.Fatalf("WriteJSON returned error: %s", err)
+	}
+	var failure transport.HTTPErrorResponse
+	if err := conn.ReadJSON(&failure); err != nil {
+		t.Fatalf("ReadJSON returned error: %s", err)
+	}
+	if failure.Error != "internal error" || failure.Code != errorsx.CodeInternal {
+		t.Errorf("unexpected error message %+v", failure)
+	}
+}
@@ -0,0 +1,62 @@
+package validate
+
+import (
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+// Plugin is a gorm plugin that validates records before they are
+// created, and before whole records are updated by Save. Updates of
+// selected columns are not validated, as the rest of the record may not
+// be loaded. Uniqueness rules query the statement's connection, so they
+// see the statement's transaction. Register it after plugins that fill
+// in fields, such as model.TenantPlugin and model.SlugPlugin, so the
+// values they set are validated.
+//
+//	db.Use(&validate.Plugin{Validator: v})
+type Plugin struct {
+	// Validator validates records. Nil uses a Validator without a DB.
+	Validator *Validator
+}
+
+func (p *Plugin) Name() string {
+	return "go-utils:validate"
+}
+
+func (p *Plugin) Initialize(db *gorm.DB) error {
+	if p.Validator == nil {
+		p.Validator = std
+	}
+	cb := db.Callback()
+	if err := cb.Create().Before("gorm:create").Register("go-utils:validate_create", p.validate); err != nil {
+		return err
+	}
+	return cb.Update().Before("gorm:update").Register("go-utils:validate_update", p.validateSave)
+}
+
+func (p *Plugin) validateSave(db *gorm.DB) {
+	if len(db.Statement.Selects) == 1 && db.Statement.Selects[0] == "*" {
+		p.validate(db)
+	}
+}
+
+func (p *Plugin) validate(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+	ctx := WithDB(db.Statement.Context, db)
+	rv := db.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len() && db.Error == nil; i++ {
+			if err := p.Validator.ValidateContext(ctx, rv.Index(i).Interface()); err != nil {
+				db.AddError(err)
+			}
+		}
+	case reflect.Struct:
+		if err := p.Validator.ValidateContext(ctx, rv.Interface()); err != nil {
+			db.AddError(err)
+		}
+	}
+}
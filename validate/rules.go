@@ -0,0 +1,100 @@
+package validate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/jdotw/go-utils/identity"
+	"github.com/jdotw/go-utils/model"
+	"github.com/jdotw/go-utils/tenant"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNoDB is returned when a uniqueness rule runs without a database.
+var ErrNoDB = errors.New("validate: no database for uniqueness rule")
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+func isSlug(s string) bool {
+	return len(s) <= model.MaxSlugLength && slugPattern.MatchString(s)
+}
+
+func isEnum(field reflect.Value, param string) bool {
+	s := fmt.Sprint(field.Interface())
+	for _, v := range enumValues(field, param) {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// enumValues returns the values of param, or of field's Values method
+// when param is empty.
+func enumValues(field reflect.Value, param string) []string {
+	if param != "" {
+		return strings.Fields(param)
+	}
+	if !field.IsValid() {
+		return nil
+	}
+	method := field.MethodByName("Values")
+	if !method.IsValid() || method.Type().NumIn() != 0 || method.Type().NumOut() != 1 ||
+		method.Type().Out(0).Kind() != reflect.Slice {
+		return nil
+	}
+	values := method.Call(nil)[0]
+	allowed := make([]string, values.Len())
+	for i := range allowed {
+		allowed[i] = fmt.Sprint(values.Index(i).Interface())
+	}
+	return allowed
+}
+
+type dbKey struct{}
+
+// WithDB returns a context whose validations run their uniqueness rules
+// against db, such as a transaction, in place of the Validator's DB.
+func WithDB(ctx context.Context, db *gorm.DB) context.Context {
+	return context.WithValue(ctx, dbKey{}, db)
+}
+
+// unique reports whether no other row of the rule's table has the
+// field's value, counting soft deleted rows as unique indexes do.
+func (v *Validator) unique(ctx context.Context, fl validator.FieldLevel, tenanted bool) (bool, error) {
+	table, column, ok := strings.Cut(fl.Param(), ".")
+	if !ok || table == "" || column == "" {
+		return false, fmt.Errorf("validate: %s needs a table.column parameter, got %q", fl.GetTag(), fl.Param())
+	}
+	db, _ := ctx.Value(dbKey{}).(*gorm.DB)
+	if db == nil {
+		db = v.db
+	}
+	if db == nil {
+		return false, ErrNoDB
+	}
+
+	q := db.Session(&gorm.Session{NewDB: true}).WithContext(ctx).Table(table).
+		Where(clause.Eq{Column: clause.Column{Name: column}, Value: fl.Field().Interface()})
+	if tenanted {
+		id := identity.TenantID(ctx)
+		if id == "" {
+			return false, tenant.ErrMissingTenant
+		}
+		q = q.Where(clause.Eq{Column: clause.Column{Name: "tenant_id"}, Value: id})
+	}
+	if id := reflect.Indirect(fl.Parent()).FieldByName("ID"); id.IsValid() && !id.IsZero() {
+		q = q.Where(clause.Neq{Column: clause.Column{Name: "id"}, Value: id.Interface()})
+	}
+	var count int64
+	if err := q.Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count == 0, nil
+}
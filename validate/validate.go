@@ -0,0 +1,259 @@
+// Package validate checks structs against their validate tags, reporting
+// every invalid field as a recorderrors.FieldError. The transport request
+// decoders and the gorm Plugin both use it, so an invalid request and an
+// invalid record are described to clients the same way.
+//
+//	type Widget struct {
+//		model.Defaults
+//		model.Tenanted
+//		Name   string `json:"name" validate:"required,max=100,tenant_unique=widgets.name"`
+//		Slug   string `json:"slug" validate:"omitempty,slug"`
+//		Status Status `json:"status" validate:"enum"`
+//		Owner  string `json:"owner_id" validate:"uuid"`
+//	}
+//
+//	v := validate.New(validate.DB(db))
+//	transport.SetValidator(v)
+//	db.Use(&validate.Plugin{Validator: v})
+//
+// Besides the go-playground/validator tags, the rules are:
+//
+//   - slug: a lower case slug as produced by model.Slugify
+//   - enum: one of the field type's Values(), or of the space separated
+//     values given as enum=a b c
+//   - unique=table.column: no other row of table has the value in column
+//   - tenant_unique=table.column: as unique, among the rows of the tenant
+//     in context
+//
+// The uniqueness rules need a database, given with DB or WithDB, and
+// exclude the row whose primary key is the struct's ID field so records
+// can be saved again.
+package validate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/jdotw/go-utils/recorderrors"
+	"gorm.io/gorm"
+)
+
+// FieldError describes a single invalid field.
+type FieldError = recorderrors.FieldError
+
+// Error is returned when a struct fails validation, listing each invalid
+// field. It maps to a 400 status.
+type Error struct {
+	Fields []FieldError
+}
+
+func (e *Error) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Field + " " + f.Message
+	}
+	return "invalid request: " + strings.Join(msgs, ", ")
+}
+
+// FieldErrors returns the invalid fields, which the HTTP and gRPC error
+// encoders include in responses.
+func (e *Error) FieldErrors() []FieldError {
+	return e.Fields
+}
+
+// StatusCode implements go-kit's StatusCoder.
+func (e *Error) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// RuleFunc reports whether field satisfies a rule, given the rule's
+// parameter. An error, such as a failed database query, aborts
+// validation and is returned in place of an *Error.
+type RuleFunc func(ctx context.Context, field reflect.Value, param string) (bool, error)
+
+// Option configures a Validator.
+type Option func(*options)
+
+type rule struct {
+	fn      RuleFunc
+	message string
+}
+
+type options struct {
+	db    *gorm.DB
+	rules map[string]rule
+}
+
+// DB is the database queried by the uniqueness rules when the context
+// has none from WithDB.
+func DB(db *gorm.DB) Option {
+	return func(o *options) { o.db = db }
+}
+
+// Rule adds a rule for tag, reported with message when it fails. A %s in
+// message is replaced with the rule's parameter.
+//
+//	validate.Rule("even", func(_ context.Context, f reflect.Value, _ string) (bool, error) {
+//		return f.Int()%2 == 0, nil
+//	}, "must be even")
+func Rule(tag string, fn RuleFunc, message string) Option {
+	return func(o *options) { o.rules[tag] = rule{fn: fn, message: message} }
+}
+
+// Validator validates structs. It implements transport.Validator.
+type Validator struct {
+	validate *validator.Validate
+	db       *gorm.DB
+	messages map[string]string
+}
+
+// New returns a Validator with the package's rules and those added by
+// opts. Fields are named by their json, query or path tag.
+func New(opts ...Option) *Validator {
+	o := options{rules: make(map[string]rule)}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	v := &Validator{validate: validator.New(), db: o.db, messages: make(map[string]string)}
+	v.validate.RegisterTagNameFunc(func(f reflect.StructField) string {
+		for _, key := range []string{"json", "query", "path"} {
+			if name := strings.Split(f.Tag.Get(key), ",")[0]; name != "" && name != "-" {
+				return name
+			}
+		}
+		return f.Name
+	})
+	v.register("slug", func(_ context.Context, fl validator.FieldLevel) (bool, error) {
+		return isSlug(fl.Field().String()), nil
+	})
+	v.register("enum", func(_ context.Context, fl validator.FieldLevel) (bool, error) {
+		return isEnum(fl.Field(), fl.Param()), nil
+	})
+	v.register("unique", func(ctx context.Context, fl validator.FieldLevel) (bool, error) {
+		return v.unique(ctx, fl, false)
+	})
+	v.register("tenant_unique", func(ctx context.Context, fl validator.FieldLevel) (bool, error) {
+		return v.unique(ctx, fl, true)
+	})
+	for tag, r := range o.rules {
+		fn := r.fn
+		v.register(tag, func(ctx context.Context, fl validator.FieldLevel) (bool, error) {
+			return fn(ctx, fl.Field(), fl.Param())
+		})
+		v.messages[tag] = r.message
+	}
+	return v
+}
+
+type validationKey struct{}
+
+// validation collects the first error from a rule during a validation.
+type validation struct {
+	err error
+}
+
+func (v *Validator) register(tag string, fn func(ctx context.Context, fl validator.FieldLevel) (bool, error)) {
+	v.validate.RegisterValidationCtx(tag, func(ctx context.Context, fl validator.FieldLevel) bool {
+		ok, err := fn(ctx, fl)
+		if err != nil {
+			if state, _ := ctx.Value(validationKey{}).(*validation); state != nil && state.err == nil {
+				state.err = err
+			}
+			return true
+		}
+		return ok
+	})
+}
+
+// Validate validates s as ValidateContext does, without a context.
+func (v *Validator) Validate(s interface{}) error {
+	return v.ValidateContext(context.Background(), s)
+}
+
+// ValidateContext returns an *Error listing the fields of s that fail
+// their rules. Values other than structs and pointers to them are
+// valid.
+func (v *Validator) ValidateContext(ctx context.Context, s interface{}) error {
+	rv := reflect.ValueOf(s)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	state := &validation{}
+	err := v.validate.StructCtx(context.WithValue(ctx, validationKey{}, state), s)
+	if state.err != nil {
+		return state.err
+	}
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return err
+	}
+	fields := make([]FieldError, len(verrs))
+	for i, fe := range verrs {
+		// Namespaces start with the struct's type name, unless it is
+		// anonymous
+		field := fe.Namespace()
+		if rv.Type().Name() != "" {
+			field = strings.SplitN(field, ".", 2)[1]
+		}
+		fields[i] = FieldError{
+			Field:   field,
+			Rule:    fe.Tag(),
+			Message: v.message(fe),
+		}
+	}
+	return &Error{Fields: fields}
+}
+
+func (v *Validator) message(fe validator.FieldError) string {
+	if msg, ok := v.messages[fe.Tag()]; ok {
+		if strings.Contains(msg, "%s") {
+			return fmt.Sprintf(msg, fe.Param())
+		}
+		return msg
+	}
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "oneof":
+		return "must be one of " + fe.Param()
+	case "min":
+		return "must be at least " + fe.Param()
+	case "max":
+		return "must be at most " + fe.Param()
+	case "len":
+		return "must have length " + fe.Param()
+	case "uuid", "uuid4":
+		return "must be a UUID"
+	case "slug":
+		return "must be a slug of lower case letters, digits and hyphens"
+	case "enum":
+		return "must be one of " + strings.Join(enumValues(reflect.ValueOf(fe.Value()), fe.Param()), ", ")
+	case "unique", "tenant_unique":
+		return "is already taken"
+	}
+	if fe.Param() != "" {
+		return fmt.Sprintf("failed %s=%s", fe.Tag(), fe.Param())
+	}
+	return "failed " + fe.Tag()
+}
+
+var std = New()
+
+// Struct validates s with a Validator without a database, as
+// Validator.ValidateContext does.
+func Struct(ctx context.Context, s interface{}) error {
+	return std.ValidateContext(ctx, s)
+}
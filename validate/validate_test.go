@@ -0,0 +1,142 @@
+package validate
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/jdotw/go-utils/identity"
+	"github.com/jdotw/go-utils/tenant"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/utils/tests"
+)
+
+type status string
+
+func (status) Values() []status {
+	return []status{"active", "archived"}
+}
+
+type widget struct {
+	ID       string `json:"id"`
+	Name     string `json:"name" validate:"required,tenant_unique=widgets.name"`
+	Slug     string `json:"slug" validate:"omitempty,slug"`
+	Status   status `json:"status" validate:"enum"`
+	Size     string `json:"size" validate:"omitempty,enum=small large"`
+	Quantity int    `json:"quantity" validate:"even"`
+}
+
+func fieldErrors(t *testing.T, err error) map[string]string {
+	t.Helper()
+	var verr *Error
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected an *Error, got %v", err)
+	}
+	fields := make(map[string]string)
+	for _, f := range verr.Fields {
+		fields[f.Field] = f.Message
+	}
+	return fields
+}
+
+func even(_ context.Context, f reflect.Value, _ string) (bool, error) {
+	return f.Int()%2 == 0, nil
+}
+
+func TestRules(t *testing.T) {
+	v := New(Rule("even", even, "must be even"))
+	err := v.Validate(struct {
+		Slug   string `json:"slug" validate:"slug"`
+		Status status `json:"status" validate:"enum"`
+		Size   string `json:"size" validate:"enum=small large"`
+		Count  int    `json:"count" validate:"even"`
+	}{Slug: "Not A Slug", Status: "deleted", Size: "medium", Count: 3})
+	fields := fieldErrors(t, err)
+	expected := map[string]string{
+		"slug":   "must be a slug of lower case letters, digits and hyphens",
+		"status": "must be one of active, archived",
+		"size":   "must be one of small, large",
+		"count":  "must be even",
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("expected %v, got %v", expected, fields)
+	}
+
+	err = v.Validate(struct {
+		Slug   string `json:"slug" validate:"slug"`
+		Status status `json:"status" validate:"enum"`
+	}{Slug: "my-post-2", Status: "archived"})
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if err := v.Validate("not a struct"); err != nil {
+		t.Errorf("expected non-structs to be valid, got %v", err)
+	}
+}
+
+func TestUniqueWithoutDB(t *testing.T) {
+	err := New(Rule("even", even, "must be even")).Validate(&widget{Name: "a", Status: "active"})
+	if !errors.Is(err, ErrNoDB) {
+		t.Errorf("expected ErrNoDB, got %v", err)
+	}
+}
+
+func TestPlugin(t *testing.T) {
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(&Plugin{Validator: New(Rule("even", even, "must be even"))}); err != nil {
+		t.Fatal(err)
+	}
+	var sql string
+	var taken int64
+	err = db.Callback().Query().Replace("gorm:query", func(db *gorm.DB) {
+		callbacks.BuildQuerySQL(db)
+		sql = db.Dialector.Explain(db.Statement.SQL.String(), db.Statement.Vars...)
+		*db.Statement.Dest.(*int64) = taken
+		db.RowsAffected = 1
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.WithValue(context.Background(), identity.TenantIDContextKey, "acme")
+
+	w := &widget{Name: "bolt", Status: "active"}
+	if err := db.WithContext(ctx).Create(w).Error; err != nil {
+		t.Fatalf("Create returned error: %s", err)
+	}
+	if expected := "SELECT count(*) FROM `widgets` WHERE `name` = \"bolt\" AND `tenant_id` = \"acme\""; sql != expected {
+		t.Errorf("expected %s, got %s", expected, sql)
+	}
+
+	// Saving an existing record excludes it from the uniqueness check
+	w.ID = "w1"
+	if err := db.WithContext(ctx).Save(w).Error; err != nil {
+		t.Fatalf("Save returned error: %s", err)
+	}
+	if expected := "SELECT count(*) FROM `widgets` WHERE `name` = \"bolt\" AND `tenant_id` = \"acme\" AND `id` <> \"w1\""; sql != expected {
+		t.Errorf("expected %s, got %s", expected, sql)
+	}
+
+	taken = 1
+	err = db.WithContext(ctx).Create(&widget{Name: "bolt", Slug: "Bolt", Status: "gone", Quantity: 1}).Error
+	fields := fieldErrors(t, err)
+	for _, field := range []string{"name", "slug", "status", "quantity"} {
+		if fields[field] == "" {
+			t.Errorf("expected %s to be invalid, got %v", field, fields)
+		}
+	}
+
+	err = db.Create(&widget{Name: "bolt", Status: "active"}).Error
+	if !errors.Is(err, tenant.ErrMissingTenant) {
+		t.Errorf("expected ErrMissingTenant, got %v", err)
+	}
+
+	// Updates of selected columns are not validated
+	if err := db.WithContext(ctx).Model(&widget{ID: "w1"}).Update("slug", "Not A Slug").Error; err != nil {
+		t.Errorf("Update returned error: %s", err)
+	}
+}
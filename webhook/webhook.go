@@ -0,0 +1,279 @@
+// Package webhook signs outgoing webhook payloads and verifies them on
+// receipt. A payload is signed with HMAC-SHA256 over the timestamp and
+// body, "<timestamp>.<body>", and sent with two headers:
+//
+//	X-Webhook-Timestamp: 1700000000
+//	X-Webhook-Signature: v1=5257a869...,v1=9c1d03b2...
+//
+// One signature is sent per active secret, so secrets can be rotated by
+// adding the new secret on both sides before retiring the old one.
+// Receivers reject stale timestamps and, given a cache.Store, signatures
+// they have already seen.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jdotw/go-utils/cache"
+	"github.com/jdotw/go-utils/errorsx"
+)
+
+const (
+	// SignatureHeader carries the payload signatures.
+	SignatureHeader = "X-Webhook-Signature"
+	// TimestampHeader carries the Unix time the payload was signed at.
+	TimestampHeader = "X-Webhook-Timestamp"
+
+	// DefaultTolerance is how far a timestamp may be from the receiver's
+	// clock before the payload is rejected.
+	DefaultTolerance = 5 * time.Minute
+
+	// DefaultMaxBodyBytes limits the body read by VerifyRequest.
+	DefaultMaxBodyBytes = 1 << 20
+
+	scheme = "v1"
+)
+
+// The rejection errors respond 401, except ErrPayloadTooLarge.
+var (
+	// ErrNoSecrets is returned when signing or verifying without a secret.
+	ErrNoSecrets = errors.New("no webhook secrets configured")
+	// ErrMissingSignature is returned when the signature or timestamp
+	// header is absent.
+	ErrMissingSignature = errorsx.Sentinel(errorsx.CodeUnauthenticated, "webhook signature missing")
+	// ErrInvalidSignature is returned when no signature matches a secret.
+	ErrInvalidSignature = errorsx.Sentinel(errorsx.CodeUnauthenticated, "webhook signature invalid")
+	// ErrTimestampOutOfRange is returned when the timestamp is outside the
+	// tolerance.
+	ErrTimestampOutOfRange = errorsx.Sentinel(errorsx.CodeUnauthenticated, "webhook timestamp out of range")
+	// ErrReplayed is returned when a signature has already been accepted.
+	ErrReplayed = errorsx.Sentinel(errorsx.CodeUnauthenticated, "webhook already received")
+	// ErrPayloadTooLarge is returned by VerifyRequest when the body exceeds
+	// the limit. It responds 413.
+	ErrPayloadTooLarge error = tooLargeError{}
+)
+
+// tooLargeError is a 413 error, which no errorsx code maps to.
+type tooLargeError struct{}
+
+func (tooLargeError) Error() string {
+	return "webhook payload too large"
+}
+
+// StatusCode implements go-kit's StatusCoder.
+func (tooLargeError) StatusCode() int {
+	return http.StatusRequestEntityTooLarge
+}
+
+// Signature returns the hex encoded v1 signature of body at timestamp.
+func Signature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// secrets holds the active secrets, replaceable while in use.
+type secrets struct {
+	mu     sync.RWMutex
+	values []string
+}
+
+// SetSecrets replaces the active secrets, the newest first.
+func (s *secrets) SetSecrets(values ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values = append([]string(nil), values...)
+}
+
+func (s *secrets) get() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.values
+}
+
+// Signer signs outgoing payloads.
+type Signer struct {
+	secrets
+	now func() time.Time
+}
+
+// NewSigner returns a Signer signing with each of secrets.
+func NewSigner(secrets ...string) *Signer {
+	s := &Signer{now: time.Now}
+	s.SetSecrets(secrets...)
+	return s
+}
+
+// Sign returns the timestamp and signature header values for body.
+func (s *Signer) Sign(body []byte) (timestamp, signature string, err error) {
+	secrets := s.get()
+	if len(secrets) == 0 {
+		return "", "", ErrNoSecrets
+	}
+	ts := s.now().Unix()
+	sigs := make([]string, len(secrets))
+	for i, secret := range secrets {
+		sigs[i] = scheme + "=" + Signature(secret, ts, body)
+	}
+	return strconv.FormatInt(ts, 10), strings.Join(sigs, ","), nil
+}
+
+// SignRequest signs the body of r and sets the signature headers. The
+// body is read and replaced so the request can still be sent.
+func (s *Signer) SignRequest(r *http.Request) error {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		if body, err = io.ReadAll(r.Body); err != nil {
+			return err
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	timestamp, signature, err := s.Sign(body)
+	if err != nil {
+		return err
+	}
+	r.Header.Set(TimestampHeader, timestamp)
+	r.Header.Set(SignatureHeader, signature)
+	return nil
+}
+
+// Option configures a Verifier.
+type Option func(*Verifier)
+
+// Tolerance sets how far a timestamp may be from the current time.
+func Tolerance(d time.Duration) Option {
+	return func(v *Verifier) {
+		v.tolerance = d
+	}
+}
+
+// ReplayStore rejects signatures already accepted within the tolerance,
+// recording them in store. Use a shared store such as Redis when several
+// instances receive the same webhooks.
+func ReplayStore(store cache.Store) Option {
+	return func(v *Verifier) {
+		v.store = store
+	}
+}
+
+// MaxBodyBytes limits the body read by VerifyRequest.
+func MaxBodyBytes(n int64) Option {
+	return func(v *Verifier) {
+		v.maxBodyBytes = n
+	}
+}
+
+// Verifier verifies received payloads.
+type Verifier struct {
+	secrets
+	tolerance    time.Duration
+	store        cache.Store
+	maxBodyBytes int64
+	now          func() time.Time
+}
+
+// NewVerifier returns a Verifier accepting payloads signed with any of
+// secrets.
+func NewVerifier(secrets []string, opts ...Option) *Verifier {
+	v := &Verifier{
+		tolerance:    DefaultTolerance,
+		maxBodyBytes: DefaultMaxBodyBytes,
+		now:          time.Now,
+	}
+	v.SetSecrets(secrets...)
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// Verify checks the signature headers in h against body.
+func (v *Verifier) Verify(ctx context.Context, h http.Header, body []byte) error {
+	secrets := v.get()
+	if len(secrets) == 0 {
+		return ErrNoSecrets
+	}
+	timestamp, signature := h.Get(TimestampHeader), h.Get(SignatureHeader)
+	if timestamp == "" || signature == "" {
+		return ErrMissingSignature
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if d := v.now().Sub(time.Unix(ts, 0)); d > v.tolerance || d < -v.tolerance {
+		return ErrTimestampOutOfRange
+	}
+
+	matched := ""
+	for _, secret := range secrets {
+		want := Signature(secret, ts, body)
+		for _, sig := range strings.Split(signature, ",") {
+			value := strings.TrimPrefix(strings.TrimSpace(sig), scheme+"=")
+			if hmac.Equal([]byte(value), []byte(want)) {
+				matched = want
+				break
+			}
+		}
+		if matched != "" {
+			break
+		}
+	}
+	if matched == "" {
+		return ErrInvalidSignature
+	}
+
+	if v.store == nil {
+		return nil
+	}
+	// Timestamps older than the tolerance are rejected anyway, so the
+	// signature need only be remembered for twice that. Recording it only
+	// if absent lets one of concurrent deliveries through.
+	stored, err := v.store.SetIfAbsent(ctx, "webhook:"+matched, []byte(timestamp), 2*v.tolerance)
+	if err != nil {
+		return err
+	}
+	if !stored {
+		return ErrReplayed
+	}
+	return nil
+}
+
+// VerifyRequest reads and verifies the body of r, returning it. The body
+// is replaced so handlers can read it again.
+func (v *Verifier) VerifyRequest(r *http.Request) ([]byte, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		if body, err = io.ReadAll(io.LimitReader(r.Body, v.maxBodyBytes+1)); err != nil {
+			return nil, err
+		}
+		r.Body.Close()
+		if int64(len(body)) > v.maxBodyBytes {
+			return nil, ErrPayloadTooLarge
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if err := v.Verify(r.Context(), r.Header, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
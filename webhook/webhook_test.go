@@ -0,0 +1,145 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jdotw/go-utils/cache"
+)
+
+func signedRequest(t *testing.T, s *Signer, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(body))
+	if err := s.SignRequest(r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestSignAndVerify(t *testing.T) {
+	s := NewSigner("secret")
+	v := NewVerifier([]string{"secret"})
+
+	r := signedRequest(t, s, `{"event":"created"}`)
+	body, err := v.VerifyRequest(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(body) != `{"event":"created"}` {
+		t.Errorf("unexpected body %q", body)
+	}
+	if again, _ := io.ReadAll(r.Body); string(again) != string(body) {
+		t.Errorf("body should be readable after verification, got %q", again)
+	}
+
+	// Tampered body
+	r = signedRequest(t, s, `{"event":"created"}`)
+	r.Body = io.NopCloser(strings.NewReader(`{"event":"deleted"}`))
+	if _, err := v.VerifyRequest(r); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature, got %v", err)
+	}
+
+	// Missing headers
+	r = httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader("{}"))
+	if _, err := v.VerifyRequest(r); !errors.Is(err, ErrMissingSignature) {
+		t.Errorf("expected ErrMissingSignature, got %v", err)
+	}
+}
+
+func TestSecretRotation(t *testing.T) {
+	// The sender signs with the new and old secrets during rotation
+	s := NewSigner("new", "old")
+	_, sig, err := s.Sign([]byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(sig, "v1="); n != 2 {
+		t.Errorf("expected 2 signatures, got %d in %q", n, sig)
+	}
+
+	// A receiver still on the old secret accepts it
+	old := NewVerifier([]string{"old"})
+	if _, err := old.VerifyRequest(signedRequest(t, s, "{}")); err != nil {
+		t.Errorf("unexpected error with the old secret: %v", err)
+	}
+
+	// Once the old secret is retired it no longer verifies
+	s.SetSecrets("new")
+	if _, err := old.VerifyRequest(signedRequest(t, s, "{}")); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature, got %v", err)
+	}
+	old.SetSecrets("new")
+	if _, err := old.VerifyRequest(signedRequest(t, s, "{}")); err != nil {
+		t.Errorf("unexpected error after rotating the receiver: %v", err)
+	}
+}
+
+func TestTimestampTolerance(t *testing.T) {
+	v := NewVerifier([]string{"secret"}, Tolerance(time.Minute))
+	for _, age := range []time.Duration{2 * time.Minute, -2 * time.Minute} {
+		ts := time.Now().Add(-age).Unix()
+		h := http.Header{}
+		h.Set(TimestampHeader, strconv.FormatInt(ts, 10))
+		h.Set(SignatureHeader, "v1="+Signature("secret", ts, nil))
+		if err := v.Verify(context.Background(), h, nil); !errors.Is(err, ErrTimestampOutOfRange) {
+			t.Errorf("expected ErrTimestampOutOfRange for age %s, got %v", age, err)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	s := NewSigner("secret")
+	v := NewVerifier([]string{"secret"}, ReplayStore(cache.NewMemoryStore()))
+
+	r := signedRequest(t, s, "{}")
+	h := r.Header.Clone()
+	if _, err := v.VerifyRequest(r); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := v.Verify(context.Background(), h, []byte("{}")); !errors.Is(err, ErrReplayed) {
+		t.Errorf("expected ErrReplayed, got %v", err)
+	}
+}
+
+func TestReplayConcurrent(t *testing.T) {
+	s := NewSigner("secret")
+	v := NewVerifier([]string{"secret"}, ReplayStore(cache.NewMemoryStore()))
+	h := signedRequest(t, s, "{}").Header
+
+	var accepted, replayed int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			switch err := v.Verify(context.Background(), h, []byte("{}")); {
+			case err == nil:
+				atomic.AddInt32(&accepted, 1)
+			case errors.Is(err, ErrReplayed):
+				atomic.AddInt32(&replayed, 1)
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if accepted != 1 || replayed != 19 {
+		t.Errorf("expected one delivery accepted and the rest replays, got %d accepted and %d replays", accepted, replayed)
+	}
+}
+
+func TestPayloadTooLarge(t *testing.T) {
+	s := NewSigner("secret")
+	v := NewVerifier([]string{"secret"}, MaxBodyBytes(4))
+	if _, err := v.VerifyRequest(signedRequest(t, s, "too large")); !errors.Is(err, ErrPayloadTooLarge) {
+		t.Errorf("expected ErrPayloadTooLarge, got %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package worker
+
+import (
+	"github.com/jdotw/go-utils/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type poolMetrics struct {
+	queueDepth prometheus.Gauge
+	busy       prometheus.Gauge
+	jobs       *prometheus.CounterVec
+	duration   *prometheus.HistogramVec
+}
+
+func newMetrics(registerer prometheus.Registerer, pool string) *poolMetrics {
+	queueDepth := metrics.MustRegister(registerer, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "worker_queue_depth",
+		Help: "Number of jobs waiting for a worker.",
+	}, []string{"pool"}))
+	busy := metrics.MustRegister(registerer, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "worker_busy",
+		Help: "Number of workers running a job.",
+	}, []string{"pool"}))
+	return &poolMetrics{
+		queueDepth: queueDepth.WithLabelValues(pool),
+		busy:       busy.WithLabelValues(pool),
+		jobs: metrics.MustRegister(registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "worker_jobs_total",
+			Help: "Number of jobs finished, by result.",
+		}, []string{"pool", "result"})),
+		duration: metrics.MustRegister(registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "worker_job_duration_seconds",
+			Help:    "Time taken to run jobs.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"pool"})),
+	}
+}
@@ -0,0 +1,266 @@
+// Package worker runs background jobs on a bounded pool of goroutines.
+// Jobs carry the trace span, request ID and logger of the context that
+// submitted them, but not its cancellation, so they outlive the request
+// that queued them. Shutdown stops accepting jobs and drains the queue.
+//
+//	pool := worker.NewPool(worker.Config{Name: "emails", Workers: 4, QueueSize: 100}, logger, tracer,
+//		worker.Metrics(prometheus.DefaultRegisterer))
+//	err := pool.Submit(ctx, func(ctx context.Context) error {
+//		return sendWelcomeEmail(ctx, user)
+//	})
+//	...
+//	err := pool.Shutdown(shutdownCtx)
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jdotw/go-utils/correlation"
+	"github.com/jdotw/go-utils/identity"
+	"github.com/jdotw/go-utils/log"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrPoolClosed is returned when submitting to a pool that is shutting
+	// down.
+	ErrPoolClosed = errors.New("worker pool closed")
+
+	// ErrQueueFull is returned by TrySubmit when the queue is full.
+	ErrQueueFull = errors.New("worker queue full")
+)
+
+// Job is a unit of work. Its context is cancelled when Shutdown gives up
+// waiting for the pool to drain.
+type Job func(ctx context.Context) error
+
+// Config configures a Pool. Its tags allow loading it with the config
+// package.
+type Config struct {
+	// Name labels the pool's spans, logs and metrics.
+	Name string `json:"name" default:"default"`
+	// Workers is the number of jobs run at once.
+	Workers int `json:"workers" default:"4" validate:"min=1"`
+	// QueueSize is the number of jobs that can wait for a worker.
+	QueueSize int `json:"queue_size" default:"100" validate:"min=0"`
+}
+
+type options struct {
+	registerer prometheus.Registerer
+}
+
+// Option configures a Pool.
+type Option func(*options)
+
+// Metrics registers queue depth, busy worker, job and duration metrics.
+// A nil registerer uses prometheus.DefaultRegisterer.
+func Metrics(registerer prometheus.Registerer) Option {
+	return func(o *options) {
+		if registerer == nil {
+			registerer = prometheus.DefaultRegisterer
+		}
+		o.registerer = registerer
+	}
+}
+
+type task struct {
+	ctx context.Context
+	job Job
+}
+
+// Pool is a bounded pool of workers.
+type Pool struct {
+	name    string
+	logger  log.Factory
+	tracer  opentracing.Tracer
+	metrics *poolMetrics
+
+	queue  chan task
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewPool starts cfg.Workers workers.
+func NewPool(cfg Config, logger log.Factory, tracer opentracing.Tracer, opts ...Option) *Pool {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if cfg.Name == "" {
+		cfg.Name = "default"
+	}
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.QueueSize < 0 {
+		cfg.QueueSize = 0
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{
+		name:   cfg.Name,
+		logger: logger,
+		tracer: tracer,
+		queue:  make(chan task, cfg.QueueSize),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	if o.registerer != nil {
+		p.metrics = newMetrics(o.registerer, cfg.Name)
+	}
+	p.wg.Add(cfg.Workers)
+	for i := 0; i < cfg.Workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// Submit queues job, waiting for room in the queue until ctx is done.
+func (p *Pool) Submit(ctx context.Context, job Job) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrPoolClosed
+	}
+	select {
+	case p.queue <- task{ctx: ctx, job: job}:
+		p.queued()
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TrySubmit queues job, returning ErrQueueFull rather than waiting when
+// the queue is full.
+func (p *Pool) TrySubmit(ctx context.Context, job Job) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrPoolClosed
+	}
+	select {
+	case p.queue <- task{ctx: ctx, job: job}:
+		p.queued()
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Shutdown stops accepting jobs and waits for queued and running jobs to
+// finish. If ctx is done first, the jobs' contexts are cancelled, the
+// remaining queue is discarded and ctx's error is returned.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (p *Pool) queued() {
+	if p.metrics != nil {
+		p.metrics.queueDepth.Inc()
+	}
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+	for t := range p.queue {
+		if p.metrics != nil {
+			p.metrics.queueDepth.Dec()
+		}
+		if p.ctx.Err() != nil {
+			// Shutdown timed out; drop what is left
+			log.Warn(p.logger.For(t.ctx), "Discarding queued job", zap.String("pool", p.name))
+			p.observe("discarded", 0)
+			continue
+		}
+		p.run(t)
+	}
+}
+
+// run runs t in a context carrying its submitter's span, request ID,
+// identity and logger, recovering from panics.
+func (p *Pool) run(t task) {
+	ctx := p.ctx
+	var opts []opentracing.StartSpanOption
+	if parent := opentracing.SpanFromContext(t.ctx); parent != nil {
+		opts = append(opts, opentracing.FollowsFrom(parent.Context()))
+	}
+	span := p.tracer.StartSpan("worker."+p.name, opts...)
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	if id := correlation.FromContext(t.ctx); id != "" {
+		ctx = correlation.WithRequestID(ctx, id)
+		span.SetTag(correlation.SpanTag, id)
+	}
+	// The user and tenant, so tenant scoped queries work in jobs
+	ctx = identity.WithIdentity(ctx, identity.FromContext(t.ctx))
+	if logger, ok := t.ctx.Value(log.LoggerContextKey).(log.Logger); ok {
+		ctx = log.WithLogger(ctx, logger)
+	}
+
+	if p.metrics != nil {
+		p.metrics.busy.Inc()
+		defer p.metrics.busy.Dec()
+	}
+	start := time.Now()
+	err := p.call(ctx, t.job)
+	result := "success"
+	if err != nil {
+		result = "error"
+		ext.Error.Set(span, true)
+		span.LogFields(otlog.Error(err))
+		log.FromContextOr(ctx, p.logger).Error("Job failed", zap.String("pool", p.name), zap.Error(err))
+	}
+	p.observe(result, time.Since(start))
+}
+
+func (p *Pool) call(ctx context.Context, job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.LogPanic(ctx, p.logger, r)
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return job(ctx)
+}
+
+func (p *Pool) observe(result string, d time.Duration) {
+	if p.metrics == nil {
+		return
+	}
+	p.metrics.jobs.WithLabelValues(p.name, result).Inc()
+	if result != "discarded" {
+		p.metrics.duration.WithLabelValues(p.name).Observe(d.Seconds())
+	}
+}
@@ -0,0 +1,167 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jdotw/go-utils/correlation"
+	"github.com/jdotw/go-utils/identity"
+	"github.com/jdotw/go-utils/log"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPoolPropagatesContext(t *testing.T) {
+	tracer := mocktracer.New()
+	pool := NewPool(Config{Name: "test", Workers: 2, QueueSize: 10}, log.NewMockLogFactory(), tracer)
+
+	parent := tracer.StartSpan("handler")
+	ctx, cancel := context.WithCancel(opentracing.ContextWithSpan(context.Background(), parent))
+	ctx = correlation.WithRequestID(ctx, "req-1")
+	ctx = identity.WithIdentity(ctx, identity.Identity{UserID: "user-1", TenantID: "acme"})
+
+	done := make(chan string, 1)
+	err := pool.Submit(ctx, func(ctx context.Context) error {
+		if ctx.Err() != nil {
+			t.Error("the job should not inherit its submitter's cancellation")
+		}
+		if opentracing.SpanFromContext(ctx) == nil {
+			t.Error("expected the job to run in a span")
+		}
+		if id := identity.FromContext(ctx); id.UserID != "user-1" || id.TenantID != "acme" {
+			t.Errorf("expected the submitter's identity, got %+v", id)
+		}
+		done <- correlation.FromContext(ctx)
+		return nil
+	})
+	cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := <-done; id != "req-1" {
+		t.Errorf("expected the request ID to be propagated, got %q", id)
+	}
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 1 || spans[0].OperationName != "worker.test" {
+		t.Fatalf("expected a worker.test span, got %v", spans)
+	}
+	if spans[0].ParentID != parent.Context().(mocktracer.MockSpanContext).SpanID {
+		t.Error("expected the job span to follow from the submitter's span")
+	}
+}
+
+func TestPoolShutdownDrains(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	pool := NewPool(Config{Workers: 1, QueueSize: 10}, log.NewMockLogFactory(), mocktracer.New(), Metrics(registry))
+
+	var ran int32
+	for i := 0; i < 5; i++ {
+		err := pool.Submit(context.Background(), func(ctx context.Context) error {
+			time.Sleep(time.Millisecond)
+			if atomic.AddInt32(&ran, 1) == 5 {
+				return errors.New("failed")
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if ran != 5 {
+		t.Errorf("expected all queued jobs to run before shutdown returned, ran %d", ran)
+	}
+	if err := pool.Submit(context.Background(), func(context.Context) error { return nil }); err != ErrPoolClosed {
+		t.Errorf("expected ErrPoolClosed after shutdown, got %v", err)
+	}
+
+	m := pool.metrics
+	if n := testutil.ToFloat64(m.jobs.WithLabelValues("default", "success")); n != 4 {
+		t.Errorf("expected 4 successful jobs, got %v", n)
+	}
+	if n := testutil.ToFloat64(m.jobs.WithLabelValues("default", "error")); n != 1 {
+		t.Errorf("expected 1 failed job, got %v", n)
+	}
+	if n := testutil.ToFloat64(m.queueDepth); n != 0 {
+		t.Errorf("expected an empty queue, got %v", n)
+	}
+}
+
+func TestPoolShutdownTimeout(t *testing.T) {
+	pool := NewPool(Config{Workers: 1, QueueSize: 10}, log.NewMockLogFactory(), mocktracer.New())
+
+	var cancelled, ran int32
+	started := make(chan struct{})
+	pool.Submit(context.Background(), func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		atomic.StoreInt32(&cancelled, 1)
+		return ctx.Err()
+	})
+	pool.Submit(context.Background(), func(ctx context.Context) error {
+		atomic.StoreInt32(&ran, 1)
+		return nil
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := pool.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected the shutdown to time out, got %v", err)
+	}
+	if cancelled != 1 {
+		t.Error("expected the running job's context to be cancelled")
+	}
+	if ran != 0 {
+		t.Error("expected the queued job to be discarded")
+	}
+}
+
+func TestTrySubmit(t *testing.T) {
+	pool := NewPool(Config{Workers: 1, QueueSize: 1}, log.NewMockLogFactory(), mocktracer.New())
+	release := make(chan struct{})
+	block := func(context.Context) error {
+		<-release
+		return nil
+	}
+
+	started := make(chan struct{})
+	pool.Submit(context.Background(), func(ctx context.Context) error {
+		close(started)
+		return block(ctx)
+	})
+	<-started
+	if err := pool.TrySubmit(context.Background(), block); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.TrySubmit(context.Background(), block); err != ErrQueueFull {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+	close(release)
+	pool.Shutdown(context.Background())
+}
+
+func TestPoolRecoversPanics(t *testing.T) {
+	pool := NewPool(Config{Workers: 1}, log.NewMockLogFactory(), mocktracer.New())
+	pool.Submit(context.Background(), func(context.Context) error {
+		panic("boom")
+	})
+	done := make(chan struct{})
+	pool.Submit(context.Background(), func(context.Context) error {
+		close(done)
+		return nil
+	})
+	<-done
+	pool.Shutdown(context.Background())
+}